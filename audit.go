@@ -0,0 +1,165 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2
+
+import (
+	"bytes"
+	"errors"
+)
+
+// AuditRecord describes a command that was executed with an audit session tracked by an AuditVerifier.
+type AuditRecord struct {
+	CommandCode CommandCode
+	CpHash      Digest // The command parameter digest that the TPM extended in to the audit digest
+	RpHash      Digest // The response parameter digest that the TPM extended in to the audit digest
+
+	// Exclusive indicates whether the TPM reported the audit session as exclusive in the response to this command.
+	Exclusive bool
+
+	// Preceding contains the commands executed via the same TPMContext after the previous audited command and before this one that
+	// didn't use the audit session. If Exclusive is false, the first of these is the command that caused the session to lose
+	// exclusivity. If it is empty and Exclusive is false, then the intervening command was executed by another user of the TPM.
+	Preceding []CommandCode
+}
+
+// AuditVerifier computes the expected audit digest for an audit session on the host, in order to verify the attestation returned
+// from TPMContext.GetSessionAuditDigest. It is created with TPMContext.NewAuditVerifier, after which it records the command and
+// response parameter digests of every command executed via the same TPMContext with the session and the AttrAudit,
+// AttrAuditExclusive or AttrAuditReset attribute. Commands executed with the AttrAuditReset attribute reset the expected digest
+// and discard the previously recorded commands.
+//
+// Commands are only recorded whilst the session is loaded. Saving the session with TPMContext.ContextSave or flushing it stops
+// recording.
+type AuditVerifier struct {
+	hashAlg   HashAlgorithmId
+	digest    Digest
+	records   []AuditRecord
+	preceding []CommandCode
+}
+
+// NewAuditVerifier begins tracking the audit digest for the supplied HMAC or policy session. The session should not have been used
+// for auditing before this is called, unless its next use for auditing is with the AttrAuditReset attribute.
+func (t *TPMContext) NewAuditVerifier(session SessionContext) (*AuditVerifier, error) {
+	s, isSession := session.(*sessionContext)
+	if !isSession || s.Data() == nil {
+		return nil, makeInvalidArgError("session", "not a HMAC or policy session with complete context data")
+	}
+
+	data := s.Data()
+	if !data.HashAlg.Available() {
+		return nil, makeInvalidArgError("session", "unsupported digest algorithm")
+	}
+
+	v := &AuditVerifier{hashAlg: data.HashAlg, digest: make(Digest, data.HashAlg.Size())}
+	if t.auditVerifiers == nil {
+		t.auditVerifiers = make(map[*sessionContextData]*AuditVerifier)
+	}
+	t.auditVerifiers[data] = v
+	return v, nil
+}
+
+// Digest returns the expected audit digest for the session, computed from the commands that have been recorded.
+func (v *AuditVerifier) Digest() Digest {
+	return append(Digest(nil), v.digest...)
+}
+
+// Records returns the commands that contribute to the expected audit digest, in the order that they were executed.
+func (v *AuditVerifier) Records() []AuditRecord {
+	return append([]AuditRecord(nil), v.records...)
+}
+
+// Verify checks the contents of an attestation structure returned from TPMContext.GetSessionAuditDigest against the expected audit
+// digest. It doesn't verify the signature of the attestation, which should be done separately if it was signed.
+//
+// If the audit digest doesn't match, a *AuditDigestError is returned. If requireExclusive is true and the TPM reports that the
+// session is not exclusive, a *AuditExclusivityError is returned that identifies where exclusivity was lost.
+func (v *AuditVerifier) Verify(attest *Attest, requireExclusive bool) error {
+	if attest == nil || attest.Type != TagAttestSessionAudit || attest.Attested == nil || attest.Attested.SessionAudit == nil {
+		return errors.New("not a session audit attestation")
+	}
+	info := attest.Attested.SessionAudit
+
+	if !bytes.Equal(info.SessionDigest, v.digest) {
+		return &AuditDigestError{Expected: v.Digest(), Digest: info.SessionDigest}
+	}
+
+	if !requireExclusive || info.ExclusiveSession {
+		return nil
+	}
+
+	for i, r := range v.records {
+		if r.Exclusive {
+			continue
+		}
+		e := &AuditExclusivityError{Index: i, Command: r.CommandCode}
+		if len(r.Preceding) > 0 {
+			e.Interrupter = r.Preceding[0]
+		}
+		return e
+	}
+
+	e := &AuditExclusivityError{Index: len(v.records)}
+	if len(v.preceding) > 0 {
+		e.Interrupter = v.preceding[0]
+	}
+	return e
+}
+
+func (v *AuditVerifier) record(commandCode CommandCode, reset bool, cpHash, rpHash Digest, exclusive bool) {
+	if reset {
+		v.digest = make(Digest, v.hashAlg.Size())
+		v.records = nil
+	}
+
+	h := v.hashAlg.NewHash()
+	h.Write(v.digest)
+	h.Write(cpHash)
+	h.Write(rpHash)
+	v.digest = h.Sum(nil)
+
+	v.records = append(v.records, AuditRecord{
+		CommandCode: commandCode,
+		CpHash:      cpHash,
+		RpHash:      rpHash,
+		Exclusive:   exclusive,
+		Preceding:   v.preceding})
+	v.preceding = nil
+}
+
+// auditCommand contains the details of a command that is being executed with an audit session tracked by an AuditVerifier.
+type auditCommand struct {
+	verifier *AuditVerifier
+	index    int // Index of the audit session in the command's authorization area
+	reset    bool
+	cpHash   Digest
+}
+
+func (t *TPMContext) prepareAuditCommand(commandCode CommandCode, handleNames []Name, cpBytes []byte, sessionParams *sessionParams) *auditCommand {
+	for i, s := range sessionParams.sessions {
+		if s.session == nil || s.attrs&(AttrAudit|AttrAuditExclusive|AttrAuditReset) == 0 {
+			continue
+		}
+		v, ok := t.auditVerifiers[s.session.Data()]
+		if !ok {
+			return nil
+		}
+		return &auditCommand{
+			verifier: v,
+			index:    i,
+			reset:    s.attrs&AttrAuditReset != 0,
+			cpHash:   cryptComputeCpHash(v.hashAlg, commandCode, handleNames, cpBytes)}
+	}
+	return nil
+}
+
+// recordAuditInterruptions records the specified command with every AuditVerifier other than the one that audited it, if any.
+func (t *TPMContext) recordAuditInterruptions(commandCode CommandCode, audit *auditCommand) {
+	for _, v := range t.auditVerifiers {
+		if audit != nil && audit.verifier == v {
+			continue
+		}
+		v.preceding = append(v.preceding, commandCode)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+
+	. "github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/testutil"
+
+	"golang.org/x/xerrors"
+)
+
+func makeMockAuditSessionResponse(params []byte, exclusive bool) []byte {
+	attrs := uint8(0x81) // continueSession | audit
+	if exclusive {
+		attrs |= 0x02
+	}
+	b, err := mu.MarshalToBytes(TagSessions, uint32(10+4+len(params)+2+32+1+2), Success, uint32(len(params)), mu.RawBytes(params),
+		make(Nonce, 32), attrs, Auth(nil))
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestAuditVerifier(t *testing.T) {
+	randomBytes := Digest{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
+	getRandomResponse, _ := mu.MarshalToBytes(randomBytes)
+
+	tcti := testutil.NewMockTCTI(
+		&testutil.MockCommand{CommandCode: CommandGetRandom, RawResponse: makeMockAuditSessionResponse(getRandomResponse, true)},
+		&testutil.MockCommand{CommandCode: CommandGetRandom, RawResponse: makeMockAuditSessionResponse(getRandomResponse, true)},
+		&testutil.MockCommand{CommandCode: CommandSelfTest, Response: &testutil.MockResponse{}},
+		&testutil.MockCommand{CommandCode: CommandGetRandom, RawResponse: makeMockAuditSessionResponse(getRandomResponse, false)})
+	tpm, _ := NewTPMContext(tcti)
+
+	session := MakeMockSessionContext(0x03000000, &SessionContextData{
+		HashAlg:     HashAlgorithmSHA256,
+		SessionType: SessionTypePolicy,
+		NonceCaller: make(Nonce, 32),
+		NonceTPM:    make(Nonce, 32)}).WithAttrs(AttrContinueSession | AttrAudit)
+
+	verifier, err := tpm.NewAuditVerifier(session)
+	if err != nil {
+		t.Fatalf("NewAuditVerifier failed: %v", err)
+	}
+
+	// Use RunCommand directly to avoid the capability queries performed by TPMContext.GetRandom.
+	getRandom := func() error {
+		return tpm.RunCommand(CommandGetRandom, []SessionContext{session}, Delimiter, uint16(8), Delimiter, Delimiter, new(Digest))
+	}
+
+	expected := make(Digest, 32)
+	extend := func() {
+		cpHash := CryptComputeCpHash(HashAlgorithmSHA256, CommandGetRandom, nil, []byte{0x00, 0x08})
+		h := sha256.New()
+		binary.Write(h, binary.BigEndian, uint32(Success))
+		binary.Write(h, binary.BigEndian, uint32(CommandGetRandom))
+		h.Write(getRandomResponse)
+		rpHash := h.Sum(nil)
+
+		h = sha256.New()
+		h.Write(expected)
+		h.Write(cpHash)
+		h.Write(rpHash)
+		expected = h.Sum(nil)
+	}
+	makeAttest := func(digest Digest, exclusive bool) *Attest {
+		return &Attest{
+			Magic:    TPMGeneratedValue,
+			Type:     TagAttestSessionAudit,
+			Attested: &AttestU{SessionAudit: &SessionAuditInfo{ExclusiveSession: exclusive, SessionDigest: digest}}}
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := getRandom(); err != nil {
+			t.Fatalf("GetRandom failed: %v", err)
+		}
+		extend()
+	}
+
+	if !bytes.Equal(verifier.Digest(), expected) {
+		t.Errorf("Unexpected digest")
+	}
+	if err := verifier.Verify(makeAttest(expected, true), true); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+
+	var de *AuditDigestError
+	if err := verifier.Verify(makeAttest(make(Digest, 32), true), true); !xerrors.As(err, &de) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// An intervening command that doesn't use the audit session breaks exclusivity.
+	if err := tpm.SelfTest(false); err != nil {
+		t.Fatalf("SelfTest failed: %v", err)
+	}
+	if err := getRandom(); err != nil {
+		t.Fatalf("GetRandom failed: %v", err)
+	}
+	extend()
+
+	if err := verifier.Verify(makeAttest(expected, false), false); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+
+	var ee *AuditExclusivityError
+	err = verifier.Verify(makeAttest(expected, false), true)
+	if !xerrors.As(err, &ee) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ee.Index != 2 || ee.Command != CommandGetRandom || ee.Interrupter != CommandSelfTest {
+		t.Errorf("Unexpected error: %v", ee)
+	}
+	if err.Error() != "audit session lost exclusivity before audited command 2 (TPM_CC_GetRandom) because of command TPM_CC_SelfTest" {
+		t.Errorf("Unexpected error string: %v", err)
+	}
+
+	records := verifier.Records()
+	if len(records) != 3 {
+		t.Fatalf("Unexpected number of records: %d", len(records))
+	}
+	if !records[0].Exclusive || !records[1].Exclusive || records[2].Exclusive {
+		t.Errorf("Unexpected exclusivity in records")
+	}
+	if len(records[2].Preceding) != 1 || records[2].Preceding[0] != CommandSelfTest {
+		t.Errorf("Unexpected preceding commands: %v", records[2].Preceding)
+	}
+}
@@ -6,12 +6,12 @@ package tpm2
 
 import (
 	"bytes"
-	"crypto/hmac"
+	"crypto/subtle"
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"hash"
 	"io"
+	"math"
 
 	"github.com/canonical/go-tpm2/mu"
 
@@ -47,21 +47,34 @@ type authCommand struct {
 
 type commandAuthArea []authCommand
 
-type commandAuthAreaRawSlice struct {
-	Data []authCommand `tpm2:"raw"`
-}
-
+// Marshal implements mu.CustomMarshaller. The auth area is marshalled by hand rather than via
+// reflection because it is built for every command that has sessions.
 func (a commandAuthArea) Marshal(w io.Writer) error {
-	tmpBuf := new(bytes.Buffer)
-	if _, err := mu.MarshalToWriter(tmpBuf, commandAuthAreaRawSlice{[]authCommand(a)}); err != nil {
-		panic(fmt.Sprintf("cannot marshal raw command auth area to temporary buffer: %v", err))
+	size := 0
+	for _, auth := range a {
+		if len(auth.Nonce) > math.MaxUint16 || len(auth.HMAC) > math.MaxUint16 {
+			panic("cannot marshal auth area: nonce or HMAC too large")
+		}
+		size += 4 + 2 + len(auth.Nonce) + 1 + 2 + len(auth.HMAC)
 	}
 
-	if err := binary.Write(w, binary.BigEndian, uint32(tmpBuf.Len())); err != nil {
-		return xerrors.Errorf("cannot write size of auth area to buffer: %w", err)
+	b := make([]byte, 4+size)
+	binary.BigEndian.PutUint32(b, uint32(size))
+	off := 4
+	for _, auth := range a {
+		binary.BigEndian.PutUint32(b[off:], uint32(auth.SessionHandle))
+		off += 4
+		binary.BigEndian.PutUint16(b[off:], uint16(len(auth.Nonce)))
+		off += 2
+		off += copy(b[off:], auth.Nonce)
+		b[off] = byte(auth.SessionAttrs)
+		off++
+		binary.BigEndian.PutUint16(b[off:], uint16(len(auth.HMAC)))
+		off += 2
+		off += copy(b[off:], auth.HMAC)
 	}
 
-	if _, err := tmpBuf.WriteTo(w); err != nil {
+	if _, err := w.Write(b); err != nil {
 		return xerrors.Errorf("cannot write marshalled auth area to buffer: %w", err)
 	}
 	return nil
@@ -82,6 +95,10 @@ type sessionParam struct {
 	associatedContext ResourceContext // The resource associated with an authorization - can be nil
 	includeAuthValue  bool            // Whether the authorization value of associatedContext is included in the HMAC key
 
+	// attrs are the attributes of session for this command. These may exclude parameter encryption attributes of a session that
+	// is used for authorization if the command doesn't support parameter encryption.
+	attrs SessionAttributes
+
 	decryptNonce Nonce
 	encryptNonce Nonce
 }
@@ -101,7 +118,7 @@ func (s *sessionParam) computeSessionHMACKey() []byte {
 
 func (s *sessionParam) computeHMAC(pHash []byte, nonceNewer, nonceOlder, nonceDecrypt, nonceEncrypt Nonce, attrs sessionAttrs) ([]byte, bool) {
 	key := s.computeSessionHMACKey()
-	h := hmac.New(func() hash.Hash { return s.session.Data().HashAlg.NewHash() }, key)
+	h := s.session.hmacForKey(key)
 
 	h.Write(pHash)
 	h.Write(nonceNewer)
@@ -116,7 +133,7 @@ func (s *sessionParam) computeHMAC(pHash []byte, nonceNewer, nonceOlder, nonceDe
 func (s *sessionParam) computeCommandHMAC(commandCode CommandCode, commandHandles []Name, cpBytes []byte) []byte {
 	data := s.session.Data()
 	cpHash := cryptComputeCpHash(data.HashAlg, commandCode, commandHandles, cpBytes)
-	h, _ := s.computeHMAC(cpHash, data.NonceCaller, data.NonceTPM, s.decryptNonce, s.encryptNonce, s.session.tpmAttrs())
+	h, _ := s.computeHMAC(cpHash, data.NonceCaller, data.NonceTPM, s.decryptNonce, s.encryptNonce, s.attrs.tpmAttrs())
 	return h
 }
 
@@ -138,7 +155,7 @@ func (s *sessionParam) buildCommandSessionAuth(commandCode CommandCode, commandH
 	return &authCommand{
 		SessionHandle: s.session.Handle(),
 		Nonce:         data.NonceCaller,
-		SessionAttrs:  s.session.tpmAttrs(),
+		SessionAttrs:  s.attrs.tpmAttrs(),
 		HMAC:          hmac}
 }
 
@@ -179,7 +196,7 @@ func (s *sessionParam) processResponseAuth(resp authResponse, responseCode Respo
 	}
 
 	hmac, hmacRequired := s.computeResponseHMAC(resp, responseCode, commandCode, rpBytes)
-	if (hmacRequired || len(resp.HMAC) > 0) && !bytes.Equal(hmac, resp.HMAC) {
+	if (hmacRequired || len(resp.HMAC) > 0) && subtle.ConstantTimeCompare(hmac, resp.HMAC) != 1 {
 		return errors.New("incorrect HMAC")
 	}
 
@@ -210,7 +227,7 @@ func (p *sessionParams) findSessionWithAttr(attr SessionAttributes) (*sessionPar
 		if session.session == nil {
 			continue
 		}
-		if session.session.attrs&attr > 0 {
+		if session.attrs&attr > 0 {
 			return session, i
 		}
 	}
@@ -228,6 +245,7 @@ func (p *sessionParams) validateAndAppend(s *sessionParam) error {
 		if data == nil {
 			return errors.New("invalid context for session: incomplete session can only be used in TPMContext.FlushContext")
 		}
+		s.attrs = s.session.attrs
 		switch data.SessionType {
 		case SessionTypeHMAC:
 			switch {
@@ -261,6 +279,9 @@ func (p *sessionParams) validateAndAppend(s *sessionParam) error {
 
 func (p *sessionParams) validateAndAppendAuth(in ResourceContextWithSession) error {
 	sc, _ := in.Session.(*sessionContext)
+	if sc != nil && sc.isPassword() {
+		sc = nil
+	}
 	associatedContext := in.Context
 	if associatedContext == nil {
 		associatedContext = makePermanentContext(HandleNull)
@@ -274,7 +295,11 @@ func (p *sessionParams) validateAndAppendExtra(in []SessionContext) error {
 		if s == nil {
 			continue
 		}
-		if err := p.validateAndAppend(&sessionParam{session: s.(*sessionContext)}); err != nil {
+		sc := s.(*sessionContext)
+		if sc.isPassword() {
+			return errors.New("the password session can only be used for authorization")
+		}
+		if err := p.validateAndAppend(&sessionParam{session: sc}); err != nil {
 			return err
 		}
 	}
@@ -282,21 +307,102 @@ func (p *sessionParams) validateAndAppendExtra(in []SessionContext) error {
 	return nil
 }
 
-func (p *sessionParams) computeCallerNonces() error {
+// useDefaultSession replaces the first password authorization with the supplied HMAC session, unless it is already supplied for
+// this command. A session can only appear once in a command, so any other password authorizations are left alone. The parameter encryption attributes of the session are dropped if another session is already used for parameter
+// encryption.
+func (p *sessionParams) useDefaultSession(session *sessionContext) error {
+	if session == nil {
+		return nil
+	}
+	var attrs SessionAttributes
+	for _, s := range p.sessions {
+		if s.session == session {
+			return nil
+		}
+		if s.session != nil {
+			attrs |= s.attrs
+		}
+	}
+
+	sessions := p.sessions
+	p.sessions = nil
+	used := false
+	for _, s := range sessions {
+		if used || s.session != nil || !s.isAuth() {
+			p.sessions = append(p.sessions, s)
+			continue
+		}
+		if err := p.validateAndAppend(&sessionParam{associatedContext: s.associatedContext, session: session}); err != nil {
+			return xerrors.Errorf("cannot use default session: %w", err)
+		}
+		p.sessions[len(p.sessions)-1].attrs &^= attrs & (AttrCommandEncrypt | AttrResponseEncrypt)
+		used = true
+	}
+	return nil
+}
+
+// validateAttrs checks that the attributes of the sessions are valid for the specified command, so that a descriptive error can be
+// returned for misuse that would otherwise result in a TPM_RC_ATTRIBUTES or TPM_RC_SYMMETRIC error from the TPM.
+func (p *sessionParams) validateAttrs(commandCode CommandCode) error {
+	if len(p.sessions) > 0 && !isSessionAllowed(commandCode) {
+		return fmt.Errorf("command %s does not accept sessions", commandCode)
+	}
+
+	var audit, decrypt, encrypt bool
+	for i, s := range p.sessions {
+		if s.session == nil {
+			continue
+		}
+		attrs := s.attrs
+
+		if attrs&(AttrAudit|AttrAuditExclusive|AttrAuditReset) != 0 {
+			if audit {
+				return fmt.Errorf("session at index %d is used for audit, but only one session can be used for audit", i)
+			}
+			audit = true
+		}
+		if attrs&AttrCommandEncrypt != 0 {
+			if decrypt {
+				return fmt.Errorf("session at index %d is used for command parameter encryption, but only one session can be", i)
+			}
+			decrypt = true
+		}
+		if attrs&AttrResponseEncrypt != 0 {
+			if encrypt {
+				return fmt.Errorf("session at index %d is used for response parameter encryption, but only one session can be", i)
+			}
+			encrypt = true
+		}
+
+		if attrs&(AttrCommandEncrypt|AttrResponseEncrypt) != 0 {
+			if sym := s.session.Data().Symmetric; sym == nil || sym.Algorithm == SymAlgorithmNull {
+				return fmt.Errorf("session at index %d is used for parameter encryption, but was started without a symmetric algorithm", i)
+			}
+		}
+
+		if !s.isAuth() && attrs&(AttrAudit|AttrAuditExclusive|AttrAuditReset|AttrCommandEncrypt|AttrResponseEncrypt) == 0 {
+			return fmt.Errorf("session at index %d is not used for authorization, audit or parameter encryption", i)
+		}
+	}
+
+	return nil
+}
+
+func (p *sessionParams) computeCallerNonces(rand io.Reader) error {
 	for _, s := range p.sessions {
 		if s.session == nil {
 			continue
 		}
 
-		if err := cryptComputeNonce(s.session.Data().NonceCaller); err != nil {
+		if err := cryptComputeNonce(rand, s.session.Data().NonceCaller); err != nil {
 			return fmt.Errorf("cannot compute new caller nonce: %v", err)
 		}
 	}
 	return nil
 }
 
-func (p *sessionParams) buildCommandAuthArea(commandCode CommandCode, commandHandles []Name, cpBytes []byte) (commandAuthArea, error) {
-	if err := p.computeCallerNonces(); err != nil {
+func (p *sessionParams) buildCommandAuthArea(rand io.Reader, commandCode CommandCode, commandHandles []Name, cpBytes []byte) (commandAuthArea, error) {
+	if err := p.computeCallerNonces(rand); err != nil {
 		return nil, fmt.Errorf("cannot compute caller nonces: %v", err)
 	}
 
@@ -316,7 +422,7 @@ func (p *sessionParams) buildCommandAuthArea(commandCode CommandCode, commandHan
 	return area, nil
 }
 
-func (p *sessionParams) invalidateSessionContexts(authResponses []authResponse) {
+func (p *sessionParams) invalidateSessionContexts(authResponses []authResponse) (invalidated []SessionContext) {
 	for i, resp := range authResponses {
 		session := p.sessions[i].session
 		if session == nil {
@@ -326,12 +432,44 @@ func (p *sessionParams) invalidateSessionContexts(authResponses []authResponse)
 			continue
 		}
 		session.invalidate()
+		invalidated = append(invalidated, session)
 	}
+	return invalidated
 }
 
-func (p *sessionParams) processResponseAuthArea(authResponses []authResponse, responseCode ResponseCode, rpBytes []byte) error {
-	defer p.invalidateSessionContexts(authResponses)
+// validateResponseAuthArea checks that the session attributes and nonces in a response authorization area are consistent with the
+// corresponding command authorizations, for strict response validation.
+func (p *sessionParams) validateResponseAuthArea(authResponses []authResponse) error {
+	for i, resp := range authResponses {
+		s := p.sessions[i]
+
+		if s.session == nil {
+			if len(resp.Nonce) > 0 || len(resp.HMAC) > 0 || resp.SessionAttrs != attrContinueSession {
+				return fmt.Errorf("invalid response for password session at index %d", i)
+			}
+			continue
+		}
 
+		const echoedAttrs = attrContinueSession | attrDecrypt | attrEncrypt | attrAudit
+		cmdAttrs := s.attrs.tpmAttrs()
+		switch {
+		case resp.SessionAttrs&^(echoedAttrs|attrAuditExclusive) != 0:
+			return fmt.Errorf("session at index %d has invalid attributes set (0x%02x)", i, uint8(resp.SessionAttrs))
+		case resp.SessionAttrs&echoedAttrs != cmdAttrs&echoedAttrs:
+			return fmt.Errorf("session at index %d has attributes that don't match the command (got 0x%02x, expected 0x%02x)", i,
+				uint8(resp.SessionAttrs&echoedAttrs), uint8(cmdAttrs&echoedAttrs))
+		case resp.SessionAttrs&attrAuditExclusive != 0 && resp.SessionAttrs&attrAudit == 0:
+			return fmt.Errorf("session at index %d has auditExclusive set without audit", i)
+		case len(resp.Nonce) != len(s.session.Data().NonceTPM):
+			return fmt.Errorf("session at index %d has a nonce with the wrong size (got %d, expected %d)", i, len(resp.Nonce),
+				len(s.session.Data().NonceTPM))
+		}
+	}
+
+	return nil
+}
+
+func (p *sessionParams) processResponseAuthArea(authResponses []authResponse, responseCode ResponseCode, rpBytes []byte) error {
 	for i, resp := range authResponses {
 		if err := p.sessions[i].processResponseAuth(resp, responseCode, p.commandCode, rpBytes); err != nil {
 			return fmt.Errorf("encountered an error for session at index %d: %v", i, err)
@@ -5,10 +5,14 @@
 package tpm2_test
 
 import (
+	"bytes"
 	"testing"
 
 	. "github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
 	"github.com/canonical/go-tpm2/testutil"
+
+	"golang.org/x/xerrors"
 )
 
 func TestHMACSessions(t *testing.T) {
@@ -107,6 +111,55 @@ func TestHMACSessions(t *testing.T) {
 	}
 }
 
+func TestHMACSessionBoundToNVIndex(t *testing.T) {
+	tpm := openTPMForTesting(t, testutil.TPMFeatureOwnerPersist)
+	defer closeTPM(t, tpm)
+
+	owner := tpm.OwnerHandleContext()
+
+	pub := NVPublic{
+		Index:   Handle(0x0181ffff),
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeCounter.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead),
+		Size:    8}
+	rc, err := tpm.NVDefineSpace(owner, testAuth, &pub, nil)
+	if err != nil {
+		t.Fatalf("NVDefineSpace failed: %v", err)
+	}
+	defer undefineNVSpace(t, tpm, rc, owner)
+
+	sc, err := tpm.StartAuthSession(nil, rc, SessionTypeHMAC, nil, HashAlgorithmSHA256)
+	if err != nil {
+		t.Fatalf("StartAuthSession failed: %v", err)
+	}
+	defer flushContext(t, tpm, sc)
+	sc.SetAttrs(AttrContinueSession)
+
+	// The first increment is authorized with the session bound to the index. This sets AttrNVWritten, which changes the
+	// name of the index so that the session is no longer bound to it.
+	if err := tpm.NVIncrement(rc, rc, sc); err != nil {
+		t.Fatalf("NVIncrement failed: %v", err)
+	}
+	if err := tpm.NVIncrement(rc, rc, sc); err != nil {
+		t.Fatalf("NVIncrement failed: %v", err)
+	}
+
+	count, err := tpm.NVReadCounter(rc, rc, sc)
+	if err != nil {
+		t.Fatalf("NVReadCounter failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Unexpected count: %d", count)
+	}
+
+	if err := tpm.NVChangeAuth(rc, []byte("bar"), sc); err != nil {
+		t.Fatalf("NVChangeAuth failed: %v", err)
+	}
+	if err := tpm.NVIncrement(rc, rc, sc); err != nil {
+		t.Errorf("NVIncrement failed: %v", err)
+	}
+}
+
 func TestPolicySessions(t *testing.T) {
 	tpm := openTPMForTesting(t, testutil.TPMFeatureOwnerHierarchy)
 	defer closeTPM(t, tpm)
@@ -203,3 +256,150 @@ func TestPolicySessions(t *testing.T) {
 		})
 	}
 }
+
+func TestSessionAttributeValidation(t *testing.T) {
+	makeSession := func(handle Handle, symmetric *SymDef, attrs SessionAttributes) SessionContext {
+		return MakeMockSessionContext(handle, &SessionContextData{
+			HashAlg:     HashAlgorithmSHA256,
+			SessionType: SessionTypeHMAC,
+			SessionKey:  make([]byte, 32),
+			NonceCaller: make(Nonce, 32),
+			NonceTPM:    make(Nonce, 32),
+			Symmetric:   symmetric}).WithAttrs(attrs)
+	}
+	aes := &SymDef{Algorithm: SymAlgorithmAES, KeyBits: &SymKeyBitsU{Sym: 128}, Mode: &SymModeU{Sym: SymModeCFB}}
+	null := &SymDef{Algorithm: SymAlgorithmNull}
+
+	tcti := testutil.NewMockTCTI()
+	tpm, _ := NewTPMContext(tcti)
+
+	for _, data := range []struct {
+		desc        string
+		commandCode CommandCode
+		sessions    []SessionContext
+		params      []interface{}
+		err         string
+	}{
+		{
+			desc:        "SessionsNotAllowed",
+			commandCode: CommandFlushContext,
+			sessions:    []SessionContext{makeSession(0x02000000, null, AttrContinueSession|AttrAudit)},
+			params:      []interface{}{Delimiter, Handle(0x80000001)},
+			err:         "command TPM_CC_FlushContext does not accept sessions",
+		},
+		{
+			desc:        "MultipleAudit",
+			commandCode: CommandGetRandom,
+			sessions: []SessionContext{
+				makeSession(0x02000000, null, AttrContinueSession|AttrAudit),
+				makeSession(0x02000001, null, AttrContinueSession|AttrAuditExclusive)},
+			params: []interface{}{Delimiter, uint16(8), Delimiter, Delimiter, new(Digest)},
+			err:    "session at index 1 is used for audit, but only one session can be used for audit",
+		},
+		{
+			desc:        "MultipleResponseEncrypt",
+			commandCode: CommandGetRandom,
+			sessions: []SessionContext{
+				makeSession(0x02000000, aes, AttrContinueSession|AttrResponseEncrypt),
+				makeSession(0x02000001, aes, AttrContinueSession|AttrResponseEncrypt)},
+			params: []interface{}{Delimiter, uint16(8), Delimiter, Delimiter, new(Digest)},
+			err:    "session at index 1 is used for response parameter encryption, but only one session can be",
+		},
+		{
+			desc:        "NoSymmetric",
+			commandCode: CommandGetRandom,
+			sessions:    []SessionContext{makeSession(0x02000000, null, AttrContinueSession|AttrResponseEncrypt)},
+			params:      []interface{}{Delimiter, uint16(8), Delimiter, Delimiter, new(Digest)},
+			err:         "session at index 0 is used for parameter encryption, but was started without a symmetric algorithm",
+		},
+		{
+			desc:        "ResponseNotEncryptable",
+			commandCode: CommandPCRReset,
+			sessions:    []SessionContext{makeSession(0x02000000, aes, AttrContinueSession|AttrResponseEncrypt)},
+			params:      []interface{}{tpm.PCRHandleContext(7)},
+			err:         "command TPM_CC_PCR_Reset does not support response parameter encryption",
+		},
+		{
+			desc:        "UnusedSession",
+			commandCode: CommandGetRandom,
+			sessions:    []SessionContext{makeSession(0x02000000, aes, AttrContinueSession)},
+			params:      []interface{}{Delimiter, uint16(8), Delimiter, Delimiter, new(Digest)},
+			err:         "session at index 0 is not used for authorization, audit or parameter encryption",
+		},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			err := tpm.RunCommand(data.commandCode, data.sessions, data.params...)
+			if err == nil {
+				t.Fatalf("RunCommand should have failed")
+			}
+			if err.Error() != data.err {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+
+	if len(tcti.Commands()) > 0 {
+		t.Errorf("Commands were sent to the TPM")
+	}
+}
+
+func TestPasswordSession(t *testing.T) {
+	tcti := testutil.NewMockTCTI(&testutil.MockCommand{CommandCode: CommandPCRReset, Response: &testutil.MockResponse{PasswordSessions: 1}})
+	tpm, _ := NewTPMContext(tcti)
+
+	pcr := tpm.PCRHandleContext(7)
+	pcr.SetAuthValue([]byte("foo"))
+	if err := tpm.PCRReset(pcr, PasswordSession()); err != nil {
+		t.Fatalf("PCRReset failed: %v", err)
+	}
+
+	// The command should contain a single password authorization with the authorization value in cleartext.
+	expected, err := mu.MarshalToBytes(TagSessions, uint32(30), CommandPCRReset, Handle(7), uint32(12), HandlePW, Nonce(nil), uint8(1), Auth("foo"))
+	if err != nil {
+		t.Fatalf("MarshalToBytes failed: %v", err)
+	}
+	if !bytes.Equal(tcti.Commands()[0], expected) {
+		t.Errorf("Unexpected command: %x", tcti.Commands()[0])
+	}
+
+	var digest Digest
+	err = tpm.RunCommand(CommandGetRandom, []SessionContext{PasswordSession()}, Delimiter, uint16(8), Delimiter, Delimiter, &digest)
+	if err == nil || err.Error() != "cannot process non-auth SessionContext parameters for command TPM_CC_GetRandom: the password session "+
+		"can only be used for authorization" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(tcti.Commands()) != 1 {
+		t.Errorf("Unexpected commands sent to the TPM")
+	}
+}
+
+func TestRejectPasswordAuthorizations(t *testing.T) {
+	tcti := testutil.NewMockTCTI(&testutil.MockCommand{CommandCode: CommandHierarchyChangeAuth, Handles: []Handle{HandleOwner},
+		Response: &testutil.MockResponse{PasswordSessions: 1}})
+	tpm, _ := NewTPMContext(tcti)
+	tpm.SetRejectPasswordAuthorizations(true)
+
+	err := tpm.HierarchyChangeAuth(tpm.OwnerHandleContext(), Auth("foo"), nil)
+	var e *PasswordAuthorizationError
+	if !xerrors.As(err, &e) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if e.Command != CommandHierarchyChangeAuth || e.Handle != HandleOwner {
+		t.Errorf("Unexpected error: %v", e)
+	}
+	if len(tcti.Commands()) != 0 {
+		t.Errorf("Command should not have been submitted")
+	}
+
+	if err := tpm.HierarchyChangeAuth(tpm.OwnerHandleContext(), Auth("foo"), PasswordSession()); !xerrors.As(err, &e) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	tpm.SetRejectPasswordAuthorizations(false)
+	if err := tpm.HierarchyChangeAuth(tpm.OwnerHandleContext(), Auth("foo"), nil); err != nil {
+		t.Errorf("HierarchyChangeAuth failed: %v", err)
+	}
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+}
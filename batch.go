@@ -0,0 +1,219 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+type batchedCommand struct {
+	commandCode    CommandCode
+	params         *runCommandParams
+	cmd            *preparedCommand
+	responseParams []interface{}
+	start          time.Time
+}
+
+// CommandBatch is used to queue several independent commands so that they can be executed back-to-back with a single call. It is
+// useful for bulk operations such as reading many PCRs or NV indices.
+//
+// CommandBatch shares the TPMContext that created it, and like TPMContext, it is not safe to use from more than one goroutine at a
+// time.
+type CommandBatch struct {
+	tpm      *TPMContext
+	commands []*batchedCommand
+}
+
+// NewCommandBatch returns a new CommandBatch for queueing commands to be executed on this TPMContext.
+func (t *TPMContext) NewCommandBatch() *CommandBatch {
+	return &CommandBatch{tpm: t}
+}
+
+// Queue validates the command specified by commandCode and adds it to this batch. The params argument has the same format as for
+// TPMContext.RunCommand, and any response handle or response parameter pointers are populated when the batch is executed. The
+// command is marshalled when the batch is executed, so that it uses the authorization values at that time.
+//
+// Commands that require authorization can only be queued with passwords, by supplying a ResourceContextWithSession with a nil
+// Session. HMAC and policy sessions are not supported, because the authorization for each command depends on the response to the
+// previous command that used the session.
+func (b *CommandBatch) Queue(commandCode CommandCode, params ...interface{}) error {
+	p, err := splitCommandParams(commandCode, nil, params)
+	if err != nil {
+		return err
+	}
+	for _, s := range p.sessionParams.sessions {
+		if s.session != nil {
+			return fmt.Errorf("cannot queue command %s: only password authorizations are supported", commandCode)
+		}
+	}
+
+	b.commands = append(b.commands, &batchedCommand{commandCode: commandCode, params: p, responseParams: p.responseParams})
+	return nil
+}
+
+// Len returns the number of commands queued in this batch.
+func (b *CommandBatch) Len() int {
+	return len(b.commands)
+}
+
+// Execute submits each of the queued commands to the TPM in the order in which they were queued, and then empties the batch. As the
+// commands are independent, a failure of one command does not prevent the remaining commands from being executed. The returned
+// slice contains an entry for each command, which will be nil if the command succeeded or the error that would have been returned
+// from TPMContext.RunCommand if it failed.
+//
+// The commands are marshalled and checked against the current state of the TPMContext here, so a command fails if the
+// TPMContext has been configured to reject password authorizations since it was queued. If the TPMContext was created with
+// SharedTCTI.NewTPMContext, commands from other TPMContext instances are not interleaved with the batch. If the transmission
+// interface supports pipelining, each command is written before the response to the previous one has been read. In this case,
+// commands that fail with a warning accepted by the retry policy are resubmitted after the rest of the batch.
+//
+// If the transmission interface returns an error, the remaining commands are abandoned and their entries are set to
+// ErrBatchAborted. When pipelining, a command that was abandoned whilst awaiting its response may have been executed by the TPM.
+func (b *CommandBatch) Execute() []error {
+	t := b.tpm
+	errs := make([]error, len(b.commands))
+	defer func() { b.commands = nil }()
+
+	if e, ok := t.tcti.(exclusiveTCTI); ok {
+		e.lockExclusive()
+		defer e.unlockExclusive()
+	}
+
+	var ready []int
+	for i, c := range b.commands {
+		p := c.params
+		cmd, err := t.prepareCommand(c.commandCode, &p.sessionParams, p.commandHandles, p.commandParams, p.responseHandles)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		c.cmd = cmd
+		ready = append(ready, i)
+	}
+
+	if t.canPipeline(nil, nil) {
+		b.executePipelined(ready, errs)
+	} else {
+		b.executeSequential(ready, errs)
+	}
+	return errs
+}
+
+// executeSequential submits the specified commands one at a time.
+func (b *CommandBatch) executeSequential(indices []int, errs []error) {
+	for n, i := range indices {
+		c := b.commands[i]
+		if err := b.tpm.submitPreparedCommand(c.cmd); err != nil {
+			errs[i] = err
+			if isBatchAbortError(err) {
+				for _, j := range indices[n+1:] {
+					errs[j] = ErrBatchAborted
+				}
+				return
+			}
+			continue
+		}
+		errs[i] = b.tpm.processLastAuthResponse(c.responseParams)
+	}
+}
+
+// executePipelined submits the specified commands, writing each command before the response to the previous one has been read.
+// Commands that fail with a warning accepted by the retry policy are resubmitted with executeSequential once every other command
+// has completed.
+func (b *CommandBatch) executePipelined(indices []int, errs []error) {
+	t := b.tpm
+
+	var pending []int
+	var retry []int
+	next := 0
+	aborted := false
+
+	for len(pending) > 0 || (!aborted && next < len(indices)) {
+		// Keep one command queued behind the one that the TPM is executing.
+		for !aborted && next < len(indices) && len(pending) < 2 {
+			i := indices[next]
+			c := b.commands[i]
+			if err := t.writeCommandBytes(c.cmd.tag, c.cmd.commandCode, c.cmd.packet); err != nil {
+				errs[i] = err
+				aborted = true
+				break
+			}
+			next++
+			if len(pending) == 0 {
+				c.start = t.now()
+			}
+			pending = append(pending, i)
+		}
+		if len(pending) == 0 {
+			break
+		}
+
+		i := pending[0]
+		pending = pending[1:]
+		c := b.commands[i]
+
+		rspBuf := getPacketBuffer(t.responseBufferSize())
+		responseCode, responseTag, responseBytes, err := t.readResponseBytes(c.cmd.commandCode, *rspBuf)
+		if err != nil {
+			putPacketBuffer(rspBuf)
+			errs[i] = err
+			for _, j := range pending {
+				errs[j] = ErrBatchAborted
+			}
+			pending = nil
+			aborted = true
+			continue
+		}
+		t.recordCommand(c.cmd, t.now().Sub(c.start), responseCode)
+		if len(pending) > 0 {
+			// The TPM only starts executing the next command once it has finished with this one.
+			b.commands[pending[0]].start = t.now()
+		}
+
+		if responseCode != Success {
+			putPacketBuffer(rspBuf)
+			err := t.makeResponseError(c.cmd, responseCode)
+			if t.retryPolicy(err) {
+				retry = append(retry, i)
+				continue
+			}
+			errs[i] = t.annotateHierarchyDisabledError(makeTypedFailureError(err), c.cmd.resources)
+			continue
+		}
+		if err := t.completePreparedCommand(c.cmd, responseCode, responseTag, responseBytes, rspBuf); err != nil {
+			putPacketBuffer(rspBuf)
+			errs[i] = err
+			continue
+		}
+		errs[i] = t.processLastAuthResponse(c.responseParams)
+	}
+
+	for _, i := range indices[next:] {
+		if errs[i] == nil {
+			errs[i] = ErrBatchAborted
+		}
+	}
+	if aborted {
+		for _, i := range retry {
+			errs[i] = ErrBatchAborted
+		}
+		return
+	}
+	b.executeSequential(retry, errs)
+}
+
+// isBatchAbortError indicates whether an error from submitting a command means that the rest of a batch cannot be submitted.
+func isBatchAbortError(err error) bool {
+	var e *TctiError
+	return xerrors.As(err, &e)
+}
+
+// ErrBatchAborted is returned from CommandBatch.Execute for commands that were not completed because an earlier command in the
+// batch failed with an error from the transmission interface.
+var ErrBatchAborted = errors.New("the command was not completed because the batch was aborted")
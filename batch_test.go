@@ -0,0 +1,216 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/testutil"
+
+	"golang.org/x/xerrors"
+)
+
+func TestCommandBatch(t *testing.T) {
+	tcti := testutil.NewMockTCTI(
+		&testutil.MockCommand{CommandCode: CommandGetRandom, Response: &testutil.MockResponse{Params: []interface{}{Digest{0xa5, 0x5a}}}},
+		&testutil.MockCommand{CommandCode: CommandPCRReset, Handles: []Handle{7}, Response: &testutil.MockResponse{ResponseCode: ResponseCode(0x184)}},
+		&testutil.MockCommand{CommandCode: CommandGetRandom, Response: &testutil.MockResponse{Params: []interface{}{Digest{0x12, 0x34}}}})
+	tpm, _ := NewTPMContext(tcti)
+
+	batch := tpm.NewCommandBatch()
+	var d1, d3 Digest
+	if err := batch.Queue(CommandGetRandom, Delimiter, uint16(2), Delimiter, Delimiter, &d1); err != nil {
+		t.Fatalf("Queue failed: %v", err)
+	}
+	if err := batch.Queue(CommandPCRReset, ResourceContextWithSession{Context: tpm.PCRHandleContext(7)}); err != nil {
+		t.Fatalf("Queue failed: %v", err)
+	}
+	if err := batch.Queue(CommandGetRandom, Delimiter, uint16(2), Delimiter, Delimiter, &d3); err != nil {
+		t.Fatalf("Queue failed: %v", err)
+	}
+	if batch.Len() != 3 {
+		t.Errorf("Unexpected length: %d", batch.Len())
+	}
+	if len(tcti.Commands()) != 0 {
+		t.Errorf("Commands submitted before Execute")
+	}
+
+	errs := batch.Execute()
+	if len(errs) != 3 {
+		t.Fatalf("Unexpected number of results: %d", len(errs))
+	}
+	if errs[0] != nil || !bytes.Equal(d1, []byte{0xa5, 0x5a}) {
+		t.Errorf("Unexpected result for command 0: %v, %x", errs[0], d1)
+	}
+	if !IsTPMHandleError(errs[1], ErrorValue, CommandPCRReset, 1) {
+		t.Errorf("Unexpected error for command 1: %v", errs[1])
+	}
+	if errs[2] != nil || !bytes.Equal(d3, []byte{0x12, 0x34}) {
+		t.Errorf("Unexpected result for command 2: %v, %x", errs[2], d3)
+	}
+	if batch.Len() != 0 {
+		t.Errorf("Batch wasn't emptied")
+	}
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+}
+
+func TestCommandBatchAborted(t *testing.T) {
+	tcti := testutil.NewMockTCTI(&testutil.MockCommand{CommandCode: CommandSelfTest, WriteError: errors.New("write failed")})
+	tpm, _ := NewTPMContext(tcti)
+
+	batch := tpm.NewCommandBatch()
+	for i := 0; i < 2; i++ {
+		if err := batch.Queue(CommandSelfTest, Delimiter, false); err != nil {
+			t.Fatalf("Queue failed: %v", err)
+		}
+	}
+
+	errs := batch.Execute()
+	var e *TctiError
+	if !xerrors.As(errs[0], &e) {
+		t.Errorf("Unexpected error for command 0: %v", errs[0])
+	}
+	if errs[1] != ErrBatchAborted {
+		t.Errorf("Unexpected error for command 1: %v", errs[1])
+	}
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+}
+
+func TestCommandBatchRejectsSessions(t *testing.T) {
+	tpm, _ := NewTPMContext(testutil.NewMockTCTI())
+	session := MakeMockSessionContext(0x03000000, &SessionContextData{HashAlg: HashAlgorithmSHA256, SessionType: SessionTypePolicy})
+
+	batch := tpm.NewCommandBatch()
+	err := batch.Queue(CommandPCRReset, ResourceContextWithSession{Context: tpm.PCRHandleContext(7), Session: session})
+	if err == nil || err.Error() != "cannot queue command TPM_CC_PCR_Reset: only password authorizations are supported" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if batch.Len() != 0 {
+		t.Errorf("Command was queued")
+	}
+}
+
+func TestCommandBatchRevalidatesAtExecute(t *testing.T) {
+	tcti := testutil.NewMockTCTI()
+	tpm, _ := NewTPMContext(tcti)
+
+	batch := tpm.NewCommandBatch()
+	if err := batch.Queue(CommandPCRReset, ResourceContextWithSession{Context: tpm.PCRHandleContext(7)}); err != nil {
+		t.Fatalf("Queue failed: %v", err)
+	}
+
+	// Password authorizations are rejected when the batch is executed, even though the command was queued beforehand.
+	tpm.SetRejectPasswordAuthorizations(true)
+	errs := batch.Execute()
+	var e *PasswordAuthorizationError
+	if !xerrors.As(errs[0], &e) {
+		t.Errorf("Unexpected error: %v", errs[0])
+	}
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+}
+
+func TestCommandBatchPipelined(t *testing.T) {
+	getRandom := func(rsp *testutil.MockResponse) *testutil.MockCommand {
+		return &testutil.MockCommand{CommandCode: CommandGetRandom, Response: rsp}
+	}
+	tcti := testutil.NewMockTCTI(
+		getRandom(&testutil.MockResponse{Params: []interface{}{Digest{0x01}}}),
+		// TPM_RC_RETRY
+		getRandom(&testutil.MockResponse{ResponseCode: ResponseCode(0x922)}),
+		getRandom(&testutil.MockResponse{Params: []interface{}{Digest{0x03}}}),
+		getRandom(&testutil.MockResponse{Params: []interface{}{Digest{0x02}}}))
+	tcti.EnablePipelining()
+	tpm, _ := NewTPMContext(tcti)
+
+	batch := tpm.NewCommandBatch()
+	digests := make([]Digest, 3)
+	for i := range digests {
+		if err := batch.Queue(CommandGetRandom, Delimiter, uint16(1), Delimiter, Delimiter, &digests[i]); err != nil {
+			t.Fatalf("Queue failed: %v", err)
+		}
+	}
+
+	// The command that failed with TPM_RC_RETRY is resubmitted after the rest of the batch.
+	errs := batch.Execute()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Unexpected error for command %d: %v", i, err)
+		}
+		if !bytes.Equal(digests[i], []byte{byte(i + 1)}) {
+			t.Errorf("Unexpected result for command %d: %x", i, digests[i])
+		}
+	}
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+	if tcti.MaxOutstanding() != 2 {
+		t.Errorf("Commands were not pipelined (max outstanding: %d)", tcti.MaxOutstanding())
+	}
+}
+
+func TestCommandBatchSharedTCTI(t *testing.T) {
+	var other *TPMContext
+	var wg sync.WaitGroup
+	getRandom := &testutil.MockResponse{Params: []interface{}{Digest{0x01}}}
+
+	tcti := testutil.NewMockTCTI(
+		sharedCommandAttrs(),
+		&testutil.MockCommand{CommandCode: CommandGetRandom, Response: getRandom},
+		&testutil.MockCommand{
+			CommandCode: CommandGetRandom,
+			Params: func([]byte) error {
+				// Submit a command from another TPMContext whilst the batch is executing. It shouldn't be interleaved with
+				// the rest of the batch.
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					other.RunCommandBytes(TagNoSessions, CommandGetRandom, []byte{0x00, 0x01})
+				}()
+				time.Sleep(10 * time.Millisecond)
+				return nil
+			},
+			Response: getRandom},
+		&testutil.MockCommand{CommandCode: CommandReadClock, Response: &testutil.MockResponse{Params: []interface{}{&TimeInfo{}}}},
+		&testutil.MockCommand{CommandCode: CommandGetRandom, Response: getRandom})
+	shared := NewSharedTCTI(tcti)
+	tpm := shared.NewTPMContext()
+	other = shared.NewTPMContext()
+
+	// Make sure that the command attributes have been loaded.
+	if _, _, _, err := tpm.RunCommandBytes(TagNoSessions, CommandGetRandom, []byte{0x00, 0x01}); err != nil {
+		t.Fatalf("RunCommandBytes failed: %v", err)
+	}
+
+	batch := tpm.NewCommandBatch()
+	var digest Digest
+	var clock TimeInfo
+	if err := batch.Queue(CommandGetRandom, Delimiter, uint16(1), Delimiter, Delimiter, &digest); err != nil {
+		t.Fatalf("Queue failed: %v", err)
+	}
+	if err := batch.Queue(CommandReadClock, Delimiter, Delimiter, Delimiter, &clock); err != nil {
+		t.Fatalf("Queue failed: %v", err)
+	}
+	for i, err := range batch.Execute() {
+		if err != nil {
+			t.Errorf("Unexpected error for command %d: %v", i, err)
+		}
+	}
+
+	wg.Wait()
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+// The benchmarks in this file are intended for tracking performance regressions between releases. The ones that don't
+// require a TPM measure the overhead of the package itself. The ones that run against a TPM additionally report the time
+// spent waiting for the TPM ("tpm-ns/op") and the number of commands submitted ("cmds/op"), so that changes in the
+// overhead of the package can be distinguished from changes in the TPM or simulator. See the run-benchmarks script.
+
+// resetTPMStats discards the statistics recorded during setup of a benchmark and resets the benchmark timer.
+func resetTPMStats(b *testing.B, tpm *TPMContext) {
+	tpm.Stats().Reset()
+	b.ResetTimer()
+}
+
+// reportTPMStats reports the time spent waiting for the TPM and the number of commands submitted per iteration of a benchmark.
+func reportTPMStats(b *testing.B, tpm *TPMContext) {
+	b.StopTimer()
+
+	var count uint64
+	var total float64
+	for _, cs := range tpm.Stats().Commands() {
+		count += cs.Count
+		total += float64(cs.TotalDuration.Nanoseconds())
+	}
+	b.ReportMetric(total/float64(b.N), "tpm-ns/op")
+	b.ReportMetric(float64(count)/float64(b.N), "cmds/op")
+}
+
+func BenchmarkMarshalPublic(b *testing.B) {
+	pub := testutil.MakeRSASRKTemplate()
+	pub.Unique = &PublicIDU{RSA: make(PublicKeyRSA, 256)}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := mu.MarshalToBytes(pub); err != nil {
+			b.Fatalf("MarshalToBytes failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalPublic(b *testing.B) {
+	pub := testutil.MakeRSASRKTemplate()
+	pub.Unique = &PublicIDU{RSA: make(PublicKeyRSA, 256)}
+	data, err := mu.MarshalToBytes(pub)
+	if err != nil {
+		b.Fatalf("MarshalToBytes failed: %v", err)
+	}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var out *Public
+		if _, err := mu.UnmarshalFromBytes(data, &out); err != nil {
+			b.Fatalf("UnmarshalFromBytes failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkMarshalNVPublic(b *testing.B) {
+	pub := &NVPublic{
+		Index:   Handle(0x0181ffff),
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead),
+		Size:    64}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := mu.MarshalToBytes(pub); err != nil {
+			b.Fatalf("MarshalToBytes failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalPCRValues(b *testing.B) {
+	values := make(PCRValues)
+	for _, alg := range []HashAlgorithmId{HashAlgorithmSHA1, HashAlgorithmSHA256} {
+		for pcr := 0; pcr < 24; pcr++ {
+			values.SetValue(alg, pcr, make(Digest, alg.Size()))
+		}
+	}
+	selection, digests := values.ToListAndSelection()
+	data, err := mu.MarshalToBytes(selection, digests)
+	if err != nil {
+		b.Fatalf("MarshalToBytes failed: %v", err)
+	}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var selection PCRSelectionList
+		var digests DigestList
+		if _, err := mu.UnmarshalFromBytes(data, &selection, &digests); err != nil {
+			b.Fatalf("UnmarshalFromBytes failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkCommandHMAC(b *testing.B) {
+	cpBytes := make([]byte, 256)
+	names := []Name{make(Name, 34), make(Name, 34)}
+
+	for _, alg := range []HashAlgorithmId{HashAlgorithmSHA1, HashAlgorithmSHA256, HashAlgorithmSHA384} {
+		b.Run(alg.String(), func(b *testing.B) {
+			session := MakeMockSessionContext(0x02000000, &SessionContextData{
+				HashAlg:     alg,
+				SessionType: SessionTypeHMAC,
+				SessionKey:  make([]byte, alg.Size()),
+				NonceCaller: make(Nonce, alg.Size()),
+				NonceTPM:    make(Nonce, alg.Size())})
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				ComputeCommandHMAC(session, CommandNVWrite, names, cpBytes)
+			}
+		})
+	}
+}
+
+func BenchmarkPCRRead(b *testing.B) {
+	tpm := openTPMForTesting(b, 0)
+	defer closeTPM(b, tpm)
+
+	for _, data := range []struct {
+		desc      string
+		selection PCRSelectionList
+	}{
+		{
+			desc:      "SHA256/1",
+			selection: PCRSelectionList{{Hash: HashAlgorithmSHA256, Select: []int{7}}},
+		},
+		{
+			desc:      "SHA256/8",
+			selection: PCRSelectionList{{Hash: HashAlgorithmSHA256, Select: []int{0, 1, 2, 3, 4, 5, 6, 7}}},
+		},
+		{
+			desc: "SHA1+SHA256/8",
+			selection: PCRSelectionList{
+				{Hash: HashAlgorithmSHA1, Select: []int{0, 1, 2, 3, 4, 5, 6, 7}},
+				{Hash: HashAlgorithmSHA256, Select: []int{0, 1, 2, 3, 4, 5, 6, 7}}},
+		},
+	} {
+		b.Run(data.desc, func(b *testing.B) {
+			resetTPMStats(b, tpm)
+			for i := 0; i < b.N; i++ {
+				if _, _, err := tpm.PCRRead(data.selection); err != nil {
+					b.Fatalf("PCRRead failed: %v", err)
+				}
+			}
+			reportTPMStats(b, tpm)
+		})
+	}
+}
+
+func BenchmarkCreateLoad(b *testing.B) {
+	tpm := openTPMForTesting(b, testutil.TPMFeatureOwnerHierarchy)
+	defer closeTPM(b, tpm)
+
+	srk, err := testutil.CreatePrimaryECCSRK(tpm)
+	if err != nil {
+		b.Fatalf("CreatePrimaryECCSRK failed: %v", err)
+	}
+	defer flushContext(b, tpm, srk)
+
+	for _, data := range []struct {
+		desc string
+		fn   func(*TPMContext, ResourceContext) (ResourceContext, error)
+	}{
+		{desc: "ECC", fn: testutil.CreateECCSigningKey},
+		{desc: "RSA", fn: testutil.CreateRSASigningKey},
+	} {
+		b.Run(data.desc, func(b *testing.B) {
+			resetTPMStats(b, tpm)
+			for i := 0; i < b.N; i++ {
+				key, err := data.fn(tpm, srk)
+				if err != nil {
+					b.Fatalf("Cannot create key: %v", err)
+				}
+
+				b.StopTimer()
+				flushContext(b, tpm, key)
+				b.StartTimer()
+			}
+			reportTPMStats(b, tpm)
+		})
+	}
+}
+
+func benchmarkNV(b *testing.B, fn func(b *testing.B, tpm *TPMContext, index ResourceContext, session SessionContext, size int)) {
+	tpm := openTPMForTesting(b, testutil.TPMFeatureOwnerPersist)
+	defer closeTPM(b, tpm)
+
+	const maxSize = 1024
+
+	index, err := tpm.NVDefineSpace(tpm.OwnerHandleContext(), nil, &NVPublic{
+		Index:   Handle(0x0181ffff),
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead),
+		Size:    maxSize}, nil)
+	if err != nil {
+		b.Fatalf("NVDefineSpace failed: %v", err)
+	}
+	defer undefineNVSpace(b, tpm, index, tpm.OwnerHandleContext())
+
+	// Initialize the index and the TPM properties used to size transfers, so that they aren't counted.
+	if err := tpm.NVWrite(index, index, make([]byte, maxSize), 0, nil); err != nil {
+		b.Fatalf("NVWrite failed: %v", err)
+	}
+
+	session, err := tpm.StartAuthSession(nil, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256)
+	if err != nil {
+		b.Fatalf("StartAuthSession failed: %v", err)
+	}
+	defer flushContext(b, tpm, session)
+
+	for _, size := range []int{64, 512, maxSize} {
+		for _, auth := range []struct {
+			desc    string
+			session SessionContext
+		}{
+			{desc: "password"},
+			{desc: "hmac", session: session.WithAttrs(AttrContinueSession)},
+		} {
+			b.Run(fmt.Sprintf("%s/%d", auth.desc, size), func(b *testing.B) {
+				b.SetBytes(int64(size))
+				resetTPMStats(b, tpm)
+				fn(b, tpm, index, auth.session, size)
+				reportTPMStats(b, tpm)
+			})
+		}
+	}
+}
+
+func BenchmarkNVWrite(b *testing.B) {
+	benchmarkNV(b, func(b *testing.B, tpm *TPMContext, index ResourceContext, session SessionContext, size int) {
+		data := make([]byte, size)
+		for i := 0; i < b.N; i++ {
+			if err := tpm.NVWrite(index, index, data, 0, session); err != nil {
+				b.Fatalf("NVWrite failed: %v", err)
+			}
+		}
+	})
+}
+
+func BenchmarkNVRead(b *testing.B) {
+	benchmarkNV(b, func(b *testing.B, tpm *TPMContext, index ResourceContext, session SessionContext, size int) {
+		for i := 0; i < b.N; i++ {
+			if _, err := tpm.NVRead(index, index, uint16(size), 0, session); err != nil {
+				b.Fatalf("NVRead failed: %v", err)
+			}
+		}
+	})
+}
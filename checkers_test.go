@@ -0,0 +1,59 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	"golang.org/x/xerrors"
+
+	. "gopkg.in/check.v1"
+
+	. "github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+type checkersSuite struct{}
+
+var _ = Suite(&checkersSuite{})
+
+func (s *checkersSuite) TestDigestEquals(c *C) {
+	c.Check(Digest{1, 2, 3}, testutil.DigestEquals, Digest{1, 2, 3})
+	c.Check(Digest{1, 2, 3}, testutil.DigestEquals, []byte{1, 2, 3})
+	c.Check(Digest{1, 2, 3}, Not(testutil.DigestEquals), Digest{1, 2, 4})
+}
+
+func (s *checkersSuite) TestNameEquals(c *C) {
+	c.Check(Name{0x00, 0x0b, 0x01}, testutil.NameEquals, Name{0x00, 0x0b, 0x01})
+	c.Check(Name{0x00, 0x0b, 0x01}, Not(testutil.NameEquals), Name{0x00, 0x04, 0x01})
+}
+
+func (s *checkersSuite) TestPublicTemplateEquals(c *C) {
+	template := Public{
+		Type:    ObjectTypeKeyedHash,
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   AttrFixedTPM | AttrFixedParent | AttrUserWithAuth | AttrSign,
+		Params: &PublicParamsU{
+			KeyedHashDetail: &KeyedHashParams{
+				Scheme: KeyedHashScheme{
+					Scheme:  KeyedHashSchemeHMAC,
+					Details: &SchemeKeyedHashU{HMAC: &SchemeHMAC{HashAlg: HashAlgorithmSHA256}}}}},
+		Unique: &PublicIDU{KeyedHash: Digest{}}}
+
+	obtained := template
+	obtained.Unique = &PublicIDU{KeyedHash: make(Digest, 32)}
+	c.Check(&obtained, testutil.PublicTemplateEquals, &template)
+
+	obtained.Attrs |= AttrNoDA
+	c.Check(&obtained, Not(testutil.PublicTemplateEquals), &template)
+}
+
+func (s *checkersSuite) TestTPMErrorIs(c *C) {
+	err := xerrors.Errorf("wrapped: %w", &TPMHandleError{TPMError: &TPMError{Command: CommandLoad, Code: ErrorValue}, Index: 1})
+	c.Check(err, testutil.TPMErrorIs, ErrorValue, CommandLoad)
+	c.Check(err, Not(testutil.TPMErrorIs), ErrorValue, CommandCreate)
+	c.Check(err, Not(testutil.TPMErrorIs), ErrorHandle, CommandLoad)
+
+	c.Check(&TPMWarning{Command: CommandLoad, Code: WarningRetry}, testutil.TPMErrorIs, WarningRetry, CommandLoad)
+	c.Check(&TPMError{Command: CommandLoad, Code: ErrorValue}, Not(testutil.TPMErrorIs), WarningRetry, CommandLoad)
+}
@@ -0,0 +1,140 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+
+// indirect follows pointers and interfaces until it reaches a value that isn't one, or a value that implements fmt.Stringer.
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && !v.IsNil() {
+		if v.Type().Implements(stringerType) {
+			break
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func isBytes(v reflect.Value) bool {
+	return (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Type().Elem().Kind() == reflect.Uint8
+}
+
+func isScalar(v reflect.Value) bool {
+	if !v.IsValid() || v.Type().Implements(stringerType) || isBytes(v) {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Array, reflect.Map:
+		return false
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	default:
+		return true
+	}
+}
+
+func formatScalar(v reflect.Value) string {
+	switch {
+	case !v.IsValid():
+		return "<nil>"
+	case (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil():
+		return "<nil>"
+	case v.Type().Implements(stringerType):
+		return v.Interface().(fmt.Stringer).String()
+	case isBytes(v):
+		if v.Len() == 0 {
+			return "<empty>"
+		}
+		b := make([]byte, v.Len())
+		reflect.Copy(reflect.ValueOf(b), v)
+		return fmt.Sprintf("%x", b)
+	}
+
+	switch v.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Type().PkgPath() != "" {
+			// Named types without a String method are generally attributes or handles, which are easier to read in hex.
+			return fmt.Sprintf("0x%x", v.Uint())
+		}
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func lessKey(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() < b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return a.Uint() < b.Uint()
+	default:
+		return fmt.Sprint(a.Interface()) < fmt.Sprint(b.Interface())
+	}
+}
+
+type dumper struct {
+	w io.Writer
+}
+
+func (d *dumper) field(name string, v reflect.Value, depth int) {
+	v = indirect(v)
+	prefix := strings.Repeat("  ", depth)
+	if isScalar(v) {
+		fmt.Fprintf(d.w, "%s%s: %s\n", prefix, name, formatScalar(v))
+		return
+	}
+	fmt.Fprintf(d.w, "%s%s:\n", prefix, name)
+	d.children(v, depth+1)
+}
+
+func (d *dumper) children(v reflect.Value, depth int) {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			fv := v.Field(i)
+			if (fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface) && fv.IsNil() {
+				// Skip unselected union members.
+				continue
+			}
+			d.field(f.Name, fv, depth)
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Len() == 0 {
+			fmt.Fprintf(d.w, "%s<empty>\n", strings.Repeat("  ", depth))
+		}
+		for i := 0; i < v.Len(); i++ {
+			d.field(fmt.Sprintf("[%d]", i), v.Index(i), depth)
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return lessKey(keys[i], keys[j]) })
+		for _, k := range keys {
+			d.field(formatScalar(k), v.MapIndex(k), depth)
+		}
+	}
+}
+
+// dump writes a human readable representation of val to w. Structures are printed with one field per line and nested
+// structures are indented. Byte slices are printed in hex, and nil union members are omitted.
+func dump(w io.Writer, val interface{}) {
+	d := &dumper{w: w}
+	v := indirect(reflect.ValueOf(val))
+	if isScalar(v) {
+		fmt.Fprintf(w, "%s\n", formatScalar(v))
+		return
+	}
+	d.children(v, 0)
+}
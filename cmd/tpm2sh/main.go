@@ -0,0 +1,52 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+// tpm2sh is an interactive shell for debugging a TPM. It reads simple commands from standard input, executes them with the
+// go-tpm2 package and pretty-prints the responses. Type "help" at the prompt for a list of commands.
+//
+// Usage:
+//
+//	tpm2sh [-tpm <path> | -mssim <port>]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/canonical/go-tpm2"
+)
+
+func openTPM(path string, mssimPort uint) (*tpm2.TPMContext, error) {
+	var tcti tpm2.TCTI
+	if mssimPort != 0 {
+		t, err := tpm2.OpenMssim("localhost", mssimPort, mssimPort+1)
+		if err != nil {
+			return nil, err
+		}
+		tcti = t
+	} else {
+		t, err := tpm2.OpenTPMDevice(path)
+		if err != nil {
+			return nil, err
+		}
+		tcti = t
+	}
+	return tpm2.NewTPMContext(tcti)
+}
+
+func main() {
+	path := flag.String("tpm", "/dev/tpmrm0", "Path of the TPM character device")
+	mssimPort := flag.Uint("mssim", 0, "Connect to a TPM simulator on the specified port instead of a device")
+	flag.Parse()
+
+	tpm, err := openTPM(*path, *mssimPort)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot open TPM: %v\n", err)
+		os.Exit(1)
+	}
+	defer tpm.Close()
+
+	newShell(tpm, os.Stdout).run(os.Stdin, "tpm2> ")
+}
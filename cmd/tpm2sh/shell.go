@@ -0,0 +1,356 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/canonical/go-tpm2"
+)
+
+type shellCommand struct {
+	synopsis string
+	summary  string
+	run      func(s *shell, args []string) error
+}
+
+var shellCommands map[string]shellCommand
+
+func init() {
+	// This is initialized here rather than statically because the help command refers to it.
+	shellCommands = map[string]shellCommand{
+		"help":         {"", "Print this help", (*shell).help},
+		"getrandom":    {"<n>", "Obtain n random bytes from the TPM", (*shell).getRandom},
+		"getcap":       {"<category> [<first> [<count>]]", "Execute TPM2_GetCapability and print the returned data", (*shell).getCap},
+		"capabilities": {"", "Print a summary of the capabilities of the TPM", (*shell).capabilities},
+		"pcrread":      {"<bank> <pcr>[,<pcr>...]", "Print the values of PCRs", (*shell).pcrRead},
+		"readpublic":   {"<handle>", "Print the public area of an object", (*shell).readPublic},
+		"nvreadpublic": {"<handle>", "Print the public area of a NV index", (*shell).nvReadPublic},
+		"readclock":    {"", "Print the current time and clock values", (*shell).readClock},
+		"flush":        {"<handle>", "Flush a transient object or session", (*shell).flush},
+		"raw":          {"<command> [<hex parameters>]", "Execute a command without sessions and print the raw response", (*shell).raw},
+	}
+}
+
+var capabilities = map[string]tpm2.Capability{
+	"algs":           tpm2.CapabilityAlgs,
+	"handles":        tpm2.CapabilityHandles,
+	"commands":       tpm2.CapabilityCommands,
+	"pp-commands":    tpm2.CapabilityPPCommands,
+	"audit-commands": tpm2.CapabilityAuditCommands,
+	"pcrs":           tpm2.CapabilityPCRs,
+	"properties":     tpm2.CapabilityTPMProperties,
+	"pcr-properties": tpm2.CapabilityPCRProperties,
+	"ecc-curves":     tpm2.CapabilityECCCurves,
+	"auth-policies":  tpm2.CapabilityAuthPolicies}
+
+var hashAlgorithms = map[string]tpm2.HashAlgorithmId{
+	"sha1":   tpm2.HashAlgorithmSHA1,
+	"sha256": tpm2.HashAlgorithmSHA256,
+	"sha384": tpm2.HashAlgorithmSHA384,
+	"sha512": tpm2.HashAlgorithmSHA512}
+
+var errUsage = errors.New("invalid arguments")
+
+// shell executes commands against a TPM and writes the results to out.
+type shell struct {
+	tpm *tpm2.TPMContext
+	out io.Writer
+}
+
+func newShell(tpm *tpm2.TPMContext, out io.Writer) *shell {
+	return &shell{tpm: tpm, out: out}
+}
+
+func parseUint32(s string) (uint32, error) {
+	n, err := strconv.ParseUint(s, 0, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return uint32(n), nil
+}
+
+// parseHandle parses a handle supplied in hexadecimal, with or without a 0x prefix.
+func parseHandle(s string) (tpm2.Handle, error) {
+	h, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(s), "0x"), 16, 32)
+	if err != nil {
+		return tpm2.HandleUnassigned, fmt.Errorf("invalid handle %q", s)
+	}
+	return tpm2.Handle(h), nil
+}
+
+// parseCommandCode parses a command code supplied either as a number or as a name, with or without the TPM_CC_ prefix.
+func parseCommandCode(s string) (tpm2.CommandCode, error) {
+	if n, err := strconv.ParseUint(s, 0, 32); err == nil {
+		return tpm2.CommandCode(n), nil
+	}
+	name := strings.ToLower(strings.TrimPrefix(s, "TPM_CC_"))
+	for code := tpm2.CommandFirst; code <= tpm2.CommandCode(0x1ff); code++ {
+		if strings.ToLower(strings.TrimPrefix(code.String(), "TPM_CC_")) == name {
+			return code, nil
+		}
+	}
+	return 0, fmt.Errorf("unrecognized command %q", s)
+}
+
+// exec executes a single line of input.
+func (s *shell) exec(line string) error {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return nil
+	}
+	cmd, ok := shellCommands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q (type \"help\" for a list of commands)", args[0])
+	}
+	err := cmd.run(s, args[1:])
+	if err == errUsage {
+		return fmt.Errorf("usage: %s %s", args[0], cmd.synopsis)
+	}
+	return err
+}
+
+// run reads commands from r until it reaches EOF or the "exit" command, and executes them. Errors are printed and don't
+// terminate the shell.
+func (s *shell) run(r io.Reader, prompt string) {
+	scanner := bufio.NewScanner(r)
+	for {
+		fmt.Fprint(s.out, prompt)
+		if !scanner.Scan() {
+			fmt.Fprintln(s.out)
+			return
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "exit" || line == "quit" {
+			return
+		}
+		if err := s.exec(line); err != nil {
+			fmt.Fprintf(s.out, "error: %v\n", err)
+		}
+	}
+}
+
+func (s *shell) help(args []string) error {
+	var names []string
+	for name := range shellCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cmd := shellCommands[name]
+		fmt.Fprintf(s.out, "%s %s\n    %s\n", name, cmd.synopsis, cmd.summary)
+	}
+	fmt.Fprintf(s.out, "exit\n    Exit the shell\n")
+	return nil
+}
+
+func (s *shell) getRandom(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	n, err := strconv.ParseUint(args[0], 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid number of bytes %q", args[0])
+	}
+	b, err := s.tpm.GetRandom(uint16(n))
+	if err != nil {
+		return err
+	}
+	dump(s.out, b)
+	return nil
+}
+
+func (s *shell) getCap(args []string) error {
+	if len(args) < 1 || len(args) > 3 {
+		return errUsage
+	}
+	capability, ok := capabilities[args[0]]
+	if !ok {
+		var names []string
+		for name := range capabilities {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unrecognized category %q (expected one of %s)", args[0], strings.Join(names, ", "))
+	}
+	first := uint32(0)
+	count := tpm2.CapabilityMaxProperties
+	if len(args) > 1 {
+		n, err := parseUint32(args[1])
+		if err != nil {
+			return err
+		}
+		first = n
+	}
+	if len(args) > 2 {
+		n, err := parseUint32(args[2])
+		if err != nil {
+			return err
+		}
+		count = n
+	}
+
+	data, err := s.tpm.GetCapability(capability, first, count)
+	if err != nil {
+		return err
+	}
+	// Only print the member of the union that corresponds to the requested capability.
+	selected, err := data.Data.Select(reflect.ValueOf(data.Capability))
+	if err != nil {
+		return err
+	}
+	dump(s.out, selected)
+	return nil
+}
+
+func (s *shell) capabilities(args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	caps, err := s.tpm.Capabilities()
+	if err != nil {
+		return err
+	}
+	dump(s.out, caps)
+	return nil
+}
+
+func (s *shell) pcrRead(args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	alg, ok := hashAlgorithms[strings.ToLower(args[0])]
+	if !ok {
+		return fmt.Errorf("unrecognized PCR bank %q", args[0])
+	}
+	var pcrs []int
+	for _, p := range strings.Split(args[1], ",") {
+		pcr, err := strconv.Atoi(p)
+		if err != nil || pcr < 0 {
+			return fmt.Errorf("invalid PCR %q", p)
+		}
+		pcrs = append(pcrs, pcr)
+	}
+
+	_, values, err := s.tpm.PCRRead(tpm2.PCRSelectionList{{Hash: alg, Select: pcrs}})
+	if err != nil {
+		return err
+	}
+	dump(s.out, values)
+	return nil
+}
+
+func (s *shell) resourceContext(arg string) (tpm2.ResourceContext, error) {
+	handle, err := parseHandle(arg)
+	if err != nil {
+		return nil, err
+	}
+	return s.tpm.CreateResourceContextFromTPM(handle)
+}
+
+func (s *shell) readPublic(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	rc, err := s.resourceContext(args[0])
+	if err != nil {
+		return err
+	}
+	pub, _, _, err := s.tpm.ReadPublic(rc)
+	if err != nil {
+		return err
+	}
+	dump(s.out, pub)
+	fmt.Fprintf(s.out, "Name: %x\n", rc.Name())
+	return nil
+}
+
+func (s *shell) nvReadPublic(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	rc, err := s.resourceContext(args[0])
+	if err != nil {
+		return err
+	}
+	pub, _, err := s.tpm.NVReadPublic(rc)
+	if err != nil {
+		return err
+	}
+	dump(s.out, pub)
+	fmt.Fprintf(s.out, "Name: %x\n", rc.Name())
+	return nil
+}
+
+func (s *shell) readClock(args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	t, err := s.tpm.ReadClock()
+	if err != nil {
+		return err
+	}
+	dump(s.out, t)
+	return nil
+}
+
+func (s *shell) flush(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	handle, err := parseHandle(args[0])
+	if err != nil {
+		return err
+	}
+	var context tpm2.HandleContext
+	switch handle.Type() {
+	case tpm2.HandleTypeHMACSession, tpm2.HandleTypePolicySession:
+		context = tpm2.CreateIncompleteSessionContext(handle)
+	default:
+		context, err = s.tpm.CreateResourceContextFromTPM(handle)
+		if err != nil {
+			return err
+		}
+	}
+	return s.tpm.FlushContext(context)
+}
+
+func (s *shell) raw(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errUsage
+	}
+	code, err := parseCommandCode(args[0])
+	if err != nil {
+		return err
+	}
+	var params []byte
+	if len(args) > 1 {
+		params, err = hex.DecodeString(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid parameters: %v", err)
+		}
+	}
+
+	rc, tag, rsp, err := s.tpm.RunCommandBytes(tpm2.TagNoSessions, code, params)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "Command: %v\n", code)
+	fmt.Fprintf(s.out, "Tag: %v\n", tag)
+	fmt.Fprintf(s.out, "Response code: 0x%08x\n", uint32(rc))
+	if err := tpm2.DecodeResponseCode(code, rc); err != nil {
+		fmt.Fprintf(s.out, "Error: %v\n", err)
+	}
+	fmt.Fprintf(s.out, "Response: %s\n", formatScalar(reflect.ValueOf(rsp)))
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/testutil"
+
+	. "gopkg.in/check.v1"
+)
+
+func init() {
+	testutil.AddCommandLineFlags()
+}
+
+func Test(t *testing.T) { TestingT(t) }
+
+type shellSuite struct{}
+
+var _ = Suite(&shellSuite{})
+
+func (s *shellSuite) TestDump(c *C) {
+	out := new(bytes.Buffer)
+	dump(out, &tpm2.NVPublic{
+		Index:   0x01800000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthWrite | tpm2.AttrNVAuthRead),
+		Size:    8})
+	c.Check(out.String(), Equals, `Index: 0x01800000
+NameAlg: TPM_ALG_SHA256
+Attrs: authwrite|authread
+AuthPolicy: <empty>
+Size: 8
+`)
+
+	out.Reset()
+	dump(out, tpm2.PCRValues{tpm2.HashAlgorithmSHA1: {10: make(tpm2.Digest, 2), 2: tpm2.Digest{0xff, 0x01}}})
+	c.Check(out.String(), Equals, `TPM_ALG_SHA1:
+  2: ff01
+  10: 0000
+`)
+}
+
+func (s *shellSuite) TestParseCommandCode(c *C) {
+	for _, name := range []string{"TPM_CC_GetRandom", "GetRandom", "getrandom", "0x17b"} {
+		code, err := parseCommandCode(name)
+		c.Check(err, IsNil)
+		c.Check(code, Equals, tpm2.CommandGetRandom)
+	}
+	_, err := parseCommandCode("foo")
+	c.Check(err, ErrorMatches, `unrecognized command "foo"`)
+}
+
+func (s *shellSuite) TestRun(c *C) {
+	tcti := testutil.NewMockTCTI(
+		&testutil.MockCommand{CommandCode: tpm2.CommandGetCapability, Response: &testutil.MockResponse{Params: []interface{}{false,
+			&tpm2.CapabilityData{Capability: tpm2.CapabilityPCRs, Data: &tpm2.CapabilitiesU{AssignedPCR: tpm2.PCRSelectionList{
+				{Hash: tpm2.HashAlgorithmSHA256, Select: tpm2.PCRSelect{0, 7}}}}}}}},
+		&testutil.MockCommand{CommandCode: tpm2.CommandGetRandom, Response: &testutil.MockResponse{ResponseCode: tpm2.ResponseCode(0x922)}})
+	tpm, _ := tpm2.NewTPMContext(tcti)
+
+	out := new(bytes.Buffer)
+	newShell(tpm, out).run(strings.NewReader("getcap pcrs\nfoo\ngetrandom\nraw GetRandom 0004\nexit\ngetcap pcrs\n"), "> ")
+	c.Check(tcti.Done(), IsNil)
+	c.Check(out.String(), Equals, `> [0]:
+  Hash: TPM_ALG_SHA256
+  Select:
+    [0]: 0
+    [1]: 7
+> error: unknown command "foo" (type "help" for a list of commands)
+> error: usage: getrandom <n>
+> Command: TPM_CC_GetRandom
+Tag: TPM_ST_NO_SESSIONS
+Response code: 0x00000922
+Error: TPM returned a warning whilst executing command TPM_CC_GetRandom: TPM_RC_RETRY (the TPM was not able to start the command)
+Response: <empty>
+> `)
+}
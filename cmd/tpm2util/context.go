@@ -0,0 +1,67 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/canonical/go-tpm2"
+)
+
+func runDecodeContext(e *env, args []string) error {
+	flags := newFlagSet("decodecontext", "<file>")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+
+	b, err := ioutil.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	info, err := tpm2.DecodeHandleContext(b)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(e.stdout, "Type: %s\n", info.Type)
+	fmt.Fprintf(e.stdout, "Handle: %v\n", info.Handle)
+	fmt.Fprintf(e.stdout, "Name: %x\n", info.Name)
+	fmt.Fprintf(e.stdout, "Checksum valid: %t\n", info.ChecksumValid)
+	if info.ConsistencyError != nil {
+		fmt.Fprintf(e.stdout, "Consistency error: %v\n", info.ConsistencyError)
+	}
+
+	switch {
+	case info.Object != nil:
+		fmt.Fprintf(e.stdout, "Object type: %v\n", info.Object.Type)
+		fmt.Fprintf(e.stdout, "Name algorithm: %v\n", info.Object.NameAlg)
+		fmt.Fprintf(e.stdout, "Attributes: 0x%08x\n", uint32(info.Object.Attrs))
+		fmt.Fprintf(e.stdout, "Auth policy: %x\n", info.Object.AuthPolicy)
+	case info.NV != nil:
+		fmt.Fprintf(e.stdout, "Name algorithm: %v\n", info.NV.NameAlg)
+		fmt.Fprintf(e.stdout, "Attributes: 0x%08x\n", uint32(info.NV.Attrs))
+		fmt.Fprintf(e.stdout, "Auth policy: %x\n", info.NV.AuthPolicy)
+		fmt.Fprintf(e.stdout, "Size: %d\n", info.NV.Size)
+	case info.Session != nil:
+		fmt.Fprintf(e.stdout, "Session type: %v\n", info.Session.SessionType)
+		fmt.Fprintf(e.stdout, "Digest algorithm: %v\n", info.Session.HashAlg)
+		fmt.Fprintf(e.stdout, "Audit: %t (exclusive: %t)\n", info.Session.IsAudit, info.Session.IsExclusive)
+		if info.Session.IsBound {
+			fmt.Fprintf(e.stdout, "Bound entity: %x\n", info.Session.BoundEntity)
+		}
+		if info.Session.Symmetric != nil {
+			fmt.Fprintf(e.stdout, "Symmetric algorithm: %v\n", info.Session.Symmetric.Algorithm)
+		}
+		fmt.Fprintf(e.stdout, "Caller nonce: %x\n", info.Session.NonceCaller)
+		fmt.Fprintf(e.stdout, "TPM nonce: %x\n", info.Session.NonceTPM)
+	}
+
+	return nil
+}
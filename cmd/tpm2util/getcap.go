@@ -0,0 +1,71 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/canonical/go-tpm2"
+)
+
+func runGetCap(e *env, args []string) error {
+	flags := newFlagSet("getcap", "")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+
+	tpm, err := e.TPM()
+	if err != nil {
+		return err
+	}
+	manufacturer, err := tpm.GetManufacturer()
+	if err != nil {
+		return fmt.Errorf("cannot obtain manufacturer: %v", err)
+	}
+	caps, err := tpm.Capabilities()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(e.stdout, "Manufacturer: %v\n", manufacturer)
+	fmt.Fprintf(e.stdout, "PCR banks: %v (%d PCRs)\n", caps.PCRBanks, caps.PCRCount)
+	fmt.Fprintf(e.stdout, "Input buffer: %d bytes\n", caps.InputBuffer)
+	fmt.Fprintf(e.stdout, "Maximum command size: %d bytes\n", caps.MaxCommandSize)
+	fmt.Fprintf(e.stdout, "Maximum response size: %d bytes\n", caps.MaxResponseSize)
+	fmt.Fprintf(e.stdout, "Maximum NV index size: %d bytes\n", caps.NVIndexMax)
+	fmt.Fprintf(e.stdout, "NV buffer size: %d bytes\n", caps.NVBufferMax)
+	fmt.Fprintf(e.stdout, "NV counters available: %d\n", caps.NVCountersAvail)
+	fmt.Fprintf(e.stdout, "Lockout: in lockout=%t, failures=%d/%d, recovery interval=%v, lockout recovery=%v\n",
+		caps.Lockout.InLockout, caps.Lockout.LockoutCounter, caps.Lockout.MaxTries, caps.Lockout.RecoveryTime,
+		caps.Lockout.LockoutRecovery)
+
+	var algs []tpm2.AlgorithmId
+	for alg := range caps.Algorithms {
+		algs = append(algs, alg)
+	}
+	sort.Slice(algs, func(i, j int) bool { return algs[i] < algs[j] })
+	fmt.Fprintf(e.stdout, "Algorithms:\n")
+	for _, alg := range algs {
+		fmt.Fprintf(e.stdout, "  %v\n", alg)
+	}
+
+	fmt.Fprintf(e.stdout, "ECC curves:\n")
+	for _, curve := range caps.ECCCurves {
+		fmt.Fprintf(e.stdout, "  0x%04x\n", uint16(curve))
+	}
+
+	var cmds []tpm2.CommandCode
+	for code := range caps.Commands {
+		cmds = append(cmds, code)
+	}
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i] < cmds[j] })
+	fmt.Fprintf(e.stdout, "Commands:\n")
+	for _, code := range cmds {
+		fmt.Fprintf(e.stdout, "  %v\n", code)
+	}
+
+	return nil
+}
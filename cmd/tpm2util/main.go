@@ -0,0 +1,186 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+// tpm2util is a small command-line tool for interacting with a TPM, built on the go-tpm2 package. It is intended to serve as
+// documentation for how the package is used, and as a way of checking the package against real hardware.
+//
+// Usage:
+//
+//	tpm2util [-tpm <path> | -mssim <port>] <command> [arguments]
+//
+// The supported commands are decodecontext, getcap, readpublic, pcrread, nvread, nvwrite, quote, seal and unseal. Run a command
+// with -h for details of its arguments.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/canonical/go-tpm2"
+)
+
+// env is the environment in which a command runs. The TPM is only opened once a command has parsed its arguments.
+type env struct {
+	stdout io.Writer
+	open   func() (*tpm2.TPMContext, error)
+	tpm    *tpm2.TPMContext
+}
+
+// TPM returns the connection to the TPM, opening it on the first call.
+func (e *env) TPM() (*tpm2.TPMContext, error) {
+	if e.tpm == nil {
+		tpm, err := e.open()
+		if err != nil {
+			return nil, fmt.Errorf("cannot open TPM: %v", err)
+		}
+		e.tpm = tpm
+	}
+	return e.tpm, nil
+}
+
+type command struct {
+	summary string
+	run     func(e *env, args []string) error
+}
+
+var commands = map[string]command{
+	"decodecontext": {"Print the contents of a serialized HandleContext", runDecodeContext},
+	"getcap":        {"Print the capabilities of the TPM", runGetCap},
+	"readpublic":    {"Print the public area of a loaded or persistent object", runReadPublic},
+	"pcrread":       {"Print the values of PCRs", runPCRRead},
+	"nvread":        {"Read data from a NV index", runNVRead},
+	"nvwrite":       {"Write data to a NV index", runNVWrite},
+	"quote":         {"Sign the values of PCRs with a persistent signing key", runQuote},
+	"seal":          {"Seal data to a persistent storage key", runSeal},
+	"unseal":        {"Unseal data that was sealed with the seal command", runUnseal},
+}
+
+var errUsage = errors.New("invalid arguments")
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s [-tpm <path> | -mssim <port>] <command> [arguments]\n\nCommands:\n", os.Args[0])
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-15s%s\n", name, commands[name].summary)
+	}
+	fmt.Fprintf(w, "\nOptions:\n")
+	flag.CommandLine.SetOutput(w)
+	flag.PrintDefaults()
+}
+
+// newFlagSet returns a flag set for the named command. The synopsis describes the positional arguments.
+func newFlagSet(name, synopsis string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s [options] %s\n\nOptions:\n", os.Args[0], name, synopsis)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseHandle parses a handle supplied in hexadecimal, with or without a 0x prefix.
+func parseHandle(s string) (tpm2.Handle, error) {
+	h, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(s), "0x"), 16, 32)
+	if err != nil {
+		return tpm2.HandleUnassigned, fmt.Errorf("invalid handle %q", s)
+	}
+	return tpm2.Handle(h), nil
+}
+
+// parsePCRs parses a list of PCR indices, which may be separated by commas.
+func parsePCRs(args []string) ([]int, error) {
+	var pcrs []int
+	for _, arg := range args {
+		for _, s := range strings.Split(arg, ",") {
+			if s == "" {
+				continue
+			}
+			pcr, err := strconv.Atoi(s)
+			if err != nil || pcr < 0 {
+				return nil, fmt.Errorf("invalid PCR %q", s)
+			}
+			pcrs = append(pcrs, pcr)
+		}
+	}
+	return pcrs, nil
+}
+
+var hashAlgorithms = map[string]tpm2.HashAlgorithmId{
+	"sha1":   tpm2.HashAlgorithmSHA1,
+	"sha256": tpm2.HashAlgorithmSHA256,
+	"sha384": tpm2.HashAlgorithmSHA384,
+	"sha512": tpm2.HashAlgorithmSHA512}
+
+func parseHashAlgorithm(s string) (tpm2.HashAlgorithmId, error) {
+	alg, ok := hashAlgorithms[strings.ToLower(s)]
+	if !ok {
+		return tpm2.HashAlgorithmNull, fmt.Errorf("unrecognized digest algorithm %q", s)
+	}
+	return alg, nil
+}
+
+func openTPM(path string, mssimPort uint) (*tpm2.TPMContext, error) {
+	var tcti tpm2.TCTI
+	if mssimPort != 0 {
+		t, err := tpm2.OpenMssim("localhost", mssimPort, mssimPort+1)
+		if err != nil {
+			return nil, err
+		}
+		tcti = t
+	} else {
+		t, err := tpm2.OpenTPMDevice(path)
+		if err != nil {
+			return nil, err
+		}
+		tcti = t
+	}
+	return tpm2.NewTPMContext(tcti)
+}
+
+func run(stdout io.Writer) error {
+	path := flag.String("tpm", "/dev/tpmrm0", "Path of the TPM character device")
+	mssimPort := flag.Uint("mssim", 0, "Connect to a TPM simulator on the specified port instead of a device")
+	flag.Usage = func() { usage(os.Stderr) }
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		return errUsage
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		flag.Usage()
+		return fmt.Errorf("unknown command %q", flag.Arg(0))
+	}
+
+	e := &env{
+		stdout: stdout,
+		open:   func() (*tpm2.TPMContext, error) { return openTPM(*path, *mssimPort) }}
+	defer func() {
+		if e.tpm != nil {
+			e.tpm.Close()
+		}
+	}()
+
+	return cmd.run(e, flag.Args()[1:])
+}
+
+func main() {
+	if err := run(os.Stdout); err != nil {
+		if err != errUsage {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+		os.Exit(1)
+	}
+}
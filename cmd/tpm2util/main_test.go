@@ -0,0 +1,137 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/testutil"
+
+	. "gopkg.in/check.v1"
+)
+
+func init() {
+	testutil.AddCommandLineFlags()
+}
+
+func Test(t *testing.T) { TestingT(t) }
+
+type parseSuite struct{}
+
+var _ = Suite(&parseSuite{})
+
+func (s *parseSuite) TestParseHandle(c *C) {
+	h, err := parseHandle("0x81000001")
+	c.Check(err, IsNil)
+	c.Check(h, Equals, tpm2.Handle(0x81000001))
+
+	h, err = parseHandle("1500016")
+	c.Check(err, IsNil)
+	c.Check(h, Equals, tpm2.Handle(0x01500016))
+
+	_, err = parseHandle("foo")
+	c.Check(err, ErrorMatches, `invalid handle "foo"`)
+}
+
+func (s *parseSuite) TestParsePCRs(c *C) {
+	pcrs, err := parsePCRs([]string{"0,1", "7"})
+	c.Check(err, IsNil)
+	c.Check(pcrs, DeepEquals, []int{0, 1, 7})
+
+	_, err = parsePCRs([]string{"0,-1"})
+	c.Check(err, ErrorMatches, `invalid PCR "-1"`)
+}
+
+func (s *parseSuite) TestParseHashAlgorithm(c *C) {
+	alg, err := parseHashAlgorithm("SHA1")
+	c.Check(err, IsNil)
+	c.Check(alg, Equals, tpm2.HashAlgorithmSHA1)
+
+	_, err = parseHashAlgorithm("md5")
+	c.Check(err, ErrorMatches, `unrecognized digest algorithm "md5"`)
+}
+
+type commandsSuite struct {
+	testutil.TPMSimulatorTest
+	stdout *bytes.Buffer
+}
+
+var _ = Suite(&commandsSuite{})
+
+func (s *commandsSuite) run(c *C, name string, args ...string) string {
+	s.stdout = new(bytes.Buffer)
+	c.Assert(commands[name].run(&env{stdout: s.stdout, tpm: s.TPM}, args), IsNil)
+	return s.stdout.String()
+}
+
+func (s *commandsSuite) TestGetCap(c *C) {
+	c.Check(s.run(c, "getcap"), Matches, `(?s)Manufacturer: IBM\n.*TPM_CC_GetCapability\n.*`)
+}
+
+func (s *commandsSuite) TestPCRRead(c *C) {
+	c.Check(s.run(c, "pcrread", "-bank", "sha1", "23"), Equals, "TPM_ALG_SHA1:23: 0000000000000000000000000000000000000000\n")
+}
+
+func (s *commandsSuite) TestReadPublic(c *C) {
+	srk := s.CreatePrimaryRSASRK(c)
+	c.Check(s.run(c, "readpublic", fmt.Sprintf("%x", srk.Handle())), Matches, fmt.Sprintf(`(?s)Type: TPM_ALG_RSA\n.*Name: %x\n.*`, srk.Name()))
+}
+
+func (s *commandsSuite) TestSealAndUnseal(c *C) {
+	srk := s.CreatePrimaryRSASRK(c)
+	dir := c.MkDir()
+	in := filepath.Join(dir, "in")
+	out := filepath.Join(dir, "sealed")
+	c.Assert(ioutil.WriteFile(in, []byte("secret"), 0600), IsNil)
+
+	parent := fmt.Sprintf("%x", srk.Handle())
+	s.run(c, "seal", "-parent", parent, "-auth", "foo", in, out)
+	c.Check(s.run(c, "unseal", "-parent", parent, "-auth", "foo", out), Equals, "secret")
+}
+
+func (s *commandsSuite) TestNVWriteAndRead(c *C) {
+	pub := tpm2.NVPublic{
+		Index:   0x0181ff00,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthWrite | tpm2.AttrNVAuthRead),
+		Size:    8}
+	index, err := s.TPM.NVDefineSpace(s.TPM.OwnerHandleContext(), nil, &pub, nil)
+	c.Assert(err, IsNil)
+	s.AddCleanupNVSpace(c, s.TPM.OwnerHandleContext(), index)
+
+	in := filepath.Join(c.MkDir(), "in")
+	c.Assert(ioutil.WriteFile(in, []byte("bar"), 0600), IsNil)
+
+	s.run(c, "nvwrite", "-offset", "2", "0x0181ff00", in)
+	c.Check(s.run(c, "nvread", "-offset", "2", "-size", "3", "0x0181ff00"), Equals, "bar")
+}
+
+func (s *parseSuite) TestDecodeContext(c *C) {
+	rc, err := tpm2.CreateNVIndexResourceContextFromPublic(&tpm2.NVPublic{
+		Index:   0x01800000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthWrite | tpm2.AttrNVAuthRead),
+		Size:    8})
+	c.Assert(err, IsNil)
+	path := filepath.Join(c.MkDir(), "context")
+	c.Assert(ioutil.WriteFile(path, rc.SerializeToBytes(), 0600), IsNil)
+
+	stdout := new(bytes.Buffer)
+	c.Check(runDecodeContext(&env{stdout: stdout}, []string{path}), IsNil)
+	c.Check(stdout.String(), Equals, fmt.Sprintf(`Type: nv-index
+Handle: 0x01800000
+Name: %x
+Checksum valid: true
+Name algorithm: TPM_ALG_SHA256
+Attributes: 0x00040004
+Auth policy: 
+Size: 8
+`, rc.Name()))
+}
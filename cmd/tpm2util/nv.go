@@ -0,0 +1,90 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+)
+
+func runNVRead(e *env, args []string) error {
+	flags := newFlagSet("nvread", "<index>")
+	auth := flags.String("auth", "", "Authorization value for the index")
+	offset := flags.Uint("offset", 0, "Offset at which to start reading")
+	size := flags.Uint("size", 0, "Number of bytes to read. The remainder of the index is read if this isn't supplied")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+	handle, err := parseHandle(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	tpm, err := e.TPM()
+	if err != nil {
+		return err
+	}
+	index, err := tpm.CreateResourceContextFromTPM(handle)
+	if err != nil {
+		return fmt.Errorf("cannot create context for index: %v", err)
+	}
+	index.SetAuthValue([]byte(*auth))
+
+	pub, _, err := tpm.NVReadPublic(index)
+	if err != nil {
+		return err
+	}
+	if *offset > uint(pub.Size) {
+		return fmt.Errorf("offset is outside of the index")
+	}
+	if *size == 0 {
+		*size = uint(pub.Size) - *offset
+	}
+
+	data, err := tpm.NVRead(index, index, uint16(*size), uint16(*offset), nil)
+	if err != nil {
+		return err
+	}
+	_, err = e.stdout.Write(data)
+	return err
+}
+
+func runNVWrite(e *env, args []string) error {
+	flags := newFlagSet("nvwrite", "<index> <input>")
+	auth := flags.String("auth", "", "Authorization value for the index")
+	offset := flags.Uint("offset", 0, "Offset at which to start writing")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errUsage
+	}
+	handle, err := parseHandle(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	tpm, err := e.TPM()
+	if err != nil {
+		return err
+	}
+	index, err := tpm.CreateResourceContextFromTPM(handle)
+	if err != nil {
+		return fmt.Errorf("cannot create context for index: %v", err)
+	}
+	index.SetAuthValue([]byte(*auth))
+
+	return tpm.NVWrite(index, index, data, uint16(*offset), nil)
+}
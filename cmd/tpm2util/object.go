@@ -0,0 +1,153 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+)
+
+func runReadPublic(e *env, args []string) error {
+	flags := newFlagSet("readpublic", "<handle>")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+	handle, err := parseHandle(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	tpm, err := e.TPM()
+	if err != nil {
+		return err
+	}
+	object, err := tpm.CreateResourceContextFromTPM(handle)
+	if err != nil {
+		return fmt.Errorf("cannot create context for object: %v", err)
+	}
+	pub, name, qualifiedName, err := tpm.ReadPublic(object)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(e.stdout, "Type: %v\n", pub.Type)
+	fmt.Fprintf(e.stdout, "Name algorithm: %v\n", pub.NameAlg)
+	fmt.Fprintf(e.stdout, "Attributes: 0x%08x\n", uint32(pub.Attrs))
+	fmt.Fprintf(e.stdout, "Auth policy: %x\n", pub.AuthPolicy)
+	fmt.Fprintf(e.stdout, "Name: %x\n", name)
+	fmt.Fprintf(e.stdout, "Qualified name: %x\n", qualifiedName)
+	return nil
+}
+
+// sealedObject is the format of the files written by the seal command.
+type sealedObject struct {
+	Private tpm2.Private
+	Public  *tpm2.Public
+}
+
+func runSeal(e *env, args []string) error {
+	flags := newFlagSet("seal", "<input> <output>")
+	parent := flags.String("parent", "0x81000001", "Handle of the persistent storage key to seal to")
+	auth := flags.String("auth", "", "Authorization value for the sealed object")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errUsage
+	}
+	parentHandle, err := parseHandle(*parent)
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	tpm, err := e.TPM()
+	if err != nil {
+		return err
+	}
+	parentContext, err := tpm.CreateResourceContextFromTPM(parentHandle)
+	if err != nil {
+		return fmt.Errorf("cannot create context for parent: %v", err)
+	}
+
+	template := tpm2.Public{
+		Type:    tpm2.ObjectTypeKeyedHash,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.AttrFixedTPM | tpm2.AttrFixedParent | tpm2.AttrUserWithAuth,
+		Params: &tpm2.PublicParamsU{
+			KeyedHashDetail: &tpm2.KeyedHashParams{Scheme: tpm2.KeyedHashScheme{Scheme: tpm2.KeyedHashSchemeNull}}}}
+	sensitive := tpm2.SensitiveCreate{UserAuth: tpm2.Auth(*auth), Data: data}
+
+	priv, pub, _, _, _, err := tpm.Create(parentContext, &sensitive, &template, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	b, err := mu.MarshalToBytes(sealedObject{Private: priv, Public: pub})
+	if err != nil {
+		return fmt.Errorf("cannot serialize sealed object: %v", err)
+	}
+	return ioutil.WriteFile(flags.Arg(1), b, 0600)
+}
+
+func runUnseal(e *env, args []string) error {
+	flags := newFlagSet("unseal", "<input>")
+	parent := flags.String("parent", "0x81000001", "Handle of the persistent storage key that the data was sealed to")
+	auth := flags.String("auth", "", "Authorization value for the sealed object")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+	parentHandle, err := parseHandle(*parent)
+	if err != nil {
+		return err
+	}
+
+	b, err := ioutil.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	var sealed sealedObject
+	if _, err := mu.UnmarshalFromBytes(b, &sealed); err != nil {
+		return fmt.Errorf("cannot deserialize sealed object: %v", err)
+	}
+
+	tpm, err := e.TPM()
+	if err != nil {
+		return err
+	}
+	parentContext, err := tpm.CreateResourceContextFromTPM(parentHandle)
+	if err != nil {
+		return fmt.Errorf("cannot create context for parent: %v", err)
+	}
+	object, err := tpm.Load(parentContext, sealed.Private, sealed.Public, nil)
+	if err != nil {
+		return err
+	}
+	defer tpm.FlushContext(object)
+	object.SetAuthValue([]byte(*auth))
+
+	data, err := tpm.Unseal(object, nil)
+	if err != nil {
+		return err
+	}
+	_, err = e.stdout.Write(data)
+	return err
+}
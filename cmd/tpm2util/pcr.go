@@ -0,0 +1,125 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+)
+
+func runPCRRead(e *env, args []string) error {
+	flags := newFlagSet("pcrread", "<pcr>...")
+	bank := flags.String("bank", "sha256", "PCR bank to read")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	alg, err := parseHashAlgorithm(*bank)
+	if err != nil {
+		return err
+	}
+	pcrs, err := parsePCRs(flags.Args())
+	if err != nil {
+		return err
+	}
+	if len(pcrs) == 0 {
+		for i := 0; i < 24; i++ {
+			pcrs = append(pcrs, i)
+		}
+	}
+
+	tpm, err := e.TPM()
+	if err != nil {
+		return err
+	}
+	_, values, err := tpm.PCRRead(tpm2.PCRSelectionList{{Hash: alg, Select: pcrs}})
+	if err != nil {
+		return err
+	}
+
+	sort.Ints(pcrs)
+	for _, pcr := range pcrs {
+		value, ok := values[alg][pcr]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(e.stdout, "%v:%d: %x\n", alg, pcr, value)
+	}
+	return nil
+}
+
+func runQuote(e *env, args []string) error {
+	flags := newFlagSet("quote", "<pcr>...")
+	key := flags.String("key", "", "Handle of the persistent signing key")
+	auth := flags.String("auth", "", "Authorization value for the signing key")
+	bank := flags.String("bank", "sha256", "PCR bank to quote")
+	nonce := flags.String("nonce", "", "Hex encoded qualifying data. A random nonce is used if this isn't supplied")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if *key == "" || flags.NArg() == 0 {
+		flags.Usage()
+		return errUsage
+	}
+	keyHandle, err := parseHandle(*key)
+	if err != nil {
+		return err
+	}
+	alg, err := parseHashAlgorithm(*bank)
+	if err != nil {
+		return err
+	}
+	pcrs, err := parsePCRs(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	var qualifyingData []byte
+	if *nonce != "" {
+		qualifyingData, err = hex.DecodeString(*nonce)
+		if err != nil {
+			return fmt.Errorf("invalid nonce: %v", err)
+		}
+	} else {
+		qualifyingData = make([]byte, 32)
+		if _, err := rand.Read(qualifyingData); err != nil {
+			return fmt.Errorf("cannot generate nonce: %v", err)
+		}
+	}
+
+	tpm, err := e.TPM()
+	if err != nil {
+		return err
+	}
+	keyContext, err := tpm.CreateResourceContextFromTPM(keyHandle)
+	if err != nil {
+		return fmt.Errorf("cannot create context for key: %v", err)
+	}
+	keyContext.SetAuthValue([]byte(*auth))
+
+	quoted, signature, err := tpm.Quote(keyContext, qualifyingData, nil, tpm2.PCRSelectionList{{Hash: alg, Select: pcrs}}, nil)
+	if err != nil {
+		return err
+	}
+
+	quotedBytes, err := mu.MarshalToBytes(quoted)
+	if err != nil {
+		return fmt.Errorf("cannot serialize quote: %v", err)
+	}
+	signatureBytes, err := mu.MarshalToBytes(signature)
+	if err != nil {
+		return fmt.Errorf("cannot serialize signature: %v", err)
+	}
+
+	fmt.Fprintf(e.stdout, "Nonce: %x\n", qualifyingData)
+	fmt.Fprintf(e.stdout, "PCR digest: %x\n", quoted.Attested.Quote.PCRDigest)
+	fmt.Fprintf(e.stdout, "Quote: %x\n", quotedBytes)
+	fmt.Fprintf(e.stdout, "Signature: %x\n", signatureBytes)
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+// tpmproxy exposes a TPM device over the TCP protocol implemented by the Microsoft TPM 2.0 simulator, so that remote test
+// machines can use a physical TPM via the same transport that they would use for a simulator (eg, with tpm2.OpenMssim).
+//
+// Usage:
+//
+//	tpmproxy [-tpm <path>] [-listen <address>] [-port <port>]
+//
+// The TPM command channel listens on the specified port, and the platform channel listens on the following port. The platform
+// channel is only partially supported - the proxied TPM can't be power cycled or reset, and requests to do so fail.
+//
+// Each connection to the TPM command channel can only use the transient objects and sessions that it loaded, and these are flushed
+// from the TPM when the connection is closed.
+//
+// Note that anyone who can connect to the proxy has full access to the TPM.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+
+	"github.com/canonical/go-tpm2"
+)
+
+func run() error {
+	path := flag.String("tpm", "/dev/tpmrm0", "Path of the TPM character device")
+	address := flag.String("listen", "localhost", "Address to listen on")
+	port := flag.Uint("port", 2321, "Port for the TPM command channel. The platform channel uses the next port")
+	flag.Parse()
+
+	tcti, err := tpm2.OpenTPMDevice(*path)
+	if err != nil {
+		return err
+	}
+	defer tcti.Close()
+
+	tpmListener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", *address, *port))
+	if err != nil {
+		return err
+	}
+	defer tpmListener.Close()
+	platformListener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", *address, *port+1))
+	if err != nil {
+		return err
+	}
+	defer platformListener.Close()
+
+	p := newProxy(tcti)
+	errs := make(chan error, 2)
+	go func() { errs <- serve(tpmListener, p.serveTPM) }()
+	go func() { errs <- serve(platformListener, p.servePlatform) }()
+
+	log.Printf("proxying %s on %s", *path, tpmListener.Addr())
+	return <-errs
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
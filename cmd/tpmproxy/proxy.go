@@ -0,0 +1,172 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+
+	"golang.org/x/xerrors"
+)
+
+// These are the command codes of the Microsoft TPM simulator protocol that are handled by the proxy.
+const (
+	cmdPowerOn        uint32 = 1
+	cmdPowerOff       uint32 = 2
+	cmdTPMSendCommand uint32 = 8
+	cmdCancelOn       uint32 = 9
+	cmdCancelOff      uint32 = 10
+	cmdNVOn           uint32 = 11
+	cmdNVOff          uint32 = 12
+	cmdReset          uint32 = 17
+	cmdSessionEnd     uint32 = 20
+	cmdStop           uint32 = 21
+)
+
+const (
+	// maxCommandSize is the maximum size of a command accepted from a client.
+	maxCommandSize uint32 = 65536
+
+	commandHeaderSize  = 10
+	responseHeaderSize = 10
+
+	// platformNotSupported is returned in response to platform commands that can't be performed on the proxied TPM.
+	platformNotSupported uint32 = 1
+)
+
+// proxy forwards commands received using the Microsoft TPM simulator protocol to a TPM. Each connection to the TPM command
+// channel submits commands via its own TPMContext created from a tpm2.SharedTCTI, so commands from different clients are
+// serialized, transient objects and sessions are isolated between clients, and the transient objects and sessions loaded by a
+// client are flushed when it disconnects.
+//
+// The platform channel only supports commands that are meaningful for a TPM that is already powered on. Commands that
+// would require power cycling or resetting the TPM return an error. Commands are executed at the locality of the underlying
+// TCTI - the locality requested by the client is ignored.
+type proxy struct {
+	shared *tpm2.SharedTCTI
+}
+
+func newProxy(tcti tpm2.TCTI) *proxy {
+	return &proxy{shared: tpm2.NewSharedTCTI(tcti)}
+}
+
+// submit sends a command on behalf of a client and returns the complete response.
+func submit(tpm *tpm2.TPMContext, cmd []byte) ([]byte, error) {
+	if len(cmd) < commandHeaderSize {
+		return nil, fmt.Errorf("command too small (%d bytes)", len(cmd))
+	}
+	tag := tpm2.StructTag(binary.BigEndian.Uint16(cmd))
+	commandCode := tpm2.CommandCode(binary.BigEndian.Uint32(cmd[6:]))
+
+	rc, rTag, rBytes, err := tpm.RunCommandBytes(tag, commandCode, cmd[commandHeaderSize:])
+	if err != nil {
+		return nil, xerrors.Errorf("cannot submit command: %w", err)
+	}
+	return mu.MarshalToBytes(rTag, uint32(responseHeaderSize+len(rBytes)), rc, mu.RawBytes(rBytes))
+}
+
+// serveTPM handles a connection to the TPM command channel until the client ends the session, and then flushes the transient
+// objects and sessions that the client loaded.
+func (p *proxy) serveTPM(conn io.ReadWriter) error {
+	tpm := p.shared.NewTPMContext()
+	defer tpm.Close()
+
+	for {
+		var cmd uint32
+		if err := binary.Read(conn, binary.BigEndian, &cmd); err != nil {
+			return xerrors.Errorf("cannot read command: %w", err)
+		}
+
+		switch cmd {
+		case cmdTPMSendCommand:
+			var locality uint8
+			var size uint32
+			if err := binary.Read(conn, binary.BigEndian, &locality); err != nil {
+				return xerrors.Errorf("cannot read locality: %w", err)
+			}
+			if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+				return xerrors.Errorf("cannot read command size: %w", err)
+			}
+			if size > maxCommandSize {
+				return fmt.Errorf("command too large (%d bytes)", size)
+			}
+			tpmCmd := make([]byte, size)
+			if _, err := io.ReadFull(conn, tpmCmd); err != nil {
+				return xerrors.Errorf("cannot read command: %w", err)
+			}
+
+			rsp, err := submit(tpm, tpmCmd)
+			if err != nil {
+				return err
+			}
+
+			if err := binary.Write(conn, binary.BigEndian, uint32(len(rsp))); err != nil {
+				return xerrors.Errorf("cannot send response size: %w", err)
+			}
+			if _, err := conn.Write(rsp); err != nil {
+				return xerrors.Errorf("cannot send response: %w", err)
+			}
+			if err := binary.Write(conn, binary.BigEndian, uint32(0)); err != nil {
+				return xerrors.Errorf("cannot send response trailer: %w", err)
+			}
+		case cmdSessionEnd, cmdStop:
+			return nil
+		default:
+			return fmt.Errorf("unsupported command %d on TPM channel", cmd)
+		}
+	}
+}
+
+// servePlatform handles a connection to the platform channel until the client ends the session.
+func (p *proxy) servePlatform(conn io.ReadWriter) error {
+	for {
+		var cmd uint32
+		if err := binary.Read(conn, binary.BigEndian, &cmd); err != nil {
+			return xerrors.Errorf("cannot read command: %w", err)
+		}
+
+		var rc uint32
+		switch cmd {
+		case cmdPowerOn, cmdNVOn, cmdCancelOff:
+			// The TPM is already powered on with NV available, and commands are never cancelled.
+		case cmdPowerOff, cmdNVOff, cmdReset, cmdCancelOn:
+			rc = platformNotSupported
+		case cmdSessionEnd, cmdStop:
+			return nil
+		default:
+			return fmt.Errorf("unsupported command %d on platform channel", cmd)
+		}
+
+		if err := binary.Write(conn, binary.BigEndian, rc); err != nil {
+			return xerrors.Errorf("cannot send response: %w", err)
+		}
+	}
+}
+
+// serve accepts connections on l and handles each of them with fn until l is closed.
+func serve(l net.Listener, fn func(io.ReadWriter) error) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			var netErr net.Error
+			if xerrors.As(err, &netErr) && netErr.Temporary() {
+				continue
+			}
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			if err := fn(conn); err != nil {
+				log.Printf("%v: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/testutil"
+
+	"golang.org/x/xerrors"
+)
+
+func init() {
+	testutil.AddCommandLineFlags()
+}
+
+func listen(t *testing.T) (net.Listener, uint) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	return l, uint(l.Addr().(*net.TCPAddr).Port)
+}
+
+func commandAttrs(attrs ...tpm2.CommandAttributes) *testutil.MockCommand {
+	return &testutil.MockCommand{CommandCode: tpm2.CommandGetCapability, Response: &testutil.MockResponse{Params: []interface{}{false,
+		&tpm2.CapabilityData{Capability: tpm2.CapabilityCommands, Data: &tpm2.CapabilitiesU{Command: attrs}}}}}
+}
+
+func TestProxy(t *testing.T) {
+	time := tpm2.TimeInfo{Time: 5000, ClockInfo: tpm2.ClockInfo{Clock: 3000, ResetCount: 1, Safe: true}}
+	tcti := testutil.NewMockTCTI(
+		commandAttrs(tpm2.CommandAttributes(tpm2.CommandReadClock)),
+		&testutil.MockCommand{CommandCode: tpm2.CommandReadClock, Response: &testutil.MockResponse{Params: []interface{}{time}}},
+		&testutil.MockCommand{CommandCode: tpm2.CommandReadClock, Response: &testutil.MockResponse{ResponseCode: tpm2.ResponseCode(0x922)}})
+
+	tpmListener, tpmPort := listen(t)
+	defer tpmListener.Close()
+	platformListener, platformPort := listen(t)
+	defer platformListener.Close()
+
+	p := newProxy(tcti)
+	go serve(tpmListener, p.serveTPM)
+	go serve(platformListener, p.servePlatform)
+
+	mssim, err := tpm2.OpenMssim("127.0.0.1", tpmPort, platformPort)
+	if err != nil {
+		t.Fatalf("OpenMssim failed: %v", err)
+	}
+	tpm, _ := tpm2.NewTPMContext(mssim)
+	defer tpm.Close()
+	tpm.SetMaxSubmissions(1)
+
+	current, err := tpm.ReadClock()
+	if err != nil {
+		t.Fatalf("ReadClock failed: %v", err)
+	}
+	if *current != time {
+		t.Errorf("Unexpected time: %+v", current)
+	}
+
+	if _, err := tpm.ReadClock(); !tpm2.IsTPMWarning(err, tpm2.WarningRetry, tpm2.CommandReadClock) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+
+	var pe *tpm2.PlatformCommandError
+	if err := mssim.Reset(); !xerrors.As(err, &pe) || pe.Code != platformNotSupported {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestProxyFlushesOnDisconnect(t *testing.T) {
+	tcti := testutil.NewMockTCTI(
+		commandAttrs(
+			tpm2.CommandAttributes(tpm2.CommandCreatePrimary)|tpm2.AttrRHandle|(1<<25),
+			tpm2.CommandAttributes(tpm2.CommandFlushContext)),
+		&testutil.MockCommand{CommandCode: tpm2.CommandCreatePrimary, Response: &testutil.MockResponse{Handle: 0x80000001}},
+		&testutil.MockCommand{CommandCode: tpm2.CommandFlushContext,
+			Params: func(params []byte) error {
+				if !bytes.Equal(params, []byte{0x80, 0x00, 0x00, 0x01}) {
+					return fmt.Errorf("unexpected handle %x", params)
+				}
+				return nil
+			},
+			Response: &testutil.MockResponse{}})
+
+	tpmListener, tpmPort := listen(t)
+	defer tpmListener.Close()
+	platformListener, platformPort := listen(t)
+	defer platformListener.Close()
+
+	p := newProxy(tcti)
+	done := make(chan error)
+	go func() {
+		conn, err := tpmListener.Accept()
+		if err != nil {
+			done <- err
+			return
+		}
+		defer conn.Close()
+		done <- p.serveTPM(conn)
+	}()
+	go serve(platformListener, p.servePlatform)
+
+	mssim, err := tpm2.OpenMssim("127.0.0.1", tpmPort, platformPort)
+	if err != nil {
+		t.Fatalf("OpenMssim failed: %v", err)
+	}
+	tpm, _ := tpm2.NewTPMContext(mssim)
+
+	var handle tpm2.Handle
+	if err := tpm.RunCommand(tpm2.CommandCreatePrimary, nil, tpm.OwnerHandleContext(), tpm2.Delimiter, tpm2.Delimiter, &handle); err != nil {
+		t.Fatalf("RunCommand failed: %v", err)
+	}
+
+	// The object is flushed once the client disconnects, without the client flushing it.
+	if err := tpm.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("serveTPM failed: %v", err)
+	}
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+}
@@ -6,7 +6,13 @@ package tpm2
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"time"
+
+	"github.com/canonical/go-tpm2/mu"
+
+	"golang.org/x/xerrors"
 )
 
 // Section 30 - Capability Commands
@@ -23,7 +29,31 @@ import (
 //
 // If capability is CapabilityHandles and property does not correspond to a valid handle type, a *TPMParameterError error with
 // an error code of ErrorHandle is returned for parameter index 2.
+//
+// If capability caching has been enabled with TPMContext.SetCapabilityCaching and no sessions are supplied, results that don't
+// change whilst the TPM is running are returned from the cache where possible.
 func (t *TPMContext) GetCapability(capability Capability, property, propertyCount uint32, sessions ...SessionContext) (capabilityData *CapabilityData, err error) {
+	if t.capabilityCache != nil && len(sessions) == 0 {
+		key := capabilityCacheKey{capability, property, propertyCount}
+		if data, cached := t.capabilityCache[key]; cached {
+			capabilityData = new(CapabilityData)
+			if _, err := mu.UnmarshalFromBytes(data, capabilityData); err != nil {
+				panic(fmt.Sprintf("cannot unmarshal cached capability data: %v", err))
+			}
+			return capabilityData, nil
+		}
+		defer func() {
+			if err != nil || !isCapabilityCacheable(capabilityData) {
+				return
+			}
+			data, err := mu.MarshalToBytes(capabilityData)
+			if err != nil {
+				panic(fmt.Sprintf("cannot marshal capability data for cache: %v", err))
+			}
+			t.capabilityCache[key] = data
+		}()
+	}
+
 	capabilityData = &CapabilityData{Capability: capability, Data: &CapabilitiesU{}}
 
 	nextProperty := property
@@ -42,8 +72,8 @@ func (t *TPMContext) GetCapability(capability Capability, property, propertyCoun
 		}
 
 		if data.Capability != capability {
-			return nil, &InvalidResponseError{CommandGetCapability,
-				fmt.Sprintf("TPM responded with data for the wrong capability (got %s)", data.Capability)}
+			return nil, &InvalidResponseError{Command: CommandGetCapability,
+				msg: fmt.Sprintf("TPM responded with data for the wrong capability (got %s)", data.Capability)}
 		}
 
 		var l int
@@ -81,8 +111,8 @@ func (t *TPMContext) GetCapability(capability Capability, property, propertyCoun
 			}
 		case CapabilityPCRs:
 			if moreData {
-				return nil, &InvalidResponseError{CommandGetCapability,
-					fmt.Sprintf("TPM did not respond with all requested properties for capability %s", data.Capability)}
+				return nil, &InvalidResponseError{Command: CommandGetCapability,
+					msg: fmt.Sprintf("TPM did not respond with all requested properties for capability %s", data.Capability)}
 			}
 			return &data, nil
 		case CapabilityTPMProperties:
@@ -111,17 +141,96 @@ func (t *TPMContext) GetCapability(capability Capability, property, propertyCoun
 			}
 		}
 
-		nextProperty += p + 1
-		remaining -= uint32(l)
-
-		if !moreData || remaining <= 0 {
+		if !moreData || uint32(l) >= remaining {
 			break
 		}
+		if l == 0 {
+			return nil, &InvalidResponseError{Command: CommandGetCapability,
+				msg: fmt.Sprintf("TPM indicated that more data is available for capability %s without returning any properties", capability)}
+		}
+
+		nextProperty = p + 1
+		remaining -= uint32(l)
 	}
 
 	return capabilityData, nil
 }
 
+type capabilityCacheKey struct {
+	capability    Capability
+	property      uint32
+	propertyCount uint32
+}
+
+// isCapabilityCacheable indicates whether the supplied capability data can only change if the TPM is reset or reconfigured.
+func isCapabilityCacheable(data *CapabilityData) bool {
+	switch data.Capability {
+	case CapabilityAlgs, CapabilityCommands, CapabilityPCRs, CapabilityECCCurves:
+		return true
+	case CapabilityTPMProperties:
+		for _, prop := range data.Data.TPMProperties {
+			if prop.Property >= PropertyVar {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// SetCapabilityCaching enables or disables caching of the results of TPMContext.GetCapability and the helper functions that wrap
+// it. When enabled, the supported algorithms, command attributes, PCR banks, ECC curves and fixed TPM properties (those below
+// PropertyVar) are cached on this TPMContext the first time that they are requested without any sessions, so that repeated queries
+// don't require a round trip to the TPM. Other capabilities are always obtained from the TPM.
+//
+// Disabling caching discards any cached results. The cache should be invalidated with TPMContext.InvalidateCapabilityCache if the
+// TPM is reconfigured, for example, after changing the PCR allocation and resetting the TPM.
+func (t *TPMContext) SetCapabilityCaching(enable bool) {
+	switch {
+	case !enable:
+		t.capabilityCache = nil
+	case t.capabilityCache == nil:
+		t.capabilityCache = make(map[capabilityCacheKey][]byte)
+	}
+}
+
+// InvalidateCapabilityCache discards any results cached as a result of enabling capability caching with
+// TPMContext.SetCapabilityCaching.
+func (t *TPMContext) InvalidateCapabilityCache() {
+	if t.capabilityCache == nil {
+		return
+	}
+	t.capabilityCache = make(map[capabilityCacheKey][]byte)
+}
+
+// GetCapabilityAll is a helper function that wraps around TPMContext.GetCapability, and returns all of the values of the selected
+// category, starting from the value indicated by the property parameter. TPMs limit the number of values returned by a single
+// TPM2_GetCapability command and indicate that there are more values to be returned, so this will execute as many commands as are
+// required and merge the results. As a consequence, any SessionContext instances provided should have the AttrContinueSession
+// attribute defined.
+func (t *TPMContext) GetCapabilityAll(capability Capability, property uint32, sessions ...SessionContext) (*CapabilityData, error) {
+	return t.GetCapability(capability, property, CapabilityMaxProperties, sessions...)
+}
+
+// GetCapabilityAllAlgs is a helper function that wraps around TPMContext.GetCapabilityAll, and returns properties of all of the
+// algorithms supported by the TPM.
+func (t *TPMContext) GetCapabilityAllAlgs(sessions ...SessionContext) (algs AlgorithmPropertyList, err error) {
+	return t.GetCapabilityAlgs(AlgorithmFirst, CapabilityMaxProperties, sessions...)
+}
+
+// GetCapabilityAllCommands is a helper function that wraps around TPMContext.GetCapabilityAll, and returns attributes of all of the
+// commands supported by the TPM.
+func (t *TPMContext) GetCapabilityAllCommands(sessions ...SessionContext) (commands CommandAttributesList, err error) {
+	return t.GetCapabilityCommands(CommandFirst, CapabilityMaxProperties, sessions...)
+}
+
+// GetCapabilityAllHandles is a helper function that wraps around TPMContext.GetCapabilityAll, and returns the handles of all of the
+// resources on the TPM with the specified handle type.
+func (t *TPMContext) GetCapabilityAllHandles(handleType HandleType, sessions ...SessionContext) (handles HandleList, err error) {
+	return t.GetCapabilityHandles(handleType.BaseHandle(), CapabilityMaxProperties, sessions...)
+}
+
 // GetCapabilityAlgs is a helper function that wraps around TPMContext.GetCapability, and returns properties of the algorithms
 // supported by the TPM. The first parameter indicates the first algorithm for which to return properties. If this algorithm isn't
 // supported, then the properties of the next supported algorithm are returned instead. The propertyCount parameter indicates the
@@ -240,6 +349,7 @@ func (t *TPMContext) GetCapabilityAuthPolicies(first Handle, propertyCount uint3
 type TPMManufacturer uint32
 
 // GetManufacturer is a helper function that wraps around TPMContext.GetCapability in order to obtain the ID of the TPM manufacturer.
+// The result is retained so that vendor-specific errors returned from subsequent commands can be decoded.
 func (t *TPMContext) GetManufacturer(sessions ...SessionContext) (manufacturer TPMManufacturer, err error) {
 	props, err := t.GetCapabilityTPMProperties(PropertyManufacturer, 1, sessions...)
 	if err != nil {
@@ -248,7 +358,9 @@ func (t *TPMContext) GetManufacturer(sessions ...SessionContext) (manufacturer T
 	if len(props) == 0 || props[0].Property != PropertyManufacturer {
 		return 0, &InvalidResponseError{Command: CommandGetCapability, msg: "expected TPM_PT_MANUFACTURER property"}
 	}
-	return TPMManufacturer(props[0].Value), nil
+	manufacturer = TPMManufacturer(props[0].Value)
+	t.manufacturer = &manufacturer
+	return manufacturer, nil
 }
 
 // IsTPM2 determines whether this TPMContext is connected to a TPM2 device. It does this by attempting to execute a TPM2_GetCapability
@@ -271,7 +383,13 @@ func (t *TPMContext) IsTPM2() (isTpm2 bool, err error) {
 
 // GetInputBuffer returns the value of the PropertyInputBuffer property, which indicates the maximum size of arguments of the
 // MaxBuffer type in bytes. The size is TPM implementation specific, but required to be at least 1024 bytes.
+//
+// If no sessions are supplied and the properties used internally by TPMContext have already been initialized, this returns the value
+// obtained by TPMContext.InitProperties without executing a command.
 func (t *TPMContext) GetInputBuffer(sessions ...SessionContext) int {
+	if len(sessions) == 0 && t.propertiesInitialized {
+		return t.maxBufferSize
+	}
 	props, err := t.GetCapabilityTPMProperties(PropertyInputBuffer, 1, sessions...)
 	if err != nil {
 		return 1024
@@ -283,8 +401,12 @@ func (t *TPMContext) GetInputBuffer(sessions ...SessionContext) int {
 }
 
 // GetMaxDigest returns the value of the PropertyMaxDigest property, which indicates the size of the largest digest algorithm
-// supported by the TPM in bytes.
+// supported by the TPM in bytes. As with TPMContext.GetInputBuffer, a cached value is returned if no sessions are supplied and the
+// properties used internally by TPMContext have already been initialized.
 func (t *TPMContext) GetMaxDigest(sessions ...SessionContext) (int, error) {
+	if len(sessions) == 0 && t.propertiesInitialized {
+		return t.maxDigestSize, nil
+	}
 	props, err := t.GetCapabilityTPMProperties(PropertyMaxDigest, 1, sessions...)
 	if err != nil {
 		return 0, err
@@ -305,8 +427,12 @@ func (t *TPMContext) GetMaxData(sessions ...SessionContext) (int, error) {
 }
 
 // GetNVBufferMax returns the value of the PropertyNVBufferMax property, which indicates the maximum buffer size supported by
-// the TPM in bytes for TPMContext.NVReadRaw and TPMContext.NVWriteRaw.
+// the TPM in bytes for TPMContext.NVReadRaw and TPMContext.NVWriteRaw. As with TPMContext.GetInputBuffer, a cached value is
+// returned if no sessions are supplied and the properties used internally by TPMContext have already been initialized.
 func (t *TPMContext) GetNVBufferMax(sessions ...SessionContext) (int, error) {
+	if len(sessions) == 0 && t.propertiesInitialized {
+		return t.maxNVBufferSize, nil
+	}
 	props, err := t.GetCapabilityTPMProperties(PropertyNVBufferMax, 1, sessions...)
 	if err != nil {
 		return 0, err
@@ -317,6 +443,313 @@ func (t *TPMContext) GetNVBufferMax(sessions ...SessionContext) (int, error) {
 	return int(props[0].Value), nil
 }
 
+// GetNVWriteRecovery returns the value of the PropertyNVWriteRecovery property, which indicates how long the TPM requires before it
+// will accept another command that modifies NV memory after returning TPM_RC_NV_RATE.
+func (t *TPMContext) GetNVWriteRecovery(sessions ...SessionContext) (time.Duration, error) {
+	props, err := t.GetCapabilityTPMProperties(PropertyNVWriteRecovery, 1, sessions...)
+	if err != nil {
+		return 0, err
+	}
+	if len(props) == 0 || props[0].Property != PropertyNVWriteRecovery {
+		return 0, &InvalidResponseError{Command: CommandGetCapability, msg: "expected TPM_PT_NV_WRITE_RECOVERY property"}
+	}
+	return time.Duration(props[0].Value) * time.Millisecond, nil
+}
+
+// LockoutStatus describes the state of the TPM's dictionary attack protection, and is returned from TPMContext.LockoutStatus.
+type LockoutStatus struct {
+	InLockout       bool          // The TPM is in lockout mode (TPMA_PERMANENT.inLockout)
+	LockoutCounter  uint32        // The current number of authorization failures (TPM_PT_LOCKOUT_COUNTER)
+	MaxTries        uint32        // The number of authorization failures before the TPM enters lockout mode (TPM_PT_MAX_AUTH_FAIL)
+	RecoveryTime    time.Duration // The interval after which the failure count is decremented (TPM_PT_LOCKOUT_INTERVAL)
+	LockoutRecovery time.Duration // The time after a failed lockout hierarchy authorization before it can be used again (TPM_PT_LOCKOUT_RECOVERY)
+
+	// TimeUntilRecovery is an estimate of how long it will be before the TPM leaves lockout mode without a call to
+	// TPMContext.DictionaryAttackLockReset. It is zero if the TPM is not in lockout mode. It is computed from the current
+	// failure count and recovery interval, and doesn't account for time that has already elapsed since the failure count was
+	// last decremented. It is -1 if the TPM will only leave lockout mode once the failure count is reset.
+	TimeUntilRecovery time.Duration
+}
+
+// LockoutStatus is a helper function that wraps around TPMContext.GetCapability in order to obtain the current state of the
+// TPM's dictionary attack protection.
+func (t *TPMContext) LockoutStatus(sessions ...SessionContext) (*LockoutStatus, error) {
+	props, err := t.GetCapabilityTPMProperties(PropertyPermanent, uint32(PropertyLockoutRecovery-PropertyPermanent)+1, sessions...)
+	if err != nil {
+		return nil, err
+	}
+	return makeLockoutStatus(props)
+}
+
+func makeLockoutStatus(props TaggedTPMPropertyList) (*LockoutStatus, error) {
+	var status LockoutStatus
+	var found int
+	for _, prop := range props {
+		switch prop.Property {
+		case PropertyPermanent:
+			status.InLockout = PermanentAttributes(prop.Value)&AttrInLockout != 0
+		case PropertyLockoutCounter:
+			status.LockoutCounter = prop.Value
+		case PropertyMaxAuthFail:
+			status.MaxTries = prop.Value
+		case PropertyLockoutInterval:
+			status.RecoveryTime = time.Duration(prop.Value) * time.Second
+		case PropertyLockoutRecovery:
+			status.LockoutRecovery = time.Duration(prop.Value) * time.Second
+		default:
+			continue
+		}
+		found++
+	}
+	if found != 5 {
+		return nil, &InvalidResponseError{Command: CommandGetCapability, msg: "missing dictionary attack properties"}
+	}
+
+	if status.InLockout {
+		switch {
+		case status.RecoveryTime == 0:
+			status.TimeUntilRecovery = -1
+		case status.LockoutCounter >= status.MaxTries:
+			status.TimeUntilRecovery = time.Duration(status.LockoutCounter-status.MaxTries+1) * status.RecoveryTime
+		default:
+			status.TimeUntilRecovery = status.RecoveryTime
+		}
+	}
+
+	return &status, nil
+}
+
+// Capabilities is a consolidated description of the features supported by a TPM, and is returned from TPMContext.Capabilities.
+type Capabilities struct {
+	Commands   map[CommandCode]CommandAttributes   // The commands supported by the TPM
+	Algorithms map[AlgorithmId]AlgorithmAttributes // The algorithms supported by the TPM
+	ECCCurves  ECCCurveList                        // The ECC curves supported by the TPM
+	PCRBanks   []HashAlgorithmId                   // The PCR banks that currently have PCRs allocated
+	PCRCount   int                                 // The number of PCRs in each bank (TPM_PT_PCR_COUNT)
+
+	InputBuffer     int // Maximum size of a MaxBuffer argument (TPM_PT_INPUT_BUFFER)
+	MaxDigest       int // Size of the largest digest produced by the TPM (TPM_PT_MAX_DIGEST)
+	MaxCommandSize  int // Maximum size of a command (TPM_PT_MAX_COMMAND_SIZE)
+	MaxResponseSize int // Maximum size of a response (TPM_PT_MAX_RESPONSE_SIZE)
+	NVIndexMax      int // Maximum size of a NV index data area (TPM_PT_NV_INDEX_MAX)
+	NVBufferMax     int // Maximum size of a NV read or write buffer (TPM_PT_NV_BUFFER_MAX)
+
+	NVCountersMax   uint32 // Maximum number of NV indices with the counter type, or zero if there is no fixed limit (TPM_PT_NV_COUNTERS_MAX)
+	NVCountersAvail uint32 // Number of additional counter indices that can be defined (TPM_PT_NV_COUNTERS_AVAIL)
+
+	Lockout LockoutStatus // The dictionary attack protection parameters and state at the time that the capabilities were obtained
+}
+
+// IsCommandSupported indicates whether the TPM supports the specified command.
+func (c *Capabilities) IsCommandSupported(code CommandCode) bool {
+	_, ok := c.Commands[code]
+	return ok
+}
+
+// IsAlgorithmSupported indicates whether the TPM supports the specified algorithm.
+func (c *Capabilities) IsAlgorithmSupported(alg AlgorithmId) bool {
+	_, ok := c.Algorithms[alg]
+	return ok
+}
+
+// IsECCCurveSupported indicates whether the TPM supports the specified ECC curve.
+func (c *Capabilities) IsECCCurveSupported(curve ECCCurve) bool {
+	for _, c := range c.ECCCurves {
+		if c == curve {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPCRBankSupported indicates whether the TPM currently has PCRs allocated for the specified digest algorithm.
+func (c *Capabilities) IsPCRBankSupported(alg HashAlgorithmId) bool {
+	for _, b := range c.PCRBanks {
+		if b == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// AlgorithmSelection describes the strongest algorithms that are supported by both the TPM and this package, and is returned from
+// Capabilities.SelectAlgorithms and TPMContext.NegotiateAlgorithms.
+type AlgorithmSelection struct {
+	NameAlg          HashAlgorithmId // Digest algorithm for object names, authorization policies and sessions
+	SessionSymmetric *SymDef         // Symmetric algorithm for session based parameter encryption
+	ECCCurve         ECCCurve        // Curve for ECC keys, or zero if the TPM doesn't support a curve that can be used
+}
+
+var (
+	// preferredNameAlgs is the list of digest algorithms in order of preference.
+	preferredNameAlgs = []HashAlgorithmId{HashAlgorithmSHA512, HashAlgorithmSHA384, HashAlgorithmSHA256, HashAlgorithmSHA1}
+
+	// preferredECCCurves is the list of ECC curves in order of preference. Only curves that have an implementation in
+	// crypto/elliptic are included.
+	preferredECCCurves = []ECCCurve{ECCCurveNIST_P521, ECCCurveNIST_P384, ECCCurveNIST_P256}
+
+	// preferredAESKeySizes is the list of AES key sizes in order of preference.
+	preferredAESKeySizes = []uint16{256, 192, 128}
+)
+
+// SelectAlgorithms selects the strongest digest algorithm, session symmetric algorithm and ECC curve that are supported by both
+// the TPM and this package. Digest algorithms must also be linked in to the current binary. Where AES and CFB mode are supported,
+// AES-128 in CFB mode is selected for sessions, as the TPM doesn't advertise the AES key sizes that it supports - use
+// TPMContext.NegotiateAlgorithms to select a larger key size where possible. If AES isn't supported, XOR obfuscation with the
+// selected digest algorithm is selected for sessions.
+//
+// An error is returned if the TPM doesn't support any usable digest algorithm.
+func (c *Capabilities) SelectAlgorithms() (*AlgorithmSelection, error) {
+	var selection AlgorithmSelection
+	for _, alg := range preferredNameAlgs {
+		if c.IsAlgorithmSupported(AlgorithmId(alg)) && alg.Available() {
+			selection.NameAlg = alg
+			break
+		}
+	}
+	if !selection.NameAlg.IsValid() {
+		return nil, errors.New("no supported digest algorithm")
+	}
+
+	if c.IsAlgorithmSupported(AlgorithmAES) && c.IsAlgorithmSupported(AlgorithmCFB) {
+		selection.SessionSymmetric = SymDefAES128CFB()
+	} else {
+		selection.SessionSymmetric = SymDefXOR(selection.NameAlg)
+	}
+
+	if c.IsAlgorithmSupported(AlgorithmECC) {
+		for _, curve := range preferredECCCurves {
+			if c.IsECCCurveSupported(curve) {
+				selection.ECCCurve = curve
+				break
+			}
+		}
+	}
+
+	return &selection, nil
+}
+
+// NegotiateAlgorithms is a helper function that obtains the capabilities of the TPM with TPMContext.Capabilities and selects the
+// strongest mutually supported algorithms with Capabilities.SelectAlgorithms, so that applications don't need to hard-code
+// algorithms that might not be supported by every TPM. If AES is selected for sessions and the TPM supports TPM2_TestParms, this
+// also tests larger key sizes and selects the largest one that is supported.
+//
+// If capability caching has been enabled with TPMContext.SetCapabilityCaching, most of the capabilities are obtained from the
+// cache.
+func (t *TPMContext) NegotiateAlgorithms(sessions ...SessionContext) (*AlgorithmSelection, error) {
+	caps, err := t.Capabilities(sessions...)
+	if err != nil {
+		return nil, err
+	}
+	selection, err := caps.SelectAlgorithms()
+	if err != nil {
+		return nil, err
+	}
+
+	if selection.SessionSymmetric.Algorithm != SymAlgorithmAES || !caps.IsCommandSupported(CommandTestParms) {
+		return selection, nil
+	}
+
+	for _, keyBits := range preferredAESKeySizes {
+		if keyBits == selection.SessionSymmetric.KeyBits.Sym {
+			break
+		}
+		err := t.TestParms(&PublicParams{
+			Type: ObjectTypeSymCipher,
+			Parameters: &PublicParamsU{
+				SymDetail: &SymCipherParams{
+					Sym: SymDefObject{
+						Algorithm: SymObjectAlgorithmAES,
+						KeyBits:   &SymKeyBitsU{Sym: keyBits},
+						Mode:      &SymModeU{Sym: SymModeCFB}}}}}, sessions...)
+		switch {
+		case err == nil:
+			selection.SessionSymmetric.KeyBits.Sym = keyBits
+			return selection, nil
+		case IsTPMError(err, AnyErrorCode, CommandTestParms) || IsTPMParameterError(err, AnyErrorCode, CommandTestParms, AnyParameterIndex):
+			// This key size isn't supported
+		default:
+			return nil, xerrors.Errorf("cannot test AES key size %d: %w", keyBits, err)
+		}
+	}
+
+	return selection, nil
+}
+
+// Capabilities is a helper function that wraps around TPMContext.GetCapability in order to obtain the commands, algorithms, ECC
+// curves, PCR banks, size limits and dictionary attack parameters of the TPM in a single structure, so that features can be
+// detected in one place.
+func (t *TPMContext) Capabilities(sessions ...SessionContext) (*Capabilities, error) {
+	caps := &Capabilities{
+		Commands:   make(map[CommandCode]CommandAttributes),
+		Algorithms: make(map[AlgorithmId]AlgorithmAttributes)}
+
+	cmds, err := t.GetCapabilityCommands(CommandFirst, CapabilityMaxProperties, sessions...)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot obtain supported commands: %w", err)
+	}
+	for _, attrs := range cmds {
+		caps.Commands[attrs.CommandCode()] = attrs
+	}
+
+	algs, err := t.GetCapabilityAlgs(AlgorithmFirst, CapabilityMaxProperties, sessions...)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot obtain supported algorithms: %w", err)
+	}
+	for _, alg := range algs {
+		caps.Algorithms[alg.Alg] = alg.Properties
+	}
+
+	caps.ECCCurves, err = t.GetCapabilityECCCurves(sessions...)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot obtain supported ECC curves: %w", err)
+	}
+
+	pcrs, err := t.GetCapabilityPCRs(sessions...)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot obtain PCR allocation: %w", err)
+	}
+	for _, s := range pcrs {
+		if len(s.Select) > 0 {
+			caps.PCRBanks = append(caps.PCRBanks, s.Hash)
+		}
+	}
+
+	props, err := t.GetCapabilityTPMProperties(PropertyFixed, CapabilityMaxProperties, sessions...)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot obtain properties: %w", err)
+	}
+	for _, prop := range props {
+		switch prop.Property {
+		case PropertyPCRCount:
+			caps.PCRCount = int(prop.Value)
+		case PropertyInputBuffer:
+			caps.InputBuffer = int(prop.Value)
+		case PropertyMaxDigest:
+			caps.MaxDigest = int(prop.Value)
+		case PropertyMaxCommandSize:
+			caps.MaxCommandSize = int(prop.Value)
+		case PropertyMaxResponseSize:
+			caps.MaxResponseSize = int(prop.Value)
+		case PropertyNVIndexMax:
+			caps.NVIndexMax = int(prop.Value)
+		case PropertyNVBufferMax:
+			caps.NVBufferMax = int(prop.Value)
+		case PropertyNVCountersMax:
+			caps.NVCountersMax = prop.Value
+		case PropertyNVCountersAvail:
+			caps.NVCountersAvail = prop.Value
+		}
+	}
+	lockout, err := makeLockoutStatus(props)
+	if err != nil {
+		return nil, err
+	}
+	caps.Lockout = *lockout
+
+	return caps, nil
+}
+
 // TestParms executes the TPM2_TestParms command to check if the specified combination of algorithm parameters is supported.
 func (t *TPMContext) TestParms(parameters *PublicParams, sessions ...SessionContext) error {
 	return t.RunCommand(CommandTestParms, sessions, Delimiter, parameters)
@@ -8,8 +8,11 @@ import (
 	"fmt"
 	"math"
 	"reflect"
+	"testing"
+	"time"
 
 	. "github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
 	"github.com/canonical/go-tpm2/testutil"
 
 	. "gopkg.in/check.v1"
@@ -520,3 +523,365 @@ func (s *capabilitiesSuite) TestGetCapabilityPCRProperties3(c *C) {
 		expected: TaggedPCRPropertyList{
 			{Tag: PropertyPCRSave, Select: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}}}})
 }
+
+func TestSelectAlgorithms(t *testing.T) {
+	for _, data := range []struct {
+		desc     string
+		caps     *Capabilities
+		expected *AlgorithmSelection
+		err      string
+	}{
+		{
+			desc: "AES",
+			caps: &Capabilities{
+				Algorithms: map[AlgorithmId]AlgorithmAttributes{
+					AlgorithmSHA1:   AttrHash,
+					AlgorithmSHA256: AttrHash,
+					AlgorithmAES:    AttrSymmetric,
+					AlgorithmCFB:    AttrSymmetric | AttrEncrypting,
+					AlgorithmECC:    AttrAsymmetric | AttrObject},
+				ECCCurves: ECCCurveList{ECCCurveNIST_P256, ECCCurveBN_P256}},
+			expected: &AlgorithmSelection{NameAlg: HashAlgorithmSHA256, SessionSymmetric: SymDefAES128CFB(), ECCCurve: ECCCurveNIST_P256},
+		},
+		{
+			desc: "XOR",
+			caps: &Capabilities{
+				Algorithms: map[AlgorithmId]AlgorithmAttributes{
+					AlgorithmSHA384: AttrHash,
+					AlgorithmAES:    AttrSymmetric,
+					AlgorithmXOR:    AttrSymmetric | AttrHash},
+				ECCCurves: ECCCurveList{ECCCurveNIST_P384}},
+			expected: &AlgorithmSelection{NameAlg: HashAlgorithmSHA384, SessionSymmetric: SymDefXOR(HashAlgorithmSHA384)},
+		},
+		{
+			desc: "NoDigest",
+			caps: &Capabilities{Algorithms: map[AlgorithmId]AlgorithmAttributes{AlgorithmSM3_256: AttrHash}},
+			err:  "no supported digest algorithm",
+		},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			selection, err := data.caps.SelectAlgorithms()
+			if data.err != "" {
+				if err == nil || err.Error() != data.err {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SelectAlgorithms failed: %v", err)
+			}
+			if !reflect.DeepEqual(selection, data.expected) {
+				t.Errorf("Unexpected selection: %+v", selection)
+			}
+		})
+	}
+}
+
+func TestNegotiateAlgorithms(t *testing.T) {
+	capability := func(data *CapabilityData) *testutil.MockCommand {
+		return &testutil.MockCommand{CommandCode: CommandGetCapability, Response: &testutil.MockResponse{Params: []interface{}{false, data}}}
+	}
+
+	tcti := testutil.NewMockTCTI(
+		capability(&CapabilityData{Capability: CapabilityCommands, Data: &CapabilitiesU{Command: CommandAttributesList{
+			makeCommandAttributes(CommandGetCapability, 0, 0),
+			makeCommandAttributes(CommandTestParms, 0, 0)}}}),
+		capability(&CapabilityData{Capability: CapabilityAlgs, Data: &CapabilitiesU{Algorithms: AlgorithmPropertyList{
+			{Alg: AlgorithmSHA256, Properties: AttrHash},
+			{Alg: AlgorithmSHA384, Properties: AttrHash},
+			{Alg: AlgorithmAES, Properties: AttrSymmetric},
+			{Alg: AlgorithmCFB, Properties: AttrSymmetric | AttrEncrypting},
+			{Alg: AlgorithmECC, Properties: AttrAsymmetric | AttrObject}}}}),
+		capability(&CapabilityData{Capability: CapabilityECCCurves, Data: &CapabilitiesU{ECCCurves: ECCCurveList{ECCCurveNIST_P256, ECCCurveNIST_P384}}}),
+		capability(&CapabilityData{Capability: CapabilityPCRs, Data: &CapabilitiesU{AssignedPCR: PCRSelectionList{
+			{Hash: HashAlgorithmSHA256, Select: PCRSelect{0, 1, 2}}}}}),
+		capability(&CapabilityData{Capability: CapabilityTPMProperties, Data: &CapabilitiesU{TPMProperties: TaggedTPMPropertyList{
+			{Property: PropertyPermanent},
+			{Property: PropertyLockoutCounter, Value: 0},
+			{Property: PropertyMaxAuthFail, Value: 32},
+			{Property: PropertyLockoutInterval, Value: 7200},
+			{Property: PropertyLockoutRecovery, Value: 86400}}}}),
+		// 256-bit AES keys are rejected with TPM_RC_KEY_SIZE + TPM_RC_P + TPM_RC_1
+		&testutil.MockCommand{CommandCode: CommandTestParms, Response: &testutil.MockResponse{ResponseCode: 0x1c7}},
+		&testutil.MockCommand{CommandCode: CommandTestParms, Response: &testutil.MockResponse{}})
+	tpm, _ := NewTPMContext(tcti)
+
+	selection, err := tpm.NegotiateAlgorithms()
+	if err != nil {
+		t.Fatalf("NegotiateAlgorithms failed: %v", err)
+	}
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+
+	expected := &AlgorithmSelection{
+		NameAlg: HashAlgorithmSHA384,
+		SessionSymmetric: &SymDef{
+			Algorithm: SymAlgorithmAES,
+			KeyBits:   &SymKeyBitsU{Sym: 192},
+			Mode:      &SymModeU{Sym: SymModeCFB}},
+		ECCCurve: ECCCurveNIST_P384}
+	if !reflect.DeepEqual(selection, expected) {
+		t.Errorf("Unexpected selection: %+v", selection)
+	}
+}
+
+func TestGetCapabilityAllPagination(t *testing.T) {
+	getHandles := func(moreData bool, handles ...Handle) *testutil.MockCommand {
+		return &testutil.MockCommand{CommandCode: CommandGetCapability, Response: &testutil.MockResponse{Params: []interface{}{moreData,
+			&CapabilityData{Capability: CapabilityHandles, Data: &CapabilitiesU{Handles: handles}}}}}
+	}
+
+	tcti := testutil.NewMockTCTI(
+		getHandles(true, 0x81000000, 0x81000001),
+		getHandles(true, 0x81000005),
+		getHandles(false, 0x81010001),
+		getHandles(true))
+	tpm, _ := NewTPMContext(tcti)
+
+	handles, err := tpm.GetCapabilityAllHandles(HandleTypePersistent)
+	if err != nil {
+		t.Fatalf("GetCapabilityAllHandles failed: %v", err)
+	}
+	if !reflect.DeepEqual(handles, HandleList{0x81000000, 0x81000001, 0x81000005, 0x81010001}) {
+		t.Errorf("Unexpected handles: %v", handles)
+	}
+
+	if len(tcti.Commands()) != 3 {
+		t.Fatalf("Unexpected number of commands: %d", len(tcti.Commands()))
+	}
+	for i, expected := range []struct {
+		property uint32
+		count    uint32
+	}{
+		{property: 0x81000000, count: CapabilityMaxProperties},
+		{property: 0x81000002, count: CapabilityMaxProperties - 2},
+		{property: 0x81000006, count: CapabilityMaxProperties - 3},
+	} {
+		var capability Capability
+		var property, count uint32
+		if _, err := mu.UnmarshalFromBytes(tcti.Commands()[i][10:], &capability, &property, &count); err != nil {
+			t.Fatalf("UnmarshalFromBytes failed: %v", err)
+		}
+		if capability != CapabilityHandles || property != expected.property || count != expected.count {
+			t.Errorf("Unexpected command %d: %v, 0x%08x, %d", i, capability, property, count)
+		}
+	}
+
+	if _, err := tpm.GetCapabilityAll(CapabilityHandles, uint32(HandleTypeTransient.BaseHandle())); err == nil ||
+		err.Error() != "TPM returned an invalid response for command TPM_CC_GetCapability: TPM indicated that more data is available "+
+			"for capability TPM_CAP_HANDLES without returning any properties" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	capability := func(data *CapabilityData) *testutil.MockCommand {
+		return &testutil.MockCommand{CommandCode: CommandGetCapability, Response: &testutil.MockResponse{Params: []interface{}{false, data}}}
+	}
+
+	tcti := testutil.NewMockTCTI(
+		capability(&CapabilityData{Capability: CapabilityCommands, Data: &CapabilitiesU{Command: CommandAttributesList{
+			makeCommandAttributes(CommandGetCapability, 0, 0),
+			makeCommandAttributes(CommandPCRRead, 0, 0)}}}),
+		capability(&CapabilityData{Capability: CapabilityAlgs, Data: &CapabilitiesU{Algorithms: AlgorithmPropertyList{
+			{Alg: AlgorithmSHA256, Properties: AttrHash},
+			{Alg: AlgorithmECC, Properties: AttrAsymmetric | AttrObject}}}}),
+		capability(&CapabilityData{Capability: CapabilityECCCurves, Data: &CapabilitiesU{ECCCurves: ECCCurveList{ECCCurveNIST_P256}}}),
+		capability(&CapabilityData{Capability: CapabilityPCRs, Data: &CapabilitiesU{AssignedPCR: PCRSelectionList{
+			{Hash: HashAlgorithmSHA1, Select: PCRSelect{}},
+			{Hash: HashAlgorithmSHA256, Select: PCRSelect{0, 1, 2}}}}}),
+		capability(&CapabilityData{Capability: CapabilityTPMProperties, Data: &CapabilitiesU{TPMProperties: TaggedTPMPropertyList{
+			{Property: PropertyInputBuffer, Value: 1024},
+			{Property: PropertyPCRCount, Value: 24},
+			{Property: PropertyNVCountersMax, Value: 0},
+			{Property: PropertyNVIndexMax, Value: 2048},
+			{Property: PropertyMaxCommandSize, Value: 4096},
+			{Property: PropertyMaxResponseSize, Value: 4096},
+			{Property: PropertyMaxDigest, Value: 32},
+			{Property: PropertyNVBufferMax, Value: 1024},
+			{Property: PropertyPermanent},
+			{Property: PropertyNVCountersAvail, Value: 6},
+			{Property: PropertyLockoutCounter, Value: 0},
+			{Property: PropertyMaxAuthFail, Value: 32},
+			{Property: PropertyLockoutInterval, Value: 7200},
+			{Property: PropertyLockoutRecovery, Value: 86400}}}}))
+	tpm, _ := NewTPMContext(tcti)
+
+	caps, err := tpm.Capabilities()
+	if err != nil {
+		t.Fatalf("Capabilities failed: %v", err)
+	}
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+
+	expected := &Capabilities{
+		Commands: map[CommandCode]CommandAttributes{
+			CommandGetCapability: makeCommandAttributes(CommandGetCapability, 0, 0),
+			CommandPCRRead:       makeCommandAttributes(CommandPCRRead, 0, 0)},
+		Algorithms: map[AlgorithmId]AlgorithmAttributes{
+			AlgorithmSHA256: AttrHash,
+			AlgorithmECC:    AttrAsymmetric | AttrObject},
+		ECCCurves:       ECCCurveList{ECCCurveNIST_P256},
+		PCRBanks:        []HashAlgorithmId{HashAlgorithmSHA256},
+		PCRCount:        24,
+		InputBuffer:     1024,
+		MaxDigest:       32,
+		MaxCommandSize:  4096,
+		MaxResponseSize: 4096,
+		NVIndexMax:      2048,
+		NVBufferMax:     1024,
+		NVCountersAvail: 6,
+		Lockout: LockoutStatus{
+			MaxTries:        32,
+			RecoveryTime:    2 * time.Hour,
+			LockoutRecovery: 24 * time.Hour}}
+	if !reflect.DeepEqual(caps, expected) {
+		t.Errorf("Unexpected capabilities: %+v", caps)
+	}
+
+	if !caps.IsCommandSupported(CommandPCRRead) || caps.IsCommandSupported(CommandPCRExtend) {
+		t.Errorf("Unexpected IsCommandSupported result")
+	}
+	if !caps.IsAlgorithmSupported(AlgorithmECC) || caps.IsAlgorithmSupported(AlgorithmRSA) {
+		t.Errorf("Unexpected IsAlgorithmSupported result")
+	}
+	if !caps.IsECCCurveSupported(ECCCurveNIST_P256) || caps.IsECCCurveSupported(ECCCurveNIST_P384) {
+		t.Errorf("Unexpected IsECCCurveSupported result")
+	}
+	if !caps.IsPCRBankSupported(HashAlgorithmSHA256) || caps.IsPCRBankSupported(HashAlgorithmSHA1) {
+		t.Errorf("Unexpected IsPCRBankSupported result")
+	}
+}
+
+func mockTPMPropertiesCommand(props ...TaggedProperty) *testutil.MockCommand {
+	return &testutil.MockCommand{CommandCode: CommandGetCapability, Response: &testutil.MockResponse{Params: []interface{}{false,
+		&CapabilityData{Capability: CapabilityTPMProperties, Data: &CapabilitiesU{TPMProperties: props}}}}}
+}
+
+func TestLockoutStatus(t *testing.T) {
+	for _, data := range []struct {
+		desc     string
+		attrs    PermanentAttributes
+		counter  uint32
+		interval uint32
+		expected time.Duration
+	}{
+		{desc: "NotInLockout", counter: 3, interval: 7200},
+		{desc: "InLockout", attrs: AttrInLockout, counter: 34, interval: 7200, expected: 3 * 2 * time.Hour},
+		{desc: "NoRecovery", attrs: AttrInLockout, counter: 32, expected: -1},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			tcti := testutil.NewMockTCTI(mockTPMPropertiesCommand(
+				TaggedProperty{Property: PropertyPermanent, Value: uint32(data.attrs)},
+				TaggedProperty{Property: PropertyLockoutCounter, Value: data.counter},
+				TaggedProperty{Property: PropertyMaxAuthFail, Value: 32},
+				TaggedProperty{Property: PropertyLockoutInterval, Value: data.interval},
+				TaggedProperty{Property: PropertyLockoutRecovery, Value: 86400}))
+			tpm, _ := NewTPMContext(tcti)
+
+			status, err := tpm.LockoutStatus()
+			if err != nil {
+				t.Fatalf("LockoutStatus failed: %v", err)
+			}
+			expected := &LockoutStatus{
+				InLockout:         data.attrs&AttrInLockout != 0,
+				LockoutCounter:    data.counter,
+				MaxTries:          32,
+				RecoveryTime:      time.Duration(data.interval) * time.Second,
+				LockoutRecovery:   24 * time.Hour,
+				TimeUntilRecovery: data.expected}
+			if !reflect.DeepEqual(status, expected) {
+				t.Errorf("Unexpected status: %+v", status)
+			}
+		})
+	}
+
+	tpm, _ := NewTPMContext(testutil.NewMockTCTI(mockTPMPropertiesCommand(TaggedProperty{Property: PropertyPermanent})))
+	if _, err := tpm.LockoutStatus(); err == nil || err.Error() != "TPM returned an invalid response for command TPM_CC_GetCapability: missing dictionary attack properties" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestSizingFromTPMProperties(t *testing.T) {
+	getRandom := func(n int) *testutil.MockCommand {
+		return &testutil.MockCommand{CommandCode: CommandGetRandom, Response: &testutil.MockResponse{Params: []interface{}{make(Digest, n)}}}
+	}
+
+	tcti := testutil.NewMockTCTI(
+		mockTPMPropertiesCommand(
+			TaggedProperty{Property: PropertyInputBuffer, Value: 1024},
+			TaggedProperty{Property: PropertyMaxDigest, Value: 20},
+			TaggedProperty{Property: PropertyNVBufferMax, Value: 512}),
+		getRandom(20),
+		getRandom(12),
+		getRandom(8))
+	tpm, _ := NewTPMContext(tcti)
+
+	data, err := tpm.GetRandom(40)
+	if err != nil {
+		t.Fatalf("GetRandom failed: %v", err)
+	}
+	if len(data) != 40 {
+		t.Errorf("Unexpected number of bytes: %d", len(data))
+	}
+
+	var requested []uint16
+	for _, cmd := range tcti.Commands()[1:] {
+		requested = append(requested, uint16(cmd[10])<<8|uint16(cmd[11]))
+	}
+	if !reflect.DeepEqual(requested, []uint16{20, 20, 8}) {
+		t.Errorf("Unexpected requested sizes: %v", requested)
+	}
+
+	// These should be answered without executing any more commands.
+	if n, err := tpm.GetMaxDigest(); err != nil || n != 20 {
+		t.Errorf("Unexpected GetMaxDigest result: %d, %v", n, err)
+	}
+	if n, err := tpm.GetNVBufferMax(); err != nil || n != 512 {
+		t.Errorf("Unexpected GetNVBufferMax result: %d, %v", n, err)
+	}
+	if n := tpm.GetInputBuffer(); n != 1024 {
+		t.Errorf("Unexpected GetInputBuffer result: %d", n)
+	}
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+}
+
+func TestCapabilityCaching(t *testing.T) {
+	manufacturer := mockTPMPropertiesCommand(TaggedProperty{Property: PropertyManufacturer, Value: uint32(TPMManufacturerIBM)})
+	permanent := mockTPMPropertiesCommand(TaggedProperty{Property: PropertyPermanent, Value: 0})
+
+	tcti := testutil.NewMockTCTI(manufacturer, manufacturer, permanent, permanent, manufacturer, manufacturer)
+	tpm, _ := NewTPMContext(tcti)
+
+	check := func(desc string, property Property, expectedCommands int) {
+		props, err := tpm.GetCapabilityTPMProperties(property, 1)
+		if err != nil {
+			t.Fatalf("%s: GetCapabilityTPMProperties failed: %v", desc, err)
+		}
+		if len(props) != 1 || props[0].Property != property {
+			t.Errorf("%s: Unexpected properties: %v", desc, props)
+		}
+		if len(tcti.Commands()) != expectedCommands {
+			t.Errorf("%s: Unexpected number of commands: %d", desc, len(tcti.Commands()))
+		}
+	}
+
+	check("Disabled1", PropertyManufacturer, 1)
+	tpm.SetCapabilityCaching(true)
+	check("Enabled1", PropertyManufacturer, 2)
+	check("Enabled2", PropertyManufacturer, 2)
+	check("Variable1", PropertyPermanent, 3)
+	check("Variable2", PropertyPermanent, 4)
+	tpm.InvalidateCapabilityCache()
+	check("Invalidated", PropertyManufacturer, 5)
+	check("Enabled3", PropertyManufacturer, 5)
+	tpm.SetCapabilityCaching(false)
+	check("Disabled2", PropertyManufacturer, 6)
+}
@@ -55,6 +55,7 @@ func (t *TPMContext) ContextSave(saveContext HandleContext) (context *Context, e
 
 	switch c := saveContext.(type) {
 	case *sessionContext:
+		delete(t.auditVerifiers, c.Data())
 		c.handleContext.Data.Session = nil
 		if t.exclusiveSession == c {
 			t.exclusiveSession = nil
@@ -97,7 +98,7 @@ func (t *TPMContext) ContextLoad(context *Context) (loadedContext HandleContext,
 
 	var contextData []byte
 	var blob ContextData
-	if _, err := mu.UnmarshalFromBytes(context.Blob, &contextData, &blob); err != nil {
+	if _, err := mu.UnmarshalFromBytesStrict(context.Blob, &contextData, &blob); err != nil {
 		return nil, xerrors.Errorf("cannot unmarshal context blob: %w", err)
 	}
 
@@ -134,12 +135,12 @@ func (t *TPMContext) ContextLoad(context *Context) (loadedContext HandleContext,
 	switch hc.Handle().Type() {
 	case HandleTypeTransient:
 		if loadedHandle.Type() != HandleTypeTransient {
-			return nil, &InvalidResponseError{CommandContextLoad, fmt.Sprintf("handle %v returned from TPM is the wrong type", loadedHandle)}
+			return nil, &InvalidResponseError{Command: CommandContextLoad, msg: fmt.Sprintf("handle %v returned from TPM is the wrong type", loadedHandle)}
 		}
 		hc.(*objectContext).H = loadedHandle
 	case HandleTypeHMACSession, HandleTypePolicySession:
 		if loadedHandle != context.SavedHandle {
-			return nil, &InvalidResponseError{CommandContextLoad, fmt.Sprintf("handle %v returned from TPM is incorrect", loadedHandle)}
+			return nil, &InvalidResponseError{Command: CommandContextLoad, msg: fmt.Sprintf("handle %v returned from TPM is incorrect", loadedHandle)}
 		}
 		hc.(*sessionContext).Data().IsExclusive = false
 	default:
@@ -165,6 +166,11 @@ func (t *TPMContext) FlushContext(flushContext HandleContext) error {
 		return err
 	}
 
+	if session, isSession := flushContext.(*sessionContext); isSession {
+		delete(t.desyncedSessions, session.Data())
+		delete(t.auditVerifiers, session.Data())
+	}
+	t.untrackTransientObject(flushContext)
 	flushContext.(handleContextPrivate).invalidate()
 	return nil
 }
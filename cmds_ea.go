@@ -169,13 +169,30 @@ func (t *TPMContext) PolicyPCR(policySession SessionContext, pcrDigest Digest, p
 		pcrDigest, pcrs)
 }
 
-// func (t *TPMContext) PolicyLocality(policySession HandleContext, locality Locality, sessions ...SessionContext) error {
-// }
+// PolicyLocality executes the TPM2_PolicyLocality command to indicate that an authorization policy should be limited to commands
+// executed at the specified localities. This is a deferred assertion. The locality argument is a TPMA_LOCALITY value: for
+// localities 0-4, it is a bitmask where bit n indicates that commands can be executed at locality n (eg, 1<<LocalityThree).
+// Values of 32 and above indicate a single extended locality. The locality that commands are executed at can be changed with
+// TPMContext.SetLocality.
+//
+// If locality is zero, a *TPMParameterError error with an error code of ErrorRange will be returned for parameter index 1. If the
+// policy session already contains a TPM2_PolicyLocality assertion and the localities don't intersect, a *TPMParameterError error
+// with an error code of ErrorRange will also be returned for parameter index 1.
+//
+// On successful completion, the policy digest of the session context associated with policySession is extended to record the value
+// of locality. If the session is subsequently used for authorization of a command executed at a locality that isn't permitted, a
+// *TPMWarning with a warning code of WarningLocality will be returned.
+func (t *TPMContext) PolicyLocality(policySession SessionContext, locality Locality, sessions ...SessionContext) error {
+	return t.RunCommand(CommandPolicyLocality, sessions,
+		policySession, Delimiter,
+		locality)
+}
 
 // PolicyNV executes the TPM2_PolicyNV command to gate a policy based on the contents of the NV index associated with nvIndex, and is
 // an immediate assertion. The caller specifies a value to be used for the comparison via the operandB argument, an offset from the
 // start of the NV index data from which to start the comparison via the offset argument, and a comparison operator via the operation
-// argument.
+// argument. Operand B is compared with the data at offset as a big-endian integer with the same size as operandB. UnsignedOperand,
+// SignedOperand, BitsetOperand and BitclearOperand can be used to construct these arguments.
 //
 // The command requires authorization to read the NV index, defined by the state of the AttrNVPPRead, AttrNVOwnerRead, AttrNVAuthRead
 // and AttrNVPolicyRead attributes. The handle used for authorization is specified via authContext. If the NV index has the
@@ -218,7 +235,8 @@ func (t *TPMContext) PolicyNV(authContext, nvIndex ResourceContext, policySessio
 // PolicyCounterTimer executes the TPM2_PolicyCounterTimer command to gate a policy based on the contents of the TimeInfo structure,
 // and is an immediate assertion. The caller specifies a value to be used for the comparison via the operandB argument, an offset from
 // the start of the TimeInfo structure from which to start the comparison via the offset argument, and a comparison operator via the
-// operation argument.
+// operation argument. The offsets of the fields of TimeInfo are defined by the TimeInfo*Offset constants, and UnsignedOperand can be
+// used to construct these arguments.
 //
 // If the comparison fails and policySession does not correspond to a trial session, a *TPMError error will be returned with an error
 // code of ErrorPolicy.
@@ -118,22 +118,23 @@ func (t *TPMContext) CreatePrimary(primaryObject ResourceContext, inSensitive *S
 	}
 
 	if objectHandle.Type() != HandleTypeTransient {
-		return nil, nil, nil, nil, nil, &InvalidResponseError{CommandCreatePrimary,
-			fmt.Sprintf("handle 0x%08x returned from TPM is the wrong type", objectHandle)}
+		return nil, nil, nil, nil, nil, &InvalidResponseError{Command: CommandCreatePrimary,
+			msg: fmt.Sprintf("handle 0x%08x returned from TPM is the wrong type", objectHandle)}
 	}
-	if outPublicSized.Ptr == nil || !outPublicSized.Ptr.compareName(name) {
-		return nil, nil, nil, nil, nil, &InvalidResponseError{CommandCreatePrimary,
-			"name and public area returned from TPM are not consistent"}
+	if outPublicSized.Ptr == nil || (!t.skipConsistencyChecks && !outPublicSized.Ptr.compareName(name)) {
+		return nil, nil, nil, nil, nil, &InvalidResponseError{Command: CommandCreatePrimary,
+			msg: "name and public area returned from TPM are not consistent"}
 	}
 
 	public, err := outPublicSized.Ptr.copy()
 	if err != nil {
-		return nil, nil, nil, nil, nil, &InvalidResponseError{CommandCreatePrimary,
-			fmt.Sprintf("cannot copy returned public area from TPM: %v", err)}
+		return nil, nil, nil, nil, nil, &InvalidResponseError{Command: CommandCreatePrimary,
+			msg: fmt.Sprintf("cannot copy returned public area from TPM: %v", err)}
 	}
 	rc := makeObjectContext(objectHandle, name, public)
 	rc.authValue = make([]byte, len(inSensitive.UserAuth))
 	copy(rc.authValue, inSensitive.UserAuth)
+	t.trackTransientObject(rc, t.hierarchyOf(primaryObject))
 
 	return rc, outPublicSized.Ptr, creationDataSized.Ptr, creationHash, creationTicket, nil
 }
@@ -161,10 +162,68 @@ func (t *TPMContext) CreatePrimary(primaryObject ResourceContext, inSensitive *S
 //
 // If state is true, then authContext must correspond to HandlePlatform. Note that the platform hierarchy can't be re-enabled by
 // this command.
+//
+// On successful completion, the TPMContext records the new state of the hierarchy, which can be queried with
+// TPMContext.IsHierarchyDisabled. If the hierarchy was disabled, ResourceContext instances for transient objects that were created
+// or loaded in it with this TPMContext are invalidated, and subsequent commands that fail because they reference the disabled
+// hierarchy will return a *HierarchyDisabledError that identifies it.
 func (t *TPMContext) HierarchyControl(authContext ResourceContext, enable Handle, state bool, authContextAuthSession SessionContext, sessions ...SessionContext) error {
-	return t.RunCommand(CommandHierarchyControl, sessions,
+	if err := t.RunCommand(CommandHierarchyControl, sessions,
 		ResourceContextWithSession{Context: authContext, Session: authContextAuthSession}, Delimiter,
-		enable, state)
+		enable, state); err != nil {
+		return err
+	}
+
+	t.setHierarchyEnabled(enable, state)
+	return nil
+}
+
+// ChangePPS executes the TPM2_ChangePPS command to replace the primary seed of the platform hierarchy with a new value from the
+// TPM's random number generator. The command requires knowledge of the authorization value for the platform hierarchy, and
+// authContext must correspond to HandlePlatform. The command requires authorization with the user auth role for authContext, with
+// session based authorization provided via authContextAuthSession. This is intended for use by the platform manufacturer during
+// manufacturing or re-provisioning.
+//
+// On successful completion, all objects in the platform hierarchy will have been flushed or evicted, and primary objects created
+// in it subsequently will be different to those created before. ResourceContext instances for transient objects that were created
+// or loaded in the platform hierarchy with this TPMContext are invalidated. Subsequent use of ResourceContext instances for
+// persistent objects in the platform hierarchy will fail. The authorization policy of the platform hierarchy will have been
+// cleared.
+func (t *TPMContext) ChangePPS(authContext ResourceContext, authContextAuthSession SessionContext, sessions ...SessionContext) error {
+	if err := t.RunCommand(CommandChangePPS, sessions,
+		ResourceContextWithSession{Context: authContext, Session: authContextAuthSession}); err != nil {
+		return err
+	}
+
+	t.invalidateTransientObjects(HandlePlatform)
+	return nil
+}
+
+// ChangeEPS executes the TPM2_ChangeEPS command to replace the primary seed of the endorsement hierarchy with a new value from
+// the TPM's random number generator. The command requires knowledge of the authorization value for the platform hierarchy, and
+// authContext must correspond to HandlePlatform. The command requires authorization with the user auth role for authContext, with
+// session based authorization provided via authContextAuthSession.
+//
+// Changing the endorsement primary seed changes the EK, which invalidates any certificate that has been issued for it. This is
+// intended for use by the platform manufacturer during manufacturing or re-provisioning.
+//
+// On successful completion, all objects in the endorsement hierarchy will have been flushed or evicted. ResourceContext instances
+// for transient objects that were created or loaded in the endorsement hierarchy with this TPMContext are invalidated. Subsequent
+// use of ResourceContext instances for persistent objects in the endorsement hierarchy will fail. The authorization value and
+// authorization policy of the endorsement hierarchy will have been cleared. It isn't necessary to update the ResourceContext for
+// the endorsement hierarchy by calling ResourceContext.SetAuthValue in order to use it in subsequent commands that require knowledge
+// of the authorization value.
+func (t *TPMContext) ChangeEPS(authContext ResourceContext, authContextAuthSession SessionContext, sessions ...SessionContext) error {
+	if err := t.RunCommand(CommandChangeEPS, sessions,
+		ResourceContextWithSession{Context: authContext, Session: authContextAuthSession}); err != nil {
+		return err
+	}
+
+	if rc, exists := t.permanentResources[HandleEndorsement]; exists {
+		rc.SetAuthValue(nil)
+	}
+	t.invalidateTransientObjects(HandleEndorsement)
+	return nil
 }
 
 // Clear executes the TPM2_Clear command to remove all context associated with the current owner. The command requires knowledge of
@@ -10,6 +10,8 @@ import (
 
 	. "github.com/canonical/go-tpm2"
 	"github.com/canonical/go-tpm2/testutil"
+
+	"golang.org/x/xerrors"
 )
 
 func TestCreatePrimary(t *testing.T) {
@@ -317,6 +319,141 @@ func TestHierarchyControl(t *testing.T) {
 	})
 }
 
+func TestHierarchyControlTracksState(t *testing.T) {
+	public := &Public{
+		Type:    ObjectTypeKeyedHash,
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   AttrUserWithAuth,
+		Params:  &PublicParamsU{KeyedHashDetail: &KeyedHashParams{Scheme: KeyedHashScheme{Scheme: KeyedHashSchemeNull}}},
+		Unique:  &PublicIDU{KeyedHash: make(Digest, 32)}}
+	name, _ := public.Name()
+	loadExternal := &testutil.MockCommand{CommandCode: CommandLoadExternal, Response: &testutil.MockResponse{Handle: 0x80000001, Params: []interface{}{name}}}
+
+	tcti := testutil.NewMockTCTI(
+		loadExternal,
+		loadExternal,
+		&testutil.MockCommand{CommandCode: CommandHierarchyControl, Handles: []Handle{HandleOwner}, Response: &testutil.MockResponse{PasswordSessions: 1}},
+		&testutil.MockCommand{CommandCode: CommandHierarchyChangeAuth, Handles: []Handle{HandleOwner}, Response: &testutil.MockResponse{ResponseCode: ResponseCode(0x185)}},
+		&testutil.MockCommand{CommandCode: CommandHierarchyControl, Handles: []Handle{HandlePlatform}, Response: &testutil.MockResponse{PasswordSessions: 1}})
+	tpm, _ := NewTPMContext(tcti)
+
+	ownerObject, err := tpm.LoadExternal(nil, public, HandleOwner)
+	if err != nil {
+		t.Fatalf("LoadExternal failed: %v", err)
+	}
+	nullObject, err := tpm.LoadExternal(nil, public, HandleNull)
+	if err != nil {
+		t.Fatalf("LoadExternal failed: %v", err)
+	}
+
+	if err := tpm.HierarchyControl(tpm.OwnerHandleContext(), HandleOwner, false, nil); err != nil {
+		t.Fatalf("HierarchyControl failed: %v", err)
+	}
+	if !tpm.IsHierarchyDisabled(HandleOwner) || tpm.IsHierarchyDisabled(HandleEndorsement) {
+		t.Errorf("Unexpected hierarchy state")
+	}
+	if ownerObject.Handle() != HandleUnassigned {
+		t.Errorf("Object in disabled hierarchy should have been invalidated")
+	}
+	if nullObject.Handle() != 0x80000001 {
+		t.Errorf("Object in null hierarchy should not have been invalidated")
+	}
+
+	err = tpm.HierarchyChangeAuth(tpm.OwnerHandleContext(), nil, nil)
+	var e *HierarchyDisabledError
+	if !xerrors.As(err, &e) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if e.Hierarchy != HandleOwner {
+		t.Errorf("Unexpected hierarchy: %v", e.Hierarchy)
+	}
+	if err.Error() != "the hierarchy associated with handle 0x40000001 (TPM_RH_OWNER) was disabled with TPM2_HierarchyControl "+
+		"whilst executing command TPM_CC_HierarchyChangeAuth" {
+		t.Errorf("Unexpected error string: %v", err)
+	}
+
+	if err := tpm.HierarchyControl(tpm.PlatformHandleContext(), HandleOwner, true, nil); err != nil {
+		t.Fatalf("HierarchyControl failed: %v", err)
+	}
+	if tpm.IsHierarchyDisabled(HandleOwner) {
+		t.Errorf("Unexpected hierarchy state")
+	}
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+}
+
+func TestChangeSeeds(t *testing.T) {
+	public := &Public{
+		Type:    ObjectTypeKeyedHash,
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   AttrUserWithAuth,
+		Params:  &PublicParamsU{KeyedHashDetail: &KeyedHashParams{Scheme: KeyedHashScheme{Scheme: KeyedHashSchemeNull}}},
+		Unique:  &PublicIDU{KeyedHash: make(Digest, 32)}}
+	name, _ := public.Name()
+	loadExternal := &testutil.MockCommand{CommandCode: CommandLoadExternal, Response: &testutil.MockResponse{Handle: 0x80000001, Params: []interface{}{name}}}
+
+	for _, data := range []struct {
+		desc      string
+		hierarchy Handle
+		command   CommandCode
+		fn        func(*TPMContext) error
+	}{
+		{
+			desc:      "EPS",
+			hierarchy: HandleEndorsement,
+			command:   CommandChangeEPS,
+			fn:        func(tpm *TPMContext) error { return tpm.ChangeEPS(tpm.PlatformHandleContext(), nil) },
+		},
+		{
+			desc:      "PPS",
+			hierarchy: HandlePlatform,
+			command:   CommandChangePPS,
+			fn:        func(tpm *TPMContext) error { return tpm.ChangePPS(tpm.PlatformHandleContext(), nil) },
+		},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			tcti := testutil.NewMockTCTI(
+				loadExternal,
+				loadExternal,
+				&testutil.MockCommand{CommandCode: data.command, Handles: []Handle{HandlePlatform}, Response: &testutil.MockResponse{PasswordSessions: 1}})
+			tpm, _ := NewTPMContext(tcti)
+			tpm.EndorsementHandleContext().SetAuthValue([]byte("foo"))
+
+			object, err := tpm.LoadExternal(nil, public, data.hierarchy)
+			if err != nil {
+				t.Fatalf("LoadExternal failed: %v", err)
+			}
+			ownerObject, err := tpm.LoadExternal(nil, public, HandleOwner)
+			if err != nil {
+				t.Fatalf("LoadExternal failed: %v", err)
+			}
+
+			if err := data.fn(tpm); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := tcti.Done(); err != nil {
+				t.Errorf("Unexpected commands: %v", err)
+			}
+
+			if object.Handle() != HandleUnassigned {
+				t.Errorf("Object in affected hierarchy should have been invalidated")
+			}
+			if ownerObject.Handle() != 0x80000001 {
+				t.Errorf("Object in storage hierarchy should not have been invalidated")
+			}
+
+			expectedAuth := []byte("foo")
+			if data.hierarchy == HandleEndorsement {
+				expectedAuth = nil
+			}
+			if auth := tpm.EndorsementHandleContext().(ResourceContextPrivate).GetAuthValue(); !bytes.Equal(auth, expectedAuth) {
+				t.Errorf("Unexpected endorsement auth value: %x", auth)
+			}
+		})
+	}
+}
+
 func TestClear(t *testing.T) {
 	tpm := openTPMForTesting(t, testutil.TPMFeatureOwnerPersist|testutil.TPMFeatureChangeEndorsementAuth|testutil.TPMFeatureChangeLockoutAuth|testutil.TPMFeatureChangePlatformAuth|testutil.TPMFeatureClear)
 	defer closeTPM(t, tpm)
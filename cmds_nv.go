@@ -10,6 +10,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/canonical/go-tpm2/mu"
 )
@@ -232,7 +233,8 @@ func (t *TPMContext) NVWriteRaw(authContext, nvIndex ResourceContext, data MaxNV
 //
 // If data is too large to be written in a single command, this function will re-execute the TPM2_NV_Write command until all data is
 // written. In this case, any SessionContext instances provided must have the AttrContinueSession attribute defined and
-// authContextAuthSession must not be a policy session.
+// authContextAuthSession must not be a policy session. If no sessions are supplied and the transmission interface implements
+// PipelinedTCTI, each command after the first is written before the response to the previous one has been read.
 //
 // If the index has the AttrNVWriteLocked attribute set, a *TPMError error with an error code of ErrorNVLocked will be returned.
 //
@@ -253,7 +255,7 @@ func (t *TPMContext) NVWrite(authContext, nvIndex ResourceContext, data []byte,
 	}
 
 	if len(data) > t.maxNVBufferSize {
-		if authContextAuthSession != nil {
+		if authContextAuthSession != nil && !isPasswordSession(authContextAuthSession) {
 			sessionPrivate := authContextAuthSession.(*sessionContext)
 			if sessionPrivate.attrs&AttrContinueSession == 0 {
 				return makeInvalidArgError("authContextAuthSession",
@@ -277,6 +279,33 @@ func (t *TPMContext) NVWrite(authContext, nvIndex ResourceContext, data []byte,
 	}
 
 	total := 0
+	if len(data) > t.maxNVBufferSize && t.canPipeline(authContextAuthSession, sessions) {
+		var cmds []pipelinedCommand
+		for off := 0; off < len(data); off += t.maxNVBufferSize {
+			end := off + t.maxNVBufferSize
+			if end > len(data) {
+				end = len(data)
+			}
+			cmds = append(cmds, pipelinedCommand{
+				commandCode: CommandNVWrite,
+				params: []interface{}{
+					ResourceContextWithSession{Context: authContext}, nvIndex, Delimiter,
+					MaxNVBuffer(data[off:end]), offset + uint16(off)}})
+		}
+		n, err := t.runPipelined(cmds)
+		if n > 0 {
+			nvIndex.(*nvIndexContext).SetAttr(AttrNVWritten)
+		}
+		if err != nil {
+			return err
+		}
+		// Any chunks that weren't written by the pipeline are written below.
+		total = n * t.maxNVBufferSize
+		if total >= len(data) {
+			return nil
+		}
+	}
+
 	for {
 		d := data[total:]
 		if len(d) > t.maxNVBufferSize {
@@ -329,6 +358,41 @@ func (t *TPMContext) NVSetPinCounterParams(authContext, nvIndex ResourceContext,
 	return t.NVWrite(authContext, nvIndex, data, 0, authContextAuthSession, sessions...)
 }
 
+// defaultNVWriteRecovery is the time that WithNVRateBackoff waits between attempts if the TPM does not indicate a recovery time.
+const defaultNVWriteRecovery = 100 * time.Millisecond
+
+// WithNVRateBackoff executes the supplied function, which would normally perform one or more commands that modify NV memory such as
+// TPMContext.NVWrite or TPMContext.NVIncrement. If it returns a *TPMWarning with a warning code of WarningNVRate because the TPM is
+// rate limiting NV writes, this function waits for the period indicated by the PropertyNVWriteRecovery property and then executes
+// the supplied function again. This is repeated until the function succeeds, returns another error, or the specified timeout
+// elapses, in which case the last error is returned.
+//
+// As the supplied function may be executed more than once, any SessionContext instances used within it should have the
+// AttrContinueSession attribute defined.
+func (t *TPMContext) WithNVRateBackoff(timeout time.Duration, fn func() error) error {
+	deadline := t.now().Add(timeout)
+	var recovery time.Duration
+
+	for {
+		err := fn()
+		if !IsTPMWarning(err, WarningNVRate, AnyCommandCode) {
+			return err
+		}
+
+		if recovery == 0 {
+			recovery, _ = t.GetNVWriteRecovery()
+			if recovery == 0 {
+				recovery = defaultNVWriteRecovery
+			}
+		}
+
+		if !t.now().Add(recovery).Before(deadline) {
+			return err
+		}
+		t.wait(recovery)
+	}
+}
+
 // NVIncrement executes the TPM2_NV_Increment command to increment the counter associated with nvIndex.
 //
 // The command requires authorization, defined by the state of the AttrNVPPWrite, AttrNVOwnerWrite, AttrNVAuthWrite and
@@ -531,7 +595,8 @@ func (t *TPMContext) NVReadRaw(authContext, nvIndex ResourceContext, size, offse
 //
 // If the requested data can not be read in a single command, this function will re-execute the TPM2_NV_Read command until all data
 // is read. In this case, any SessionContext instances provided should have the AttrContinueSession attribute defined and
-// authContextAuth should not correspond to a policy session.
+// authContextAuth should not correspond to a policy session. If no sessions are supplied and the transmission interface implements
+// PipelinedTCTI, each command after the first is written before the response to the previous one has been read.
 //
 // If the index has the AttrNVReadLocked attribute set, a *TPMError error with an error code of ErrorNVLocked will be returned.
 //
@@ -557,6 +622,41 @@ func (t *TPMContext) NVRead(authContext, nvIndex ResourceContext, size, offset u
 	total := 0
 	remaining := size
 
+	if int(size) > t.maxNVBufferSize && t.canPipeline(authContextAuthSession, sessions) {
+		var cmds []pipelinedCommand
+		chunks := make([]MaxNVBuffer, (int(size)+t.maxNVBufferSize-1)/t.maxNVBufferSize)
+		for off := 0; off < int(size); off += t.maxNVBufferSize {
+			sz := int(size) - off
+			if sz > t.maxNVBufferSize {
+				sz = t.maxNVBufferSize
+			}
+			cmds = append(cmds, pipelinedCommand{
+				commandCode: CommandNVRead,
+				params: []interface{}{
+					ResourceContextWithSession{Context: authContext}, nvIndex, Delimiter,
+					uint16(sz), offset + uint16(off), Delimiter,
+					Delimiter,
+					&chunks[len(cmds)]}})
+		}
+		n, err := t.runPipelined(cmds)
+		if err != nil {
+			return nil, err
+		}
+		for _, chunk := range chunks[:n] {
+			sz := remaining
+			if remaining > uint16(t.maxNVBufferSize) {
+				sz = uint16(t.maxNVBufferSize)
+			}
+			copy(data[total:], chunk)
+			total += int(sz)
+			remaining -= sz
+		}
+		// Any chunks that weren't read by the pipeline are read below.
+		if remaining == 0 {
+			return data, nil
+		}
+	}
+
 	for {
 		sz := remaining
 		if remaining > uint16(t.maxNVBufferSize) {
@@ -614,7 +714,7 @@ func (t *TPMContext) NVReadCounter(authContext, nvIndex ResourceContext, authCon
 		return 0, err
 	}
 	if len(data) != binary.Size(uint64(0)) {
-		return 0, &InvalidResponseError{CommandNVRead, fmt.Sprintf("unexpected number of bytes returned (got %d)", len(data))}
+		return 0, &InvalidResponseError{Command: CommandNVRead, msg: fmt.Sprintf("unexpected number of bytes returned (got %d)", len(data))}
 	}
 	return binary.BigEndian.Uint64(data), nil
 }
@@ -654,8 +754,8 @@ func (t *TPMContext) NVReadPinCounterParams(authContext, nvIndex ResourceContext
 		return nil, err
 	}
 	var res NVPinCounterParams
-	if _, err := mu.UnmarshalFromBytes(data, &res); err != nil {
-		return nil, &InvalidResponseError{CommandNVRead, fmt.Sprintf("cannot unmarshal response bytes: %v", err)}
+	if _, err := mu.UnmarshalFromBytesStrict(data, &res); err != nil {
+		return nil, &InvalidResponseError{Command: CommandNVRead, msg: fmt.Sprintf("cannot unmarshal response bytes: %v", err)}
 	}
 	return &res, nil
 }
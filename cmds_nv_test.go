@@ -10,6 +10,7 @@ import (
 	"crypto/sha256"
 	"encoding/binary"
 	"testing"
+	"time"
 
 	. "github.com/canonical/go-tpm2"
 	"github.com/canonical/go-tpm2/testutil"
@@ -965,3 +966,165 @@ func TestNVChangeAuth(t *testing.T) {
 		})
 	}
 }
+
+func TestNVReadAndWritePipelined(t *testing.T) {
+	data := make([]byte, 40)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	nvWrite := func(rsp *testutil.MockResponse) *testutil.MockCommand {
+		return &testutil.MockCommand{CommandCode: CommandNVWrite, Handles: []Handle{0x01800000, 0x01800000}, Response: rsp}
+	}
+	nvRead := func(data MaxNVBuffer) *testutil.MockCommand {
+		return &testutil.MockCommand{CommandCode: CommandNVRead, Handles: []Handle{0x01800000, 0x01800000},
+			Response: &testutil.MockResponse{Params: []interface{}{data}, PasswordSessions: 1}}
+	}
+	tcti := testutil.NewMockTCTI(
+		mockTPMPropertiesCommand(
+			TaggedProperty{Property: PropertyMaxDigest, Value: 32},
+			TaggedProperty{Property: PropertyNVBufferMax, Value: 16}),
+		nvWrite(&testutil.MockResponse{PasswordSessions: 1}),
+		nvWrite(&testutil.MockResponse{ResponseCode: ResponseCode(0x922)}), // TPM_RC_RETRY
+		nvWrite(&testutil.MockResponse{PasswordSessions: 1}),
+		// The last 2 chunks are written again without pipelining.
+		nvWrite(&testutil.MockResponse{PasswordSessions: 1}),
+		nvWrite(&testutil.MockResponse{PasswordSessions: 1}),
+		nvRead(data[0:16]),
+		nvRead(data[16:32]),
+		nvRead(data[32:40]))
+	tcti.EnablePipelining()
+	tpm, _ := NewTPMContext(tcti)
+
+	index, err := CreateNVIndexResourceContextFromPublic(&NVPublic{
+		Index:   0x01800000,
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead),
+		Size:    40})
+	if err != nil {
+		t.Fatalf("CreateNVIndexResourceContextFromPublic failed: %v", err)
+	}
+
+	if err := tpm.NVWrite(index, index, data, 0, nil); err != nil {
+		t.Fatalf("NVWrite failed: %v", err)
+	}
+	if index.(*NvIndexContext).Attrs()&AttrNVWritten == 0 {
+		t.Errorf("AttrNVWritten wasn't set")
+	}
+	commands := tcti.Commands()
+	if len(commands) != 6 {
+		t.Fatalf("Unexpected number of commands: %d", len(commands))
+	}
+	if !bytes.Equal(commands[2], commands[4]) || !bytes.Equal(commands[3], commands[5]) {
+		t.Errorf("Unexpected commands after failure")
+	}
+
+	read, err := tpm.NVRead(index, index, 40, 0, nil)
+	if err != nil {
+		t.Fatalf("NVRead failed: %v", err)
+	}
+	if !bytes.Equal(read, data) {
+		t.Errorf("Unexpected data: %x", read)
+	}
+
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+	if tcti.MaxOutstanding() != 2 {
+		t.Errorf("Commands weren't pipelined (max outstanding: %d)", tcti.MaxOutstanding())
+	}
+}
+
+func TestNVWritePipelinedAuthFailure(t *testing.T) {
+	index, err := CreateNVIndexResourceContextFromPublic(&NVPublic{
+		Index:   0x01800000,
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead),
+		Size:    48})
+	if err != nil {
+		t.Fatalf("CreateNVIndexResourceContextFromPublic failed: %v", err)
+	}
+
+	nvWrite := func(rsp *testutil.MockResponse) *testutil.MockCommand {
+		return &testutil.MockCommand{CommandCode: CommandNVWrite, Handles: []Handle{0x01800000, 0x01800000}, Response: rsp}
+	}
+	tcti := testutil.NewMockTCTI(
+		mockTPMPropertiesCommand(
+			TaggedProperty{Property: PropertyMaxDigest, Value: 32},
+			TaggedProperty{Property: PropertyNVBufferMax, Value: 16}),
+		nvWrite(&testutil.MockResponse{ResponseCode: ResponseCode(0x98e)})) // TPM_RC_AUTH_FAIL + TPM_RC_S + TPM_RC_1
+	tcti.EnablePipelining()
+	tpm, _ := NewTPMContext(tcti)
+
+	// The first chunk fails authorization, so nothing else should be sent.
+	if err := tpm.NVWrite(index, index, make([]byte, 48), 0, nil); !IsTPMSessionError(err, ErrorAuthFail, CommandNVWrite, 1) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+	if tcti.MaxOutstanding() != 1 {
+		t.Errorf("Commands were pipelined before the first one succeeded")
+	}
+
+	// A non-retryable error after pipelining has started is returned without resubmitting anything.
+	tcti.Expect(
+		nvWrite(&testutil.MockResponse{PasswordSessions: 1}),
+		nvWrite(&testutil.MockResponse{ResponseCode: ResponseCode(0x146)}), // TPM_RC_NV_RANGE
+		nvWrite(&testutil.MockResponse{PasswordSessions: 1}))
+	if err := tpm.NVWrite(index, index, make([]byte, 48), 0, nil); !IsTPMError(err, ErrorNVRange, CommandNVWrite) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+}
+
+func TestWithNVRateBackoff(t *testing.T) {
+	nvRate := &testutil.MockCommand{CommandCode: CommandSelfTest, Response: &testutil.MockResponse{ResponseCode: ResponseCode(0x920)}}
+	success := &testutil.MockCommand{CommandCode: CommandSelfTest, Response: &testutil.MockResponse{}}
+	recovery := mockTPMPropertiesCommand(TaggedProperty{Property: PropertyNVWriteRecovery, Value: 500})
+
+	for _, data := range []struct {
+		desc     string
+		timeout  time.Duration
+		commands []*testutil.MockCommand
+		calls    int
+		slept    time.Duration
+		err      WarningCode
+	}{
+		{desc: "NoRateLimit", timeout: time.Minute, commands: []*testutil.MockCommand{success}, calls: 1},
+		{desc: "RateLimited", timeout: time.Minute, commands: []*testutil.MockCommand{nvRate, recovery, nvRate, success}, calls: 3, slept: time.Second},
+		{desc: "Timeout", timeout: 100 * time.Millisecond, commands: []*testutil.MockCommand{nvRate, recovery}, calls: 1, err: WarningNVRate},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			var slept time.Duration
+			restore := MockSleep(func(d time.Duration) { slept += d })
+			defer restore()
+
+			tcti := testutil.NewMockTCTI(data.commands...)
+			tpm, _ := NewTPMContext(tcti)
+
+			calls := 0
+			err := tpm.WithNVRateBackoff(data.timeout, func() error {
+				calls++
+				return tpm.SelfTest(false)
+			})
+			if data.err == 0 && err != nil {
+				t.Errorf("WithNVRateBackoff failed: %v", err)
+			}
+			if data.err != 0 && !IsTPMWarning(err, data.err, CommandSelfTest) {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if calls != data.calls {
+				t.Errorf("Unexpected number of calls: %d", calls)
+			}
+			if slept != data.slept {
+				t.Errorf("Unexpected delay: %v", slept)
+			}
+			if err := tcti.Done(); err != nil {
+				t.Errorf("Unexpected commands: %v", err)
+			}
+		})
+	}
+}
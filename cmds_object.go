@@ -203,14 +203,16 @@ func (t *TPMContext) Load(parentContext ResourceContext, inPrivate Private, inPu
 	}
 
 	if objectHandle.Type() != HandleTypeTransient {
-		return nil, &InvalidResponseError{CommandLoad, fmt.Sprintf("handle 0x%08x returned from TPM is the wrong type", objectHandle)}
+		return nil, &InvalidResponseError{Command: CommandLoad, msg: fmt.Sprintf("handle 0x%08x returned from TPM is the wrong type", objectHandle)}
 	}
-	if inPublic == nil || !inPublic.compareName(name) {
-		return nil, &InvalidResponseError{CommandLoad, "name returned from TPM not consistent with loaded public area"}
+	if inPublic == nil || (!t.skipConsistencyChecks && !inPublic.compareName(name)) {
+		return nil, &InvalidResponseError{Command: CommandLoad, msg: "name returned from TPM not consistent with loaded public area"}
 	}
 
 	public, _ := inPublic.copy() // inPublic already marshalled successfully, so ignore errors here
-	return makeObjectContext(objectHandle, name, public), nil
+	rc := makeObjectContext(objectHandle, name, public)
+	t.trackTransientObject(rc, t.hierarchyOf(parentContext))
+	return rc, nil
 }
 
 // LoadExternal executes the TPM2_LoadExternal command in order to load an object that is not a protected object in to the TPM.
@@ -287,15 +289,16 @@ func (t *TPMContext) LoadExternal(inPrivate *Sensitive, inPublic *Public, hierar
 	}
 
 	if objectHandle.Type() != HandleTypeTransient {
-		return nil, &InvalidResponseError{CommandLoadExternal,
-			fmt.Sprintf("handle 0x%08x returned from TPM is the wrong type", objectHandle)}
+		return nil, &InvalidResponseError{Command: CommandLoadExternal,
+			msg: fmt.Sprintf("handle 0x%08x returned from TPM is the wrong type", objectHandle)}
 	}
-	if inPublic == nil || !inPublic.compareName(name) {
-		return nil, &InvalidResponseError{CommandLoadExternal, "name returned from TPM not consistent with loaded public area"}
+	if inPublic == nil || (!t.skipConsistencyChecks && !inPublic.compareName(name)) {
+		return nil, &InvalidResponseError{Command: CommandLoadExternal, msg: "name returned from TPM not consistent with loaded public area"}
 	}
 
 	public, _ := inPublic.copy() // inPublic already marshalled successfully, so ignore errors here
 	rc := makeObjectContext(objectHandle, name, public)
+	t.trackTransientObject(rc, hierarchy)
 	if inPrivate != nil {
 		rc.authValue = make([]byte, len(inPrivate.AuthValue))
 		copy(rc.authValue, inPrivate.AuthValue)
@@ -587,20 +590,21 @@ func (t *TPMContext) CreateLoaded(parentContext ResourceContext, inSensitive *Se
 	}
 
 	if objectHandle.Type() != HandleTypeTransient {
-		return nil, nil, nil, &InvalidResponseError{CommandCreateLoaded,
-			fmt.Sprintf("handle 0x%08x returned from TPM is the wrong type", objectHandle)}
+		return nil, nil, nil, &InvalidResponseError{Command: CommandCreateLoaded,
+			msg: fmt.Sprintf("handle 0x%08x returned from TPM is the wrong type", objectHandle)}
 	}
-	if outPublicSized.Ptr == nil || !outPublicSized.Ptr.compareName(name) {
-		return nil, nil, nil, &InvalidResponseError{CommandCreateLoaded, "name and public area returned from TPM are not consistent"}
+	if outPublicSized.Ptr == nil || (!t.skipConsistencyChecks && !outPublicSized.Ptr.compareName(name)) {
+		return nil, nil, nil, &InvalidResponseError{Command: CommandCreateLoaded, msg: "name and public area returned from TPM are not consistent"}
 	}
 
 	public, err := outPublicSized.Ptr.copy()
 	if err != nil {
-		return nil, nil, nil, &InvalidResponseError{CommandCreateLoaded, fmt.Sprintf("cannot copy returned public area from TPM: %v", err)}
+		return nil, nil, nil, &InvalidResponseError{Command: CommandCreateLoaded, msg: fmt.Sprintf("cannot copy returned public area from TPM: %v", err)}
 	}
 	rc := makeObjectContext(objectHandle, name, public)
 	rc.authValue = make([]byte, len(inSensitive.UserAuth))
 	copy(rc.authValue, inSensitive.UserAuth)
+	t.trackTransientObject(rc, t.hierarchyOf(parentContext))
 
 	return rc, outPrivate, outPublicSized.Ptr, nil
 }
@@ -7,8 +7,15 @@ package tpm2
 // Section 22 - Integrity Collection (PCR)
 
 import (
+	"encoding/binary"
 	"errors"
+	"io"
+	"math"
 	"sort"
+
+	"github.com/canonical/go-tpm2/mu"
+
+	"golang.org/x/xerrors"
 )
 
 // PCRValues contains a collection of PCR values, keyed by HashAlgorithmId and PCR index.
@@ -123,6 +130,98 @@ func (t *TPMContext) PCREvent(pcrContext ResourceContext, eventData Event, pcrCo
 	return digests, nil
 }
 
+// pcrReadResponse is a custom unmarshaller for the pcrSelectionOut and pcrValues response parameters of TPM2_PCR_Read. It retains
+// the storage for the returned selection between commands, and copies digests directly in to dst, reusing existing digest buffers
+// where possible.
+type pcrReadResponse struct {
+	selection PCRSelectionList
+	dst       PCRValues
+	n         int // The number of digests in the last response
+}
+
+func (r pcrReadResponse) Marshal(w io.Writer) error {
+	panic("no need to marshal TPM2_PCR_Read response parameters")
+}
+
+func (r *pcrReadResponse) Unmarshal(rd mu.Reader) error {
+	var scratch [4]byte
+	if _, err := io.ReadFull(rd, scratch[:]); err != nil {
+		return xerrors.Errorf("cannot read length of selection list: %w", err)
+	}
+	n := binary.BigEndian.Uint32(scratch[:])
+	// Each element is at least 3 bytes long.
+	if int64(n)*3 > int64(rd.Len()) {
+		return errors.New("selection list length is larger than the remaining bytes")
+	}
+	if uint32(cap(r.selection)) >= n {
+		r.selection = r.selection[:n]
+	} else {
+		r.selection = make(PCRSelectionList, n)
+	}
+
+	for i := range r.selection {
+		if _, err := io.ReadFull(rd, scratch[:3]); err != nil {
+			return xerrors.Errorf("cannot read selection %d: %w", i, err)
+		}
+		r.selection[i].Hash = HashAlgorithmId(binary.BigEndian.Uint16(scratch[:]))
+		var mask [math.MaxUint8]byte
+		if _, err := io.ReadFull(rd, mask[:scratch[2]]); err != nil {
+			return xerrors.Errorf("cannot read PCR selection bit mask for selection %d: %w", i, err)
+		}
+		r.selection[i].Select = r.selection[i].Select[:0]
+		for j, octet := range mask[:scratch[2]] {
+			for bit := uint(0); bit < 8; bit++ {
+				if octet&(1<<bit) != 0 {
+					r.selection[i].Select = append(r.selection[i].Select, int((uint(j)*8)+bit))
+				}
+			}
+		}
+	}
+
+	if _, err := io.ReadFull(rd, scratch[:]); err != nil {
+		return xerrors.Errorf("cannot read length of digest list: %w", err)
+	}
+	r.n = int(binary.BigEndian.Uint32(scratch[:]))
+
+	i := 0
+	for _, s := range r.selection {
+		if !s.Hash.Supported() {
+			return errors.New("unsupported digest algorithm")
+		}
+		if _, ok := r.dst[s.Hash]; !ok {
+			r.dst[s.Hash] = make(map[int]Digest)
+		}
+		for _, pcr := range s.Select {
+			if i >= r.n {
+				return errors.New("insufficient digests")
+			}
+			i++
+			if _, err := io.ReadFull(rd, scratch[:2]); err != nil {
+				return xerrors.Errorf("cannot read size of digest: %w", err)
+			}
+			size := int(binary.BigEndian.Uint16(scratch[:]))
+			if size != s.Hash.Size() {
+				return errors.New("incorrect digest size")
+			}
+			d := r.dst[s.Hash][pcr]
+			if cap(d) >= size {
+				d = d[:size]
+			} else {
+				d = make(Digest, size)
+			}
+			if _, err := io.ReadFull(rd, d); err != nil {
+				return xerrors.Errorf("cannot read digest: %w", err)
+			}
+			r.dst[s.Hash][pcr] = d
+		}
+	}
+	if i != r.n {
+		return errors.New("too many digests")
+	}
+
+	return nil
+}
+
 // PCRRead executes the TPM2_PCR_Read command to return the values of the PCRs defined in the pcrSelectionIn parameter. The
 // underlying command may not be able to read all of the specified PCRs in a single transaction, so this function will
 // re-execute the TPM2_PCR_Read command until all requested values have been read. As a consequence, any SessionContext instances
@@ -130,49 +229,85 @@ func (t *TPMContext) PCREvent(pcrContext ResourceContext, eventData Event, pcrCo
 //
 // On success, the current value of pcrUpdateCounter is returned, as well as the requested PCR values.
 func (t *TPMContext) PCRRead(pcrSelectionIn PCRSelectionList, sessions ...SessionContext) (pcrUpdateCounter uint32, pcrValues PCRValues, err error) {
-	var remaining PCRSelectionList
-	for _, s := range pcrSelectionIn {
-		c := PCRSelection{Hash: s.Hash, Select: make([]int, len(s.Select))}
-		copy(c.Select, s.Select)
-		remaining = append(remaining, c)
+	pcrValues = make(PCRValues)
+	pcrUpdateCounter, err = t.PCRReadInto(pcrSelectionIn, pcrValues, sessions...)
+	if err != nil {
+		return 0, nil, err
 	}
+	return pcrUpdateCounter, pcrValues, nil
+}
 
-	pcrValues = make(PCRValues)
+// PCRReadInto behaves like TPMContext.PCRRead, but reads the PCR values in to dst, which must not be nil. It is intended for callers
+// that read the same PCRs repeatedly, such as monitoring agents. If dst already contains a digest for a selected PCR, its storage is
+// reused for the new value, so callers must copy any values that they need to retain before calling this again with the same dst.
+// Values in dst for PCRs that aren't selected are left unmodified. If an error occurs, dst may have been partially updated.
+//
+// On success, the current value of pcrUpdateCounter is returned.
+func (t *TPMContext) PCRReadInto(pcrSelectionIn PCRSelectionList, dst PCRValues, sessions ...SessionContext) (pcrUpdateCounter uint32, err error) {
+	if dst == nil {
+		return 0, makeInvalidArgError("dst", "nil value")
+	}
+
+	rsp := &t.pcrReadResponse
+	rsp.dst = dst
+	defer func() { rsp.dst = nil }()
+
+	remaining := pcrSelectionIn
 
 	for i := 0; ; i++ {
 		var updateCounter uint32
-		var pcrSelectionOut PCRSelectionList
-		var values DigestList
 
 		if err := t.RunCommand(CommandPCRRead, sessions,
 			Delimiter,
 			remaining, Delimiter,
 			Delimiter,
-			&updateCounter, &pcrSelectionOut, &values); err != nil {
-			return 0, nil, err
+			&updateCounter, rsp); err != nil {
+			return 0, err
 		}
 
 		if i == 0 {
 			pcrUpdateCounter = updateCounter
 		} else if updateCounter != pcrUpdateCounter {
-			return 0, nil, &InvalidResponseError{CommandPCRRead, "PCR update counter changed between commands"}
-		} else if len(values) == 0 && pcrSelectionOut.IsEmpty() {
-			return 0, nil, makeInvalidArgError("pcrSelectionIn", "unimplemented PCRs specified")
-		}
-
-		if n, err := pcrValues.SetValuesFromListAndSelection(pcrSelectionOut, values); err != nil {
-			return 0, nil, &InvalidResponseError{CommandPCRRead, err.Error()}
-		} else if n != len(values) {
-			return 0, nil, &InvalidResponseError{CommandPCRRead, "too many digests"}
+			return 0, &InvalidResponseError{Command: CommandPCRRead, msg: "PCR update counter changed between commands"}
+		} else if rsp.n == 0 && rsp.selection.IsEmpty() {
+			return 0, makeInvalidArgError("pcrSelectionIn", "unimplemented PCRs specified")
 		}
 
-		remaining = remaining.Remove(pcrSelectionOut)
+		remaining = remaining.Remove(rsp.selection)
 		if remaining.IsEmpty() {
 			break
 		}
 	}
 
-	return pcrUpdateCounter, pcrValues, nil
+	return pcrUpdateCounter, nil
+}
+
+// PCRAllocate executes the TPM2_PCR_Allocate command to set the desired PCR allocation, which takes effect after the next
+// _TPM_Init. The command requires authorization with the user auth role for authContext, which must correspond to HandlePlatform,
+// with session based authorization provided via authContextAuthSession.
+//
+// The pcrAllocation argument contains a selection for each bank to be changed. Banks that are omitted retain their current
+// allocation, and a bank can be deallocated by supplying an empty selection for it.
+//
+// If the TPM is able to accept the new allocation, allocationSuccess will be true. The maxPCR return value indicates the maximum
+// number of PCRs that can be allocated in any bank. The sizeNeeded and sizeAvailable return values indicate the amount of memory
+// required for the requested allocation and the amount available to the TPM for PCRs.
+//
+// If the specified allocation contains a digest algorithm that is not implemented, a *TPMParameterError error with an error code
+// of ErrorHash will be returned for parameter index 1. If pcrAllocation deallocates every PCR that is required by the platform
+// specification, a *TPMParameterError error with an error code of ErrorPCR will be returned for parameter index 1.
+//
+// Once a new allocation has been accepted, the TPM must be shut down with TPMContext.Shutdown using StartupClear before being
+// reset, as a subsequent call with StartupState will fail. Use TPMContext.ReconfigurePCRBanks to perform the entire procedure.
+func (t *TPMContext) PCRAllocate(authContext ResourceContext, pcrAllocation PCRSelectionList, authContextAuthSession SessionContext, sessions ...SessionContext) (allocationSuccess bool, maxPCR, sizeNeeded, sizeAvailable uint32, err error) {
+	if err := t.RunCommand(CommandPCRAllocate, sessions,
+		ResourceContextWithSession{Context: authContext, Session: authContextAuthSession}, Delimiter,
+		pcrAllocation, Delimiter,
+		Delimiter,
+		&allocationSuccess, &maxPCR, &sizeNeeded, &sizeAvailable); err != nil {
+		return false, 0, 0, 0, err
+	}
+	return allocationSuccess, maxPCR, sizeNeeded, sizeAvailable, nil
 }
 
 // PCRReset executes the TPM2_PCR_Reset command to reset the PCR associated with pcrContext in all banks. This command requires
@@ -10,6 +10,8 @@ import (
 
 	. "github.com/canonical/go-tpm2"
 	"github.com/canonical/go-tpm2/testutil"
+
+	"golang.org/x/xerrors"
 )
 
 func TestPCRExtend(t *testing.T) {
@@ -333,6 +335,60 @@ func TestPCRRead(t *testing.T) {
 	})
 }
 
+func TestPCRReadInto(t *testing.T) {
+	pcrRead := func(counter uint32, selection PCRSelectionList, digests DigestList) *testutil.MockCommand {
+		return &testutil.MockCommand{CommandCode: CommandPCRRead, Response: &testutil.MockResponse{Params: []interface{}{counter, selection, digests}}}
+	}
+
+	selection := PCRSelectionList{{Hash: HashAlgorithmSHA256, Select: []int{0, 7}}}
+	d1 := bytes.Repeat([]byte{0x01}, 32)
+	d2 := bytes.Repeat([]byte{0x02}, 32)
+	d3 := bytes.Repeat([]byte{0x03}, 32)
+
+	tcti := testutil.NewMockTCTI(
+		pcrRead(10, selection, DigestList{d1, d2}),
+		pcrRead(11, selection, DigestList{d3, d1}),
+		pcrRead(12, selection, DigestList{d1}))
+	tpm, _ := NewTPMContext(tcti)
+
+	dst := make(PCRValues)
+	dst.SetValue(HashAlgorithmSHA1, 0, make(Digest, 20))
+
+	counter, err := tpm.PCRReadInto(selection, dst)
+	if err != nil {
+		t.Fatalf("PCRReadInto failed: %v", err)
+	}
+	if counter != 10 {
+		t.Errorf("Unexpected counter: %d", counter)
+	}
+	if !bytes.Equal(dst[HashAlgorithmSHA256][0], d1) || !bytes.Equal(dst[HashAlgorithmSHA256][7], d2) {
+		t.Errorf("Unexpected values: %v", dst)
+	}
+	if len(dst[HashAlgorithmSHA1]) != 1 {
+		t.Errorf("Unselected values were modified")
+	}
+
+	buf := dst[HashAlgorithmSHA256][0]
+	counter, err = tpm.PCRReadInto(selection, dst)
+	if err != nil {
+		t.Fatalf("PCRReadInto failed: %v", err)
+	}
+	if counter != 11 {
+		t.Errorf("Unexpected counter: %d", counter)
+	}
+	if !bytes.Equal(dst[HashAlgorithmSHA256][0], d3) || !bytes.Equal(dst[HashAlgorithmSHA256][7], d1) {
+		t.Errorf("Unexpected values: %v", dst)
+	}
+	if &buf[0] != &dst[HashAlgorithmSHA256][0][0] {
+		t.Errorf("Digest buffer wasn't reused")
+	}
+
+	var e *InvalidResponseError
+	if _, err := tpm.PCRReadInto(selection, dst); !xerrors.As(err, &e) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
 func TestPCRReset(t *testing.T) {
 	tpm := openTPMForTesting(t, testutil.TPMFeaturePCR)
 	defer closeTPM(t, tpm)
@@ -4,11 +4,16 @@
 
 package tpm2
 
+import (
+	"fmt"
+)
+
 // Section 16 - Random Number Generator
 
 // GetRandom executes the TPM2_GetRandom command to return the next bytesRequested number of bytes from the TPM's
 // random number generator. If the requested bytes cannot be read in a single command, this function will reexecute
-// the TPM2_GetRandom command until all requested bytes have been read.
+// the TPM2_GetRandom command until all requested bytes have been read. The number of bytes requested by each command is limited to
+// the value of the PropertyMaxDigest property, and the TPM is permitted to return fewer bytes than requested.
 func (t *TPMContext) GetRandom(bytesRequested uint16, sessions ...SessionContext) (randomBytes []byte, err error) {
 	if err := t.initPropertiesIfNeeded(); err != nil {
 		return nil, err
@@ -34,9 +39,14 @@ func (t *TPMContext) GetRandom(bytesRequested uint16, sessions ...SessionContext
 			return nil, err
 		}
 
+		if len(tmpBytes) == 0 || len(tmpBytes) > int(sz) {
+			return nil, &InvalidResponseError{Command: CommandGetRandom,
+				msg: fmt.Sprintf("unexpected number of random bytes (got %d, requested %d)", len(tmpBytes), sz)}
+		}
+
 		copy(randomBytes[total:], tmpBytes)
-		total += int(sz)
-		remaining -= sz
+		total += len(tmpBytes)
+		remaining -= uint16(len(tmpBytes))
 
 		if remaining == 0 {
 			break
@@ -7,9 +7,12 @@ package tpm2
 // Section 11 - Session Commands
 
 import (
+	"bytes"
 	"fmt"
 
 	"github.com/canonical/go-tpm2/internal"
+
+	"golang.org/x/xerrors"
 )
 
 // StartAuthSession executes the TPM2_StartAuthSession command to start an authorization session. On successful completion, it will
@@ -40,6 +43,13 @@ import (
 // corresponds to a NV index with a type of NVTypePinPass or NVTypePinFail, a *TPMHandleError error with an error code of ErrorHandle
 // will be returned for handle index 2.
 //
+// The TPM considers a session to be bound to a resource by comparing a value derived from the resource's current name and
+// authorization value with the one computed when the session was started. As the name of a NV index changes when it is written to
+// for the first time or when it is read or write locked, a session bound to a NV index is no longer bound to it after one of these
+// events, and the authorization value of the index is included in the HMAC key when the session is subsequently used to authorize
+// it. This is handled automatically as long as the ResourceContext for the index is the one supplied to the commands that change its
+// attributes.
+//
 // If a session key is computed, this will be used (along with the authorization value of resources that the session is being used
 // for authorization of if the session is not bound to them) to derive a HMAC key for generating command and response HMACs. If both
 // tpmKey and bind are nil, no session key is created.
@@ -85,7 +95,7 @@ func (t *TPMContext) StartAuthSession(tpmKey, bind ResourceContext, sessionType
 		tpmKeyHandle = tpmKey.Handle()
 
 		var err error
-		encryptedSalt, salt, err = cryptComputeEncryptedSalt(object.GetPublic())
+		encryptedSalt, salt, err = cryptComputeEncryptedSalt(t.randReader(), object.GetPublic())
 		if err != nil {
 			return nil, fmt.Errorf("cannot compute encrypted salt: %v", err)
 		}
@@ -106,7 +116,7 @@ func (t *TPMContext) StartAuthSession(tpmKey, bind ResourceContext, sessionType
 	}
 
 	nonceCaller := make([]byte, digestSize)
-	if err := cryptComputeNonce(nonceCaller); err != nil {
+	if err := cryptComputeNonce(t.randReader(), nonceCaller); err != nil {
 		return nil, fmt.Errorf("cannot compute initial nonceCaller: %v", err)
 	}
 
@@ -124,8 +134,8 @@ func (t *TPMContext) StartAuthSession(tpmKey, bind ResourceContext, sessionType
 	switch sessionHandle.Type() {
 	case HandleTypeHMACSession, HandleTypePolicySession:
 	default:
-		return nil, &InvalidResponseError{CommandStartAuthSession,
-			fmt.Sprintf("handle 0x%08x returned from TPM is the wrong type", sessionHandle)}
+		return nil, &InvalidResponseError{Command: CommandStartAuthSession,
+			msg: fmt.Sprintf("handle 0x%08x returned from TPM is the wrong type", sessionHandle)}
 	}
 
 	data := &sessionContextData{
@@ -149,6 +159,110 @@ func (t *TPMContext) StartAuthSession(tpmKey, bind ResourceContext, sessionType
 	return makeSessionContext(sessionHandle, data), nil
 }
 
+// IsSessionDesynchronized indicates whether the host's copy of the nonces for the supplied session may no longer
+// match the TPM's. This happens when the session is used in a command for which a valid response isn't received, eg, because the
+// transmission interface returns an error or the response is malformed. Any subsequent attempt to use the session in a command will
+// fail with a *SessionDesynchronizedError error without the command being sent to the TPM.
+func (t *TPMContext) IsSessionDesynchronized(session SessionContext) bool {
+	s, isSession := session.(*sessionContext)
+	if !isSession {
+		return false
+	}
+	return t.isSessionDesynchronized(s)
+}
+
+// RefreshSession replaces the supplied session with a new one that has the same type, symmetric algorithm and
+// digest algorithm. The new session is started by executing the TPM2_StartAuthSession command with the supplied tpmKey and bind
+// arguments, which are used in the same way as they are by StartAuthSession. The session attributes of the existing
+// SessionContext are copied to the returned one.
+//
+// This is the way to recover from a session becoming desynchronized (see IsSessionDesynchronized), as the TPM provides no way to
+// retrieve the current nonce of a session. The existing session is flushed from the TPM first if it is still loaded, and its
+// SessionContext is invalidated. If the session was a policy session, the policy assertions need to be executed again on the new
+// session.
+func (t *TPMContext) RefreshSession(session SessionContext, tpmKey, bind ResourceContext, sessions ...SessionContext) (SessionContext, error) {
+	s, isSession := session.(*sessionContext)
+	if !isSession {
+		return nil, makeInvalidArgError("session", "not a session")
+	}
+	data := s.Data()
+	if data == nil {
+		return nil, makeInvalidArgError("session", "incomplete session")
+	}
+
+	if s.Handle() != HandleUnassigned {
+		// The session might have already been flushed by the command that caused it to become desynchronized.
+		if err := t.FlushContext(s); err != nil && !IsTPMHandleError(err, ErrorHandle, CommandFlushContext, 1) {
+			return nil, xerrors.Errorf("cannot flush existing session: %w", err)
+		}
+	}
+	delete(t.desyncedSessions, data)
+	s.invalidate()
+
+	symmetric := data.Symmetric
+	if symmetric == nil {
+		symmetric = &SymDef{Algorithm: SymAlgorithmNull}
+	}
+	newSession, err := t.StartAuthSession(tpmKey, bind, data.SessionType, symmetric, data.HashAlg, sessions...)
+	if err != nil {
+		return nil, err
+	}
+	newSession.SetAttrs(s.attrs)
+	return newSession, nil
+}
+
+// AdoptSession checks that a SessionContext that was created by another TPMContext, eg, one that was recreated from serialized data
+// with CreateHandleContextFromBytes, can be used with this TPMContext. This is useful for sessions that are shared between
+// processes, because a session doesn't survive a TPM reset or restart and the host has no other way of knowing whether the TPM has
+// discarded it.
+//
+// For a HMAC session, this executes a TPM2_GetRandom command with the session used for auditing and checks that the TPM returns a
+// new nonce for it. If the session has a session key, the response HMAC is also checked, and a *InvalidResponseError will be
+// returned if it is invalid. Note that the command will be included in the session's audit digest. For a policy or trial session,
+// this executes the TPM2_PolicyGetDigest command, which leaves the nonces unchanged.
+//
+// If the session is no longer loaded on the TPM, a ResourceUnavailableError error is returned. A session without a session key
+// that has been replaced by a different session with the same handle cannot be detected.
+func (t *TPMContext) AdoptSession(session SessionContext) error {
+	s, isSession := session.(*sessionContext)
+	if !isSession {
+		return makeInvalidArgError("session", "not a session")
+	}
+	data := s.Data()
+	if data == nil {
+		return makeInvalidArgError("session", "incomplete session")
+	}
+
+	var err error
+	switch data.SessionType {
+	case SessionTypeHMAC:
+		nonceTPM := s.NonceTPM()
+		err = t.RunCommand(CommandGetRandom, []SessionContext{s.WithAttrs(AttrContinueSession | AttrAudit)},
+			Delimiter,
+			uint16(0), Delimiter,
+			Delimiter,
+			new(Digest))
+		if err == nil && (len(s.NonceTPM()) != len(nonceTPM) || bytes.Equal(s.NonceTPM(), nonceTPM)) {
+			return fmt.Errorf("session 0x%08x returned an unexpected nonce", s.Handle())
+		}
+	case SessionTypePolicy, SessionTypeTrial:
+		_, err = t.PolicyGetDigest(s)
+	default:
+		return makeInvalidArgError("session", "unexpected session type")
+	}
+
+	switch {
+	case IsTPMWarning(err, WarningReferenceH0, AnyCommandCode) || IsTPMWarning(err, WarningReferenceS0, AnyCommandCode):
+		return ResourceUnavailableError{s.Handle()}
+	case IsTPMHandleError(err, AnyErrorCode, AnyCommandCode, 1) || IsTPMSessionError(err, ErrorHandle, AnyCommandCode, 1):
+		return ResourceUnavailableError{s.Handle()}
+	case err != nil:
+		return xerrors.Errorf("cannot check session: %w", err)
+	}
+
+	return nil
+}
+
 // PolicyRestart executes the TPM2_PolicyRestart command on the policy session associated with sessionContext, to reset the policy
 // authorization session to its initial state.
 func (t *TPMContext) PolicyRestart(sessionContext SessionContext, sessions ...SessionContext) error {
@@ -7,10 +7,14 @@ package tpm2_test
 import (
 	"bytes"
 	"crypto/sha256"
+	"reflect"
 	"testing"
 
 	. "github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
 	"github.com/canonical/go-tpm2/testutil"
+
+	"golang.org/x/xerrors"
 )
 
 func TestStartAuthSession(t *testing.T) {
@@ -211,3 +215,260 @@ func TestPolicyRestart(t *testing.T) {
 		t.Errorf("Digest wasn't reset to zero")
 	}
 }
+
+func TestAdoptSession(t *testing.T) {
+	getRandomResponse, _ := mu.MarshalToBytes(Digest(nil))
+
+	makeSession := func(sessionType SessionType, nonceTPM Nonce) SessionContext {
+		return MakeMockSessionContext(0x02000000, &SessionContextData{
+			HashAlg:     HashAlgorithmSHA256,
+			SessionType: sessionType,
+			NonceCaller: make(Nonce, 32),
+			NonceTPM:    nonceTPM}).WithAttrs(AttrContinueSession)
+	}
+
+	for _, data := range []struct {
+		desc        string
+		sessionType SessionType
+		nonceTPM    Nonce
+		command     *testutil.MockCommand
+		err         string
+		unavailable bool
+	}{
+		{
+			desc:        "HMAC",
+			sessionType: SessionTypeHMAC,
+			nonceTPM:    bytes.Repeat([]byte{0xff}, 32),
+			command:     &testutil.MockCommand{CommandCode: CommandGetRandom, RawResponse: makeMockAuditSessionResponse(getRandomResponse, false)},
+		},
+		{
+			desc:        "HMACUnchangedNonce",
+			sessionType: SessionTypeHMAC,
+			nonceTPM:    make(Nonce, 32),
+			command:     &testutil.MockCommand{CommandCode: CommandGetRandom, RawResponse: makeMockAuditSessionResponse(getRandomResponse, false)},
+			err:         "session 0x02000000 returned an unexpected nonce",
+		},
+		{
+			desc:        "HMACFlushed",
+			sessionType: SessionTypeHMAC,
+			nonceTPM:    make(Nonce, 32),
+			command:     &testutil.MockCommand{CommandCode: CommandGetRandom, Response: &testutil.MockResponse{ResponseCode: ResponseCode(0x918)}},
+			err:         "a resource at handle 0x02000000 is not available on the TPM",
+			unavailable: true,
+		},
+		{
+			desc:        "Policy",
+			sessionType: SessionTypePolicy,
+			nonceTPM:    make(Nonce, 32),
+			command: &testutil.MockCommand{CommandCode: CommandPolicyGetDigest, Handles: []Handle{0x02000000},
+				Response: &testutil.MockResponse{Params: []interface{}{make(Digest, 32)}}},
+		},
+		{
+			desc:        "PolicyFlushed",
+			sessionType: SessionTypePolicy,
+			nonceTPM:    make(Nonce, 32),
+			command:     &testutil.MockCommand{CommandCode: CommandPolicyGetDigest, Response: &testutil.MockResponse{ResponseCode: ResponseCode(0x910)}},
+			err:         "a resource at handle 0x02000000 is not available on the TPM",
+			unavailable: true,
+		},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			tcti := testutil.NewMockTCTI(data.command)
+			tpm, _ := NewTPMContext(tcti)
+
+			session := makeSession(data.sessionType, data.nonceTPM)
+			err := tpm.AdoptSession(session)
+			if data.err == "" {
+				if err != nil {
+					t.Fatalf("AdoptSession failed: %v", err)
+				}
+			} else if err == nil || err.Error() != data.err {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if xerrors.Is(err, ErrResourceUnavailable) != data.unavailable {
+				t.Errorf("Unexpected error type: %v", err)
+			}
+
+			if err := tcti.Done(); err != nil {
+				t.Errorf("Unexpected commands: %v", err)
+			}
+			if session.(*TestSessionContext).Attrs() != AttrContinueSession {
+				t.Errorf("Session attributes were modified")
+			}
+		})
+	}
+
+	tpm, _ := NewTPMContext(testutil.NewMockTCTI())
+	if err := tpm.AdoptSession(nil); err == nil || err.Error() != "invalid session argument: not a session" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestSessionDesynchronization(t *testing.T) {
+	nonce := make(Nonce, 32)
+	makeSession := func() SessionContext {
+		return MakeMockSessionContext(0x03000000, &SessionContextData{
+			HashAlg:     HashAlgorithmSHA256,
+			SessionType: SessionTypePolicy,
+			NonceCaller: make(Nonce, 32),
+			NonceTPM:    nonce}).WithAttrs(AttrContinueSession)
+	}
+
+	// A TPM error doesn't affect the session's nonces.
+	tcti := testutil.NewMockTCTI(&testutil.MockCommand{CommandCode: CommandPCRReset, Response: &testutil.MockResponse{ResponseCode: ResponseCode(0x98e)}})
+	tpm, _ := NewTPMContext(tcti)
+	tpm.SetMaxSubmissions(1)
+
+	session := makeSession()
+	if err := tpm.PCRReset(tpm.PCRHandleContext(7), session); !IsTPMSessionError(err, ErrorAuthFail, CommandPCRReset, 1) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if tpm.IsSessionDesynchronized(session) {
+		t.Errorf("Session shouldn't be desynchronized after a TPM error")
+	}
+
+	// A truncated response means that the TPM may have generated a new nonce that the host doesn't know about.
+	tcti = testutil.NewMockTCTI(&testutil.MockCommand{CommandCode: CommandPCRReset, RawResponse: []byte{0x80, 0x02, 0x00}})
+	tpm, _ = NewTPMContext(tcti)
+	tpm.SetMaxSubmissions(1)
+
+	if err := tpm.PCRReset(tpm.PCRHandleContext(7), session); err == nil {
+		t.Fatalf("PCRReset should have failed")
+	}
+	if !tpm.IsSessionDesynchronized(session) {
+		t.Errorf("Session should be desynchronized")
+	}
+	if !tpm.IsSessionDesynchronized(session.WithAttrs(0)) {
+		t.Errorf("Duplicate of session should be desynchronized")
+	}
+
+	var e *SessionDesynchronizedError
+	if err := tpm.PCRReset(tpm.PCRHandleContext(7), session); !xerrors.As(err, &e) || e.Handle != 0x03000000 {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(tcti.Commands()) != 1 {
+		t.Errorf("Command using a desynchronized session was sent to the TPM")
+	}
+
+	// Other sessions are unaffected.
+	if tpm.IsSessionDesynchronized(makeSession()) {
+		t.Errorf("Unrelated session should not be desynchronized")
+	}
+}
+
+func TestRefreshSession(t *testing.T) {
+	tcti := testutil.NewMockTCTI(
+		&testutil.MockCommand{CommandCode: CommandPCRReset, RawResponse: []byte{0x80, 0x02, 0x00}},
+		&testutil.MockCommand{CommandCode: CommandFlushContext, Response: &testutil.MockResponse{ResponseCode: ResponseCode(0x18b)}},
+		&testutil.MockCommand{CommandCode: CommandStartAuthSession, Response: &testutil.MockResponse{Handle: 0x03000001, Params: []interface{}{make(Nonce, 32)}}})
+	tpm, _ := NewTPMContext(tcti)
+	tpm.SetMaxSubmissions(1)
+
+	symmetric := &SymDef{Algorithm: SymAlgorithmAES, KeyBits: &SymKeyBitsU{Sym: 128}, Mode: &SymModeU{Sym: SymModeCFB}}
+	session := MakeMockSessionContext(0x03000000, &SessionContextData{
+		HashAlg:     HashAlgorithmSHA256,
+		SessionType: SessionTypePolicy,
+		NonceCaller: make(Nonce, 32),
+		NonceTPM:    make(Nonce, 32),
+		Symmetric:   symmetric}).WithAttrs(AttrContinueSession | AttrAudit)
+
+	var e *InvalidResponseError
+	if err := tpm.PCRReset(tpm.PCRHandleContext(7), session); !xerrors.As(err, &e) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The session has already been flushed from the TPM, which RefreshSession should tolerate.
+	newSession, err := tpm.RefreshSession(session, nil, nil)
+	if err != nil {
+		t.Fatalf("RefreshSession failed: %v", err)
+	}
+	if newSession.Handle() != 0x03000001 {
+		t.Errorf("Unexpected handle: 0x%08x", newSession.Handle())
+	}
+	if session.Handle() != HandleUnassigned {
+		t.Errorf("Old session wasn't invalidated")
+	}
+	if tpm.IsSessionDesynchronized(newSession) {
+		t.Errorf("New session shouldn't be desynchronized")
+	}
+	if newSession.(*TestSessionContext).Attrs() != AttrContinueSession|AttrAudit {
+		t.Errorf("Unexpected attributes: %v", newSession.(*TestSessionContext).Attrs())
+	}
+
+	var sessionType SessionType
+	var sym SymDef
+	var authHash HashAlgorithmId
+	if _, err := mu.UnmarshalFromBytes(tcti.Commands()[2][10+4+4:], new(Nonce), new(EncryptedSecret), &sessionType, &sym, &authHash); err != nil {
+		t.Fatalf("Cannot unmarshal StartAuthSession command: %v", err)
+	}
+	if sessionType != SessionTypePolicy || authHash != HashAlgorithmSHA256 || !reflect.DeepEqual(&sym, symmetric) {
+		t.Errorf("Unexpected StartAuthSession parameters: %v, %v, %v", sessionType, sym, authHash)
+	}
+}
+
+func TestHMACSessionBoundToNVIndexKey(t *testing.T) {
+	auth := []byte("foo")
+	rc, err := CreateNVIndexResourceContextFromPublic(&NVPublic{
+		Index:   0x01800000,
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeCounter.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead),
+		Size:    8})
+	if err != nil {
+		t.Fatalf("CreateNVIndexResourceContextFromPublic failed: %v", err)
+	}
+	rc.SetAuthValue(auth)
+
+	sessionKey := bytes.Repeat([]byte{0x01}, 32)
+	session := MakeMockSessionContext(0x02000000, &SessionContextData{
+		HashAlg:     HashAlgorithmSHA256,
+		SessionType: SessionTypeHMAC,
+		IsBound:     true,
+		BoundEntity: TestComputeBindName(rc.Name(), auth),
+		SessionKey:  sessionKey,
+		NonceCaller: make(Nonce, 32),
+		NonceTPM:    make(Nonce, 32)}).WithAttrs(AttrContinueSession)
+
+	tcti := testutil.NewMockTCTI(
+		mockCommand(CommandNVIncrement, ResponseCode(0x148)),
+		mockCommand(CommandNVIncrement, ResponseCode(0x148)))
+	tpm, _ := NewTPMContext(tcti)
+
+	// checkHMAC verifies the command HMAC of the last command sent to the TPM with the supplied key.
+	checkHMAC := func(key []byte) {
+		var nonceCaller Nonce
+		var attrs uint8
+		var hmac Auth
+		commands := tcti.Commands()
+		if _, err := mu.UnmarshalFromBytes(commands[len(commands)-1][10+8+4+4:], &nonceCaller, &attrs, &hmac); err != nil {
+			t.Fatalf("Cannot unmarshal command auth area: %v", err)
+		}
+
+		cpHash := CryptComputeCpHash(HashAlgorithmSHA256, CommandNVIncrement, []Name{rc.Name(), rc.Name()}, nil)
+		h := session.(*TestSessionContext).HMACForKey(key)
+		h.Write(cpHash)
+		h.Write(nonceCaller)
+		h.Write(session.NonceTPM())
+		h.Write([]byte{attrs})
+		if !bytes.Equal(hmac, h.Sum(nil)) {
+			t.Errorf("Unexpected command HMAC")
+		}
+	}
+
+	if err := tpm.NVIncrement(rc, rc, session); !IsTPMError(err, ErrorNVLocked, CommandNVIncrement) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// The session is bound to the index, so the index's auth value is not part of the HMAC key.
+	checkHMAC(sessionKey)
+
+	// Setting AttrNVWritten changes the name of the index, after which the session is no longer bound to it.
+	name := rc.Name()
+	rc.(*NvIndexContext).SetAttr(AttrNVWritten)
+	if bytes.Equal(rc.Name(), name) {
+		t.Fatalf("Name of index didn't change")
+	}
+
+	if err := tpm.NVIncrement(rc, rc, session); !IsTPMError(err, ErrorNVLocked, CommandNVIncrement) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkHMAC(append(sessionKey, auth...))
+}
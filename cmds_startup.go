@@ -24,7 +24,13 @@ package tpm2
 // Subsequent use of HandleContext instances corresponding to entities that are evicted as a consequence of this function will no
 // longer work.
 func (t *TPMContext) Startup(startupType StartupType) error {
-	return t.RunCommand(CommandStartup, nil, Delimiter, startupType)
+	if err := t.RunCommand(CommandStartup, nil, Delimiter, startupType); err != nil {
+		return err
+	}
+	// The TPM has been initialized, so any previously observed self test state no longer applies.
+	t.selfTestState = selfTestStateUnknown
+	t.resetHierarchyState(startupType)
+	return nil
 }
 
 // Shutdown executes the TPM2_Shutdown command with the specified StartupType, and is used to prepare the TPM for a power cycle.
@@ -6,8 +6,40 @@ package tpm2
 
 // Section 9 - Start-up
 
+// selfTestState describes what is known about the state of the TPM's self tests.
+type selfTestState uint8
+
+const (
+	selfTestStateUnknown  selfTestState = iota // Nothing is known about the state of the self tests
+	selfTestStateRunning                       // Self tests have been started and may still be running in the background
+	selfTestStateComplete                      // The TPM has indicated that all self tests have completed successfully
+)
+
+// SelfTestsComplete indicates whether the TPM has reported that all of its self tests have completed successfully, as indicated by
+// the testResult returned from TPMContext.GetTestResult. This is reset if the TPM is subsequently started up or indicates that it
+// needs to be tested again.
+func (t *TPMContext) SelfTestsComplete() bool {
+	return t.selfTestState == selfTestStateComplete
+}
+
+// SelfTest executes the TPM2_SelfTest command, which causes the TPM to test its capabilities. If fullTest is true, all functions are
+// tested. If fullTest is false, only functions that haven't already been tested are tested.
+//
+// The TPM may perform the tests in the background. Once a self test has been started with this function, commands that fail with a
+// TPM_RC_TESTING warning are resubmitted until the tests complete, even if TPMContext.SetWaitForReady hasn't been used to enable
+// waiting.
+//
+// If fullTest is false and the TPM has reported that all self tests have completed (see TPMContext.SelfTestsComplete), this function
+// does nothing, as there are no untested functions.
 func (t *TPMContext) SelfTest(fullTest bool, sessions ...SessionContext) error {
-	return t.RunCommand(CommandSelfTest, sessions, Delimiter, fullTest)
+	if !fullTest && t.selfTestState == selfTestStateComplete {
+		return nil
+	}
+	err := t.RunCommand(CommandSelfTest, sessions, Delimiter, fullTest)
+	if err == nil || IsTPMWarning(err, WarningTesting, CommandSelfTest) {
+		t.selfTestState = selfTestStateRunning
+	}
+	return err
 }
 
 func (t *TPMContext) IncrementalSelfTest(toTest AlgorithmList, sessions ...SessionContext) (AlgorithmList, error) {
@@ -26,5 +58,13 @@ func (t *TPMContext) GetTestResult(sessions ...SessionContext) (outData MaxBuffe
 	if err := t.RunCommand(CommandGetTestResult, sessions, Delimiter, Delimiter, Delimiter, &outData, &testResult); err != nil {
 		return nil, 0, err
 	}
+	switch {
+	case testResult == Success:
+		t.selfTestState = selfTestStateComplete
+	case IsTPMWarning(DecodeResponseCode(CommandGetTestResult, testResult), WarningTesting, AnyCommandCode):
+		t.selfTestState = selfTestStateRunning
+	default:
+		t.selfTestState = selfTestStateUnknown
+	}
 	return outData, testResult, nil
 }
@@ -0,0 +1,213 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2
+
+import (
+	"errors"
+	"sort"
+
+	"golang.org/x/xerrors"
+)
+
+// ConformanceCommand describes the level of support for a single command in a ConformanceReport.
+type ConformanceCommand struct {
+	CommandCode CommandCode `json:"code"`
+	Name        string      `json:"name"`
+
+	Supported   bool `json:"supported"`   // The TPM advertises support for this command
+	Implemented bool `json:"implemented"` // This package provides a wrapper for this command
+
+	// Probed indicates that the wrapper for this command was executed against the TPM whilst generating the report. If
+	// the command failed, ProbeError contains the error.
+	Probed     bool   `json:"probed"`
+	ProbeError string `json:"probeError,omitempty"`
+}
+
+// ConformanceAlgorithm describes an algorithm supported by the TPM in a ConformanceReport.
+type ConformanceAlgorithm struct {
+	Alg        AlgorithmId         `json:"id"`
+	Name       string              `json:"name"`
+	Attributes AlgorithmAttributes `json:"attributes"`
+}
+
+// ConformanceNVLimits describes the NV limits of the TPM in a ConformanceReport.
+type ConformanceNVLimits struct {
+	IndexMax              uint32 `json:"indexMax"`              // Maximum size of a NV index data area (TPM_PT_NV_INDEX_MAX)
+	BufferMax             uint32 `json:"bufferMax"`             // Maximum size of a NV read or write buffer (TPM_PT_NV_BUFFER_MAX)
+	CountersMax           uint32 `json:"countersMax"`           // Maximum number of NV indices with the counter type (TPM_PT_NV_COUNTERS_MAX)
+	CountersAvail         uint32 `json:"countersAvail"`         // Number of additional counter indices that can be defined (TPM_PT_NV_COUNTERS_AVAIL)
+	WriteRecoveryMillisec uint32 `json:"writeRecoveryMillisec"` // Delay after TPM_RC_NV_RATE before NV can be written (TPM_PT_NV_WRITE_RECOVERY)
+}
+
+// ConformanceReport is returned from TPMContext.GenerateConformanceReport. It is intended to be serialized (eg, with
+// encoding/json) so that the capabilities of TPMs across a fleet of devices can be collected and compared.
+type ConformanceReport struct {
+	Manufacturer     TPMManufacturer `json:"manufacturer"`
+	ManufacturerName string          `json:"manufacturerName"`
+	VendorString     string          `json:"vendorString"`
+	FirmwareVersion  [2]uint32       `json:"firmwareVersion"`
+
+	Commands   []ConformanceCommand   `json:"commands"`
+	Algorithms []ConformanceAlgorithm `json:"algorithms"`
+	ECCCurves  ECCCurveList           `json:"eccCurves"`
+	PCRBanks   []HashAlgorithmId      `json:"pcrBanks"`
+	NVLimits   ConformanceNVLimits    `json:"nvLimits"`
+}
+
+// conformanceProbe is a non-destructive test of a command wrapper, used by TPMContext.GenerateConformanceReport.
+type conformanceProbe struct {
+	command CommandCode
+	run     func(t *TPMContext, report *ConformanceReport) error
+}
+
+var conformanceProbes = []conformanceProbe{
+	{command: CommandGetRandom, run: func(t *TPMContext, _ *ConformanceReport) error {
+		_, err := t.GetRandom(16)
+		return err
+	}},
+	{command: CommandReadClock, run: func(t *TPMContext, _ *ConformanceReport) error {
+		_, err := t.ReadClock()
+		return err
+	}},
+	{command: CommandGetTestResult, run: func(t *TPMContext, _ *ConformanceReport) error {
+		_, _, err := t.GetTestResult()
+		return err
+	}},
+	{command: CommandPCRRead, run: func(t *TPMContext, report *ConformanceReport) error {
+		if len(report.PCRBanks) == 0 {
+			return errors.New("no PCR banks are allocated")
+		}
+		_, _, err := t.PCRRead(PCRSelectionList{{Hash: report.PCRBanks[0], Select: PCRSelect{0}}})
+		return err
+	}},
+	{command: CommandTestParms, run: func(t *TPMContext, _ *ConformanceReport) error {
+		return t.TestParms(&PublicParams{
+			Type: ObjectTypeSymCipher,
+			Parameters: &PublicParamsU{
+				SymDetail: &SymCipherParams{
+					Sym: SymDefObject{
+						Algorithm: SymObjectAlgorithmAES,
+						KeyBits:   &SymKeyBitsU{Sym: 128},
+						Mode:      &SymModeU{Sym: SymModeCFB}}}}})
+	}},
+	{command: CommandStartAuthSession, run: func(t *TPMContext, _ *ConformanceReport) error {
+		session, err := t.StartAuthSession(nil, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256)
+		if err != nil {
+			return err
+		}
+		return t.FlushContext(session)
+	}},
+}
+
+func (t *TPMContext) getFixedProperties() (map[Property]uint32, error) {
+	props, err := t.GetCapabilityTPMProperties(PropertyFixed, CapabilityMaxProperties)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[Property]uint32)
+	for _, p := range props {
+		out[p.Property] = p.Value
+	}
+	return out, nil
+}
+
+// GenerateConformanceReport queries the TPM for the commands, algorithms, ECC curves, PCR banks and NV limits that it supports,
+// and returns a report that can be used to qualify TPMs from different vendors. Each command advertised by the TPM is compared
+// against the set of commands implemented by this package. The wrappers for a set of commands that have no side effects on the
+// persistent state of the TPM are also executed, and any failures are recorded in the report rather than being returned as an
+// error.
+//
+// An error is only returned if the TPM's capabilities cannot be queried.
+func (t *TPMContext) GenerateConformanceReport() (*ConformanceReport, error) {
+	report := new(ConformanceReport)
+
+	fixed, err := t.getFixedProperties()
+	if err != nil {
+		return nil, xerrors.Errorf("cannot obtain fixed properties: %w", err)
+	}
+	report.Manufacturer = TPMManufacturer(fixed[PropertyManufacturer])
+	report.ManufacturerName = report.Manufacturer.String()
+	report.VendorString = decodeVendorString([4]uint32{fixed[PropertyVendorString1], fixed[PropertyVendorString2],
+		fixed[PropertyVendorString3], fixed[PropertyVendorString4]})
+	report.FirmwareVersion = [2]uint32{fixed[PropertyFirmwareVersion1], fixed[PropertyFirmwareVersion2]}
+	report.NVLimits.IndexMax = fixed[PropertyNVIndexMax]
+	report.NVLimits.BufferMax = fixed[PropertyNVBufferMax]
+	report.NVLimits.CountersMax = fixed[PropertyNVCountersMax]
+
+	props, err := t.GetCapabilityTPMProperties(PropertyNVCountersAvail, 1)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot obtain available NV counters: %w", err)
+	}
+	if len(props) > 0 && props[0].Property == PropertyNVCountersAvail {
+		report.NVLimits.CountersAvail = props[0].Value
+	}
+	props, err = t.GetCapabilityTPMProperties(PropertyNVWriteRecovery, 1)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot obtain NV write recovery time: %w", err)
+	}
+	if len(props) > 0 && props[0].Property == PropertyNVWriteRecovery {
+		report.NVLimits.WriteRecoveryMillisec = props[0].Value
+	}
+
+	algs, err := t.GetCapabilityAlgs(AlgorithmFirst, CapabilityMaxProperties)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot obtain supported algorithms: %w", err)
+	}
+	for _, a := range algs {
+		report.Algorithms = append(report.Algorithms, ConformanceAlgorithm{Alg: a.Alg, Name: a.Alg.String(), Attributes: a.Properties})
+	}
+
+	report.ECCCurves, err = t.GetCapabilityECCCurves()
+	if err != nil {
+		return nil, xerrors.Errorf("cannot obtain supported ECC curves: %w", err)
+	}
+
+	pcrs, err := t.GetCapabilityPCRs()
+	if err != nil {
+		return nil, xerrors.Errorf("cannot obtain PCR allocation: %w", err)
+	}
+	for _, s := range pcrs {
+		if len(s.Select) > 0 {
+			report.PCRBanks = append(report.PCRBanks, s.Hash)
+		}
+	}
+
+	cmds, err := t.GetCapabilityCommands(CommandFirst, CapabilityMaxProperties)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot obtain supported commands: %w", err)
+	}
+	commands := make(map[CommandCode]*ConformanceCommand)
+	for code := range commandHandleCounts {
+		commands[code] = &ConformanceCommand{CommandCode: code, Implemented: true}
+	}
+	for _, attrs := range cmds {
+		code := attrs.CommandCode()
+		c, ok := commands[code]
+		if !ok {
+			c = &ConformanceCommand{CommandCode: code}
+			commands[code] = c
+		}
+		c.Supported = true
+	}
+
+	for _, p := range conformanceProbes {
+		c := commands[p.command]
+		if !c.Supported {
+			continue
+		}
+		c.Probed = true
+		if err := p.run(t, report); err != nil {
+			c.ProbeError = err.Error()
+		}
+	}
+
+	for _, c := range commands {
+		c.Name = c.CommandCode.String()
+		report.Commands = append(report.Commands, *c)
+	}
+	sort.Slice(report.Commands, func(i, j int) bool { return report.Commands[i].CommandCode < report.Commands[j].CommandCode })
+
+	return report, nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	"reflect"
+	"testing"
+
+	. "github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+func TestGenerateConformanceReport(t *testing.T) {
+	capability := func(data *CapabilityData) *testutil.MockCommand {
+		return &testutil.MockCommand{CommandCode: CommandGetCapability, Response: &testutil.MockResponse{Params: []interface{}{false, data}}}
+	}
+	properties := func(props ...TaggedProperty) *testutil.MockCommand {
+		return capability(&CapabilityData{Capability: CapabilityTPMProperties, Data: &CapabilitiesU{TPMProperties: props}})
+	}
+
+	tcti := testutil.NewMockTCTI(
+		properties(
+			TaggedProperty{Property: PropertyManufacturer, Value: uint32(TPMManufacturerIBM)},
+			TaggedProperty{Property: PropertyVendorString1, Value: 0x53572020},
+			TaggedProperty{Property: PropertyVendorString2, Value: 0x2054504d},
+			TaggedProperty{Property: PropertyFirmwareVersion1, Value: 0x20191023},
+			TaggedProperty{Property: PropertyFirmwareVersion2, Value: 0x00163636},
+			TaggedProperty{Property: PropertyNVCountersMax, Value: 0},
+			TaggedProperty{Property: PropertyNVIndexMax, Value: 2048},
+			TaggedProperty{Property: PropertyNVBufferMax, Value: 1024}),
+		properties(TaggedProperty{Property: PropertyNVCountersAvail, Value: 6}),
+		properties(TaggedProperty{Property: PropertyNVWriteRecovery, Value: 50}),
+		capability(&CapabilityData{Capability: CapabilityAlgs, Data: &CapabilitiesU{Algorithms: AlgorithmPropertyList{
+			{Alg: AlgorithmSHA256, Properties: AttrHash}}}}),
+		capability(&CapabilityData{Capability: CapabilityECCCurves, Data: &CapabilitiesU{ECCCurves: ECCCurveList{ECCCurveNIST_P256}}}),
+		capability(&CapabilityData{Capability: CapabilityPCRs, Data: &CapabilitiesU{AssignedPCR: PCRSelectionList{
+			{Hash: HashAlgorithmSHA1, Select: PCRSelect{}},
+			{Hash: HashAlgorithmSHA256, Select: PCRSelect{0, 1, 2}}}}}),
+		capability(&CapabilityData{Capability: CapabilityCommands, Data: &CapabilitiesU{Command: CommandAttributesList{
+			makeCommandAttributes(CommandGetCapability, 0, 0),
+			makeCommandAttributes(CommandGetRandom, 0, 0),
+			makeCommandAttributes(CommandCode(0x20000001), 0, 0)}}}),
+		properties(
+			TaggedProperty{Property: PropertyInputBuffer, Value: 1024},
+			TaggedProperty{Property: PropertyMaxDigest, Value: 32},
+			TaggedProperty{Property: PropertyNVBufferMax, Value: 1024}),
+		&testutil.MockCommand{CommandCode: CommandGetRandom, Response: &testutil.MockResponse{ResponseCode: ResponseCode(0x901)}})
+	tpm, _ := NewTPMContext(tcti)
+
+	report, err := tpm.GenerateConformanceReport()
+	if err != nil {
+		t.Fatalf("GenerateConformanceReport failed: %v", err)
+	}
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+
+	if report.Manufacturer != TPMManufacturerIBM || report.ManufacturerName != "IBM" {
+		t.Errorf("Unexpected manufacturer: %v (%s)", report.Manufacturer, report.ManufacturerName)
+	}
+	if report.VendorString != "SW   TPM" {
+		t.Errorf("Unexpected vendor string: %q", report.VendorString)
+	}
+	if report.FirmwareVersion != [2]uint32{0x20191023, 0x00163636} {
+		t.Errorf("Unexpected firmware version: %x", report.FirmwareVersion)
+	}
+	if !reflect.DeepEqual(report.NVLimits, ConformanceNVLimits{IndexMax: 2048, BufferMax: 1024, CountersAvail: 6, WriteRecoveryMillisec: 50}) {
+		t.Errorf("Unexpected NV limits: %+v", report.NVLimits)
+	}
+	if !reflect.DeepEqual(report.Algorithms, []ConformanceAlgorithm{{Alg: AlgorithmSHA256, Name: "TPM_ALG_SHA256", Attributes: AttrHash}}) {
+		t.Errorf("Unexpected algorithms: %+v", report.Algorithms)
+	}
+	if !reflect.DeepEqual(report.ECCCurves, ECCCurveList{ECCCurveNIST_P256}) {
+		t.Errorf("Unexpected ECC curves: %v", report.ECCCurves)
+	}
+	if !reflect.DeepEqual(report.PCRBanks, []HashAlgorithmId{HashAlgorithmSHA256}) {
+		t.Errorf("Unexpected PCR banks: %v", report.PCRBanks)
+	}
+
+	commands := make(map[CommandCode]ConformanceCommand)
+	for i, c := range report.Commands {
+		if i > 0 && c.CommandCode <= report.Commands[i-1].CommandCode {
+			t.Errorf("Commands are not sorted")
+		}
+		commands[c.CommandCode] = c
+	}
+	if c := commands[CommandGetCapability]; !c.Supported || !c.Implemented || c.Probed || c.Name != "TPM_CC_GetCapability" {
+		t.Errorf("Unexpected entry for TPM2_GetCapability: %+v", c)
+	}
+	if c := commands[CommandGetRandom]; !c.Supported || !c.Implemented || !c.Probed || c.ProbeError == "" {
+		t.Errorf("Unexpected entry for TPM2_GetRandom: %+v", c)
+	}
+	if c := commands[CommandClear]; c.Supported || !c.Implemented || c.Probed {
+		t.Errorf("Unexpected entry for TPM2_Clear: %+v", c)
+	}
+	if c := commands[CommandCode(0x20000001)]; !c.Supported || c.Implemented {
+		t.Errorf("Unexpected entry for vendor command: %+v", c)
+	}
+}
@@ -84,6 +84,8 @@ const (
 	CommandEvictControl               CommandCode = 0x00000120 // TPM_CC_EvictControl
 	CommandHierarchyControl           CommandCode = 0x00000121 // TPM_CC_HierarchyControl
 	CommandNVUndefineSpace            CommandCode = 0x00000122 // TPM_CC_NV_UndefineSpace
+	CommandChangeEPS                  CommandCode = 0x00000124 // TPM_CC_ChangeEPS
+	CommandChangePPS                  CommandCode = 0x00000125 // TPM_CC_ChangePPS
 	CommandClear                      CommandCode = 0x00000126 // TPM_CC_Clear
 	CommandClearControl               CommandCode = 0x00000127 // TPM_CC_ClearControl
 	CommandClockSet                   CommandCode = 0x00000128 // TPM_CC_ClockSet
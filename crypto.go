@@ -6,11 +6,13 @@ package tpm2
 
 import (
 	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/rsa"
 	"encoding/binary"
 	"fmt"
+	"hash"
+	"io"
 	"math/big"
+	"sync"
 
 	"github.com/canonical/go-tpm2/internal"
 	"github.com/canonical/go-tpm2/mu"
@@ -30,11 +32,34 @@ func eccCurveToGoCurve(curve ECCCurve) elliptic.Curve {
 	return nil
 }
 
+// hashPools contains a *sync.Pool of hash.Hash instances for each digest algorithm in use, so that computing command and response
+// parameter digests for every command doesn't allocate new hash states.
+var hashPools sync.Map
+
+func getHash(alg HashAlgorithmId) hash.Hash {
+	p, ok := hashPools.Load(alg)
+	if !ok {
+		p, _ = hashPools.LoadOrStore(alg, &sync.Pool{New: func() interface{} { return alg.NewHash() }})
+	}
+	h := p.(*sync.Pool).Get().(hash.Hash)
+	h.Reset()
+	return h
+}
+
+func putHash(alg HashAlgorithmId, h hash.Hash) {
+	if p, ok := hashPools.Load(alg); ok {
+		p.(*sync.Pool).Put(h)
+	}
+}
+
 func cryptComputeCpHash(hashAlg HashAlgorithmId, commandCode CommandCode, commandHandles []Name,
 	cpBytes []byte) []byte {
-	hash := hashAlg.NewHash()
+	hash := getHash(hashAlg)
+	defer putHash(hashAlg, hash)
 
-	binary.Write(hash, binary.BigEndian, commandCode)
+	var scratch [4]byte
+	binary.BigEndian.PutUint32(scratch[:], uint32(commandCode))
+	hash.Write(scratch[:])
 	for _, name := range commandHandles {
 		hash.Write([]byte(name))
 	}
@@ -44,21 +69,24 @@ func cryptComputeCpHash(hashAlg HashAlgorithmId, commandCode CommandCode, comman
 }
 
 func cryptComputeRpHash(hashAlg HashAlgorithmId, responseCode ResponseCode, commandCode CommandCode, rpBytes []byte) []byte {
-	hash := hashAlg.NewHash()
+	hash := getHash(hashAlg)
+	defer putHash(hashAlg, hash)
 
-	binary.Write(hash, binary.BigEndian, responseCode)
-	binary.Write(hash, binary.BigEndian, commandCode)
+	var scratch [8]byte
+	binary.BigEndian.PutUint32(scratch[:], uint32(responseCode))
+	binary.BigEndian.PutUint32(scratch[4:], uint32(commandCode))
+	hash.Write(scratch[:])
 	hash.Write(rpBytes)
 
 	return hash.Sum(nil)
 }
 
-func cryptComputeNonce(nonce []byte) error {
-	_, err := rand.Read(nonce)
+func cryptComputeNonce(rand io.Reader, nonce []byte) error {
+	_, err := io.ReadFull(rand, nonce)
 	return err
 }
 
-func cryptEncryptRSA(public *Public, paddingOverride RSASchemeId, data, label []byte) ([]byte, error) {
+func cryptEncryptRSA(rand io.Reader, public *Public, paddingOverride RSASchemeId, data, label []byte) ([]byte, error) {
 	if public.Type != ObjectTypeRSA {
 		panic(fmt.Sprintf("Unsupported key type %v", public.Type))
 	}
@@ -89,14 +117,14 @@ func cryptEncryptRSA(public *Public, paddingOverride RSASchemeId, data, label []
 		hash := schemeHashAlg.NewHash()
 		labelCopy := make([]byte, len(label)+1)
 		copy(labelCopy, label)
-		return rsa.EncryptOAEP(hash, rand.Reader, pubKey, data, labelCopy)
+		return rsa.EncryptOAEP(hash, rand, pubKey, data, labelCopy)
 	case RSASchemeRSAES:
-		return rsa.EncryptPKCS1v15(rand.Reader, pubKey, data)
+		return rsa.EncryptPKCS1v15(rand, pubKey, data)
 	}
 	return nil, fmt.Errorf("unsupported RSA scheme: %v", padding)
 }
 
-func cryptGetECDHPoint(public *Public) (ECCParameter, *ECCPoint, error) {
+func cryptGetECDHPoint(rand io.Reader, public *Public) (ECCParameter, *ECCPoint, error) {
 	if public.Type != ObjectTypeECC {
 		panic(fmt.Sprintf("Unsupported key type %v", public.Type))
 	}
@@ -106,7 +134,7 @@ func cryptGetECDHPoint(public *Public) (ECCParameter, *ECCPoint, error) {
 		return nil, nil, fmt.Errorf("unsupported curve: %v", public.Params.ECCDetail.CurveID)
 	}
 
-	ephPriv, ephX, ephY, err := elliptic.GenerateKey(curve, rand.Reader)
+	ephPriv, ephX, ephY, err := elliptic.GenerateKey(curve, rand)
 	if err != nil {
 		return nil, nil, fmt.Errorf("cannot generate ephemeral ECC key: %v", err)
 	}
@@ -123,7 +151,7 @@ func cryptGetECDHPoint(public *Public) (ECCParameter, *ECCPoint, error) {
 	return mulX.Bytes(), &ECCPoint{X: ephX.Bytes(), Y: ephY.Bytes()}, nil
 }
 
-func cryptComputeEncryptedSalt(public *Public) (EncryptedSecret, []byte, error) {
+func cryptComputeEncryptedSalt(rand io.Reader, public *Public) (EncryptedSecret, []byte, error) {
 	if !public.NameAlg.Supported() {
 		return nil, nil, fmt.Errorf("cannot determine size of unknown nameAlg %v", public.NameAlg)
 	}
@@ -132,13 +160,13 @@ func cryptComputeEncryptedSalt(public *Public) (EncryptedSecret, []byte, error)
 	switch public.Type {
 	case ObjectTypeRSA:
 		salt := make([]byte, digestSize)
-		if _, err := rand.Read(salt); err != nil {
+		if _, err := io.ReadFull(rand, salt); err != nil {
 			return nil, nil, fmt.Errorf("cannot read random bytes for salt: %v", err)
 		}
-		encryptedSalt, err := cryptEncryptRSA(public, RSASchemeOAEP, salt, []byte("SECRET"))
+		encryptedSalt, err := cryptEncryptRSA(rand, public, RSASchemeOAEP, salt, []byte("SECRET"))
 		return encryptedSalt, salt, err
 	case ObjectTypeECC:
-		z, q, err := cryptGetECDHPoint(public)
+		z, q, err := cryptGetECDHPoint(rand, public)
 		if err != nil {
 			return nil, nil, fmt.Errorf("failed to compute secret: %v", err)
 		}
@@ -5,6 +5,9 @@
 package tpm2_test
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
 	"reflect"
 	"testing"
 
@@ -60,3 +63,44 @@ func TestCryptoSymmetricModeConversions(t *testing.T) {
 		})
 	}
 }
+
+func TestCryptComputeCpHashPooled(t *testing.T) {
+	names := []Name{{0x40, 0x00, 0x00, 0x01}}
+	cpBytes := []byte("foo")
+
+	h := sha256.New()
+	h.Write([]byte{0x00, 0x00, 0x01, 0x53})
+	h.Write(names[0])
+	h.Write(cpBytes)
+	expected := h.Sum(nil)
+
+	// Run more than once to make sure that pooled hash states are reset.
+	for i := 0; i < 3; i++ {
+		if cpHash := CryptComputeCpHash(HashAlgorithmSHA256, CommandCreate, names, cpBytes); !bytes.Equal(cpHash, expected) {
+			t.Errorf("Unexpected cpHash: %x", cpHash)
+		}
+	}
+}
+
+func TestSessionHMACReuse(t *testing.T) {
+	session := MakeMockSessionContext(0x02000000, &SessionContextData{HashAlg: HashAlgorithmSHA256}).(*TestSessionContext)
+
+	computeExpected := func(key []byte) []byte {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte("bar"))
+		return h.Sum(nil)
+	}
+
+	for _, key := range [][]byte{[]byte("1234"), []byte("1234"), []byte("5678"), nil} {
+		h := session.HMACForKey(key)
+		h.Write([]byte("bar"))
+		if d := h.Sum(nil); !bytes.Equal(d, computeExpected(key)) {
+			t.Errorf("Unexpected HMAC for key %q: %x", key, d)
+		}
+	}
+
+	h1 := session.HMACForKey([]byte("1234"))
+	if h2 := session.HMACForKey([]byte("1234")); h1 != h2 {
+		t.Errorf("HMAC state wasn't reused")
+	}
+}
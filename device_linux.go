@@ -20,8 +20,9 @@ const (
 
 // tctiDeviceLinux represents a connection to a Linux TPM character device.
 type TctiDeviceLinux struct {
-	f   *os.File
-	buf *bytes.Reader
+	f       *os.File
+	buf     *bytes.Reader
+	readBuf []byte // Reused for each response read from the device
 }
 
 func (d *TctiDeviceLinux) readMoreData() error {
@@ -35,13 +36,19 @@ func (d *TctiDeviceLinux) readMoreData() error {
 		return fmt.Errorf("invalid poll events returned: %d", fds[0].Revents)
 	}
 
-	buf := make([]byte, maxCommandSize)
-	n, err := d.f.Read(buf)
+	if d.readBuf == nil {
+		d.readBuf = make([]byte, maxCommandSize)
+	}
+	n, err := d.f.Read(d.readBuf)
 	if err != nil {
 		return xerrors.Errorf("reading from device failed: %w", err)
 	}
 
-	d.buf = bytes.NewReader(buf[:n])
+	if d.buf == nil {
+		d.buf = bytes.NewReader(d.readBuf[:n])
+	} else {
+		d.buf.Reset(d.readBuf[:n])
+	}
 	return nil
 }
 
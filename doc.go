@@ -71,7 +71,8 @@ Authorization types
 Some TPM resources require authorization in order to use them in some commands. There are 3 main types of authorization supported by
 this package:
  * Cleartext password: A cleartext authorization value is sent to the TPM by calling ResourceContext.SetAuthValue and supplying the
- ResourceContext to a function requiring authorization. Authorization succeeds if the correct value is sent.
+ ResourceContext to a function requiring authorization, along with either a nil session or the session returned from
+ PasswordSession. Authorization succeeds if the correct value is sent.
 
  * HMAC session: Knowledge of an authorization value is demonstrated by calling ResourceContext.SetAuthValue and supplying the ResourceContext
  to a function requiring authorization, along with a session with the type SessionTypeHMAC. Authorization succeeds if the computed HMAC
@@ -0,0 +1,110 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"reflect"
+	"testing"
+
+	. "github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/testutil"
+
+	. "gopkg.in/check.v1"
+)
+
+func TestIssueEKCertificate(t *testing.T) {
+	ca, err := testutil.NewTestCA()
+	if err != nil {
+		t.Fatalf("NewTestCA failed: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	rsaEK := testutil.MakeRSAEKTemplate()
+	rsaEK.Unique.RSA = rsaKey.N.Bytes()
+
+	eccKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	eccEK := testutil.MakeECCEKTemplate()
+	eccEK.Unique.ECC = &ECCPoint{X: eccKey.X.Bytes(), Y: eccKey.Y.Bytes()}
+
+	for _, data := range []struct {
+		desc string
+		ek   *Public
+		key  interface{}
+	}{
+		{desc: "RSA", ek: rsaEK, key: &rsaKey.PublicKey},
+		{desc: "ECC", ek: eccEK, key: &eccKey.PublicKey},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			der, err := ca.IssueEKCertificate(data.ek)
+			if err != nil {
+				t.Fatalf("IssueEKCertificate failed: %v", err)
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				t.Fatalf("ParseCertificate failed: %v", err)
+			}
+			if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+				t.Errorf("Verify failed: %v", err)
+			}
+			if !reflect.DeepEqual(cert.PublicKey, data.key) {
+				t.Errorf("Unexpected public key")
+			}
+		})
+	}
+}
+
+type ekCertSuite struct {
+	testutil.TPMSimulatorTest
+}
+
+var _ = Suite(&ekCertSuite{})
+
+func (s *ekCertSuite) TestInjectEKCertificates(c *C) {
+	ca, err := testutil.NewTestCA()
+	c.Assert(err, IsNil)
+	c.Assert(testutil.InjectEKCertificates(s.TPM, ca), IsNil)
+
+	for _, data := range []struct {
+		index    Handle
+		template *Public
+	}{
+		{index: testutil.RSAEKCertNVIndex, template: testutil.MakeRSAEKTemplate()},
+		{index: testutil.ECCEKCertNVIndex, template: testutil.MakeECCEKTemplate()},
+	} {
+		index, err := s.TPM.CreateResourceContextFromTPM(data.index)
+		c.Assert(err, IsNil)
+		pub, _, err := s.TPM.NVReadPublic(index)
+		c.Assert(err, IsNil)
+		der, err := s.TPM.NVRead(index, index, pub.Size, 0, nil)
+		c.Check(err, IsNil)
+
+		cert, err := x509.ParseCertificate(der)
+		c.Assert(err, IsNil)
+		c.Check(cert.CheckSignatureFrom(ca.Cert), IsNil)
+
+		ek, ekPub, _, _, _, err := s.TPM.CreatePrimary(s.TPM.EndorsementHandleContext(), nil, data.template, nil, nil, nil)
+		c.Assert(err, IsNil)
+		s.AddCleanup(func() { c.Check(s.TPM.FlushContext(ek), IsNil) })
+
+		der2, err := ca.IssueEKCertificate(ekPub)
+		c.Assert(err, IsNil)
+		cert2, err := x509.ParseCertificate(der2)
+		c.Assert(err, IsNil)
+		c.Check(cert.PublicKey, DeepEquals, cert2.PublicKey)
+	}
+}
@@ -6,7 +6,9 @@ package tpm2
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"syscall"
 
 	"golang.org/x/xerrors"
 )
@@ -36,6 +38,33 @@ const (
 	AnyWarningCode WarningCode = 0x80
 )
 
+// Sentinel errors for commonly tested conditions, for use with errors.Is (or xerrors.Is). These match errors returned from any
+// command and, where applicable, associated with any handle, parameter or session index. For example, ErrTPMAuthFail will match a
+// *TPMSessionError with an error code of ErrorAuthFail. To match more specific errors, construct a value of the appropriate type
+// and use the Any* constants defined in this package to indicate which fields should be ignored.
+var (
+	ErrTPMAuthFail         = &TPMError{Command: AnyCommandCode, Code: ErrorAuthFail}    // TPM_RC_AUTH_FAIL
+	ErrTPMBadAuth          = &TPMError{Command: AnyCommandCode, Code: ErrorBadAuth}     // TPM_RC_BAD_AUTH
+	ErrTPMPolicyFail       = &TPMError{Command: AnyCommandCode, Code: ErrorPolicyFail}  // TPM_RC_POLICY_FAIL
+	ErrTPMHandle           = &TPMError{Command: AnyCommandCode, Code: ErrorHandle}      // TPM_RC_HANDLE
+	ErrTPMNVDefined        = &TPMError{Command: AnyCommandCode, Code: ErrorNVDefined}   // TPM_RC_NV_DEFINED
+	ErrTPMNVLocked         = &TPMError{Command: AnyCommandCode, Code: ErrorNVLocked}    // TPM_RC_NV_LOCKED
+	ErrTPMLockout          = &TPMWarning{Command: AnyCommandCode, Code: WarningLockout} // TPM_RC_LOCKOUT
+	ErrTPMRetry            = &TPMWarning{Command: AnyCommandCode, Code: WarningRetry}   // TPM_RC_RETRY
+	ErrTPMNVRate           = &TPMWarning{Command: AnyCommandCode, Code: WarningNVRate}  // TPM_RC_NV_RATE
+	ErrResourceUnavailable = ResourceUnavailableError{Handle: AnyHandle}
+)
+
+// InvalidHandleTypeError is returned from functions that create a HandleContext if they are called with a handle that has a type
+// that isn't valid for the function.
+type InvalidHandleTypeError struct {
+	Handle Handle
+}
+
+func (e InvalidHandleTypeError) Error() string {
+	return fmt.Sprintf("invalid type for handle 0x%08x", e.Handle)
+}
+
 // ResourceUnavailableError is returned from TPMContext.GetOrCreateResourceContext or TPMContext.GetOrCreateSessionContext if it is
 // called with a handle that does not correspond to a resource that is available on the TPM. This could be because the resource
 // doesn't exist on the TPM, or it lives within a hierarchy that is disabled.
@@ -47,6 +76,14 @@ func (e ResourceUnavailableError) Error() string {
 	return fmt.Sprintf("a resource at handle 0x%08x is not available on the TPM", e.Handle)
 }
 
+func (e ResourceUnavailableError) Is(target error) bool {
+	t, ok := target.(ResourceUnavailableError)
+	if !ok {
+		return false
+	}
+	return t.Handle == AnyHandle || t.Handle == e.Handle
+}
+
 // InvalidResponseError is returned from any TPMContext method that executes a TPM command if the TPM's response is invalid. An
 // invalid response could be one that is shorter than the response header, one with an invalid responseSize field, a payload that is
 // shorter than the responseSize field indicates, a payload that unmarshals incorrectly because of an invalid union selector value,
@@ -60,16 +97,103 @@ func (e ResourceUnavailableError) Error() string {
 //
 // If any function that executes a command which removes objects from the TPM returns this error, it is possible that these objects
 // were removed from the TPM. Any associated HandleContexts should be considered stale after this error.
+//
+// Where the raw response is available, a copy of it (truncated to maxRecordedResponseSize bytes) is stored in the Response field so
+// that the failure can be reproduced and decoded offline.
 type InvalidResponseError struct {
-	Command CommandCode
-	msg     string
+	Command  CommandCode
+	Response []byte // The raw response packet, including the header
+	msg      string
 }
 
 func (e *InvalidResponseError) Error() string {
 	return fmt.Sprintf("TPM returned an invalid response for command %s: %v", e.Command, e.msg)
 }
 
-// TctiError is returned from any TPMContext method if the underlying TCTI returns an error.
+// SessionDesynchronizedError is returned from any TPMContext method that executes a TPM command if one of the supplied sessions was
+// used in an earlier command for which a valid response was not received, such as when the transmission interface returned an
+// error or the response was malformed. In this case, the TPM may have executed the command and generated a new nonce for the session
+// that the host doesn't know, and any further attempt to compute a HMAC for the session would fail. The session can be replaced with
+// TPMContext.RefreshSession.
+type SessionDesynchronizedError struct {
+	Handle Handle
+}
+
+func (e *SessionDesynchronizedError) Error() string {
+	return fmt.Sprintf("session 0x%08x is out of sync with the TPM because a valid response to an earlier command that used it "+
+		"was not received", e.Handle)
+}
+
+// PasswordAuthorizationError is returned from any TPMContext method that executes a TPM command if the command would be supplied
+// with a password authorization for the resource with the specified handle, and password authorizations have been disabled with
+// TPMContext.SetRejectPasswordAuthorizations.
+type PasswordAuthorizationError struct {
+	Command CommandCode
+	Handle  Handle
+}
+
+func (e *PasswordAuthorizationError) Error() string {
+	return fmt.Sprintf("cannot use password authorization for handle 0x%08x with command %s: password authorizations are disabled",
+		e.Handle, e.Command)
+}
+
+// AuditDigestError is returned from AuditVerifier.Verify if the audit digest reported by the TPM doesn't match the digest computed
+// from the commands that the AuditVerifier recorded.
+type AuditDigestError struct {
+	Expected Digest // The audit digest computed by the AuditVerifier
+	Digest   Digest // The audit digest reported by the TPM
+}
+
+func (e *AuditDigestError) Error() string {
+	return fmt.Sprintf("unexpected session audit digest (got %x, expected %x)", e.Digest, e.Expected)
+}
+
+// AuditExclusivityError is returned from AuditVerifier.Verify if exclusivity is required and the TPM reports that the audit session
+// is not exclusive. Index is the index of the first record returned from AuditVerifier.Records for which the TPM reported that the
+// session was not exclusive, and Command is the command code for that record. If exclusivity was lost after the last recorded
+// command, Index is equal to the number of records and Command is zero.
+//
+// Interrupter is the command code of the first command executed via the same TPMContext that didn't use the audit session before
+// the point at which exclusivity was lost. It is zero if no such command was executed, in which case the interrupting command was
+// executed by another user of the TPM.
+type AuditExclusivityError struct {
+	Index       int
+	Command     CommandCode
+	Interrupter CommandCode
+}
+
+func (e *AuditExclusivityError) Error() string {
+	var at string
+	if e.Command == 0 {
+		at = "after the last audited command"
+	} else {
+		at = fmt.Sprintf("before audited command %d (%s)", e.Index, e.Command)
+	}
+	if e.Interrupter == 0 {
+		return fmt.Sprintf("audit session lost exclusivity %s because of a command executed by another user of the TPM", at)
+	}
+	return fmt.Sprintf("audit session lost exclusivity %s because of command %s", at, e.Interrupter)
+}
+
+// CapturedCommandError wraps an error returned from a TPMContext method when capturing of command packets has been enabled with
+// TPMContext.SetCaptureCommandOnError. The underlying error can be obtained with xerrors.Unwrap or inspected with xerrors.Is and
+// xerrors.As.
+type CapturedCommandError struct {
+	Packet []byte // The serialized command packet, with cleartext authorization values redacted
+	err    error
+}
+
+func (e *CapturedCommandError) Error() string {
+	return e.err.Error()
+}
+
+func (e *CapturedCommandError) Unwrap() error {
+	return e.err
+}
+
+// TctiError is returned from any TPMContext method if the underlying TCTI returns an error. The original error is preserved and can
+// be inspected with xerrors.Is or xerrors.As - for example, xerrors.Is(err, os.ErrPermission) or xerrors.Is(err, syscall.ENODEV)
+// will work for errors returned from the Linux character device.
 type TctiError struct {
 	Op  string // The operation that caused the error
 	err error
@@ -83,6 +207,25 @@ func (e *TctiError) Unwrap() error {
 	return e.err
 }
 
+// Timeout indicates whether the underlying error is a timeout, such as a net.Error returned from the simulator connection or
+// a syscall.Errno that indicates a timeout.
+func (e *TctiError) Timeout() bool {
+	var t interface{ Timeout() bool }
+	return xerrors.As(e.err, &t) && t.Timeout()
+}
+
+// Temporary indicates whether the underlying error is temporary, and the operation may succeed if it is retried.
+func (e *TctiError) Temporary() bool {
+	var t interface{ Temporary() bool }
+	return xerrors.As(e.err, &t) && t.Temporary()
+}
+
+// Errno returns the system error number associated with the underlying error, if there is one.
+func (e *TctiError) Errno() (errno syscall.Errno, ok bool) {
+	ok = xerrors.As(e.err, &errno)
+	return
+}
+
 // TPM1Error is returned from DecodeResponseCode and any TPMContext method that executes a command on the TPM if the TPM response code
 // indicates an error from a TPM 1.2 device.
 type TPM1Error struct {
@@ -91,18 +234,85 @@ type TPM1Error struct {
 }
 
 func (e *TPM1Error) Error() string {
-	return fmt.Sprintf("TPM returned a 1.2 error whilst executing command %s: 0x%08x", e.Command, e.Code)
+	var builder bytes.Buffer
+	fmt.Fprintf(&builder, "TPM returned a 1.2 error whilst executing command %s: 0x%08x", e.Command, e.Code)
+	if desc, hasDesc := tpm1ErrorCodeDescriptions[e.Code]; hasDesc {
+		fmt.Fprintf(&builder, " (%s)", desc)
+	}
+	return builder.String()
 }
 
 // TPMVendorError is returned from DecodeResponseCode and and TPMContext method that executes a command on the TPM if the TPM response
 // code indicates a vendor-specific error.
+//
+// If a VendorErrorDecoder has been registered for the manufacturer of the TPM with RegisterVendorErrorDecoder, and the manufacturer
+// has already been obtained with TPMContext.InitProperties, TPMContext.GetManufacturer or TPMContext.GetVendorInfo, errors returned
+// from TPMContext methods will have the Manufacturer, VendorCode and Description fields populated where the decoder recognizes the
+// response code. Errors that aren't decoded because the manufacturer isn't known can be decoded with DecodeVendorError.
 type TPMVendorError struct {
 	Command CommandCode  // Command code associated with this error
 	Code    ResponseCode // Response code
+
+	Manufacturer TPMManufacturer // Manufacturer of the TPM, if the error was decoded by a VendorErrorDecoder
+	VendorCode   interface{}     // Vendor-specific representation of the response code returned from a VendorErrorDecoder
+	Description  string          // Description of the error returned from a VendorErrorDecoder
 }
 
 func (e *TPMVendorError) Error() string {
-	return fmt.Sprintf("TPM returned a vendor defined error whilst executing command %s: 0x%08x", e.Command, e.Code)
+	var builder bytes.Buffer
+	fmt.Fprintf(&builder, "TPM returned a vendor defined error whilst executing command %s: 0x%08x", e.Command, e.Code)
+	if e.Description != "" {
+		fmt.Fprintf(&builder, " (%s)", e.Description)
+	}
+	return builder.String()
+}
+
+// VendorErrorDecoder decodes a vendor-specific response code from a TPM. If the code is recognized, it returns a vendor-specific
+// representation of it along with a human-readable description. If the code is not recognized, ok will be false.
+type VendorErrorDecoder func(code ResponseCode) (vendorCode interface{}, description string, ok bool)
+
+// VendorErrorTable is a simple table of descriptions for vendor-specific response codes. Its Decode method can be registered with
+// RegisterVendorErrorDecoder.
+type VendorErrorTable map[ResponseCode]string
+
+// Decode implements VendorErrorDecoder. The vendor-specific representation of a recognized code is the ResponseCode itself.
+func (t VendorErrorTable) Decode(code ResponseCode) (vendorCode interface{}, description string, ok bool) {
+	description, ok = t[code]
+	if !ok {
+		return nil, "", false
+	}
+	return code, description, true
+}
+
+var vendorErrorDecoders = make(map[TPMManufacturer]VendorErrorDecoder)
+
+// RegisterVendorErrorDecoder registers a decoder for vendor-specific response codes returned from TPMs made by the specified
+// manufacturer, replacing any previously registered decoder for that manufacturer. Passing a nil decoder removes the registration.
+// This isn't safe to call concurrently with the execution of commands, and should normally be called from an init function.
+func RegisterVendorErrorDecoder(manufacturer TPMManufacturer, decoder VendorErrorDecoder) {
+	if decoder == nil {
+		delete(vendorErrorDecoders, manufacturer)
+		return
+	}
+	vendorErrorDecoders[manufacturer] = decoder
+}
+
+// DecodeVendorError populates the Manufacturer, VendorCode and Description fields of the supplied error using the decoder
+// registered for the specified manufacturer. It returns false if there is no decoder registered for the manufacturer, or the
+// decoder does not recognize the response code.
+func DecodeVendorError(manufacturer TPMManufacturer, err *TPMVendorError) bool {
+	decoder, ok := vendorErrorDecoders[manufacturer]
+	if !ok {
+		return false
+	}
+	vendorCode, description, ok := decoder(err.Code)
+	if !ok {
+		return false
+	}
+	err.Manufacturer = manufacturer
+	err.VendorCode = vendorCode
+	err.Description = description
+	return true
 }
 
 // WarningCode represents a response from the TPM that is not necessarily an error.
@@ -113,6 +323,10 @@ type WarningCode ResponseCode
 type TPMWarning struct {
 	Command CommandCode // Command code associated with this error
 	Code    WarningCode // Warning code
+
+	// ResponseCode is the response code returned from the TPM. As responses that indicate an error consist of only a response
+	// header with a tag of TagNoSessions, this is enough to reconstruct the entire response.
+	ResponseCode ResponseCode
 }
 
 func (e *TPMWarning) Error() string {
@@ -124,6 +338,14 @@ func (e *TPMWarning) Error() string {
 	return builder.String()
 }
 
+func (e *TPMWarning) Is(target error) bool {
+	t, ok := target.(*TPMWarning)
+	if !ok {
+		return false
+	}
+	return (t.Code == AnyWarningCode || t.Code == e.Code) && (t.Command == AnyCommandCode || t.Command == e.Command)
+}
+
 // ErrorCode represents an error code from the TPM.
 type ErrorCode ResponseCode
 
@@ -132,6 +354,11 @@ type ErrorCode ResponseCode
 type TPMError struct {
 	Command CommandCode // Command code associated with this error
 	Code    ErrorCode   // Error code
+
+	// ResponseCode is the response code returned from the TPM, which includes any handle, parameter or session index associated
+	// with this error. As responses that indicate an error consist of only a response header with a tag of TagNoSessions, this is
+	// enough to reconstruct the entire response.
+	ResponseCode ResponseCode
 }
 
 func (e *TPMError) Error() string {
@@ -143,6 +370,14 @@ func (e *TPMError) Error() string {
 	return builder.String()
 }
 
+func (e *TPMError) Is(target error) bool {
+	t, ok := target.(*TPMError)
+	if !ok {
+		return false
+	}
+	return (t.Code == AnyErrorCode || t.Code == e.Code) && (t.Command == AnyCommandCode || t.Command == e.Command)
+}
+
 // TPMParameterError is returned from DecodeResponseCode and any TPMContext method that executes a command on the TPM if the TPM
 // response code indicates an error that is associated with a command parameter. It wraps a *TPMError.
 type TPMParameterError struct {
@@ -163,16 +398,33 @@ func (e *TPMParameterError) Unwrap() error {
 	return e.TPMError
 }
 
+func (e *TPMParameterError) Is(target error) bool {
+	t, ok := target.(*TPMParameterError)
+	if !ok || t.TPMError == nil || e.TPMError == nil {
+		return false
+	}
+	return e.TPMError.Is(t.TPMError) && (t.Index == AnyParameterIndex || t.Index == e.Index)
+}
+
 // TPMSessionError is returned from DecodeResponseCode and any TPMContext method that executes a command on the TPM if the TPM
 // response code indicates an error that is associated with a session. It wraps a *TPMError.
 type TPMSessionError struct {
 	*TPMError
 	Index int // Index of the session associated with this error in the authorization area, starting from 1
+
+	// Handle and Name identify the session associated with this error, if it is known. Name will be empty if the session is not
+	// known, such as when this error is returned from DecodeResponseCode. A password session has a Handle of HandlePW.
+	Handle Handle
+	Name   Name
 }
 
 func (e *TPMSessionError) Error() string {
 	var builder bytes.Buffer
-	fmt.Fprintf(&builder, "TPM returned an error for session %d whilst executing command %s: %s", e.Index, e.Command, e.Code)
+	fmt.Fprintf(&builder, "TPM returned an error for session %d", e.Index)
+	if len(e.Name) > 0 {
+		fmt.Fprintf(&builder, " (0x%08x)", e.Handle)
+	}
+	fmt.Fprintf(&builder, " whilst executing command %s: %s", e.Command, e.Code)
 	if desc, hasDesc := errorCodeDescriptions[e.Code]; hasDesc {
 		fmt.Fprintf(&builder, " (%s)", desc)
 	}
@@ -183,6 +435,14 @@ func (e *TPMSessionError) Unwrap() error {
 	return e.TPMError
 }
 
+func (e *TPMSessionError) Is(target error) bool {
+	t, ok := target.(*TPMSessionError)
+	if !ok || t.TPMError == nil || e.TPMError == nil {
+		return false
+	}
+	return e.TPMError.Is(t.TPMError) && (t.Index == AnySessionIndex || t.Index == e.Index)
+}
+
 // TPMHandleError is returned from DecodeResponseCode and any TPMContext method that executes a command on the TPM if the TPM
 // response code indicates an error that is associated with a command handle. It wraps a *TPMError.
 type TPMHandleError struct {
@@ -190,11 +450,20 @@ type TPMHandleError struct {
 	// Index is the index of the handle associated with this error in the command handle area, starting from 1. An index of 0 corresponds
 	// to an unspecified handle
 	Index int
+
+	// Handle and Name identify the resource associated with this error, if it is known. Name will be empty if the resource is not
+	// known, such as when this error is returned from DecodeResponseCode.
+	Handle Handle
+	Name   Name
 }
 
 func (e *TPMHandleError) Error() string {
 	var builder bytes.Buffer
-	fmt.Fprintf(&builder, "TPM returned an error for handle %d whilst executing command %s: %s", e.Index, e.Command, e.Code)
+	fmt.Fprintf(&builder, "TPM returned an error for handle %d", e.Index)
+	if len(e.Name) > 0 {
+		fmt.Fprintf(&builder, " (0x%08x)", e.Handle)
+	}
+	fmt.Fprintf(&builder, " whilst executing command %s: %s", e.Command, e.Code)
 	if desc, hasDesc := errorCodeDescriptions[e.Code]; hasDesc {
 		fmt.Fprintf(&builder, " (%s)", desc)
 	}
@@ -205,6 +474,14 @@ func (e *TPMHandleError) Unwrap() error {
 	return e.TPMError
 }
 
+func (e *TPMHandleError) Is(target error) bool {
+	t, ok := target.(*TPMHandleError)
+	if !ok || t.TPMError == nil || e.TPMError == nil {
+		return false
+	}
+	return e.TPMError.Is(t.TPMError) && (t.Index == AnyHandleIndex || t.Index == e.Index)
+}
+
 func AsResourceUnavailableError(err error, handle Handle, out *ResourceUnavailableError) bool {
 	return xerrors.As(err, out) && (handle == AnyHandle || (*out).Handle == handle)
 }
@@ -289,6 +566,184 @@ func IsTPMWarning(err error, code WarningCode, command CommandCode) bool {
 	return AsTPMWarning(err, code, command, &e)
 }
 
+// TPMFailureModeError is returned from TPMContext methods that execute commands if the TPM responds with TPM_RC_FAILURE, which
+// indicates that it is in failure mode. The underlying *TPMError can be obtained with xerrors.As.
+type TPMFailureModeError struct {
+	Command  CommandCode // Command code associated with this error
+	Guidance string      // Advice on how to handle this error
+	err      *TPMError
+}
+
+func (e *TPMFailureModeError) Error() string {
+	return fmt.Sprintf("TPM is in failure mode whilst executing command %s", e.Command)
+}
+
+func (e *TPMFailureModeError) Unwrap() error {
+	return e.err
+}
+
+// TPM12DeviceError is returned from TPMContext methods that execute commands if the TPM responds with a TPM 1.2 response code,
+// which indicates that the device is not a TPM 2.0 device. The underlying *TPM1Error can be obtained with xerrors.As.
+type TPM12DeviceError struct {
+	Command  CommandCode // Command code associated with this error
+	Guidance string      // Advice on how to handle this error
+	err      *TPM1Error
+}
+
+func (e *TPM12DeviceError) Error() string {
+	return fmt.Sprintf("TPM 1.2 device detected whilst executing command %s: %v", e.Command, e.err)
+}
+
+func (e *TPM12DeviceError) Unwrap() error {
+	return e.err
+}
+
+// HierarchyDisabledError is returned from TPMContext methods that execute commands if the TPM responds with TPM_RC_HIERARCHY for a
+// command handle, which indicates that the handle references a hierarchy that is disabled or an object that lives within a disabled
+// hierarchy. If the handle corresponds to the platform hierarchy, *PlatformHierarchyUnavailableError is returned instead. The
+// underlying *TPMHandleError can be obtained with xerrors.As.
+//
+// If the hierarchy was disabled with TPMContext.HierarchyControl using the same TPMContext, and the handle corresponds to that
+// hierarchy or to a transient object that was created or loaded in it with the same TPMContext, Hierarchy identifies the
+// hierarchy. Otherwise, it is zero.
+type HierarchyDisabledError struct {
+	Command   CommandCode // Command code associated with this error
+	Handle    Handle      // The command handle associated with this error
+	Hierarchy Handle      // The hierarchy that is known to be disabled, if any
+	Guidance  string      // Advice on how to handle this error
+	err       *TPMHandleError
+}
+
+func (e *HierarchyDisabledError) Error() string {
+	if e.Hierarchy != 0 {
+		return fmt.Sprintf("the hierarchy associated with handle 0x%08x (%v) was disabled with TPM2_HierarchyControl whilst executing "+
+			"command %s", e.Handle, e.Hierarchy, e.Command)
+	}
+	return fmt.Sprintf("the hierarchy associated with handle 0x%08x is disabled whilst executing command %s", e.Handle, e.Command)
+}
+
+func (e *HierarchyDisabledError) Unwrap() error {
+	return e.err
+}
+
+// PlatformHierarchyUnavailableError is returned from TPMContext methods that execute commands if the TPM responds with
+// TPM_RC_HIERARCHY for the platform hierarchy handle, which indicates that the platform hierarchy has been disabled. The underlying
+// *TPMHandleError can be obtained with xerrors.As.
+type PlatformHierarchyUnavailableError struct {
+	Command  CommandCode // Command code associated with this error
+	Guidance string      // Advice on how to handle this error
+	err      *TPMHandleError
+}
+
+func (e *PlatformHierarchyUnavailableError) Error() string {
+	return fmt.Sprintf("the platform hierarchy is unavailable whilst executing command %s", e.Command)
+}
+
+func (e *PlatformHierarchyUnavailableError) Unwrap() error {
+	return e.err
+}
+
+// makeTypedFailureError converts errors decoded from a response code that correspond to specific failure conditions in to one of
+// the typed errors for these conditions. Other errors are returned unchanged.
+func makeTypedFailureError(err error) error {
+	switch e := err.(type) {
+	case *TPMError:
+		if e.Code == ErrorFailure {
+			return &TPMFailureModeError{
+				Command: e.Command,
+				Guidance: "The TPM will only execute TPM2_GetTestResult and TPM2_GetCapability. Diagnostic information can be " +
+					"obtained with TPMContext.GetTestResult, and the TPM must be reset to leave failure mode.",
+				err: e}
+		}
+	case *TPM1Error:
+		return &TPM12DeviceError{
+			Command:  e.Command,
+			Guidance: "TPM 1.2 devices are not supported. The TPM may support TPM 2.0 if it is reconfigured in the platform firmware.",
+			err:      e}
+	case *TPMHandleError:
+		if e.TPMError == nil || e.Code != ErrorHierarchy {
+			break
+		}
+		if e.Handle == HandlePlatform || e.Handle == HandlePlatformNV {
+			return &PlatformHierarchyUnavailableError{
+				Command: e.Command,
+				Guidance: "The platform hierarchy is normally disabled by the platform firmware before the operating system is " +
+					"started, and can only be re-enabled by a TPM reset.",
+				err: e}
+		}
+		return &HierarchyDisabledError{
+			Command: e.Command,
+			Handle:  e.Handle,
+			Guidance: "A disabled storage or endorsement hierarchy can be re-enabled with TPMContext.HierarchyControl using the " +
+				"platform hierarchy, or by restarting the TPM.",
+			err: e}
+	}
+	return err
+}
+
+// RetryClass describes whether and how a command that failed with a particular error can be retried.
+type RetryClass int
+
+const (
+	// NotRetryable indicates that an error is not a transient condition, and resubmitting the command without changes will fail
+	// again.
+	NotRetryable RetryClass = iota
+
+	// RetryImmediately indicates that the TPM was not able to start or complete the command because of a transient condition
+	// (TPM_RC_RETRY, TPM_RC_YIELDED or TPM_RC_TESTING), and the command can be resubmitted straight away.
+	RetryImmediately
+
+	// RetryAfterDelay indicates that the TPM is temporarily refusing the command in order to protect its NV memory
+	// (TPM_RC_NV_RATE), and the command should be resubmitted after waiting.
+	RetryAfterDelay
+
+	// RetryAfterRecovery indicates that the TPM has run out of a resource (TPM_RC_MEMORY, TPM_RC_OBJECT_MEMORY,
+	// TPM_RC_SESSION_MEMORY or TPM_RC_CONTEXT_GAP). The command can succeed if it is resubmitted after the caller frees resources,
+	// for example by flushing or saving objects and sessions.
+	RetryAfterRecovery
+)
+
+// ClassifyRetry returns the RetryClass of the supplied error, based on the first *TPMWarning in its chain.
+func ClassifyRetry(err error) RetryClass {
+	var e *TPMWarning
+	if !xerrors.As(err, &e) {
+		return NotRetryable
+	}
+	switch e.Code {
+	case WarningRetry, WarningYielded, WarningTesting:
+		return RetryImmediately
+	case WarningNVRate:
+		return RetryAfterDelay
+	case WarningMemory, WarningObjectMemory, WarningSessionMemory, WarningContextGap:
+		return RetryAfterRecovery
+	default:
+		return NotRetryable
+	}
+}
+
+// IsRetryableError indicates whether the error or any error within its chain indicates a transient condition, such that the command
+// may succeed if it is resubmitted. Use ClassifyRetry to determine whether the caller needs to wait or free resources before
+// resubmitting the command.
+func IsRetryableError(err error) bool {
+	return ClassifyRetry(err) != NotRetryable
+}
+
+// RetryPolicy is used by TPMContext to decide whether a command that failed with the supplied error should be resubmitted
+// automatically. The number of submissions is always limited by TPMContext.SetMaxSubmissions.
+type RetryPolicy func(err error) bool
+
+// DefaultRetryPolicy is the RetryPolicy used by TPMContext unless one is set with TPMContext.SetRetryPolicy. It resubmits commands
+// that fail with an error in the RetryImmediately class.
+func DefaultRetryPolicy(err error) bool {
+	return ClassifyRetry(err) == RetryImmediately
+}
+
+// isTPMNotReadyError indicates whether the supplied error is a warning that the TPM cannot currently execute commands because it
+// is still performing self tests or NV memory is unavailable.
+func isTPMNotReadyError(err error) bool {
+	return IsTPMWarning(err, WarningTesting, AnyCommandCode) || IsTPMWarning(err, WarningNVUnavailable, AnyCommandCode)
+}
+
 const (
 	formatMask ResponseCode = 1 << 7 // Bit 7 indicates whether the error is a format-zero or format-one code
 
@@ -321,25 +776,132 @@ func DecodeResponseCode(command CommandCode, resp ResponseCode) error {
 		case resp&fmt0VersionMask == 0:
 			return &TPM1Error{command, resp}
 		case resp&fmt0VendorMask > 0:
-			return &TPMVendorError{command, resp}
+			return &TPMVendorError{Command: command, Code: resp}
 		case resp&fmt0SeverityMask > 0:
-			return &TPMWarning{command, WarningCode(resp & fmt0ErrorCodeMask)}
+			return &TPMWarning{command, WarningCode(resp & fmt0ErrorCodeMask), resp}
 		default:
-			return &TPMError{command, ErrorCode(resp & fmt0ErrorCodeMask)}
+			return &TPMError{command, ErrorCode(resp & fmt0ErrorCodeMask), resp}
 		}
 	default:
 		// Format 1 error codes
-		err := &TPMError{command, ErrorCode(resp&fmt1ErrorCodeMask) + errorCode1Start}
+		err := &TPMError{command, ErrorCode(resp&fmt1ErrorCodeMask) + errorCode1Start, resp}
 		switch {
 		case resp&fmt1ParameterMask > 0:
 			return &TPMParameterError{err, int((resp & fmt1ParameterIndexMask) >> fmt1IndexShift)}
 		case resp&fmt1SessionMask > 0:
-			return &TPMSessionError{err, int((resp & fmt1HandleOrSessionIndexMask) >> fmt1IndexShift)}
+			return &TPMSessionError{TPMError: err, Index: int((resp & fmt1HandleOrSessionIndexMask) >> fmt1IndexShift)}
 		case resp&fmt1HandleOrSessionIndexMask > 0:
-			return &TPMHandleError{err, int((resp & fmt1HandleOrSessionIndexMask) >> fmt1IndexShift)}
+			return &TPMHandleError{TPMError: err, Index: int((resp & fmt1HandleOrSessionIndexMask) >> fmt1IndexShift)}
 		default:
 			return err
 		}
 
 	}
 }
+
+func encodeTPMError(e *TPMError) (ResponseCode, error) {
+	switch {
+	case e == nil:
+		return 0, errors.New("nil error")
+	case e.Code < errorCode1Start:
+		return fmt0VersionMask | ResponseCode(e.Code), nil
+	case e.Code-errorCode1Start <= ErrorCode(fmt1ErrorCodeMask):
+		return formatMask | ResponseCode(e.Code-errorCode1Start), nil
+	default:
+		return 0, fmt.Errorf("invalid error code: 0x%x", uint32(e.Code))
+	}
+}
+
+func encodeTPMFmt1Error(e *TPMError, index, maxIndex int) (ResponseCode, error) {
+	if e != nil && e.Code < errorCode1Start {
+		return 0, fmt.Errorf("error code %s cannot be associated with a handle, parameter or session", e.Code)
+	}
+	if index < 1 || index > maxIndex {
+		return 0, fmt.Errorf("invalid index %d", index)
+	}
+	rc, err := encodeTPMError(e)
+	if err != nil {
+		return 0, err
+	}
+	return rc | (ResponseCode(index) << fmt1IndexShift), nil
+}
+
+// EncodeResponseCode is the inverse of DecodeResponseCode. It returns the ResponseCode that the TPM would return for the supplied
+// error, which must be nil (in which case Success is returned) or one of *TPMError, *TPMWarning, *TPMHandleError,
+// *TPMParameterError, *TPMSessionError, *TPM1Error or *TPMVendorError. This is useful for implementations of TPM emulators, proxies
+// and test doubles.
+//
+// An error will be returned if err is of any other type, or if the code or index cannot be represented in a response code. Only
+// format-one error codes (those associated with ErrorAsymmetric and higher) can be associated with a handle, parameter or session.
+func EncodeResponseCode(err error) (ResponseCode, error) {
+	switch e := err.(type) {
+	case nil:
+		return Success, nil
+	case *TPM1Error:
+		if e.Code&formatMask != 0 || e.Code&fmt0VersionMask != 0 || e.Code == Success {
+			return 0, fmt.Errorf("invalid TPM1.2 response code: 0x%08x", e.Code)
+		}
+		return e.Code, nil
+	case *TPMVendorError:
+		if e.Code&formatMask != 0 || e.Code&fmt0VersionMask == 0 || e.Code&fmt0VendorMask == 0 {
+			return 0, fmt.Errorf("invalid vendor response code: 0x%08x", e.Code)
+		}
+		return e.Code, nil
+	case *TPMWarning:
+		if ResponseCode(e.Code) > fmt0ErrorCodeMask {
+			return 0, fmt.Errorf("invalid warning code: 0x%x", uint32(e.Code))
+		}
+		return fmt0VersionMask | fmt0SeverityMask | ResponseCode(e.Code), nil
+	case *TPMError:
+		return encodeTPMError(e)
+	case *TPMParameterError:
+		rc, err := encodeTPMFmt1Error(e.TPMError, e.Index, int(fmt1ParameterIndexMask>>fmt1IndexShift))
+		if err != nil {
+			return 0, err
+		}
+		return rc | fmt1ParameterMask, nil
+	case *TPMSessionError:
+		rc, err := encodeTPMFmt1Error(e.TPMError, e.Index, int(fmt1HandleOrSessionIndexMask>>fmt1IndexShift))
+		if err != nil {
+			return 0, err
+		}
+		return rc | fmt1SessionMask, nil
+	case *TPMHandleError:
+		if e.Index == 0 {
+			// An unspecified handle is encoded the same way as an error that isn't associated with a handle.
+			if e.TPMError != nil && e.TPMError.Code < errorCode1Start {
+				return 0, fmt.Errorf("error code %s cannot be associated with a handle, parameter or session", e.Code)
+			}
+			return encodeTPMError(e.TPMError)
+		}
+		return encodeTPMFmt1Error(e.TPMError, e.Index, int(fmt1HandleOrSessionIndexMask>>fmt1IndexShift))
+	default:
+		return 0, fmt.Errorf("unsupported error type %T", err)
+	}
+}
+
+// LookupResponseCodeDescription returns a human readable description of the supplied response code, for use by tooling that
+// needs to display TPM response codes. This works for TPM 2.0 error and warning codes, and the common TPM 1.2 response codes.
+// The handle, parameter or session index of format-one error codes is ignored. If there is no description for the response code,
+// including for vendor defined response codes, false is returned.
+func LookupResponseCodeDescription(rc ResponseCode) (string, bool) {
+	var desc string
+	var ok bool
+	switch e := DecodeResponseCode(0, rc).(type) {
+	case nil:
+		desc, ok = "success", true
+	case *TPM1Error:
+		desc, ok = tpm1ErrorCodeDescriptions[e.Code]
+	case *TPMWarning:
+		desc, ok = warningCodeDescriptions[e.Code]
+	case *TPMError:
+		desc, ok = errorCodeDescriptions[e.Code]
+	case *TPMParameterError:
+		desc, ok = errorCodeDescriptions[e.Code]
+	case *TPMSessionError:
+		desc, ok = errorCodeDescriptions[e.Code]
+	case *TPMHandleError:
+		desc, ok = errorCodeDescriptions[e.Code]
+	}
+	return desc, ok
+}
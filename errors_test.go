@@ -5,9 +5,15 @@
 package tpm2_test
 
 import (
+	"errors"
+	"os"
+	"syscall"
 	"testing"
 
 	. "github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/testutil"
+
+	"golang.org/x/xerrors"
 )
 
 func TestDecodeResponse(t *testing.T) {
@@ -60,3 +66,282 @@ func TestDecodeResponse(t *testing.T) {
 		t.Errorf("Unexpected error: %v", err)
 	}
 }
+
+func TestErrorsIs(t *testing.T) {
+	for _, data := range []struct {
+		desc   string
+		err    error
+		target error
+		match  bool
+	}{
+		{
+			desc:   "SessionAuthFail",
+			err:    DecodeResponseCode(CommandUnseal, ResponseCode(0x0000098e)),
+			target: ErrTPMAuthFail,
+			match:  true,
+		},
+		{
+			desc:   "SessionBadAuth",
+			err:    DecodeResponseCode(CommandUnseal, ResponseCode(0x000009a2)),
+			target: ErrTPMAuthFail,
+		},
+		{
+			desc:   "Lockout",
+			err:    xerrors.Errorf("cannot unseal: %w", DecodeResponseCode(CommandUnseal, ResponseCode(0x00000921))),
+			target: ErrTPMLockout,
+			match:  true,
+		},
+		{
+			desc:   "WarningIsNotError",
+			err:    DecodeResponseCode(CommandUnseal, ResponseCode(0x00000921)),
+			target: ErrTPMAuthFail,
+		},
+		{
+			desc:   "SpecificCommand",
+			err:    DecodeResponseCode(CommandNVDefineSpace, ResponseCode(0x0000014c)),
+			target: &TPMError{Command: CommandNVDefineSpace, Code: ErrorNVDefined},
+			match:  true,
+		},
+		{
+			desc:   "WrongCommand",
+			err:    DecodeResponseCode(CommandNVDefineSpace, ResponseCode(0x0000014c)),
+			target: &TPMError{Command: CommandNVWrite, Code: ErrorNVDefined},
+		},
+		{
+			desc:   "ParameterIndex",
+			err:    DecodeResponseCode(CommandClear, ResponseCode(0x000005e7)),
+			target: &TPMParameterError{TPMError: &TPMError{Command: AnyCommandCode, Code: ErrorECCPoint}, Index: 5},
+			match:  true,
+		},
+		{
+			desc:   "WrongParameterIndex",
+			err:    DecodeResponseCode(CommandClear, ResponseCode(0x000005e7)),
+			target: &TPMParameterError{TPMError: &TPMError{Command: AnyCommandCode, Code: ErrorECCPoint}, Index: 4},
+		},
+		{
+			desc:   "AnyHandleIndex",
+			err:    DecodeResponseCode(CommandUnseal, ResponseCode(0x0000018b)),
+			target: &TPMHandleError{TPMError: &TPMError{Command: CommandUnseal, Code: AnyErrorCode}, Index: AnyHandleIndex},
+			match:  true,
+		},
+		{
+			desc:   "ResourceUnavailable",
+			err:    xerrors.Errorf("cannot create context: %w", ResourceUnavailableError{Handle: 0x81000001}),
+			target: ErrResourceUnavailable,
+			match:  true,
+		},
+		{
+			desc:   "ResourceUnavailableWrongHandle",
+			err:    ResourceUnavailableError{Handle: 0x81000001},
+			target: ResourceUnavailableError{Handle: 0x81000002},
+		},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			if xerrors.Is(data.err, data.target) != data.match {
+				t.Errorf("Unexpected result for %v", data.err)
+			}
+		})
+	}
+}
+
+func TestClassifyRetry(t *testing.T) {
+	for _, data := range []struct {
+		desc     string
+		err      error
+		expected RetryClass
+	}{
+		{desc: "Retry", err: DecodeResponseCode(CommandLoad, ResponseCode(0x922)), expected: RetryImmediately},
+		{desc: "Yielded", err: DecodeResponseCode(CommandLoad, ResponseCode(0x908)), expected: RetryImmediately},
+		{desc: "Testing", err: DecodeResponseCode(CommandLoad, ResponseCode(0x90a)), expected: RetryImmediately},
+		{desc: "NVRate", err: DecodeResponseCode(CommandNVWrite, ResponseCode(0x920)), expected: RetryAfterDelay},
+		{desc: "Memory", err: DecodeResponseCode(CommandLoad, ResponseCode(0x904)), expected: RetryAfterRecovery},
+		{desc: "ObjectMemory", err: DecodeResponseCode(CommandLoad, ResponseCode(0x902)), expected: RetryAfterRecovery},
+		{desc: "ContextGap", err: DecodeResponseCode(CommandStartAuthSession, ResponseCode(0x901)), expected: RetryAfterRecovery},
+		{desc: "Wrapped", err: xerrors.Errorf("cannot load: %w", DecodeResponseCode(CommandLoad, ResponseCode(0x922))), expected: RetryImmediately},
+		{desc: "Lockout", err: DecodeResponseCode(CommandUnseal, ResponseCode(0x921)), expected: NotRetryable},
+		{desc: "Error", err: DecodeResponseCode(CommandLoad, ResponseCode(0x98e)), expected: NotRetryable},
+		{desc: "Nil", expected: NotRetryable},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			if c := ClassifyRetry(data.err); c != data.expected {
+				t.Errorf("Unexpected class %d", c)
+			}
+			if IsRetryableError(data.err) != (data.expected != NotRetryable) {
+				t.Errorf("Unexpected IsRetryableError result")
+			}
+		})
+	}
+}
+
+func TestEncodeResponseCode(t *testing.T) {
+	for _, rc := range []ResponseCode{
+		Success,
+		0x00000155, // TPM_RC_SENSITIVE
+		0x00000923, // TPM_RC_NV_UNAVAILABLE
+		0x000005e7, // TPM_RC_ECC_POINT + TPM_RC_P + TPM_RC_5
+		0x00000f84, // TPM_RC_VALUE + TPM_RC_P + TPM_RC_F
+		0x0000098e, // TPM_RC_AUTH_FAIL + TPM_RC_S + TPM_RC_1
+		0x0000028b, // TPM_RC_HANDLE + TPM_RC_H + TPM_RC_2
+		0x00000084, // TPM_RC_VALUE
+		0xa5a5057e, // vendor
+		0x0000001e, // TPM 1.2
+	} {
+		err := DecodeResponseCode(CommandLoad, rc)
+		encoded, err2 := EncodeResponseCode(err)
+		if err2 != nil {
+			t.Errorf("EncodeResponseCode failed for 0x%08x: %v", rc, err2)
+			continue
+		}
+		if encoded != rc {
+			t.Errorf("Unexpected response code for %v: 0x%08x", err, encoded)
+		}
+	}
+
+	for _, data := range []struct {
+		desc string
+		err  error
+	}{
+		{desc: "InvalidErrorCode", err: &TPMError{Code: 0xff}},
+		{desc: "Fmt0ParameterError", err: &TPMParameterError{TPMError: &TPMError{Code: ErrorSensitive}, Index: 1}},
+		{desc: "ParameterIndexTooLarge", err: &TPMParameterError{TPMError: &TPMError{Code: ErrorValue}, Index: 16}},
+		{desc: "SessionIndexTooLarge", err: &TPMSessionError{TPMError: &TPMError{Code: ErrorAuthFail}, Index: 8}},
+		{desc: "InvalidWarningCode", err: &TPMWarning{Code: 0x80}},
+		{desc: "InvalidVendorCode", err: &TPMVendorError{Code: 0x155}},
+		{desc: "UnsupportedType", err: &TctiError{Op: "read"}},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			if _, err := EncodeResponseCode(data.err); err == nil {
+				t.Errorf("EncodeResponseCode should have failed")
+			}
+		})
+	}
+}
+
+func TestDecodeResponseCodeRaw(t *testing.T) {
+	for _, rc := range []ResponseCode{0x00000155, 0x00000923, 0x000005e7, 0x0000098e, 0x0000028b, 0x00000084} {
+		err := DecodeResponseCode(CommandLoad, rc)
+		var raw ResponseCode
+		switch e := err.(type) {
+		case *TPMWarning:
+			raw = e.ResponseCode
+		case *TPMError:
+			raw = e.ResponseCode
+		case *TPMParameterError:
+			raw = e.ResponseCode
+		case *TPMSessionError:
+			raw = e.ResponseCode
+		case *TPMHandleError:
+			raw = e.ResponseCode
+		default:
+			t.Fatalf("Unexpected error type %T", err)
+		}
+		if raw != rc {
+			t.Errorf("Unexpected raw response code for %v: 0x%08x", err, raw)
+		}
+	}
+}
+
+func TestLookupResponseCodeDescription(t *testing.T) {
+	for _, data := range []struct {
+		rc       ResponseCode
+		expected string
+		ok       bool
+	}{
+		{rc: Success, expected: "success", ok: true},
+		{rc: 0x00000101, expected: "commands not being accepted because of a TPM failure", ok: true},
+		{rc: 0x00000921, expected: "authorizations for objects subject to DA protection are not allowed at this time because the TPM is in DA lockout mode", ok: true},
+		{rc: 0x0000098e, expected: "the authorization HMAC check failed and DA counter incremented", ok: true},
+		{rc: 0x0000001e, expected: "the tag value sent for a command is invalid", ok: true},
+		{rc: 0x00000802, expected: "the TPM is currently executing a full self-test", ok: true},
+		{rc: 0xa5a5057e},
+		{rc: 0x0000017f},
+	} {
+		desc, ok := LookupResponseCodeDescription(data.rc)
+		if ok != data.ok {
+			t.Errorf("Unexpected result for 0x%08x", data.rc)
+		}
+		if desc != data.expected {
+			t.Errorf("Unexpected description for 0x%08x: %q", data.rc, desc)
+		}
+	}
+
+	err := DecodeResponseCode(CommandStartup, 0x0000001e)
+	if err.Error() != "TPM returned a 1.2 error whilst executing command TPM_CC_Startup: 0x0000001e (the tag value sent for a command is invalid)" {
+		t.Errorf("Unexpected error string: %v", err)
+	}
+}
+
+func TestDecodeVendorError(t *testing.T) {
+	RegisterVendorErrorDecoder(TPMManufacturerIFX, VendorErrorTable{0x0501: "firmware update in progress"}.Decode)
+	defer RegisterVendorErrorDecoder(TPMManufacturerIFX, nil)
+
+	e := &TPMVendorError{Command: CommandLoad, Code: 0x0501}
+	if DecodeVendorError(TPMManufacturerNTC, e) {
+		t.Errorf("DecodeVendorError succeeded for a manufacturer without a decoder")
+	}
+	if !DecodeVendorError(TPMManufacturerIFX, e) {
+		t.Fatalf("DecodeVendorError failed")
+	}
+	if e.Manufacturer != TPMManufacturerIFX || e.VendorCode != ResponseCode(0x0501) || e.Description != "firmware update in progress" {
+		t.Errorf("Unexpected error fields: %#v", e)
+	}
+	if e.Error() != "TPM returned a vendor defined error whilst executing command TPM_CC_Load: 0x00000501 (firmware update in progress)" {
+		t.Errorf("Unexpected error string: %v", e)
+	}
+
+	e = &TPMVendorError{Command: CommandLoad, Code: 0x0502}
+	if DecodeVendorError(TPMManufacturerIFX, e) {
+		t.Errorf("DecodeVendorError succeeded for an unknown code")
+	}
+	if e.Error() != "TPM returned a vendor defined error whilst executing command TPM_CC_Load: 0x00000502" {
+		t.Errorf("Unexpected error string: %v", e)
+	}
+}
+
+type mockTimeoutError struct{}
+
+func (e mockTimeoutError) Error() string   { return "i/o timeout" }
+func (e mockTimeoutError) Timeout() bool   { return true }
+func (e mockTimeoutError) Temporary() bool { return true }
+
+func TestTctiError(t *testing.T) {
+	for _, data := range []struct {
+		desc      string
+		err       error
+		timeout   bool
+		temporary bool
+		errno     syscall.Errno
+		is        error
+	}{
+		{desc: "Timeout", err: xerrors.Errorf("cannot write: %w", mockTimeoutError{}), timeout: true, temporary: true},
+		{desc: "Permission", err: &os.PathError{Op: "write", Path: "/dev/tpm0", Err: syscall.EACCES}, errno: syscall.EACCES, is: os.ErrPermission},
+		{desc: "NoDevice", err: &os.PathError{Op: "write", Path: "/dev/tpm0", Err: syscall.ENODEV}, errno: syscall.ENODEV, is: syscall.ENODEV},
+		{desc: "Other", err: errors.New("some error")},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			tpm, _ := NewTPMContext(testutil.NewMockTCTI(&testutil.MockCommand{CommandCode: CommandSelfTest, WriteError: data.err}))
+			err := tpm.SelfTest(false)
+
+			var e *TctiError
+			if !xerrors.As(err, &e) {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if e.Op != "write" {
+				t.Errorf("Unexpected op: %s", e.Op)
+			}
+			if e.Timeout() != data.timeout {
+				t.Errorf("Unexpected Timeout() result")
+			}
+			if e.Temporary() != data.temporary {
+				t.Errorf("Unexpected Temporary() result")
+			}
+			errno, ok := e.Errno()
+			if ok != (data.errno != 0) || errno != data.errno {
+				t.Errorf("Unexpected Errno() result: %v, %v", errno, ok)
+			}
+			if data.is != nil && !xerrors.Is(err, data.is) {
+				t.Errorf("Error doesn't match %v", data.is)
+			}
+		})
+	}
+}
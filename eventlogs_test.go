@@ -0,0 +1,122 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+
+	. "github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+// replayEventLog is a minimal parser for crypto-agile event logs, which only performs enough parsing to compute the final PCR
+// values.
+func replayEventLog(t *testing.T, data []byte) PCRValues {
+	r := bytes.NewReader(data)
+
+	var header struct {
+		PCRIndex  uint32
+		EventType uint32
+		Digest    [20]byte
+		EventSize uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		t.Fatalf("Cannot read Spec ID event: %v", err)
+	}
+	specID := make([]byte, header.EventSize)
+	if _, err := io.ReadFull(r, specID); err != nil {
+		t.Fatalf("Cannot read Spec ID event data: %v", err)
+	}
+	if !bytes.HasPrefix(specID, []byte("Spec ID Event03\x00")) {
+		t.Fatalf("Unexpected Spec ID event signature")
+	}
+
+	values := make(PCRValues)
+	for r.Len() > 0 {
+		var event struct {
+			PCRIndex  uint32
+			EventType uint32
+			Count     uint32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &event); err != nil {
+			t.Fatalf("Cannot read event: %v", err)
+		}
+		for i := uint32(0); i < event.Count; i++ {
+			var alg HashAlgorithmId
+			if err := binary.Read(r, binary.LittleEndian, &alg); err != nil {
+				t.Fatalf("Cannot read digest algorithm: %v", err)
+			}
+			digest := make(Digest, alg.Size())
+			if _, err := io.ReadFull(r, digest); err != nil {
+				t.Fatalf("Cannot read digest: %v", err)
+			}
+
+			pcr, ok := values[alg][int(event.PCRIndex)]
+			if !ok {
+				pcr = make(Digest, alg.Size())
+			}
+			h := alg.NewHash()
+			h.Write(pcr)
+			h.Write(digest)
+			values.SetValue(alg, int(event.PCRIndex), h.Sum(nil))
+		}
+		var size uint32
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+			t.Fatalf("Cannot read event size: %v", err)
+		}
+		if _, err := r.Seek(int64(size), io.SeekCurrent); err != nil {
+			t.Fatalf("Cannot skip event data: %v", err)
+		}
+	}
+
+	return values
+}
+
+func TestEventLogFixtures(t *testing.T) {
+	fixtures, err := testutil.EventLogFixtures()
+	if err != nil {
+		t.Fatalf("EventLogFixtures failed: %v", err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatalf("No fixtures")
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.Name, func(t *testing.T) {
+			for _, alg := range []HashAlgorithmId{HashAlgorithmSHA1, HashAlgorithmSHA256} {
+				if len(fixture.ExpectedPCRs[alg]) == 0 {
+					t.Errorf("No expected values for %v bank", alg)
+				}
+			}
+
+			data, err := fixture.Data()
+			if err != nil {
+				t.Fatalf("Data failed: %v", err)
+			}
+			if values := replayEventLog(t, data); !reflect.DeepEqual(values, fixture.ExpectedPCRs) {
+				t.Errorf("Unexpected PCR values")
+			}
+		})
+	}
+}
+
+func TestGetEventLogFixture(t *testing.T) {
+	fixture, err := testutil.GetEventLogFixture("uefi-secureboot")
+	if err != nil {
+		t.Fatalf("GetEventLogFixture failed: %v", err)
+	}
+	if fixture.Name != "uefi-secureboot" {
+		t.Errorf("Unexpected name: %s", fixture.Name)
+	}
+
+	if _, err := testutil.GetEventLogFixture("missing"); !os.IsNotExist(err) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -4,6 +4,11 @@
 
 package tpm2
 
+import (
+	"hash"
+	"time"
+)
+
 type ResourceContextPrivate = resourceContextPrivate
 type ObjectContext = objectContext
 type NvIndexContext = nvIndexContext
@@ -16,3 +21,26 @@ func (r *TestSessionContext) Attrs() SessionAttributes {
 var TestComputeBindName = computeBindName
 
 type SessionContextData = sessionContextData
+
+func MockSleep(fn func(time.Duration)) (restore func()) {
+	orig := sleep
+	sleep = fn
+	return func() {
+		sleep = orig
+	}
+}
+
+func MakeMockSessionContext(handle Handle, data *SessionContextData) SessionContext {
+	return makeSessionContext(handle, data)
+}
+
+var CryptComputeCpHash = cryptComputeCpHash
+
+func (r *TestSessionContext) HMACForKey(key []byte) hash.Hash {
+	return r.hmacForKey(key)
+}
+
+func ComputeCommandHMAC(session SessionContext, commandCode CommandCode, commandHandles []Name, cpBytes []byte) []byte {
+	s := &sessionParam{session: session.(*sessionContext), attrs: session.(*sessionContext).attrs}
+	return s.computeCommandHMAC(commandCode, commandHandles, cpBytes)
+}
@@ -0,0 +1,124 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+//go:build go1.18
+// +build go1.18
+
+package tpm2_test
+
+import (
+	"testing"
+
+	. "github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+// The fuzz targets in this file exercise the code that consumes responses from the TPM, which may be a hostile device or be
+// accessed via an untrusted proxy. They check that malformed responses result in an error rather than a panic or an excessive
+// allocation. Run them with (for example) "go test -run XXX -fuzz FuzzResponseHeader".
+
+func mockResponseBytes(f *testing.F, rsp *testutil.MockResponse) []byte {
+	b, err := rsp.Bytes()
+	if err != nil {
+		f.Fatalf("Bytes failed: %v", err)
+	}
+	return b
+}
+
+func FuzzResponseHeader(f *testing.F) {
+	f.Add(mockResponseBytes(f, &testutil.MockResponse{Params: []interface{}{Digest{0x01, 0x02, 0x03, 0x04}}}))
+	f.Add(mockResponseBytes(f, &testutil.MockResponse{ResponseCode: ResponseCode(0x184)}))
+	f.Add(mockResponseBytes(f, &testutil.MockResponse{ResponseCode: ResponseCode(0x922)}))
+	f.Add([]byte{0x80, 0x01, 0x00, 0x00, 0x00, 0x0a})
+	f.Add([]byte{0x80, 0x01, 0xff, 0xff, 0xff, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00})
+	f.Add([]byte{0x00, 0xc4, 0x00, 0x00, 0x00, 0x0a, 0x00, 0x00, 0x00, 0x1e})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		tpm, _ := NewTPMContext(testutil.NewMockTCTI(&testutil.MockCommand{CommandCode: CommandGetRandom, RawResponse: data}))
+		tpm.SetMaxSubmissions(1)
+
+		var randomBytes Digest
+		if err := tpm.RunCommand(CommandGetRandom, nil, Delimiter, uint16(4), Delimiter, Delimiter, &randomBytes); err == nil && len(data) < 10 {
+			t.Errorf("RunCommand succeeded with a truncated response")
+		}
+	})
+}
+
+func FuzzResponseAuthArea(f *testing.F) {
+	hmacResponse, err := mu.MarshalToBytes(TagSessions, uint32(0), Success, uint32(0), make(Nonce, 32), uint8(AttrContinueSession), make(Auth, 32))
+	if err != nil {
+		f.Fatalf("MarshalToBytes failed: %v", err)
+	}
+	hmacResponse[5] = uint8(len(hmacResponse))
+
+	f.Add(false, mockResponseBytes(f, &testutil.MockResponse{PasswordSessions: 1}))
+	f.Add(true, mockResponseBytes(f, &testutil.MockResponse{PasswordSessions: 1}))
+	f.Add(false, mockResponseBytes(f, &testutil.MockResponse{Params: []interface{}{mu.RawBytes{0x01, 0x02}}, PasswordSessions: 1}))
+	f.Add(false, hmacResponse)
+	f.Add(true, hmacResponse)
+	f.Add(false, mockResponseBytes(f, &testutil.MockResponse{}))
+
+	f.Fuzz(func(t *testing.T, strict bool, data []byte) {
+		for _, session := range []SessionContext{
+			nil,
+			MakeMockSessionContext(0x02000000, &SessionContextData{
+				HashAlg:     HashAlgorithmSHA256,
+				SessionType: SessionTypeHMAC,
+				SessionKey:  make([]byte, 32),
+				NonceCaller: make(Nonce, 32),
+				NonceTPM:    make(Nonce, 32)}),
+		} {
+			tpm, _ := NewTPMContext(testutil.NewMockTCTI(&testutil.MockCommand{CommandCode: CommandPCRReset, RawResponse: data}))
+			tpm.SetMaxSubmissions(1)
+			tpm.SetStrictResponseValidation(strict)
+
+			tpm.RunCommand(CommandPCRReset, nil, ResourceContextWithSession{Context: tpm.PCRHandleContext(7), Session: session})
+		}
+	})
+}
+
+func FuzzDecodeResponseCode(f *testing.F) {
+	f.Add(uint32(CommandPCRReset), uint32(0x184))
+	f.Add(uint32(CommandUnseal), uint32(0x98e))
+	f.Add(uint32(CommandLoad), uint32(0x1c4))
+	f.Add(uint32(CommandStartup), uint32(0x100))
+	f.Add(uint32(CommandGetRandom), uint32(0x922))
+	f.Add(uint32(CommandGetRandom), uint32(0x0400))
+	f.Add(uint32(CommandGetRandom), uint32(0x0030))
+
+	f.Fuzz(func(t *testing.T, command, code uint32) {
+		err := DecodeResponseCode(CommandCode(command), ResponseCode(code))
+		if code == uint32(Success) {
+			if err != nil {
+				t.Errorf("Unexpected error for success: %v", err)
+			}
+			return
+		}
+		if err == nil {
+			t.Fatalf("No error for response code 0x%08x", code)
+		}
+		if err.Error() == "" {
+			t.Errorf("Empty error string for response code 0x%08x", code)
+		}
+
+		var pe *TPMParameterError
+		var se *TPMSessionError
+		var he *TPMHandleError
+		switch {
+		case AsTPMParameterError(err, AnyErrorCode, AnyCommandCode, AnyParameterIndex, &pe):
+			if pe.Index < 0 || pe.Index > 0xf {
+				t.Errorf("Invalid parameter index %d for response code 0x%08x", pe.Index, code)
+			}
+		case AsTPMSessionError(err, AnyErrorCode, AnyCommandCode, AnySessionIndex, &se):
+			if se.Index < 0 || se.Index > 0x7 {
+				t.Errorf("Invalid session index %d for response code 0x%08x", se.Index, code)
+			}
+		case AsTPMHandleError(err, AnyErrorCode, AnyCommandCode, AnyHandleIndex, &he):
+			if he.Index < 0 || he.Index > 0x7 {
+				t.Errorf("Invalid handle index %d for response code 0x%08x", he.Index, code)
+			}
+		}
+	})
+}
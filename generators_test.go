@@ -0,0 +1,88 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+	"testing/quick"
+
+	. "github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+func TestGeneratedPublicRoundTrip(t *testing.T) {
+	if err := quick.Check(func(p testutil.QuickPublic) bool {
+		b, err := mu.MarshalToBytes(p.Public)
+		if err != nil {
+			t.Logf("MarshalToBytes failed: %v", err)
+			return false
+		}
+		var p2 *Public
+		if _, err := mu.UnmarshalFromBytes(b, &p2); err != nil {
+			t.Logf("UnmarshalFromBytes failed: %v", err)
+			return false
+		}
+		n1, err := p.Name()
+		if err != nil {
+			t.Logf("Name failed: %v", err)
+			return false
+		}
+		n2, _ := p2.Name()
+		b2, _ := mu.MarshalToBytes(p2)
+		return bytes.Equal(b, b2) && bytes.Equal(n1, n2)
+	}, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGeneratedNVPublicRoundTrip(t *testing.T) {
+	if err := quick.Check(func(p testutil.QuickNVPublic) bool {
+		b, err := mu.MarshalToBytes(p.NVPublic)
+		if err != nil {
+			t.Logf("MarshalToBytes failed: %v", err)
+			return false
+		}
+		var p2 *NVPublic
+		if _, err := mu.UnmarshalFromBytes(b, &p2); err != nil {
+			t.Logf("UnmarshalFromBytes failed: %v", err)
+			return false
+		}
+		b2, _ := mu.MarshalToBytes(p2)
+		return bytes.Equal(b, b2)
+	}, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGeneratedPCRSelectionListRoundTrip(t *testing.T) {
+	if err := quick.Check(func(l testutil.QuickPCRSelectionList) bool {
+		b, err := mu.MarshalToBytes(l.PCRSelectionList)
+		if err != nil {
+			t.Logf("MarshalToBytes failed: %v", err)
+			return false
+		}
+		var l2 PCRSelectionList
+		if _, err := mu.UnmarshalFromBytes(b, &l2); err != nil {
+			t.Logf("UnmarshalFromBytes failed: %v", err)
+			return false
+		}
+		return l.Equal(l2)
+	}, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGenerateTrialAuthPolicyIsDeterministic(t *testing.T) {
+	for i := int64(0); i < 20; i++ {
+		d1 := testutil.GenerateTrialAuthPolicy(rand.New(rand.NewSource(i)), HashAlgorithmSHA256).GetDigest()
+		d2 := testutil.GenerateTrialAuthPolicy(rand.New(rand.NewSource(i)), HashAlgorithmSHA256).GetDigest()
+		if !bytes.Equal(d1, d2) || len(d1) != 32 {
+			t.Errorf("Unexpected digests for seed %d: %x, %x", i, d1, d2)
+		}
+	}
+}
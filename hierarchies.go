@@ -0,0 +1,118 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2
+
+import (
+	"fmt"
+)
+
+// hierarchyOf returns the hierarchy that the resource associated with context lives in, if this is known. For hierarchies, this
+// is the handle of the hierarchy itself. For transient objects that were created or loaded with this TPMContext, it is the
+// hierarchy that the object was created or loaded in. HandleUnassigned is returned for any other resource.
+func (t *TPMContext) hierarchyOf(context ResourceContext) Handle {
+	switch c := context.(type) {
+	case *permanentContext:
+		switch c.Handle() {
+		case HandleOwner, HandleEndorsement, HandlePlatform, HandleNull:
+			return c.Handle()
+		}
+	case *objectContext:
+		if h, ok := t.transientObjects[c]; ok {
+			return h
+		}
+	}
+	return HandleUnassigned
+}
+
+// trackTransientObject records the hierarchy that the supplied transient object was created or loaded in, so that it can be
+// invalidated if the hierarchy is disabled or its seed is changed.
+func (t *TPMContext) trackTransientObject(object *objectContext, hierarchy Handle) {
+	if hierarchy == HandleUnassigned {
+		return
+	}
+	if t.transientObjects == nil {
+		t.transientObjects = make(map[*objectContext]Handle)
+	}
+	t.transientObjects[object] = hierarchy
+}
+
+func (t *TPMContext) untrackTransientObject(context HandleContext) {
+	if object, isObject := context.(*objectContext); isObject {
+		delete(t.transientObjects, object)
+	}
+}
+
+// invalidateTransientObjects invalidates all of the transient objects that were created or loaded in the specified hierarchy with
+// this TPMContext.
+func (t *TPMContext) invalidateTransientObjects(hierarchy Handle) {
+	for object, h := range t.transientObjects {
+		if h != hierarchy {
+			continue
+		}
+		object.invalidate()
+		delete(t.transientObjects, object)
+	}
+}
+
+// IsHierarchyDisabled indicates whether the specified hierarchy was disabled by a call to TPMContext.HierarchyControl with this
+// TPMContext, and hasn't since been re-enabled by a subsequent call or by TPMContext.Startup. It does not reflect changes made
+// outside of this TPMContext, such as by the platform firmware, and should not be used in place of checking the TPM's
+// PropertyStartupClear property.
+func (t *TPMContext) IsHierarchyDisabled(hierarchy Handle) bool {
+	_, disabled := t.disabledHierarchies[hierarchy]
+	return disabled
+}
+
+func (t *TPMContext) setHierarchyEnabled(hierarchy Handle, enabled bool) {
+	if enabled {
+		delete(t.disabledHierarchies, hierarchy)
+		return
+	}
+
+	if t.disabledHierarchies == nil {
+		t.disabledHierarchies = make(map[Handle]struct{})
+	}
+	t.disabledHierarchies[hierarchy] = struct{}{}
+	// The TPM flushes transient objects in a hierarchy when it is disabled.
+	t.invalidateTransientObjects(hierarchy)
+}
+
+// resetHierarchyState updates the hierarchy state after TPM2_Startup. Transient objects are always flushed. The platform
+// hierarchy is always enabled, and the storage and endorsement hierarchies are enabled after a TPM reset or restart.
+func (t *TPMContext) resetHierarchyState(startupType StartupType) {
+	t.transientObjects = nil
+	if startupType == StartupClear {
+		t.disabledHierarchies = nil
+		return
+	}
+	delete(t.disabledHierarchies, HandlePlatform)
+	delete(t.disabledHierarchies, HandlePlatformNV)
+}
+
+// annotateHierarchyDisabledError adds information to a *HierarchyDisabledError if the hierarchy associated with the command handle
+// that it corresponds to is known to have been disabled with this TPMContext.
+func (t *TPMContext) annotateHierarchyDisabledError(err error, resources []interface{}) error {
+	e, ok := err.(*HierarchyDisabledError)
+	if !ok {
+		return err
+	}
+	index := e.err.Index
+	if index < 1 || index > len(resources) {
+		return err
+	}
+	context, ok := resources[index-1].(ResourceContext)
+	if !ok {
+		return err
+	}
+
+	hierarchy := t.hierarchyOf(context)
+	if !t.IsHierarchyDisabled(hierarchy) {
+		return err
+	}
+	e.Hierarchy = hierarchy
+	e.Guidance = fmt.Sprintf("The %v hierarchy was disabled with TPMContext.HierarchyControl. It can be re-enabled with "+
+		"TPMContext.HierarchyControl using the platform hierarchy, or by restarting the TPM.", hierarchy)
+	return err
+}
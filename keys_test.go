@@ -0,0 +1,49 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	"crypto"
+
+	. "github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/testutil"
+
+	. "gopkg.in/check.v1"
+)
+
+type keysSuite struct {
+	testutil.TPMTest
+}
+
+var _ = Suite(&keysSuite{TPMTest: testutil.TPMTest{TPMFeatures: testutil.TPMFeatureOwnerHierarchy}})
+
+func (s *keysSuite) testSigningKey(c *C, srk, key ResourceContext, sigAlg SigSchemeId) {
+	pub, _, _, err := s.TPM.ReadPublic(srk)
+	c.Assert(err, IsNil)
+	c.Check(pub.Attrs&(AttrRestricted|AttrDecrypt), Equals, AttrRestricted|AttrDecrypt)
+
+	h := crypto.SHA256.New()
+	h.Write([]byte("foo"))
+	digest := h.Sum(nil)
+
+	sig, err := s.TPM.Sign(key, digest, nil, nil, nil)
+	c.Assert(err, IsNil)
+	c.Check(sig.SigAlg, Equals, sigAlg)
+}
+
+func (s *keysSuite) TestRSAKeys(c *C) {
+	srk := s.CreatePrimaryRSASRK(c)
+	s.testSigningKey(c, srk, s.CreateRSASigningKey(c, srk), SigSchemeAlgRSASSA)
+}
+
+func (s *keysSuite) TestECCKeys(c *C) {
+	srk := s.CreatePrimaryECCSRK(c)
+	s.testSigningKey(c, srk, s.CreateECCSigningKey(c, srk), SigSchemeAlgECDSA)
+}
+
+func (s *keysSuite) TestFlushedByTest(c *C) {
+	srk := s.CreatePrimaryRSASRK(c)
+	c.Check(s.TPM.FlushContext(srk), IsNil)
+}
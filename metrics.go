@@ -0,0 +1,90 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2
+
+import (
+	"fmt"
+	"time"
+)
+
+// Metrics is implemented by monitoring integrations in order to receive metrics about the commands executed by a TPMContext. It
+// is registered with TPMContext.SetMetrics. Metrics are identified by name, and label values are supplied in the order of the label
+// names described by MetricDescs. The methods are called from the goroutine that is executing the command.
+//
+// The github.com/canonical/go-tpm2/prometheus package provides an implementation that exposes metrics in a form that can be scraped
+// by Prometheus.
+type Metrics interface {
+	// IncCounter increments the counter with the specified name and label values.
+	IncCounter(name string, labelValues ...string)
+
+	// ObserveHistogram adds an observation to the histogram with the specified name and label values.
+	ObserveHistogram(name string, value float64, labelValues ...string)
+}
+
+const (
+	// MetricCommands is a counter of command submissions, labelled by command.
+	MetricCommands = "tpm_commands_total"
+
+	// MetricCommandErrors is a counter of command submissions for which the TPM responded with an error or warning, labelled by
+	// command and response code.
+	MetricCommandErrors = "tpm_command_errors_total"
+
+	// MetricCommandDuration is a histogram of the time in seconds taken for the TPM to respond to a command, labelled by command.
+	MetricCommandDuration = "tpm_command_duration_seconds"
+
+	// MetricLockoutEvents is a counter of command submissions that failed because the TPM is in dictionary attack lockout mode,
+	// labelled by command.
+	MetricLockoutEvents = "tpm_lockout_events_total"
+)
+
+// MetricType describes the type of a metric.
+type MetricType int
+
+const (
+	MetricTypeCounter MetricType = iota
+	MetricTypeHistogram
+)
+
+// MetricDesc describes a metric that is supplied to a Metrics implementation.
+type MetricDesc struct {
+	Name   string
+	Help   string
+	Type   MetricType
+	Labels []string // The names of the labels, in the order that their values are supplied
+}
+
+// MetricDescs returns descriptions of all of the metrics supplied to Metrics implementations.
+func MetricDescs() []MetricDesc {
+	return []MetricDesc{
+		{Name: MetricCommands, Help: "Number of commands submitted to the TPM.", Type: MetricTypeCounter,
+			Labels: []string{"command"}},
+		{Name: MetricCommandErrors, Help: "Number of commands for which the TPM responded with an error or warning.",
+			Type: MetricTypeCounter, Labels: []string{"command", "response_code"}},
+		{Name: MetricCommandDuration, Help: "Time taken for the TPM to respond to commands in seconds.", Type: MetricTypeHistogram,
+			Labels: []string{"command"}},
+		{Name: MetricLockoutEvents, Help: "Number of commands rejected because the TPM is in dictionary attack lockout mode.",
+			Type: MetricTypeCounter, Labels: []string{"command"}},
+	}
+}
+
+// SetMetrics registers an implementation of Metrics that will receive metrics for every command submitted to the TPM, including
+// automatic resubmissions. Setting this to nil disables metrics.
+func (t *TPMContext) SetMetrics(metrics Metrics) {
+	t.metrics = metrics
+}
+
+func (t *TPMContext) recordMetrics(commandCode CommandCode, duration time.Duration, responseCode ResponseCode) {
+	command := commandCode.String()
+	t.metrics.IncCounter(MetricCommands, command)
+	t.metrics.ObserveHistogram(MetricCommandDuration, duration.Seconds(), command)
+
+	if responseCode == Success {
+		return
+	}
+	t.metrics.IncCounter(MetricCommandErrors, command, fmt.Sprintf("0x%08x", uint32(responseCode)))
+	if IsTPMWarning(DecodeResponseCode(commandCode, responseCode), WarningLockout, commandCode) {
+		t.metrics.IncCounter(MetricLockoutEvents, command)
+	}
+}
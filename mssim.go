@@ -19,8 +19,10 @@ import (
 
 const (
 	cmdPowerOn        uint32 = 1
+	cmdPowerOff       uint32 = 2
 	cmdTPMSendCommand uint32 = 8
 	cmdNVOn           uint32 = 11
+	cmdNVOff          uint32 = 12
 	cmdReset          uint32 = 17
 	cmdSessionEnd     uint32 = 20
 	cmdStop           uint32 = 21
@@ -43,7 +45,8 @@ type TctiMssim struct {
 	tpm      net.Conn
 	platform net.Conn
 
-	buf *bytes.Reader
+	buf     *bytes.Reader
+	readBuf []byte // Reused for each response read from the command channel
 }
 
 func (t *TctiMssim) readMoreData() error {
@@ -52,12 +55,19 @@ func (t *TctiMssim) readMoreData() error {
 		return xerrors.Errorf("cannot read response size from TPM command channel: %w", err)
 	}
 
-	buf := make([]byte, size)
+	if uint32(cap(t.readBuf)) < size {
+		t.readBuf = make([]byte, size)
+	}
+	buf := t.readBuf[:size]
 	if _, err := io.ReadFull(t.tpm, buf); err != nil {
 		return xerrors.Errorf("cannot read response from TPM command channel: %w", err)
 	}
 
-	t.buf = bytes.NewReader(buf)
+	if t.buf == nil {
+		t.buf = bytes.NewReader(buf)
+	} else {
+		t.buf.Reset(buf)
+	}
 
 	var trash uint32
 	if err := binary.Read(t.tpm, binary.BigEndian, &trash); err != nil {
@@ -87,6 +97,12 @@ func sendSessionEnd(conn net.Conn) error {
 	return binary.Write(conn, binary.BigEndian, cmdSessionEnd)
 }
 
+// SupportsPipelining implements PipelinedTCTI.SupportsPipelining. The simulator processes commands on the command channel in order,
+// so commands can always be pipelined.
+func (t *TctiMssim) SupportsPipelining() bool {
+	return true
+}
+
 func (t *TctiMssim) Close() (out error) {
 	if err := sendSessionEnd(t.platform); err != nil {
 		out = xerrors.Errorf("cannot send session end command on platform channel: %w", err)
@@ -134,6 +150,32 @@ func (t *TctiMssim) Reset() error {
 	return t.platformCommand(cmdReset)
 }
 
+// PowerOff submits the power off command on the platform connection, which simulates removing power from the TPM. If
+// TPMContext.Shutdown was not called beforehand, the next startup will be treated as a disorderly shutdown. The simulator won't
+// respond to TPM commands until PowerOn is called.
+func (t *TctiMssim) PowerOff() error {
+	return t.platformCommand(cmdPowerOff)
+}
+
+// PowerOn submits the power on command on the platform connection, which simulates applying power to the TPM and results in the
+// execution of _TPM_Init(). TPMContext.Startup must be called before executing other commands. This is called automatically by
+// OpenMssim.
+func (t *TctiMssim) PowerOn() error {
+	return t.platformCommand(cmdPowerOn)
+}
+
+// NVOn submits the NV on command on the platform connection, which makes NV memory available to the TPM. This is called
+// automatically by OpenMssim.
+func (t *TctiMssim) NVOn() error {
+	return t.platformCommand(cmdNVOn)
+}
+
+// NVOff submits the NV off command on the platform connection, which makes NV memory unavailable to the TPM. Commands that require
+// access to NV memory will fail with TPM_RC_NV_UNAVAILABLE until NVOn is called.
+func (t *TctiMssim) NVOff() error {
+	return t.platformCommand(cmdNVOff)
+}
+
 func sendStop(conn net.Conn) error {
 	return binary.Write(conn, binary.BigEndian, cmdStop)
 }
@@ -178,10 +220,10 @@ func OpenMssim(host string, tpmPort, platformPort uint) (*TctiMssim, error) {
 	}
 	tcti.platform = platform
 
-	if err := tcti.platformCommand(cmdPowerOn); err != nil {
+	if err := tcti.PowerOn(); err != nil {
 		return nil, xerrors.Errorf("cannot complete power on command: %w", err)
 	}
-	if err := tcti.platformCommand(cmdNVOn); err != nil {
+	if err := tcti.NVOn(); err != nil {
 		return nil, xerrors.Errorf("cannot complete NV on command: %w", err)
 	}
 
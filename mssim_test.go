@@ -0,0 +1,119 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+
+	. "github.com/canonical/go-tpm2"
+)
+
+// mockMssimPlatform accepts a single connection on each of the TPM and platform ports, and records the platform commands that it
+// receives. It responds to commands in failCommands with an error.
+type mockMssimPlatform struct {
+	tpm          net.Listener
+	platform     net.Listener
+	failCommands map[uint32]bool
+	commands     chan uint32
+}
+
+func newMockMssimPlatform(t *testing.T) *mockMssimPlatform {
+	tpm, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("Cannot listen: %v", err)
+	}
+	platform, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tpm.Close()
+		t.Skipf("Cannot listen: %v", err)
+	}
+	m := &mockMssimPlatform{tpm: tpm, platform: platform, failCommands: make(map[uint32]bool), commands: make(chan uint32, 10)}
+
+	go func() {
+		conn, err := tpm.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var b [1]byte
+		conn.Read(b[:])
+	}()
+	go func() {
+		conn, err := platform.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			var cmd uint32
+			if err := binary.Read(conn, binary.BigEndian, &cmd); err != nil {
+				close(m.commands)
+				return
+			}
+			m.commands <- cmd
+			var rsp uint32
+			if m.failCommands[cmd] {
+				rsp = 1
+			}
+			if err := binary.Write(conn, binary.BigEndian, rsp); err != nil {
+				return
+			}
+		}
+	}()
+
+	return m
+}
+
+func (m *mockMssimPlatform) ports() (uint, uint) {
+	return uint(m.tpm.Addr().(*net.TCPAddr).Port), uint(m.platform.Addr().(*net.TCPAddr).Port)
+}
+
+func (m *mockMssimPlatform) close() {
+	m.tpm.Close()
+	m.platform.Close()
+}
+
+func TestMssimPlatformCommands(t *testing.T) {
+	m := newMockMssimPlatform(t)
+	defer m.close()
+	m.failCommands[12] = true
+
+	tpmPort, platformPort := m.ports()
+	tcti, err := OpenMssim("127.0.0.1", tpmPort, platformPort)
+	if err != nil {
+		t.Fatalf("OpenMssim failed: %v", err)
+	}
+
+	if err := tcti.PowerOff(); err != nil {
+		t.Errorf("PowerOff failed: %v", err)
+	}
+	if err := tcti.PowerOn(); err != nil {
+		t.Errorf("PowerOn failed: %v", err)
+	}
+	if err := tcti.NVOn(); err != nil {
+		t.Errorf("NVOn failed: %v", err)
+	}
+	if err := tcti.Reset(); err != nil {
+		t.Errorf("Reset failed: %v", err)
+	}
+	if err := tcti.NVOff(); err == nil {
+		t.Errorf("NVOff should have failed")
+	} else if e, ok := err.(*PlatformCommandError); !ok || e.Code != 1 {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	tcti.Close()
+
+	var commands []uint32
+	for cmd := range m.commands {
+		commands = append(commands, cmd)
+	}
+	// OpenMssim sends power on and NV on, and Close sends session end.
+	if !reflect.DeepEqual(commands, []uint32{1, 11, 2, 1, 11, 17, 12, 20}) {
+		t.Errorf("Unexpected platform commands: %v", commands)
+	}
+}
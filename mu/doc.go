@@ -25,6 +25,12 @@ Go types are marshalled to and from the TPM wire format according to the followi
   enclosing struct, where the field has the `tpm2:"selector:<field_name>"` tag referencing a valid selector field name in the
   enclosing struct.
 
+Types that implement both encoding.BinaryMarshaler and encoding.BinaryUnmarshaler (the latter with a pointer receiver) are
+marshalled as a TPM2B prefixed type, using the result of MarshalBinary as the contents of the sized buffer. If such a type is
+referenced from a struct field with the `tpm2:"raw"` tag, it is marshalled without the size field, and unmarshalling consumes the
+remainder of the enclosing sized buffer or input. A nil pointer to one of these types is marshalled as a zero sized buffer. Types
+that implement CustomMarshaller take precedence over these interfaces.
+
 TPMI prefixed types (interface types) are generally not explicitly supported. These are used by the TPM for type checking during
 unmarshalling. Some TPMI prefixed types that use TPM_ALG_ID as the underlying concrete type are implemented.
 
@@ -34,9 +40,11 @@ The marshalling code parses the "tpm2" tag on struct fields, the value of which
  * selector:<field_name> - used when the field is a struct that implements the Union interface. <field_name> references the name of
  another field in the struct, the value of which is used as the selector for the union type.
  * sized - used when the field is a struct, to indicate that it should be marshalled and unmarshalled as a sized struct. The field
- must be a pointer to a struct, and a nil pointer indicates a zero-sized struct.
+ must be a pointer to a struct that isn't a union, and a nil pointer indicates a zero-sized struct. Applying this option to any other
+ type, or combining it with the raw option, results in an error.
  * raw - used when the field is a slice, to indicate that it should be marshalled and unmarshalled without a length (if it
  represents a list) or size (if it represents a sized buffer) field. The slice must be pre-allocated to the correct length by the
- caller during unmarshalling.
+ caller during unmarshalling. This can also be used when the field is a type that implements encoding.BinaryMarshaler, to indicate
+ that it should be marshalled and unmarshalled without a size field.
 */
 package mu
@@ -6,14 +6,17 @@ package mu
 
 import (
 	"bytes"
+	"encoding"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math"
 	"os"
 	"reflect"
 	"strings"
+	"sync"
 
 	"golang.org/x/xerrors"
 )
@@ -21,12 +24,15 @@ import (
 var (
 	customMuType reflect.Type = reflect.TypeOf((*customMuIface)(nil)).Elem()
 	unionType    reflect.Type = reflect.TypeOf((*Union)(nil)).Elem()
-	nilValueType reflect.Type = reflect.TypeOf(NilUnionValue)
 	rawBytesType reflect.Type = reflect.TypeOf(RawBytes(nil))
+
+	binaryMarshalerType   reflect.Type = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	binaryUnmarshalerType reflect.Type = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
 )
 
-// InvalidSelectorError may be returned as a wrapped error from UnmarshalFromBytes or UnmarshalFromReader when a union type indicates
-// that a selector value is invalid.
+// InvalidSelectorError should be returned from implementations of Union.Select to indicate that a selector value is invalid. It
+// may be returned as a wrapped error from MarshalToBytes, MarshalToWriter, UnmarshalFromBytes or UnmarshalFromReader, in which case
+// the wrapping error identifies the union type.
 type InvalidSelectorError struct {
 	Selector reflect.Value
 }
@@ -35,6 +41,54 @@ func (e *InvalidSelectorError) Error() string {
 	return fmt.Sprintf("invalid selector value: %v", e.Selector)
 }
 
+// SizeError indicates that a sized value or list has a size or length that is invalid. During marshalling, this is returned as a
+// wrapped error from MarshalToBytes, MarshalToWriter or MarshalAppend if a value is too large to be represented in the TPM wire
+// format. During unmarshalling, this is returned as a wrapped error from UnmarshalFromBytes or UnmarshalFromReader if the size of a
+// value is inconsistent with the supplied data.
+type SizeError struct {
+	msg string
+}
+
+func (e *SizeError) Error() string {
+	return e.msg
+}
+
+// IOError is returned as a wrapped error from MarshalToBytes, MarshalToWriter, MarshalAppend, UnmarshalFromBytes or
+// UnmarshalFromReader when the underlying io.Writer or io.Reader returns an error. Note that io.EOF and io.ErrUnexpectedEOF
+// are not wrapped by this type during unmarshalling, as these indicate that the supplied data was truncated rather than an I/O
+// failure.
+type IOError struct {
+	err error
+}
+
+func (e *IOError) Error() string {
+	return e.err.Error()
+}
+
+func (e *IOError) Unwrap() error {
+	return e.err
+}
+
+func makeIOError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*IOError); ok {
+		return err
+	}
+	return &IOError{err: err}
+}
+
+// TrailingBytesError is returned from UnmarshalFromBytesStrict when the supplied data contains bytes that were not consumed
+// during unmarshalling.
+type TrailingBytesError struct {
+	N int // The number of trailing bytes
+}
+
+func (e *TrailingBytesError) Error() string {
+	return fmt.Sprintf("%d trailing byte(s) after unmarshalling", e.N)
+}
+
 type customMuIface interface {
 	CustomMarshaller
 	CustomUnmarshaller
@@ -55,12 +109,6 @@ type CustomUnmarshaller interface {
 	Unmarshal(r Reader) error
 }
 
-type empty struct{}
-
-// NilUnionValue is a special value, the type of which should be returned from implementations of Union.Select to indicate
-// that a union contains no data for a particular selector value.
-var NilUnionValue empty
-
 // RawBytes is a special byte slice type which is marshalled and unmarshalled without a size field. The slice must be pre-allocated to
 // the correct length by the caller during unmarshalling.
 type RawBytes []byte
@@ -69,8 +117,9 @@ type RawBytes []byte
 type Union interface {
 	// Select is called by the marshalling code to map the supplied selector to a field. The returned value must be a pointer to
 	// the field to be marshalled or unmarshalled. To work correctly during marshalling and unmarshalling, implementations must
-	// take a pointer receiver. If no data should be marshalled or unmarshalled, it should return NilUnionValue.
-	Select(selector reflect.Value) interface{}
+	// take a pointer receiver. If no data should be marshalled or unmarshalled, it should return a nil value and a nil error. If
+	// the selector value is invalid, it should return a *InvalidSelectorError error.
+	Select(selector reflect.Value) (interface{}, error)
 }
 
 type muError struct {
@@ -122,6 +171,10 @@ func makeCustomTypeMuError(val reflect.Value, ctx *muContext, err error) error {
 	return &muError{kind: "custom", val: val, container: ctx.container, err: err}
 }
 
+func makeBinaryTypeMuError(val reflect.Value, ctx *muContext, err error) error {
+	return &muError{kind: "binary", val: val, container: ctx.container, err: err}
+}
+
 type structFieldMuError struct {
 	val   reflect.Value
 	field reflect.StructField
@@ -251,17 +304,18 @@ func (c *muContext) enterUnionElem(u reflect.Value) (elem reflect.Value, exit fu
 			c.options.selector, u.Type(), c.container.Type()))
 	}
 
-	p := u.Addr().Interface().(Union).Select(selectorVal)
+	p, err := u.Addr().Interface().(Union).Select(selectorVal)
 	switch {
+	case err != nil:
+		return reflect.Value{}, nil, err
 	case p == nil:
-		return reflect.Value{}, nil, &InvalidSelectorError{selectorVal}
-	case p == NilUnionValue:
 		return reflect.Value{}, nil, nil
 	}
 	elem = reflect.ValueOf(p).Elem()
 
+	// The options that apply to the union field in the container don't apply to the selected member.
 	origOptions := c.options
-	c.options.selector = ""
+	c.options = muOptions{}
 
 	return elem, func() {
 		c.options = origOptions
@@ -269,9 +323,21 @@ func (c *muContext) enterUnionElem(u reflect.Value) (elem reflect.Value, exit fu
 
 }
 
-func (c *muContext) enterSizedType(v reflect.Value) (exit func()) {
+func (c *muContext) enterSizedType(v reflect.Value) (exit func(), err error) {
 	switch {
-	case v.Kind() == reflect.Ptr:
+	case c.options.sized && c.options.raw:
+		return nil, errors.New("the sized and raw options are mutually exclusive")
+	case c.options.sized:
+		// TPM2B types either contain a byte buffer or a single structure. A sized buffer is already handled by the
+		// TPMKindSized path, so the sized option is only meaningful for a pointer to a structure.
+		if v.Kind() != reflect.Ptr || v.Type().Elem().Kind() != reflect.Struct {
+			return nil, fmt.Errorf("invalid sized type %s: the sized option can only be applied to a pointer to a struct", v.Type())
+		}
+		switch tpmKind(v.Type().Elem()) {
+		case TPMKindStruct, TPMKindCustom:
+		default:
+			return nil, fmt.Errorf("invalid sized type %s: the sized option cannot be applied to a pointer to a union", v.Type())
+		}
 	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
 	default:
 		panic(fmt.Sprintf("invalid sized type: %v", v.Type()))
@@ -285,7 +351,14 @@ func (c *muContext) enterSizedType(v reflect.Value) (exit func()) {
 
 	return func() {
 		c.options = origOptions
+	}, nil
+}
+
+func checkRawType(v reflect.Value) error {
+	if v.Kind() != reflect.Slice {
+		return fmt.Errorf("invalid raw type %s: the raw option can only be applied to a slice", v.Type())
 	}
+	return nil
 }
 
 // TPMKind indicates the TPM type class associated with a Go type
@@ -303,6 +376,20 @@ const (
 	TPMKindRawList
 )
 
+// isBinaryMarshalerType indicates whether the supplied type should be marshalled and unmarshalled using the
+// encoding.BinaryMarshaler and encoding.BinaryUnmarshaler interfaces. Types that implement CustomMarshaller take precedence.
+func isBinaryMarshalerType(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	p := reflect.PtrTo(t)
+	if p.Implements(customMuType) {
+		return false
+	}
+	return p.Implements(binaryMarshalerType) && p.Implements(binaryUnmarshalerType)
+}
+
 func tpmKind(t reflect.Type) TPMKind {
 	if t.Kind() == reflect.Ptr {
 		t = t.Elem()
@@ -343,6 +430,10 @@ func DetermineTPMKind(i interface{}) TPMKind {
 		if t.Kind() == reflect.Ptr {
 			t = t.Elem()
 		}
+		if isBinaryMarshalerType(t) {
+			k = TPMKindSized
+			break
+		}
 		k = tpmKind(t)
 		if k != TPMKindStruct {
 			break
@@ -370,38 +461,87 @@ func DetermineTPMKind(i interface{}) TPMKind {
 	}
 }
 
+// maxPooledBufferSize is the maximum capacity of a temporary buffer that will be returned to bufferPool. Sized values are limited
+// to 2^16-1 bytes, so this is large enough for any buffer used for marshalling a sized value.
+const maxPooledBufferSize = math.MaxUint16
+
+// bufferPool contains temporary buffers used for marshalling sized values.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	}}
+
+func getPooledBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putPooledBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
 type marshaller struct {
 	*muContext
-	w      io.Writer
-	nbytes int
+	w       io.Writer
+	nbytes  int
+	scratch [8]byte
 }
 
 func (m *marshaller) Write(p []byte) (n int, err error) {
 	n, err = m.w.Write(p)
 	m.nbytes += n
-	return
+	return n, makeIOError(err)
+}
+
+func (m *marshaller) writeUint16(x uint16) error {
+	binary.BigEndian.PutUint16(m.scratch[:], x)
+	_, err := m.Write(m.scratch[:2])
+	return err
 }
 
 func (m *marshaller) marshalSized(v reflect.Value) error {
-	exit := m.enterSizedType(v)
+	exit, err := m.enterSizedType(v)
+	if err != nil {
+		return err
+	}
 	defer exit()
 
 	if v.IsNil() {
-		if err := binary.Write(m, binary.BigEndian, uint16(0)); err != nil {
+		if err := m.writeUint16(0); err != nil {
 			return xerrors.Errorf("cannot write size of zero sized value: %w", err)
 		}
 		return nil
 	}
 
-	tmpBuf := new(bytes.Buffer)
+	if v.Kind() == reflect.Slice {
+		// Sized buffers are by far the most common sized type, and their size is known up
+		// front, so write them directly rather than via a temporary buffer.
+		if v.Len() > math.MaxUint16 {
+			return &SizeError{"sized value size greater than 2^16-1"}
+		}
+		if err := m.writeUint16(uint16(v.Len())); err != nil {
+			return xerrors.Errorf("cannot write size of sized value: %w", err)
+		}
+		if _, err := m.Write(v.Bytes()); err != nil {
+			return xerrors.Errorf("cannot write marshalled sized value: %w", err)
+		}
+		return nil
+	}
+
+	tmpBuf := getPooledBuffer()
+	defer putPooledBuffer(tmpBuf)
 	sm := &marshaller{muContext: m.muContext, w: tmpBuf}
 	if err := sm.marshalValue(v); err != nil {
 		return err
 	}
 	if tmpBuf.Len() > math.MaxUint16 {
-		return errors.New("sized value size greater than 2^16-1")
+		return &SizeError{"sized value size greater than 2^16-1"}
 	}
-	if err := binary.Write(m, binary.BigEndian, uint16(tmpBuf.Len())); err != nil {
+	if err := m.writeUint16(uint16(tmpBuf.Len())); err != nil {
 		return xerrors.Errorf("cannot write size of sized value: %w", err)
 	}
 	if _, err := tmpBuf.WriteTo(m); err != nil {
@@ -423,6 +563,10 @@ func (m *marshaller) marshalRawList(v reflect.Value) error {
 }
 
 func (m *marshaller) marshalRaw(v reflect.Value) error {
+	if err := checkRawType(v); err != nil {
+		return err
+	}
+
 	switch v.Type().Elem().Kind() {
 	case reflect.Uint8:
 		_, err := m.Write(v.Bytes())
@@ -441,7 +585,32 @@ func (m *marshaller) marshalPtr(v reflect.Value) error {
 }
 
 func (m *marshaller) marshalPrimitive(v reflect.Value) error {
-	return binary.Write(m, binary.BigEndian, v.Interface())
+	// This avoids binary.Write, which allocates a new buffer for every value.
+	var x uint64
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			x = 1
+		}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x = uint64(v.Int())
+	default:
+		x = v.Uint()
+	}
+
+	b := m.scratch[:v.Type().Size()]
+	switch len(b) {
+	case 1:
+		b[0] = uint8(x)
+	case 2:
+		binary.BigEndian.PutUint16(b, uint16(x))
+	case 4:
+		binary.BigEndian.PutUint32(b, uint32(x))
+	case 8:
+		binary.BigEndian.PutUint64(b, x)
+	}
+	_, err := m.Write(b)
+	return err
 }
 
 func (m *marshaller) marshalList(v reflect.Value) error {
@@ -449,7 +618,7 @@ func (m *marshaller) marshalList(v reflect.Value) error {
 	// necessary anyway. For the case where int is 64-bits, truncate to uint32 then zero extend it again to int to make
 	// sure the original number was preserved.
 	if int(uint32(v.Len())) != v.Len() {
-		return errors.New("slice length greater than 2^32-1")
+		return &SizeError{"slice length greater than 2^32-1"}
 	}
 
 	// Marshal length field
@@ -474,8 +643,10 @@ func (m *marshaller) marshalStruct(v reflect.Value) error {
 }
 
 func (m *marshaller) marshalUnion(v reflect.Value) error {
-	// Ignore during marshalling - let the TPM unmarshalling catch it
-	elem, exit, _ := m.enterUnionElem(v)
+	elem, exit, err := m.enterUnionElem(v)
+	if err != nil {
+		return err
+	}
 	if !elem.IsValid() {
 		return nil
 	}
@@ -487,7 +658,48 @@ func (m *marshaller) marshalCustom(v reflect.Value) error {
 	return v.Interface().(CustomMarshaller).Marshal(m)
 }
 
+func (m *marshaller) marshalBinary(v reflect.Value) error {
+	var data []byte
+	if v.Kind() != reflect.Ptr || !v.IsNil() {
+		if v.Kind() != reflect.Ptr {
+			if v.CanAddr() {
+				v = v.Addr()
+			} else {
+				p := reflect.New(v.Type())
+				p.Elem().Set(v)
+				v = p
+			}
+		}
+
+		var err error
+		data, err = v.Interface().(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return xerrors.Errorf("cannot marshal value: %w", err)
+		}
+	}
+
+	if !m.options.raw {
+		if len(data) > math.MaxUint16 {
+			return &SizeError{"sized value size greater than 2^16-1"}
+		}
+		if err := binary.Write(m, binary.BigEndian, uint16(len(data))); err != nil {
+			return xerrors.Errorf("cannot write size of sized value: %w", err)
+		}
+	}
+	if _, err := m.Write(data); err != nil {
+		return xerrors.Errorf("cannot write marshalled value: %w", err)
+	}
+	return nil
+}
+
 func (m *marshaller) marshalValue(v reflect.Value) error {
+	if isBinaryMarshalerType(v.Type()) {
+		if err := m.marshalBinary(v); err != nil {
+			return makeBinaryTypeMuError(v, m.muContext, err)
+		}
+		return nil
+	}
+
 	switch {
 	case m.options.sized:
 		if err := m.marshalSized(v); err != nil {
@@ -550,15 +762,21 @@ type Reader interface {
 
 type unmarshaller struct {
 	*muContext
-	r      io.Reader
-	sz     int64
-	nbytes int
+	r       io.Reader
+	sz      int64
+	nbytes  int
+	scratch [8]byte
 }
 
 func (u *unmarshaller) Read(p []byte) (n int, err error) {
 	n, err = u.r.Read(p)
 	u.nbytes += n
-	return
+	switch err {
+	case nil, io.EOF, io.ErrUnexpectedEOF:
+		return n, err
+	default:
+		return n, makeIOError(err)
+	}
 }
 
 func (u *unmarshaller) Len() int {
@@ -595,6 +813,8 @@ func startingSizeOfReader(r io.Reader) (int64, error) {
 			sz = rImpl.N
 		}
 		return sz, nil
+	case Reader:
+		return int64(rImpl.Len()), nil
 	}
 	return 1<<63 - 1, nil
 }
@@ -608,13 +828,16 @@ func makeUnmarshaller(ctx *muContext, r io.Reader) (*unmarshaller, error) {
 }
 
 func (u *unmarshaller) unmarshalSized(v reflect.Value) error {
-	exit := u.enterSizedType(v)
+	exit, err := u.enterSizedType(v)
+	if err != nil {
+		return err
+	}
 	defer exit()
 
-	var size uint16
-	if err := binary.Read(u, binary.BigEndian, &size); err != nil {
+	if _, err := io.ReadFull(u, u.scratch[:2]); err != nil {
 		return xerrors.Errorf("cannot read size of sized value: %w", err)
 	}
+	size := binary.BigEndian.Uint16(u.scratch[:])
 
 	switch {
 	case size == 0 && !v.IsNil() && v.Kind() == reflect.Ptr:
@@ -622,9 +845,12 @@ func (u *unmarshaller) unmarshalSized(v reflect.Value) error {
 	case size == 0:
 		return nil
 	case int(size) > u.Len():
-		return errors.New("sized value has a size larger than the remaining bytes")
+		return &SizeError{"sized value has a size larger than the remaining bytes"}
 	case v.Kind() == reflect.Slice:
-		v.Set(reflect.MakeSlice(v.Type(), int(size), int(size)))
+		// Read sized buffers directly without creating a new unmarshaller.
+		v.SetBytes(make([]byte, size))
+		_, err := io.ReadFull(u, v.Bytes())
+		return err
 	}
 
 	su, err := makeUnmarshaller(u.muContext, io.LimitReader(u, int64(size)))
@@ -648,6 +874,10 @@ func (u *unmarshaller) unmarshalRawList(v reflect.Value, n int) (reflect.Value,
 }
 
 func (u *unmarshaller) unmarshalRaw(v reflect.Value) error {
+	if err := checkRawType(v); err != nil {
+		return err
+	}
+
 	switch v.Type().Elem().Kind() {
 	case reflect.Uint8:
 		_, err := io.ReadFull(u, v.Bytes())
@@ -715,7 +945,54 @@ func (u *unmarshaller) unmarshalCustom(v reflect.Value) error {
 	return v.Interface().(CustomUnmarshaller).Unmarshal(u)
 }
 
+func (u *unmarshaller) unmarshalBinary(v reflect.Value) error {
+	var data []byte
+	if u.options.raw {
+		var err error
+		data, err = ioutil.ReadAll(u)
+		if err != nil {
+			return xerrors.Errorf("cannot read raw value: %w", err)
+		}
+	} else {
+		var size uint16
+		if err := binary.Read(u, binary.BigEndian, &size); err != nil {
+			return xerrors.Errorf("cannot read size of sized value: %w", err)
+		}
+
+		switch {
+		case size == 0 && v.Kind() == reflect.Ptr:
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		case int(size) > u.Len():
+			return &SizeError{"sized value has a size larger than the remaining bytes"}
+		}
+
+		data = make([]byte, size)
+		if _, err := io.ReadFull(u, data); err != nil {
+			return xerrors.Errorf("cannot read sized value: %w", err)
+		}
+	}
+
+	switch {
+	case v.Kind() != reflect.Ptr:
+		v = v.Addr()
+	case v.IsNil():
+		v.Set(reflect.New(v.Type().Elem()))
+	}
+	if err := v.Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(data); err != nil {
+		return xerrors.Errorf("cannot unmarshal value: %w", err)
+	}
+	return nil
+}
+
 func (u *unmarshaller) unmarshalValue(v reflect.Value) error {
+	if isBinaryMarshalerType(v.Type()) {
+		if err := u.unmarshalBinary(v); err != nil {
+			return makeBinaryTypeMuError(v, u.muContext, err)
+		}
+		return nil
+	}
+
 	switch {
 	case u.options.sized:
 		if err := u.unmarshalSized(v); err != nil {
@@ -777,8 +1054,9 @@ func (u *unmarshaller) unmarshalValue(v reflect.Value) error {
 // the number of bytes written.
 func MarshalToWriter(w io.Writer, vals ...interface{}) (int, error) {
 	var totalBytes int
+	m := &marshaller{muContext: new(muContext), w: w}
 	for i, val := range vals {
-		m := &marshaller{muContext: new(muContext), w: w}
+		m.nbytes = 0
 		err := m.marshalValue(reflect.ValueOf(val))
 		totalBytes += m.nbytes
 		if err != nil {
@@ -788,17 +1066,37 @@ func MarshalToWriter(w io.Writer, vals ...interface{}) (int, error) {
 	return totalBytes, nil
 }
 
+type sliceWriter struct {
+	b []byte
+}
+
+func (w *sliceWriter) Write(p []byte) (int, error) {
+	w.b = append(w.b, p...)
+	return len(p), nil
+}
+
+// MarshalAppend marshals vals to the TPM wire format, according to the rules specified in the package description, and appends
+// the result to b. A nil pointer encountered during marshalling causes the zero value for the type to be marshalled, unless the
+// pointer is to a sized structure. This can be used to reduce allocations by callers that marshal values frequently, by reusing
+// the same slice.
+//
+// If successful, this function returns the extended slice. If this function does not complete successfully, it will return an
+// error. In this case, no data will be returned, although the spare capacity of b may have been modified.
+func MarshalAppend(b []byte, vals ...interface{}) ([]byte, error) {
+	w := &sliceWriter{b: b}
+	if _, err := MarshalToWriter(w, vals...); err != nil {
+		return nil, err
+	}
+	return w.b, nil
+}
+
 // MarshalToBytes marshals vals to the TPM wire format, according to the rules specified in the package description. A nil pointer
 // encountered during marshalling causes the zero value for the type to be marshalled, unless the pointer is to a sized structure.
 //
 // If successful, this function returns the marshalled data. If this function does not complete successfully, it will return an error.
 // In this case, no data will be returned.
 func MarshalToBytes(vals ...interface{}) ([]byte, error) {
-	buf := new(bytes.Buffer)
-	if _, err := MarshalToWriter(buf, vals...); err != nil {
-		return nil, err
-	}
-	return buf.Bytes(), nil
+	return MarshalAppend(nil, vals...)
 }
 
 // UnmarshalFromReader unmarshals data in the TPM wire format from r to vals, according to the rules specified in the package
@@ -834,6 +1132,49 @@ func UnmarshalFromReader(r io.Reader, vals ...interface{}) (int, error) {
 	return totalBytes, nil
 }
 
+// Unmarshaller unmarshals data in the TPM wire format from an io.Reader across multiple calls, and keeps track of the total number
+// of bytes consumed. This is useful for parsing structures that consist of several parts.
+type Unmarshaller struct {
+	r      io.Reader
+	sz     int64
+	nbytes int
+}
+
+// NewUnmarshaller returns a new Unmarshaller that reads from r.
+func NewUnmarshaller(r io.Reader) (*Unmarshaller, error) {
+	sz, err := startingSizeOfReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &Unmarshaller{r: r, sz: sz}, nil
+}
+
+// Read implements io.Reader, and permits the caller to read raw bytes from the underlying reader. Bytes read this way are included
+// in the total returned from BytesRead.
+func (u *Unmarshaller) Read(p []byte) (n int, err error) {
+	n, err = u.r.Read(p)
+	u.nbytes += n
+	return
+}
+
+// Len returns the number of bytes remaining in the underlying reader, if this can be determined.
+func (u *Unmarshaller) Len() int {
+	return int(u.sz - int64(u.nbytes))
+}
+
+// BytesRead returns the total number of bytes consumed from the underlying reader.
+func (u *Unmarshaller) BytesRead() int {
+	return u.nbytes
+}
+
+// Unmarshal unmarshals data in the TPM wire format to vals, according to the same rules as UnmarshalFromReader. If this function
+// does not complete successfully, it will return an error. In this case, partial results may have been unmarshalled to the supplied
+// destination values, and the bytes consumed will still be included in the total returned from BytesRead.
+func (u *Unmarshaller) Unmarshal(vals ...interface{}) error {
+	_, err := UnmarshalFromReader(u, vals...)
+	return err
+}
+
 // UnmarshalFromBytes unmarshals data in the TPM wire format from b to vals, according to the rules specified in the package
 // description. The values supplied to this function must be pointers to the destination values. Nil pointers encountered during
 // unmarshalling will be initialized to point to newly allocated memory, unless the pointer represents a zero-sized structure. New
@@ -847,3 +1188,17 @@ func UnmarshalFromBytes(b []byte, vals ...interface{}) (int, error) {
 	buf := bytes.NewReader(b)
 	return UnmarshalFromReader(buf, vals...)
 }
+
+// UnmarshalFromBytesStrict behaves like UnmarshalFromBytes, except that it returns a *TrailingBytesError error if any bytes remain
+// in b after unmarshalling has completed successfully. This is useful for callers that expect b to contain exactly the supplied
+// values.
+func UnmarshalFromBytesStrict(b []byte, vals ...interface{}) (int, error) {
+	n, err := UnmarshalFromBytes(b, vals...)
+	if err != nil {
+		return n, err
+	}
+	if n < len(b) {
+		return n, &TrailingBytesError{N: len(b) - n}
+	}
+	return n, nil
+}
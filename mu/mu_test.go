@@ -14,6 +14,8 @@ import (
 	. "github.com/canonical/go-tpm2/mu"
 	"github.com/canonical/go-tpm2/testutil"
 
+	"golang.org/x/xerrors"
+
 	. "gopkg.in/check.v1"
 )
 
@@ -109,6 +111,73 @@ func (s *muSuite) TestMarshalAndUnmarshalPrimitives(c *C) {
 	s.testMarshalAndUnmarshalIO(c, data)
 }
 
+func (s *muSuite) TestMarshalAppend(c *C) {
+	b := make([]byte, 2, 16)
+	b[0] = 0xa5
+	b[1] = 0x5a
+
+	out, err := MarshalAppend(b, uint16(1156), []byte{1, 2, 3}, uint32(45623564))
+	c.Check(err, IsNil)
+	c.Check(out, DeepEquals, testutil.DecodeHexString(c, "a55a0484000301020302b8290c"))
+	c.Check(&out[0], Equals, &b[0])
+}
+
+func (s *muSuite) TestMarshalAppendError(c *C) {
+	out, err := MarshalAppend([]byte{0xa5}, uint16(1156), make([]byte, 70000))
+	c.Check(err, ErrorMatches, "cannot marshal argument at index 1: cannot process sized type \\[\\]uint8: sized value size greater than 2\\^16-1")
+	c.Check(out, IsNil)
+}
+
+func (s *muSuite) TestUnmarshalFromBytesStrict(c *C) {
+	var a uint16
+	var b []byte
+	n, err := UnmarshalFromBytesStrict(testutil.DecodeHexString(c, "04840003010203"), &a, &b)
+	c.Check(err, IsNil)
+	c.Check(n, Equals, 7)
+	c.Check(a, Equals, uint16(1156))
+	c.Check(b, DeepEquals, []byte{1, 2, 3})
+}
+
+func (s *muSuite) TestUnmarshalFromBytesStrictTrailingBytes(c *C) {
+	var a uint16
+	n, err := UnmarshalFromBytesStrict(testutil.DecodeHexString(c, "04840003"), &a)
+	c.Check(err, ErrorMatches, "2 trailing byte\\(s\\) after unmarshalling")
+	c.Check(n, Equals, 2)
+
+	var e *TrailingBytesError
+	c.Assert(xerrors.As(err, &e), testutil.IsTrue)
+	c.Check(e.N, Equals, 2)
+}
+
+func (s *muSuite) TestUnmarshaller(c *C) {
+	u, err := NewUnmarshaller(bytes.NewReader(testutil.DecodeHexString(c, "048400000003a5a5a5000301020302b8290c")))
+	c.Assert(err, IsNil)
+	c.Check(u.Len(), Equals, 18)
+
+	var a uint16
+	var b uint32
+	c.Check(u.Unmarshal(&a, &b), IsNil)
+	c.Check(a, Equals, uint16(1156))
+	c.Check(b, Equals, uint32(3))
+	c.Check(u.BytesRead(), Equals, 6)
+
+	raw := make([]byte, b)
+	_, err = io.ReadFull(u, raw)
+	c.Check(err, IsNil)
+	c.Check(raw, DeepEquals, []byte{0xa5, 0xa5, 0xa5})
+	c.Check(u.BytesRead(), Equals, 9)
+
+	var d []byte
+	var e uint32
+	c.Check(u.Unmarshal(&d, &e), IsNil)
+	c.Check(d, DeepEquals, []byte{1, 2, 3})
+	c.Check(e, Equals, uint32(45623564))
+	c.Check(u.BytesRead(), Equals, 18)
+	c.Check(u.Len(), Equals, 0)
+
+	c.Check(u.Unmarshal(&a), ErrorMatches, "cannot unmarshal argument at index 0: cannot process primitive type uint16: EOF")
+}
+
 func (s *muSuite) TestMarshalAndUnmarshalPtrs(c *C) {
 	var x uint32 = 45623564
 	var y bool = true
@@ -331,18 +400,18 @@ type testUnion struct {
 	C uint16
 }
 
-func (t *testUnion) Select(selector reflect.Value) interface{} {
+func (t *testUnion) Select(selector reflect.Value) (interface{}, error) {
 	switch selector.Interface().(uint32) {
 	case 1:
-		return &t.A
+		return &t.A, nil
 	case 2:
-		return &t.B
+		return &t.B, nil
 	case 3:
-		return &t.C
+		return &t.C, nil
 	case 4:
-		return NilUnionValue
+		return nil, nil
 	default:
-		return nil
+		return nil, &InvalidSelectorError{Selector: selector}
 	}
 }
 
@@ -406,6 +475,71 @@ func (s *muSuite) TestMarshalAndUnmarshalCustomMarshaller(c *C) {
 		expected: expected})
 }
 
+type testBinaryMarshaler struct {
+	A uint16
+	B string
+}
+
+func (t testBinaryMarshaler) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 2+len(t.B))
+	binary.LittleEndian.PutUint16(b, t.A)
+	copy(b[2:], t.B)
+	return b, nil
+}
+
+func (t *testBinaryMarshaler) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 {
+		return io.ErrUnexpectedEOF
+	}
+	t.A = binary.LittleEndian.Uint16(data)
+	t.B = string(data[2:])
+	return nil
+}
+
+type testStructWithBinaryMarshalerFields struct {
+	A *testBinaryMarshaler
+	B uint32
+	C testBinaryMarshaler `tpm2:"raw"`
+}
+
+func (s *muSuite) TestMarshalAndUnmarshalBinaryMarshaler(c *C) {
+	a := testBinaryMarshaler{A: 4321, B: "foo"}
+	expected := testutil.DecodeHexString(c, "0005e110666f6f")
+
+	s.testMarshalAndUnmarshalBytes(c, &testMarshalAndUnmarshalData{
+		values:   []interface{}{a},
+		expected: expected})
+	s.testMarshalAndUnmarshalIO(c, &testMarshalAndUnmarshalData{
+		values:   []interface{}{a},
+		expected: expected})
+}
+
+func (s *muSuite) TestMarshalAndUnmarshalBinaryMarshalerFields(c *C) {
+	a := testStructWithBinaryMarshalerFields{A: &testBinaryMarshaler{A: 1, B: "bar"}, B: 6, C: testBinaryMarshaler{A: 2, B: "baz"}}
+	b := testStructWithBinaryMarshalerFields{B: 7, C: testBinaryMarshaler{A: 3}}
+	expected := testutil.DecodeHexString(c, "0005010062617200000006020062617a0000000000070300")
+
+	s.testMarshalAndUnmarshalBytes(c, &testMarshalAndUnmarshalData{
+		values:         []interface{}{a},
+		expected:       expected[:16],
+		unmarshalDests: []interface{}{&testStructWithBinaryMarshalerFields{}}})
+	s.testMarshalAndUnmarshalBytes(c, &testMarshalAndUnmarshalData{
+		values:         []interface{}{b},
+		expected:       expected[16:],
+		unmarshalDests: []interface{}{&testStructWithBinaryMarshalerFields{}}})
+}
+
+func (s *muSuite) TestUnmarshalBinaryMarshalerError(c *C) {
+	var a testBinaryMarshaler
+	_, err := UnmarshalFromBytes(testutil.DecodeHexString(c, "000101"), &a)
+	c.Check(err, ErrorMatches, "cannot unmarshal argument at index 0: cannot process binary type mu_test.testBinaryMarshaler: "+
+		"cannot unmarshal value: unexpected EOF")
+}
+
+func (s *muSuite) TestDetermineTPMKindBinaryMarshaler(c *C) {
+	s.testDetermineTPMKind(c, &testDetermineTPMKindData{d: testBinaryMarshaler{}, k: TPMKindSized})
+}
+
 type testStructWithRawTagSizedFields struct {
 	A [][]byte `tpm2:"raw"`
 }
@@ -498,16 +632,30 @@ func (s *muSuite) TestDetermineTPMKindRawList(c *C) {
 	s.testDetermineTPMKind(c, &testDetermineTPMKindData{d: testStructWithRawListField{}, k: TPMKindRawList})
 }
 
-func (s *muSuite) TestMarshalAndUnmarshalUnionWithInvalidSelector(c *C) {
+func (s *muSuite) TestMarshalUnionWithInvalidSelector(c *C) {
 	w := testUnionContainer{Select: 259}
-	b, err := MarshalToBytes(w)
-	c.Check(err, IsNil)
+	_, err := MarshalToBytes(w)
+	c.Check(err, ErrorMatches, "cannot marshal argument at index 0: cannot process struct type mu_test.testUnionContainer: cannot "+
+		"process field Union from struct type mu_test.testUnionContainer: cannot process union type mu_test.testUnion, inside container "+
+		"type mu_test.testUnionContainer: invalid selector value: 259")
+
+	var e *InvalidSelectorError
+	c.Assert(xerrors.As(err, &e), testutil.IsTrue)
+	c.Check(e.Selector.Interface(), Equals, uint32(259))
+}
+
+func (s *muSuite) TestUnmarshalUnionWithInvalidSelector(c *C) {
+	b := testutil.DecodeHexString(c, "00000103")
 
 	var uw testUnionContainer
-	_, err = UnmarshalFromBytes(b, &uw)
+	_, err := UnmarshalFromBytes(b, &uw)
 	c.Check(err, ErrorMatches, "cannot unmarshal argument at index 0: cannot process struct type mu_test.testUnionContainer: cannot "+
 		"process field Union from struct type mu_test.testUnionContainer: cannot process union type mu_test.testUnion, inside container "+
 		"type mu_test.testUnionContainer: invalid selector value: 259")
+
+	var e *InvalidSelectorError
+	c.Assert(xerrors.As(err, &e), testutil.IsTrue)
+	c.Check(e.Selector.Interface(), Equals, uint32(259))
 }
 
 func (s *muSuite) TestUnmarshalZeroSizedFieldToNonNilPointer(c *C) {
@@ -564,7 +712,98 @@ type testStructWithInvalidSizedField struct {
 
 func (s *muSuite) TestMarshalInvalidSizedField(c *C) {
 	a := testStructWithInvalidSizedField{}
-	c.Check(func() { MarshalToBytes(a) }, PanicMatches, "invalid sized type: mu_test.testStruct")
+	_, err := MarshalToBytes(a)
+	c.Check(err, ErrorMatches, "cannot marshal argument at index 0: cannot process struct type mu_test.testStructWithInvalidSizedField: "+
+		"cannot process field A from struct type mu_test.testStructWithInvalidSizedField: cannot process sized type mu_test.testStruct, "+
+		"inside container type mu_test.testStructWithInvalidSizedField: invalid sized type mu_test.testStruct: the sized option can "+
+		"only be applied to a pointer to a struct")
+}
+
+type testStructWithInvalidSizedField2 struct {
+	A *uint32 `tpm2:"sized"`
+}
+
+func (s *muSuite) TestMarshalInvalidSizedField2(c *C) {
+	a := testStructWithInvalidSizedField2{}
+	_, err := MarshalToBytes(a)
+	c.Check(err, ErrorMatches, "cannot marshal argument at index 0: cannot process struct type mu_test.testStructWithInvalidSizedField2: "+
+		"cannot process field A from struct type mu_test.testStructWithInvalidSizedField2: cannot process sized type \\*uint32, "+
+		"inside container type mu_test.testStructWithInvalidSizedField2: invalid sized type \\*uint32: the sized option can only be "+
+		"applied to a pointer to a struct")
+}
+
+func (s *muSuite) TestUnmarshalInvalidSizedField(c *C) {
+	var a testStructWithInvalidSizedField2
+	_, err := UnmarshalFromBytes(testutil.DecodeHexString(c, "000400000001"), &a)
+	c.Check(err, ErrorMatches, "cannot unmarshal argument at index 0: cannot process struct type mu_test.testStructWithInvalidSizedField2: "+
+		"cannot process field A from struct type mu_test.testStructWithInvalidSizedField2: cannot process sized type \\*uint32, "+
+		"inside container type mu_test.testStructWithInvalidSizedField2: invalid sized type \\*uint32: the sized option can only be "+
+		"applied to a pointer to a struct")
+}
+
+type testSizedUnionContainer struct {
+	Select uint32
+	Union  *testUnion `tpm2:"selector:Select,sized"`
+}
+
+func (s *muSuite) TestMarshalSizedUnion(c *C) {
+	a := testSizedUnionContainer{Select: 3, Union: &testUnion{C: 5}}
+	_, err := MarshalToBytes(a)
+	c.Check(err, ErrorMatches, "cannot marshal argument at index 0: cannot process struct type mu_test.testSizedUnionContainer: "+
+		"cannot process field Union from struct type mu_test.testSizedUnionContainer: cannot process sized type \\*mu_test.testUnion, "+
+		"inside container type mu_test.testSizedUnionContainer: invalid sized type \\*mu_test.testUnion: the sized option cannot be "+
+		"applied to a pointer to a union")
+}
+
+type testStructWithSizedAndRawField struct {
+	A *testStruct `tpm2:"sized,raw"`
+}
+
+func (s *muSuite) TestMarshalSizedAndRawField(c *C) {
+	a := testStructWithSizedAndRawField{}
+	_, err := MarshalToBytes(a)
+	c.Check(err, ErrorMatches, "cannot marshal argument at index 0: cannot process struct type mu_test.testStructWithSizedAndRawField: "+
+		"cannot process field A from struct type mu_test.testStructWithSizedAndRawField: cannot process sized type \\*mu_test.testStruct, "+
+		"inside container type mu_test.testStructWithSizedAndRawField: the sized and raw options are mutually exclusive")
+}
+
+type testStructWithInvalidRawField struct {
+	A uint32 `tpm2:"raw"`
+}
+
+func (s *muSuite) TestMarshalInvalidRawField(c *C) {
+	a := testStructWithInvalidRawField{}
+	_, err := MarshalToBytes(a)
+	c.Check(err, ErrorMatches, "cannot marshal argument at index 0: cannot process struct type mu_test.testStructWithInvalidRawField: "+
+		"cannot process field A from struct type mu_test.testStructWithInvalidRawField: cannot process raw type uint32, inside container "+
+		"type mu_test.testStructWithInvalidRawField: invalid raw type uint32: the raw option can only be applied to a slice")
+}
+
+type testUnionWithSizedMember struct {
+	A []byte
+}
+
+func (t *testUnionWithSizedMember) Select(selector reflect.Value) (interface{}, error) {
+	switch selector.Interface().(uint32) {
+	case 1:
+		return &t.A, nil
+	default:
+		return nil, &InvalidSelectorError{Selector: selector}
+	}
+}
+
+type testUnionWithSizedMemberContainer struct {
+	Select uint32
+	Union  *testUnionWithSizedMember `tpm2:"selector:Select"`
+}
+
+func (s *muSuite) TestMarshalAndUnmarshalSizedBufferInsideUnion(c *C) {
+	a := testUnionWithSizedMemberContainer{Select: 1, Union: &testUnionWithSizedMember{A: []byte{1, 2, 3}}}
+	expected := testutil.DecodeHexString(c, "000000010003010203")
+
+	s.testMarshalAndUnmarshalBytes(c, &testMarshalAndUnmarshalData{
+		values:   []interface{}{a},
+		expected: expected})
 }
 
 func (s *muSuite) TestMarshalUnsupportedType(c *C) {
@@ -647,3 +886,43 @@ func (s *muSuite) TestMashalErrorList(c *C) {
 		[]uint32{0},
 		"cannot marshal argument at index 0: cannot process list type \\[\\]uint32: cannot write length of list: io: read/write on closed pipe"})
 }
+
+func (s *muSuite) TestMarshalIOError(c *C) {
+	_, err := MarshalToWriter(&testBrokenWriter{}, uint16(0))
+	var e *IOError
+	c.Assert(xerrors.As(err, &e), testutil.IsTrue)
+	c.Check(xerrors.Is(err, io.ErrClosedPipe), testutil.IsTrue)
+}
+
+type testBrokenReader struct{}
+
+func (*testBrokenReader) Read(data []byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+func (s *muSuite) TestUnmarshalIOError(c *C) {
+	var a uint16
+	_, err := UnmarshalFromReader(&testBrokenReader{}, &a)
+	c.Check(err, ErrorMatches, "cannot unmarshal argument at index 0: cannot process primitive type uint16: io: read/write on closed pipe")
+	var e *IOError
+	c.Assert(xerrors.As(err, &e), testutil.IsTrue)
+	c.Check(xerrors.Is(err, io.ErrClosedPipe), testutil.IsTrue)
+}
+
+func (s *muSuite) TestUnmarshalTruncatedIsNotIOError(c *C) {
+	var a uint32
+	_, err := UnmarshalFromBytes([]byte{0, 1}, &a)
+	c.Check(xerrors.Is(err, io.ErrUnexpectedEOF), testutil.IsTrue)
+	var e *IOError
+	c.Check(xerrors.As(err, &e), testutil.IsFalse)
+}
+
+func (s *muSuite) TestSizeError(c *C) {
+	var o []byte
+	_, err := UnmarshalFromBytes(testutil.DecodeHexString(c, "ffff0000"), &o)
+	var e *SizeError
+	c.Check(xerrors.As(err, &e), testutil.IsTrue)
+
+	_, err = MarshalToBytes(make([]byte, 100000))
+	c.Check(xerrors.As(err, &e), testutil.IsTrue)
+}
@@ -0,0 +1,127 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2
+
+import (
+	"fmt"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// platformCertHandleFirst and platformCertHandleLast are the bounds of the NV index range that the TCG handle registry
+	// reserves for the platform manufacturer, which is where platform certificates are stored.
+	platformCertHandleFirst Handle = 0x01c08000
+	platformCertHandleLast  Handle = 0x01c0ffff
+
+	// idevidCertHandleFirst and idevidCertHandleLast are the bounds of the NV index range that the TCG handle registry reserves
+	// for the component OEM, which is where IDevID and IAK certificates are stored.
+	idevidCertHandleFirst Handle = 0x01c90000
+	idevidCertHandleLast  Handle = 0x01c9ffff
+)
+
+// highRangeEKCertHandles are the NV indices of the EK certificates for the high range templates defined by the TCG EK Credential
+// Profile.
+var highRangeEKCertHandles = []Handle{0x01c00012, 0x01c00014, 0x01c00016, 0x01c00018, 0x01c0001a, 0x01c0001c, 0x01c0001e}
+
+// NVIndexPurpose describes the well-known purpose of a NV index, as determined by its handle.
+type NVIndexPurpose int
+
+const (
+	// NVIndexPurposeUnknown indicates that the handle of the NV index doesn't correspond to a well-known purpose.
+	NVIndexPurposeUnknown NVIndexPurpose = iota
+
+	// NVIndexPurposeEKCertificate indicates that the NV index is one that the TCG EK Credential Profile defines for storing an EK
+	// certificate.
+	NVIndexPurposeEKCertificate
+
+	// NVIndexPurposePlatformCertificate indicates that the NV index is in the range reserved for the platform manufacturer,
+	// which is used for storing platform certificates.
+	NVIndexPurposePlatformCertificate
+
+	// NVIndexPurposeIDevIDCertificate indicates that the NV index is in the range reserved for the component OEM, which is used
+	// for storing IDevID and IAK certificates.
+	NVIndexPurposeIDevIDCertificate
+)
+
+func (p NVIndexPurpose) String() string {
+	switch p {
+	case NVIndexPurposeUnknown:
+		return "unknown"
+	case NVIndexPurposeEKCertificate:
+		return "EK certificate"
+	case NVIndexPurposePlatformCertificate:
+		return "platform certificate"
+	case NVIndexPurposeIDevIDCertificate:
+		return "IDevID certificate"
+	default:
+		return fmt.Sprintf("NVIndexPurpose(%d)", int(p))
+	}
+}
+
+// ClassifyNVIndex returns the well-known purpose of the NV index with the specified handle, based on the handle assignments
+// defined by the TCG. This only indicates the purpose that is implied by the handle - it doesn't check the contents of the index.
+func ClassifyNVIndex(handle Handle) NVIndexPurpose {
+	switch {
+	case handle == rsaEKCertHandle || handle == eccEKCertHandle:
+		return NVIndexPurposeEKCertificate
+	case handle >= platformCertHandleFirst && handle <= platformCertHandleLast:
+		return NVIndexPurposePlatformCertificate
+	case handle >= idevidCertHandleFirst && handle <= idevidCertHandleLast:
+		return NVIndexPurposeIDevIDCertificate
+	}
+	for _, h := range highRangeEKCertHandles {
+		if handle == h {
+			return NVIndexPurposeEKCertificate
+		}
+	}
+	return NVIndexPurposeUnknown
+}
+
+// NVIndexDescriptor describes a NV index that is defined on the TPM, and is returned from TPMContext.NVIndexInventory.
+type NVIndexDescriptor struct {
+	Context ResourceContext // Context for the index, which can be used with the NV commands
+	Public  *NVPublic       // Public area of the index
+	Type    NVType          // Type of the index
+	Purpose NVIndexPurpose  // Well-known purpose of the index, based on its handle
+	Written bool            // Whether the index has been written to (AttrNVWritten)
+}
+
+// NVIndexInventory is a helper function that returns a descriptor for each of the NV indices that are currently defined on the
+// TPM. The handles are obtained with TPMContext.GetCapabilityAllHandles, and a ResourceContext is created for each one with
+// TPMContext.CreateResourceContextFromTPM, with any supplied sessions being used for both. Each index is classified according to
+// its type and the well-known purpose implied by its handle (see ClassifyNVIndex).
+//
+// Indices that are undefined between obtaining the list of handles and reading their public areas are omitted from the result.
+func (t *TPMContext) NVIndexInventory(sessions ...SessionContext) ([]*NVIndexDescriptor, error) {
+	handles, err := t.GetCapabilityAllHandles(HandleTypeNVIndex, sessions...)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot obtain NV index handles: %w", err)
+	}
+
+	var descriptors []*NVIndexDescriptor
+	for _, handle := range handles {
+		if handle.Type() != HandleTypeNVIndex {
+			continue
+		}
+		context, err := t.CreateResourceContextFromTPM(handle, sessions...)
+		switch {
+		case xerrors.Is(err, ResourceUnavailableError{handle}):
+			continue
+		case err != nil:
+			return nil, xerrors.Errorf("cannot create context for NV index 0x%08x: %w", handle, err)
+		}
+
+		public := context.(*nvIndexContext).GetPublic()
+		descriptors = append(descriptors, &NVIndexDescriptor{
+			Context: context,
+			Public:  public,
+			Type:    public.Attrs.Type(),
+			Purpose: ClassifyNVIndex(handle),
+			Written: public.Attrs&AttrNVWritten != 0})
+	}
+
+	return descriptors, nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	"testing"
+
+	. "github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+func TestClassifyNVIndex(t *testing.T) {
+	for _, data := range []struct {
+		handle  Handle
+		purpose NVIndexPurpose
+	}{
+		{handle: 0x01c00002, purpose: NVIndexPurposeEKCertificate},
+		{handle: 0x01c0000a, purpose: NVIndexPurposeEKCertificate},
+		{handle: 0x01c00016, purpose: NVIndexPurposeEKCertificate},
+		{handle: 0x01c00004, purpose: NVIndexPurposeUnknown},
+		{handle: 0x01c08000, purpose: NVIndexPurposePlatformCertificate},
+		{handle: 0x01c0ffff, purpose: NVIndexPurposePlatformCertificate},
+		{handle: 0x01c90000, purpose: NVIndexPurposeIDevIDCertificate},
+		{handle: 0x01800000, purpose: NVIndexPurposeUnknown},
+	} {
+		if purpose := ClassifyNVIndex(data.handle); purpose != data.purpose {
+			t.Errorf("Unexpected purpose for handle 0x%08x: %v", data.handle, purpose)
+		}
+	}
+}
+
+func TestNVIndexInventory(t *testing.T) {
+	readPublic := func(pub *NVPublic) *testutil.MockCommand {
+		name, err := pub.Name()
+		if err != nil {
+			t.Fatalf("Name failed: %v", err)
+		}
+		b, err := mu.MarshalToBytes(pub)
+		if err != nil {
+			t.Fatalf("MarshalToBytes failed: %v", err)
+		}
+		return &testutil.MockCommand{CommandCode: CommandNVReadPublic, Handles: []Handle{pub.Index},
+			Response: &testutil.MockResponse{Params: []interface{}{uint16(len(b)), mu.RawBytes(b), name}}}
+	}
+
+	ekCert := &NVPublic{
+		Index:   0x01c00002,
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVPPWrite | AttrNVAuthRead | AttrNVOwnerRead | AttrNVNoDA | AttrNVWritten | AttrNVPlatformCreate),
+		Size:    1024}
+	counter := &NVPublic{
+		Index:   0x01800000,
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeCounter.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead),
+		Size:    8}
+
+	tcti := testutil.NewMockTCTI(
+		&testutil.MockCommand{CommandCode: CommandGetCapability, Response: &testutil.MockResponse{Params: []interface{}{false,
+			&CapabilityData{Capability: CapabilityHandles, Data: &CapabilitiesU{Handles: HandleList{0x01800000, 0x01800001, 0x01c00002}}}}}},
+		readPublic(counter),
+		&testutil.MockCommand{CommandCode: CommandNVReadPublic, Handles: []Handle{0x01800001},
+			Response: &testutil.MockResponse{ResponseCode: ResponseCode(0x18b)}},
+		readPublic(ekCert))
+	tpm, _ := NewTPMContext(tcti)
+
+	descriptors, err := tpm.NVIndexInventory()
+	if err != nil {
+		t.Fatalf("NVIndexInventory failed: %v", err)
+	}
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+
+	if len(descriptors) != 2 {
+		t.Fatalf("Unexpected number of descriptors: %d", len(descriptors))
+	}
+	if d := descriptors[0]; d.Context.Handle() != 0x01800000 || d.Type != NVTypeCounter || d.Purpose != NVIndexPurposeUnknown || d.Written {
+		t.Errorf("Unexpected descriptor: %+v", d)
+	}
+	if d := descriptors[1]; d.Context.Handle() != 0x01c00002 || d.Type != NVTypeOrdinary || d.Purpose != NVIndexPurposeEKCertificate ||
+		!d.Written || d.Public.Size != 1024 {
+		t.Errorf("Unexpected descriptor: %+v", d)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// OperandComparison describes a comparison between the value read by TPM2_PolicyNV or TPM2_PolicyCounterTimer (operand A) and the
+// value supplied by the caller (operand B).
+type OperandComparison uint8
+
+const (
+	CompareEqual              OperandComparison = iota // A == B
+	CompareNotEqual                                    // A != B
+	CompareGreaterThan                                 // A > B
+	CompareLessThan                                    // A < B
+	CompareGreaterThanOrEqual                          // A >= B
+	CompareLessThanOrEqual                             // A <= B
+)
+
+// Offsets of the fields of the marshalled TimeInfo structure that TPM2_PolicyCounterTimer compares against.
+const (
+	TimeInfoTimeOffset         uint16 = 0  // TimeInfo.Time (8 bytes)
+	TimeInfoClockOffset        uint16 = 8  // TimeInfo.ClockInfo.Clock (8 bytes)
+	TimeInfoResetCountOffset   uint16 = 16 // TimeInfo.ClockInfo.ResetCount (4 bytes)
+	TimeInfoRestartCountOffset uint16 = 20 // TimeInfo.ClockInfo.RestartCount (4 bytes)
+	TimeInfoSafeOffset         uint16 = 24 // TimeInfo.ClockInfo.Safe (1 byte)
+)
+
+// OperandTerms contains the operandB, offset and operation arguments for TPMContext.PolicyNV and TPMContext.PolicyCounterTimer
+// (and the equivalent TrialAuthPolicy and PolicySession methods). It should be created with UnsignedOperand, SignedOperand,
+// BitsetOperand or BitclearOperand, which take care of encoding operand B in big-endian form with the width of the value being
+// compared and of selecting the correct signed or unsigned operation.
+type OperandTerms struct {
+	OperandB  Operand
+	Offset    uint16
+	Operation ArithmeticOp
+}
+
+var (
+	unsignedOps = map[OperandComparison]ArithmeticOp{
+		CompareEqual:              OpEq,
+		CompareNotEqual:           OpNeq,
+		CompareGreaterThan:        OpUnsignedGT,
+		CompareLessThan:           OpUnsignedLT,
+		CompareGreaterThanOrEqual: OpUnsignedGE,
+		CompareLessThanOrEqual:    OpUnsignedLE}
+	signedOps = map[OperandComparison]ArithmeticOp{
+		CompareEqual:              OpEq,
+		CompareNotEqual:           OpNeq,
+		CompareGreaterThan:        OpSignedGT,
+		CompareLessThan:           OpSignedLT,
+		CompareGreaterThanOrEqual: OpSignedGE,
+		CompareLessThanOrEqual:    OpSignedLE}
+)
+
+func makeOperand(size int, value uint64) Operand {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], value)
+	return Operand(b[8-size:])
+}
+
+func checkOperandSize(size int) error {
+	switch size {
+	case 1, 2, 4, 8:
+		return nil
+	default:
+		return makeInvalidArgError("size", fmt.Sprintf("invalid size %d (must be 1, 2, 4 or 8 bytes)", size))
+	}
+}
+
+// UnsignedOperand returns the terms for comparing the unsigned integer of the specified size in bytes at offset with value. An
+// error is returned if value doesn't fit in to the specified size.
+func UnsignedOperand(offset uint16, size int, comparison OperandComparison, value uint64) (*OperandTerms, error) {
+	if err := checkOperandSize(size); err != nil {
+		return nil, err
+	}
+	op, ok := unsignedOps[comparison]
+	if !ok {
+		return nil, makeInvalidArgError("comparison", fmt.Sprintf("invalid comparison %d", comparison))
+	}
+	if size < 8 && value >= uint64(1)<<uint(size*8) {
+		return nil, makeInvalidArgError("value", fmt.Sprintf("%d does not fit in to %d bytes", value, size))
+	}
+	return &OperandTerms{OperandB: makeOperand(size, value), Offset: offset, Operation: op}, nil
+}
+
+// SignedOperand returns the terms for comparing the two's complement signed integer of the specified size in bytes at offset
+// with value. An error is returned if value doesn't fit in to the specified size.
+func SignedOperand(offset uint16, size int, comparison OperandComparison, value int64) (*OperandTerms, error) {
+	if err := checkOperandSize(size); err != nil {
+		return nil, err
+	}
+	op, ok := signedOps[comparison]
+	if !ok {
+		return nil, makeInvalidArgError("comparison", fmt.Sprintf("invalid comparison %d", comparison))
+	}
+	if size < 8 {
+		limit := int64(1) << uint(size*8-1)
+		if value < -limit || value >= limit {
+			return nil, makeInvalidArgError("value", fmt.Sprintf("%d does not fit in to %d bytes", value, size))
+		}
+	}
+	return &OperandTerms{OperandB: makeOperand(size, uint64(value)), Offset: offset, Operation: op}, nil
+}
+
+func makeBitsOperand(offset uint16, size int, bits uint64, op ArithmeticOp) (*OperandTerms, error) {
+	if err := checkOperandSize(size); err != nil {
+		return nil, err
+	}
+	if size < 8 && bits >= uint64(1)<<uint(size*8) {
+		return nil, makeInvalidArgError("bits", fmt.Sprintf("0x%x does not fit in to %d bytes", bits, size))
+	}
+	return &OperandTerms{OperandB: makeOperand(size, bits), Offset: offset, Operation: op}, nil
+}
+
+// BitsetOperand returns the terms for checking that all of the specified bits are set in the value of the specified size in
+// bytes at offset.
+func BitsetOperand(offset uint16, size int, bits uint64) (*OperandTerms, error) {
+	return makeBitsOperand(offset, size, bits, OpBitset)
+}
+
+// BitclearOperand returns the terms for checking that all of the specified bits are clear in the value of the specified size in
+// bytes at offset.
+func BitclearOperand(offset uint16, size int, bits uint64) (*OperandTerms, error) {
+	return makeBitsOperand(offset, size, bits, OpBitclear)
+}
@@ -0,0 +1,133 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	. "github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+)
+
+func TestOperandTerms(t *testing.T) {
+	for _, data := range []struct {
+		desc     string
+		fn       func() (*OperandTerms, error)
+		expected *OperandTerms
+		err      string
+	}{
+		{
+			desc: "Uint64GE",
+			fn: func() (*OperandTerms, error) {
+				return UnsignedOperand(0, 8, CompareGreaterThanOrEqual, 0x0102030405060708)
+			},
+			expected: &OperandTerms{OperandB: Operand{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}, Operation: OpUnsignedGE},
+		},
+		{
+			desc:     "Uint32LT",
+			fn:       func() (*OperandTerms, error) { return UnsignedOperand(TimeInfoResetCountOffset, 4, CompareLessThan, 5) },
+			expected: &OperandTerms{OperandB: Operand{0x00, 0x00, 0x00, 0x05}, Offset: 16, Operation: OpUnsignedLT},
+		},
+		{
+			desc:     "Uint8Eq",
+			fn:       func() (*OperandTerms, error) { return UnsignedOperand(3, 1, CompareEqual, 0xff) },
+			expected: &OperandTerms{OperandB: Operand{0xff}, Offset: 3, Operation: OpEq},
+		},
+		{
+			desc: "Uint16Overflow",
+			fn:   func() (*OperandTerms, error) { return UnsignedOperand(0, 2, CompareEqual, 0x10000) },
+			err:  "invalid value argument: 65536 does not fit in to 2 bytes",
+		},
+		{
+			desc:     "Int16Negative",
+			fn:       func() (*OperandTerms, error) { return SignedOperand(2, 2, CompareGreaterThan, -2) },
+			expected: &OperandTerms{OperandB: Operand{0xff, 0xfe}, Offset: 2, Operation: OpSignedGT},
+		},
+		{
+			desc:     "Int32NE",
+			fn:       func() (*OperandTerms, error) { return SignedOperand(0, 4, CompareNotEqual, 100) },
+			expected: &OperandTerms{OperandB: Operand{0x00, 0x00, 0x00, 0x64}, Operation: OpNeq},
+		},
+		{
+			desc:     "Int8Min",
+			fn:       func() (*OperandTerms, error) { return SignedOperand(0, 1, CompareLessThanOrEqual, -128) },
+			expected: &OperandTerms{OperandB: Operand{0x80}, Operation: OpSignedLE},
+		},
+		{
+			desc: "Int8Overflow",
+			fn:   func() (*OperandTerms, error) { return SignedOperand(0, 1, CompareEqual, 128) },
+			err:  "invalid value argument: 128 does not fit in to 1 bytes",
+		},
+		{
+			desc:     "Bitset",
+			fn:       func() (*OperandTerms, error) { return BitsetOperand(0, 8, 0x8001) },
+			expected: &OperandTerms{OperandB: Operand{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x80, 0x01}, Operation: OpBitset},
+		},
+		{
+			desc:     "Bitclear",
+			fn:       func() (*OperandTerms, error) { return BitclearOperand(4, 4, 0x10) },
+			expected: &OperandTerms{OperandB: Operand{0x00, 0x00, 0x00, 0x10}, Offset: 4, Operation: OpBitclear},
+		},
+		{
+			desc: "InvalidSize",
+			fn:   func() (*OperandTerms, error) { return UnsignedOperand(0, 3, CompareEqual, 0) },
+			err:  "invalid size argument: invalid size 3 (must be 1, 2, 4 or 8 bytes)",
+		},
+		{
+			desc: "InvalidComparison",
+			fn:   func() (*OperandTerms, error) { return SignedOperand(0, 8, OperandComparison(10), 0) },
+			err:  "invalid comparison argument: invalid comparison 10",
+		},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			terms, err := data.fn()
+			if data.err != "" {
+				if err == nil || err.Error() != data.err {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !bytes.Equal(terms.OperandB, data.expected.OperandB) || terms.Offset != data.expected.Offset ||
+				terms.Operation != data.expected.Operation {
+				t.Errorf("Unexpected terms: %#v", terms)
+			}
+		})
+	}
+}
+
+func TestTimeInfoOffsets(t *testing.T) {
+	info := TimeInfo{
+		Time: 1,
+		ClockInfo: ClockInfo{
+			Clock:        2,
+			ResetCount:   3,
+			RestartCount: 4,
+			Safe:         true}}
+	b, err := mu.MarshalToBytes(&info)
+	if err != nil {
+		t.Fatalf("MarshalToBytes failed: %v", err)
+	}
+
+	if binary.BigEndian.Uint64(b[TimeInfoTimeOffset:]) != 1 {
+		t.Errorf("Unexpected Time offset")
+	}
+	if binary.BigEndian.Uint64(b[TimeInfoClockOffset:]) != 2 {
+		t.Errorf("Unexpected Clock offset")
+	}
+	if binary.BigEndian.Uint32(b[TimeInfoResetCountOffset:]) != 3 {
+		t.Errorf("Unexpected ResetCount offset")
+	}
+	if binary.BigEndian.Uint32(b[TimeInfoRestartCountOffset:]) != 4 {
+		t.Errorf("Unexpected RestartCount offset")
+	}
+	if b[TimeInfoSafeOffset] != 1 || len(b) != int(TimeInfoSafeOffset)+1 {
+		t.Errorf("Unexpected Safe offset")
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2
+
+import (
+	"golang.org/x/xerrors"
+)
+
+// StartupStatus describes how the TPM was most recently started, and is returned from TPMContext.StartupStatus.
+type StartupStatus struct {
+	Attrs StartupClearAttributes // The value of the TPM_PT_STARTUP_CLEAR property
+	Time  TimeInfo               // The time and clock information returned from TPM2_ReadClock
+
+	// Orderly indicates whether the most recent TPM2_Startup was preceded by a TPM2_Shutdown. If this is false, the previous
+	// shutdown was disorderly, and updates to NV indices with the AttrNVOrderly attribute since they were last written to NV
+	// memory may have been lost.
+	Orderly bool
+
+	// ClockSafe indicates whether the TPM guarantees that the current value of ClockInfo.Clock has not been reported before.
+	// This is cleared when the TPM detects that a clock update may have been lost as a result of a disorderly shutdown.
+	ClockSafe bool
+}
+
+// StartupStatus is a helper function that determines whether the TPM was shut down in an orderly manner before it was last
+// started, using the TPM_PT_STARTUP_CLEAR property and the clock information returned from TPMContext.ReadClock.
+func (t *TPMContext) StartupStatus(sessions ...SessionContext) (*StartupStatus, error) {
+	props, err := t.GetCapabilityTPMProperties(PropertyStartupClear, 1, sessions...)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot obtain startup attributes: %w", err)
+	}
+	if len(props) == 0 || props[0].Property != PropertyStartupClear {
+		return nil, &InvalidResponseError{Command: CommandGetCapability, msg: "missing TPM_PT_STARTUP_CLEAR property"}
+	}
+
+	time, err := t.ReadClock(sessions...)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot read clock: %w", err)
+	}
+
+	attrs := StartupClearAttributes(props[0].Value)
+	return &StartupStatus{
+		Attrs:     attrs,
+		Time:      *time,
+		Orderly:   attrs&AttrOrderly != 0,
+		ClockSafe: time.ClockInfo.Safe}, nil
+}
+
+// OrderlyNVIndicesAtRisk returns descriptors for the NV indices with the AttrNVOrderly attribute set if the TPM was last started
+// after a disorderly shutdown, as updates to these indices are held in RAM and may have been lost. This includes hybrid counter,
+// bit field and extend indices. Applications that use these indices should treat their contents with suspicion, although the TPM
+// ensures that counter indices never roll back. If the previous shutdown was orderly, this returns nil.
+//
+// The indices are obtained with TPMContext.NVIndexInventory.
+func (t *TPMContext) OrderlyNVIndicesAtRisk(sessions ...SessionContext) ([]*NVIndexDescriptor, error) {
+	status, err := t.StartupStatus(sessions...)
+	if err != nil {
+		return nil, err
+	}
+	if status.Orderly {
+		return nil, nil
+	}
+
+	indices, err := t.NVIndexInventory(sessions...)
+	if err != nil {
+		return nil, err
+	}
+	var atRisk []*NVIndexDescriptor
+	for _, index := range indices {
+		if index.Public.Attrs&AttrNVOrderly != 0 {
+			atRisk = append(atRisk, index)
+		}
+	}
+	return atRisk, nil
+}
+
+// OrderlyShutdown is a helper function for daemons and other long running applications to call before they exit, so that the
+// TPM's volatile state is saved and the next startup is orderly. It executes TPMContext.Shutdown with StartupState so that the
+// state can be restored by a subsequent TPM restart or resume. If this fails because the PCR allocation has been changed, the TPM
+// is shut down with StartupClear instead. The type of shutdown that was performed is returned.
+//
+// Commands executed after this but before the TPM is reset may nullify the shutdown, so this should be the last command that is
+// executed before the TPMContext is closed.
+func (t *TPMContext) OrderlyShutdown(sessions ...SessionContext) (StartupType, error) {
+	err := t.Shutdown(StartupState, sessions...)
+	switch {
+	case err == nil:
+		return StartupState, nil
+	case IsTPMParameterError(err, ErrorType, CommandShutdown, 1):
+		// The PCR allocation was changed with TPM2_PCR_Allocate.
+		if err := t.Shutdown(StartupClear, sessions...); err != nil {
+			return 0, err
+		}
+		return StartupClear, nil
+	default:
+		return 0, err
+	}
+}
+
+// StartupPreservingState is a helper function that starts the TPM whilst preserving as much of its state as possible. It first
+// executes TPMContext.Startup with StartupState, which results in a TPM resume if the TPM was shut down with StartupState. If there
+// is no saved state to restore, or the saved state cannot be recovered, the TPM is started with StartupClear, which results in a
+// TPM restart or TPM reset depending on how it was shut down. The type of startup that was performed is returned.
+//
+// Use TPMContext.StartupStatus after this to determine whether the previous shutdown was orderly.
+func (t *TPMContext) StartupPreservingState() (StartupType, error) {
+	err := t.Startup(StartupState)
+	switch {
+	case err == nil:
+		return StartupState, nil
+	case IsTPMParameterError(err, ErrorValue, CommandStartup, 1) || IsTPMError(err, ErrorNVUninitialized, CommandStartup):
+		if err := t.Startup(StartupClear); err != nil {
+			return 0, err
+		}
+		return StartupClear, nil
+	default:
+		return 0, err
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	"testing"
+
+	. "github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+func startupStatusCommands(attrs StartupClearAttributes, safe bool) []*testutil.MockCommand {
+	return []*testutil.MockCommand{
+		{CommandCode: CommandGetCapability, Response: &testutil.MockResponse{Params: []interface{}{false,
+			&CapabilityData{Capability: CapabilityTPMProperties, Data: &CapabilitiesU{TPMProperties: TaggedTPMPropertyList{
+				{Property: PropertyStartupClear, Value: uint32(attrs)}}}}}}},
+		{CommandCode: CommandReadClock, Response: &testutil.MockResponse{Params: []interface{}{
+			&TimeInfo{Time: 1000, ClockInfo: ClockInfo{Clock: 50000, ResetCount: 3, RestartCount: 1, Safe: safe}}}}}}
+}
+
+func TestStartupStatus(t *testing.T) {
+	tcti := testutil.NewMockTCTI(startupStatusCommands(AttrPhEnable|AttrShEnable|AttrEhEnable|AttrPhEnableNV, false)...)
+	tpm, _ := NewTPMContext(tcti)
+
+	status, err := tpm.StartupStatus()
+	if err != nil {
+		t.Fatalf("StartupStatus failed: %v", err)
+	}
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+	if status.Orderly || status.ClockSafe || status.Time.ClockInfo.ResetCount != 3 || status.Attrs&AttrOrderly != 0 {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+}
+
+func TestOrderlyNVIndicesAtRisk(t *testing.T) {
+	tcti := testutil.NewMockTCTI(startupStatusCommands(AttrPhEnable|AttrOrderly, true)...)
+	tpm, _ := NewTPMContext(tcti)
+
+	indices, err := tpm.OrderlyNVIndicesAtRisk()
+	if err != nil {
+		t.Fatalf("OrderlyNVIndicesAtRisk failed: %v", err)
+	}
+	if indices != nil {
+		t.Errorf("Unexpected indices after orderly shutdown: %v", indices)
+	}
+
+	readPublic := func(pub *NVPublic) *testutil.MockCommand {
+		name, _ := pub.Name()
+		b, _ := mu.MarshalToBytes(pub)
+		return &testutil.MockCommand{CommandCode: CommandNVReadPublic, Handles: []Handle{pub.Index},
+			Response: &testutil.MockResponse{Params: []interface{}{uint16(len(b)), mu.RawBytes(b), name}}}
+	}
+	tcti.Expect(startupStatusCommands(AttrPhEnable, false)...)
+	tcti.Expect(
+		&testutil.MockCommand{CommandCode: CommandGetCapability, Response: &testutil.MockResponse{Params: []interface{}{false,
+			&CapabilityData{Capability: CapabilityHandles, Data: &CapabilitiesU{Handles: HandleList{0x01800000, 0x01800001}}}}}},
+		readPublic(&NVPublic{Index: 0x01800000, NameAlg: HashAlgorithmSHA256, Attrs: NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead), Size: 8}),
+		readPublic(&NVPublic{Index: 0x01800001, NameAlg: HashAlgorithmSHA256, Attrs: NVTypeCounter.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead | AttrNVOrderly), Size: 8}))
+
+	indices, err = tpm.OrderlyNVIndicesAtRisk()
+	if err != nil {
+		t.Fatalf("OrderlyNVIndicesAtRisk failed: %v", err)
+	}
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+	if len(indices) != 1 || indices[0].Context.Handle() != 0x01800001 || indices[0].Type != NVTypeCounter {
+		t.Errorf("Unexpected indices: %v", indices)
+	}
+}
+
+func TestOrderlyShutdown(t *testing.T) {
+	tcti := testutil.NewMockTCTI(
+		&testutil.MockCommand{CommandCode: CommandShutdown, Response: &testutil.MockResponse{}},
+		// TPM_RC_TYPE + TPM_RC_P + TPM_RC_1, returned after a PCR allocation change
+		&testutil.MockCommand{CommandCode: CommandShutdown, Response: &testutil.MockResponse{ResponseCode: ResponseCode(0x1ca)}},
+		&testutil.MockCommand{CommandCode: CommandShutdown, Response: &testutil.MockResponse{}})
+	tpm, _ := NewTPMContext(tcti)
+
+	for _, expected := range []StartupType{StartupState, StartupClear} {
+		shutdownType, err := tpm.OrderlyShutdown()
+		if err != nil {
+			t.Fatalf("OrderlyShutdown failed: %v", err)
+		}
+		if shutdownType != expected {
+			t.Errorf("Unexpected shutdown type: %v", shutdownType)
+		}
+	}
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+}
+
+func TestStartupPreservingState(t *testing.T) {
+	tcti := testutil.NewMockTCTI(
+		&testutil.MockCommand{CommandCode: CommandStartup, Response: &testutil.MockResponse{}},
+		// TPM_RC_VALUE + TPM_RC_P + TPM_RC_1, returned when there is no saved state
+		&testutil.MockCommand{CommandCode: CommandStartup, Response: &testutil.MockResponse{ResponseCode: ResponseCode(0x1c4)}},
+		&testutil.MockCommand{CommandCode: CommandStartup, Response: &testutil.MockResponse{}},
+		&testutil.MockCommand{CommandCode: CommandStartup, Response: &testutil.MockResponse{ResponseCode: ResponseCode(0x100)}})
+	tpm, _ := NewTPMContext(tcti)
+
+	for _, expected := range []StartupType{StartupState, StartupClear} {
+		startupType, err := tpm.StartupPreservingState()
+		if err != nil {
+			t.Fatalf("StartupPreservingState failed: %v", err)
+		}
+		if startupType != expected {
+			t.Errorf("Unexpected startup type: %v", startupType)
+		}
+	}
+
+	if _, err := tpm.StartupPreservingState(); !IsTPMError(err, ErrorInitialize, CommandStartup) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+}
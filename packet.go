@@ -0,0 +1,288 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/canonical/go-tpm2/mu"
+
+	"golang.org/x/xerrors"
+)
+
+// marshalledParams contains command parameters that have already been marshalled by CommandPacket.
+type marshalledParams struct {
+	data            []byte
+	firstParamSized bool
+}
+
+func (p marshalledParams) Marshal(w io.Writer) error {
+	_, err := w.Write(p.data)
+	return err
+}
+
+func (p *marshalledParams) Unmarshal(r mu.Reader) error {
+	panic("no need to unmarshal marshalled command parameters")
+}
+
+// remainingParams consumes all of the remaining bytes of the response parameter area.
+type remainingParams []byte
+
+func (p remainingParams) Marshal(w io.Writer) error {
+	panic("no need to marshal remaining response parameters")
+}
+
+func (p *remainingParams) Unmarshal(r mu.Reader) error {
+	*p = make(remainingParams, r.Len())
+	_, err := io.ReadFull(r, *p)
+	return err
+}
+
+// CommandPacket is used to build a command for execution with TPMContext.RunCommandPacket. It is a typed alternative to the variable
+// length arguments accepted by TPMContext.RunCommand. Parameters of primitive and sized buffer types are marshalled as they are added
+// without the use of reflection, and the handle and parameter areas are built with separate methods rather than being separated by
+// the Delimiter sentinel value.
+//
+// The methods used to build the command return the CommandPacket so that calls can be chained. Any error encountered whilst building
+// the command is returned from TPMContext.RunCommandPacket.
+//
+// A CommandPacket can be executed more than once.
+type CommandPacket struct {
+	commandCode        CommandCode
+	handles            []interface{}
+	auths              []ResourceContextWithSession
+	sessions           []SessionContext
+	params             marshalledParams
+	numParams          int
+	numResponseHandles int
+	err                error
+}
+
+// NewCommandPacket returns a new CommandPacket for the command specified by commandCode.
+func NewCommandPacket(commandCode CommandCode) *CommandPacket {
+	return &CommandPacket{commandCode: commandCode}
+}
+
+// AddHandle adds a command handle that doesn't require authorization. A nil context will be converted to a handle with the value of
+// HandleNull.
+func (p *CommandPacket) AddHandle(context HandleContext) *CommandPacket {
+	p.handles = append(p.handles, context)
+	return p
+}
+
+// AddHandleWithAuth adds a command handle that requires authorization, with the specified session. If session is nil, then a
+// password authorization is used.
+func (p *CommandPacket) AddHandleWithAuth(context ResourceContext, session SessionContext) *CommandPacket {
+	p.handles = append(p.handles, context)
+	p.auths = append(p.auths, ResourceContextWithSession{Context: context, Session: session})
+	return p
+}
+
+// AddSessions adds sessions that aren't associated with a command handle, for the purposes of command auditing or session based
+// parameter encryption.
+func (p *CommandPacket) AddSessions(sessions ...SessionContext) *CommandPacket {
+	p.sessions = append(p.sessions, sessions...)
+	return p
+}
+
+func (p *CommandPacket) beginParam(sized bool) {
+	if p.numParams == 0 {
+		p.params.firstParamSized = sized
+	}
+	p.numParams++
+}
+
+// AddUint8 adds a command parameter of a TPM type that is represented by a uint8.
+func (p *CommandPacket) AddUint8(v uint8) *CommandPacket {
+	p.beginParam(false)
+	p.params.data = append(p.params.data, v)
+	return p
+}
+
+// AddUint16 adds a command parameter of a TPM type that is represented by a uint16.
+func (p *CommandPacket) AddUint16(v uint16) *CommandPacket {
+	p.beginParam(false)
+	p.params.data = append(p.params.data, 0, 0)
+	binary.BigEndian.PutUint16(p.params.data[len(p.params.data)-2:], v)
+	return p
+}
+
+// AddUint32 adds a command parameter of a TPM type that is represented by a uint32.
+func (p *CommandPacket) AddUint32(v uint32) *CommandPacket {
+	p.beginParam(false)
+	p.params.data = append(p.params.data, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(p.params.data[len(p.params.data)-4:], v)
+	return p
+}
+
+// AddUint64 adds a command parameter of a TPM type that is represented by a uint64.
+func (p *CommandPacket) AddUint64(v uint64) *CommandPacket {
+	p.beginParam(false)
+	p.params.data = append(p.params.data, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint64(p.params.data[len(p.params.data)-8:], v)
+	return p
+}
+
+// AddSizedBytes adds a command parameter of a sized buffer type (a TPM2B type containing a byte buffer), such as Digest, Nonce, Auth
+// or MaxBuffer.
+func (p *CommandPacket) AddSizedBytes(b []byte) *CommandPacket {
+	p.beginParam(true)
+	if len(b) > math.MaxUint16 {
+		if p.err == nil {
+			p.err = makeInvalidArgError("b", fmt.Sprintf("sized buffer parameter %d is too large", p.numParams-1))
+		}
+		return p
+	}
+	p.params.data = append(p.params.data, uint8(len(b)>>8), uint8(len(b)))
+	p.params.data = append(p.params.data, b...)
+	return p
+}
+
+// AddParams adds command parameters of any type supported by the mu package. This is provided for parameters of structure and
+// union types which can't be added with the other methods.
+func (p *CommandPacket) AddParams(params ...interface{}) *CommandPacket {
+	for _, param := range params {
+		p.beginParam(mu.DetermineTPMKind(param) == mu.TPMKindSized)
+		b, err := mu.MarshalToBytes(param)
+		if err != nil {
+			if p.err == nil {
+				p.err = xerrors.Errorf("cannot marshal command parameter %d: %w", p.numParams-1, err)
+			}
+			return p
+		}
+		p.params.data = append(p.params.data, b...)
+	}
+	return p
+}
+
+// ExpectResponseHandles sets the number of handles that the command returns in the response handle area.
+func (p *CommandPacket) ExpectResponseHandles(n int) *CommandPacket {
+	p.numResponseHandles = n
+	return p
+}
+
+// ResponsePacket contains the response to a command executed with TPMContext.RunCommandPacket. The response parameters are read in
+// order using the typed accessor methods.
+type ResponsePacket struct {
+	Handles HandleList // The response handles
+	params  []byte
+}
+
+// Len returns the number of unread bytes in the response parameter area.
+func (r *ResponsePacket) Len() int {
+	return len(r.params)
+}
+
+func (r *ResponsePacket) next(n int) ([]byte, error) {
+	if len(r.params) < n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := r.params[:n]
+	r.params = r.params[n:]
+	return b, nil
+}
+
+// Uint8 reads a response parameter of a TPM type that is represented by a uint8.
+func (r *ResponsePacket) Uint8() (uint8, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// Uint16 reads a response parameter of a TPM type that is represented by a uint16.
+func (r *ResponsePacket) Uint16() (uint16, error) {
+	b, err := r.next(2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(b), nil
+}
+
+// Uint32 reads a response parameter of a TPM type that is represented by a uint32.
+func (r *ResponsePacket) Uint32() (uint32, error) {
+	b, err := r.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b), nil
+}
+
+// Uint64 reads a response parameter of a TPM type that is represented by a uint64.
+func (r *ResponsePacket) Uint64() (uint64, error) {
+	b, err := r.next(8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+// SizedBytes reads a response parameter of a sized buffer type. The returned slice is a copy.
+func (r *ResponsePacket) SizedBytes() ([]byte, error) {
+	size, err := r.Uint16()
+	if err != nil {
+		return nil, xerrors.Errorf("cannot read size of sized buffer: %w", err)
+	}
+	b, err := r.next(int(size))
+	if err != nil {
+		return nil, xerrors.Errorf("cannot read sized buffer: %w", err)
+	}
+	return append([]byte(nil), b...), nil
+}
+
+// Unmarshal reads response parameters of any type supported by the mu package. This is provided for parameters of structure and
+// union types which can't be read with the other methods.
+func (r *ResponsePacket) Unmarshal(params ...interface{}) error {
+	n, err := mu.UnmarshalFromBytes(r.params, params...)
+	if err != nil {
+		return err
+	}
+	r.params = r.params[n:]
+	return nil
+}
+
+// RunCommandPacket executes the command built with p. It behaves in the same way as TPMContext.RunCommand, with the exception that
+// response parameters are returned in a ResponsePacket and are not checked for trailing bytes, as they are consumed by the caller.
+func (t *TPMContext) RunCommandPacket(p *CommandPacket) (*ResponsePacket, error) {
+	if p.err != nil {
+		return nil, xerrors.Errorf("cannot build command %s: %w", p.commandCode, p.err)
+	}
+
+	var sessionParams sessionParams
+	for i, auth := range p.auths {
+		if err := sessionParams.validateAndAppendAuth(auth); err != nil {
+			return nil, fmt.Errorf("cannot process authorization %d for command %s: %v", i, p.commandCode, err)
+		}
+	}
+	if err := sessionParams.validateAndAppendExtra(p.sessions); err != nil {
+		return nil, fmt.Errorf("cannot process non-auth SessionContext parameters for command %s: %v", p.commandCode, err)
+	}
+
+	var params []interface{}
+	if p.numParams > 0 {
+		params = []interface{}{&p.params}
+	}
+
+	rsp := &ResponsePacket{Handles: make(HandleList, p.numResponseHandles)}
+	outHandles := make([]interface{}, 0, p.numResponseHandles)
+	for i := range rsp.Handles {
+		outHandles = append(outHandles, &rsp.Handles[i])
+	}
+
+	if err := t.runCommandWithoutProcessingAuthResponse(p.commandCode, &sessionParams, p.handles, params, outHandles); err != nil {
+		return nil, err
+	}
+
+	var rpBytes remainingParams
+	if err := t.processLastAuthResponse([]interface{}{&rpBytes}); err != nil {
+		return nil, err
+	}
+	rsp.params = rpBytes
+	return rsp, nil
+}
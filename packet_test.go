@@ -0,0 +1,92 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+func TestRunCommandPacket(t *testing.T) {
+	getRandom := &testutil.MockCommand{CommandCode: CommandGetRandom, Response: &testutil.MockResponse{Params: []interface{}{Digest{0xa5, 0x5a, 0x12, 0x34}}}}
+	pcrReset := &testutil.MockCommand{CommandCode: CommandPCRReset, Handles: []Handle{7}, Response: &testutil.MockResponse{PasswordSessions: 1}}
+	tcti := testutil.NewMockTCTI(getRandom, getRandom, pcrReset, pcrReset)
+	tpm, _ := NewTPMContext(tcti)
+
+	rsp, err := tpm.RunCommandPacket(NewCommandPacket(CommandGetRandom).AddUint16(4))
+	if err != nil {
+		t.Fatalf("RunCommandPacket failed: %v", err)
+	}
+	data, err := rsp.SizedBytes()
+	if err != nil {
+		t.Fatalf("SizedBytes failed: %v", err)
+	}
+	if !bytes.Equal(data, []byte{0xa5, 0x5a, 0x12, 0x34}) {
+		t.Errorf("Unexpected response parameter: %x", data)
+	}
+	if rsp.Len() != 0 {
+		t.Errorf("Unexpected trailing bytes")
+	}
+
+	var expected Digest
+	if err := tpm.RunCommand(CommandGetRandom, nil, Delimiter, uint16(4), Delimiter, Delimiter, &expected); err != nil {
+		t.Fatalf("RunCommand failed: %v", err)
+	}
+	if !bytes.Equal(tcti.Commands()[0], tcti.Commands()[1]) {
+		t.Errorf("Unexpected command packet: %x", tcti.Commands()[0])
+	}
+
+	if _, err := tpm.RunCommandPacket(NewCommandPacket(CommandPCRReset).AddHandleWithAuth(tpm.PCRHandleContext(7), nil)); err != nil {
+		t.Fatalf("RunCommandPacket failed: %v", err)
+	}
+	if err := tpm.PCRReset(tpm.PCRHandleContext(7), nil); err != nil {
+		t.Fatalf("PCRReset failed: %v", err)
+	}
+	if !bytes.Equal(tcti.Commands()[2], tcti.Commands()[3]) {
+		t.Errorf("Unexpected command packet: %x", tcti.Commands()[2])
+	}
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+}
+
+func TestRunCommandPacketResponseHandles(t *testing.T) {
+	tcti := testutil.NewMockTCTI(&testutil.MockCommand{CommandCode: CommandLoadExternal,
+		Response: &testutil.MockResponse{Handle: 0x80000001, Params: []interface{}{Name{0x00, 0x0b}}}})
+	tpm, _ := NewTPMContext(tcti)
+
+	rsp, err := tpm.RunCommandPacket(NewCommandPacket(CommandLoadExternal).AddParams(&SymDef{Algorithm: SymAlgorithmNull}).ExpectResponseHandles(1))
+	if err != nil {
+		t.Fatalf("RunCommandPacket failed: %v", err)
+	}
+	if len(rsp.Handles) != 1 || rsp.Handles[0] != 0x80000001 {
+		t.Errorf("Unexpected response handles: %v", rsp.Handles)
+	}
+	var name Name
+	if err := rsp.Unmarshal(&name); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !bytes.Equal(name, []byte{0x00, 0x0b}) {
+		t.Errorf("Unexpected name: %x", name)
+	}
+	if _, err := rsp.Uint8(); err == nil {
+		t.Errorf("Expected an error reading past the end of the response")
+	}
+}
+
+func TestRunCommandPacketBuildError(t *testing.T) {
+	tcti := testutil.NewMockTCTI()
+	tpm, _ := NewTPMContext(tcti)
+
+	if _, err := tpm.RunCommandPacket(NewCommandPacket(CommandHash).AddSizedBytes(make([]byte, 70000))); err == nil {
+		t.Fatalf("RunCommandPacket should have failed")
+	}
+	if len(tcti.Commands()) != 0 {
+		t.Errorf("Command was submitted")
+	}
+}
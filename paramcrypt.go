@@ -14,6 +14,9 @@ import (
 )
 
 func isParamEncryptable(param interface{}) bool {
+	if p, ok := param.(*marshalledParams); ok {
+		return p.firstParamSized
+	}
 	return mu.DetermineTPMKind(param) == mu.TPMKindSized
 }
 
@@ -39,6 +42,30 @@ func (p *sessionParams) hasDecryptSession() bool {
 	return s != nil
 }
 
+func (p *sessionParams) hasEncryptSession() bool {
+	s, _ := p.findEncryptSession()
+	return s != nil
+}
+
+// excludeUnsupportedParamEncryption removes the specified parameter encryption attribute from sessions used for authorization if
+// the first parameter can't be encrypted, so that a session can be used for both authorization and parameter encryption without
+// having to adjust its attributes for each command. Sessions that aren't used for authorization are left alone, as they are only
+// supplied for audit or parameter encryption.
+func (p *sessionParams) excludeUnsupportedParamEncryption(attr SessionAttributes, params []interface{}) {
+	var sessions []*sessionParam
+	for _, s := range p.sessions {
+		if s.session != nil && s.isAuth() && s.attrs&attr != 0 {
+			sessions = append(sessions, s)
+		}
+	}
+	if len(sessions) == 0 || (len(params) > 0 && isParamEncryptable(params[0])) {
+		return
+	}
+	for _, s := range sessions {
+		s.attrs &^= attr
+	}
+}
+
 func (p *sessionParams) computeEncryptNonce() {
 	s, i := p.findEncryptSession()
 	if s == nil || i == 0 || !p.sessions[0].isAuth() {
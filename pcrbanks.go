@@ -0,0 +1,201 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/xerrors"
+)
+
+// PCRBankReconfigureCallbacks contains the callbacks used by TPMContext.ReconfigurePCRBanks to coordinate the TPM reset that is
+// required for a new PCR allocation to take effect.
+type PCRBankReconfigureCallbacks struct {
+	// BeforeShutdown is called once the TPM has accepted the new allocation, immediately before the TPM is shut down. This can be
+	// used to stop other users of the TPM. It is optional, and any error that it returns is returned from
+	// TPMContext.ReconfigurePCRBanks without shutting the TPM down.
+	BeforeShutdown func() error
+
+	// Restart is called after the TPM has been shut down, and must reset the TPM so that the next command is preceded by _TPM_Init
+	// (eg, by calling TctiMssim.Reset for the TPM simulator). It must not execute TPM2_Startup, as this is done by
+	// TPMContext.ReconfigurePCRBanks.
+	//
+	// If this is nil, TPMContext.ReconfigurePCRBanks returns once the TPM has been shut down. In this case, the caller is
+	// responsible for resetting the TPM (eg, by rebooting the system) and for calling TPMContext.ConfirmPCRBanks once the TPM has
+	// been restarted.
+	Restart func() error
+}
+
+// pcrBanksEqual indicates whether every PCR is allocated in each of the banks associated with the specified digest algorithms, and
+// no PCRs are allocated in any other bank.
+func pcrBanksEqual(pcrs PCRSelectionList, banks []HashAlgorithmId, pcrCount int) bool {
+	requested := make(map[HashAlgorithmId]bool)
+	for _, alg := range banks {
+		requested[alg] = true
+	}
+
+	for _, s := range pcrs {
+		if !requested[s.Hash] {
+			if len(s.Select) > 0 {
+				return false
+			}
+			continue
+		}
+		delete(requested, s.Hash)
+
+		selected := make(map[int]bool)
+		for _, i := range s.Select {
+			selected[i] = true
+		}
+		for i := 0; i < pcrCount; i++ {
+			if !selected[i] {
+				return false
+			}
+		}
+	}
+	return len(requested) == 0
+}
+
+// getPCRCount returns the number of PCRs implemented by the TPM in each bank (TPM_PT_PCR_COUNT).
+func (t *TPMContext) getPCRCount(sessions ...SessionContext) (int, error) {
+	props, err := t.GetCapabilityTPMProperties(PropertyPCRCount, 1, sessions...)
+	if err != nil {
+		return 0, err
+	}
+	if len(props) == 0 || props[0].Property != PropertyPCRCount {
+		return 0, &InvalidResponseError{Command: CommandGetCapability, msg: "missing TPM_PT_PCR_COUNT property"}
+	}
+	return int(props[0].Value), nil
+}
+
+// makePCRAllocation validates the requested PCR banks against the banks implemented by the TPM, and returns the selection list
+// to supply to TPM2_PCR_Allocate in order to allocate every PCR in the requested banks and deallocate every other bank.
+func makePCRAllocation(current PCRSelectionList, banks []HashAlgorithmId, pcrCount int) (PCRSelectionList, error) {
+	if len(banks) == 0 {
+		return nil, makeInvalidArgError("banks", "no PCR banks specified")
+	}
+
+	requested := make(map[HashAlgorithmId]bool)
+	for _, alg := range banks {
+		if !alg.IsValid() {
+			return nil, makeInvalidArgError("banks", fmt.Sprintf("invalid digest algorithm %v", alg))
+		}
+		if requested[alg] {
+			return nil, makeInvalidArgError("banks", fmt.Sprintf("digest algorithm %v specified more than once", alg))
+		}
+		requested[alg] = true
+	}
+
+	var all PCRSelect
+	for i := 0; i < pcrCount; i++ {
+		all = append(all, i)
+	}
+
+	var allocation PCRSelectionList
+	for _, s := range current {
+		if requested[s.Hash] {
+			allocation = append(allocation, PCRSelection{Hash: s.Hash, Select: all})
+			delete(requested, s.Hash)
+		} else {
+			allocation = append(allocation, PCRSelection{Hash: s.Hash, Select: PCRSelect{}})
+		}
+	}
+	for _, alg := range banks {
+		if requested[alg] {
+			return nil, makeInvalidArgError("banks", fmt.Sprintf("PCR bank for digest algorithm %v is not implemented by the TPM", alg))
+		}
+	}
+
+	return allocation, nil
+}
+
+// ReconfigurePCRBanks changes the PCR allocation so that every PCR is allocated in each of the banks associated with the specified
+// digest algorithms, and every other bank is deallocated. The requested banks are validated against those implemented by the TPM
+// before any changes are made, and nothing is done if the current allocation already matches.
+//
+// The new allocation is set with TPMContext.PCRAllocate, which requires authorization with the user auth role for platformContext,
+// with session based authorization provided via platformContextAuthSession. The platformContext argument must correspond to
+// HandlePlatform. If the TPM doesn't accept the new allocation, an error will be returned and no further action is taken.
+//
+// The new allocation only takes effect after the TPM has been reset. This function calls callbacks.BeforeShutdown if it is set,
+// and then shuts the TPM down with TPMContext.Shutdown using StartupClear, as the new allocation prevents the TPM from being shut
+// down with StartupState. If callbacks.Restart is set, it is then called to reset the TPM, after which this function executes
+// TPMContext.Startup with StartupClear and confirms the new allocation with TPMContext.ConfirmPCRBanks. If callbacks.Restart is not
+// set, the caller must reset the TPM and call TPMContext.ConfirmPCRBanks itself.
+//
+// As the TPM is reset, all PCR values, transient objects and sessions are lost.
+func (t *TPMContext) ReconfigurePCRBanks(platformContext ResourceContext, banks []HashAlgorithmId, platformContextAuthSession SessionContext, callbacks *PCRBankReconfigureCallbacks) error {
+	if callbacks == nil {
+		callbacks = &PCRBankReconfigureCallbacks{}
+	}
+
+	current, err := t.GetCapabilityPCRs()
+	if err != nil {
+		return xerrors.Errorf("cannot obtain current PCR allocation: %w", err)
+	}
+	pcrCount, err := t.getPCRCount()
+	if err != nil {
+		return xerrors.Errorf("cannot obtain number of PCRs: %w", err)
+	}
+
+	allocation, err := makePCRAllocation(current, banks, pcrCount)
+	if err != nil {
+		return err
+	}
+	if pcrBanksEqual(current, banks, pcrCount) {
+		return nil
+	}
+
+	success, _, sizeNeeded, sizeAvailable, err := t.PCRAllocate(platformContext, allocation, platformContextAuthSession)
+	if err != nil {
+		return xerrors.Errorf("cannot set PCR allocation: %w", err)
+	}
+	if !success {
+		return fmt.Errorf("the TPM rejected the PCR allocation (size needed: %d, size available: %d)", sizeNeeded, sizeAvailable)
+	}
+
+	if callbacks.BeforeShutdown != nil {
+		if err := callbacks.BeforeShutdown(); err != nil {
+			return xerrors.Errorf("cannot prepare for shutdown: %w", err)
+		}
+	}
+	if err := t.Shutdown(StartupClear); err != nil {
+		return xerrors.Errorf("cannot shut down TPM: %w", err)
+	}
+
+	if callbacks.Restart == nil {
+		return nil
+	}
+	if err := callbacks.Restart(); err != nil {
+		return xerrors.Errorf("cannot restart TPM: %w", err)
+	}
+	if err := t.Startup(StartupClear); err != nil {
+		return xerrors.Errorf("cannot start TPM: %w", err)
+	}
+
+	return t.ConfirmPCRBanks(banks)
+}
+
+// ConfirmPCRBanks checks that the TPM has every PCR allocated in each of the banks associated with the specified digest algorithms,
+// and no PCRs allocated in any other bank. It is used to confirm that a new allocation set with TPMContext.ReconfigurePCRBanks has
+// taken effect after the TPM has been reset. Any capabilities cached on this TPMContext are discarded first, as they may describe
+// the previous allocation.
+func (t *TPMContext) ConfirmPCRBanks(banks []HashAlgorithmId, sessions ...SessionContext) error {
+	t.InvalidateCapabilityCache()
+
+	pcrs, err := t.GetCapabilityPCRs(sessions...)
+	if err != nil {
+		return xerrors.Errorf("cannot obtain current PCR allocation: %w", err)
+	}
+	pcrCount, err := t.getPCRCount(sessions...)
+	if err != nil {
+		return xerrors.Errorf("cannot obtain number of PCRs: %w", err)
+	}
+	if !pcrBanksEqual(pcrs, banks, pcrCount) {
+		return errors.New("the current PCR allocation does not match the requested banks")
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	. "github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+func pcrAllocationCapability(pcrs PCRSelectionList) *testutil.MockCommand {
+	return &testutil.MockCommand{CommandCode: CommandGetCapability, Response: &testutil.MockResponse{Params: []interface{}{false,
+		&CapabilityData{Capability: CapabilityPCRs, Data: &CapabilitiesU{AssignedPCR: pcrs}}}}}
+}
+
+func pcrCountCapability(n uint32) *testutil.MockCommand {
+	return &testutil.MockCommand{CommandCode: CommandGetCapability, Response: &testutil.MockResponse{Params: []interface{}{false,
+		&CapabilityData{Capability: CapabilityTPMProperties, Data: &CapabilitiesU{TPMProperties: TaggedTPMPropertyList{
+			{Property: PropertyPCRCount, Value: n}}}}}}}
+}
+
+func TestReconfigurePCRBanks(t *testing.T) {
+	all := PCRSelect{0, 1, 2, 3, 4, 5, 6, 7}
+	expectedAllocation := PCRSelectionList{
+		{Hash: HashAlgorithmSHA1, Select: PCRSelect{}},
+		{Hash: HashAlgorithmSHA256, Select: all},
+		{Hash: HashAlgorithmSHA384, Select: all}}
+
+	tcti := testutil.NewMockTCTI(
+		pcrAllocationCapability(PCRSelectionList{
+			{Hash: HashAlgorithmSHA1, Select: all},
+			{Hash: HashAlgorithmSHA256, Select: all},
+			{Hash: HashAlgorithmSHA384, Select: PCRSelect{}}}),
+		pcrCountCapability(8),
+		&testutil.MockCommand{
+			CommandCode: CommandPCRAllocate,
+			Handles:     []Handle{HandlePlatform},
+			Params: func(params []byte) error {
+				var allocation PCRSelectionList
+				if _, err := mu.UnmarshalFromBytes(params, &allocation); err != nil {
+					return err
+				}
+				if !reflect.DeepEqual(allocation, expectedAllocation) {
+					return fmt.Errorf("unexpected allocation: %v", allocation)
+				}
+				return nil
+			},
+			Response: &testutil.MockResponse{Params: []interface{}{true, uint32(24), uint32(96), uint32(128)}, PasswordSessions: 1}},
+		&testutil.MockCommand{CommandCode: CommandShutdown, Response: &testutil.MockResponse{}},
+		&testutil.MockCommand{CommandCode: CommandStartup, Response: &testutil.MockResponse{}},
+		pcrAllocationCapability(expectedAllocation),
+		pcrCountCapability(8))
+	tpm, _ := NewTPMContext(tcti)
+
+	var events []string
+	callbacks := &PCRBankReconfigureCallbacks{
+		BeforeShutdown: func() error {
+			events = append(events, "shutdown")
+			return nil
+		},
+		Restart: func() error {
+			events = append(events, "restart")
+			return nil
+		}}
+	if err := tpm.ReconfigurePCRBanks(tpm.PlatformHandleContext(), []HashAlgorithmId{HashAlgorithmSHA384, HashAlgorithmSHA256}, nil, callbacks); err != nil {
+		t.Fatalf("ReconfigurePCRBanks failed: %v", err)
+	}
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+	if !reflect.DeepEqual(events, []string{"shutdown", "restart"}) {
+		t.Errorf("Unexpected callbacks: %v", events)
+	}
+}
+
+func TestReconfigurePCRBanksErrors(t *testing.T) {
+	current := PCRSelectionList{
+		{Hash: HashAlgorithmSHA1, Select: PCRSelect{0, 1, 2}},
+		{Hash: HashAlgorithmSHA256, Select: PCRSelect{}}}
+
+	for _, data := range []struct {
+		desc     string
+		banks    []HashAlgorithmId
+		commands []*testutil.MockCommand
+		err      string
+	}{
+		{
+			desc:  "Unchanged",
+			banks: []HashAlgorithmId{HashAlgorithmSHA1},
+		},
+		{
+			desc:  "NoBanks",
+			banks: nil,
+			err:   "invalid banks argument: no PCR banks specified",
+		},
+		{
+			desc:  "Duplicate",
+			banks: []HashAlgorithmId{HashAlgorithmSHA256, HashAlgorithmSHA256},
+			err:   "invalid banks argument: digest algorithm TPM_ALG_SHA256 specified more than once",
+		},
+		{
+			desc:  "NotImplemented",
+			banks: []HashAlgorithmId{HashAlgorithmSHA512},
+			err:   "invalid banks argument: PCR bank for digest algorithm TPM_ALG_SHA512 is not implemented by the TPM",
+		},
+		{
+			desc:  "Rejected",
+			banks: []HashAlgorithmId{HashAlgorithmSHA256},
+			commands: []*testutil.MockCommand{
+				{CommandCode: CommandPCRAllocate, Response: &testutil.MockResponse{Params: []interface{}{false, uint32(24), uint32(192), uint32(128)}, PasswordSessions: 1}}},
+			err: "the TPM rejected the PCR allocation (size needed: 192, size available: 128)",
+		},
+		{
+			desc:  "Pending",
+			banks: []HashAlgorithmId{HashAlgorithmSHA256},
+			commands: []*testutil.MockCommand{
+				{CommandCode: CommandPCRAllocate, Response: &testutil.MockResponse{Params: []interface{}{true, uint32(24), uint32(96), uint32(128)}, PasswordSessions: 1}},
+				{CommandCode: CommandShutdown, Response: &testutil.MockResponse{}}},
+		},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			tcti := testutil.NewMockTCTI(append([]*testutil.MockCommand{pcrAllocationCapability(current), pcrCountCapability(3)}, data.commands...)...)
+			tpm, _ := NewTPMContext(tcti)
+
+			err := tpm.ReconfigurePCRBanks(tpm.PlatformHandleContext(), data.banks, nil, nil)
+			switch {
+			case data.err == "" && err != nil:
+				t.Errorf("ReconfigurePCRBanks failed: %v", err)
+			case data.err != "" && (err == nil || err.Error() != data.err):
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if err := tcti.Done(); err != nil {
+				t.Errorf("Unexpected commands: %v", err)
+			}
+		})
+	}
+
+	tcti := testutil.NewMockTCTI(pcrAllocationCapability(current), pcrCountCapability(3),
+		&testutil.MockCommand{CommandCode: CommandPCRAllocate, Response: &testutil.MockResponse{Params: []interface{}{true, uint32(24), uint32(96), uint32(128)}, PasswordSessions: 1}})
+	tpm, _ := NewTPMContext(tcti)
+	err := tpm.ReconfigurePCRBanks(tpm.PlatformHandleContext(), []HashAlgorithmId{HashAlgorithmSHA256}, nil,
+		&PCRBankReconfigureCallbacks{BeforeShutdown: func() error { return errors.New("busy") }})
+	if err == nil || err.Error() != "cannot prepare for shutdown: busy" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestReconfigurePCRBanksPartiallyAllocated(t *testing.T) {
+	// SHA-256 is allocated, but not for every PCR.
+	tcti := testutil.NewMockTCTI(
+		pcrAllocationCapability(PCRSelectionList{{Hash: HashAlgorithmSHA256, Select: PCRSelect{0, 1, 2, 3, 4, 5, 6, 7}}}),
+		pcrCountCapability(24),
+		&testutil.MockCommand{
+			CommandCode: CommandPCRAllocate,
+			Handles:     []Handle{HandlePlatform},
+			Params: func(params []byte) error {
+				var allocation PCRSelectionList
+				if _, err := mu.UnmarshalFromBytes(params, &allocation); err != nil {
+					return err
+				}
+				if len(allocation) != 1 || allocation[0].Hash != HashAlgorithmSHA256 || len(allocation[0].Select) != 24 {
+					return fmt.Errorf("unexpected allocation: %v", allocation)
+				}
+				return nil
+			},
+			Response: &testutil.MockResponse{Params: []interface{}{true, uint32(24), uint32(96), uint32(128)}, PasswordSessions: 1}},
+		&testutil.MockCommand{CommandCode: CommandShutdown, Response: &testutil.MockResponse{}})
+	tpm, _ := NewTPMContext(tcti)
+
+	if err := tpm.ReconfigurePCRBanks(tpm.PlatformHandleContext(), []HashAlgorithmId{HashAlgorithmSHA256}, nil, nil); err != nil {
+		t.Errorf("ReconfigurePCRBanks failed: %v", err)
+	}
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+}
+
+func TestConfirmPCRBanks(t *testing.T) {
+	for _, data := range []struct {
+		desc string
+		pcrs PCRSelectionList
+		err  string
+	}{
+		{
+			desc: "Match",
+			pcrs: PCRSelectionList{{Hash: HashAlgorithmSHA1, Select: PCRSelect{}}, {Hash: HashAlgorithmSHA256, Select: PCRSelect{0, 1, 2}}},
+		},
+		{
+			desc: "WrongBank",
+			pcrs: PCRSelectionList{{Hash: HashAlgorithmSHA1, Select: PCRSelect{0, 1, 2}}, {Hash: HashAlgorithmSHA256, Select: PCRSelect{}}},
+			err:  "the current PCR allocation does not match the requested banks",
+		},
+		{
+			desc: "Partial",
+			pcrs: PCRSelectionList{{Hash: HashAlgorithmSHA256, Select: PCRSelect{0, 1}}},
+			err:  "the current PCR allocation does not match the requested banks",
+		},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			tcti := testutil.NewMockTCTI(pcrAllocationCapability(data.pcrs), pcrCountCapability(3))
+			tpm, _ := NewTPMContext(tcti)
+
+			err := tpm.ConfirmPCRBanks([]HashAlgorithmId{HashAlgorithmSHA256})
+			switch {
+			case data.err == "" && err != nil:
+				t.Errorf("ConfirmPCRBanks failed: %v", err)
+			case data.err != "" && (err == nil || err.Error() != data.err):
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if err := tcti.Done(); err != nil {
+				t.Errorf("Unexpected commands: %v", err)
+			}
+		})
+	}
+}
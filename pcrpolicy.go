@@ -0,0 +1,224 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+
+	"github.com/canonical/go-tpm2/mu"
+
+	"golang.org/x/xerrors"
+)
+
+// UpdatablePCRPolicy implements an authorization policy that is bound to PCR values which can be updated after the object it
+// protects has been created, without changing the object's authorization policy. The object's policy is a TPM2_PolicyAuthorize
+// assertion that delegates authorization to a signing key (the authority). The authority signs policies of the form
+// TPM2_PolicyPCR followed by a TPM2_PolicyNV assertion against a NV counter index, which permits revocation of previously signed
+// policies: each signed policy contains a sequence number and is only valid whilst the value of the counter is less than or equal
+// to it. Incrementing the counter beyond the sequence number of a signed policy revokes it.
+//
+// The counter index must be a NV index with a type of NVTypeCounter. As the name of a NV index changes when it is first written,
+// the counter must have been incremented at least once before the policy can be satisfied.
+type UpdatablePCRPolicy struct {
+	alg          HashAlgorithmId
+	authKey      *Public
+	authKeyName  Name
+	policyRef    Nonce
+	counterName  Name
+	counterIndex Handle
+}
+
+// PCRPolicyData contains a policy that has been signed by the authority for an UpdatablePCRPolicy. It can be serialized with
+// PCRPolicyData.Marshal so that it can be stored alongside the object that it authorizes.
+type PCRPolicyData struct {
+	PCRSelection   PCRSelectionList
+	PCRDigest      Digest
+	Sequence       uint64 // The highest value of the counter for which this policy is valid
+	ApprovedPolicy Digest // The digest of the signed policy
+	Signature      *Signature
+}
+
+// Marshal serializes this PCRPolicyData.
+func (d *PCRPolicyData) Marshal() ([]byte, error) {
+	return mu.MarshalToBytes(d)
+}
+
+// UnmarshalPCRPolicyData deserializes a PCRPolicyData that was serialized by PCRPolicyData.Marshal.
+func UnmarshalPCRPolicyData(b []byte) (*PCRPolicyData, error) {
+	var d PCRPolicyData
+	if _, err := mu.UnmarshalFromBytes(b, &d); err != nil {
+		return nil, xerrors.Errorf("cannot unmarshal policy data: %w", err)
+	}
+	return &d, nil
+}
+
+// NewUpdatablePCRPolicy returns a new UpdatablePCRPolicy that computes policy digests with the specified algorithm. The authKey
+// argument is the public area of the authority's signing key, and counter is the public area of the NV counter index used for
+// revocation. The policyRef argument is included in the signed authorizations, and allows the same authority key to be used for
+// more than one policy.
+func NewUpdatablePCRPolicy(alg HashAlgorithmId, authKey *Public, policyRef Nonce, counter *NVPublic) (*UpdatablePCRPolicy, error) {
+	if !alg.Available() {
+		return nil, makeInvalidArgError("alg", "unsupported digest algorithm")
+	}
+	if authKey == nil || !authKey.NameAlg.Available() {
+		return nil, makeInvalidArgError("authKey", "no public area or unsupported name algorithm")
+	}
+	if counter == nil || counter.Attrs.Type() != NVTypeCounter {
+		return nil, makeInvalidArgError("counter", "not a counter index")
+	}
+
+	authKeyName, err := authKey.Name()
+	if err != nil {
+		return nil, xerrors.Errorf("cannot compute name of authority key: %w", err)
+	}
+
+	writtenCounter := *counter
+	writtenCounter.Attrs |= AttrNVWritten
+	counterName, err := writtenCounter.Name()
+	if err != nil {
+		return nil, xerrors.Errorf("cannot compute name of counter: %w", err)
+	}
+
+	return &UpdatablePCRPolicy{
+		alg:          alg,
+		authKey:      authKey,
+		authKeyName:  authKeyName,
+		policyRef:    policyRef,
+		counterName:  counterName,
+		counterIndex: counter.Index}, nil
+}
+
+// AuthPolicy returns the authorization policy digest for objects protected by this policy.
+func (p *UpdatablePCRPolicy) AuthPolicy() Digest {
+	trial, _ := ComputeAuthPolicy(p.alg)
+	trial.PolicyAuthorize(p.policyRef, p.authKeyName)
+	return trial.GetDigest()
+}
+
+func (p *UpdatablePCRPolicy) counterOperand(sequence uint64) *OperandTerms {
+	terms, _ := UnsignedOperand(0, 8, CompareLessThanOrEqual, sequence)
+	return terms
+}
+
+func (p *UpdatablePCRPolicy) computeApprovedPolicy(pcrDigest Digest, pcrs PCRSelectionList, sequence uint64) Digest {
+	trial, _ := ComputeAuthPolicy(p.alg)
+	trial.PolicyPCR(pcrDigest, pcrs)
+	terms := p.counterOperand(sequence)
+	trial.PolicyNV(p.counterName, terms.OperandB, terms.Offset, terms.Operation)
+	return trial.GetDigest()
+}
+
+func (p *UpdatablePCRPolicy) sign(signer crypto.Signer, approvedPolicy Digest) (*Signature, error) {
+	h := p.authKey.NameAlg.NewHash()
+	h.Write(approvedPolicy)
+	h.Write(p.policyRef)
+	aHash := h.Sum(nil)
+
+	sig, err := signer.Sign(rand.Reader, aHash, p.authKey.NameAlg.GetHash())
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := signer.Public().(type) {
+	case *rsa.PublicKey:
+		return &Signature{
+			SigAlg:    SigSchemeAlgRSASSA,
+			Signature: &SignatureU{RSASSA: &SignatureRSASSA{Hash: p.authKey.NameAlg, Sig: sig}}}, nil
+	case *ecdsa.PublicKey:
+		var ecdsaSig struct {
+			R, S *big.Int
+		}
+		if _, err := asn1.Unmarshal(sig, &ecdsaSig); err != nil {
+			return nil, xerrors.Errorf("cannot unmarshal ECDSA signature: %w", err)
+		}
+		size := (k.Params().BitSize + 7) / 8
+		r := make(ECCParameter, size)
+		rBytes := ecdsaSig.R.Bytes()
+		copy(r[size-len(rBytes):], rBytes)
+		s := make(ECCParameter, size)
+		sBytes := ecdsaSig.S.Bytes()
+		copy(s[size-len(sBytes):], sBytes)
+		return &Signature{
+			SigAlg:    SigSchemeAlgECDSA,
+			Signature: &SignatureU{ECDSA: &SignatureECDSA{Hash: p.authKey.NameAlg, SignatureR: r, SignatureS: s}}}, nil
+	default:
+		return nil, errors.New("unsupported signer type")
+	}
+}
+
+// Update computes a new policy bound to the supplied PCR values and signs it with the authority key. The policy is valid whilst the
+// value of the counter index is less than or equal to sequence. The supplied signer must correspond to the authority key, and must
+// be a RSA or ECDSA key. The returned PCRPolicyData should be supplied to UpdatablePCRPolicy.Execute.
+//
+// To revoke policies created by previous calls, the counter should be incremented to a value that is greater than their sequence
+// numbers once the new policy has been distributed.
+func (p *UpdatablePCRPolicy) Update(signer crypto.Signer, pcrs PCRSelectionList, values PCRValues, sequence uint64) (*PCRPolicyData, error) {
+	pcrDigest, err := ComputePCRDigest(p.alg, pcrs, values)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot compute PCR digest: %w", err)
+	}
+
+	approvedPolicy := p.computeApprovedPolicy(pcrDigest, pcrs, sequence)
+	signature, err := p.sign(signer, approvedPolicy)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot sign policy: %w", err)
+	}
+
+	return &PCRPolicyData{
+		PCRSelection:   pcrs,
+		PCRDigest:      pcrDigest,
+		Sequence:       sequence,
+		ApprovedPolicy: approvedPolicy,
+		Signature:      signature}, nil
+}
+
+// Execute executes the assertions for this policy on the policy session associated with policySession, using the supplied policy
+// data created by UpdatablePCRPolicy.Update.
+//
+// The counter argument must correspond to the counter index, and it is used to authorize reading the counter with the password
+// session and the authorization value set on it. The authKey argument must correspond to the authority's public key loaded in to
+// the TPM, eg, with TPMContext.LoadExternal. It must be loaded in to a hierarchy other than HandleNull, as the TPM does not produce
+// a valid verification ticket for keys in the null hierarchy.
+//
+// If the PCR values don't match the policy, the TPM will return an error when the policy session is used for authorization. If
+// the policy has been revoked, a *TPMError with an error code of ErrorPolicy will be returned.
+func (p *UpdatablePCRPolicy) Execute(tpm *TPMContext, policySession SessionContext, data *PCRPolicyData, counter, authKey ResourceContext, sessions ...SessionContext) error {
+	if data == nil {
+		return makeInvalidArgError("data", "nil value")
+	}
+	if counter == nil || counter.Handle() != p.counterIndex {
+		return makeInvalidArgError("counter", "unexpected index")
+	}
+	if authKey == nil {
+		return makeInvalidArgError("authKey", "nil value")
+	}
+
+	if err := tpm.PolicyPCR(policySession, data.PCRDigest, data.PCRSelection, sessions...); err != nil {
+		return xerrors.Errorf("cannot execute PCR assertion: %w", err)
+	}
+	terms := p.counterOperand(data.Sequence)
+	if err := tpm.PolicyNV(counter, counter, policySession, terms.OperandB, terms.Offset, terms.Operation, nil, sessions...); err != nil {
+		return xerrors.Errorf("cannot execute revocation counter assertion: %w", err)
+	}
+
+	h := p.authKey.NameAlg.NewHash()
+	h.Write(data.ApprovedPolicy)
+	h.Write(p.policyRef)
+	ticket, err := tpm.VerifySignature(authKey, h.Sum(nil), data.Signature, sessions...)
+	if err != nil {
+		return xerrors.Errorf("cannot verify policy signature: %w", err)
+	}
+
+	if err := tpm.PolicyAuthorize(policySession, data.ApprovedPolicy, p.policyRef, authKey.Name(), ticket, sessions...); err != nil {
+		return xerrors.Errorf("cannot execute authorization assertion: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"math/big"
+	"reflect"
+	"testing"
+
+	. "github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+func makeUpdatablePCRPolicyCounter() *NVPublic {
+	return &NVPublic{
+		Index:   0x01800000,
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeCounter.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead | AttrNVNoDA),
+		Size:    8}
+}
+
+func TestUpdatablePCRPolicy(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+
+	pcrs := PCRSelectionList{{Hash: HashAlgorithmSHA256, Select: []int{7, 12}}}
+	values := PCRValues{HashAlgorithmSHA256: {7: make(Digest, 32), 12: bytes.Repeat([]byte{0x01}, 32)}}
+
+	for _, data := range []struct {
+		desc   string
+		signer crypto.Signer
+		public *Public
+		verify func(digest []byte, sig *Signature) bool
+	}{
+		{
+			desc:   "RSA",
+			signer: rsaKey,
+			public: &Public{
+				Type:    ObjectTypeRSA,
+				NameAlg: HashAlgorithmSHA256,
+				Attrs:   AttrSensitiveDataOrigin | AttrUserWithAuth | AttrSign,
+				Params: &PublicParamsU{
+					RSADetail: &RSAParams{
+						Symmetric: SymDefObject{Algorithm: SymObjectAlgorithmNull},
+						Scheme:    RSAScheme{Scheme: RSASchemeNull},
+						KeyBits:   2048,
+						Exponent:  uint32(rsaKey.PublicKey.E)}},
+				Unique: &PublicIDU{RSA: rsaKey.PublicKey.N.Bytes()}},
+			verify: func(digest []byte, sig *Signature) bool {
+				return sig.SigAlg == SigSchemeAlgRSASSA &&
+					rsa.VerifyPKCS1v15(&rsaKey.PublicKey, crypto.SHA256, digest, sig.Signature.RSASSA.Sig) == nil
+			},
+		},
+		{
+			desc:   "ECDSA",
+			signer: ecKey,
+			public: &Public{
+				Type:    ObjectTypeECC,
+				NameAlg: HashAlgorithmSHA256,
+				Attrs:   AttrSensitiveDataOrigin | AttrUserWithAuth | AttrSign,
+				Params: &PublicParamsU{
+					ECCDetail: &ECCParams{
+						Symmetric: SymDefObject{Algorithm: SymObjectAlgorithmNull},
+						Scheme:    ECCScheme{Scheme: ECCSchemeNull},
+						CurveID:   ECCCurveNIST_P256,
+						KDF:       KDFScheme{Scheme: KDFAlgorithmNull}}},
+				Unique: &PublicIDU{ECC: &ECCPoint{X: ecKey.X.Bytes(), Y: ecKey.Y.Bytes()}}},
+			verify: func(digest []byte, sig *Signature) bool {
+				if sig.SigAlg != SigSchemeAlgECDSA || len(sig.Signature.ECDSA.SignatureR) != 32 || len(sig.Signature.ECDSA.SignatureS) != 32 {
+					return false
+				}
+				r := new(big.Int).SetBytes(sig.Signature.ECDSA.SignatureR)
+				s := new(big.Int).SetBytes(sig.Signature.ECDSA.SignatureS)
+				return ecdsa.Verify(&ecKey.PublicKey, digest, r, s)
+			},
+		},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			counter := makeUpdatablePCRPolicyCounter()
+			policy, err := NewUpdatablePCRPolicy(HashAlgorithmSHA256, data.public, []byte("foo"), counter)
+			if err != nil {
+				t.Fatalf("NewUpdatablePCRPolicy failed: %v", err)
+			}
+
+			keyName, _ := data.public.Name()
+			expected, _ := ComputeAuthPolicy(HashAlgorithmSHA256)
+			expected.PolicyAuthorize([]byte("foo"), keyName)
+			if !bytes.Equal(policy.AuthPolicy(), expected.GetDigest()) {
+				t.Errorf("Unexpected auth policy")
+			}
+
+			policyData, err := policy.Update(data.signer, pcrs, values, 5)
+			if err != nil {
+				t.Fatalf("Update failed: %v", err)
+			}
+
+			pcrDigest, _ := ComputePCRDigest(HashAlgorithmSHA256, pcrs, values)
+			counter.Attrs |= AttrNVWritten
+			counterName, _ := counter.Name()
+			approved, _ := ComputeAuthPolicy(HashAlgorithmSHA256)
+			approved.PolicyPCR(pcrDigest, pcrs)
+			approved.PolicyNV(counterName, Operand{0, 0, 0, 0, 0, 0, 0, 5}, 0, OpUnsignedLE)
+			if !bytes.Equal(policyData.ApprovedPolicy, approved.GetDigest()) {
+				t.Errorf("Unexpected approved policy")
+			}
+			if !bytes.Equal(policyData.PCRDigest, pcrDigest) || policyData.Sequence != 5 {
+				t.Errorf("Unexpected policy data")
+			}
+
+			h := sha256.New()
+			h.Write(policyData.ApprovedPolicy)
+			h.Write([]byte("foo"))
+			if !data.verify(h.Sum(nil), policyData.Signature) {
+				t.Errorf("Invalid signature")
+			}
+
+			b, err := policyData.Marshal()
+			if err != nil {
+				t.Fatalf("Marshal failed: %v", err)
+			}
+			policyData2, err := UnmarshalPCRPolicyData(b)
+			if err != nil {
+				t.Fatalf("UnmarshalPCRPolicyData failed: %v", err)
+			}
+			if !reflect.DeepEqual(policyData, policyData2) {
+				t.Errorf("Unexpected unmarshalled data")
+			}
+		})
+	}
+}
+
+func TestUpdatablePCRPolicyExecute(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	public := &Public{
+		Type:    ObjectTypeRSA,
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   AttrSensitiveDataOrigin | AttrUserWithAuth | AttrSign,
+		Params: &PublicParamsU{
+			RSADetail: &RSAParams{
+				Symmetric: SymDefObject{Algorithm: SymObjectAlgorithmNull},
+				Scheme:    RSAScheme{Scheme: RSASchemeNull},
+				KeyBits:   2048,
+				Exponent:  uint32(key.PublicKey.E)}},
+		Unique: &PublicIDU{RSA: key.PublicKey.N.Bytes()}}
+	counterPub := makeUpdatablePCRPolicyCounter()
+
+	policy, err := NewUpdatablePCRPolicy(HashAlgorithmSHA256, public, nil, counterPub)
+	if err != nil {
+		t.Fatalf("NewUpdatablePCRPolicy failed: %v", err)
+	}
+	pcrs := PCRSelectionList{{Hash: HashAlgorithmSHA256, Select: []int{7}}}
+	policyData, err := policy.Update(key, pcrs, PCRValues{HashAlgorithmSHA256: {7: make(Digest, 32)}}, 1)
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	tcti := testutil.NewMockTCTI(
+		&testutil.MockCommand{CommandCode: CommandPolicyPCR, Response: &testutil.MockResponse{}},
+		&testutil.MockCommand{CommandCode: CommandPolicyNV, Response: &testutil.MockResponse{PasswordSessions: 1}},
+		&testutil.MockCommand{CommandCode: CommandVerifySignature, Response: &testutil.MockResponse{
+			Params: []interface{}{&TkVerified{Tag: TagVerified, Hierarchy: HandleOwner, Digest: make(Digest, 32)}}}},
+		&testutil.MockCommand{CommandCode: CommandPolicyAuthorize, Response: &testutil.MockResponse{}})
+	tpm, _ := NewTPMContext(tcti)
+
+	session := MakeMockSessionContext(0x03000000, &SessionContextData{
+		HashAlg:     HashAlgorithmSHA256,
+		SessionType: SessionTypePolicy,
+		NonceCaller: make(Nonce, 32),
+		NonceTPM:    make(Nonce, 32)})
+
+	written := *counterPub
+	written.Attrs |= AttrNVWritten
+	counter, _ := CreateNVIndexResourceContextFromPublic(&written)
+	authKey, _ := CreateObjectResourceContextFromPublic(0x80000001, public)
+
+	if err := policy.Execute(tpm, session, policyData, counter, authKey); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	if err := tcti.Done(); err != nil {
+		t.Fatalf("Unexpected commands: %v", err)
+	}
+
+	var approvedPolicy Digest
+	if _, err := mu.UnmarshalFromBytes(tcti.Commands()[3][10+4:], &approvedPolicy); err != nil {
+		t.Fatalf("Cannot unmarshal PolicyAuthorize command: %v", err)
+	}
+	if !bytes.Equal(approvedPolicy, policyData.ApprovedPolicy) {
+		t.Errorf("Unexpected approved policy")
+	}
+
+	if err := policy.Execute(tpm, session, policyData, authKey, authKey); err == nil || err.Error() != "invalid counter argument: unexpected index" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
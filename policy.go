@@ -0,0 +1,584 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// PolicySession provides a way to execute the assertions of an authorization policy. It is implemented by TrialAuthSession, which
+// computes the resulting policy digest on the host, and by the PolicySession returned from TPMContext.NewPolicySession, which
+// executes the assertions on a policy session on the TPM. This allows a single function that describes a policy to be used both
+// for computing the policy digest offline and for satisfying the policy at authorization time.
+//
+// The methods correspond to the TPMContext methods with the same names, without the policySession and sessions arguments.
+type PolicySession interface {
+	PolicySigned(authContext ResourceContext, includeNonceTPM bool, cpHashA Digest, policyRef Nonce, expiration int32, auth *Signature) (Timeout, *TkAuth, error)
+	PolicySecret(authContext ResourceContext, cpHashA Digest, policyRef Nonce, expiration int32, authContextAuthSession SessionContext) (Timeout, *TkAuth, error)
+	PolicyTicket(timeout Timeout, cpHashA Digest, policyRef Nonce, authName Name, ticket *TkAuth) error
+	PolicyOR(pHashList DigestList) error
+	PolicyPCR(pcrDigest Digest, pcrs PCRSelectionList) error
+	PolicyLocality(locality Locality) error
+	PolicyNV(authContext, nvIndex ResourceContext, operandB Operand, offset uint16, operation ArithmeticOp, authContextAuthSession SessionContext) error
+	PolicyCounterTimer(operandB Operand, offset uint16, operation ArithmeticOp) error
+	PolicyCommandCode(code CommandCode) error
+	PolicyCpHash(cpHashA Digest) error
+	PolicyNameHash(nameHash Digest) error
+	PolicyDuplicationSelect(objectName, newParentName Name, includeObject bool) error
+	PolicyAuthorize(approvedPolicy Digest, policyRef Nonce, keySign Name, checkTicket *TkVerified) error
+	PolicyAuthValue() error
+	PolicyPassword() error
+	PolicyNvWritten(writtenSet bool) error
+	PolicyGetDigest() (Digest, error)
+}
+
+type tpmPolicySession struct {
+	tpm      *TPMContext
+	session  SessionContext
+	sessions []SessionContext
+}
+
+func (s *tpmPolicySession) PolicySigned(authContext ResourceContext, includeNonceTPM bool, cpHashA Digest, policyRef Nonce, expiration int32, auth *Signature) (Timeout, *TkAuth, error) {
+	return s.tpm.PolicySigned(authContext, s.session, includeNonceTPM, cpHashA, policyRef, expiration, auth, s.sessions...)
+}
+
+func (s *tpmPolicySession) PolicySecret(authContext ResourceContext, cpHashA Digest, policyRef Nonce, expiration int32, authContextAuthSession SessionContext) (Timeout, *TkAuth, error) {
+	return s.tpm.PolicySecret(authContext, s.session, cpHashA, policyRef, expiration, authContextAuthSession, s.sessions...)
+}
+
+func (s *tpmPolicySession) PolicyTicket(timeout Timeout, cpHashA Digest, policyRef Nonce, authName Name, ticket *TkAuth) error {
+	return s.tpm.PolicyTicket(s.session, timeout, cpHashA, policyRef, authName, ticket, s.sessions...)
+}
+
+func (s *tpmPolicySession) PolicyOR(pHashList DigestList) error {
+	return s.tpm.PolicyOR(s.session, pHashList, s.sessions...)
+}
+
+func (s *tpmPolicySession) PolicyPCR(pcrDigest Digest, pcrs PCRSelectionList) error {
+	return s.tpm.PolicyPCR(s.session, pcrDigest, pcrs, s.sessions...)
+}
+
+func (s *tpmPolicySession) PolicyLocality(locality Locality) error {
+	return s.tpm.PolicyLocality(s.session, locality, s.sessions...)
+}
+
+func (s *tpmPolicySession) PolicyNV(authContext, nvIndex ResourceContext, operandB Operand, offset uint16, operation ArithmeticOp, authContextAuthSession SessionContext) error {
+	return s.tpm.PolicyNV(authContext, nvIndex, s.session, operandB, offset, operation, authContextAuthSession, s.sessions...)
+}
+
+func (s *tpmPolicySession) PolicyCounterTimer(operandB Operand, offset uint16, operation ArithmeticOp) error {
+	return s.tpm.PolicyCounterTimer(s.session, operandB, offset, operation, s.sessions...)
+}
+
+func (s *tpmPolicySession) PolicyCommandCode(code CommandCode) error {
+	return s.tpm.PolicyCommandCode(s.session, code, s.sessions...)
+}
+
+func (s *tpmPolicySession) PolicyCpHash(cpHashA Digest) error {
+	return s.tpm.PolicyCpHash(s.session, cpHashA, s.sessions...)
+}
+
+func (s *tpmPolicySession) PolicyNameHash(nameHash Digest) error {
+	return s.tpm.PolicyNameHash(s.session, nameHash, s.sessions...)
+}
+
+func (s *tpmPolicySession) PolicyDuplicationSelect(objectName, newParentName Name, includeObject bool) error {
+	return s.tpm.PolicyDuplicationSelect(s.session, objectName, newParentName, includeObject, s.sessions...)
+}
+
+func (s *tpmPolicySession) PolicyAuthorize(approvedPolicy Digest, policyRef Nonce, keySign Name, checkTicket *TkVerified) error {
+	return s.tpm.PolicyAuthorize(s.session, approvedPolicy, policyRef, keySign, checkTicket, s.sessions...)
+}
+
+func (s *tpmPolicySession) PolicyAuthValue() error {
+	return s.tpm.PolicyAuthValue(s.session, s.sessions...)
+}
+
+func (s *tpmPolicySession) PolicyPassword() error {
+	return s.tpm.PolicyPassword(s.session, s.sessions...)
+}
+
+func (s *tpmPolicySession) PolicyNvWritten(writtenSet bool) error {
+	return s.tpm.PolicyNvWritten(s.session, writtenSet, s.sessions...)
+}
+
+func (s *tpmPolicySession) PolicyGetDigest() (Digest, error) {
+	return s.tpm.PolicyGetDigest(s.session, s.sessions...)
+}
+
+// NewPolicySession returns a PolicySession that executes assertions on the TPM using the policy or trial session associated with
+// session. The optional sessions are supplied to every command that is executed, for the purposes of command auditing or parameter
+// encryption.
+func (t *TPMContext) NewPolicySession(session SessionContext, sessions ...SessionContext) PolicySession {
+	return &tpmPolicySession{tpm: t, session: session, sessions: sessions}
+}
+
+// TrialAuthSession is a PolicySession that computes a policy digest on the host without communicating with the TPM, in the same way
+// that the TPM does for a trial session. It accepts the same arguments as a PolicySession that executes assertions on the TPM, but
+// only uses the ones that contribute to the policy digest. For example, only the name of authContext is used by PolicySecret, and
+// the auth argument of PolicySigned can be nil. Methods that would return a timeout and ticket from the TPM return nil values.
+//
+// As the authorizing entities are not used, digests for policies that contain PolicySecret and PolicyNV assertions can be computed
+// without knowledge of their authorization values. ResourceContexts for entities that don't exist on the TPM can be created with
+// the functions that create contexts from public areas, such as CreateNVIndexResourceContextFromPublic.
+type TrialAuthSession struct {
+	policy *TrialAuthPolicy
+}
+
+// NewTrialAuthSession returns a new TrialAuthSession for computing a policy digest with the specified algorithm.
+func NewTrialAuthSession(alg HashAlgorithmId) (*TrialAuthSession, error) {
+	policy, err := ComputeAuthPolicy(alg)
+	if err != nil {
+		return nil, err
+	}
+	return &TrialAuthSession{policy: policy}, nil
+}
+
+func (s *TrialAuthSession) PolicySigned(authContext ResourceContext, includeNonceTPM bool, cpHashA Digest, policyRef Nonce, expiration int32, auth *Signature) (Timeout, *TkAuth, error) {
+	if authContext == nil {
+		return nil, nil, makeInvalidArgError("authContext", "nil value")
+	}
+	s.policy.PolicySigned(authContext.Name(), policyRef)
+	return nil, nil, nil
+}
+
+func (s *TrialAuthSession) PolicySecret(authContext ResourceContext, cpHashA Digest, policyRef Nonce, expiration int32, authContextAuthSession SessionContext) (Timeout, *TkAuth, error) {
+	if authContext == nil {
+		return nil, nil, makeInvalidArgError("authContext", "nil value")
+	}
+	s.policy.PolicySecret(authContext.Name(), policyRef)
+	return nil, nil, nil
+}
+
+// PolicyTicket extends the policy digest in the same way as the assertion that produced the ticket. The type of assertion is
+// determined from the tag of the ticket.
+func (s *TrialAuthSession) PolicyTicket(timeout Timeout, cpHashA Digest, policyRef Nonce, authName Name, ticket *TkAuth) error {
+	if ticket == nil {
+		return makeInvalidArgError("ticket", "nil value")
+	}
+	switch ticket.Tag {
+	case TagAuthSigned:
+		s.policy.PolicySigned(authName, policyRef)
+	case TagAuthSecret:
+		s.policy.PolicySecret(authName, policyRef)
+	default:
+		return makeInvalidArgError("ticket", "invalid tag")
+	}
+	return nil
+}
+
+func (s *TrialAuthSession) PolicyOR(pHashList DigestList) error {
+	return s.policy.PolicyOR(pHashList)
+}
+
+func (s *TrialAuthSession) PolicyPCR(pcrDigest Digest, pcrs PCRSelectionList) error {
+	s.policy.PolicyPCR(pcrDigest, pcrs)
+	return nil
+}
+
+func (s *TrialAuthSession) PolicyLocality(locality Locality) error {
+	s.policy.PolicyLocality(locality)
+	return nil
+}
+
+func (s *TrialAuthSession) PolicyNV(authContext, nvIndex ResourceContext, operandB Operand, offset uint16, operation ArithmeticOp, authContextAuthSession SessionContext) error {
+	if nvIndex == nil {
+		return makeInvalidArgError("nvIndex", "nil value")
+	}
+	s.policy.PolicyNV(nvIndex.Name(), operandB, offset, operation)
+	return nil
+}
+
+func (s *TrialAuthSession) PolicyCounterTimer(operandB Operand, offset uint16, operation ArithmeticOp) error {
+	s.policy.PolicyCounterTimer(operandB, offset, operation)
+	return nil
+}
+
+func (s *TrialAuthSession) PolicyCommandCode(code CommandCode) error {
+	s.policy.PolicyCommandCode(code)
+	return nil
+}
+
+func (s *TrialAuthSession) PolicyCpHash(cpHashA Digest) error {
+	s.policy.PolicyCpHash(cpHashA)
+	return nil
+}
+
+func (s *TrialAuthSession) PolicyNameHash(nameHash Digest) error {
+	s.policy.PolicyNameHash(nameHash)
+	return nil
+}
+
+func (s *TrialAuthSession) PolicyDuplicationSelect(objectName, newParentName Name, includeObject bool) error {
+	s.policy.PolicyDuplicationSelect(objectName, newParentName, includeObject)
+	return nil
+}
+
+func (s *TrialAuthSession) PolicyAuthorize(approvedPolicy Digest, policyRef Nonce, keySign Name, checkTicket *TkVerified) error {
+	s.policy.PolicyAuthorize(policyRef, keySign)
+	return nil
+}
+
+func (s *TrialAuthSession) PolicyAuthValue() error {
+	s.policy.PolicyAuthValue()
+	return nil
+}
+
+func (s *TrialAuthSession) PolicyPassword() error {
+	s.policy.PolicyPassword()
+	return nil
+}
+
+func (s *TrialAuthSession) PolicyNvWritten(writtenSet bool) error {
+	s.policy.PolicyNvWritten(writtenSet)
+	return nil
+}
+
+// PolicyGetDigest returns a copy of the policy digest computed from the assertions executed so far.
+func (s *TrialAuthSession) PolicyGetDigest() (Digest, error) {
+	return append(Digest(nil), s.policy.GetDigest()...), nil
+}
+
+// Reset resets the policy digest to its initial value, in the same way as TPMContext.PolicyRestart.
+func (s *TrialAuthSession) Reset() {
+	s.policy.Reset()
+}
+
+// PolicySignedAuthorizer is called by PolicyTicketCache.PolicySigned to obtain a signed authorization from the authorizing entity.
+// The signature must be computed over the digest of the supplied qualifiers, as described in the documentation for
+// TPMContext.PolicySigned.
+type PolicySignedAuthorizer func(nonceTPM Nonce, expiration int32, cpHashA Digest, policyRef Nonce) (*Signature, error)
+
+type policyTicketKey struct {
+	tag       StructTag
+	authName  string
+	cpHashA   string
+	policyRef string
+}
+
+type cachedPolicyTicket struct {
+	timeout Timeout
+	ticket  *TkAuth
+	expires time.Time
+}
+
+// PolicyTicketCache executes PolicySecret and PolicySigned assertions that are valid for a bounded period of time, and caches the
+// tickets returned from the TPM. Subsequent assertions with the same authorizing entity, cpHashA and policyRef within the validity
+// period are satisfied with TPMContext.PolicyTicket instead, which avoids authorizing the entity again in the case of PolicySecret,
+// or obtaining a new signature from the authorizing entity in the case of PolicySigned.
+//
+// The TPM measures the validity period from the start of the policy session used to obtain a ticket, but the cache measures it from
+// when the ticket was obtained. If the TPM rejects a cached ticket because it has expired or is no longer valid, such as after the
+// TPM has been reset, the ticket is discarded and the full assertion is executed instead.
+//
+// Tickets are not requested or used for trial sessions.
+type PolicyTicketCache struct {
+	tpm        *TPMContext
+	expiration int32
+	validity   time.Duration
+	tickets    map[policyTicketKey]*cachedPolicyTicket
+}
+
+// NewPolicyTicketCache returns a new PolicyTicketCache for assertions that are valid for the specified period, which is rounded up
+// to a whole number of seconds.
+func (t *TPMContext) NewPolicyTicketCache(validity time.Duration) (*PolicyTicketCache, error) {
+	seconds := (validity + time.Second - 1) / time.Second
+	if seconds < 1 || seconds > math.MaxInt32 {
+		return nil, makeInvalidArgError("validity", "out of range")
+	}
+	return &PolicyTicketCache{
+		tpm:        t,
+		expiration: -int32(seconds),
+		validity:   seconds * time.Second,
+		tickets:    make(map[policyTicketKey]*cachedPolicyTicket)}, nil
+}
+
+func isTrialSession(session SessionContext) bool {
+	s, isSession := session.(*sessionContext)
+	return isSession && s.Data() != nil && s.Data().SessionType == SessionTypeTrial
+}
+
+// usePolicyTicket attempts to satisfy an assertion with a cached ticket. It returns false if there isn't a valid ticket, in which
+// case the caller should execute the full assertion.
+func (c *PolicyTicketCache) usePolicyTicket(key policyTicketKey, policySession SessionContext, cpHashA Digest, policyRef Nonce, authName Name, sessions ...SessionContext) (bool, error) {
+	ticket, ok := c.tickets[key]
+	if !ok {
+		return false, nil
+	}
+	if !c.tpm.now().Before(ticket.expires) {
+		delete(c.tickets, key)
+		return false, nil
+	}
+
+	err := c.tpm.PolicyTicket(policySession, ticket.timeout, cpHashA, policyRef, authName, ticket.ticket, sessions...)
+	switch {
+	case err == nil:
+		return true, nil
+	case IsTPMParameterError(err, ErrorExpired, CommandPolicyTicket, 1) || IsTPMParameterError(err, ErrorTicket, CommandPolicyTicket, 5):
+		delete(c.tickets, key)
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+func (c *PolicyTicketCache) addPolicyTicket(key policyTicketKey, start time.Time, timeout Timeout, ticket *TkAuth) {
+	if ticket == nil || ticket.Hierarchy == HandleNull {
+		return
+	}
+	c.tickets[key] = &cachedPolicyTicket{timeout: timeout, ticket: ticket, expires: start.Add(c.validity)}
+}
+
+// PolicySecret executes a TPM2_PolicySecret assertion on the session associated with policySession with the expiration time of this
+// cache, or a TPM2_PolicyTicket assertion with a ticket obtained from a previous TPM2_PolicySecret assertion for the same authContext,
+// cpHashA and policyRef if one is available and hasn't expired. The authContextAuthSession argument is only used if a new
+// TPM2_PolicySecret assertion is executed. See the documentation for TPMContext.PolicySecret and TPMContext.PolicyTicket.
+func (c *PolicyTicketCache) PolicySecret(authContext ResourceContext, policySession SessionContext, cpHashA Digest, policyRef Nonce, authContextAuthSession SessionContext, sessions ...SessionContext) error {
+	if authContext == nil {
+		return makeInvalidArgError("authContext", "nil value")
+	}
+	if policySession == nil {
+		return makeInvalidArgError("policySession", "nil value")
+	}
+
+	trial := isTrialSession(policySession)
+	key := policyTicketKey{tag: TagAuthSecret, authName: string(authContext.Name()), cpHashA: string(cpHashA), policyRef: string(policyRef)}
+	if !trial {
+		if ok, err := c.usePolicyTicket(key, policySession, cpHashA, policyRef, authContext.Name(), sessions...); ok || err != nil {
+			return err
+		}
+	}
+
+	start := c.tpm.now()
+	timeout, ticket, err := c.tpm.PolicySecret(authContext, policySession, cpHashA, policyRef, c.expiration, authContextAuthSession, sessions...)
+	if err != nil {
+		return err
+	}
+	if !trial {
+		c.addPolicyTicket(key, start, timeout, ticket)
+	}
+	return nil
+}
+
+// PolicySigned executes a TPM2_PolicySigned assertion on the session associated with policySession with the expiration time of this
+// cache, or a TPM2_PolicyTicket assertion with a ticket obtained from a previous TPM2_PolicySigned assertion for the same authContext,
+// cpHashA and policyRef if one is available and hasn't expired. The authorizer is only called if a new TPM2_PolicySigned assertion
+// is executed, and is supplied with the current nonceTPM of the session, which the TPM requires for assertions with an expiration
+// time. See the documentation for TPMContext.PolicySigned and TPMContext.PolicyTicket.
+func (c *PolicyTicketCache) PolicySigned(authContext ResourceContext, policySession SessionContext, cpHashA Digest, policyRef Nonce, authorizer PolicySignedAuthorizer, sessions ...SessionContext) error {
+	if authContext == nil {
+		return makeInvalidArgError("authContext", "nil value")
+	}
+	if policySession == nil {
+		return makeInvalidArgError("policySession", "nil value")
+	}
+
+	trial := isTrialSession(policySession)
+	key := policyTicketKey{tag: TagAuthSigned, authName: string(authContext.Name()), cpHashA: string(cpHashA), policyRef: string(policyRef)}
+	if !trial {
+		if ok, err := c.usePolicyTicket(key, policySession, cpHashA, policyRef, authContext.Name(), sessions...); ok || err != nil {
+			return err
+		}
+	}
+
+	auth, err := authorizer(policySession.NonceTPM(), c.expiration, cpHashA, policyRef)
+	if err != nil {
+		return xerrors.Errorf("cannot obtain signed authorization: %w", err)
+	}
+
+	start := c.tpm.now()
+	timeout, ticket, err := c.tpm.PolicySigned(authContext, policySession, true, cpHashA, policyRef, c.expiration, auth, sessions...)
+	if err != nil {
+		return err
+	}
+	if !trial {
+		c.addPolicyTicket(key, start, timeout, ticket)
+	}
+	return nil
+}
+
+// Flush discards all of the cached tickets.
+func (c *PolicyTicketCache) Flush() {
+	c.tickets = make(map[policyTicketKey]*cachedPolicyTicket)
+}
+
+// PolicyBranch describes one of the alternative sub-policies combined by a TPM2_PolicyOR assertion. It executes the assertions of
+// the sub-policy on the supplied session.
+type PolicyBranch func(session PolicySession) error
+
+// policyBranchError is returned from PolicyBranchSelector.OR when the selected branch couldn't be satisfied.
+type policyBranchError struct {
+	name      string
+	count     int
+	exhausted bool // Whether every branch has been tried by the current call to PolicyBranchSelector.Execute
+	err       error
+}
+
+func (e *policyBranchError) Error() string {
+	return fmt.Sprintf("cannot satisfy branch of %s: %v", e.name, e.err)
+}
+
+func (e *policyBranchError) Unwrap() error {
+	return e.err
+}
+
+// PolicyBranchSelector executes policies that contain TPM2_PolicyOR assertions, computing the digests for the alternative branches
+// on the host and issuing the TPM2_PolicyOR assertions with the correct digest lists. Each TPM2_PolicyOR node in a policy is
+// identified by a unique name, and the selector remembers which branch of each node was last satisfied so that it is tried first
+// next time.
+//
+// A policy is described by a function that executes assertions on a PolicySession and calls PolicyBranchSelector.OR for each
+// TPM2_PolicyOR node. The same function can be used with a TrialAuthSession to compute the policy digest, and with
+// PolicyBranchSelector.Execute to satisfy the policy on the TPM.
+type PolicyBranchSelector struct {
+	alg        HashAlgorithmId
+	selections map[string]int
+	tried      map[string]int
+}
+
+// NewPolicyBranchSelector returns a new PolicyBranchSelector for policies that use the specified digest algorithm.
+func NewPolicyBranchSelector(alg HashAlgorithmId) (*PolicyBranchSelector, error) {
+	if !alg.Available() {
+		return nil, makeInvalidArgError("alg", "unsupported digest algorithm")
+	}
+	return &PolicyBranchSelector{alg: alg, selections: make(map[string]int)}, nil
+}
+
+// Selection returns the index of the branch of the named node that was last satisfied, or that will be tried first.
+func (s *PolicyBranchSelector) Selection(name string) int {
+	return s.selections[name]
+}
+
+// Select sets the branch of the named node that will be tried first.
+func (s *PolicyBranchSelector) Select(name string, index int) {
+	s.selections[name] = index
+}
+
+func (s *PolicyBranchSelector) computeBranchDigests(digest Digest, branches []PolicyBranch) (DigestList, error) {
+	var digests DigestList
+	for i, branch := range branches {
+		trial, err := NewTrialAuthSession(s.alg)
+		if err != nil {
+			return nil, err
+		}
+		if err := trial.policy.SetDigest(append(Digest(nil), digest...)); err != nil {
+			return nil, err
+		}
+		if err := branch(trial); err != nil {
+			return nil, xerrors.Errorf("cannot compute digest for branch %d: %w", i, err)
+		}
+		d, _ := trial.PolicyGetDigest()
+		digests = append(digests, d)
+	}
+	return digests, nil
+}
+
+// policyOR executes the TPM2_PolicyOR assertions required to combine the branch at the specified index with the other branches.
+// Where there are more than 8 branches, the assertions are arranged as a tree.
+func (s *PolicyBranchSelector) policyOR(session PolicySession, digests DigestList, index int) error {
+	for len(digests) > 8 {
+		var next DigestList
+		for i := 0; i < len(digests); i += 8 {
+			end := i + 8
+			if end > len(digests) {
+				end = len(digests)
+			}
+			group := digests[i:end]
+			if len(group) == 1 {
+				// A single digest can't be combined with PolicyOR, so it is promoted to the next level.
+				next = append(next, group[0])
+				continue
+			}
+			if index >= i && index < end {
+				if err := session.PolicyOR(group); err != nil {
+					return err
+				}
+			}
+			trial, _ := ComputeAuthPolicy(s.alg)
+			if err := trial.PolicyOR(group); err != nil {
+				return err
+			}
+			next = append(next, trial.GetDigest())
+		}
+		digests = next
+		index /= 8
+	}
+	return session.PolicyOR(digests)
+}
+
+// OR executes the assertions of one of the supplied branches on session, followed by the TPM2_PolicyOR assertions that combine it
+// with the other branches. The name identifies this node of the policy, and must be unique within the policy. The branch executed
+// is the one returned by PolicyBranchSelector.Selection. At least 2 branches must be supplied.
+//
+// The digest for each branch is computed on the host from the current digest of session, so the branches must not depend on any
+// state other than the arguments to their assertions.
+//
+// If the selected branch fails with a TPM error, an error is returned that causes PolicyBranchSelector.Execute to try the next
+// branch. When session is a TrialAuthSession, the resulting policy digest is the same regardless of the branch that is selected.
+func (s *PolicyBranchSelector) OR(session PolicySession, name string, branches ...PolicyBranch) error {
+	if len(branches) < 2 {
+		return makeInvalidArgError("branches", "at least 2 branches are required")
+	}
+
+	digest, err := session.PolicyGetDigest()
+	if err != nil {
+		return xerrors.Errorf("cannot obtain current policy digest: %w", err)
+	}
+	digests, err := s.computeBranchDigests(digest, branches)
+	if err != nil {
+		return xerrors.Errorf("cannot compute branch digests for %s: %w", name, err)
+	}
+
+	index := s.selections[name]
+	if index < 0 || index >= len(branches) {
+		index = 0
+		s.selections[name] = 0
+	}
+
+	if err := branches[index](session); err != nil {
+		var be *policyBranchError
+		switch {
+		case xerrors.As(err, &be) && !be.exhausted:
+			// A nested node has more branches to try.
+			return err
+		case be == nil && !IsTPMError(err, AnyErrorCode, AnyCommandCode):
+			return err
+		}
+		return &policyBranchError{name: name, count: len(branches), exhausted: s.tried[name]+1 >= len(branches), err: err}
+	}
+
+	return s.policyOR(session, digests, index)
+}
+
+// Execute executes policy on the policy session associated with policySession. If a branch of a TPM2_PolicyOR node fails with a
+// TPM error, the session is restarted with TPMContext.PolicyRestart and the policy is executed again with the next branch of that
+// node, until a branch of every node is satisfied or all of the branches of a node have been tried. The optional sessions are
+// supplied to every command that is executed.
+func (s *PolicyBranchSelector) Execute(tpm *TPMContext, policySession SessionContext, policy func(session PolicySession) error, sessions ...SessionContext) error {
+	s.tried = make(map[string]int)
+	defer func() { s.tried = nil }()
+
+	session := tpm.NewPolicySession(policySession, sessions...)
+	for {
+		err := policy(session)
+		var be *policyBranchError
+		if !xerrors.As(err, &be) {
+			return err
+		}
+		if be.exhausted {
+			return xerrors.Errorf("no branch of %s could be satisfied: %w", be.name, be.err)
+		}
+		s.tried[be.name]++
+		s.selections[be.name] = (s.selections[be.name] + 1) % be.count
+
+		if err := tpm.PolicyRestart(policySession, sessions...); err != nil {
+			return xerrors.Errorf("cannot restart session: %w", err)
+		}
+	}
+}
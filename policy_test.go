@@ -0,0 +1,394 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	. "github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+func TestTrialAuthSession(t *testing.T) {
+	nvPub := NVPublic{
+		Index:   0x0181ffff,
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthRead | AttrNVAuthWrite | AttrNVWritten),
+		Size:    8}
+	index, err := CreateNVIndexResourceContextFromPublic(&nvPub)
+	if err != nil {
+		t.Fatalf("CreateNVIndexResourceContextFromPublic failed: %v", err)
+	}
+
+	keySign := Name{0x00, 0x0b, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10,
+		0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f, 0x20}
+	operandB := Operand{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0a}
+
+	for _, data := range []struct {
+		desc     string
+		alg      HashAlgorithmId
+		build    func(s PolicySession) error
+		expected func(p *TrialAuthPolicy) error
+	}{
+		{
+			desc: "PolicyAuthValue",
+			alg:  HashAlgorithmSHA256,
+			build: func(s PolicySession) error {
+				return s.PolicyAuthValue()
+			},
+			expected: func(p *TrialAuthPolicy) error {
+				p.PolicyAuthValue()
+				return nil
+			},
+		},
+		{
+			desc: "PolicySecret",
+			alg:  HashAlgorithmSHA1,
+			build: func(s PolicySession) error {
+				_, _, err := s.PolicySecret(index, nil, []byte("foo"), 0, nil)
+				return err
+			},
+			expected: func(p *TrialAuthPolicy) error {
+				p.PolicySecret(index.Name(), []byte("foo"))
+				return nil
+			},
+		},
+		{
+			desc: "PolicyNVAndCommandCode",
+			alg:  HashAlgorithmSHA256,
+			build: func(s PolicySession) error {
+				if err := s.PolicyNV(index, index, operandB, 0, OpUnsignedLT, nil); err != nil {
+					return err
+				}
+				if err := s.PolicyCommandCode(CommandNVRead); err != nil {
+					return err
+				}
+				return s.PolicyNvWritten(true)
+			},
+			expected: func(p *TrialAuthPolicy) error {
+				p.PolicyNV(index.Name(), operandB, 0, OpUnsignedLT)
+				p.PolicyCommandCode(CommandNVRead)
+				p.PolicyNvWritten(true)
+				return nil
+			},
+		},
+		{
+			desc: "PolicyOR",
+			alg:  HashAlgorithmSHA256,
+			build: func(s PolicySession) error {
+				if err := s.PolicyPassword(); err != nil {
+					return err
+				}
+				return s.PolicyOR(DigestList{make(Digest, 32), bytes.Repeat([]byte{0xff}, 32)})
+			},
+			expected: func(p *TrialAuthPolicy) error {
+				p.PolicyPassword()
+				return p.PolicyOR(DigestList{make(Digest, 32), bytes.Repeat([]byte{0xff}, 32)})
+			},
+		},
+		{
+			desc: "PolicyAuthorize",
+			alg:  HashAlgorithmSHA256,
+			build: func(s PolicySession) error {
+				return s.PolicyAuthorize(nil, []byte("bar"), keySign, nil)
+			},
+			expected: func(p *TrialAuthPolicy) error {
+				p.PolicyAuthorize([]byte("bar"), keySign)
+				return nil
+			},
+		},
+		{
+			desc: "PolicyTicketSecret",
+			alg:  HashAlgorithmSHA256,
+			build: func(s PolicySession) error {
+				return s.PolicyTicket(nil, nil, []byte("foo"), index.Name(), &TkAuth{Tag: TagAuthSecret})
+			},
+			expected: func(p *TrialAuthPolicy) error {
+				p.PolicySecret(index.Name(), []byte("foo"))
+				return nil
+			},
+		},
+		{
+			desc: "PolicyTicketSigned",
+			alg:  HashAlgorithmSHA256,
+			build: func(s PolicySession) error {
+				return s.PolicyTicket(nil, nil, nil, keySign, &TkAuth{Tag: TagAuthSigned})
+			},
+			expected: func(p *TrialAuthPolicy) error {
+				p.PolicySigned(keySign, nil)
+				return nil
+			},
+		},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			session, err := NewTrialAuthSession(data.alg)
+			if err != nil {
+				t.Fatalf("NewTrialAuthSession failed: %v", err)
+			}
+			if err := data.build(session); err != nil {
+				t.Fatalf("build failed: %v", err)
+			}
+			digest, err := session.PolicyGetDigest()
+			if err != nil {
+				t.Fatalf("PolicyGetDigest failed: %v", err)
+			}
+
+			trial, _ := ComputeAuthPolicy(data.alg)
+			if err := data.expected(trial); err != nil {
+				t.Fatalf("expected failed: %v", err)
+			}
+
+			if !bytes.Equal(digest, trial.GetDigest()) {
+				t.Errorf("Unexpected digest (got %x, expected %x)", digest, trial.GetDigest())
+			}
+
+			session.Reset()
+			digest, _ = session.PolicyGetDigest()
+			if !bytes.Equal(digest, make(Digest, data.alg.Size())) {
+				t.Errorf("Reset didn't reset the digest")
+			}
+		})
+	}
+
+	t.Run("InvalidTicket", func(t *testing.T) {
+		session, _ := NewTrialAuthSession(HashAlgorithmSHA256)
+		err := session.PolicyTicket(nil, nil, nil, keySign, &TkAuth{Tag: TagHashcheck})
+		if err == nil || err.Error() != "invalid ticket argument: invalid tag" {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	})
+}
+
+func TestTrialAuthSessionMatchesTPM(t *testing.T) {
+	tpm := openTPMForTesting(t, testutil.TPMFeatureOwnerHierarchy)
+	defer closeTPM(t, tpm)
+
+	owner := tpm.OwnerHandleContext()
+
+	build := func(s PolicySession) error {
+		if _, _, err := s.PolicySecret(owner, nil, []byte("foo"), 0, nil); err != nil {
+			return err
+		}
+		if err := s.PolicyCommandCode(CommandUnseal); err != nil {
+			return err
+		}
+		return s.PolicyAuthValue()
+	}
+
+	trial, err := NewTrialAuthSession(HashAlgorithmSHA256)
+	if err != nil {
+		t.Fatalf("NewTrialAuthSession failed: %v", err)
+	}
+	if err := build(trial); err != nil {
+		t.Fatalf("build failed with TrialAuthSession: %v", err)
+	}
+	expected, _ := trial.PolicyGetDigest()
+
+	sessionContext, err := tpm.StartAuthSession(nil, nil, SessionTypeTrial, nil, HashAlgorithmSHA256)
+	if err != nil {
+		t.Fatalf("StartAuthSession failed: %v", err)
+	}
+	defer flushContext(t, tpm, sessionContext)
+
+	session := tpm.NewPolicySession(sessionContext)
+	if err := build(session); err != nil {
+		t.Fatalf("build failed with TPM session: %v", err)
+	}
+	digest, err := session.PolicyGetDigest()
+	if err != nil {
+		t.Fatalf("PolicyGetDigest failed: %v", err)
+	}
+
+	if !bytes.Equal(digest, expected) {
+		t.Errorf("Unexpected digest (got %x, expected %x)", digest, expected)
+	}
+}
+
+func TestPolicyTicketCache(t *testing.T) {
+	policySecret := &testutil.MockCommand{CommandCode: CommandPolicySecret, Handles: []Handle{HandleOwner, 0x03000000}, Response: &testutil.MockResponse{
+		Params:           []interface{}{Timeout{0x00, 0x01}, &TkAuth{Tag: TagAuthSecret, Hierarchy: HandleOwner, Digest: make(Digest, 32)}},
+		PasswordSessions: 1}}
+
+	tcti := testutil.NewMockTCTI(
+		policySecret,
+		&testutil.MockCommand{CommandCode: CommandPolicyTicket, Response: &testutil.MockResponse{}},
+		policySecret,
+		&testutil.MockCommand{CommandCode: CommandPolicyTicket, Response: &testutil.MockResponse{ResponseCode: ResponseCode(0x5e0)}},
+		policySecret)
+	tpm, _ := NewTPMContext(tcti)
+	tpm.SetMaxSubmissions(1)
+	clock := &testutil.FakeClock{Time: time.Unix(0, 0)}
+	tpm.SetClock(clock)
+
+	session := MakeMockSessionContext(0x03000000, &SessionContextData{
+		HashAlg:     HashAlgorithmSHA256,
+		SessionType: SessionTypePolicy,
+		NonceCaller: make(Nonce, 32),
+		NonceTPM:    make(Nonce, 32)})
+
+	cache, err := tpm.NewPolicyTicketCache(90 * time.Second)
+	if err != nil {
+		t.Fatalf("NewPolicyTicketCache failed: %v", err)
+	}
+
+	run := func() {
+		if err := cache.PolicySecret(tpm.OwnerHandleContext(), session, nil, []byte("foo"), nil); err != nil {
+			t.Fatalf("PolicySecret failed: %v", err)
+		}
+	}
+
+	// The first assertion obtains a ticket.
+	run()
+	var expiration int32
+	if _, err := mu.UnmarshalFromBytes(tcti.Commands()[0][10+8+4+9:], new(Nonce), new(Digest), new(Nonce), &expiration); err != nil {
+		t.Fatalf("Cannot unmarshal PolicySecret command: %v", err)
+	}
+	if expiration != -90 {
+		t.Errorf("Unexpected expiration: %d", expiration)
+	}
+
+	// The second assertion uses the ticket.
+	clock.Sleep(30 * time.Second)
+	run()
+
+	// The ticket isn't used once it has expired.
+	clock.Sleep(60 * time.Second)
+	run()
+
+	// A ticket that the TPM rejects is discarded.
+	run()
+
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+}
+
+func TestPolicyBranchSelectorDigest(t *testing.T) {
+	for _, n := range []int{2, 8, 9, 20} {
+		selector, err := NewPolicyBranchSelector(HashAlgorithmSHA256)
+		if err != nil {
+			t.Fatalf("NewPolicyBranchSelector failed: %v", err)
+		}
+
+		var branches []PolicyBranch
+		var digests DigestList
+		for i := 0; i < n; i++ {
+			code := CommandCode(i)
+			branches = append(branches, func(session PolicySession) error {
+				return session.PolicyCommandCode(code)
+			})
+
+			trial, _ := ComputeAuthPolicy(HashAlgorithmSHA256)
+			trial.PolicyAuthValue()
+			trial.PolicyCommandCode(code)
+			digests = append(digests, trial.GetDigest())
+		}
+
+		// Compute the expected digest, arranging the PolicyOR assertions as a tree.
+		for len(digests) > 8 {
+			var next DigestList
+			for i := 0; i < len(digests); i += 8 {
+				end := i + 8
+				if end > len(digests) {
+					end = len(digests)
+				}
+				if end-i == 1 {
+					next = append(next, digests[i])
+					continue
+				}
+				trial, _ := ComputeAuthPolicy(HashAlgorithmSHA256)
+				trial.PolicyOR(digests[i:end])
+				next = append(next, trial.GetDigest())
+			}
+			digests = next
+		}
+		expected, _ := ComputeAuthPolicy(HashAlgorithmSHA256)
+		expected.PolicyOR(digests)
+
+		for _, selected := range []int{0, n - 1} {
+			session, _ := NewTrialAuthSession(HashAlgorithmSHA256)
+			session.PolicyAuthValue()
+			selector.Select("node", selected)
+			if err := selector.OR(session, "node", branches...); err != nil {
+				t.Fatalf("OR failed: %v", err)
+			}
+			digest, _ := session.PolicyGetDigest()
+			if !bytes.Equal(digest, expected.GetDigest()) {
+				t.Errorf("Unexpected digest for %d branches with branch %d selected", n, selected)
+			}
+		}
+	}
+}
+
+func TestPolicyBranchSelectorExecute(t *testing.T) {
+	policyGetDigest := &testutil.MockCommand{CommandCode: CommandPolicyGetDigest, Response: &testutil.MockResponse{Params: []interface{}{make(Digest, 32)}}}
+	policyCommandCode := &testutil.MockCommand{CommandCode: CommandPolicyCommandCode, Response: &testutil.MockResponse{}}
+	policyOR := &testutil.MockCommand{CommandCode: CommandPolicyOR, Response: &testutil.MockResponse{}}
+
+	// The first branch fails, so the session is restarted and the second branch is used.
+	tcti := testutil.NewMockTCTI(
+		policyGetDigest,
+		&testutil.MockCommand{CommandCode: CommandPolicyCommandCode, Response: &testutil.MockResponse{ResponseCode: ResponseCode(0x184)}},
+		&testutil.MockCommand{CommandCode: CommandPolicyRestart, Response: &testutil.MockResponse{}},
+		policyGetDigest,
+		policyCommandCode,
+		policyOR)
+	tpm, _ := NewTPMContext(tcti)
+	tpm.SetMaxSubmissions(1)
+
+	session := MakeMockSessionContext(0x03000000, &SessionContextData{
+		HashAlg:     HashAlgorithmSHA256,
+		SessionType: SessionTypePolicy,
+		NonceCaller: make(Nonce, 32),
+		NonceTPM:    make(Nonce, 32)})
+
+	selector, err := NewPolicyBranchSelector(HashAlgorithmSHA256)
+	if err != nil {
+		t.Fatalf("NewPolicyBranchSelector failed: %v", err)
+	}
+	policy := func(session PolicySession) error {
+		return selector.OR(session, "node",
+			func(session PolicySession) error { return session.PolicyCommandCode(CommandUnseal) },
+			func(session PolicySession) error { return session.PolicyCommandCode(CommandSign) })
+	}
+
+	if err := selector.Execute(tpm, session, policy); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if selector.Selection("node") != 1 {
+		t.Errorf("Unexpected selection: %d", selector.Selection("node"))
+	}
+	if err := tcti.Done(); err != nil {
+		t.Fatalf("Unexpected commands: %v", err)
+	}
+
+	var cc CommandCode
+	var digests DigestList
+	if _, err := mu.UnmarshalFromBytes(tcti.Commands()[5][10+4:], &digests); err != nil {
+		t.Fatalf("Cannot unmarshal PolicyOR command: %v", err)
+	}
+	if _, err := mu.UnmarshalFromBytes(tcti.Commands()[4][10+4:], &cc); err != nil || cc != CommandSign {
+		t.Errorf("Unexpected PolicyCommandCode command")
+	}
+	for i, code := range []CommandCode{CommandUnseal, CommandSign} {
+		trial, _ := ComputeAuthPolicy(HashAlgorithmSHA256)
+		trial.PolicyCommandCode(code)
+		if len(digests) != 2 || !bytes.Equal(digests[i], trial.GetDigest()) {
+			t.Errorf("Unexpected PolicyOR digests")
+		}
+	}
+
+	// The branch that was satisfied is remembered.
+	tcti.Expect(policyGetDigest, policyCommandCode, policyOR)
+	if err := selector.Execute(tpm, session, policy); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+/*
+Package prometheus provides an implementation of tpm2.Metrics that exposes the metrics recorded by tpm2.TPMContext in the
+Prometheus text exposition format, so that they can be scraped by a Prometheus server. It has no dependencies on the Prometheus
+client libraries.
+
+A Collector is registered with one or more TPMContext instances using TPMContext.SetMetrics, and is served over HTTP as it
+implements http.Handler:
+
+	collector := prometheus.NewCollector()
+	tpm.SetMetrics(collector)
+	http.Handle("/metrics", collector)
+*/
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/canonical/go-tpm2"
+)
+
+// DefaultBuckets are the default histogram buckets used by NewCollector, in seconds.
+var DefaultBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type series struct {
+	labelValues []string
+	value       float64  // The counter value, or the sum of observations for a histogram
+	count       uint64   // The number of observations for a histogram
+	buckets     []uint64 // The number of observations in each bucket for a histogram (not cumulative)
+}
+
+type metric struct {
+	desc   tpm2.MetricDesc
+	series map[string]*series
+}
+
+// Collector is an implementation of tpm2.Metrics that aggregates metrics in memory and writes them in the Prometheus text
+// exposition format. It is safe to use from multiple goroutines.
+type Collector struct {
+	mu      sync.Mutex
+	buckets []float64
+	metrics map[string]*metric
+}
+
+// NewCollector returns a new Collector. The buckets argument specifies the upper bounds of the histogram buckets in ascending
+// order. If none are supplied, DefaultBuckets is used.
+func NewCollector(buckets ...float64) *Collector {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	c := &Collector{
+		buckets: append([]float64(nil), buckets...),
+		metrics: make(map[string]*metric)}
+	sort.Float64s(c.buckets)
+	for _, desc := range tpm2.MetricDescs() {
+		c.metrics[desc.Name] = &metric{desc: desc, series: make(map[string]*series)}
+	}
+	return c
+}
+
+func (c *Collector) getSeries(name string, metricType tpm2.MetricType, labelValues []string) *series {
+	m, ok := c.metrics[name]
+	if !ok || m.desc.Type != metricType || len(labelValues) != len(m.desc.Labels) {
+		return nil
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		if metricType == tpm2.MetricTypeHistogram {
+			s.buckets = make([]uint64, len(c.buckets))
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+// IncCounter implements tpm2.Metrics.IncCounter. Unknown metrics are ignored.
+func (c *Collector) IncCounter(name string, labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if s := c.getSeries(name, tpm2.MetricTypeCounter, labelValues); s != nil {
+		s.value++
+	}
+}
+
+// ObserveHistogram implements tpm2.Metrics.ObserveHistogram. Unknown metrics are ignored.
+func (c *Collector) ObserveHistogram(name string, value float64, labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.getSeries(name, tpm2.MetricTypeHistogram, labelValues)
+	if s == nil {
+		return
+	}
+	s.value += value
+	s.count++
+	for i, bound := range c.buckets {
+		if value <= bound {
+			s.buckets[i]++
+			break
+		}
+	}
+}
+
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func formatLabels(names, values []string, extra ...string) string {
+	var pairs []string
+	for i, name := range names {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, escapeLabelValue(values[i])))
+	}
+	for i := 0; i < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], escapeLabelValue(extra[i+1])))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// WriteTo writes the current value of all metrics to w in the Prometheus text exposition format.
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var names []string
+	for name := range c.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	for _, name := range names {
+		m := c.metrics[name]
+
+		var keys []string
+		for key := range m.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		fmt.Fprintf(bw, "# HELP %s %s\n", name, m.desc.Help)
+		switch m.desc.Type {
+		case tpm2.MetricTypeCounter:
+			fmt.Fprintf(bw, "# TYPE %s counter\n", name)
+			for _, key := range keys {
+				s := m.series[key]
+				fmt.Fprintf(bw, "%s%s %s\n", name, formatLabels(m.desc.Labels, s.labelValues), formatFloat(s.value))
+			}
+		case tpm2.MetricTypeHistogram:
+			fmt.Fprintf(bw, "# TYPE %s histogram\n", name)
+			for _, key := range keys {
+				s := m.series[key]
+				var cumulative uint64
+				for i, bound := range c.buckets {
+					cumulative += s.buckets[i]
+					fmt.Fprintf(bw, "%s_bucket%s %d\n", name, formatLabels(m.desc.Labels, s.labelValues, "le", formatFloat(bound)),
+						cumulative)
+				}
+				fmt.Fprintf(bw, "%s_bucket%s %d\n", name, formatLabels(m.desc.Labels, s.labelValues, "le", "+Inf"), s.count)
+				fmt.Fprintf(bw, "%s_sum%s %s\n", name, formatLabels(m.desc.Labels, s.labelValues), formatFloat(s.value))
+				fmt.Fprintf(bw, "%s_count%s %d\n", name, formatLabels(m.desc.Labels, s.labelValues), s.count)
+			}
+		}
+	}
+
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ServeHTTP implements http.Handler, and serves the current value of all metrics in the Prometheus text exposition format.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	c.WriteTo(w)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(data []byte) (int, error) {
+	n, err := w.w.Write(data)
+	w.n += int64(n)
+	return n, err
+}
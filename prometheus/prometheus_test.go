@@ -0,0 +1,75 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package prometheus_test
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/canonical/go-tpm2"
+	. "github.com/canonical/go-tpm2/prometheus"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+func init() {
+	testutil.AddCommandLineFlags()
+}
+
+func TestCollector(t *testing.T) {
+	c := NewCollector(0.01, 0.1)
+	c.IncCounter(tpm2.MetricCommands, "TPM_CC_PCR_Read")
+	c.IncCounter(tpm2.MetricCommands, "TPM_CC_PCR_Read")
+	c.IncCounter(tpm2.MetricCommandErrors, "TPM_CC_Unseal", "0x00000921")
+	c.IncCounter(tpm2.MetricLockoutEvents, "TPM_CC_Unseal")
+	c.ObserveHistogram(tpm2.MetricCommandDuration, 0.005, "TPM_CC_PCR_Read")
+	c.ObserveHistogram(tpm2.MetricCommandDuration, 0.05, "TPM_CC_PCR_Read")
+	c.ObserveHistogram(tpm2.MetricCommandDuration, 0.5, "TPM_CC_PCR_Read")
+
+	// These should be ignored.
+	c.IncCounter("unknown", "foo")
+	c.IncCounter(tpm2.MetricCommands)
+	c.ObserveHistogram(tpm2.MetricCommands, 1, "TPM_CC_PCR_Read")
+
+	expected := `# HELP tpm_command_duration_seconds Time taken for the TPM to respond to commands in seconds.
+# TYPE tpm_command_duration_seconds histogram
+tpm_command_duration_seconds_bucket{command="TPM_CC_PCR_Read",le="0.01"} 1
+tpm_command_duration_seconds_bucket{command="TPM_CC_PCR_Read",le="0.1"} 2
+tpm_command_duration_seconds_bucket{command="TPM_CC_PCR_Read",le="+Inf"} 3
+tpm_command_duration_seconds_sum{command="TPM_CC_PCR_Read"} 0.555
+tpm_command_duration_seconds_count{command="TPM_CC_PCR_Read"} 3
+# HELP tpm_command_errors_total Number of commands for which the TPM responded with an error or warning.
+# TYPE tpm_command_errors_total counter
+tpm_command_errors_total{command="TPM_CC_Unseal",response_code="0x00000921"} 1
+# HELP tpm_commands_total Number of commands submitted to the TPM.
+# TYPE tpm_commands_total counter
+tpm_commands_total{command="TPM_CC_PCR_Read"} 2
+# HELP tpm_lockout_events_total Number of commands rejected because the TPM is in dictionary attack lockout mode.
+# TYPE tpm_lockout_events_total counter
+tpm_lockout_events_total{command="TPM_CC_Unseal"} 1
+`
+
+	buf := new(bytes.Buffer)
+	n, err := c.WriteTo(buf)
+	if err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo returned the wrong length")
+	}
+	if buf.String() != expected {
+		t.Errorf("Unexpected output:\n%s", buf.String())
+	}
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("Unexpected content type: %s", rec.Header().Get("Content-Type"))
+	}
+	if rec.Body.String() != expected {
+		t.Errorf("Unexpected HTTP response:\n%s", rec.Body.String())
+	}
+}
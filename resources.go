@@ -7,10 +7,15 @@ package tpm2
 import (
 	"bytes"
 	"crypto"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
 	_ "crypto/sha256"
+	"crypto/subtle"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"reflect"
 
@@ -59,12 +64,20 @@ const (
 	// from the host to the TPM. This can only be used for parameters that have types corresponding to TPM2B prefixed TCG types,
 	// and requires a session that was configured with a valid symmetric algorithm via the symmetric argument of
 	// TPMContext.StartAuthSession.
+	//
+	// If a session with this attribute is used for authorization of a command for which the first command parameter can't be
+	// encrypted, the attribute is ignored for that command. This allows a single session to be used for authorization and parameter
+	// encryption across a sequence of commands. A session that isn't used for authorization must only have this attribute set for
+	// commands that support it.
 	AttrCommandEncrypt
 
 	// AttrResponseEncrypt specifies that the session should be used for encryption of the first response parameter before being sent
 	// from the TPM to the host. This can only be used for parameters that have types corresponding to TPM2B prefixed TCG types, and
 	// requires a session that was configured with a valid symmetric algorithm via the symmetric argument of TPMContext.StartAuthSession.
 	// This package automatically decrypts the received encrypted response parameter.
+	//
+	// As with AttrCommandEncrypt, this attribute is ignored for commands that don't support it if the session is used for
+	// authorization.
 	AttrResponseEncrypt
 
 	// AttrAudit indicates that the session should be used for auditing. If this is the first time that the session is used for auditing,
@@ -133,18 +146,18 @@ type handleContextU struct {
 	Session *sessionContextData
 }
 
-func (d *handleContextU) Select(selector reflect.Value) interface{} {
+func (d *handleContextU) Select(selector reflect.Value) (interface{}, error) {
 	switch selector.Interface().(handleContextType) {
 	case handleContextTypeDummy, handleContextTypePermanent:
-		return mu.NilUnionValue
+		return nil, nil
 	case handleContextTypeObject:
-		return &d.Object
+		return &d.Object, nil
 	case handleContextTypeNvIndex:
-		return &d.NV
+		return &d.NV, nil
 	case handleContextTypeSession:
-		return &d.Session
+		return &d.Session, nil
 	default:
-		return nil
+		return nil, &mu.InvalidSelectorError{Selector: selector}
 	}
 }
 
@@ -190,8 +203,7 @@ func (h *handleContext) SerializeToWriter(w io.Writer) error {
 
 func (h *handleContext) invalidate() {
 	h.H = HandleUnassigned
-	h.N = make(Name, binary.Size(Handle(0)))
-	binary.BigEndian.PutUint32(h.N, uint32(h.H))
+	h.N = handleName(h.H)
 }
 
 func (h *handleContext) checkConsistency() error {
@@ -296,14 +308,40 @@ func (r *dummyContext) SetAuthValue([]byte) {}
 
 func (r *dummyContext) invalidate() {}
 
-func makeDummyContext(handle Handle) *dummyContext {
+// permanentHandleNames contains precomputed names for the permanent and PCR handles, which are used in many commands. The name of
+// these resources is the handle, so it never changes. The returned slices are shared and must not be modified.
+var permanentHandleNames = func() map[Handle]Name {
+	names := make(map[Handle]Name)
+	for _, h := range []Handle{HandleOwner, HandleNull, HandleUnassigned, HandlePW, HandleLockout, HandleEndorsement, HandlePlatform,
+		HandlePlatformNV} {
+		names[h] = makeHandleName(h)
+	}
+	for pcr := 0; pcr < 24; pcr++ {
+		names[Handle(pcr)] = makeHandleName(Handle(pcr))
+	}
+	return names
+}()
+
+func makeHandleName(handle Handle) Name {
 	name := make(Name, binary.Size(Handle(0)))
 	binary.BigEndian.PutUint32(name, uint32(handle))
+	return name
+}
+
+// handleName returns the name of an entity whose name is its handle, using the precomputed name if there is one.
+func handleName(handle Handle) Name {
+	if name, ok := permanentHandleNames[handle]; ok {
+		return name
+	}
+	return makeHandleName(handle)
+}
+
+func makeDummyContext(handle Handle) *dummyContext {
 	return &dummyContext{
 		handleContext: handleContext{
 			Type: handleContextTypeDummy,
 			H:    handle,
-			N:    name}}
+			N:    handleName(handle)}}
 }
 
 type resourceContext struct {
@@ -326,14 +364,12 @@ type permanentContext struct {
 func (r *permanentContext) invalidate() {}
 
 func makePermanentContext(handle Handle) *permanentContext {
-	name := make(Name, binary.Size(Handle(0)))
-	binary.BigEndian.PutUint32(name, uint32(handle))
 	return &permanentContext{
 		resourceContext: resourceContext{
 			handleContext: handleContext{
 				Type: handleContextTypePermanent,
 				H:    handle,
-				N:    name}}}
+				N:    handleName(handle)}}}
 }
 
 type objectContext struct {
@@ -359,10 +395,13 @@ func (t *TPMContext) makeObjectContextFromTPM(context ResourceContext, sessions
 	if err != nil {
 		return nil, err
 	}
+	if t.skipConsistencyChecks {
+		return makeObjectContext(context.Handle(), name, pub), nil
+	}
 	if n, err := pub.Name(); err != nil {
-		return nil, &InvalidResponseError{CommandReadPublic, fmt.Sprintf("cannot compute name of returned public area: %v", err)}
+		return nil, &InvalidResponseError{Command: CommandReadPublic, msg: fmt.Sprintf("cannot compute name of returned public area: %v", err)}
 	} else if !bytes.Equal(n, name) {
-		return nil, &InvalidResponseError{CommandReadPublic, "name and public area don't match"}
+		return nil, &InvalidResponseError{Command: CommandReadPublic, msg: "name and public area don't match"}
 	}
 	return makeObjectContext(context.Handle(), name, pub), nil
 }
@@ -375,16 +414,24 @@ func (r *nvIndexContext) GetPublic() *NVPublic {
 	return r.Data.NV
 }
 
-func (r *nvIndexContext) SetAttr(a NVAttributes) {
-	r.Data.NV.Attrs |= a
+// setAttrs updates the attributes of the public area associated with this context. The name is only recomputed if the attributes
+// change, so that commands which repeatedly set attributes that are already set (such as TPM2_NV_Write setting AttrNVWritten) don't
+// hash the public area every time.
+func (r *nvIndexContext) setAttrs(attrs NVAttributes) {
+	if attrs == r.Data.NV.Attrs {
+		return
+	}
+	r.Data.NV.Attrs = attrs
 	name, _ := r.Data.NV.Name()
 	r.N = name
 }
 
+func (r *nvIndexContext) SetAttr(a NVAttributes) {
+	r.setAttrs(r.Data.NV.Attrs | a)
+}
+
 func (r *nvIndexContext) ClearAttr(a NVAttributes) {
-	r.Data.NV.Attrs &= ^a
-	name, _ := r.Data.NV.Name()
-	r.N = name
+	r.setAttrs(r.Data.NV.Attrs &^ a)
 }
 
 func (r *nvIndexContext) Attrs() NVAttributes {
@@ -406,13 +453,15 @@ func (t *TPMContext) makeNVIndexContextFromTPM(context ResourceContext, sessions
 	if err != nil {
 		return nil, err
 	}
-	if n, err := pub.Name(); err != nil {
-		return nil, &InvalidResponseError{CommandNVReadPublic, fmt.Sprintf("cannot compute name of returned public area: %v", err)}
-	} else if !bytes.Equal(n, name) {
-		return nil, &InvalidResponseError{CommandNVReadPublic, "name and public area don't match"}
+	if !t.skipConsistencyChecks {
+		if n, err := pub.Name(); err != nil {
+			return nil, &InvalidResponseError{Command: CommandNVReadPublic, msg: fmt.Sprintf("cannot compute name of returned public area: %v", err)}
+		} else if !bytes.Equal(n, name) {
+			return nil, &InvalidResponseError{Command: CommandNVReadPublic, msg: "name and public area don't match"}
+		}
 	}
 	if pub.Index != context.Handle() {
-		return nil, &InvalidResponseError{CommandNVReadPublic, "unexpected index in public area"}
+		return nil, &InvalidResponseError{Command: CommandNVReadPublic, msg: "unexpected index in public area"}
 	}
 	return makeNVIndexContext(name, pub), nil
 }
@@ -420,6 +469,26 @@ func (t *TPMContext) makeNVIndexContextFromTPM(context ResourceContext, sessions
 type sessionContext struct {
 	*handleContext
 	attrs SessionAttributes
+
+	// hmac is the HMAC state used for the last command or response HMAC computed for this session, keyed with hmacKey. It is reused
+	// for subsequent HMACs computed with the same key, which is the common case for a session used to authorize the same resource
+	// or for parameter encryption.
+	hmac    hash.Hash
+	hmacAlg HashAlgorithmId
+	hmacKey []byte
+}
+
+// hmacForKey returns a HMAC state for this session's digest algorithm that is keyed with the supplied key.
+func (r *sessionContext) hmacForKey(key []byte) hash.Hash {
+	hashAlg := r.Data().HashAlg
+	if r.hmac != nil && hashAlg == r.hmacAlg && hmac.Equal(key, r.hmacKey) {
+		r.hmac.Reset()
+		return r.hmac
+	}
+	r.hmac = hmac.New(hashAlg.NewHash, key)
+	r.hmacAlg = hashAlg
+	r.hmacKey = key
+	return r.hmac
 }
 
 func (r *sessionContext) NonceTPM() Nonce {
@@ -466,29 +535,57 @@ func (r *sessionContext) Data() *sessionContextData {
 	return r.handleContext.Data.Session
 }
 
-func (r *sessionContext) tpmAttrs() sessionAttrs {
+func (a SessionAttributes) tpmAttrs() sessionAttrs {
 	var attrs sessionAttrs
-	if r.attrs&AttrContinueSession > 0 {
+	if a&AttrContinueSession > 0 {
 		attrs |= attrContinueSession
 	}
-	if r.attrs&AttrAuditExclusive > 0 {
+	if a&AttrAuditExclusive > 0 {
 		attrs |= (attrAuditExclusive | attrAudit)
 	}
-	if r.attrs&AttrAuditReset > 0 {
+	if a&AttrAuditReset > 0 {
 		attrs |= (attrAuditReset | attrAudit)
 	}
-	if r.attrs&AttrCommandEncrypt > 0 {
+	if a&AttrCommandEncrypt > 0 {
 		attrs |= attrDecrypt
 	}
-	if r.attrs&AttrResponseEncrypt > 0 {
+	if a&AttrResponseEncrypt > 0 {
 		attrs |= attrEncrypt
 	}
-	if r.attrs&AttrAudit > 0 {
+	if a&AttrAudit > 0 {
 		attrs |= attrAudit
 	}
 	return attrs
 }
 
+// isPassword indicates whether this corresponds to the password session returned from PasswordSession.
+func (r *sessionContext) isPassword() bool {
+	return r.H == HandlePW
+}
+
+// isPasswordSession indicates whether the supplied SessionContext was returned from PasswordSession.
+func isPasswordSession(session SessionContext) bool {
+	s, isSession := session.(*sessionContext)
+	return isSession && s.isPassword()
+}
+
+// PasswordSession returns a SessionContext that corresponds to the password session (TPM_RS_PW), which can be supplied to any
+// function that accepts a SessionContext for authorization in order to explicitly request cleartext password authorization using
+// the authorization value set on the associated ResourceContext. This is equivalent to supplying a nil SessionContext, but makes
+// the use of cleartext authorization visible at the call site.
+//
+// The password session can only be used for authorization. It cannot be used for command auditing or parameter encryption, and
+// supplying it in any other position will result in an error.
+func PasswordSession() SessionContext {
+	return &sessionContext{
+		handleContext: &handleContext{
+			Type: handleContextTypeSession,
+			H:    HandlePW,
+			N:    handleName(HandlePW),
+			Data: &handleContextU{}},
+		attrs: AttrContinueSession}
+}
+
 func makeSessionContext(handle Handle, data *sessionContextData) *sessionContext {
 	name := make(Name, binary.Size(Handle(0)))
 	binary.BigEndian.PutUint32(name, uint32(handle))
@@ -509,7 +606,7 @@ func makeSessionContext(handle Handle, data *sessionContextData) *sessionContext
 // on the second read once the name is known. This second read provides an assurance that an entity with the name of the returned
 // ResourceContext actually lives on the TPM.
 //
-// This function will panic if handle doesn't correspond to a NV index, transient object or persistent object.
+// An InvalidHandleTypeError error will be returned if handle doesn't correspond to a NV index, transient object or persistent object.
 //
 // If subsequent use of the returned ResourceContext requires knowledge of the authorization value of the corresponding TPM resource,
 // this should be provided by calling ResourceContext.SetAuthValue.
@@ -517,25 +614,15 @@ func (t *TPMContext) CreateResourceContextFromTPM(handle Handle, sessions ...Ses
 	switch handle.Type() {
 	case HandleTypeNVIndex, HandleTypeTransient, HandleTypePersistent:
 	default:
-		panic("invalid handle type")
+		return nil, InvalidHandleTypeError{handle}
 	}
 
 	var rc ResourceContext = makeDummyContext(handle)
 	var s []SessionContext
 	for i := 0; i < 2; i++ {
 		var err error
-		if handle.Type() == HandleTypeNVIndex {
-			rc, err = t.makeNVIndexContextFromTPM(rc, s...)
-		} else {
-			rc, err = t.makeObjectContextFromTPM(rc, s...)
-		}
-
-		switch {
-		case IsTPMWarning(err, WarningReferenceH0, AnyCommandCode):
-			return nil, ResourceUnavailableError{handle}
-		case IsTPMHandleError(err, ErrorHandle, AnyCommandCode, AnyHandleIndex):
-			return nil, ResourceUnavailableError{handle}
-		case err != nil:
+		rc, err = t.readResourceContextFromTPM(rc, s...)
+		if err != nil {
 			return nil, err
 		}
 
@@ -548,6 +635,54 @@ func (t *TPMContext) CreateResourceContextFromTPM(handle Handle, sessions ...Ses
 	return rc, nil
 }
 
+// CreateResourceContextFromTPMWithName is a variant of TPMContext.CreateResourceContextFromTPM for applications that already know
+// the name of the resource, for example, because it was recorded when the resource was created. As the name is known, the public
+// area is only read back from the TPM once, with any supplied sessions being used for this read. This provides the same assurance as
+// calling TPMContext.CreateResourceContextFromTPM with sessions, but with a single round trip to the TPM.
+//
+// If the name of the resource on the TPM doesn't match the supplied name, an error will be returned. This may be returned from the
+// TPM if the supplied sessions are used for command auditing or parameter encryption.
+//
+// An InvalidHandleTypeError error will be returned if handle doesn't correspond to a NV index, transient object or persistent object.
+func (t *TPMContext) CreateResourceContextFromTPMWithName(handle Handle, name Name, sessions ...SessionContext) (ResourceContext, error) {
+	switch handle.Type() {
+	case HandleTypeNVIndex, HandleTypeTransient, HandleTypePersistent:
+	default:
+		return nil, InvalidHandleTypeError{handle}
+	}
+
+	context := makeDummyContext(handle)
+	context.N = name
+
+	rc, err := t.readResourceContextFromTPM(context, sessions...)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(rc.Name(), name) {
+		return nil, fmt.Errorf("the resource at handle 0x%08x has an unexpected name", handle)
+	}
+	return rc, nil
+}
+
+func (t *TPMContext) readResourceContextFromTPM(context ResourceContext, sessions ...SessionContext) (rc ResourceContext, err error) {
+	if context.Handle().Type() == HandleTypeNVIndex {
+		rc, err = t.makeNVIndexContextFromTPM(context, sessions...)
+	} else {
+		rc, err = t.makeObjectContextFromTPM(context, sessions...)
+	}
+
+	switch {
+	case IsTPMWarning(err, WarningReferenceH0, AnyCommandCode):
+		return nil, ResourceUnavailableError{context.Handle()}
+	case IsTPMHandleError(err, ErrorHandle, AnyCommandCode, AnyHandleIndex):
+		return nil, ResourceUnavailableError{context.Handle()}
+	case err != nil:
+		return nil, err
+	}
+
+	return rc, nil
+}
+
 // CreateIncompleteSessionContext creates and returns a new SessionContext for the specified handle. The returned SessionContext will
 // not be complete and the session associated with it cannot be used in any command other than TPMContext.FlushContext.
 //
@@ -563,22 +698,33 @@ func CreateIncompleteSessionContext(handle Handle) SessionContext {
 
 // GetPermanentContext returns a ResourceContext for the specified permanent handle or PCR handle.
 //
-// This function will panic if handle does not correspond to a permanent or PCR handle.
+// This function will panic if handle does not correspond to a permanent or PCR handle. Use TPMContext.TryGetPermanentContext if
+// handle is obtained from an untrusted source.
 //
 // If subsequent use of the returned ResourceContext requires knowledge of the authorization value of the corresponding TPM resource,
 // this should be provided by calling ResourceContext.SetAuthValue.
 func (t *TPMContext) GetPermanentContext(handle Handle) ResourceContext {
+	rc, err := t.TryGetPermanentContext(handle)
+	if err != nil {
+		panic("invalid handle type")
+	}
+	return rc
+}
+
+// TryGetPermanentContext is a variant of TPMContext.GetPermanentContext that returns an InvalidHandleTypeError error instead of
+// panicking if handle does not correspond to a permanent or PCR handle.
+func (t *TPMContext) TryGetPermanentContext(handle Handle) (ResourceContext, error) {
 	switch handle.Type() {
 	case HandleTypePermanent, HandleTypePCR:
 		if rc, exists := t.permanentResources[handle]; exists {
-			return rc
+			return rc, nil
 		}
 
 		rc := makePermanentContext(handle)
 		t.permanentResources[handle] = rc
-		return rc
+		return rc, nil
 	default:
-		panic("invalid handle type")
+		return nil, InvalidHandleTypeError{handle}
 	}
 }
 
@@ -613,13 +759,23 @@ func (t *TPMContext) PlatformNVHandleContext() ResourceContext {
 }
 
 // PCRHandleContext returns the ResourceContext corresponding to the PCR at the specified index. It will panic if pcr is not a valid
-// PCR index.
+// PCR index. Use TPMContext.TryPCRHandleContext if pcr is obtained from an untrusted source.
 func (t *TPMContext) PCRHandleContext(pcr int) ResourceContext {
-	h := Handle(pcr)
-	if h.Type() != HandleTypePCR {
+	rc, err := t.TryPCRHandleContext(pcr)
+	if err != nil {
 		panic("invalid PCR index")
 	}
-	return t.GetPermanentContext(h)
+	return rc
+}
+
+// TryPCRHandleContext is a variant of TPMContext.PCRHandleContext that returns an error instead of panicking if pcr is not a valid
+// PCR index.
+func (t *TPMContext) TryPCRHandleContext(pcr int) (ResourceContext, error) {
+	h := Handle(pcr)
+	if pcr < 0 || h.Type() != HandleTypePCR {
+		return nil, makeInvalidArgError("pcr", fmt.Sprintf("invalid PCR index %d", pcr))
+	}
+	return t.TryGetPermanentContext(h)
 }
 
 // CreateHandleContextFromReader returns a new HandleContext created from the serialized data read from the supplied io.Reader. This
@@ -642,18 +798,14 @@ func CreateHandleContextFromReader(r io.Reader) (HandleContext, error) {
 	}
 	h := integrityAlg.NewHash()
 	h.Write(b)
-	if !bytes.Equal(h.Sum(nil), integrity) {
+	if subtle.ConstantTimeCompare(h.Sum(nil), integrity) != 1 {
 		return nil, errors.New("invalid checksum")
 	}
 
 	var data *handleContext
-	n, err := mu.UnmarshalFromBytes(b, &data)
-	if err != nil {
+	if _, err := mu.UnmarshalFromBytesStrict(b, &data); err != nil {
 		return nil, xerrors.Errorf("cannot unmarshal context data: %w", err)
 	}
-	if n < len(b) {
-		return nil, errors.New("context blob contains trailing bytes")
-	}
 
 	if data.Type == handleContextTypePermanent {
 		return nil, errors.New("cannot create a permanent context from serialized data")
@@ -694,6 +846,175 @@ func CreateHandleContextFromBytes(b []byte) (HandleContext, int, error) {
 	return rc, len(b) - buf.Len(), nil
 }
 
+// encryptedHandleContextAdditionalData is the additional data authenticated by the AEAD used to encrypt a serialized HandleContext,
+// so that the ciphertext can't be substituted for data encrypted with the same key for another purpose.
+var encryptedHandleContextAdditionalData = []byte("GO-TPM2-HANDLE-CONTEXT")
+
+type encryptedHandleContextPayload struct {
+	Context   []byte
+	AuthValue Auth
+}
+
+// SerializeHandleContextEncrypted returns the serialized form of the supplied HandleContext, encrypted and authenticated with the
+// supplied AEAD. The serialized form of a SessionContext contains the session key and nonces, which would allow anybody with access
+// to it to authorize commands with the session, so this should be used instead of HandleContext.SerializeToBytes when saving a
+// session to untrusted storage. If the context is a ResourceContext, its authorization value is included as well.
+//
+// The data can be restored with CreateHandleContextFromEncryptedBytes using an AEAD with the same key.
+func SerializeHandleContextEncrypted(context HandleContext, aead cipher.AEAD) ([]byte, error) {
+	if context == nil {
+		return nil, makeInvalidArgError("context", "nil value")
+	}
+	data := context.SerializeToBytes()
+	if data == nil {
+		return nil, makeInvalidArgError("context", "cannot be serialized")
+	}
+
+	payload := encryptedHandleContextPayload{Context: data}
+	if rc, isResource := context.(resourceContextPrivate); isResource {
+		payload.AuthValue = rc.GetAuthValue()
+	}
+	plaintext, err := mu.MarshalToBytes(&payload)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot marshal payload: %w", err)
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, xerrors.Errorf("cannot create nonce: %w", err)
+	}
+
+	return mu.MarshalToBytes(nonce, aead.Seal(nil, nonce, plaintext, encryptedHandleContextAdditionalData))
+}
+
+// CreateHandleContextFromEncryptedBytes returns a new HandleContext created from the data returned from
+// SerializeHandleContextEncrypted, which is decrypted and authenticated with the supplied AEAD. If the data corresponds to a
+// ResourceContext, its authorization value is restored.
+func CreateHandleContextFromEncryptedBytes(b []byte, aead cipher.AEAD) (HandleContext, error) {
+	var nonce []byte
+	var ciphertext []byte
+	if _, err := mu.UnmarshalFromBytes(b, &nonce, &ciphertext); err != nil {
+		return nil, xerrors.Errorf("cannot unpack nonce and ciphertext: %w", err)
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid nonce size")
+	}
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, encryptedHandleContextAdditionalData)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot decrypt context: %w", err)
+	}
+
+	var payload encryptedHandleContextPayload
+	if _, err := mu.UnmarshalFromBytesStrict(plaintext, &payload); err != nil {
+		return nil, xerrors.Errorf("cannot unmarshal payload: %w", err)
+	}
+
+	hc, _, err := CreateHandleContextFromBytes(payload.Context)
+	if err != nil {
+		return nil, err
+	}
+	if rc, isResource := hc.(ResourceContext); isResource {
+		rc.SetAuthValue(payload.AuthValue)
+	}
+	return hc, nil
+}
+
+// SessionContextInfo describes the session state contained in a serialized SessionContext. It omits the session key.
+type SessionContextInfo struct {
+	HashAlg     HashAlgorithmId // The session's digest algorithm
+	SessionType SessionType
+	IsAudit     bool    // Whether the session has been used for audit
+	IsExclusive bool    // Whether the session was exclusive for audit purposes
+	IsBound     bool    // Whether the session is bound to an entity
+	BoundEntity Name    // The name of the entity that the session is bound to
+	Symmetric   *SymDef // The session's symmetric algorithm for parameter encryption
+	NonceCaller Nonce
+	NonceTPM    Nonce
+}
+
+// HandleContextInfo describes the contents of a serialized HandleContext, and is returned from DecodeHandleContext.
+type HandleContextInfo struct {
+	Type   string // The type of context - "object", "nv-index", "session" or "permanent"
+	Handle Handle
+	Name   Name
+
+	Object  *Public             // The public area of an object context
+	NV      *NVPublic           // The public area of a NV index context
+	Session *SessionContextInfo // The state of a session context. This is nil if the context doesn't contain any session state
+
+	// ChecksumValid indicates whether the checksum in the serialized data matches its contents. If it is false, the data has been
+	// modified or corrupted and the other fields may not be reliable.
+	ChecksumValid bool
+
+	// ConsistencyError is set if the contents of the serialized data are inconsistent, in which case CreateHandleContextFromBytes
+	// would reject it.
+	ConsistencyError error
+}
+
+// DecodeHandleContext decodes the serialized data produced by HandleContext.SerializeToBytes or HandleContext.SerializeToWriter,
+// and returns a description of its contents. Unlike CreateHandleContextFromBytes, it doesn't reject data with an invalid
+// checksum or inconsistent contents. Instead, these are indicated by the ChecksumValid and ConsistencyError fields of the returned
+// HandleContextInfo, which makes this useful for debugging saved contexts that can no longer be loaded.
+//
+// An error is only returned if the data cannot be decoded.
+func DecodeHandleContext(b []byte) (*HandleContextInfo, error) {
+	var integrityAlg HashAlgorithmId
+	var integrity []byte
+	var blob []byte
+	if _, err := mu.UnmarshalFromBytes(b, &integrityAlg, &integrity, &blob); err != nil {
+		return nil, xerrors.Errorf("cannot unpack context blob and checksum: %w", err)
+	}
+
+	var data *handleContext
+	if _, err := mu.UnmarshalFromBytesStrict(blob, &data); err != nil {
+		return nil, xerrors.Errorf("cannot unmarshal context data: %w", err)
+	}
+
+	info := &HandleContextInfo{
+		Handle: data.H,
+		Name:   data.N}
+	if integrityAlg.Supported() {
+		h := integrityAlg.NewHash()
+		h.Write(blob)
+		info.ChecksumValid = subtle.ConstantTimeCompare(h.Sum(nil), integrity) == 1
+	}
+
+	switch data.Type {
+	case handleContextTypePermanent:
+		info.Type = "permanent"
+		info.ConsistencyError = errors.New("cannot create a permanent context from serialized data")
+	case handleContextTypeObject:
+		info.Type = "object"
+		info.Object = data.Data.Object
+	case handleContextTypeNvIndex:
+		info.Type = "nv-index"
+		info.NV = data.Data.NV
+	case handleContextTypeSession:
+		info.Type = "session"
+		if scData := data.Data.Session; scData != nil {
+			info.Session = &SessionContextInfo{
+				HashAlg:     scData.HashAlg,
+				SessionType: scData.SessionType,
+				IsAudit:     scData.IsAudit,
+				IsExclusive: scData.IsExclusive,
+				IsBound:     scData.IsBound,
+				BoundEntity: scData.BoundEntity,
+				Symmetric:   scData.Symmetric,
+				NonceCaller: scData.NonceCaller,
+				NonceTPM:    scData.NonceTPM}
+		}
+	default:
+		info.Type = "unknown"
+	}
+
+	if info.ConsistencyError == nil {
+		info.ConsistencyError = data.checkConsistency()
+	}
+
+	return info, nil
+}
+
 // CreateNVIndexResourceContextFromPublic returns a new ResourceContext created from the provided public area. If subsequent use of
 // the returned ResourceContext requires knowledge of the authorization value of the corresponding TPM resource, this should be
 // provided by calling ResourceContext.SetAuthValue.
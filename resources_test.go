@@ -6,10 +6,16 @@ package tpm2_test
 
 import (
 	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"reflect"
 	"testing"
 
 	. "github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
 	"github.com/canonical/go-tpm2/testutil"
+
+	"golang.org/x/xerrors"
 )
 
 func TestCreateResourceContextFromTPM(t *testing.T) {
@@ -153,6 +159,186 @@ func TestCreateHandleContextFromBytes(t *testing.T) {
 	})
 }
 
+func TestCreateHandleContextFromBytesInvalidChecksum(t *testing.T) {
+	rc, err := CreateNVIndexResourceContextFromPublic(&NVPublic{
+		Index:   0x01800000,
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead),
+		Size:    8})
+	if err != nil {
+		t.Fatalf("CreateNVIndexResourceContextFromPublic failed: %v", err)
+	}
+	b := rc.SerializeToBytes()
+	// Corrupt the last byte of the checksum, which follows the 2 byte algorithm and 2 byte size fields.
+	b[2+2+32-1] ^= 0xff
+
+	if _, _, err := CreateHandleContextFromBytes(b); err == nil || err.Error() != "invalid checksum" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestDecodeHandleContext(t *testing.T) {
+	pub := NVPublic{
+		Index:   0x01800000,
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead),
+		Size:    8}
+	rc, err := CreateNVIndexResourceContextFromPublic(&pub)
+	if err != nil {
+		t.Fatalf("CreateNVIndexResourceContextFromPublic failed: %v", err)
+	}
+
+	t.Run("NV", func(t *testing.T) {
+		info, err := DecodeHandleContext(rc.SerializeToBytes())
+		if err != nil {
+			t.Fatalf("DecodeHandleContext failed: %v", err)
+		}
+		expected := &HandleContextInfo{
+			Type:          "nv-index",
+			Handle:        0x01800000,
+			Name:          rc.Name(),
+			NV:            &pub,
+			ChecksumValid: true}
+		if !reflect.DeepEqual(info, expected) {
+			t.Errorf("Unexpected info: %+v", info)
+		}
+	})
+
+	t.Run("InvalidChecksum", func(t *testing.T) {
+		b := rc.SerializeToBytes()
+		b[2+2+32-1] ^= 0xff
+
+		info, err := DecodeHandleContext(b)
+		if err != nil {
+			t.Fatalf("DecodeHandleContext failed: %v", err)
+		}
+		if info.ChecksumValid {
+			t.Errorf("Checksum should be invalid")
+		}
+		if info.Handle != 0x01800000 || info.ConsistencyError != nil {
+			t.Errorf("Unexpected info: %+v", info)
+		}
+	})
+
+	t.Run("Session", func(t *testing.T) {
+		sc := MakeMockSessionContext(0x02000000, &SessionContextData{
+			HashAlg:     HashAlgorithmSHA256,
+			SessionType: SessionTypeHMAC,
+			SessionKey:  make([]byte, 32),
+			NonceCaller: make(Nonce, 32),
+			NonceTPM:    make(Nonce, 20),
+			Symmetric:   &SymDef{Algorithm: SymAlgorithmNull}})
+
+		info, err := DecodeHandleContext(sc.SerializeToBytes())
+		if err != nil {
+			t.Fatalf("DecodeHandleContext failed: %v", err)
+		}
+		if info.Type != "session" || info.Handle != 0x02000000 || !info.ChecksumValid {
+			t.Errorf("Unexpected info: %+v", info)
+		}
+		if info.Session == nil || info.Session.HashAlg != HashAlgorithmSHA256 || info.Session.SessionType != SessionTypeHMAC {
+			t.Errorf("Unexpected session info: %+v", info.Session)
+		}
+		if info.ConsistencyError == nil || info.ConsistencyError.Error() != "unexpected nonce size for session context" {
+			t.Errorf("Unexpected consistency error: %v", info.ConsistencyError)
+		}
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		b := rc.SerializeToBytes()
+		if _, err := DecodeHandleContext(b[:10]); err == nil {
+			t.Errorf("DecodeHandleContext should fail with truncated data")
+		}
+	})
+}
+
+func TestSerializeHandleContextEncrypted(t *testing.T) {
+	block, err := aes.NewCipher(make([]byte, 16))
+	if err != nil {
+		t.Fatalf("NewCipher failed: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatalf("NewGCM failed: %v", err)
+	}
+
+	t.Run("Session", func(t *testing.T) {
+		sessionKey := []byte("0123456789abcdef0123456789abcdef")
+		sc := MakeMockSessionContext(0x02000000, &SessionContextData{
+			HashAlg:     HashAlgorithmSHA256,
+			SessionType: SessionTypeHMAC,
+			SessionKey:  sessionKey,
+			NonceCaller: make(Nonce, 32),
+			NonceTPM:    make(Nonce, 32),
+			Symmetric:   &SymDef{Algorithm: SymAlgorithmNull}})
+
+		b, err := SerializeHandleContextEncrypted(sc, aead)
+		if err != nil {
+			t.Fatalf("SerializeHandleContextEncrypted failed: %v", err)
+		}
+		if bytes.Contains(b, sessionKey) {
+			t.Errorf("Serialized data contains the session key")
+		}
+
+		hc, err := CreateHandleContextFromEncryptedBytes(b, aead)
+		if err != nil {
+			t.Fatalf("CreateHandleContextFromEncryptedBytes failed: %v", err)
+		}
+		restored, ok := hc.(SessionContext)
+		if !ok {
+			t.Fatalf("Unexpected type: %T", hc)
+		}
+		if restored.Handle() != sc.Handle() || !bytes.Equal(restored.(*TestSessionContext).Data().SessionKey, sessionKey) {
+			t.Errorf("Restored session doesn't match")
+		}
+	})
+
+	t.Run("ResourceWithAuth", func(t *testing.T) {
+		pub := NVPublic{
+			Index:   0x01800000,
+			NameAlg: HashAlgorithmSHA256,
+			Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead),
+			Size:    8}
+		rc, err := CreateNVIndexResourceContextFromPublic(&pub)
+		if err != nil {
+			t.Fatalf("CreateNVIndexResourceContextFromPublic failed: %v", err)
+		}
+		rc.SetAuthValue([]byte("foo"))
+
+		b, err := SerializeHandleContextEncrypted(rc, aead)
+		if err != nil {
+			t.Fatalf("SerializeHandleContextEncrypted failed: %v", err)
+		}
+		hc, err := CreateHandleContextFromEncryptedBytes(b, aead)
+		if err != nil {
+			t.Fatalf("CreateHandleContextFromEncryptedBytes failed: %v", err)
+		}
+		if !bytes.Equal(hc.Name(), rc.Name()) {
+			t.Errorf("Unexpected name")
+		}
+		if !bytes.Equal(hc.(ResourceContextPrivate).GetAuthValue(), []byte("foo")) {
+			t.Errorf("Auth value wasn't restored")
+		}
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		sc := MakeMockSessionContext(0x02000000, &SessionContextData{
+			HashAlg:     HashAlgorithmSHA256,
+			SessionType: SessionTypeHMAC,
+			NonceCaller: make(Nonce, 32),
+			NonceTPM:    make(Nonce, 32),
+			Symmetric:   &SymDef{Algorithm: SymAlgorithmNull}})
+		b, err := SerializeHandleContextEncrypted(sc, aead)
+		if err != nil {
+			t.Fatalf("SerializeHandleContextEncrypted failed: %v", err)
+		}
+		b[len(b)-1] ^= 0xff
+		if _, err := CreateHandleContextFromEncryptedBytes(b, aead); err == nil || err.Error() != "cannot decrypt context: cipher: message authentication failed" {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	})
+}
+
 func TestCreateResourceContextFromTPMWithSession(t *testing.T) {
 	tpm := openTPMForTesting(t, testutil.TPMFeatureOwnerPersist)
 	defer closeTPM(t, tpm)
@@ -345,3 +531,116 @@ func TestSessionContextExcludeAttrs(t *testing.T) {
 		t.Errorf("SessionContext.ExcludeAttrs didn't work")
 	}
 }
+
+// mockKeyedHashReadPublic returns a mock TPM2_ReadPublic command for a keyed hash object at the specified handle, along with the
+// name of the object. The response contains the supplied name, or the name of the object if that is nil.
+func mockKeyedHashReadPublic(t *testing.T, handle Handle, name Name) (*testutil.MockCommand, Name) {
+	pub := Public{
+		Type:    ObjectTypeKeyedHash,
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   AttrFixedTPM | AttrFixedParent | AttrUserWithAuth,
+		Params:  &PublicParamsU{KeyedHashDetail: &KeyedHashParams{Scheme: KeyedHashScheme{Scheme: KeyedHashSchemeNull}}},
+		Unique:  &PublicIDU{KeyedHash: make(Digest, 32)}}
+	pubBytes, err := pub.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes failed: %v", err)
+	}
+	pubName, err := pub.Name()
+	if err != nil {
+		t.Fatalf("Name failed: %v", err)
+	}
+	if name == nil {
+		name = pubName
+	}
+	payload, err := mu.MarshalToBytes(uint16(len(pubBytes)), mu.RawBytes(pubBytes), name, Name(nil))
+	if err != nil {
+		t.Fatalf("MarshalToBytes failed: %v", err)
+	}
+	return &testutil.MockCommand{CommandCode: CommandReadPublic, Handles: []Handle{handle},
+		Response: &testutil.MockResponse{Params: []interface{}{mu.RawBytes(payload)}}}, pubName
+}
+
+func TestCreateResourceContextFromTPMWithName(t *testing.T) {
+	readPublic, name := mockKeyedHashReadPublic(t, 0x81000001, nil)
+
+	tcti := testutil.NewMockTCTI(readPublic, readPublic)
+	tpm, _ := NewTPMContext(tcti)
+
+	rc, err := tpm.CreateResourceContextFromTPMWithName(0x81000001, name)
+	if err != nil {
+		t.Fatalf("CreateResourceContextFromTPMWithName failed: %v", err)
+	}
+	if rc.Handle() != 0x81000001 || !bytes.Equal(rc.Name(), name) {
+		t.Errorf("Unexpected context: 0x%08x, %x", rc.Handle(), rc.Name())
+	}
+	if len(tcti.Commands()) != 1 {
+		t.Errorf("Unexpected number of commands: %d", len(tcti.Commands()))
+	}
+
+	if _, err := tpm.CreateResourceContextFromTPMWithName(0x81000001, make(Name, len(name))); err == nil ||
+		err.Error() != "the resource at handle 0x81000001 has an unexpected name" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestSetConsistencyChecks(t *testing.T) {
+	// Return a name that isn't consistent with the public area.
+	name := append(Name{0x00, 0x0b}, make([]byte, 32)...)
+	readPublic, _ := mockKeyedHashReadPublic(t, 0x81000001, name)
+
+	tcti := testutil.NewMockTCTI(readPublic, readPublic)
+	tpm, _ := NewTPMContext(tcti)
+
+	var e *InvalidResponseError
+	if _, err := tpm.CreateResourceContextFromTPM(0x81000001); !xerrors.As(err, &e) || e.Command != CommandReadPublic {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	tpm.SetConsistencyChecks(false)
+	rc, err := tpm.CreateResourceContextFromTPM(0x81000001)
+	if err != nil {
+		t.Fatalf("CreateResourceContextFromTPM failed: %v", err)
+	}
+	if !bytes.Equal(rc.Name(), name) {
+		t.Errorf("Unexpected name: %x", rc.Name())
+	}
+}
+
+func TestCachedNames(t *testing.T) {
+	nvWriteLock := &testutil.MockCommand{CommandCode: CommandNVWriteLock, Response: &testutil.MockResponse{PasswordSessions: 1}}
+	tpm, _ := NewTPMContext(testutil.NewMockTCTI(nvWriteLock, nvWriteLock))
+
+	if !bytes.Equal(tpm.OwnerHandleContext().Name(), []byte{0x40, 0x00, 0x00, 0x01}) {
+		t.Errorf("Unexpected name for owner hierarchy: %x", tpm.OwnerHandleContext().Name())
+	}
+	if !bytes.Equal(tpm.PCRHandleContext(7).Name(), []byte{0x00, 0x00, 0x00, 0x07}) {
+		t.Errorf("Unexpected name for PCR: %x", tpm.PCRHandleContext(7).Name())
+	}
+
+	pub := NVPublic{
+		Index:   0x01800000,
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead | AttrNVWritten),
+		Size:    8}
+	rc, err := CreateNVIndexResourceContextFromPublic(&pub)
+	if err != nil {
+		t.Fatalf("CreateNVIndexResourceContextFromPublic failed: %v", err)
+	}
+
+	if err := tpm.NVWriteLock(rc, rc, nil); err != nil {
+		t.Fatalf("NVWriteLock failed: %v", err)
+	}
+	pub.Attrs |= AttrNVWriteLocked
+	expected, _ := pub.Name()
+	name := rc.Name()
+	if !bytes.Equal(name, expected) {
+		t.Errorf("Name wasn't updated after attributes changed")
+	}
+
+	if err := tpm.NVWriteLock(rc, rc, nil); err != nil {
+		t.Fatalf("NVWriteLock failed: %v", err)
+	}
+	if &rc.Name()[0] != &name[0] {
+		t.Errorf("Name was recomputed even though the attributes didn't change")
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"math/big"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// rsaEKCertHandle is the NV index of the RSA 2048 EK certificate, as defined by the TCG EK Credential Profile.
+	rsaEKCertHandle Handle = 0x01c00002
+
+	// eccEKCertHandle is the NV index of the ECC NIST P256 EK certificate, as defined by the TCG EK Credential Profile.
+	eccEKCertHandle Handle = 0x01c0000a
+)
+
+// defaultEKAuthPolicy is the authorization policy of the default EK templates, which is PolicySecret(TPM_RH_ENDORSEMENT).
+var defaultEKAuthPolicy = Digest{0x83, 0x71, 0x97, 0x67, 0x44, 0x84, 0xb3, 0xf8, 0x1a, 0x90, 0xcc, 0x8d, 0x46, 0xa5, 0xd7, 0x24,
+	0xfd, 0x52, 0xd7, 0x6e, 0x06, 0x52, 0x0b, 0x64, 0xf2, 0xa1, 0xda, 0x1b, 0x33, 0x14, 0x69, 0xaa}
+
+// makeDefaultEKTemplate returns the default RSA 2048 EK template from the TCG EK Credential Profile (template L-1).
+func makeDefaultEKTemplate() *Public {
+	return &Public{
+		Type:       ObjectTypeRSA,
+		NameAlg:    HashAlgorithmSHA256,
+		Attrs:      AttrFixedTPM | AttrFixedParent | AttrSensitiveDataOrigin | AttrAdminWithPolicy | AttrRestricted | AttrDecrypt,
+		AuthPolicy: defaultEKAuthPolicy,
+		Params: &PublicParamsU{
+			RSADetail: &RSAParams{
+				Symmetric: SymDefObject{
+					Algorithm: SymObjectAlgorithmAES,
+					KeyBits:   &SymKeyBitsU{Sym: 128},
+					Mode:      &SymModeU{Sym: SymModeCFB}},
+				Scheme:   RSAScheme{Scheme: RSASchemeNull},
+				KeyBits:  2048,
+				Exponent: 0}},
+		Unique: &PublicIDU{RSA: make(PublicKeyRSA, 256)}}
+}
+
+func publicToCryptoPublicKey(public *Public) (crypto.PublicKey, error) {
+	switch public.Type {
+	case ObjectTypeRSA:
+		exp := int(public.Params.RSADetail.Exponent)
+		if exp == 0 {
+			exp = DefaultRSAExponent
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(public.Unique.RSA), E: exp}, nil
+	case ObjectTypeECC:
+		curve := eccCurveToGoCurve(public.Params.ECCDetail.CurveID)
+		if curve == nil {
+			return nil, errors.New("unsupported curve")
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(public.Unique.ECC.X),
+			Y:     new(big.Int).SetBytes(public.Unique.ECC.Y)}, nil
+	default:
+		return nil, errors.New("unsupported object type")
+	}
+}
+
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	switch k := a.(type) {
+	case *rsa.PublicKey:
+		other, ok := b.(*rsa.PublicKey)
+		return ok && k.N.Cmp(other.N) == 0 && k.E == other.E
+	case *ecdsa.PublicKey:
+		other, ok := b.(*ecdsa.PublicKey)
+		return ok && k.Curve == other.Curve && k.X.Cmp(other.X) == 0 && k.Y.Cmp(other.Y) == 0
+	default:
+		return false
+	}
+}
+
+// VerifyEKCertificate verifies that the supplied DER encoded EK certificate chains to one of the roots in opts, and that it
+// certifies the public key of the EK with the supplied public area. If opts.KeyUsages is empty, it defaults to
+// x509.ExtKeyUsageAny, as EK certificates contain the TCG specific tcg-kp-EKCertificate extended key usage.
+//
+// A successful verification indicates that the EK with the supplied public area resides in a genuine TPM, and therefore that
+// secrets which are encrypted to it can only be recovered by that TPM.
+func VerifyEKCertificate(cert []byte, ek *Public, opts x509.VerifyOptions) error {
+	if ek == nil {
+		return makeInvalidArgError("ek", "nil value")
+	}
+
+	c, err := x509.ParseCertificate(cert)
+	if err != nil {
+		return xerrors.Errorf("cannot parse certificate: %w", err)
+	}
+
+	if len(opts.KeyUsages) == 0 {
+		opts.KeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+	}
+	if _, err := c.Verify(opts); err != nil {
+		return xerrors.Errorf("cannot verify certificate: %w", err)
+	}
+
+	key, err := publicToCryptoPublicKey(ek)
+	if err != nil {
+		return xerrors.Errorf("cannot obtain public key of EK: %w", err)
+	}
+	if !publicKeysEqual(key, c.PublicKey) {
+		return errors.New("certificate does not match EK")
+	}
+	return nil
+}
+
+// SecureChannelOptions contains the options for TPMContext.OpenSecureChannel.
+type SecureChannelOptions struct {
+	// EKTemplate is the template used to create the EK. If nil, the default RSA 2048 template from the TCG EK Credential Profile
+	// is used.
+	EKTemplate *Public
+
+	// EKCertificate is the DER encoded certificate for the EK. If nil, it is read from the NV index that the TCG EK Credential
+	// Profile defines for the default template of the same type as the EK.
+	EKCertificate []byte
+
+	// VerifyOptions is used to verify the EK certificate. It must contain the root certificates of the TPM manufacturers that
+	// are trusted.
+	VerifyOptions x509.VerifyOptions
+
+	// Bind is the resource that the session is bound to. If nil, the session is bound to the endorsement hierarchy. The
+	// authorization value for this resource is included in the session key.
+	Bind ResourceContext
+
+	// AuthHash is the digest algorithm of the session. If this is HashAlgorithmNull, HashAlgorithmSHA256 is used.
+	AuthHash HashAlgorithmId
+}
+
+// SecureChannel corresponds to a HMAC session that is salted with a key that has been verified to reside in a genuine TPM. It
+// provides protection against an adversary that is able to observe or tamper with communications between the host CPU and the
+// TPM, when its session is used for all commands that authorize the use of sensitive resources or that transfer secrets.
+type SecureChannel struct {
+	tpm     *TPMContext
+	session SessionContext
+}
+
+// Session returns the session associated with this channel. It has the AttrContinueSession, AttrCommandEncrypt and
+// AttrResponseEncrypt attributes set.
+//
+// It can be supplied as the authorization session for any command, in which case the first command parameter and first response
+// parameter are encrypted if the command supports it. Commands that don't require authorization can be protected by supplying the
+// session in the optional sessions argument, as long as their first command and response parameters support encryption.
+func (c *SecureChannel) Session() SessionContext {
+	return c.session
+}
+
+// Close flushes the session associated with this channel from the TPM. If it is the default session for authorizations, then
+// password authorizations are used again for subsequent commands.
+func (c *SecureChannel) Close() error {
+	if c.tpm.defaultAuthSession == c.session {
+		c.tpm.SetDefaultAuthSession(nil)
+	}
+	return c.tpm.FlushContext(c.session)
+}
+
+func (t *TPMContext) readEKCertificate(ek *Public) ([]byte, error) {
+	var handle Handle
+	switch ek.Type {
+	case ObjectTypeRSA:
+		handle = rsaEKCertHandle
+	case ObjectTypeECC:
+		handle = eccEKCertHandle
+	default:
+		return nil, errors.New("unsupported object type")
+	}
+
+	index, err := t.CreateResourceContextFromTPM(handle)
+	if err != nil {
+		return nil, err
+	}
+	pub, _, err := t.NVReadPublic(index)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot read public area: %w", err)
+	}
+	return t.NVRead(index, index, pub.Size, 0, nil)
+}
+
+// OpenSecureChannel establishes a session that protects against an adversary that is able to observe or tamper with
+// communications between the host CPU and the TPM (eg, with an interposer on the TPM bus).
+//
+// This creates the EK in the endorsement hierarchy with the template specified in opts, and verifies its certificate with
+// VerifyEKCertificate. If the certificate is verified, a HMAC session is started that is salted with the EK and that uses 128-bit
+// AES-CFB for parameter encryption. As the salt can only be recovered by the TPM that the certificate was issued for, an
+// adversary is unable to compute the session key and cannot forge authorizations, modify command or response parameters without
+// detection, or decrypt parameters that are encrypted with the session. The EK is flushed before this function returns.
+//
+// Creating the EK requires knowledge of the authorization value for the endorsement hierarchy, which is supplied with a password
+// session. This is normally empty, and the endorsement hierarchy doesn't protect any secrets that the channel is used for.
+//
+// The session is bound to opts.Bind, or to the endorsement hierarchy if that is nil, and the authorization value of the bind
+// entity is included in the session key. The authorization value must be set on the bind entity before calling this function.
+//
+// On success, the session is made the default session for authorizations with TPMContext.SetDefaultAuthSession, so that it is
+// used instead of a password authorization for every subsequent command that authorizes the use of a resource without
+// a session. This is a single switch that protects all of these commands. Commands that don't require authorization are only
+// protected if the session is supplied to them explicitly, as described in the documentation for SecureChannel.Session.
+//
+// As this uses password authorizations, it must be called before they are disabled with
+// TPMContext.SetRejectPasswordAuthorizations.
+//
+// The returned channel should be closed with SecureChannel.Close when it is no longer needed.
+func (t *TPMContext) OpenSecureChannel(opts *SecureChannelOptions) (*SecureChannel, error) {
+	if opts == nil {
+		opts = &SecureChannelOptions{}
+	}
+	template := opts.EKTemplate
+	if template == nil {
+		template = makeDefaultEKTemplate()
+	}
+	authHash := opts.AuthHash
+	if authHash == HashAlgorithmNull {
+		authHash = HashAlgorithmSHA256
+	}
+
+	ek, ekPublic, _, _, _, err := t.CreatePrimary(t.EndorsementHandleContext(), nil, template, nil, nil, nil)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot create EK: %w", err)
+	}
+	defer t.FlushContext(ek)
+
+	cert := opts.EKCertificate
+	if cert == nil {
+		cert, err = t.readEKCertificate(ekPublic)
+		if err != nil {
+			return nil, xerrors.Errorf("cannot read EK certificate: %w", err)
+		}
+	}
+	if err := VerifyEKCertificate(cert, ekPublic, opts.VerifyOptions); err != nil {
+		return nil, xerrors.Errorf("cannot verify EK certificate: %w", err)
+	}
+
+	symmetric := SymDef{
+		Algorithm: SymAlgorithmAES,
+		KeyBits:   &SymKeyBitsU{Sym: 128},
+		Mode:      &SymModeU{Sym: SymModeCFB}}
+	bind := opts.Bind
+	if bind == nil {
+		bind = t.EndorsementHandleContext()
+	}
+	session, err := t.StartAuthSession(ek, bind, SessionTypeHMAC, &symmetric, authHash)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot start session: %w", err)
+	}
+	session.SetAttrs(AttrContinueSession | AttrCommandEncrypt | AttrResponseEncrypt)
+	t.SetDefaultAuthSession(session)
+
+	return &SecureChannel{tpm: t, session: session}, nil
+}
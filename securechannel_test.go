@@ -0,0 +1,185 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"testing"
+
+	. "github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/testutil"
+
+	"golang.org/x/xerrors"
+
+	. "gopkg.in/check.v1"
+)
+
+func TestVerifyEKCertificate(t *testing.T) {
+	ca, err := testutil.NewTestCA()
+	if err != nil {
+		t.Fatalf("NewTestCA failed: %v", err)
+	}
+	otherCA, err := testutil.NewTestCA()
+	if err != nil {
+		t.Fatalf("NewTestCA failed: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	rsaEK := testutil.MakeRSAEKTemplate()
+	rsaEK.Unique.RSA = rsaKey.N.Bytes()
+
+	eccKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	eccEK := testutil.MakeECCEKTemplate()
+	eccEK.Unique.ECC = &ECCPoint{X: eccKey.X.Bytes(), Y: eccKey.Y.Bytes()}
+
+	rsaCert, err := ca.IssueEKCertificate(rsaEK)
+	if err != nil {
+		t.Fatalf("IssueEKCertificate failed: %v", err)
+	}
+	eccCert, err := ca.IssueEKCertificate(eccEK)
+	if err != nil {
+		t.Fatalf("IssueEKCertificate failed: %v", err)
+	}
+	untrustedCert, err := otherCA.IssueEKCertificate(rsaEK)
+	if err != nil {
+		t.Fatalf("IssueEKCertificate failed: %v", err)
+	}
+
+	for _, data := range []struct {
+		desc string
+		cert []byte
+		ek   *Public
+		err  string
+	}{
+		{desc: "RSA", cert: rsaCert, ek: rsaEK},
+		{desc: "ECC", cert: eccCert, ek: eccEK},
+		{desc: "WrongKey", cert: rsaCert, ek: eccEK, err: "certificate does not match EK"},
+		{desc: "Untrusted", cert: untrustedCert, ek: rsaEK, err: "cannot verify certificate: x509: certificate signed by unknown authority"},
+		{desc: "Invalid", cert: []byte{0x30, 0x00}, ek: rsaEK, err: "cannot parse certificate"},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			err := VerifyEKCertificate(data.cert, data.ek, x509.VerifyOptions{Roots: roots})
+			switch {
+			case data.err == "" && err != nil:
+				t.Errorf("VerifyEKCertificate failed: %v", err)
+			case data.err != "" && (err == nil || !bytes.HasPrefix([]byte(err.Error()), []byte(data.err))):
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestSetDefaultAuthSession(t *testing.T) {
+	tcti := testutil.NewMockTCTI(
+		&testutil.MockCommand{CommandCode: CommandPCRReset, Response: &testutil.MockResponse{ResponseCode: ResponseCode(0x98e)}},
+		&testutil.MockCommand{CommandCode: CommandPCRReset, Response: &testutil.MockResponse{PasswordSessions: 1}})
+	tpm, _ := NewTPMContext(tcti)
+	tpm.SetMaxSubmissions(1)
+
+	session := MakeMockSessionContext(0x02000000, &SessionContextData{
+		HashAlg:     HashAlgorithmSHA256,
+		SessionType: SessionTypeHMAC,
+		NonceCaller: make(Nonce, 32),
+		NonceTPM:    make(Nonce, 32)}).WithAttrs(AttrContinueSession)
+	tpm.SetDefaultAuthSession(session)
+
+	if err := tpm.PCRReset(tpm.PCRHandleContext(7), nil); !IsTPMSessionError(err, ErrorAuthFail, CommandPCRReset, 1) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tpm.SetDefaultAuthSession(nil)
+	if err := tpm.PCRReset(tpm.PCRHandleContext(7), nil); err != nil {
+		t.Fatalf("PCRReset failed: %v", err)
+	}
+
+	// The authorization area follows the header, the PCR handle and the authorization size.
+	for i, expected := range []Handle{0x02000000, HandlePW} {
+		var handle Handle
+		if _, err := mu.UnmarshalFromBytes(tcti.Commands()[i][10+4+4:], &handle); err != nil {
+			t.Fatalf("Cannot unmarshal session handle: %v", err)
+		}
+		if handle != expected {
+			t.Errorf("Unexpected session handle for command %d: 0x%08x", i, handle)
+		}
+	}
+}
+
+type secureChannelSuite struct {
+	testutil.TPMSimulatorTest
+}
+
+var _ = Suite(&secureChannelSuite{})
+
+func (s *secureChannelSuite) TestOpenSecureChannel(c *C) {
+	ca, err := testutil.NewTestCA()
+	c.Assert(err, IsNil)
+	c.Assert(testutil.InjectEKCertificates(s.TPM, ca), IsNil)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+
+	for _, template := range []*Public{nil, testutil.MakeECCEKTemplate()} {
+		channel, err := s.TPM.OpenSecureChannel(&SecureChannelOptions{
+			EKTemplate:    template,
+			VerifyOptions: x509.VerifyOptions{Roots: roots}})
+		c.Assert(err, IsNil)
+
+		session := channel.Session()
+		c.Check(session.Handle().Type(), Equals, HandleTypeHMACSession)
+
+		random, err := s.TPM.GetRandom(32, session)
+		c.Check(err, IsNil)
+		c.Check(random, HasLen, 32)
+
+		c.Check(channel.Close(), IsNil)
+	}
+}
+
+func (s *secureChannelSuite) TestOpenSecureChannelIsDefaultAuthSession(c *C) {
+	ca, err := testutil.NewTestCA()
+	c.Assert(err, IsNil)
+	c.Assert(testutil.InjectEKCertificates(s.TPM, ca), IsNil)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+
+	channel, err := s.TPM.OpenSecureChannel(&SecureChannelOptions{VerifyOptions: x509.VerifyOptions{Roots: roots}})
+	c.Assert(err, IsNil)
+
+	s.TPM.SetRejectPasswordAuthorizations(true)
+	defer s.TPM.SetRejectPasswordAuthorizations(false)
+
+	// The channel session replaces the password authorization for the owner hierarchy.
+	c.Check(s.TPM.HierarchyChangeAuth(s.TPM.OwnerHandleContext(), nil, nil), IsNil)
+
+	c.Check(channel.Close(), IsNil)
+
+	err = s.TPM.HierarchyChangeAuth(s.TPM.OwnerHandleContext(), nil, nil)
+	var e *PasswordAuthorizationError
+	c.Check(xerrors.As(err, &e), Equals, true)
+}
+
+func (s *secureChannelSuite) TestOpenSecureChannelUntrusted(c *C) {
+	ca, err := testutil.NewTestCA()
+	c.Assert(err, IsNil)
+	c.Assert(testutil.InjectEKCertificates(s.TPM, ca), IsNil)
+
+	_, err = s.TPM.OpenSecureChannel(&SecureChannelOptions{VerifyOptions: x509.VerifyOptions{Roots: x509.NewCertPool()}})
+	c.Check(err, ErrorMatches, "cannot verify EK certificate: cannot verify certificate: .*")
+}
@@ -0,0 +1,735 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/canonical/go-tpm2/mu"
+
+	"golang.org/x/xerrors"
+)
+
+// SharedTCTI allows a single TCTI to be shared safely between multiple TPMContext instances, for example one per tenant in a
+// service that uses the TPM on behalf of several clients. TPMContext instances created with SharedTCTI.NewTPMContext can be used
+// from different goroutines, although each individual TPMContext must still only be used from one goroutine at a time.
+//
+// Commands from each TPMContext are serialized, so that a command and its response are never interleaved with those of another
+// TPMContext. Transient objects and sessions are isolated: a TPMContext can only use transient objects and sessions that were
+// returned to it by the TPM, and any command that references a transient object or session owned by a different TPMContext,
+// including the handle parameter of TPM2_FlushContext, is rejected with a TPM_RC_HANDLE error without being sent to the TPM.
+// TPM2_GetCapability with CapabilityHandles only returns the transient objects and sessions owned by the calling TPMContext, and
+// cannot be used with sessions because the response is constructed by SharedTCTI.
+//
+// Transient object handles are virtualized. Each transient object is assigned a handle by SharedTCTI when it is created or loaded,
+// which is translated to the handle assigned by the TPM whenever it is used. If the TPM runs out of object slots, SharedTCTI
+// saves and flushes the objects that aren't used by the current command with TPM2_ContextSave and TPM2_FlushContext, and restores
+// them with TPM2_ContextLoad when they are next used, so that each TPMContext is not limited by the objects loaded by the others.
+// Session handles are not translated, as the handle of a session is also its name, but sessions are saved and restored in the same
+// way when the TPM runs out of session slots. When a TPMContext is closed, the transient objects and sessions that it owns are
+// flushed from the TPM.
+//
+// In order to locate the handles in each command, SharedTCTI queries the command attributes from the TPM with TPM2_GetCapability
+// before the first command is submitted.
+type SharedTCTI struct {
+	mu         sync.Mutex
+	tcti       TCTI
+	locality   uint8
+	cmdAttrs   map[CommandCode]CommandAttributes
+	objects    map[Handle]*sharedObject  // keyed by virtual handle
+	sessions   map[Handle]*sharedSession // keyed by session handle
+	nextHandle Handle
+	closed     bool
+}
+
+// sharedObject tracks a transient object owned by a client of SharedTCTI.
+type sharedObject struct {
+	client  *sharedTCTIClient
+	handle  Handle // The handle assigned by the TPM, or HandleUnassigned if the object has been swapped out
+	context []byte // The marshalled TPMS_CONTEXT if the object has been swapped out
+}
+
+// sharedSession tracks a session owned by a client of SharedTCTI.
+type sharedSession struct {
+	client  *sharedTCTIClient
+	context []byte // The marshalled TPMS_CONTEXT if the session has been swapped out
+}
+
+const (
+	firstVirtualHandle Handle = Handle(HandleTypeTransient) << 24
+
+	rcObjectMemory  = fmt0VersionMask | fmt0SeverityMask | ResponseCode(WarningObjectMemory)
+	rcSessionMemory = fmt0VersionMask | fmt0SeverityMask | ResponseCode(WarningSessionMemory)
+	rcAuthContext   = fmt0VersionMask | ResponseCode(ErrorAuthContext)
+	rcHandle        = formatMask | ResponseCode(ErrorHandle-errorCode1Start)
+)
+
+// NewSharedTCTI returns a new SharedTCTI for the supplied transmission interface.
+func NewSharedTCTI(tcti TCTI) *SharedTCTI {
+	return &SharedTCTI{
+		tcti:       tcti,
+		objects:    make(map[Handle]*sharedObject),
+		sessions:   make(map[Handle]*sharedSession),
+		nextHandle: firstVirtualHandle}
+}
+
+// NewTPMContext returns a new TPMContext that submits commands via this SharedTCTI. Calling Close on the returned TPMContext flushes
+// the transient objects and sessions that it owns, but doesn't close the underlying transmission interface.
+func (s *SharedTCTI) NewTPMContext() *TPMContext {
+	return newTpmContext(&sharedTCTIClient{shared: s})
+}
+
+// Close closes the underlying transmission interface. TPMContext instances created from this SharedTCTI can no longer be used.
+func (s *SharedTCTI) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return s.tcti.Close()
+}
+
+// transact submits a complete command packet to the TPM and returns the complete response packet.
+func (s *SharedTCTI) transact(cmd []byte) ([]byte, error) {
+	if _, err := s.tcti.Write(cmd); err != nil {
+		return nil, err
+	}
+
+	var header responseHeader
+	rsp := make([]byte, binary.Size(header))
+	if _, err := io.ReadFull(s.tcti, rsp); err != nil {
+		return nil, xerrors.Errorf("cannot read response header: %w", err)
+	}
+	if _, err := mu.UnmarshalFromBytes(rsp, &header); err != nil {
+		return nil, xerrors.Errorf("cannot unmarshal response header: %w", err)
+	}
+	if int(header.ResponseSize) < len(rsp) {
+		return nil, fmt.Errorf("invalid responseSize value (%d)", header.ResponseSize)
+	}
+
+	// Don't trust the TPM's responseSize for allocating a buffer - read the payload in to a buffer that grows as bytes are
+	// received instead.
+	buf := bytes.NewBuffer(rsp)
+	if n, err := io.CopyN(buf, s.tcti, int64(header.ResponseSize)-int64(len(rsp))); err != nil {
+		if err == io.EOF && n > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, xerrors.Errorf("cannot read response payload: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// makeSharedCommand returns a command packet without sessions for a command executed on behalf of SharedTCTI.
+func makeSharedCommand(commandCode CommandCode, params ...interface{}) []byte {
+	payload, err := mu.MarshalToBytes(params...)
+	if err != nil {
+		panic(fmt.Sprintf("cannot marshal command parameters: %v", err))
+	}
+	cmd, err := mu.MarshalToBytes(commandHeader{TagNoSessions, uint32(binary.Size(commandHeader{}) + len(payload)), commandCode},
+		mu.RawBytes(payload))
+	if err != nil {
+		panic(fmt.Sprintf("cannot marshal command: %v", err))
+	}
+	return cmd
+}
+
+// run executes a command without sessions on behalf of SharedTCTI, and returns the response code and the response payload.
+func (s *SharedTCTI) run(commandCode CommandCode, params ...interface{}) (ResponseCode, []byte, error) {
+	rsp, err := s.transact(makeSharedCommand(commandCode, params...))
+	if err != nil {
+		return 0, nil, err
+	}
+	return responseCodeFromPacket(rsp), rsp[binary.Size(responseHeader{}):], nil
+}
+
+func (s *SharedTCTI) loadCommandAttrs() error {
+	attrs := make(map[CommandCode]CommandAttributes)
+	next := uint32(CommandFirst)
+	for {
+		rc, payload, err := s.run(CommandGetCapability, CapabilityCommands, next, CapabilityMaxProperties)
+		if err != nil {
+			return err
+		}
+		if rc != Success {
+			return xerrors.Errorf("cannot obtain command attributes: %w", DecodeResponseCode(CommandGetCapability, rc))
+		}
+
+		var moreData bool
+		var data CapabilityData
+		if _, err := mu.UnmarshalFromBytes(payload, &moreData, &data); err != nil {
+			return xerrors.Errorf("cannot unmarshal command attributes: %w", err)
+		}
+		if data.Capability != CapabilityCommands {
+			return errors.New("TPM responded with data for the wrong capability")
+		}
+
+		for _, a := range data.Data.Command {
+			attrs[a.CommandCode()] = a
+		}
+		if !moreData || len(data.Data.Command) == 0 {
+			break
+		}
+		next = uint32(data.Data.Command[len(data.Data.Command)-1].CommandCode()) + 1
+	}
+
+	s.cmdAttrs = attrs
+	return nil
+}
+
+// responseCodeFromPacket returns the response code from a response packet that has already been validated by
+// SharedTCTI.transact.
+func responseCodeFromPacket(rsp []byte) ResponseCode {
+	return ResponseCode(binary.BigEndian.Uint32(rsp[6:]))
+}
+
+// makeSharedResponse returns a response packet with no payload and the specified response code.
+func makeSharedResponse(rc ResponseCode) []byte {
+	rsp, err := mu.MarshalToBytes(responseHeader{TagNoSessions, uint32(binary.Size(responseHeader{})), rc})
+	if err != nil {
+		panic(fmt.Sprintf("cannot marshal response: %v", err))
+	}
+	return rsp
+}
+
+func isSessionHandle(handle Handle) bool {
+	switch handle.Type() {
+	case HandleTypeHMACSession, HandleTypePolicySession:
+		return true
+	default:
+		return false
+	}
+}
+
+// sharedCommand describes the location of the handles in a command submitted to SharedTCTI.
+type sharedCommand struct {
+	header   commandHeader
+	handles  []int         // offsets of the command handles
+	sessions []authCommand // the command authorizations
+	params   int           // offset of the parameter area
+}
+
+func parseSharedCommand(cmd []byte, numHandles int) (*sharedCommand, error) {
+	c := new(sharedCommand)
+	if _, err := mu.UnmarshalFromBytes(cmd, &c.header); err != nil {
+		return nil, xerrors.Errorf("cannot unmarshal command header: %w", err)
+	}
+	if int(c.header.CommandSize) != len(cmd) {
+		return nil, fmt.Errorf("invalid commandSize value (%d)", c.header.CommandSize)
+	}
+
+	off := binary.Size(c.header)
+	if len(cmd) < off+(4*numHandles) {
+		return nil, errors.New("command packet is too short for handle area")
+	}
+	for i := 0; i < numHandles; i++ {
+		c.handles = append(c.handles, off)
+		off += 4
+	}
+
+	if c.header.Tag == TagSessions {
+		if len(cmd) < off+4 {
+			return nil, errors.New("command packet is too short for auth area size")
+		}
+		authSize := int(binary.BigEndian.Uint32(cmd[off:]))
+		off += 4
+		if len(cmd) < off+authSize {
+			return nil, errors.New("command packet is too short for auth area")
+		}
+		r := bytes.NewReader(cmd[off : off+authSize])
+		for i := 1; r.Len() > 0; i++ {
+			var auth authCommand
+			if _, err := mu.UnmarshalFromReader(r, &auth); err != nil {
+				return nil, xerrors.Errorf("cannot unmarshal authorization %d: %w", i, err)
+			}
+			c.sessions = append(c.sessions, auth)
+		}
+		off += authSize
+	}
+
+	c.params = off
+	return c, nil
+}
+
+func handleAt(cmd []byte, off int) Handle {
+	return Handle(binary.BigEndian.Uint32(cmd[off:]))
+}
+
+// newVirtualHandle returns an unused handle to assign to a transient object.
+func (s *SharedTCTI) newVirtualHandle() Handle {
+	for {
+		handle := s.nextHandle
+		s.nextHandle++
+		if s.nextHandle.Type() != HandleTypeTransient {
+			s.nextHandle = firstVirtualHandle
+		}
+		if _, exists := s.objects[handle]; !exists {
+			return handle
+		}
+	}
+}
+
+// forget stops tracking the transient object or session with the specified handle.
+func (s *SharedTCTI) forget(handle Handle) {
+	delete(s.objects, handle)
+	delete(s.sessions, handle)
+}
+
+// evict swaps out the transient objects or sessions that aren't referenced by the current command if rc indicates that the TPM
+// has run out of object or session slots. It returns true if anything was swapped out.
+func (s *SharedTCTI) evict(rc ResponseCode, pinned map[Handle]bool) (bool, error) {
+	evicted := false
+
+	switch rc {
+	case rcObjectMemory:
+		for handle, o := range s.objects {
+			if pinned[handle] || o.context != nil {
+				continue
+			}
+			rc, context, err := s.run(CommandContextSave, o.handle)
+			if err != nil {
+				return false, err
+			}
+			if rc != Success {
+				// The object is no longer loaded, eg, because its hierarchy was cleared.
+				delete(s.objects, handle)
+				continue
+			}
+			if _, _, err := s.run(CommandFlushContext, o.handle); err != nil {
+				return false, err
+			}
+			o.handle = HandleUnassigned
+			o.context = context
+			evicted = true
+		}
+	case rcSessionMemory:
+		for handle, session := range s.sessions {
+			if pinned[handle] || session.context != nil {
+				continue
+			}
+			rc, context, err := s.run(CommandContextSave, handle)
+			if err != nil {
+				return false, err
+			}
+			if rc != Success {
+				// The session isn't loaded, eg, because it has been saved by its owner.
+				continue
+			}
+			session.context = context
+			evicted = true
+		}
+	}
+
+	return evicted, nil
+}
+
+// transactWithEviction submits a command packet to the TPM. If the TPM has run out of object or session slots, the transient
+// objects or sessions that aren't referenced by the command are swapped out and the command is submitted again.
+func (s *SharedTCTI) transactWithEviction(cmd []byte, pinned map[Handle]bool) ([]byte, error) {
+	for {
+		rsp, err := s.transact(cmd)
+		if err != nil {
+			return nil, err
+		}
+		evicted, err := s.evict(responseCodeFromPacket(rsp), pinned)
+		if err != nil {
+			return nil, xerrors.Errorf("cannot swap out contexts: %w", err)
+		}
+		if !evicted {
+			return rsp, nil
+		}
+	}
+}
+
+// swapIn restores the transient object or session with the specified handle if it was swapped out by SharedTCTI.
+func (s *SharedTCTI) swapIn(handle Handle, pinned map[Handle]bool) error {
+	var context []byte
+	o, isObject := s.objects[handle]
+	session, isSession := s.sessions[handle]
+	switch {
+	case isObject:
+		context = o.context
+	case isSession:
+		context = session.context
+	}
+	if context == nil {
+		return nil
+	}
+
+	rsp, err := s.transactWithEviction(makeSharedCommand(CommandContextLoad, mu.RawBytes(context)), pinned)
+	if err != nil {
+		return err
+	}
+	if rc := responseCodeFromPacket(rsp); rc != Success {
+		// The context can no longer be restored, eg, because the TPM has been reset.
+		s.forget(handle)
+		return DecodeResponseCode(CommandContextLoad, rc)
+	}
+
+	var loaded Handle
+	if _, err := mu.UnmarshalFromBytes(rsp[binary.Size(responseHeader{}):], &loaded); err != nil {
+		return &InvalidResponseError{Command: CommandContextLoad, msg: fmt.Sprintf("cannot unmarshal response handle: %v", err)}
+	}
+
+	if isObject {
+		o.handle = loaded
+		o.context = nil
+	} else {
+		session.context = nil
+	}
+	return nil
+}
+
+// getCapabilityHandles executes TPM2_GetCapability for transient object or session handles on behalf of client, returning only
+// the handles that it owns. It returns a nil response for any other TPM2_GetCapability command.
+func (s *SharedTCTI) getCapabilityHandles(client *sharedTCTIClient, c *sharedCommand, cmd []byte) ([]byte, error) {
+	var capability Capability
+	var property, propertyCount uint32
+	if _, err := mu.UnmarshalFromBytes(cmd[c.params:], &capability, &property, &propertyCount); err != nil {
+		return nil, xerrors.Errorf("cannot unmarshal command parameters: %w", err)
+	}
+	first := Handle(property)
+	if capability != CapabilityHandles || (first.Type() != HandleTypeTransient && !isSessionHandle(first)) {
+		return nil, nil
+	}
+	if len(c.sessions) > 0 {
+		// The response is constructed here, so it can't be authorized by the TPM.
+		return makeSharedResponse(rcAuthContext), nil
+	}
+
+	var handles HandleList
+	moreData := false
+
+	if first.Type() == HandleTypeTransient {
+		for handle, o := range s.objects {
+			if o.client == client && handle >= first {
+				handles = append(handles, handle)
+			}
+		}
+		sort.Slice(handles, func(i, j int) bool { return handles[i] < handles[j] })
+		if len(handles) > int(propertyCount) {
+			handles = handles[:propertyCount]
+			moreData = true
+		}
+	} else {
+		for {
+			rc, payload, err := s.run(CommandGetCapability, capability, uint32(first), propertyCount)
+			if err != nil {
+				return nil, err
+			}
+			if rc != Success {
+				return makeSharedResponse(rc), nil
+			}
+
+			var data CapabilityData
+			if _, err := mu.UnmarshalFromBytes(payload, &moreData, &data); err != nil {
+				return nil, &InvalidResponseError{Command: CommandGetCapability, msg: fmt.Sprintf("cannot unmarshal response parameters: %v", err)}
+			}
+			if data.Capability != CapabilityHandles {
+				return nil, &InvalidResponseError{Command: CommandGetCapability, msg: "TPM responded with data for the wrong capability"}
+			}
+
+			for _, handle := range data.Data.Handles {
+				if session, ok := s.sessions[handle]; ok && session.client == client {
+					handles = append(handles, handle)
+				}
+			}
+			if len(data.Data.Handles) == 0 {
+				moreData = false
+			}
+			if len(handles) > 0 || !moreData {
+				break
+			}
+			// None of the handles in this batch are owned by client, so keep going.
+			first = data.Data.Handles[len(data.Data.Handles)-1] + 1
+		}
+	}
+
+	payload, err := mu.MarshalToBytes(moreData, &CapabilityData{Capability: CapabilityHandles, Data: &CapabilitiesU{Handles: handles}})
+	if err != nil {
+		panic(fmt.Sprintf("cannot marshal response parameters: %v", err))
+	}
+	rsp, err := mu.MarshalToBytes(responseHeader{TagNoSessions, uint32(binary.Size(responseHeader{}) + len(payload)), Success},
+		mu.RawBytes(payload))
+	if err != nil {
+		panic(fmt.Sprintf("cannot marshal response: %v", err))
+	}
+	return rsp, nil
+}
+
+func (s *SharedTCTI) submit(client *sharedTCTIClient, cmd []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.submitLocked(client, cmd)
+}
+
+// submitLocked submits a command on behalf of client. The caller must hold the lock.
+func (s *SharedTCTI) submitLocked(client *sharedTCTIClient, cmd []byte) ([]byte, error) {
+	if s.closed {
+		return nil, errors.New("shared TCTI is closed")
+	}
+
+	var header commandHeader
+	if _, err := mu.UnmarshalFromBytes(cmd, &header); err != nil {
+		return nil, xerrors.Errorf("cannot unmarshal command header: %w", err)
+	}
+
+	if s.cmdAttrs == nil {
+		if err := s.loadCommandAttrs(); err != nil {
+			return nil, xerrors.Errorf("cannot load command attributes: %w", err)
+		}
+	}
+
+	if err := s.setLocality(client); err != nil {
+		return nil, err
+	}
+
+	attrs, knownCommand := s.cmdAttrs[header.CommandCode]
+	if !knownCommand {
+		// The TPM doesn't implement this command and will reject it.
+		return s.transact(cmd)
+	}
+
+	c, err := parseSharedCommand(cmd, attrs.NumberOfCommandHandles())
+	if err != nil {
+		return nil, err
+	}
+
+	// Check that every transient object and session referenced by the command is owned by client. These are pinned so that
+	// they aren't swapped out whilst the command is executed.
+	pinned := make(map[Handle]bool)
+	var objects []int // offsets of the transient object handles to translate
+	owned := func(handle Handle) bool {
+		switch {
+		case handle.Type() == HandleTypeTransient:
+			if o, ok := s.objects[handle]; !ok || o.client != client {
+				return false
+			}
+		case isSessionHandle(handle):
+			if session, ok := s.sessions[handle]; !ok || session.client != client {
+				return false
+			}
+		default:
+			return true
+		}
+		pinned[handle] = true
+		return true
+	}
+
+	for i, off := range c.handles {
+		handle := handleAt(cmd, off)
+		if !owned(handle) {
+			return makeSharedResponse(rcHandle | ResponseCode(i+1)<<fmt1IndexShift), nil
+		}
+		if handle.Type() == HandleTypeTransient {
+			objects = append(objects, off)
+		}
+	}
+	for i, auth := range c.sessions {
+		if !owned(auth.SessionHandle) {
+			return makeSharedResponse(rcHandle | fmt1SessionMask | ResponseCode(i+1)<<fmt1IndexShift), nil
+		}
+	}
+
+	switch c.header.CommandCode {
+	case CommandFlushContext:
+		// The handle to flush is a parameter rather than a command handle.
+		if len(cmd) < c.params+4 {
+			return nil, errors.New("command packet is too short for flushHandle parameter")
+		}
+		handle := handleAt(cmd, c.params)
+		if !owned(handle) {
+			return makeSharedResponse(rcHandle | fmt1ParameterMask | 1<<fmt1IndexShift), nil
+		}
+		if o, ok := s.objects[handle]; ok && o.context != nil {
+			// The object has been swapped out, so there's nothing to flush from the TPM.
+			s.forget(handle)
+			return makeSharedResponse(Success), nil
+		}
+		if handle.Type() == HandleTypeTransient {
+			objects = append(objects, c.params)
+		}
+	case CommandContextLoad:
+		// Don't permit a client to load a saved session that is owned by another client.
+		var sequence uint64
+		var savedHandle Handle
+		if _, err := mu.UnmarshalFromBytes(cmd[c.params:], &sequence, &savedHandle); err == nil {
+			if session, ok := s.sessions[savedHandle]; ok && session.client != client {
+				return makeSharedResponse(rcHandle | fmt1ParameterMask | 1<<fmt1IndexShift), nil
+			}
+		}
+	case CommandGetCapability:
+		rsp, err := s.getCapabilityHandles(client, c, cmd)
+		if err != nil || rsp != nil {
+			return rsp, err
+		}
+	}
+
+	for handle := range pinned {
+		if err := s.swapIn(handle, pinned); err != nil {
+			return nil, xerrors.Errorf("cannot restore context for handle 0x%08x: %w", handle, err)
+		}
+	}
+
+	// Translate the virtual handles in a copy of the command, so that the original can still be used to identify them.
+	translated := make([]byte, len(cmd))
+	copy(translated, cmd)
+	for _, off := range objects {
+		binary.BigEndian.PutUint32(translated[off:], uint32(s.objects[handleAt(cmd, off)].handle))
+	}
+
+	rsp, err := s.transactWithEviction(translated, pinned)
+	if err != nil {
+		return nil, err
+	}
+	if responseCodeFromPacket(rsp) != Success {
+		return rsp, nil
+	}
+
+	off := binary.Size(responseHeader{})
+	if attrs&AttrRHandle != 0 && len(rsp) >= off+4 {
+		handle := handleAt(rsp, off)
+		switch {
+		case handle.Type() == HandleTypeTransient:
+			virtual := s.newVirtualHandle()
+			s.objects[virtual] = &sharedObject{client: client, handle: handle}
+			binary.BigEndian.PutUint32(rsp[off:], uint32(virtual))
+		case isSessionHandle(handle):
+			s.sessions[handle] = &sharedSession{client: client}
+		}
+	}
+
+	switch c.header.CommandCode {
+	case CommandFlushContext:
+		s.forget(handleAt(cmd, c.params))
+	case CommandSequenceComplete:
+		s.forget(handleAt(cmd, c.handles[0]))
+	case CommandEventSequenceComplete:
+		s.forget(handleAt(cmd, c.handles[1]))
+	case CommandStartup:
+		// Loaded transient objects and sessions don't survive a TPM reset, restart or resume.
+		for handle, o := range s.objects {
+			if o.context == nil {
+				delete(s.objects, handle)
+			}
+		}
+		for handle, session := range s.sessions {
+			if session.context == nil {
+				delete(s.sessions, handle)
+			}
+		}
+	}
+
+	// The TPM flushes sessions that are used without the continueSession attribute.
+	for _, auth := range c.sessions {
+		if isSessionHandle(auth.SessionHandle) && auth.SessionAttrs&attrContinueSession == 0 {
+			s.forget(auth.SessionHandle)
+		}
+	}
+
+	return rsp, nil
+}
+
+func (s *SharedTCTI) setLocality(client *sharedTCTIClient) error {
+	if client.locality == s.locality {
+		return nil
+	}
+	if err := s.tcti.SetLocality(client.locality); err != nil {
+		return xerrors.Errorf("cannot set locality: %w", err)
+	}
+	s.locality = client.locality
+	return nil
+}
+
+// flush flushes all of the transient objects and sessions owned by client.
+func (s *SharedTCTI) flush(client *sharedTCTIClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for handle, o := range s.objects {
+		if o.client != client {
+			continue
+		}
+		delete(s.objects, handle)
+		if s.closed || o.context != nil {
+			continue
+		}
+		s.run(CommandFlushContext, o.handle)
+	}
+	for handle, session := range s.sessions {
+		if session.client != client {
+			continue
+		}
+		delete(s.sessions, handle)
+		if s.closed {
+			continue
+		}
+		// This also flushes sessions that have been swapped out.
+		s.run(CommandFlushContext, handle)
+	}
+}
+
+// sharedTCTIClient is the TCTI used by each TPMContext created from a SharedTCTI.
+type sharedTCTIClient struct {
+	shared    *SharedTCTI
+	locality  uint8
+	rsp       *bytes.Reader
+	exclusive bool // this client holds the lock for a sequence of commands
+}
+
+func (c *sharedTCTIClient) Read(data []byte) (int, error) {
+	if c.rsp == nil {
+		return 0, io.EOF
+	}
+	return c.rsp.Read(data)
+}
+
+func (c *sharedTCTIClient) Write(data []byte) (int, error) {
+	c.rsp = nil
+	var rsp []byte
+	var err error
+	if c.exclusive {
+		rsp, err = c.shared.submitLocked(c, data)
+	} else {
+		rsp, err = c.shared.submit(c, data)
+	}
+	if err != nil {
+		return 0, err
+	}
+	c.rsp = bytes.NewReader(rsp)
+	return len(data), nil
+}
+
+func (c *sharedTCTIClient) Close() error {
+	c.shared.flush(c)
+	return nil
+}
+
+func (c *sharedTCTIClient) SetLocality(locality uint8) error {
+	c.locality = locality
+	return nil
+}
+
+func (c *sharedTCTIClient) MakeSticky(handle Handle, sticky bool) error {
+	c.shared.mu.Lock()
+	defer c.shared.mu.Unlock()
+	if o, ok := c.shared.objects[handle]; ok && o.client == c && o.context == nil {
+		handle = o.handle
+	}
+	return c.shared.tcti.MakeSticky(handle, sticky)
+}
+
+func (c *sharedTCTIClient) lockExclusive() {
+	c.shared.mu.Lock()
+	c.exclusive = true
+}
+
+func (c *sharedTCTIClient) unlockExclusive() {
+	c.exclusive = false
+	c.shared.mu.Unlock()
+}
@@ -0,0 +1,179 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	. "github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+func sharedCommandAttrs() *testutil.MockCommand {
+	return &testutil.MockCommand{CommandCode: CommandGetCapability, Response: &testutil.MockResponse{Params: []interface{}{false,
+		&CapabilityData{Capability: CapabilityCommands, Data: &CapabilitiesU{Command: CommandAttributesList{
+			makeCommandAttributes(CommandCreatePrimary, AttrRHandle, 1),
+			makeCommandAttributes(CommandGetCapability, 0, 0),
+			makeCommandAttributes(CommandContextLoad, AttrRHandle, 0),
+			makeCommandAttributes(CommandContextSave, 0, 1),
+			makeCommandAttributes(CommandFlushContext, 0, 0),
+			makeCommandAttributes(CommandGetRandom, 0, 0),
+			makeCommandAttributes(CommandReadClock, 0, 0),
+			makeCommandAttributes(CommandReadPublic, 0, 1)}}}}}}
+}
+
+func expectParams(expected ...interface{}) func([]byte) error {
+	return func(params []byte) error {
+		b, err := mu.MarshalToBytes(expected...)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(params, b) {
+			return fmt.Errorf("got %x, expected %x", params, b)
+		}
+		return nil
+	}
+}
+
+func handleBytes(handle Handle) []byte {
+	return []byte{byte(handle >> 24), byte(handle >> 16), byte(handle >> 8), byte(handle)}
+}
+
+func sharedCreatePrimary(t *testing.T, tpm *TPMContext) Handle {
+	var handle Handle
+	if err := tpm.RunCommand(CommandCreatePrimary, nil, tpm.OwnerHandleContext(), Delimiter, Delimiter, &handle); err != nil {
+		t.Fatalf("RunCommand failed: %v", err)
+	}
+	return handle
+}
+
+func sharedReadPublic(t *testing.T, tpm *TPMContext, handle Handle) ResponseCode {
+	rc, _, _, err := tpm.RunCommandBytes(TagNoSessions, CommandReadPublic, handleBytes(handle))
+	if err != nil {
+		t.Fatalf("RunCommandBytes failed: %v", err)
+	}
+	return rc
+}
+
+func sharedGetTransientHandles(t *testing.T, tpm *TPMContext) HandleList {
+	handles, err := tpm.GetCapabilityHandles(Handle(HandleTypeTransient)<<24, CapabilityMaxProperties)
+	if err != nil {
+		t.Fatalf("GetCapabilityHandles failed: %v", err)
+	}
+	return handles
+}
+
+func TestSharedTCTI(t *testing.T) {
+	tcti := testutil.NewMockTCTI(
+		sharedCommandAttrs(),
+		&testutil.MockCommand{CommandCode: CommandCreatePrimary, Response: &testutil.MockResponse{Handle: 0x80000005}},
+		&testutil.MockCommand{CommandCode: CommandReadPublic, Handles: []Handle{0x80000005}, Response: &testutil.MockResponse{}},
+		&testutil.MockCommand{CommandCode: CommandFlushContext, Params: expectParams(Handle(0x80000005)), Response: &testutil.MockResponse{}})
+	shared := NewSharedTCTI(tcti)
+	tpmA := shared.NewTPMContext()
+	tpmB := shared.NewTPMContext()
+
+	// The handle returned to tpmA is virtualized.
+	handle := sharedCreatePrimary(t, tpmA)
+	if handle != 0x80000000 {
+		t.Errorf("Unexpected handle: 0x%08x", handle)
+	}
+
+	// tpmB doesn't own the object, so these commands shouldn't reach the TPM.
+	rc := sharedReadPublic(t, tpmB, handle)
+	if !IsTPMHandleError(DecodeResponseCode(CommandReadPublic, rc), ErrorHandle, CommandReadPublic, 1) {
+		t.Errorf("Unexpected response code: 0x%08x", rc)
+	}
+	rc, _, _, err := tpmB.RunCommandBytes(TagNoSessions, CommandFlushContext, handleBytes(handle))
+	if err != nil {
+		t.Fatalf("RunCommandBytes failed: %v", err)
+	}
+	if !IsTPMParameterError(DecodeResponseCode(CommandFlushContext, rc), ErrorHandle, CommandFlushContext, 1) {
+		t.Errorf("Unexpected response code: 0x%08x", rc)
+	}
+
+	// The virtual handle is translated for tpmA.
+	if rc := sharedReadPublic(t, tpmA, handle); rc != Success {
+		t.Errorf("Unexpected response code: 0x%08x", rc)
+	}
+
+	// Each TPMContext only sees its own transient objects.
+	if handles := sharedGetTransientHandles(t, tpmA); len(handles) != 1 || handles[0] != handle {
+		t.Errorf("Unexpected handles for tpmA: %v", handles)
+	}
+	if handles := sharedGetTransientHandles(t, tpmB); len(handles) != 0 {
+		t.Errorf("Unexpected handles for tpmB: %v", handles)
+	}
+
+	if err := tpmA.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+}
+
+func TestSharedTCTITruncatedResponse(t *testing.T) {
+	// The response claims to be 4GB, which shouldn't be allocated up front.
+	tcti := testutil.NewMockTCTI(
+		sharedCommandAttrs(),
+		&testutil.MockCommand{CommandCode: CommandGetRandom, RawResponse: []byte{0x80, 0x01, 0xff, 0xff, 0xff, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00}})
+	tpm := NewSharedTCTI(tcti).NewTPMContext()
+
+	_, _, _, err := tpm.RunCommandBytes(TagNoSessions, CommandGetRandom, []byte{0x00, 0x08})
+	if err == nil || !strings.HasSuffix(err.Error(), "cannot read response payload: unexpected EOF") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestSharedTCTIObjectMemory(t *testing.T) {
+	contextA := &Context{Sequence: 1, SavedHandle: 0x80000000, Hierarchy: HandleOwner, Blob: ContextData("A")}
+	contextB := &Context{Sequence: 2, SavedHandle: 0x80000000, Hierarchy: HandleOwner, Blob: ContextData("B")}
+	// TPM_RC_OBJECT_MEMORY
+	objectMemory := &testutil.MockResponse{ResponseCode: ResponseCode(0x902)}
+
+	tcti := testutil.NewMockTCTI(
+		sharedCommandAttrs(),
+		&testutil.MockCommand{CommandCode: CommandCreatePrimary, Response: &testutil.MockResponse{Handle: 0x80000001}},
+
+		// There is no room for the object created by tpmB, so the object owned by tpmA is swapped out.
+		&testutil.MockCommand{CommandCode: CommandCreatePrimary, Response: objectMemory},
+		&testutil.MockCommand{CommandCode: CommandContextSave, Handles: []Handle{0x80000001},
+			Response: &testutil.MockResponse{Params: []interface{}{contextA}}},
+		&testutil.MockCommand{CommandCode: CommandFlushContext, Params: expectParams(Handle(0x80000001)), Response: &testutil.MockResponse{}},
+		&testutil.MockCommand{CommandCode: CommandCreatePrimary, Response: &testutil.MockResponse{Handle: 0x80000001}},
+
+		// The object owned by tpmA is restored when it is used, which requires the object owned by tpmB to be swapped out.
+		&testutil.MockCommand{CommandCode: CommandContextLoad, Params: expectParams(contextA), Response: objectMemory},
+		&testutil.MockCommand{CommandCode: CommandContextSave, Handles: []Handle{0x80000001},
+			Response: &testutil.MockResponse{Params: []interface{}{contextB}}},
+		&testutil.MockCommand{CommandCode: CommandFlushContext, Params: expectParams(Handle(0x80000001)), Response: &testutil.MockResponse{}},
+		&testutil.MockCommand{CommandCode: CommandContextLoad, Params: expectParams(contextA), Response: &testutil.MockResponse{Handle: 0x80000001}},
+		&testutil.MockCommand{CommandCode: CommandReadPublic, Handles: []Handle{0x80000001}, Response: &testutil.MockResponse{}})
+	shared := NewSharedTCTI(tcti)
+	tpmA := shared.NewTPMContext()
+	tpmB := shared.NewTPMContext()
+
+	handleA := sharedCreatePrimary(t, tpmA)
+	handleB := sharedCreatePrimary(t, tpmB)
+	if handleA == handleB {
+		t.Errorf("Virtual handles are not unique")
+	}
+	if rc := sharedReadPublic(t, tpmA, handleA); rc != Success {
+		t.Errorf("Unexpected response code: 0x%08x", rc)
+	}
+
+	// The object owned by tpmB has been swapped out, so closing tpmB shouldn't send anything to the TPM.
+	if err := tpmB.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+}
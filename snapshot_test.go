@@ -0,0 +1,46 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	. "github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/testutil"
+
+	. "gopkg.in/check.v1"
+)
+
+type snapshotSuite struct {
+	testutil.TPMSimulatorTest
+}
+
+var _ = Suite(&snapshotSuite{})
+
+func (s *snapshotSuite) TestSnapshotAndRestore(c *C) {
+	dir := c.MkDir()
+
+	pub := NVPublic{
+		Index:   0x0181ff00,
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead),
+		Size:    8}
+	index, err := s.TPM.NVDefineSpace(s.TPM.OwnerHandleContext(), nil, &pub, nil)
+	c.Assert(err, IsNil)
+
+	s.SnapshotTPMSimulator(c, dir)
+
+	c.Check(s.TPM.NVUndefineSpace(s.TPM.OwnerHandleContext(), index, nil), IsNil)
+	_, err = s.TPM.CreateResourceContextFromTPM(pub.Index)
+	c.Check(IsResourceUnavailableError(err, pub.Index), Equals, true)
+
+	s.RestoreTPMSimulator(c, dir)
+
+	index, err = s.TPM.CreateResourceContextFromTPM(pub.Index)
+	c.Assert(err, IsNil)
+	s.AddCleanupNVSpace(c, s.TPM.OwnerHandleContext(), index)
+
+	restoredPub, _, err := s.TPM.NVReadPublic(index)
+	c.Assert(err, IsNil)
+	c.Check(restoredPub.Size, Equals, pub.Size)
+}
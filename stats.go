@@ -0,0 +1,89 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2
+
+import (
+	"sync"
+	"time"
+)
+
+// CommandStats contains the statistics recorded for a single command code.
+type CommandStats struct {
+	Count         uint64        // The number of times the command has been submitted to the TPM
+	Errors        uint64        // The number of submissions for which the TPM responded with an error or warning
+	TotalDuration time.Duration // The cumulative time taken for the TPM to respond to the command
+}
+
+// AverageDuration returns the average time taken for the TPM to respond to the command, or zero if it has not been submitted.
+func (s CommandStats) AverageDuration() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.TotalDuration / time.Duration(s.Count)
+}
+
+// Stats records per-command latency statistics for a TPMContext. Every submission of a command is counted, including automatic
+// resubmissions. Submissions that fail because the transmission interface returns an error are not counted.
+//
+// The methods of Stats are safe to call from a goroutine other than the one using the TPMContext, so that statistics can be
+// collected by a monitoring goroutine.
+type Stats struct {
+	mu       sync.Mutex
+	commands map[CommandCode]*CommandStats
+}
+
+func (s *Stats) record(commandCode CommandCode, duration time.Duration, responseCode ResponseCode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.commands == nil {
+		s.commands = make(map[CommandCode]*CommandStats)
+	}
+	cs, ok := s.commands[commandCode]
+	if !ok {
+		cs = new(CommandStats)
+		s.commands[commandCode] = cs
+	}
+	cs.Count++
+	cs.TotalDuration += duration
+	if responseCode != Success {
+		cs.Errors++
+	}
+}
+
+// Command returns the statistics for the specified command code.
+func (s *Stats) Command(commandCode CommandCode) CommandStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cs, ok := s.commands[commandCode]; ok {
+		return *cs
+	}
+	return CommandStats{}
+}
+
+// Commands returns a snapshot of the statistics for every command that has been submitted since the last call to Reset.
+func (s *Stats) Commands() map[CommandCode]CommandStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[CommandCode]CommandStats, len(s.commands))
+	for commandCode, cs := range s.commands {
+		out[commandCode] = *cs
+	}
+	return out
+}
+
+// Reset discards all of the recorded statistics.
+func (s *Stats) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands = nil
+}
+
+// Stats returns the per-command latency statistics for this TPMContext.
+func (t *TPMContext) Stats() *Stats {
+	return &t.stats
+}
@@ -7,6 +7,8 @@ package tpm2
 import (
 	"bytes"
 	"fmt"
+	"strconv"
+	"strings"
 )
 
 func makeDefaultFormatter(s fmt.State, f rune) string {
@@ -95,6 +97,10 @@ func (c CommandCode) String() string {
 		return "TPM_CC_HierarchyControl"
 	case CommandNVUndefineSpace:
 		return "TPM_CC_NV_UndefineSpace"
+	case CommandChangeEPS:
+		return "TPM_CC_ChangeEPS"
+	case CommandChangePPS:
+		return "TPM_CC_ChangePPS"
 	case CommandClear:
 		return "TPM_CC_Clear"
 	case CommandClearControl:
@@ -630,46 +636,90 @@ func (a AlgorithmId) Format(s fmt.State, f rune) {
 	}
 }
 
+func (a HashAlgorithmId) String() string {
+	return AlgorithmId(a).String()
+}
+
 func (a HashAlgorithmId) Format(s fmt.State, f rune) {
 	AlgorithmId(a).Format(s, f)
 }
 
+func (a SymAlgorithmId) String() string {
+	return AlgorithmId(a).String()
+}
+
 func (a SymAlgorithmId) Format(s fmt.State, f rune) {
 	AlgorithmId(a).Format(s, f)
 }
 
+func (a SymObjectAlgorithmId) String() string {
+	return AlgorithmId(a).String()
+}
+
 func (a SymObjectAlgorithmId) Format(s fmt.State, f rune) {
 	AlgorithmId(a).Format(s, f)
 }
 
+func (a SymModeId) String() string {
+	return AlgorithmId(a).String()
+}
+
 func (a SymModeId) Format(s fmt.State, f rune) {
 	AlgorithmId(a).Format(s, f)
 }
 
+func (a KDFAlgorithmId) String() string {
+	return AlgorithmId(a).String()
+}
+
 func (a KDFAlgorithmId) Format(s fmt.State, f rune) {
 	AlgorithmId(a).Format(s, f)
 }
 
+func (a SigSchemeId) String() string {
+	return AlgorithmId(a).String()
+}
+
 func (a SigSchemeId) Format(s fmt.State, f rune) {
 	AlgorithmId(a).Format(s, f)
 }
 
+func (a KeyedHashSchemeId) String() string {
+	return AlgorithmId(a).String()
+}
+
 func (a KeyedHashSchemeId) Format(s fmt.State, f rune) {
 	AlgorithmId(a).Format(s, f)
 }
 
+func (a AsymSchemeId) String() string {
+	return AlgorithmId(a).String()
+}
+
 func (a AsymSchemeId) Format(s fmt.State, f rune) {
 	AlgorithmId(a).Format(s, f)
 }
 
+func (a RSASchemeId) String() string {
+	return AlgorithmId(a).String()
+}
+
 func (a RSASchemeId) Format(s fmt.State, f rune) {
 	AlgorithmId(a).Format(s, f)
 }
 
+func (a ECCSchemeId) String() string {
+	return AlgorithmId(a).String()
+}
+
 func (a ECCSchemeId) Format(s fmt.State, f rune) {
 	AlgorithmId(a).Format(s, f)
 }
 
+func (a ObjectTypeId) String() string {
+	return AlgorithmId(a).String()
+}
+
 func (a ObjectTypeId) Format(s fmt.State, f rune) {
 	AlgorithmId(a).Format(s, f)
 }
@@ -710,6 +760,743 @@ func (c Capability) Format(s fmt.State, f rune) {
 	}
 }
 
+func (o ArithmeticOp) String() string {
+	switch o {
+	case OpEq:
+		return "TPM_EO_EQ"
+	case OpNeq:
+		return "TPM_EO_NEQ"
+	case OpSignedGT:
+		return "TPM_EO_SIGNED_GT"
+	case OpUnsignedGT:
+		return "TPM_EO_UNSIGNED_GT"
+	case OpSignedLT:
+		return "TPM_EO_SIGNED_LT"
+	case OpUnsignedLT:
+		return "TPM_EO_UNSIGNED_LT"
+	case OpSignedGE:
+		return "TPM_EO_SIGNED_GE"
+	case OpUnsignedGE:
+		return "TPM_EO_UNSIGNED_GE"
+	case OpSignedLE:
+		return "TPM_EO_SIGNED_LE"
+	case OpUnsignedLE:
+		return "TPM_EO_UNSIGNED_LE"
+	case OpBitset:
+		return "TPM_EO_BITSET"
+	case OpBitclear:
+		return "TPM_EO_BITCLEAR"
+	default:
+		return fmt.Sprintf("0x%04x", uint16(o))
+	}
+}
+
+func (o ArithmeticOp) Format(s fmt.State, f rune) {
+	switch f {
+	case 's', 'v':
+		fmt.Fprintf(s, "%s", o.String())
+	default:
+		fmt.Fprintf(s, makeDefaultFormatter(s, f), uint16(o))
+	}
+}
+
+func (t StructTag) String() string {
+	switch t {
+	case TagNoSessions:
+		return "TPM_ST_NO_SESSIONS"
+	case TagSessions:
+		return "TPM_ST_SESSIONS"
+	case TagAttestNV:
+		return "TPM_ST_ATTEST_NV"
+	case TagAttestCommandAudit:
+		return "TPM_ST_ATTEST_COMMAND_AUDIT"
+	case TagAttestSessionAudit:
+		return "TPM_ST_ATTEST_SESSION_AUDIT"
+	case TagAttestCertify:
+		return "TPM_ST_ATTEST_CERTIFY"
+	case TagAttestQuote:
+		return "TPM_ST_ATTEST_QUOTE"
+	case TagAttestTime:
+		return "TPM_ST_ATTEST_TIME"
+	case TagAttestCreation:
+		return "TPM_ST_ATTEST_CREATION"
+	case TagCreation:
+		return "TPM_ST_CREATION"
+	case TagVerified:
+		return "TPM_ST_VERIFIED"
+	case TagAuthSecret:
+		return "TPM_ST_AUTH_SECRET"
+	case TagHashcheck:
+		return "TPM_ST_HASHCHECK"
+	case TagAuthSigned:
+		return "TPM_ST_AUTH_SIGNED"
+	default:
+		return fmt.Sprintf("0x%04x", uint16(t))
+	}
+}
+
+func (t StructTag) Format(s fmt.State, f rune) {
+	switch f {
+	case 's', 'v':
+		fmt.Fprintf(s, "%s", t.String())
+	default:
+		fmt.Fprintf(s, makeDefaultFormatter(s, f), uint16(t))
+	}
+}
+
+func (t StartupType) String() string {
+	switch t {
+	case StartupClear:
+		return "TPM_SU_CLEAR"
+	case StartupState:
+		return "TPM_SU_STATE"
+	default:
+		return fmt.Sprintf("0x%04x", uint16(t))
+	}
+}
+
+func (t StartupType) Format(s fmt.State, f rune) {
+	switch f {
+	case 's', 'v':
+		fmt.Fprintf(s, "%s", t.String())
+	default:
+		fmt.Fprintf(s, makeDefaultFormatter(s, f), uint16(t))
+	}
+}
+
+func (t SessionType) String() string {
+	switch t {
+	case SessionTypeHMAC:
+		return "TPM_SE_HMAC"
+	case SessionTypePolicy:
+		return "TPM_SE_POLICY"
+	case SessionTypeTrial:
+		return "TPM_SE_TRIAL"
+	default:
+		return fmt.Sprintf("0x%02x", uint8(t))
+	}
+}
+
+func (t SessionType) Format(s fmt.State, f rune) {
+	switch f {
+	case 's', 'v':
+		fmt.Fprintf(s, "%s", t.String())
+	default:
+		fmt.Fprintf(s, makeDefaultFormatter(s, f), uint8(t))
+	}
+}
+
+func (p Property) String() string {
+	switch p {
+	case PropertyFamilyIndicator:
+		return "TPM_PT_FAMILY_INDICATOR"
+	case PropertyLevel:
+		return "TPM_PT_LEVEL"
+	case PropertyRevision:
+		return "TPM_PT_REVISION"
+	case PropertyDayOfYear:
+		return "TPM_PT_DAY_OF_YEAR"
+	case PropertyYear:
+		return "TPM_PT_YEAR"
+	case PropertyManufacturer:
+		return "TPM_PT_MANUFACTURER"
+	case PropertyVendorString1:
+		return "TPM_PT_VENDOR_STRING_1"
+	case PropertyVendorString2:
+		return "TPM_PT_VENDOR_STRING_2"
+	case PropertyVendorString3:
+		return "TPM_PT_VENDOR_STRING_3"
+	case PropertyVendorString4:
+		return "TPM_PT_VENDOR_STRING_4"
+	case PropertyVendorTPMType:
+		return "TPM_PT_VENDOR_TPM_TYPE"
+	case PropertyFirmwareVersion1:
+		return "TPM_PT_FIRMWARE_VERSION_1"
+	case PropertyFirmwareVersion2:
+		return "TPM_PT_FIRMWARE_VERSION_2"
+	case PropertyInputBuffer:
+		return "TPM_PT_INPUT_BUFFER"
+	case PropertyHRTransientMin:
+		return "TPM_PT_HR_TRANSIENT_MIN"
+	case PropertyHRPersistentMin:
+		return "TPM_PT_HR_PERSISTENT_MIN"
+	case PropertyHRLoadedMin:
+		return "TPM_PT_HR_LOADED_MIN"
+	case PropertyActiveSessionsMax:
+		return "TPM_PT_ACTIVE_SESSIONS_MAX"
+	case PropertyPCRCount:
+		return "TPM_PT_PCR_COUNT"
+	case PropertyPCRSelectMin:
+		return "TPM_PT_PCR_SELECT_MIN"
+	case PropertyContextGapMax:
+		return "TPM_PT_CONTEXT_GAP_MAX"
+	case PropertyNVCountersMax:
+		return "TPM_PT_NV_COUNTERS_MAX"
+	case PropertyNVIndexMax:
+		return "TPM_PT_NV_INDEX_MAX"
+	case PropertyMemory:
+		return "TPM_PT_MEMORY"
+	case PropertyClockUpdate:
+		return "TPM_PT_CLOCK_UPDATE"
+	case PropertyContextHash:
+		return "TPM_PT_CONTEXT_HASH"
+	case PropertyContextSym:
+		return "TPM_PT_CONTEXT_SYM"
+	case PropertyContextSymSize:
+		return "TPM_PT_CONTEXT_SYM_SIZE"
+	case PropertyOrderlyCount:
+		return "TPM_PT_ORDERLY_COUNT"
+	case PropertyMaxCommandSize:
+		return "TPM_PT_MAX_COMMAND_SIZE"
+	case PropertyMaxResponseSize:
+		return "TPM_PT_MAX_RESPONSE_SIZE"
+	case PropertyMaxDigest:
+		return "TPM_PT_MAX_DIGEST"
+	case PropertyMaxObjectContext:
+		return "TPM_PT_MAX_OBJECT_CONTEXT"
+	case PropertyMaxSessionContext:
+		return "TPM_PT_MAX_SESSION_CONTEXT"
+	case PropertyPSFamilyIndicator:
+		return "TPM_PT_PS_FAMILY_INDICATOR"
+	case PropertyPSLevel:
+		return "TPM_PT_PS_LEVEL"
+	case PropertyPSRevision:
+		return "TPM_PT_PS_REVISION"
+	case PropertyPSDayOfYear:
+		return "TPM_PT_PS_DAY_OF_YEAR"
+	case PropertyPSYear:
+		return "TPM_PT_PS_YEAR"
+	case PropertySplitMax:
+		return "TPM_PT_SPLIT_MAX"
+	case PropertyTotalCommands:
+		return "TPM_PT_TOTAL_COMMANDS"
+	case PropertyLibraryCommands:
+		return "TPM_PT_LIBRARY_COMMANDS"
+	case PropertyVendorCommands:
+		return "TPM_PT_VENDOR_COMMANDS"
+	case PropertyNVBufferMax:
+		return "TPM_PT_NV_BUFFER_MAX"
+	case PropertyModes:
+		return "TPM_PT_MODES"
+	case PropertyMaxCapBuffer:
+		return "TPM_PT_MAX_CAP_BUFFER"
+	case PropertyPermanent:
+		return "TPM_PT_PERMANENT"
+	case PropertyStartupClear:
+		return "TPM_PT_STARTUP_CLEAR"
+	case PropertyHRNVIndex:
+		return "TPM_PT_HR_NV_INDEX"
+	case PropertyHRLoaded:
+		return "TPM_PT_HR_LOADED"
+	case PropertyHRLoadedAvail:
+		return "TPM_PT_HR_LOADED_AVAIL"
+	case PropertyHRActive:
+		return "TPM_PT_HR_ACTIVE"
+	case PropertyHRActiveAvail:
+		return "TPM_PT_HR_ACTIVE_AVAIL"
+	case PropertyHRTransientAvail:
+		return "TPM_PT_HR_TRANSIENT_AVAIL"
+	case PropertyHRPersistent:
+		return "TPM_PT_HR_PERSISTENT"
+	case PropertyHRPersistentAvail:
+		return "TPM_PT_HR_PERSISTENT_AVAIL"
+	case PropertyNVCounters:
+		return "TPM_PT_NV_COUNTERS"
+	case PropertyNVCountersAvail:
+		return "TPM_PT_NV_COUNTERS_AVAIL"
+	case PropertyAlgorithmSet:
+		return "TPM_PT_ALGORITHM_SET"
+	case PropertyLoadedCurves:
+		return "TPM_PT_LOADED_CURVES"
+	case PropertyLockoutCounter:
+		return "TPM_PT_LOCKOUT_COUNTER"
+	case PropertyMaxAuthFail:
+		return "TPM_PT_MAX_AUTH_FAIL"
+	case PropertyLockoutInterval:
+		return "TPM_PT_LOCKOUT_INTERVAL"
+	case PropertyLockoutRecovery:
+		return "TPM_PT_LOCKOUT_RECOVERY"
+	case PropertyNVWriteRecovery:
+		return "TPM_PT_NV_WRITE_RECOVERY"
+	case PropertyAuditCounter0:
+		return "TPM_PT_AUDIT_COUNTER_0"
+	case PropertyAuditCounter1:
+		return "TPM_PT_AUDIT_COUNTER_1"
+	default:
+		return fmt.Sprintf("0x%08x", uint32(p))
+	}
+}
+
+func (p Property) Format(s fmt.State, f rune) {
+	switch f {
+	case 's', 'v':
+		fmt.Fprintf(s, "%s", p.String())
+	default:
+		fmt.Fprintf(s, makeDefaultFormatter(s, f), uint32(p))
+	}
+}
+
+func (p PropertyPCR) String() string {
+	switch p {
+	case PropertyPCRSave:
+		return "TPM_PT_PCR_SAVE"
+	case PropertyPCRExtendL0:
+		return "TPM_PT_PCR_EXTEND_L0"
+	case PropertyPCRResetL0:
+		return "TPM_PT_PCR_RESET_L0"
+	case PropertyPCRExtendL1:
+		return "TPM_PT_PCR_EXTEND_L1"
+	case PropertyPCRResetL1:
+		return "TPM_PT_PCR_RESET_L1"
+	case PropertyPCRExtendL2:
+		return "TPM_PT_PCR_EXTEND_L2"
+	case PropertyPCRResetL2:
+		return "TPM_PT_PCR_RESET_L2"
+	case PropertyPCRExtendL3:
+		return "TPM_PT_PCR_EXTEND_L3"
+	case PropertyPCRResetL3:
+		return "TPM_PT_PCR_RESET_L3"
+	case PropertyPCRExtendL4:
+		return "TPM_PT_PCR_EXTEND_L4"
+	case PropertyPCRResetL4:
+		return "TPM_PT_PCR_RESET_L4"
+	case PropertyPCRNoIncrement:
+		return "TPM_PT_PCR_NO_INCREMENT"
+	case PropertyPCRDRTMReset:
+		return "TPM_PT_PCR_DRTM_RESET"
+	case PropertyPCRPolicy:
+		return "TPM_PT_PCR_POLICY"
+	case PropertyPCRAuth:
+		return "TPM_PT_PCR_AUTH"
+	default:
+		return fmt.Sprintf("0x%08x", uint32(p))
+	}
+}
+
+func (p PropertyPCR) Format(s fmt.State, f rune) {
+	switch f {
+	case 's', 'v':
+		fmt.Fprintf(s, "%s", p.String())
+	default:
+		fmt.Fprintf(s, makeDefaultFormatter(s, f), uint32(p))
+	}
+}
+
+func (h HandleType) String() string {
+	switch h {
+	case HandleTypePCR:
+		return "TPM_HT_PCR"
+	case HandleTypeNVIndex:
+		return "TPM_HT_NV_INDEX"
+	case HandleTypeHMACSession:
+		return "TPM_HT_HMAC_SESSION"
+	case HandleTypePolicySession:
+		return "TPM_HT_POLICY_SESSION"
+	case HandleTypePermanent:
+		return "TPM_HT_PERMANENT"
+	case HandleTypeTransient:
+		return "TPM_HT_TRANSIENT"
+	case HandleTypePersistent:
+		return "TPM_HT_PERSISTENT"
+	default:
+		return fmt.Sprintf("0x%02x", uint8(h))
+	}
+}
+
+func (h HandleType) Format(s fmt.State, f rune) {
+	switch f {
+	case 's', 'v':
+		fmt.Fprintf(s, "%s", h.String())
+	default:
+		fmt.Fprintf(s, makeDefaultFormatter(s, f), uint8(h))
+	}
+}
+
+func (c ECCCurve) String() string {
+	switch c {
+	case ECCCurveNIST_P192:
+		return "TPM_ECC_NIST_P192"
+	case ECCCurveNIST_P224:
+		return "TPM_ECC_NIST_P224"
+	case ECCCurveNIST_P256:
+		return "TPM_ECC_NIST_P256"
+	case ECCCurveNIST_P384:
+		return "TPM_ECC_NIST_P384"
+	case ECCCurveNIST_P521:
+		return "TPM_ECC_NIST_P521"
+	case ECCCurveBN_P256:
+		return "TPM_ECC_BN_P256"
+	case ECCCurveBN_P638:
+		return "TPM_ECC_BN_P638"
+	case ECCCurveSM2_P256:
+		return "TPM_ECC_SM2_P256"
+	default:
+		return fmt.Sprintf("0x%04x", uint16(c))
+	}
+}
+
+func (c ECCCurve) Format(s fmt.State, f rune) {
+	switch f {
+	case 's', 'v':
+		fmt.Fprintf(s, "%s", c.String())
+	default:
+		fmt.Fprintf(s, makeDefaultFormatter(s, f), uint16(c))
+	}
+}
+
+func (t NVType) String() string {
+	switch t {
+	case NVTypeOrdinary:
+		return "TPM_NT_ORDINARY"
+	case NVTypeCounter:
+		return "TPM_NT_COUNTER"
+	case NVTypeBits:
+		return "TPM_NT_BITS"
+	case NVTypeExtend:
+		return "TPM_NT_EXTEND"
+	case NVTypePinFail:
+		return "TPM_NT_PIN_FAIL"
+	case NVTypePinPass:
+		return "TPM_NT_PIN_PASS"
+	default:
+		return fmt.Sprintf("0x%08x", uint32(t))
+	}
+}
+
+func (t NVType) Format(s fmt.State, f rune) {
+	switch f {
+	case 's', 'v':
+		fmt.Fprintf(s, "%s", t.String())
+	default:
+		fmt.Fprintf(s, makeDefaultFormatter(s, f), uint32(t))
+	}
+}
+
+func (l Locality) String() string {
+	switch l {
+	case LocalityZero:
+		return "TPM_LOC_ZERO"
+	case LocalityOne:
+		return "TPM_LOC_ONE"
+	case LocalityTwo:
+		return "TPM_LOC_TWO"
+	case LocalityThree:
+		return "TPM_LOC_THREE"
+	case LocalityFour:
+		return "TPM_LOC_FOUR"
+	default:
+		return fmt.Sprintf("0x%02x", uint8(l))
+	}
+}
+
+func (l Locality) Format(s fmt.State, f rune) {
+	switch f {
+	case 's', 'v':
+		fmt.Fprintf(s, "%s", l.String())
+	default:
+		fmt.Fprintf(s, makeDefaultFormatter(s, f), uint8(l))
+	}
+}
+
+type attrName struct {
+	attr uint32
+	name string
+}
+
+// formatAttrs returns a string representation of a set of attributes, with each known attribute in names represented by its name
+// and any remaining bits represented as a hexadecimal value, each separated by "|".
+func formatAttrs(attrs uint32, names []attrName) string {
+	if attrs == 0 {
+		return "0"
+	}
+
+	var builder bytes.Buffer
+	for _, n := range names {
+		if attrs&n.attr == 0 {
+			continue
+		}
+		if builder.Len() > 0 {
+			builder.WriteString("|")
+		}
+		builder.WriteString(n.name)
+		attrs &^= n.attr
+	}
+	if attrs != 0 {
+		if builder.Len() > 0 {
+			builder.WriteString("|")
+		}
+		fmt.Fprintf(&builder, "0x%08x", attrs)
+	}
+	return builder.String()
+}
+
+// parseAttrs is the inverse of formatAttrs. Names are matched case-insensitively, and numeric values are accepted in any form
+// supported by strconv.ParseUint with a base of 0.
+func parseAttrs(str string, names []attrName, extra func(string) (uint32, bool, error)) (uint32, error) {
+	var attrs uint32
+	for _, field := range strings.Split(str, "|") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			return 0, fmt.Errorf("empty attribute in %q", str)
+		}
+
+		found := false
+		for _, n := range names {
+			if strings.EqualFold(field, n.name) {
+				attrs |= n.attr
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+
+		if extra != nil {
+			v, ok, err := extra(field)
+			if err != nil {
+				return 0, err
+			}
+			if ok {
+				attrs |= v
+				continue
+			}
+		}
+
+		v, err := strconv.ParseUint(field, 0, 32)
+		if err != nil {
+			return 0, fmt.Errorf("unrecognized attribute %q", field)
+		}
+		attrs |= uint32(v)
+	}
+	return attrs, nil
+}
+
+var (
+	algorithmAttrNames = []attrName{
+		{uint32(AttrAsymmetric), "asymmetric"},
+		{uint32(AttrSymmetric), "symmetric"},
+		{uint32(AttrHash), "hash"},
+		{uint32(AttrObject), "object"},
+		{uint32(AttrSigning), "signing"},
+		{uint32(AttrEncrypting), "encrypting"},
+		{uint32(AttrMethod), "method"}}
+
+	// objectAttrNames and nvAttrNames use the same names as tpm2-tools so that attributes can be exchanged with configuration
+	// files and scripts that use those tools.
+	objectAttrNames = []attrName{
+		{uint32(AttrFixedTPM), "fixedtpm"},
+		{uint32(AttrStClear), "stclear"},
+		{uint32(AttrFixedParent), "fixedparent"},
+		{uint32(AttrSensitiveDataOrigin), "sensitivedataorigin"},
+		{uint32(AttrUserWithAuth), "userwithauth"},
+		{uint32(AttrAdminWithPolicy), "adminwithpolicy"},
+		{uint32(AttrNoDA), "noda"},
+		{uint32(AttrEncryptedDuplication), "encryptedduplication"},
+		{uint32(AttrRestricted), "restricted"},
+		{uint32(AttrDecrypt), "decrypt"},
+		{uint32(AttrSign), "sign"}}
+
+	nvAttrNames = []attrName{
+		{uint32(AttrNVPPWrite), "ppwrite"},
+		{uint32(AttrNVOwnerWrite), "ownerwrite"},
+		{uint32(AttrNVAuthWrite), "authwrite"},
+		{uint32(AttrNVPolicyWrite), "policywrite"},
+		{uint32(AttrNVPolicyDelete), "policy_delete"},
+		{uint32(AttrNVWriteLocked), "writelocked"},
+		{uint32(AttrNVWriteAll), "writeall"},
+		{uint32(AttrNVWriteDefine), "writedefine"},
+		{uint32(AttrNVWriteStClear), "write_stclear"},
+		{uint32(AttrNVGlobalLock), "globallock"},
+		{uint32(AttrNVPPRead), "ppread"},
+		{uint32(AttrNVOwnerRead), "ownerread"},
+		{uint32(AttrNVAuthRead), "authread"},
+		{uint32(AttrNVPolicyRead), "policyread"},
+		{uint32(AttrNVNoDA), "no_da"},
+		{uint32(AttrNVOrderly), "orderly"},
+		{uint32(AttrNVClearStClear), "clear_stclear"},
+		{uint32(AttrNVReadLocked), "readlocked"},
+		{uint32(AttrNVWritten), "written"},
+		{uint32(AttrNVPlatformCreate), "platformcreate"},
+		{uint32(AttrNVReadStClear), "read_stclear"}}
+
+	nvTypeNames = map[NVType]string{
+		NVTypeOrdinary: "ordinary",
+		NVTypeCounter:  "counter",
+		NVTypeBits:     "bits",
+		NVTypeExtend:   "extend",
+		NVTypePinFail:  "pinfail",
+		NVTypePinPass:  "pinpass"}
+
+	permanentAttrNames = []attrName{
+		{uint32(AttrOwnerAuthSet), "ownerAuthSet"},
+		{uint32(AttrEndorsementAuthSet), "endorsementAuthSet"},
+		{uint32(AttrLockoutAuthSet), "lockoutAuthSet"},
+		{uint32(AttrDisableClear), "disableClear"},
+		{uint32(AttrInLockout), "inLockout"},
+		{uint32(AttrTPMGeneratedEPS), "tpmGeneratedEPS"}}
+
+	startupClearAttrNames = []attrName{
+		{uint32(AttrPhEnable), "phEnable"},
+		{uint32(AttrShEnable), "shEnable"},
+		{uint32(AttrEhEnable), "ehEnable"},
+		{uint32(AttrPhEnableNV), "phEnableNV"},
+		{uint32(AttrOrderly), "orderly"}}
+
+	sessionAttrNames = []attrName{
+		{uint32(AttrContinueSession), "continueSession"},
+		{uint32(AttrAuditExclusive), "auditExclusive"},
+		{uint32(AttrAuditReset), "auditReset"},
+		{uint32(AttrCommandEncrypt), "commandEncrypt"},
+		{uint32(AttrResponseEncrypt), "responseEncrypt"},
+		{uint32(AttrAudit), "audit"}}
+)
+
+func (a AlgorithmAttributes) String() string {
+	return formatAttrs(uint32(a), algorithmAttrNames)
+}
+
+func (a AlgorithmAttributes) Format(s fmt.State, f rune) {
+	switch f {
+	case 's', 'v':
+		fmt.Fprintf(s, "%s", a.String())
+	default:
+		fmt.Fprintf(s, makeDefaultFormatter(s, f), uint32(a))
+	}
+}
+
+func (a ObjectAttributes) String() string {
+	return formatAttrs(uint32(a), objectAttrNames)
+}
+
+func (a ObjectAttributes) Format(s fmt.State, f rune) {
+	switch f {
+	case 's', 'v':
+		fmt.Fprintf(s, "%s", a.String())
+	default:
+		fmt.Fprintf(s, makeDefaultFormatter(s, f), uint32(a))
+	}
+}
+
+func (a NVAttributes) String() string {
+	s := formatAttrs(uint32(a.AttrsOnly()), nvAttrNames)
+	if a.Type() == NVTypeOrdinary {
+		return s
+	}
+	t, ok := nvTypeNames[a.Type()]
+	if !ok {
+		t = fmt.Sprintf("0x%x", uint32(a.Type()))
+	}
+	if s == "0" {
+		return "nt=" + t
+	}
+	return s + "|nt=" + t
+}
+
+// ParseObjectAttributes parses the symbolic representation of a set of object attributes, as returned from ObjectAttributes.String
+// and used by tpm2-tools (eg, "fixedtpm|fixedparent|sensitivedataorigin|userwithauth|restricted|decrypt"). Attribute names are
+// case-insensitive, and numeric values may be used for bits that don't have a name.
+func ParseObjectAttributes(s string) (ObjectAttributes, error) {
+	attrs, err := parseAttrs(s, objectAttrNames, nil)
+	if err != nil {
+		return 0, err
+	}
+	return ObjectAttributes(attrs), nil
+}
+
+// ParseNVAttributes parses the symbolic representation of a set of NV index attributes, as returned from NVAttributes.String and
+// used by tpm2-tools (eg, "ownerwrite|ownerread|authread|nt=counter"). The type of the index is specified with "nt=" followed by
+// either the name of the type or its numeric value, and defaults to NVTypeOrdinary if omitted.
+func ParseNVAttributes(s string) (NVAttributes, error) {
+	var nt *NVType
+	attrs, err := parseAttrs(s, nvAttrNames, func(field string) (uint32, bool, error) {
+		if len(field) < 3 || !strings.EqualFold(field[:3], "nt=") {
+			return 0, false, nil
+		}
+		if nt != nil {
+			return 0, false, fmt.Errorf("more than one type specified in %q", s)
+		}
+		t, err := parseNVType(field[3:])
+		if err != nil {
+			return 0, false, err
+		}
+		nt = &t
+		return 0, true, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	a := NVAttributes(attrs)
+	if nt == nil {
+		return a, nil
+	}
+	if a.Type() != NVTypeOrdinary {
+		return 0, fmt.Errorf("type specified with both nt= and a numeric value in %q", s)
+	}
+	return nt.WithAttrs(a), nil
+}
+
+func parseNVType(s string) (NVType, error) {
+	for t, n := range nvTypeNames {
+		if strings.EqualFold(s, n) {
+			return t, nil
+		}
+	}
+	v, err := strconv.ParseUint(s, 0, 4)
+	if err != nil {
+		return 0, fmt.Errorf("invalid NV index type %q", s)
+	}
+	return NVType(v), nil
+}
+
+func (a NVAttributes) Format(s fmt.State, f rune) {
+	switch f {
+	case 's', 'v':
+		fmt.Fprintf(s, "%s", a.String())
+	default:
+		fmt.Fprintf(s, makeDefaultFormatter(s, f), uint32(a))
+	}
+}
+
+func (a PermanentAttributes) String() string {
+	return formatAttrs(uint32(a), permanentAttrNames)
+}
+
+func (a PermanentAttributes) Format(s fmt.State, f rune) {
+	switch f {
+	case 's', 'v':
+		fmt.Fprintf(s, "%s", a.String())
+	default:
+		fmt.Fprintf(s, makeDefaultFormatter(s, f), uint32(a))
+	}
+}
+
+func (a StartupClearAttributes) String() string {
+	return formatAttrs(uint32(a), startupClearAttrNames)
+}
+
+func (a StartupClearAttributes) Format(s fmt.State, f rune) {
+	switch f {
+	case 's', 'v':
+		fmt.Fprintf(s, "%s", a.String())
+	default:
+		fmt.Fprintf(s, makeDefaultFormatter(s, f), uint32(a))
+	}
+}
+
+func (a SessionAttributes) String() string {
+	return formatAttrs(uint32(a), sessionAttrNames)
+}
+
+func (a SessionAttributes) Format(s fmt.State, f rune) {
+	switch f {
+	case 's', 'v':
+		fmt.Fprintf(s, "%s", a.String())
+	default:
+		fmt.Fprintf(s, makeDefaultFormatter(s, f), int(a))
+	}
+}
+
 var (
 	errorCodeDescriptions = map[ErrorCode]string{
 		ErrorInitialize:      "TPM not initialized by TPM2_Startup or already initialized",
@@ -814,4 +1601,50 @@ var (
 			"lockout mode",
 		WarningRetry:         "the TPM was not able to start the command",
 		WarningNVUnavailable: "the command may require writing of NV and NV is not current accessible"}
+
+	// tpm1ErrorCodeDescriptions contains descriptions of the TPM 1.2 response codes, most commonly returned from devices that are
+	// in TPM 1.2 mode and receive a TPM 2.0 command.
+	tpm1ErrorCodeDescriptions = map[ResponseCode]string{
+		0x01:  "authentication failed",
+		0x02:  "the index to a PCR, DIR or other register is incorrect",
+		0x03:  "one or more parameter is bad",
+		0x04:  "an operation completed successfully but the auditing of that operation failed",
+		0x05:  "the clear disable flag is set and all clear operations now require physical access",
+		0x06:  "the TPM is deactivated",
+		0x07:  "the TPM is disabled",
+		0x08:  "the target command has been disabled",
+		0x09:  "the operation failed",
+		0x0a:  "the ordinal was unknown or inconsistent",
+		0x0b:  "the ability to install an owner is disabled",
+		0x0c:  "the key handle can not be interpreted",
+		0x0d:  "the key handle points to an invalid key",
+		0x0e:  "unacceptable encryption scheme",
+		0x0f:  "migration authorization failed",
+		0x10:  "PCR information could not be interpreted",
+		0x11:  "no room to load key",
+		0x12:  "there is no SRK set",
+		0x13:  "an encrypted blob is invalid or was not created by this TPM",
+		0x14:  "there is already an owner",
+		0x15:  "the TPM has insufficient internal resources to perform the requested action",
+		0x16:  "a random string was too short",
+		0x17:  "the TPM does not have the space to perform the operation",
+		0x18:  "the named PCR value does not match the current PCR value",
+		0x19:  "the paramSize argument to the command has the incorrect value",
+		0x1a:  "there is no existing SHA-1 thread",
+		0x1b:  "the calculation is unable to proceed because the existing SHA-1 thread has already encountered an error",
+		0x1c:  "self-test has failed and the TPM has shut down",
+		0x1d:  "the authorization for the second key in a 2 key function failed authorization",
+		0x1e:  "the tag value sent for a command is invalid",
+		0x1f:  "an IO error occurred transmitting information to the TPM",
+		0x20:  "the encryption process had a problem",
+		0x21:  "the decryption process did not complete",
+		0x22:  "an invalid handle was used",
+		0x23:  "the TPM does not have an endorsement key installed",
+		0x24:  "the usage of a key is not allowed",
+		0x25:  "the submitted entity type is not allowed",
+		0x26:  "the command was received in the wrong sequence relative to TPM_Init and a subsequent TPM_Startup",
+		0x800: "the TPM is too busy to respond to the command immediately, but the command could be resubmitted at a later time",
+		0x801: "the TPM needs to run a self-test before the command can be executed",
+		0x802: "the TPM is currently executing a full self-test",
+		0x803: "the TPM is defending against dictionary attacks and is in a time-out period"}
 )
@@ -0,0 +1,126 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	"fmt"
+
+	. "github.com/canonical/go-tpm2"
+
+	. "gopkg.in/check.v1"
+)
+
+type stringsSuite struct{}
+
+var _ = Suite(&stringsSuite{})
+
+func (s *stringsSuite) TestEnums(c *C) {
+	for _, data := range []struct {
+		value    interface{}
+		expected string
+	}{
+		{StructTag(TagSessions), "TPM_ST_SESSIONS"},
+		{StartupState, "TPM_SU_STATE"},
+		{SessionTypePolicy, "TPM_SE_POLICY"},
+		{PropertyNVBufferMax, "TPM_PT_NV_BUFFER_MAX"},
+		{PropertyPCRNoIncrement, "TPM_PT_PCR_NO_INCREMENT"},
+		{HandleTypeLoadedSession, "TPM_HT_HMAC_SESSION"},
+		{ECCCurveNIST_P256, "TPM_ECC_NIST_P256"},
+		{NVTypeCounter, "TPM_NT_COUNTER"},
+		{OpUnsignedLE, "TPM_EO_UNSIGNED_LE"},
+		{LocalityThree, "TPM_LOC_THREE"},
+		{HashAlgorithmSHA256, "TPM_ALG_SHA256"},
+		{ObjectTypeRSA, "TPM_ALG_RSA"},
+		{Property(0x1ff), "0x000001ff"},
+		{ECCCurve(0x40), "0x0040"},
+	} {
+		c.Check(fmt.Sprintf("%v", data.value), Equals, data.expected)
+		c.Check(data.value.(fmt.Stringer).String(), Equals, data.expected)
+	}
+}
+
+func (s *stringsSuite) TestEnumFormatNumeric(c *C) {
+	c.Check(fmt.Sprintf("%d", PropertyNVBufferMax), Equals, "300")
+	c.Check(fmt.Sprintf("%#x", SessionTypeTrial), Equals, "0x3")
+}
+
+func (s *stringsSuite) TestAttributes(c *C) {
+	for _, data := range []struct {
+		value    fmt.Stringer
+		expected string
+	}{
+		{AttrFixedTPM | AttrFixedParent | AttrUserWithAuth | AttrSign, "fixedtpm|fixedparent|userwithauth|sign"},
+		{ObjectAttributes(0), "0"},
+		{AttrRestricted | ObjectAttributes(1<<30), "restricted|0x40000000"},
+		{NVTypeCounter.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead), "authwrite|authread|nt=counter"},
+		{AttrNVOwnerRead, "ownerread"},
+		{NVTypeBits.WithAttrs(0), "nt=bits"},
+		{NVType(3).WithAttrs(AttrNVNoDA), "no_da|nt=0x3"},
+		{AttrOwnerAuthSet | AttrInLockout, "ownerAuthSet|inLockout"},
+		{AttrShEnable | AttrOrderly, "shEnable|orderly"},
+		{AttrHash, "hash"},
+		{AttrContinueSession | AttrCommandEncrypt, "continueSession|commandEncrypt"},
+	} {
+		c.Check(data.value.String(), Equals, data.expected)
+	}
+}
+
+func (s *stringsSuite) TestParseObjectAttributes(c *C) {
+	for _, data := range []struct {
+		in       string
+		expected ObjectAttributes
+	}{
+		{"fixedtpm|fixedparent|sensitivedataorigin|userwithauth|restricted|decrypt",
+			AttrFixedTPM | AttrFixedParent | AttrSensitiveDataOrigin | AttrUserWithAuth | AttrRestricted | AttrDecrypt},
+		{"fixedTPM | noDA", AttrFixedTPM | AttrNoDA},
+		{"0", 0},
+		{"sign|0x40000000", AttrSign | ObjectAttributes(1<<30)},
+	} {
+		a, err := ParseObjectAttributes(data.in)
+		c.Check(err, IsNil)
+		c.Check(a, Equals, data.expected)
+	}
+
+	for _, a := range []ObjectAttributes{AttrFixedTPM | AttrStClear | AttrEncryptedDuplication | AttrSign, AttrAdminWithPolicy | 0x1} {
+		b, err := ParseObjectAttributes(a.String())
+		c.Check(err, IsNil)
+		c.Check(b, Equals, a)
+	}
+
+	_, err := ParseObjectAttributes("fixedtpm|foo")
+	c.Check(err, ErrorMatches, "unrecognized attribute \"foo\"")
+	_, err = ParseObjectAttributes("fixedtpm||sign")
+	c.Check(err, ErrorMatches, "empty attribute in .*")
+}
+
+func (s *stringsSuite) TestParseNVAttributes(c *C) {
+	for _, data := range []struct {
+		in       string
+		expected NVAttributes
+	}{
+		{"ownerwrite|ownerread|authread", AttrNVOwnerWrite | AttrNVOwnerRead | AttrNVAuthRead},
+		{"authwrite|authread|nt=counter", NVTypeCounter.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead)},
+		{"nt=0x4|policywrite|no_da", NVTypeExtend.WithAttrs(AttrNVPolicyWrite | AttrNVNoDA)},
+		{"NT=PinPass", NVTypePinPass.WithAttrs(0)},
+		{"write_stclear|nt=ordinary", AttrNVWriteStClear},
+	} {
+		a, err := ParseNVAttributes(data.in)
+		c.Check(err, IsNil)
+		c.Check(a, Equals, data.expected)
+	}
+
+	for _, a := range []NVAttributes{NVTypeBits.WithAttrs(AttrNVPPWrite | AttrNVReadStClear), AttrNVWritten, NVType(3).WithAttrs(0)} {
+		b, err := ParseNVAttributes(a.String())
+		c.Check(err, IsNil)
+		c.Check(b, Equals, a)
+	}
+
+	_, err := ParseNVAttributes("nt=counter|nt=bits")
+	c.Check(err, ErrorMatches, "more than one type specified in .*")
+	_, err = ParseNVAttributes("nt=foo")
+	c.Check(err, ErrorMatches, "invalid NV index type \"foo\"")
+	_, err = ParseNVAttributes("nt=bits|0x10")
+	c.Check(err, ErrorMatches, "type specified with both nt= and a numeric value in .*")
+}
@@ -34,3 +34,23 @@ type TCTI interface {
 	// associated with the supplied handle between commands.
 	MakeSticky(handle Handle, sticky bool) error
 }
+
+// PipelinedTCTI is implemented by transmission interfaces that can accept a command before the response to the previous command
+// has been read, such as a connection to a TPM simulator where the transport queues commands. When supported, TPMContext uses this
+// to marshal and write the next command of a multi-command operation (such as a large NV read or write) whilst the TPM is still
+// processing the previous one.
+type PipelinedTCTI interface {
+	TCTI
+
+	// SupportsPipelining indicates whether a command can be written before the response to the previous command has been read.
+	SupportsPipelining() bool
+}
+
+// exclusiveTCTI is implemented by transmission interfaces that are shared with other users, and which can prevent commands from
+// other users from being interleaved with a sequence of commands, such as those used by TPMContext instances created with
+// SharedTCTI.NewTPMContext.
+type exclusiveTCTI interface {
+	// lockExclusive blocks commands from other users until unlockExclusive is called.
+	lockExclusive()
+	unlockExclusive()
+}
@@ -5,8 +5,13 @@
 package testutil
 
 import (
+	"bytes"
+	"fmt"
 	"reflect"
 
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+
 	. "gopkg.in/check.v1"
 )
 
@@ -58,3 +63,110 @@ func (checker *isFalseChecker) Check(params []interface{}, names []string) (resu
 	r, err := checker.Checker.Check(params, names)
 	return !r, err
 }
+
+type digestEqualsChecker struct {
+	*CheckerInfo
+}
+
+// DigestEquals checks that the obtained tpm2.Digest is equal to the expected one. The expected value can be a tpm2.Digest or a
+// []byte.
+var DigestEquals Checker = &digestEqualsChecker{
+	&CheckerInfo{Name: "DigestEquals", Params: []string{"obtained", "expected"}}}
+
+func (checker *digestEqualsChecker) Check(params []interface{}, names []string) (result bool, error string) {
+	return checkBytesEqual(params, names)
+}
+
+type nameEqualsChecker struct {
+	*CheckerInfo
+}
+
+// NameEquals checks that the obtained tpm2.Name is equal to the expected one. The expected value can be a tpm2.Name or a []byte.
+var NameEquals Checker = &nameEqualsChecker{
+	&CheckerInfo{Name: "NameEquals", Params: []string{"obtained", "expected"}}}
+
+func (checker *nameEqualsChecker) Check(params []interface{}, names []string) (result bool, error string) {
+	return checkBytesEqual(params, names)
+}
+
+func checkBytesEqual(params []interface{}, names []string) (result bool, error string) {
+	var values [2][]byte
+	for i := range values {
+		v := reflect.ValueOf(params[i])
+		if v.Kind() != reflect.Slice || v.Type().Elem().Kind() != reflect.Uint8 {
+			return false, names[i] + " is not a byte slice"
+		}
+		values[i] = v.Bytes()
+	}
+	return bytes.Equal(values[0], values[1]), ""
+}
+
+type publicTemplateEqualsChecker struct {
+	*CheckerInfo
+}
+
+// PublicTemplateEquals checks that the obtained *tpm2.Public has the same type, name algorithm, attributes, authorization policy
+// and parameters as the expected *tpm2.Public. The unique field is not compared, so this can be used to check the public area of
+// an object created from a template.
+var PublicTemplateEquals Checker = &publicTemplateEqualsChecker{
+	&CheckerInfo{Name: "PublicTemplateEquals", Params: []string{"obtained", "expected"}}}
+
+func (checker *publicTemplateEqualsChecker) Check(params []interface{}, names []string) (result bool, error string) {
+	obtained, ok := params[0].(*tpm2.Public)
+	if !ok {
+		return false, names[0] + " is not a *tpm2.Public"
+	}
+	expected, ok := params[1].(*tpm2.Public)
+	if !ok {
+		return false, names[1] + " is not a *tpm2.Public"
+	}
+	if obtained.Type != expected.Type {
+		return false, ""
+	}
+
+	// Compare the marshalled forms with the unique field of the expected value replaced with the obtained one.
+	e := *expected
+	e.Unique = obtained.Unique
+	a, err := mu.MarshalToBytes(obtained)
+	if err != nil {
+		return false, fmt.Sprintf("cannot marshal %s: %v", names[0], err)
+	}
+	b, err := mu.MarshalToBytes(&e)
+	if err != nil {
+		return false, fmt.Sprintf("cannot marshal %s: %v", names[1], err)
+	}
+	return bytes.Equal(a, b), ""
+}
+
+type tpmErrorIsChecker struct {
+	*CheckerInfo
+}
+
+// TPMErrorIs checks that the obtained error or any error in its chain is a TPM error or warning for the specified command, with the
+// expected code. The code can be a tpm2.ErrorCode or tpm2.WarningCode. Errors associated with a handle, parameter or session match
+// regardless of the index.
+var TPMErrorIs Checker = &tpmErrorIsChecker{
+	&CheckerInfo{Name: "TPMErrorIs", Params: []string{"error", "code", "command"}}}
+
+func (checker *tpmErrorIsChecker) Check(params []interface{}, names []string) (bool, string) {
+	err, ok := params[0].(error)
+	if !ok {
+		return false, names[0] + " is not an error"
+	}
+	command, ok := params[2].(tpm2.CommandCode)
+	if !ok {
+		return false, names[2] + " is not a tpm2.CommandCode"
+	}
+
+	switch code := params[1].(type) {
+	case tpm2.ErrorCode:
+		return tpm2.IsTPMError(err, code, command) ||
+			tpm2.IsTPMHandleError(err, code, command, tpm2.AnyHandleIndex) ||
+			tpm2.IsTPMParameterError(err, code, command, tpm2.AnyParameterIndex) ||
+			tpm2.IsTPMSessionError(err, code, command, tpm2.AnySessionIndex), ""
+	case tpm2.WarningCode:
+		return tpm2.IsTPMWarning(err, code, command), ""
+	default:
+		return false, names[1] + " is not a tpm2.ErrorCode or tpm2.WarningCode"
+	}
+}
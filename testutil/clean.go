@@ -0,0 +1,162 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package testutil
+
+import (
+	"github.com/canonical/go-tpm2"
+
+	"golang.org/x/xerrors"
+)
+
+// HandleRange describes an inclusive range of handles.
+type HandleRange struct {
+	First tpm2.Handle
+	Last  tpm2.Handle
+}
+
+func (r HandleRange) contains(h tpm2.Handle) bool {
+	return h >= r.First && h <= r.Last
+}
+
+var (
+	// DefaultTestPersistentHandles is the range of persistent handles evicted by CleanTPMState by default, which corresponds
+	// to the owner range of persistent handles.
+	DefaultTestPersistentHandles = HandleRange{First: 0x81000000, Last: 0x817fffff}
+
+	// DefaultTestNVIndices is the range of NV indices undefined by CleanTPMState by default, which corresponds to the range
+	// reserved for owner indices.
+	DefaultTestNVIndices = HandleRange{First: 0x01800000, Last: 0x01bfffff}
+)
+
+// CleanTPMStateOptions specifies the resources that CleanTPMState removes.
+type CleanTPMStateOptions struct {
+	// PersistentHandles is the range of persistent objects to evict. If this is nil, DefaultTestPersistentHandles is used.
+	PersistentHandles *HandleRange
+
+	// NVIndices is the range of NV indices to undefine. If this is nil, DefaultTestNVIndices is used.
+	NVIndices *HandleRange
+
+	// Clear indicates that the owner and endorsement hierarchies should be cleared with TPM2_Clear, using the lockout
+	// hierarchy for authorization. This is performed last, and will also remove any persistent objects and NV indices in the
+	// owner hierarchy outside of the above ranges.
+	Clear bool
+}
+
+// flushableHandles returns the handles of all transient objects and sessions currently loaded or saved on the TPM. Policy
+// session handles are returned as HMAC session handles, as both share the same TPM_HT_LOADED_SESSION handle type.
+func flushableHandles(tpm *tpm2.TPMContext) (out tpm2.HandleList, err error) {
+	for _, t := range []tpm2.HandleType{tpm2.HandleTypeTransient, tpm2.HandleTypeLoadedSession, tpm2.HandleTypeSavedSession} {
+		h, err := tpm.GetCapabilityHandles(t.BaseHandle(), tpm2.CapabilityMaxProperties, nil)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, h...)
+	}
+	for i, h := range out {
+		if h.Type() == tpm2.HandleTypePolicySession {
+			out[i] = (h & 0xffffff) | (tpm2.Handle(tpm2.HandleTypeHMACSession) << 24)
+		}
+	}
+	return out, nil
+}
+
+// flushHandle flushes the transient object or session with the supplied handle.
+func flushHandle(tpm *tpm2.TPMContext, h tpm2.Handle) error {
+	var hc tpm2.HandleContext
+	switch h.Type() {
+	case tpm2.HandleTypeTransient:
+		var err error
+		hc, err = tpm.CreateResourceContextFromTPM(h)
+		if err != nil {
+			return err
+		}
+	case tpm2.HandleTypeHMACSession:
+		hc = tpm2.CreateIncompleteSessionContext(h)
+	default:
+		return xerrors.Errorf("unexpected handle type for handle 0x%08x", h)
+	}
+	return tpm.FlushContext(hc)
+}
+
+// CleanTPMState returns the TPM associated with the supplied context to a known state, so that integration tests that run on shared
+// hardware can be isolated from each other. It flushes all transient objects and sessions, evicts persistent objects and undefines
+// NV indices in the ranges specified by opts, and optionally clears the owner and endorsement hierarchies. NV indices created by
+// the platform are undefined using the platform hierarchy. The authorization values of the hierarchies used must be set on the
+// corresponding ResourceContexts before calling this.
+//
+// If opts is nil, the default ranges are used and the hierarchies are not cleared.
+func CleanTPMState(tpm *tpm2.TPMContext, opts *CleanTPMStateOptions) error {
+	if opts == nil {
+		opts = &CleanTPMStateOptions{}
+	}
+	persistent := DefaultTestPersistentHandles
+	if opts.PersistentHandles != nil {
+		persistent = *opts.PersistentHandles
+	}
+	nvIndices := DefaultTestNVIndices
+	if opts.NVIndices != nil {
+		nvIndices = *opts.NVIndices
+	}
+
+	handles, err := flushableHandles(tpm)
+	if err != nil {
+		return xerrors.Errorf("cannot obtain flushable handles: %w", err)
+	}
+	for _, h := range handles {
+		if err := flushHandle(tpm, h); err != nil {
+			return xerrors.Errorf("cannot flush handle 0x%08x: %w", h, err)
+		}
+	}
+
+	handles, err = tpm.GetCapabilityHandles(persistent.First, tpm2.CapabilityMaxProperties)
+	if err != nil {
+		return xerrors.Errorf("cannot obtain persistent handles: %w", err)
+	}
+	for _, h := range handles {
+		if !persistent.contains(h) {
+			continue
+		}
+		object, err := tpm.CreateResourceContextFromTPM(h)
+		if err != nil {
+			return xerrors.Errorf("cannot create context for persistent handle 0x%08x: %w", h, err)
+		}
+		if _, err := tpm.EvictControl(tpm.OwnerHandleContext(), object, h, nil); err != nil {
+			return xerrors.Errorf("cannot evict persistent handle 0x%08x: %w", h, err)
+		}
+	}
+
+	handles, err = tpm.GetCapabilityHandles(nvIndices.First, tpm2.CapabilityMaxProperties)
+	if err != nil {
+		return xerrors.Errorf("cannot obtain NV index handles: %w", err)
+	}
+	for _, h := range handles {
+		if !nvIndices.contains(h) {
+			continue
+		}
+		index, err := tpm.CreateResourceContextFromTPM(h)
+		if err != nil {
+			return xerrors.Errorf("cannot create context for NV index 0x%08x: %w", h, err)
+		}
+		pub, _, err := tpm.NVReadPublic(index)
+		if err != nil {
+			return xerrors.Errorf("cannot read public area of NV index 0x%08x: %w", h, err)
+		}
+		auth := tpm.OwnerHandleContext()
+		if pub.Attrs&tpm2.AttrNVPlatformCreate != 0 {
+			auth = tpm.PlatformHandleContext()
+		}
+		if err := tpm.NVUndefineSpace(auth, index, nil); err != nil {
+			return xerrors.Errorf("cannot undefine NV index 0x%08x: %w", h, err)
+		}
+	}
+
+	if opts.Clear {
+		if err := tpm.Clear(tpm.LockoutHandleContext(), nil); err != nil {
+			return xerrors.Errorf("cannot clear hierarchies: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package testutil
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+)
+
+func TestCleanTPMState(t *testing.T) {
+	handles := func(h ...tpm2.Handle) *MockResponse {
+		return &MockResponse{Params: []interface{}{false, &tpm2.CapabilityData{Capability: tpm2.CapabilityHandles, Data: &tpm2.CapabilitiesU{Handles: h}}}}
+	}
+
+	pub := GeneratePublic(rand.New(rand.NewSource(1)))
+	name, err := pub.Name()
+	if err != nil {
+		t.Fatalf("Name failed: %v", err)
+	}
+	pubBytes, err := pub.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes failed: %v", err)
+	}
+
+	tcti := NewMockTCTI(
+		&MockCommand{CommandCode: tpm2.CommandGetCapability, Response: handles()},
+		&MockCommand{CommandCode: tpm2.CommandGetCapability, Response: handles(0x02000001)},
+		&MockCommand{CommandCode: tpm2.CommandGetCapability, Response: handles()},
+		&MockCommand{CommandCode: tpm2.CommandFlushContext, Response: &MockResponse{}},
+		&MockCommand{CommandCode: tpm2.CommandGetCapability, Response: handles(0x81000001, 0x81800000)},
+		&MockCommand{CommandCode: tpm2.CommandReadPublic, Handles: []tpm2.Handle{0x81000001},
+			Response: &MockResponse{Params: []interface{}{uint16(len(pubBytes)), mu.RawBytes(pubBytes), name, name}}},
+		&MockCommand{CommandCode: tpm2.CommandEvictControl, Handles: []tpm2.Handle{tpm2.HandleOwner, 0x81000001},
+			Response: &MockResponse{PasswordSessions: 1}},
+		&MockCommand{CommandCode: tpm2.CommandGetCapability, Response: handles()},
+		&MockCommand{CommandCode: tpm2.CommandClear, Handles: []tpm2.Handle{tpm2.HandleLockout},
+			Response: &MockResponse{PasswordSessions: 1}})
+	tpm, _ := tpm2.NewTPMContext(tcti)
+
+	if err := CleanTPMState(tpm, &CleanTPMStateOptions{Clear: true}); err != nil {
+		t.Errorf("CleanTPMState failed: %v", err)
+	}
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package testutil
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/canonical/go-tpm2"
+)
+
+// deterministicRandom is an io.Reader that produces a stream of bytes from the SHA-256 digests of a seed and an incrementing
+// counter. It is not suitable for anything other than testing.
+type deterministicRandom struct {
+	seed    []byte
+	counter uint64
+	buf     []byte
+}
+
+func (r *deterministicRandom) Read(data []byte) (int, error) {
+	n := 0
+	for n < len(data) {
+		if len(r.buf) == 0 {
+			h := sha256.New()
+			h.Write(r.seed)
+			binary.Write(h, binary.BigEndian, r.counter)
+			r.counter++
+			r.buf = h.Sum(nil)
+		}
+		c := copy(data[n:], r.buf)
+		r.buf = r.buf[c:]
+		n += c
+	}
+	return n, nil
+}
+
+// NewDeterministicRandomSource returns an io.Reader that produces the same stream of bytes for the same seed. This is not a
+// cryptographically secure source of random bytes, and must only be used for testing.
+func NewDeterministicRandomSource(seed []byte) io.Reader {
+	return &deterministicRandom{seed: append([]byte(nil), seed...)}
+}
+
+// FakeClock is an implementation of tpm2.Clock that doesn't advance on its own. Calls to Sleep return immediately and advance the
+// clock by the requested duration.
+type FakeClock struct {
+	Time time.Time
+}
+
+func (c *FakeClock) Now() time.Time {
+	return c.Time
+}
+
+func (c *FakeClock) Sleep(d time.Duration) {
+	c.Time = c.Time.Add(d)
+}
+
+// MakeTPMContextDeterministic configures the supplied TPMContext with a deterministic random source created from seed and a
+// FakeClock starting at the Unix epoch, so that tests produce identical command packets across runs. This covers caller nonces,
+// and therefore command HMACs and parameter encryption. Salted sessions are only reproducible if the crypto packages in the Go
+// standard library use the supplied random source for RSA-OAEP encryption and ECC key generation, which recent Go versions don't
+// guarantee.
+func MakeTPMContextDeterministic(tpm *tpm2.TPMContext, seed []byte) *FakeClock {
+	clock := &FakeClock{Time: time.Unix(0, 0)}
+	tpm.SetRandomSource(NewDeterministicRandomSource(seed))
+	tpm.SetClock(clock)
+	return clock
+}
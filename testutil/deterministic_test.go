@@ -0,0 +1,78 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package testutil
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/canonical/go-tpm2"
+)
+
+func mockCommand(commandCode tpm2.CommandCode, rc tpm2.ResponseCode) *MockCommand {
+	return &MockCommand{CommandCode: commandCode, Response: &MockResponse{ResponseCode: rc}}
+}
+
+func TestDeterministicCommandPackets(t *testing.T) {
+	run := func(seed string) [][]byte {
+		tcti := NewMockTCTI(
+			&MockCommand{CommandCode: tpm2.CommandStartAuthSession, Response: &MockResponse{Handle: 0x02000000, Params: []interface{}{make(tpm2.Nonce, 32)}}},
+			mockCommand(tpm2.CommandHierarchyChangeAuth, tpm2.ResponseCode(0x98e)))
+		tpm, _ := tpm2.NewTPMContext(tcti)
+		clock := MakeTPMContextDeterministic(tpm, []byte(seed))
+
+		var durations []time.Duration
+		tpm.SetCommandObserver(observerFunc(func(_ tpm2.CommandCode, _ tpm2.HandleList, d time.Duration, _ tpm2.ResponseCode) {
+			durations = append(durations, d)
+		}))
+
+		symmetric := &tpm2.SymDef{Algorithm: tpm2.SymAlgorithmAES, KeyBits: &tpm2.SymKeyBitsU{Sym: 128}, Mode: &tpm2.SymModeU{Sym: tpm2.SymModeCFB}}
+		session, err := tpm.StartAuthSession(nil, nil, tpm2.SessionTypeHMAC, symmetric, tpm2.HashAlgorithmSHA256)
+		if err != nil {
+			t.Fatalf("StartAuthSession failed: %v", err)
+		}
+		if err := tpm.HierarchyChangeAuth(tpm.OwnerHandleContext(), tpm2.Auth("foo"), session.WithAttrs(tpm2.AttrContinueSession|tpm2.AttrCommandEncrypt)); err == nil {
+			t.Fatalf("HierarchyChangeAuth should have failed")
+		}
+
+		if !clock.Now().Equal(time.Unix(0, 0)) || !reflect.DeepEqual(durations, []time.Duration{0, 0}) {
+			t.Errorf("Unexpected clock or durations: %v, %v", clock.Now(), durations)
+		}
+		return tcti.Commands()
+	}
+
+	commands1 := run("foo")
+	commands2 := run("foo")
+	if !reflect.DeepEqual(commands1, commands2) {
+		t.Errorf("Command packets are not identical:\n%x\n%x", commands1, commands2)
+	}
+	if reflect.DeepEqual(commands1, run("bar")) {
+		t.Errorf("Command packets should differ with a different seed")
+	}
+}
+
+type observerFunc func(tpm2.CommandCode, tpm2.HandleList, time.Duration, tpm2.ResponseCode)
+
+func (f observerFunc) ObserveCommand(commandCode tpm2.CommandCode, handles tpm2.HandleList, duration time.Duration, responseCode tpm2.ResponseCode) {
+	f(commandCode, handles, duration, responseCode)
+}
+
+func TestFakeClockAdvancesWhenWaiting(t *testing.T) {
+	tcti := NewMockTCTI(
+		mockCommand(tpm2.CommandSelfTest, tpm2.ResponseCode(0x923)),
+		mockCommand(tpm2.CommandSelfTest, tpm2.ResponseCode(0x923)),
+		mockCommand(tpm2.CommandSelfTest, tpm2.Success))
+	tpm, _ := tpm2.NewTPMContext(tcti)
+	clock := MakeTPMContextDeterministic(tpm, nil)
+	tpm.SetWaitForReady(time.Second)
+
+	if err := tpm.SelfTest(false); err != nil {
+		t.Fatalf("SelfTest failed: %v", err)
+	}
+	if clock.Now().Sub(time.Unix(0, 0)) != 200*time.Millisecond {
+		t.Errorf("Unexpected clock: %v", clock.Now())
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package testutil
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/canonical/go-tpm2"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// RSAEKCertNVIndex is the NV index of the RSA 2048 EK certificate, as defined by the TCG EK Credential Profile.
+	RSAEKCertNVIndex tpm2.Handle = 0x01c00002
+
+	// ECCEKCertNVIndex is the NV index of the ECC NIST P256 EK certificate, as defined by the TCG EK Credential Profile.
+	ECCEKCertNVIndex tpm2.Handle = 0x01c0000a
+)
+
+var (
+	// ekAuthPolicy is the authorization policy of the default EK templates, which is PolicySecret(TPM_RH_ENDORSEMENT).
+	ekAuthPolicy = tpm2.Digest{0x83, 0x71, 0x97, 0x67, 0x44, 0x84, 0xb3, 0xf8, 0x1a, 0x90, 0xcc, 0x8d, 0x46, 0xa5, 0xd7, 0x24,
+		0xfd, 0x52, 0xd7, 0x6e, 0x06, 0x52, 0x0b, 0x64, 0xf2, 0xa1, 0xda, 0x1b, 0x33, 0x14, 0x69, 0xaa}
+
+	oidTcgKpEKCertificate = asn1.ObjectIdentifier{2, 23, 133, 8, 1}
+)
+
+// MakeRSAEKTemplate returns the default RSA 2048 EK template from the TCG EK Credential Profile (template L-1).
+func MakeRSAEKTemplate() *tpm2.Public {
+	return &tpm2.Public{
+		Type:    tpm2.ObjectTypeRSA,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs: tpm2.AttrFixedTPM | tpm2.AttrFixedParent | tpm2.AttrSensitiveDataOrigin | tpm2.AttrAdminWithPolicy |
+			tpm2.AttrRestricted | tpm2.AttrDecrypt,
+		AuthPolicy: ekAuthPolicy,
+		Params: &tpm2.PublicParamsU{
+			RSADetail: &tpm2.RSAParams{
+				Symmetric: aes128CFB,
+				Scheme:    tpm2.RSAScheme{Scheme: tpm2.RSASchemeNull},
+				KeyBits:   2048,
+				Exponent:  0}},
+		Unique: &tpm2.PublicIDU{RSA: make(tpm2.PublicKeyRSA, 256)}}
+}
+
+// MakeECCEKTemplate returns the default ECC NIST P256 EK template from the TCG EK Credential Profile (template L-2).
+func MakeECCEKTemplate() *tpm2.Public {
+	return &tpm2.Public{
+		Type:    tpm2.ObjectTypeECC,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs: tpm2.AttrFixedTPM | tpm2.AttrFixedParent | tpm2.AttrSensitiveDataOrigin | tpm2.AttrAdminWithPolicy |
+			tpm2.AttrRestricted | tpm2.AttrDecrypt,
+		AuthPolicy: ekAuthPolicy,
+		Params: &tpm2.PublicParamsU{
+			ECCDetail: &tpm2.ECCParams{
+				Symmetric: aes128CFB,
+				Scheme:    tpm2.ECCScheme{Scheme: tpm2.ECCSchemeNull},
+				CurveID:   tpm2.ECCCurveNIST_P256,
+				KDF:       tpm2.KDFScheme{Scheme: tpm2.KDFAlgorithmNull}}},
+		Unique: &tpm2.PublicIDU{ECC: &tpm2.ECCPoint{X: make(tpm2.ECCParameter, 32), Y: make(tpm2.ECCParameter, 32)}}}
+}
+
+// TestCA is a certificate authority for issuing EK certificates in tests.
+type TestCA struct {
+	Cert *x509.Certificate
+	Key  crypto.Signer
+}
+
+// NewTestCA creates a new self-signed certificate authority with an ECDSA P256 key.
+func NewTestCA() (*TestCA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot generate key: %w", err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"go-tpm2"}, CommonName: "Test EK CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, key.Public(), key)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot create certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot parse certificate: %w", err)
+	}
+	return &TestCA{Cert: cert, Key: key}, nil
+}
+
+func publicKeyFromPublic(pub *tpm2.Public) (crypto.PublicKey, error) {
+	switch pub.Type {
+	case tpm2.ObjectTypeRSA:
+		exp := int(pub.Params.RSADetail.Exponent)
+		if exp == 0 {
+			exp = tpm2.DefaultRSAExponent
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(pub.Unique.RSA), E: exp}, nil
+	case tpm2.ObjectTypeECC:
+		curve := pub.Params.ECCDetail.CurveID.GoCurve()
+		if curve == nil {
+			return nil, errors.New("unsupported curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(pub.Unique.ECC.X), Y: new(big.Int).SetBytes(pub.Unique.ECC.Y)}, nil
+	default:
+		return nil, errors.New("unsupported object type")
+	}
+}
+
+// IssueEKCertificate issues a DER encoded EK certificate for the supplied EK public area.
+func (ca *TestCA) IssueEKCertificate(ekPublic *tpm2.Public) ([]byte, error) {
+	key, err := publicKeyFromPublic(ekPublic)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot obtain public key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, xerrors.Errorf("cannot generate serial number: %w", err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "Test EK"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageKeyEncipherment,
+		UnknownExtKeyUsage:    []asn1.ObjectIdentifier{oidTcgKpEKCertificate},
+		BasicConstraintsValid: true,
+		IsCA:                  false}
+	if ekPublic.Type == tpm2.ObjectTypeECC {
+		template.KeyUsage = x509.KeyUsageKeyAgreement
+	}
+
+	return x509.CreateCertificate(rand.Reader, &template, ca.Cert, key, ca.Key)
+}
+
+func writeEKCertificate(tpm *tpm2.TPMContext, index tpm2.Handle, cert []byte) error {
+	if existing, err := tpm.CreateResourceContextFromTPM(index); err == nil {
+		if err := tpm.NVUndefineSpace(tpm.PlatformHandleContext(), existing, nil); err != nil {
+			return xerrors.Errorf("cannot undefine existing index: %w", err)
+		}
+	} else if !tpm2.IsResourceUnavailableError(err, index) {
+		return err
+	}
+
+	nvPub := tpm2.NVPublic{
+		Index:   index,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs: tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVPPWrite | tpm2.AttrNVWriteDefine | tpm2.AttrNVPPRead | tpm2.AttrNVOwnerRead |
+			tpm2.AttrNVAuthRead | tpm2.AttrNVNoDA | tpm2.AttrNVPlatformCreate),
+		Size: uint16(len(cert))}
+	rc, err := tpm.NVDefineSpace(tpm.PlatformHandleContext(), nil, &nvPub, nil)
+	if err != nil {
+		return xerrors.Errorf("cannot define index: %w", err)
+	}
+	if err := tpm.NVWrite(tpm.PlatformHandleContext(), rc, cert, 0, nil); err != nil {
+		return xerrors.Errorf("cannot write certificate: %w", err)
+	}
+	return nil
+}
+
+// InjectEKCertificates creates the default RSA and ECC EKs on the TPM associated with the supplied context, issues certificates
+// for them with the supplied CA, and writes the certificates to the standard NV indices (RSAEKCertNVIndex and ECCEKCertNVIndex),
+// replacing any existing certificates. The EKs are flushed afterwards, as they can be recreated from the templates returned from
+// MakeRSAEKTemplate and MakeECCEKTemplate.
+//
+// This requires the use of the platform hierarchy, and is intended for use with a TPM simulator so that attestation flows can be
+// tested end to end.
+func InjectEKCertificates(tpm *tpm2.TPMContext, ca *TestCA) error {
+	for _, ek := range []struct {
+		template *tpm2.Public
+		index    tpm2.Handle
+	}{
+		{template: MakeRSAEKTemplate(), index: RSAEKCertNVIndex},
+		{template: MakeECCEKTemplate(), index: ECCEKCertNVIndex},
+	} {
+		rc, pub, _, _, _, err := tpm.CreatePrimary(tpm.EndorsementHandleContext(), nil, ek.template, nil, nil, nil)
+		if err != nil {
+			return xerrors.Errorf("cannot create %v EK: %w", ek.template.Type, err)
+		}
+		tpm.FlushContext(rc)
+
+		cert, err := ca.IssueEKCertificate(pub)
+		if err != nil {
+			return xerrors.Errorf("cannot issue %v EK certificate: %w", ek.template.Type, err)
+		}
+		if err := writeEKCertificate(tpm, ek.index, cert); err != nil {
+			return xerrors.Errorf("cannot write %v EK certificate: %w", ek.template.Type, err)
+		}
+	}
+
+	return nil
+}
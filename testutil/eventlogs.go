@@ -0,0 +1,140 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package testutil
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/canonical/go-tpm2"
+
+	"golang.org/x/xerrors"
+)
+
+// EventLogFixture corresponds to a sample TCG PC Client firmware event log in the crypto-agile format, along with the PCR values
+// that are obtained by replaying it. The logs are synthetic but are modelled on those produced by common UEFI firmware
+// implementations, and contain digests for the SHA-1 and SHA-256 PCR banks. They are generated by
+// testdata/eventlogs/generate.go.
+type EventLogFixture struct {
+	Name        string // The name of this fixture
+	Description string // A description of the boot sequence recorded in the log
+	Path        string // The path of the binary event log
+
+	// ExpectedPCRs contains the value of every PCR measured to in the log, for each bank.
+	ExpectedPCRs tpm2.PCRValues
+}
+
+// Data returns the contents of the binary event log.
+func (f *EventLogFixture) Data() ([]byte, error) {
+	return ioutil.ReadFile(f.Path)
+}
+
+var eventLogBanks = map[string]tpm2.HashAlgorithmId{
+	"sha1":   tpm2.HashAlgorithmSHA1,
+	"sha256": tpm2.HashAlgorithmSHA256}
+
+func eventLogFixturesDir() (string, error) {
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		return "", errors.New("cannot determine source directory")
+	}
+	return filepath.Join(filepath.Dir(file), "testdata", "eventlogs"), nil
+}
+
+func readEventLogFixture(dir, name string) (*EventLogFixture, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, name+".json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var expected struct {
+		Description string
+		PCRs        map[string]map[string]string
+	}
+	if err := json.Unmarshal(data, &expected); err != nil {
+		return nil, xerrors.Errorf("cannot decode expected values: %w", err)
+	}
+
+	fixture := &EventLogFixture{
+		Name:         name,
+		Description:  expected.Description,
+		Path:         filepath.Join(dir, name+".bin"),
+		ExpectedPCRs: make(tpm2.PCRValues)}
+	for bank, values := range expected.PCRs {
+		alg, ok := eventLogBanks[bank]
+		if !ok {
+			return nil, fmt.Errorf("unrecognized PCR bank %q", bank)
+		}
+		for index, value := range values {
+			pcr, err := strconv.Atoi(index)
+			if err != nil {
+				return nil, xerrors.Errorf("invalid PCR index %q: %w", index, err)
+			}
+			digest, err := hex.DecodeString(value)
+			if err != nil {
+				return nil, xerrors.Errorf("invalid value for PCR %d in bank %s: %w", pcr, bank, err)
+			}
+			if len(digest) != alg.Size() {
+				return nil, fmt.Errorf("invalid value for PCR %d in bank %s: incorrect length", pcr, bank)
+			}
+			fixture.ExpectedPCRs.SetValue(alg, pcr, digest)
+		}
+	}
+
+	return fixture, nil
+}
+
+// EventLogFixtures returns all of the sample event logs, sorted by name.
+func EventLogFixtures() ([]*EventLogFixture, error) {
+	dir, err := eventLogFixturesDir()
+	if err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, fi := range files {
+		if filepath.Ext(fi.Name()) != ".json" {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(fi.Name(), ".json"))
+	}
+	sort.Strings(names)
+
+	var fixtures []*EventLogFixture
+	for _, name := range names {
+		fixture, err := readEventLogFixture(dir, name)
+		if err != nil {
+			return nil, xerrors.Errorf("cannot read fixture %s: %w", name, err)
+		}
+		fixtures = append(fixtures, fixture)
+	}
+	return fixtures, nil
+}
+
+// GetEventLogFixture returns the sample event log with the specified name. If there isn't one, an error that can be tested
+// for with os.IsNotExist is returned.
+func GetEventLogFixture(name string) (*EventLogFixture, error) {
+	dir, err := eventLogFixturesDir()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(dir, name+".bin")); err != nil {
+		return nil, err
+	}
+	return readEventLogFixture(dir, name)
+}
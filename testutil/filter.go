@@ -21,7 +21,9 @@ func commandMayModifyPersistentStorage(command tpm2.CommandCode) bool {
 		return true
 	case tpm2.CommandEvictControl:
 		return true
-	case tpm2.CommandClear:
+	case tpm2.CommandClear, tpm2.CommandChangeEPS, tpm2.CommandChangePPS:
+		return true
+	case tpm2.CommandPCRAllocate:
 		return true
 	default:
 		return false
@@ -42,6 +44,8 @@ var numberOfCommandAuthHandles = map[tpm2.CommandCode]int{
 	tpm2.CommandEvictControl:               2,
 	tpm2.CommandHierarchyControl:           1,
 	tpm2.CommandNVUndefineSpace:            1, // 2 handles total
+	tpm2.CommandChangeEPS:                  1,
+	tpm2.CommandChangePPS:                  1,
 	tpm2.CommandClear:                      1,
 	tpm2.CommandClearControl:               1,
 	tpm2.CommandHierarchyChangeAuth:        1,
@@ -57,6 +61,7 @@ var numberOfCommandAuthHandles = map[tpm2.CommandCode]int{
 	tpm2.CommandDictionaryAttackLockReset:  1,
 	tpm2.CommandDictionaryAttackParameters: 1,
 	tpm2.CommandNVChangeAuth:               1,
+	tpm2.CommandPCRAllocate:                1,
 	tpm2.CommandPCREvent:                   1,
 	tpm2.CommandPCRReset:                   1,
 	tpm2.CommandSequenceComplete:           1,
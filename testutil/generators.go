@@ -0,0 +1,246 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package testutil
+
+import (
+	"math/rand"
+	"reflect"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+)
+
+var generatorHashAlgs = []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA1, tpm2.HashAlgorithmSHA256, tpm2.HashAlgorithmSHA384, tpm2.HashAlgorithmSHA512}
+
+func randomBytes(r *rand.Rand, n int) []byte {
+	b := make([]byte, n)
+	r.Read(b)
+	return b
+}
+
+func randomHashAlg(r *rand.Rand) tpm2.HashAlgorithmId {
+	return generatorHashAlgs[r.Intn(len(generatorHashAlgs))]
+}
+
+func randomDigest(r *rand.Rand, alg tpm2.HashAlgorithmId) tpm2.Digest {
+	return randomBytes(r, alg.Size())
+}
+
+func randomName(r *rand.Rand) tpm2.Name {
+	alg := randomHashAlg(r)
+	name, err := mu.MarshalToBytes(alg, mu.RawBytes(randomDigest(r, alg)))
+	if err != nil {
+		panic(err)
+	}
+	return name
+}
+
+func randomAuthPolicy(r *rand.Rand, alg tpm2.HashAlgorithmId) tpm2.Digest {
+	if r.Intn(2) == 0 {
+		return nil
+	}
+	return randomDigest(r, alg)
+}
+
+var aes128CFB = tpm2.SymDefObject{
+	Algorithm: tpm2.SymObjectAlgorithmAES,
+	KeyBits:   &tpm2.SymKeyBitsU{Sym: 128},
+	Mode:      &tpm2.SymModeU{Sym: tpm2.SymModeCFB}}
+
+// GeneratePublic returns a randomly generated public area that is structurally valid, with a random object type, name algorithm,
+// authorization policy and unique field. The attributes and parameters are consistent with one of a storage key, a signing key,
+// a sealed data object, a HMAC key or a symmetric cipher key.
+func GeneratePublic(r *rand.Rand) *tpm2.Public {
+	pub := &tpm2.Public{
+		NameAlg: randomHashAlg(r),
+		Attrs:   tpm2.AttrFixedTPM | tpm2.AttrFixedParent | tpm2.AttrUserWithAuth}
+	pub.AuthPolicy = randomAuthPolicy(r, pub.NameAlg)
+
+	switch r.Intn(5) {
+	case 0:
+		pub.Type = tpm2.ObjectTypeRSA
+		pub.Attrs |= tpm2.AttrSensitiveDataOrigin
+		params := &tpm2.RSAParams{KeyBits: 2048}
+		if r.Intn(2) == 0 {
+			pub.Attrs |= tpm2.AttrRestricted | tpm2.AttrDecrypt
+			params.Symmetric = aes128CFB
+			params.Scheme = tpm2.RSAScheme{Scheme: tpm2.RSASchemeNull}
+		} else {
+			pub.Attrs |= tpm2.AttrSign
+			params.Symmetric = tpm2.SymDefObject{Algorithm: tpm2.SymObjectAlgorithmNull}
+			params.Scheme = tpm2.RSAScheme{
+				Scheme:  tpm2.RSASchemeRSASSA,
+				Details: &tpm2.AsymSchemeU{RSASSA: &tpm2.SigSchemeRSASSA{HashAlg: randomHashAlg(r)}}}
+		}
+		pub.Params = &tpm2.PublicParamsU{RSADetail: params}
+		pub.Unique = &tpm2.PublicIDU{RSA: randomBytes(r, 256)}
+	case 1:
+		pub.Type = tpm2.ObjectTypeECC
+		pub.Attrs |= tpm2.AttrSensitiveDataOrigin | tpm2.AttrSign
+		pub.Params = &tpm2.PublicParamsU{
+			ECCDetail: &tpm2.ECCParams{
+				Symmetric: tpm2.SymDefObject{Algorithm: tpm2.SymObjectAlgorithmNull},
+				Scheme: tpm2.ECCScheme{
+					Scheme:  tpm2.ECCSchemeECDSA,
+					Details: &tpm2.AsymSchemeU{ECDSA: &tpm2.SigSchemeECDSA{HashAlg: randomHashAlg(r)}}},
+				CurveID: tpm2.ECCCurveNIST_P256,
+				KDF:     tpm2.KDFScheme{Scheme: tpm2.KDFAlgorithmNull}}}
+		pub.Unique = &tpm2.PublicIDU{ECC: &tpm2.ECCPoint{X: randomBytes(r, 32), Y: randomBytes(r, 32)}}
+	case 2:
+		pub.Type = tpm2.ObjectTypeKeyedHash
+		pub.Params = &tpm2.PublicParamsU{
+			KeyedHashDetail: &tpm2.KeyedHashParams{Scheme: tpm2.KeyedHashScheme{Scheme: tpm2.KeyedHashSchemeNull}}}
+		pub.Unique = &tpm2.PublicIDU{KeyedHash: randomDigest(r, pub.NameAlg)}
+	case 3:
+		pub.Type = tpm2.ObjectTypeKeyedHash
+		pub.Attrs |= tpm2.AttrSensitiveDataOrigin | tpm2.AttrSign
+		pub.Params = &tpm2.PublicParamsU{
+			KeyedHashDetail: &tpm2.KeyedHashParams{
+				Scheme: tpm2.KeyedHashScheme{
+					Scheme:  tpm2.KeyedHashSchemeHMAC,
+					Details: &tpm2.SchemeKeyedHashU{HMAC: &tpm2.SchemeHMAC{HashAlg: randomHashAlg(r)}}}}}
+		pub.Unique = &tpm2.PublicIDU{KeyedHash: randomDigest(r, pub.NameAlg)}
+	case 4:
+		pub.Type = tpm2.ObjectTypeSymCipher
+		pub.Attrs |= tpm2.AttrSensitiveDataOrigin | tpm2.AttrDecrypt | tpm2.AttrSign
+		pub.Params = &tpm2.PublicParamsU{SymDetail: &tpm2.SymCipherParams{Sym: aes128CFB}}
+		pub.Unique = &tpm2.PublicIDU{Sym: randomDigest(r, pub.NameAlg)}
+	}
+
+	return pub
+}
+
+// GenerateNVPublic returns a randomly generated public area for a NV index in the owner range, with a random type, name
+// algorithm, authorization policy and a consistent set of attributes and size.
+func GenerateNVPublic(r *rand.Rand) *tpm2.NVPublic {
+	pub := &tpm2.NVPublic{
+		Index:   tpm2.Handle(0x01000000 | r.Intn(0x400000)),
+		NameAlg: randomHashAlg(r)}
+	pub.AuthPolicy = randomAuthPolicy(r, pub.NameAlg)
+
+	attrs := tpm2.AttrNVOwnerWrite | tpm2.AttrNVOwnerRead
+	if r.Intn(2) == 0 {
+		attrs |= tpm2.AttrNVAuthWrite | tpm2.AttrNVAuthRead
+	}
+	if len(pub.AuthPolicy) > 0 {
+		attrs |= tpm2.AttrNVPolicyWrite | tpm2.AttrNVPolicyRead
+	}
+	if r.Intn(2) == 0 {
+		attrs |= tpm2.AttrNVNoDA
+	}
+	if r.Intn(2) == 0 {
+		attrs |= tpm2.AttrNVWritten
+	}
+
+	switch r.Intn(4) {
+	case 0:
+		pub.Attrs = tpm2.NVTypeOrdinary.WithAttrs(attrs)
+		pub.Size = uint16(1 + r.Intn(1024))
+	case 1:
+		pub.Attrs = tpm2.NVTypeCounter.WithAttrs(attrs)
+		pub.Size = 8
+	case 2:
+		pub.Attrs = tpm2.NVTypeBits.WithAttrs(attrs)
+		pub.Size = 8
+	case 3:
+		pub.Attrs = tpm2.NVTypeExtend.WithAttrs(attrs)
+		pub.Size = uint16(randomHashAlg(r).Size())
+	}
+
+	return pub
+}
+
+// GeneratePCRSelectionList returns a randomly generated PCR selection list, with up to one selection for each of the supported
+// digest algorithms. Each selection selects a random subset of PCRs 0-23, and may be empty.
+func GeneratePCRSelectionList(r *rand.Rand) tpm2.PCRSelectionList {
+	var list tpm2.PCRSelectionList
+	for _, alg := range generatorHashAlgs {
+		if r.Intn(2) == 0 {
+			continue
+		}
+		s := tpm2.PCRSelection{Hash: alg, Select: tpm2.PCRSelect{}}
+		for i := 0; i < 24; i++ {
+			if r.Intn(3) == 0 {
+				s.Select = append(s.Select, i)
+			}
+		}
+		list = append(list, s)
+	}
+	return list
+}
+
+// GenerateTrialAuthPolicy returns a TrialAuthPolicy for the specified digest algorithm, to which a random sequence of between 1
+// and 8 policy assertions with random arguments has been applied.
+func GenerateTrialAuthPolicy(r *rand.Rand, alg tpm2.HashAlgorithmId) *tpm2.TrialAuthPolicy {
+	policy, err := tpm2.ComputeAuthPolicy(alg)
+	if err != nil {
+		panic(err)
+	}
+
+	n := 1 + r.Intn(8)
+	for i := 0; i < n; i++ {
+		switch r.Intn(12) {
+		case 0:
+			policy.PolicySigned(randomName(r), randomBytes(r, r.Intn(16)))
+		case 1:
+			policy.PolicySecret(randomName(r), randomBytes(r, r.Intn(16)))
+		case 2:
+			digests := make(tpm2.DigestList, 2+r.Intn(7))
+			for j := range digests {
+				digests[j] = randomDigest(r, alg)
+			}
+			if err := policy.PolicyOR(digests); err != nil {
+				panic(err)
+			}
+		case 3:
+			policy.PolicyPCR(randomDigest(r, alg), GeneratePCRSelectionList(r))
+		case 4:
+			policy.PolicyNV(randomName(r), randomBytes(r, 1+r.Intn(8)), uint16(r.Intn(64)), tpm2.ArithmeticOp(r.Intn(int(tpm2.OpBitclear)+1)))
+		case 5:
+			policy.PolicyCounterTimer(randomBytes(r, 8), uint16(r.Intn(16)), tpm2.ArithmeticOp(r.Intn(int(tpm2.OpBitclear)+1)))
+		case 6:
+			policy.PolicyCommandCode(tpm2.CommandCode(uint32(tpm2.CommandFirst) + uint32(r.Intn(0x80))))
+		case 7:
+			policy.PolicyCpHash(randomDigest(r, alg))
+		case 8:
+			policy.PolicyAuthorize(randomBytes(r, r.Intn(16)), randomName(r))
+		case 9:
+			policy.PolicyAuthValue()
+		case 10:
+			policy.PolicyPassword()
+		case 11:
+			policy.PolicyNvWritten(r.Intn(2) == 0)
+		}
+	}
+
+	return policy
+}
+
+// QuickPublic implements quick.Generator for producing random public areas with GeneratePublic.
+type QuickPublic struct {
+	*tpm2.Public
+}
+
+func (QuickPublic) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(QuickPublic{GeneratePublic(r)})
+}
+
+// QuickNVPublic implements quick.Generator for producing random NV index public areas with GenerateNVPublic.
+type QuickNVPublic struct {
+	*tpm2.NVPublic
+}
+
+func (QuickNVPublic) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(QuickNVPublic{GenerateNVPublic(r)})
+}
+
+// QuickPCRSelectionList implements quick.Generator for producing random PCR selection lists with GeneratePCRSelectionList.
+type QuickPCRSelectionList struct {
+	tpm2.PCRSelectionList
+}
+
+func (QuickPCRSelectionList) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(QuickPCRSelectionList{GeneratePCRSelectionList(r)})
+}
@@ -0,0 +1,168 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package testutil
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/canonical/go-tpm2"
+
+	"golang.org/x/xerrors"
+
+	. "gopkg.in/check.v1"
+)
+
+// UpdateGoldenTranscripts indicates that CheckGoldenTranscript should overwrite golden transcripts with the transcript from the
+// current test run rather than comparing against them.
+var UpdateGoldenTranscripts bool
+
+// TranscriptIgnoreRules describes the parts of a transcript that are ignored by CompareTranscripts. These are typically parts of
+// commands that are expected to differ between test runs.
+type TranscriptIgnoreRules struct {
+	// Nonces indicates that session nonces and HMACs should be ignored.
+	Nonces bool
+
+	// Handles indicates that the values of transient object handles and session handles should be ignored.
+	Handles bool
+
+	// Params is a list of command codes for which the command parameters should be ignored, such as commands which are expected
+	// to have randomly generated parameters.
+	Params []tpm2.CommandCode
+
+	// ResponseParams indicates that the response parameters should be ignored. Response codes are always compared.
+	ResponseParams bool
+}
+
+func (r *TranscriptIgnoreRules) ignoreParams(code tpm2.CommandCode) bool {
+	for _, c := range r.Params {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *TranscriptIgnoreRules) compareHandles(obtained, expected tpm2.Handle) bool {
+	if r.Handles {
+		switch obtained.Type() {
+		case tpm2.HandleTypeTransient, tpm2.HandleTypeHMACSession, tpm2.HandleTypePolicySession:
+			return obtained.Type() == expected.Type()
+		}
+	}
+	return obtained == expected
+}
+
+func (r *TranscriptIgnoreRules) compareAuthAreas(obtained, expected []tpm2.TranscriptAuth, command bool) error {
+	if len(obtained) != len(expected) {
+		return fmt.Errorf("unexpected number of authorizations %d (expected %d)", len(obtained), len(expected))
+	}
+	for i := range obtained {
+		o, e := obtained[i], expected[i]
+		if command && !r.compareHandles(o.SessionHandle, e.SessionHandle) {
+			return fmt.Errorf("unexpected session handle for authorization %d: 0x%08x (expected 0x%08x)", i, o.SessionHandle, e.SessionHandle)
+		}
+		if o.Attrs != e.Attrs {
+			return fmt.Errorf("unexpected session attributes for authorization %d: 0x%02x (expected 0x%02x)", i, o.Attrs, e.Attrs)
+		}
+		if r.Nonces {
+			continue
+		}
+		if !bytes.Equal(o.Nonce, e.Nonce) {
+			return fmt.Errorf("unexpected nonce for authorization %d", i)
+		}
+		if !bytes.Equal(o.HMAC, e.HMAC) {
+			return fmt.Errorf("unexpected HMAC for authorization %d", i)
+		}
+	}
+	return nil
+}
+
+func (r *TranscriptIgnoreRules) compareEntries(obtained, expected *tpm2.TranscriptEntry) error {
+	oc, or, err := obtained.Decode()
+	if err != nil {
+		return xerrors.Errorf("cannot decode obtained exchange: %w", err)
+	}
+	ec, er, err := expected.Decode()
+	if err != nil {
+		return xerrors.Errorf("cannot decode expected exchange: %w", err)
+	}
+
+	if oc.CommandCode != ec.CommandCode {
+		return fmt.Errorf("unexpected command %v (expected %v)", oc.CommandCode, ec.CommandCode)
+	}
+	if oc.Tag != ec.Tag {
+		return fmt.Errorf("unexpected command tag %v (expected %v)", oc.Tag, ec.Tag)
+	}
+	if len(oc.Handles) != len(ec.Handles) {
+		return fmt.Errorf("unexpected number of command handles %d (expected %d)", len(oc.Handles), len(ec.Handles))
+	}
+	for i := range oc.Handles {
+		if !r.compareHandles(oc.Handles[i], ec.Handles[i]) {
+			return fmt.Errorf("unexpected command handle %d: 0x%08x (expected 0x%08x)", i, oc.Handles[i], ec.Handles[i])
+		}
+	}
+	if err := r.compareAuthAreas(oc.AuthArea, ec.AuthArea, true); err != nil {
+		return xerrors.Errorf("command: %w", err)
+	}
+	if !r.ignoreParams(oc.CommandCode) && !bytes.Equal(oc.Params, ec.Params) {
+		return fmt.Errorf("unexpected command parameters %x (expected %x)", oc.Params, ec.Params)
+	}
+
+	if or.ResponseCode != er.ResponseCode {
+		return fmt.Errorf("unexpected response code 0x%08x (expected 0x%08x)", or.ResponseCode, er.ResponseCode)
+	}
+	if !r.compareHandles(or.Handle, er.Handle) {
+		return fmt.Errorf("unexpected response handle 0x%08x (expected 0x%08x)", or.Handle, er.Handle)
+	}
+	if err := r.compareAuthAreas(or.AuthArea, er.AuthArea, false); err != nil {
+		return xerrors.Errorf("response: %w", err)
+	}
+	if !r.ResponseParams && !bytes.Equal(or.Params, er.Params) {
+		return fmt.Errorf("unexpected response parameters %x (expected %x)", or.Params, er.Params)
+	}
+
+	return nil
+}
+
+// CompareTranscripts compares the obtained transcript against the expected one, ignoring the parts specified by rules. It returns
+// an error describing the first difference. If rules is nil, the transcripts must be identical.
+func CompareTranscripts(obtained, expected []*tpm2.TranscriptEntry, rules *TranscriptIgnoreRules) error {
+	if rules == nil {
+		rules = &TranscriptIgnoreRules{}
+	}
+
+	for i := 0; i < len(obtained) && i < len(expected); i++ {
+		if err := rules.compareEntries(obtained[i], expected[i]); err != nil {
+			return xerrors.Errorf("exchange %d: %w", i, err)
+		}
+	}
+	if len(obtained) != len(expected) {
+		return fmt.Errorf("unexpected number of exchanges %d (expected %d)", len(obtained), len(expected))
+	}
+	return nil
+}
+
+// CheckGoldenTranscript compares the supplied transcript file contents against the golden transcript stored at path, using the
+// specified rules. If UpdateGoldenTranscripts is true, the golden transcript is written instead.
+func CheckGoldenTranscript(c *C, path string, transcript []byte, rules *TranscriptIgnoreRules) {
+	if UpdateGoldenTranscripts {
+		c.Assert(ioutil.WriteFile(path, transcript, 0644), IsNil)
+		return
+	}
+
+	golden, err := os.Open(path)
+	c.Assert(err, IsNil)
+	defer golden.Close()
+
+	expected, err := tpm2.ReadTranscript(golden)
+	c.Assert(err, IsNil)
+	obtained, err := tpm2.ReadTranscript(bytes.NewReader(transcript))
+	c.Assert(err, IsNil)
+
+	c.Check(CompareTranscripts(obtained, expected, rules), IsNil)
+}
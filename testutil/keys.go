@@ -0,0 +1,121 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package testutil
+
+import (
+	"github.com/canonical/go-tpm2"
+
+	"golang.org/x/xerrors"
+)
+
+// MakeRSASRKTemplate returns the template for a RSA 2048 storage root key in the storage hierarchy, as defined by the TCG TPM v2.0
+// Provisioning Guidance specification.
+func MakeRSASRKTemplate() *tpm2.Public {
+	return &tpm2.Public{
+		Type:    tpm2.ObjectTypeRSA,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs: tpm2.AttrFixedTPM | tpm2.AttrFixedParent | tpm2.AttrSensitiveDataOrigin | tpm2.AttrUserWithAuth | tpm2.AttrNoDA |
+			tpm2.AttrRestricted | tpm2.AttrDecrypt,
+		Params: &tpm2.PublicParamsU{
+			RSADetail: &tpm2.RSAParams{
+				Symmetric: aes128CFB,
+				Scheme:    tpm2.RSAScheme{Scheme: tpm2.RSASchemeNull},
+				KeyBits:   2048,
+				Exponent:  0}}}
+}
+
+// MakeECCSRKTemplate returns the template for a ECC NIST P256 storage root key in the storage hierarchy, as defined by the TCG TPM
+// v2.0 Provisioning Guidance specification.
+func MakeECCSRKTemplate() *tpm2.Public {
+	return &tpm2.Public{
+		Type:    tpm2.ObjectTypeECC,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs: tpm2.AttrFixedTPM | tpm2.AttrFixedParent | tpm2.AttrSensitiveDataOrigin | tpm2.AttrUserWithAuth | tpm2.AttrNoDA |
+			tpm2.AttrRestricted | tpm2.AttrDecrypt,
+		Params: &tpm2.PublicParamsU{
+			ECCDetail: &tpm2.ECCParams{
+				Symmetric: aes128CFB,
+				Scheme:    tpm2.ECCScheme{Scheme: tpm2.ECCSchemeNull},
+				CurveID:   tpm2.ECCCurveNIST_P256,
+				KDF:       tpm2.KDFScheme{Scheme: tpm2.KDFAlgorithmNull}}}}
+}
+
+// MakeRSASigningKeyTemplate returns the template for an unrestricted RSA 2048 signing key that uses RSASSA-PKCS1-v1_5 with
+// SHA-256.
+func MakeRSASigningKeyTemplate() *tpm2.Public {
+	return &tpm2.Public{
+		Type:    tpm2.ObjectTypeRSA,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.AttrFixedTPM | tpm2.AttrFixedParent | tpm2.AttrSensitiveDataOrigin | tpm2.AttrUserWithAuth | tpm2.AttrSign,
+		Params: &tpm2.PublicParamsU{
+			RSADetail: &tpm2.RSAParams{
+				Symmetric: tpm2.SymDefObject{Algorithm: tpm2.SymObjectAlgorithmNull},
+				Scheme: tpm2.RSAScheme{
+					Scheme:  tpm2.RSASchemeRSASSA,
+					Details: &tpm2.AsymSchemeU{RSASSA: &tpm2.SigSchemeRSASSA{HashAlg: tpm2.HashAlgorithmSHA256}}},
+				KeyBits:  2048,
+				Exponent: 0}}}
+}
+
+// MakeECCSigningKeyTemplate returns the template for an unrestricted ECC NIST P256 signing key that uses ECDSA with SHA-256.
+func MakeECCSigningKeyTemplate() *tpm2.Public {
+	return &tpm2.Public{
+		Type:    tpm2.ObjectTypeECC,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.AttrFixedTPM | tpm2.AttrFixedParent | tpm2.AttrSensitiveDataOrigin | tpm2.AttrUserWithAuth | tpm2.AttrSign,
+		Params: &tpm2.PublicParamsU{
+			ECCDetail: &tpm2.ECCParams{
+				Symmetric: tpm2.SymDefObject{Algorithm: tpm2.SymObjectAlgorithmNull},
+				Scheme: tpm2.ECCScheme{
+					Scheme:  tpm2.ECCSchemeECDSA,
+					Details: &tpm2.AsymSchemeU{ECDSA: &tpm2.SigSchemeECDSA{HashAlg: tpm2.HashAlgorithmSHA256}}},
+				CurveID: tpm2.ECCCurveNIST_P256,
+				KDF:     tpm2.KDFScheme{Scheme: tpm2.KDFAlgorithmNull}}}}
+}
+
+func createPrimary(tpm *tpm2.TPMContext, template *tpm2.Public) (tpm2.ResourceContext, error) {
+	rc, _, _, _, _, err := tpm.CreatePrimary(tpm.OwnerHandleContext(), nil, template, nil, nil, nil)
+	return rc, err
+}
+
+func createAndLoad(tpm *tpm2.TPMContext, parent tpm2.ResourceContext, template *tpm2.Public) (tpm2.ResourceContext, error) {
+	priv, pub, _, _, _, err := tpm.Create(parent, nil, template, nil, nil, nil)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot create key: %w", err)
+	}
+	rc, err := tpm.Load(parent, priv, pub, nil)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot load key: %w", err)
+	}
+	return rc, nil
+}
+
+// CreatePrimaryRSASRK creates a RSA storage root key in the storage hierarchy from the template returned by MakeRSASRKTemplate.
+// The authorization value for the storage hierarchy must be set on its ResourceContext if it isn't empty. The caller is
+// responsible for flushing the returned key.
+func CreatePrimaryRSASRK(tpm *tpm2.TPMContext) (tpm2.ResourceContext, error) {
+	return createPrimary(tpm, MakeRSASRKTemplate())
+}
+
+// CreatePrimaryECCSRK creates an ECC storage root key in the storage hierarchy from the template returned by MakeECCSRKTemplate.
+// The authorization value for the storage hierarchy must be set on its ResourceContext if it isn't empty. The caller is
+// responsible for flushing the returned key.
+func CreatePrimaryECCSRK(tpm *tpm2.TPMContext) (tpm2.ResourceContext, error) {
+	return createPrimary(tpm, MakeECCSRKTemplate())
+}
+
+// CreateRSASigningKey creates a RSA signing key from the template returned by MakeRSASigningKeyTemplate as a child of the
+// supplied storage key, and loads it in to the TPM. The key has an empty authorization value. The caller is responsible for
+// flushing the returned key.
+func CreateRSASigningKey(tpm *tpm2.TPMContext, parent tpm2.ResourceContext) (tpm2.ResourceContext, error) {
+	return createAndLoad(tpm, parent, MakeRSASigningKeyTemplate())
+}
+
+// CreateECCSigningKey creates an ECC signing key from the template returned by MakeECCSigningKeyTemplate as a child of the
+// supplied storage key, and loads it in to the TPM. The key has an empty authorization value. The caller is responsible for
+// flushing the returned key.
+func CreateECCSigningKey(tpm *tpm2.TPMContext, parent tpm2.ResourceContext) (tpm2.ResourceContext, error) {
+	return createAndLoad(tpm, parent, MakeECCSigningKeyTemplate())
+}
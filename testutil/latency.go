@@ -0,0 +1,144 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package testutil
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/canonical/go-tpm2"
+)
+
+var errLatencyTCTIClosed = errors.New("TCTI is closed")
+
+type latencyResult struct {
+	data []byte
+	n    int
+	err  error
+}
+
+type latencyOp struct {
+	data []byte
+	done chan latencyResult
+}
+
+// LatencyTCTI wraps another TCTI, and injects latency in to the exchange of commands and responses in order to simulate a slow
+// TPM. Reads and writes are performed on the wrapped TCTI from separate goroutines rather than from the caller's goroutine, so that
+// tests run with the race detector can check that the package doesn't rely on commands and responses being exchanged on a single
+// goroutine, and that state shared with other goroutines (such as tpm2.Stats) is accessed safely whilst commands are in flight.
+//
+// Close unblocks any pending Read or Write calls, which return an error.
+type LatencyTCTI struct {
+	tcti         tpm2.TCTI
+	writeLatency time.Duration
+	readLatency  time.Duration
+
+	writes    chan *latencyOp
+	reads     chan *latencyOp
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mu      sync.Mutex
+	readyAt time.Time
+}
+
+// NewLatencyTCTI returns a new LatencyTCTI that wraps tcti. Each write to tcti is delayed by writeLatency, and the response to
+// each command is not read from tcti until readLatency after the command was written.
+func NewLatencyTCTI(tcti tpm2.TCTI, writeLatency, readLatency time.Duration) *LatencyTCTI {
+	t := &LatencyTCTI{
+		tcti:         tcti,
+		writeLatency: writeLatency,
+		readLatency:  readLatency,
+		writes:       make(chan *latencyOp),
+		reads:        make(chan *latencyOp),
+		closed:       make(chan struct{})}
+	go t.writeLoop()
+	go t.readLoop()
+	return t
+}
+
+func (t *LatencyTCTI) writeLoop() {
+	for {
+		select {
+		case <-t.closed:
+			return
+		case op := <-t.writes:
+			time.Sleep(t.writeLatency)
+			n, err := t.tcti.Write(op.data)
+
+			t.mu.Lock()
+			t.readyAt = time.Now().Add(t.readLatency)
+			t.mu.Unlock()
+
+			op.done <- latencyResult{n: n, err: err}
+		}
+	}
+}
+
+func (t *LatencyTCTI) readLoop() {
+	for {
+		select {
+		case <-t.closed:
+			return
+		case op := <-t.reads:
+			t.mu.Lock()
+			delay := time.Until(t.readyAt)
+			t.mu.Unlock()
+			if delay > 0 {
+				time.Sleep(delay)
+			}
+
+			n, err := t.tcti.Read(op.data)
+			op.done <- latencyResult{data: op.data[:n], n: n, err: err}
+		}
+	}
+}
+
+func (t *LatencyTCTI) submit(ch chan *latencyOp, data []byte) (latencyResult, error) {
+	op := &latencyOp{data: data, done: make(chan latencyResult, 1)}
+	select {
+	case ch <- op:
+	case <-t.closed:
+		return latencyResult{}, errLatencyTCTIClosed
+	}
+	select {
+	case r := <-op.done:
+		return r, nil
+	case <-t.closed:
+		return latencyResult{}, errLatencyTCTIClosed
+	}
+}
+
+func (t *LatencyTCTI) Read(data []byte) (int, error) {
+	// Read in to a private buffer, as the read goroutine may still be using it if Close is called.
+	r, err := t.submit(t.reads, make([]byte, len(data)))
+	if err != nil {
+		return 0, err
+	}
+	return copy(data, r.data), r.err
+}
+
+func (t *LatencyTCTI) Write(data []byte) (int, error) {
+	r, err := t.submit(t.writes, append([]byte(nil), data...))
+	if err != nil {
+		return 0, err
+	}
+	return r.n, r.err
+}
+
+// Close stops the goroutines used for reading and writing, and closes the wrapped TCTI.
+func (t *LatencyTCTI) Close() error {
+	t.closeOnce.Do(func() { close(t.closed) })
+	return t.tcti.Close()
+}
+
+func (t *LatencyTCTI) SetLocality(locality uint8) error {
+	return t.tcti.SetLocality(locality)
+}
+
+func (t *LatencyTCTI) MakeSticky(handle tpm2.Handle, sticky bool) error {
+	return t.tcti.MakeSticky(handle, sticky)
+}
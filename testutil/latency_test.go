@@ -0,0 +1,75 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package testutil
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/canonical/go-tpm2"
+)
+
+func TestLatencyTCTI(t *testing.T) {
+	cmds := []*MockCommand{{
+		CommandCode: tpm2.CommandGetCapability,
+		Response: &MockResponse{Params: []interface{}{false, &tpm2.CapabilityData{
+			Capability: tpm2.CapabilityTPMProperties,
+			Data: &tpm2.CapabilitiesU{TPMProperties: tpm2.TaggedTPMPropertyList{
+				{Property: tpm2.PropertyInputBuffer, Value: 1024},
+				{Property: tpm2.PropertyMaxDigest, Value: 32},
+				{Property: tpm2.PropertyNVBufferMax, Value: 1024}}}}}}}}
+	for i := 0; i < 4; i++ {
+		cmds = append(cmds, &MockCommand{
+			CommandCode: tpm2.CommandGetRandom,
+			Response:    &MockResponse{Params: []interface{}{tpm2.Digest{1, 2, 3, 4}}}})
+	}
+	mock := NewMockTCTI(cmds...)
+	tcti := NewLatencyTCTI(mock, time.Millisecond, 2*time.Millisecond)
+	tpm, _ := tpm2.NewTPMContext(tcti)
+
+	// Read the statistics from another goroutine whilst commands are in flight.
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				tpm.Stats().Commands()
+				time.Sleep(100 * time.Microsecond)
+			}
+		}
+	}()
+
+	for i := 0; i < 4; i++ {
+		if _, err := tpm.GetRandom(4); err != nil {
+			t.Fatalf("GetRandom failed: %v", err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	if err := mock.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+	stats := tpm.Stats().Command(tpm2.CommandGetRandom)
+	if stats.Count != 4 {
+		t.Errorf("Unexpected count: %d", stats.Count)
+	}
+	if stats.AverageDuration() < 2*time.Millisecond {
+		t.Errorf("Latency was not applied (average duration %v)", stats.AverageDuration())
+	}
+
+	if err := tpm.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	if _, err := tcti.Write([]byte{0}); err == nil {
+		t.Errorf("Write after Close should fail")
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package testutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+
+	"golang.org/x/xerrors"
+)
+
+// MockResponse describes a response returned by MockTCTI.
+type MockResponse struct {
+	ResponseCode tpm2.ResponseCode
+
+	// Handle is the response handle, for commands that return one. It is omitted from the response if it is zero.
+	Handle tpm2.Handle
+
+	// Params are the response parameters, which are marshalled with mu.MarshalToBytes.
+	Params []interface{}
+
+	// PasswordSessions is the number of password session authorizations to include in the response. This must match the number
+	// of authorizations in the corresponding command, and must be zero if the command has no authorizations.
+	PasswordSessions int
+}
+
+// Bytes returns the marshalled response.
+func (r *MockResponse) Bytes() ([]byte, error) {
+	if r.ResponseCode != tpm2.Success {
+		return mu.MarshalToBytes(tpm2.TagNoSessions, uint32(10), r.ResponseCode)
+	}
+
+	params, err := mu.MarshalToBytes(r.Params...)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot marshal parameters: %w", err)
+	}
+
+	var payload bytes.Buffer
+	if r.Handle != 0 {
+		if _, err := mu.MarshalToWriter(&payload, r.Handle); err != nil {
+			return nil, err
+		}
+	}
+
+	tag := tpm2.TagNoSessions
+	if r.PasswordSessions > 0 {
+		tag = tpm2.TagSessions
+		if _, err := mu.MarshalToWriter(&payload, uint32(len(params))); err != nil {
+			return nil, err
+		}
+	}
+	payload.Write(params)
+	for i := 0; i < r.PasswordSessions; i++ {
+		// Empty nonce, TPMA_SESSION_CONTINUESESSION and empty HMAC
+		payload.Write([]byte{0x00, 0x00, 0x01, 0x00, 0x00})
+	}
+
+	return mu.MarshalToBytes(tag, uint32(10+payload.Len()), tpm2.Success, mu.RawBytes(payload.Bytes()))
+}
+
+// MockCommand describes a command that is expected by MockTCTI, and the response that should be returned when it is received.
+type MockCommand struct {
+	CommandCode tpm2.CommandCode
+
+	// Handles are the expected command handles. If this is nil, the handles are not checked.
+	Handles []tpm2.Handle
+
+	// Params is an optional function for checking the command parameters, which excludes the handle and authorization areas. As
+	// the number of handles is determined from the length of Handles, Handles must be set when using this with a command that has
+	// handles. Params should return an error if the parameters don't match.
+	Params func(params []byte) error
+
+	// Response is the response to return to the caller.
+	Response *MockResponse
+
+	// RawResponse is returned to the caller instead of Response if it is not nil.
+	RawResponse []byte
+
+	// WriteError is returned from Write instead of a response if it is not nil, in order to simulate a failure of the
+	// transmission interface.
+	WriteError error
+}
+
+func (c *MockCommand) match(cmd []byte) error {
+	r := bytes.NewReader(cmd)
+
+	var h commandHeader
+	if _, err := mu.UnmarshalFromReader(r, &h); err != nil {
+		return xerrors.Errorf("cannot unmarshal command header: %w", err)
+	}
+	if h.CommandCode != c.CommandCode {
+		return fmt.Errorf("unexpected command code %v (expected %v)", h.CommandCode, c.CommandCode)
+	}
+
+	for i, expected := range c.Handles {
+		var handle tpm2.Handle
+		if _, err := mu.UnmarshalFromReader(r, &handle); err != nil {
+			return xerrors.Errorf("cannot unmarshal handle %d: %w", i+1, err)
+		}
+		if handle != expected {
+			return fmt.Errorf("unexpected handle %d: 0x%08x (expected 0x%08x)", i+1, handle, expected)
+		}
+	}
+
+	if c.Params == nil {
+		return nil
+	}
+	if h.Tag == tpm2.TagSessions {
+		var authSize uint32
+		if _, err := mu.UnmarshalFromReader(r, &authSize); err != nil {
+			return xerrors.Errorf("cannot unmarshal authorization area size: %w", err)
+		}
+		if _, err := r.Seek(int64(authSize), io.SeekCurrent); err != nil {
+			return err
+		}
+	}
+
+	params := make([]byte, r.Len())
+	r.Read(params)
+	if err := c.Params(params); err != nil {
+		return xerrors.Errorf("unexpected parameters: %w", err)
+	}
+	return nil
+}
+
+// MockTCTI is a TCTI implementation that doesn't communicate with a TPM, and can be used to unit test code that uses a
+// tpm2.TPMContext without a TPM simulator. It checks each command submitted to it against a script of expected commands, and
+// returns the corresponding canned response. The packets of all submitted commands are recorded, and can be obtained with
+// Commands.
+//
+// If a command doesn't match the next expectation, Write returns an error. Call Done at the end of a test to check that all of the
+// expected commands were submitted.
+//
+// MockTCTI implements tpm2.PipelinedTCTI, but only indicates support for pipelining once EnablePipelining has been called.
+type MockTCTI struct {
+	commands  []*MockCommand
+	next      int
+	submitted [][]byte
+	locality  uint8
+	err       error
+
+	pipelining     bool
+	rsps           []*bytes.Reader
+	maxOutstanding int
+}
+
+// NewMockTCTI returns a new MockTCTI that expects the specified commands to be submitted in order.
+func NewMockTCTI(commands ...*MockCommand) *MockTCTI {
+	return &MockTCTI{commands: commands}
+}
+
+// Expect appends the specified commands to the list of commands that this MockTCTI expects to receive.
+func (t *MockTCTI) Expect(commands ...*MockCommand) {
+	t.commands = append(t.commands, commands...)
+}
+
+// EnablePipelining enables support for pipelining, so that commands can be written before the responses to previous commands have
+// been read.
+func (t *MockTCTI) EnablePipelining() {
+	t.pipelining = true
+}
+
+// SupportsPipelining implements tpm2.PipelinedTCTI.SupportsPipelining.
+func (t *MockTCTI) SupportsPipelining() bool {
+	return t.pipelining
+}
+
+// MaxOutstanding returns the maximum number of responses that were waiting to be read at any one time.
+func (t *MockTCTI) MaxOutstanding() int {
+	return t.maxOutstanding
+}
+
+// Commands returns the packets of the commands submitted to this MockTCTI, in the order in which they were submitted.
+func (t *MockTCTI) Commands() [][]byte {
+	return t.submitted
+}
+
+// Locality returns the locality most recently set with SetLocality.
+func (t *MockTCTI) Locality() uint8 {
+	return t.locality
+}
+
+func (t *MockTCTI) Read(data []byte) (int, error) {
+	if len(t.rsps) == 0 {
+		return 0, io.EOF
+	}
+	n, err := t.rsps[0].Read(data)
+	if t.rsps[0].Len() == 0 {
+		t.rsps = t.rsps[1:]
+	}
+	return n, err
+}
+
+func (t *MockTCTI) Write(data []byte) (int, error) {
+	t.submitted = append(t.submitted, append([]byte(nil), data...))
+	if !t.pipelining {
+		// Discard any response that wasn't read.
+		t.rsps = nil
+	}
+
+	if t.err != nil {
+		return 0, t.err
+	}
+
+	if t.next >= len(t.commands) {
+		t.err = errors.New("unexpected command: no more commands are expected")
+		return 0, t.err
+	}
+	cmd := t.commands[t.next]
+	if err := cmd.match(data); err != nil {
+		t.err = xerrors.Errorf("command %d does not match expectation: %w", t.next+1, err)
+		return 0, t.err
+	}
+	t.next++
+
+	if cmd.WriteError != nil {
+		return 0, cmd.WriteError
+	}
+
+	rsp := cmd.RawResponse
+	if rsp == nil {
+		if cmd.Response == nil {
+			t.err = fmt.Errorf("no response for command %d", t.next)
+			return 0, t.err
+		}
+		var err error
+		rsp, err = cmd.Response.Bytes()
+		if err != nil {
+			t.err = xerrors.Errorf("cannot create response for command %d: %w", t.next, err)
+			return 0, t.err
+		}
+	}
+	t.rsps = append(t.rsps, bytes.NewReader(rsp))
+	if len(t.rsps) > t.maxOutstanding {
+		t.maxOutstanding = len(t.rsps)
+	}
+	return len(data), nil
+}
+
+func (t *MockTCTI) Close() error {
+	return nil
+}
+
+func (t *MockTCTI) SetLocality(locality uint8) error {
+	t.locality = locality
+	return nil
+}
+
+func (t *MockTCTI) MakeSticky(handle tpm2.Handle, sticky bool) error {
+	return errors.New("not implemented")
+}
+
+// Done returns an error if a submitted command didn't match an expectation, or if any of the expected commands were not
+// submitted.
+func (t *MockTCTI) Done() error {
+	if t.err != nil {
+		return t.err
+	}
+	if t.next < len(t.commands) {
+		return fmt.Errorf("%d expected command(s) were not submitted, starting with %v", len(t.commands)-t.next, t.commands[t.next].CommandCode)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package testutil
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/canonical/go-tpm2"
+)
+
+func TestMockTCTI(t *testing.T) {
+	tcti := NewMockTCTI(
+		&MockCommand{
+			CommandCode: tpm2.CommandGetCapability,
+			Response: &MockResponse{Params: []interface{}{false, &tpm2.CapabilityData{
+				Capability: tpm2.CapabilityTPMProperties,
+				Data: &tpm2.CapabilitiesU{TPMProperties: tpm2.TaggedTPMPropertyList{
+					{Property: tpm2.PropertyInputBuffer, Value: 1024},
+					{Property: tpm2.PropertyMaxDigest, Value: 32},
+					{Property: tpm2.PropertyNVBufferMax, Value: 1024}}}}}}},
+		&MockCommand{
+			CommandCode: tpm2.CommandGetRandom,
+			Params: func(params []byte) error {
+				if !bytes.Equal(params, []byte{0x00, 0x04}) {
+					return fmt.Errorf("unexpected bytesRequested: %x", params)
+				}
+				return nil
+			},
+			Response: &MockResponse{Params: []interface{}{tpm2.Digest{1, 2, 3, 4}}}},
+		&MockCommand{
+			CommandCode: tpm2.CommandPCRReset,
+			Handles:     []tpm2.Handle{7},
+			Response:    &MockResponse{PasswordSessions: 1}},
+		&MockCommand{
+			CommandCode: tpm2.CommandPCRReset,
+			Response:    &MockResponse{ResponseCode: tpm2.ResponseCode(0x184)}})
+	tpm, _ := tpm2.NewTPMContext(tcti)
+
+	b, err := tpm.GetRandom(4)
+	if err != nil {
+		t.Fatalf("GetRandom failed: %v", err)
+	}
+	if !bytes.Equal(b, []byte{1, 2, 3, 4}) {
+		t.Errorf("Unexpected random bytes: %x", b)
+	}
+	if err := tpm.PCRReset(tpm.PCRHandleContext(7), nil); err != nil {
+		t.Errorf("PCRReset failed: %v", err)
+	}
+	if err := tcti.Done(); err == nil {
+		t.Errorf("Done should fail with outstanding commands")
+	}
+	if err := tpm.PCRReset(tpm.PCRHandleContext(8), nil); !tpm2.IsTPMHandleError(err, tpm2.ErrorValue, tpm2.CommandPCRReset, 1) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Done failed: %v", err)
+	}
+
+	if _, err := tpm.GetRandom(4); err == nil {
+		t.Errorf("Unexpected command should fail")
+	}
+	if err := tcti.Done(); err == nil {
+		t.Errorf("Done should return the error from the unexpected command")
+	}
+}
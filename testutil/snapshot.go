@@ -0,0 +1,150 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package testutil
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/osutil/sys"
+
+	"golang.org/x/xerrors"
+)
+
+// launchedMssim describes an instance of the Microsoft reference simulator started by LaunchTPMSimulator.
+type launchedMssim struct {
+	opts     TPMSimulatorOptions
+	stateDir string
+	stop     func()
+}
+
+var (
+	// launchedMssims contains the simulators started by LaunchTPMSimulator that haven't been stopped yet, indexed by port.
+	launchedMssims     = make(map[uint]*launchedMssim)
+	launchedMssimsLock sync.Mutex
+)
+
+func getLaunchedMssim(port uint) *launchedMssim {
+	launchedMssimsLock.Lock()
+	defer launchedMssimsLock.Unlock()
+	return launchedMssims[port]
+}
+
+func addLaunchedMssim(sim *launchedMssim) {
+	launchedMssimsLock.Lock()
+	defer launchedMssimsLock.Unlock()
+	launchedMssims[sim.opts.port()] = sim
+}
+
+func removeLaunchedMssim(sim *launchedMssim) {
+	launchedMssimsLock.Lock()
+	defer launchedMssimsLock.Unlock()
+	if launchedMssims[sim.opts.port()] == sim {
+		delete(launchedMssims, sim.opts.port())
+	}
+}
+
+func copyNVChip(destDir, srcDir string) error {
+	src, err := os.Open(filepath.Join(srcDir, "NVChip"))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dest, err := osutil.NewAtomicFile(filepath.Join(destDir, "NVChip"), 0644, 0, sys.UserID(osutil.NoChown), sys.GroupID(osutil.NoChown))
+	if err != nil {
+		return err
+	}
+	defer dest.Cancel()
+
+	if _, err := io.Copy(dest, src); err != nil {
+		return err
+	}
+	return dest.Commit()
+}
+
+// SnapshotTPMSimulator saves the persistent state of the simulator started by LaunchTPMSimulator on the port specified by
+// MssimPort to the NVChip file in dir, so that expensive provisioning can be performed once and reused by other tests or test
+// packages with RestoreTPMSimulator or by passing dir as TPMSimulatorOptions.SourceDir. The supplied context must be connected to
+// the simulator with tcti.
+//
+// The simulator is shut down with TPM2_Shutdown(CLEAR) and powered off using the platform interface whilst its state is copied,
+// and is then powered back on and started with TPM2_Startup(CLEAR). Transient objects and sessions are lost. This is only
+// supported with the Microsoft reference simulator.
+func SnapshotTPMSimulator(tpm *tpm2.TPMContext, tcti *tpm2.TctiMssim, dir string) error {
+	sim := getLaunchedMssim(MssimPort)
+	if sim == nil {
+		return errors.New("no simulator launched by LaunchTPMSimulator is running on the port specified by MssimPort")
+	}
+
+	if err := tpm.Shutdown(tpm2.StartupClear); err != nil {
+		return xerrors.Errorf("cannot shut down simulator: %w", err)
+	}
+	if err := tcti.NVOff(); err != nil {
+		return xerrors.Errorf("cannot disable NV: %w", err)
+	}
+	if err := tcti.PowerOff(); err != nil {
+		return xerrors.Errorf("cannot power off simulator: %w", err)
+	}
+
+	if err := copyNVChip(dir, sim.stateDir); err != nil {
+		return xerrors.Errorf("cannot save persistent data: %w", err)
+	}
+
+	if err := tcti.PowerOn(); err != nil {
+		return xerrors.Errorf("cannot power on simulator: %w", err)
+	}
+	if err := tcti.NVOn(); err != nil {
+		return xerrors.Errorf("cannot enable NV: %w", err)
+	}
+	if err := tpm.Startup(tpm2.StartupClear); err != nil {
+		return xerrors.Errorf("simulator startup failed: %w", err)
+	}
+	return nil
+}
+
+// RestoreTPMSimulator restores the persistent state of the simulator started by LaunchTPMSimulator on the port specified by
+// MssimPort from a snapshot created by SnapshotTPMSimulator in dir. The simulator only reads its persistent data when it starts,
+// so it is restarted on the same port. The simulator only services one connection at a time, so the supplied context (if not nil)
+// is closed first, and callers must open a new connection afterwards.
+//
+// The function returned from LaunchTPMSimulator stops the restarted simulator, but no longer saves its persistent data if
+// TPMSimulatorOptions.SavePersistent was set.
+func RestoreTPMSimulator(tpm *tpm2.TPMContext, dir string) error {
+	sim := getLaunchedMssim(MssimPort)
+	if sim == nil {
+		return errors.New("no simulator launched by LaunchTPMSimulator is running on the port specified by MssimPort")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "NVChip")); err != nil {
+		return xerrors.Errorf("cannot find snapshot: %w", err)
+	}
+
+	if tpm != nil {
+		if err := tpm.Close(); err != nil {
+			return xerrors.Errorf("cannot close existing connection: %w", err)
+		}
+	}
+	sim.stop()
+
+	opts := sim.opts
+	opts.SourceDir = dir
+	opts.Manufacture = false
+	opts.SavePersistent = false
+
+	stateDir, stop, err := launchMssim(&opts)
+	if err != nil {
+		removeLaunchedMssim(sim)
+		sim.stop = func() {}
+		return xerrors.Errorf("cannot restart simulator: %w", err)
+	}
+	sim.stateDir = stateDir
+	sim.stop = stop
+	return nil
+}
@@ -53,23 +53,13 @@ func (b *TPMTestBase) SetUpTest(c *C) {
 
 	b.AddCleanup(func() { c.Assert(b.TPM.Close(), IsNil) })
 
-	getFlushableHandles := func() (out []tpm2.Handle) {
-		for _, t := range []tpm2.HandleType{tpm2.HandleTypeTransient, tpm2.HandleTypeLoadedSession, tpm2.HandleTypeSavedSession} {
-			h, err := b.TPM.GetCapabilityHandles(t.BaseHandle(), tpm2.CapabilityMaxProperties, nil)
-			c.Assert(err, IsNil)
-			out = append(out, h...)
-		}
-		for i, h := range out {
-			if h.Type() == tpm2.HandleTypePolicySession {
-				out[i] = (h & 0xffffff) | (tpm2.Handle(tpm2.HandleTypeHMACSession) << 24)
-			}
-		}
-		return
-	}
-	startFlushableHandles := getFlushableHandles()
+	startFlushableHandles, err := flushableHandles(b.TPM)
+	c.Assert(err, IsNil)
 
 	b.AddCleanup(func() {
-		for _, h := range getFlushableHandles() {
+		handles, err := flushableHandles(b.TPM)
+		c.Assert(err, IsNil)
+		for _, h := range handles {
 			found := false
 			for _, sh := range startFlushableHandles {
 				if sh == h {
@@ -80,18 +70,7 @@ func (b *TPMTestBase) SetUpTest(c *C) {
 			if found {
 				continue
 			}
-			var hc tpm2.HandleContext
-			switch h.Type() {
-			case tpm2.HandleTypeTransient:
-				var err error
-				hc, err = b.TPM.CreateResourceContextFromTPM(h)
-				c.Check(err, IsNil)
-			case tpm2.HandleTypeHMACSession:
-				hc = tpm2.CreateIncompleteSessionContext(h)
-			default:
-				c.Fatalf("Unexpected handle type")
-			}
-			c.Check(b.TPM.FlushContext(hc), IsNil)
+			c.Check(flushHandle(b.TPM, h), IsNil)
 		}
 	})
 }
@@ -113,6 +92,48 @@ func (b *TPMTestBase) SetHierarchyAuth(c *C, hierarchy tpm2.Handle) {
 	})
 }
 
+// CreatePrimaryRSASRK creates a RSA storage root key with CreatePrimaryRSASRK, and flushes it at the end of the test.
+func (b *TPMTestBase) CreatePrimaryRSASRK(c *C) tpm2.ResourceContext {
+	rc, err := CreatePrimaryRSASRK(b.TPM)
+	c.Assert(err, IsNil)
+	b.addCleanupFlush(c, rc)
+	return rc
+}
+
+// CreatePrimaryECCSRK creates an ECC storage root key with CreatePrimaryECCSRK, and flushes it at the end of the test.
+func (b *TPMTestBase) CreatePrimaryECCSRK(c *C) tpm2.ResourceContext {
+	rc, err := CreatePrimaryECCSRK(b.TPM)
+	c.Assert(err, IsNil)
+	b.addCleanupFlush(c, rc)
+	return rc
+}
+
+// CreateRSASigningKey creates and loads a RSA signing key with CreateRSASigningKey, and flushes it at the end of the test.
+func (b *TPMTestBase) CreateRSASigningKey(c *C, parent tpm2.ResourceContext) tpm2.ResourceContext {
+	rc, err := CreateRSASigningKey(b.TPM, parent)
+	c.Assert(err, IsNil)
+	b.addCleanupFlush(c, rc)
+	return rc
+}
+
+// CreateECCSigningKey creates and loads an ECC signing key with CreateECCSigningKey, and flushes it at the end of the test.
+func (b *TPMTestBase) CreateECCSigningKey(c *C, parent tpm2.ResourceContext) tpm2.ResourceContext {
+	rc, err := CreateECCSigningKey(b.TPM, parent)
+	c.Assert(err, IsNil)
+	b.addCleanupFlush(c, rc)
+	return rc
+}
+
+func (b *TPMTestBase) addCleanupFlush(c *C, rc tpm2.ResourceContext) {
+	b.AddCleanup(func() {
+		// The key may have already been flushed by the test.
+		if rc.Handle() == tpm2.HandleUnassigned {
+			return
+		}
+		c.Check(b.TPM.FlushContext(rc), IsNil)
+	})
+}
+
 // ResetTPMSimulator issues a Shutdown -> Reset -> Startup cycle of the TPM simulator.
 func (b *TPMTestBase) ResetTPMSimulator(c *C) {
 	mssim, ok := b.TCTI.(*tpm2.TctiMssim)
@@ -122,6 +143,29 @@ func (b *TPMTestBase) ResetTPMSimulator(c *C) {
 	c.Assert(ResetTPMSimulator(b.TPM, mssim), IsNil)
 }
 
+// SnapshotTPMSimulator saves the persistent state of the TPM simulator to dir with SnapshotTPMSimulator.
+func (b *TPMTestBase) SnapshotTPMSimulator(c *C, dir string) {
+	mssim, ok := b.TCTI.(*tpm2.TctiMssim)
+	if !ok {
+		c.Fatalf("No TPM simulator connection available")
+	}
+	c.Assert(SnapshotTPMSimulator(b.TPM, mssim, dir), IsNil)
+}
+
+// RestoreTPMSimulator restores the persistent state of the TPM simulator from a snapshot in dir with RestoreTPMSimulator, and
+// replaces TPM and TCTI with a new connection to the restarted simulator.
+func (b *TPMTestBase) RestoreTPMSimulator(c *C, dir string) {
+	if _, ok := b.TCTI.(*tpm2.TctiMssim); !ok {
+		c.Fatalf("No TPM simulator connection available")
+	}
+	c.Assert(RestoreTPMSimulator(b.TPM, dir), IsNil)
+
+	tpm, tcti, err := NewTPMSimulatorContext()
+	c.Assert(err, IsNil)
+	b.TPM = tpm
+	b.TCTI = tcti
+}
+
 // TPMTest is a base test suite for all tests that require a TPMContext created for them.
 type TPMTest struct {
 	TPMTestBase
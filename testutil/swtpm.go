@@ -0,0 +1,160 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package testutil
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/canonical/go-tpm2"
+
+	"golang.org/x/xerrors"
+)
+
+const swtpmCmdShutdown uint32 = 0x03 // CMD_SHUTDOWN on the swtpm control channel
+
+// TctiSwtpm represents a connection to a swtpm instance that is listening for TPM commands on a TCP socket. Commands and responses
+// are exchanged without any additional framing.
+type TctiSwtpm struct {
+	tpm  net.Conn
+	ctrl net.Conn
+}
+
+func (t *TctiSwtpm) Read(data []byte) (int, error) {
+	return t.tpm.Read(data)
+}
+
+func (t *TctiSwtpm) Write(data []byte) (int, error) {
+	return t.tpm.Write(data)
+}
+
+func (t *TctiSwtpm) Close() error {
+	err := t.tpm.Close()
+	if err2 := t.ctrl.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// SetLocality is not supported by swtpm over the TCP command channel, and returns an error for any locality other than 0.
+func (t *TctiSwtpm) SetLocality(locality uint8) error {
+	if locality != 0 {
+		return errors.New("not supported")
+	}
+	return nil
+}
+
+func (t *TctiSwtpm) MakeSticky(handle tpm2.Handle, sticky bool) error {
+	return errors.New("not implemented")
+}
+
+// Stop requests that swtpm shuts down.
+func (t *TctiSwtpm) Stop() error {
+	var cmd [4]byte
+	binary.BigEndian.PutUint32(cmd[:], swtpmCmdShutdown)
+	if _, err := t.ctrl.Write(cmd[:]); err != nil {
+		return xerrors.Errorf("cannot send shutdown command: %w", err)
+	}
+	var rsp [4]byte
+	if _, err := t.ctrl.Read(rsp[:]); err != nil {
+		return xerrors.Errorf("cannot read shutdown response: %w", err)
+	}
+	if rc := binary.BigEndian.Uint32(rsp[:]); rc != 0 {
+		return fmt.Errorf("shutdown command failed with result 0x%08x", rc)
+	}
+	return nil
+}
+
+// OpenSwtpm attempts to open a connection to a swtpm instance on the specified host. tpmPort is the port on which swtpm is
+// listening for TPM commands, and ctrlPort is the port of its control channel. If host is an empty string, it defaults to
+// "localhost".
+func OpenSwtpm(host string, tpmPort, ctrlPort uint) (*TctiSwtpm, error) {
+	if host == "" {
+		host = "localhost"
+	}
+
+	tpm, err := net.Dial("tcp", net.JoinHostPort(host, strconv.FormatUint(uint64(tpmPort), 10)))
+	if err != nil {
+		return nil, xerrors.Errorf("cannot connect to TPM socket: %w", err)
+	}
+	ctrl, err := net.Dial("tcp", net.JoinHostPort(host, strconv.FormatUint(uint64(ctrlPort), 10)))
+	if err != nil {
+		tpm.Close()
+		return nil, xerrors.Errorf("cannot connect to control socket: %w", err)
+	}
+	return &TctiSwtpm{tpm: tpm, ctrl: ctrl}, nil
+}
+
+// launchSwtpm launches swtpm with a freshly manufactured TPM in a temporary directory, listening on the port specified by
+// opts.Port, and its control channel on the next port.
+func launchSwtpm(opts *TPMSimulatorOptions) (stop func(), err error) {
+	if opts.SavePersistent {
+		return nil, errors.New("saving persistent data is not supported with swtpm")
+	}
+
+	port := opts.port()
+
+	swtpmPath, err := exec.LookPath("swtpm")
+	if err != nil {
+		return nil, errors.New("cannot find swtpm")
+	}
+
+	stateDir, err := ioutil.TempDir("", "tpm2test.swtpm")
+	if err != nil {
+		return nil, xerrors.Errorf("cannot create temporary directory for swtpm: %w", err)
+	}
+
+	cmd := exec.Command(swtpmPath, "socket", "--tpm2",
+		"--server", fmt.Sprintf("type=tcp,port=%d,bindaddr=127.0.0.1", port),
+		"--ctrl", fmt.Sprintf("type=tcp,port=%d,bindaddr=127.0.0.1", port+1),
+		"--tpmstate", "dir="+stateDir,
+		"--flags", "not-need-init,startup-clear")
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(stateDir)
+		return nil, xerrors.Errorf("cannot start swtpm: %w", err)
+	}
+
+	stop = func() {
+		defer os.RemoveAll(stateDir)
+
+		tcti, err := OpenSwtpm("", port, port+1)
+		if err == nil {
+			tpm, _ := tpm2.NewTPMContext(tcti)
+			if err := tpm.Shutdown(tpm2.StartupClear); err != nil {
+				fmt.Fprintf(os.Stderr, "swtpm shutdown failed: %v\n", err)
+			}
+			err = tcti.Stop()
+			tpm.Close()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Killing swtpm: %v\n", err)
+			cmd.Process.Kill()
+		}
+		cmd.Wait()
+	}
+
+	// Give swtpm 5 seconds to start up
+	for i := 0; ; i++ {
+		tcti, err := OpenSwtpm("", port, port+1)
+		if err == nil {
+			tcti.Close()
+			break
+		}
+		if i == 4 {
+			stop()
+			return nil, xerrors.Errorf("cannot open swtpm connection: %w", err)
+		}
+		time.Sleep(time.Second)
+	}
+
+	return stop, nil
+}
@@ -0,0 +1,297 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+//go:build ignore
+// +build ignore
+
+// This program generates the sample event logs in this directory and the files containing their expected PCR values. The logs
+// are synthetic, but are modelled on the logs produced by common UEFI firmware implementations booting a Linux distribution
+// via shim and GRUB, and follow the crypto-agile format defined in the TCG PC Client Platform Firmware Profile specification.
+//
+// Run it from this directory with "go run generate.go".
+package main
+
+import (
+	"bytes"
+	"crypto"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"unicode/utf16"
+)
+
+const (
+	evNoAction                          = 0x00000003
+	evSeparator                         = 0x00000004
+	evSCRTMVersion                      = 0x00000008
+	evIPL                               = 0x0000000d
+	evEFIVariableDriverConfig           = 0x80000001
+	evEFIVariableBoot                   = 0x80000002
+	evEFIBootServicesApplication        = 0x80000003
+	evEFIAction                         = 0x80000007
+	evEFIPlatformFirmwareBlob           = 0x80000008
+	evEFIHandoffTables                  = 0x80000009
+	evEFIVariableAuthority              = 0x800000e0
+	algSHA1                      uint16 = 0x0004
+	algSHA256                    uint16 = 0x000b
+)
+
+var (
+	efiGlobalVariable    = guid(0x8be4df61, 0x93ca, 0x11d2, 0xaa0d, [6]uint8{0x00, 0xe0, 0x98, 0x03, 0x2b, 0x8c})
+	efiImageSecurityDB   = guid(0xd719b2cb, 0x3d3a, 0x4596, 0xa3bc, [6]uint8{0xda, 0xd0, 0x0e, 0x67, 0x65, 0x6f})
+	shimLockGuid         = guid(0x605dab50, 0xe046, 0x4300, 0xabb6, [6]uint8{0x3d, 0xd8, 0x10, 0xdd, 0x8b, 0x23})
+	efiCertX509Guid      = guid(0xa5c059a1, 0x94e4, 0x4aa7, 0x87b5, [6]uint8{0xab, 0x15, 0x5c, 0x2b, 0xf0, 0x72})
+	efiCertSHA256Guid    = guid(0xc1c41626, 0x504c, 0x4092, 0xaca9, [6]uint8{0x41, 0xf9, 0x36, 0x93, 0x43, 0x28})
+	sampleSignatureOwner = guid(0x77fa9abd, 0x0359, 0x4d32, 0xbd60, [6]uint8{0x28, 0xf4, 0xe7, 0x8f, 0x78, 0x4b})
+
+	banks = []struct {
+		alg  uint16
+		name string
+		hash crypto.Hash
+	}{
+		{algSHA1, "sha1", crypto.SHA1},
+		{algSHA256, "sha256", crypto.SHA256},
+	}
+)
+
+func guid(a uint32, b, c, d uint16, e [6]uint8) []byte {
+	w := new(bytes.Buffer)
+	binary.Write(w, binary.LittleEndian, a)
+	binary.Write(w, binary.LittleEndian, b)
+	binary.Write(w, binary.LittleEndian, c)
+	binary.Write(w, binary.BigEndian, d)
+	w.Write(e[:])
+	return w.Bytes()
+}
+
+func ucs2(s string) []byte {
+	w := new(bytes.Buffer)
+	binary.Write(w, binary.LittleEndian, utf16.Encode([]rune(s)))
+	return w.Bytes()
+}
+
+func variableData(guid []byte, name string, data []byte) []byte {
+	w := new(bytes.Buffer)
+	w.Write(guid)
+	binary.Write(w, binary.LittleEndian, uint64(len(utf16.Encode([]rune(name)))))
+	binary.Write(w, binary.LittleEndian, uint64(len(data)))
+	w.Write(ucs2(name))
+	w.Write(data)
+	return w.Bytes()
+}
+
+// signatureList returns an EFI_SIGNATURE_LIST containing a single entry.
+func signatureList(sigType []byte, data []byte) []byte {
+	w := new(bytes.Buffer)
+	w.Write(sigType)
+	binary.Write(w, binary.LittleEndian, uint32(28+16+len(data)))
+	binary.Write(w, binary.LittleEndian, uint32(0))
+	binary.Write(w, binary.LittleEndian, uint32(16+len(data)))
+	w.Write(sampleSignatureOwner)
+	w.Write(data)
+	return w.Bytes()
+}
+
+// signatureData returns an EFI_SIGNATURE_DATA, as measured for EV_EFI_VARIABLE_AUTHORITY events.
+func signatureData(data []byte) []byte {
+	return append(append([]byte(nil), sampleSignatureOwner...), data...)
+}
+
+// sampleCert returns some bytes that stand in for a DER encoded X.509 certificate.
+func sampleCert(subject string) []byte {
+	return append([]byte{0x30, 0x82, 0x00, byte(len(subject))}, []byte(subject)...)
+}
+
+func imageLoadEvent(base, length uint64) []byte {
+	w := new(bytes.Buffer)
+	binary.Write(w, binary.LittleEndian, base)
+	binary.Write(w, binary.LittleEndian, length)
+	binary.Write(w, binary.LittleEndian, uint64(0))
+	binary.Write(w, binary.LittleEndian, uint64(4))
+	w.Write([]byte{0x7f, 0xff, 0x04, 0x00})
+	return w.Bytes()
+}
+
+func firmwareBlob(base, length uint64) []byte {
+	w := new(bytes.Buffer)
+	binary.Write(w, binary.LittleEndian, base)
+	binary.Write(w, binary.LittleEndian, length)
+	return w.Bytes()
+}
+
+type event struct {
+	pcr       uint32
+	eventType uint32
+	data      []byte
+	measured  []byte // The data that is hashed for the event digest, if different to data
+}
+
+type log struct {
+	description string
+	events      []event
+}
+
+func (l *log) add(pcr, eventType uint32, data []byte) {
+	l.events = append(l.events, event{pcr: pcr, eventType: eventType, data: data})
+}
+
+func (l *log) addMeasured(pcr, eventType uint32, data, measured []byte) {
+	l.events = append(l.events, event{pcr: pcr, eventType: eventType, data: data, measured: measured})
+}
+
+func (l *log) write(name string) error {
+	w := new(bytes.Buffer)
+
+	// Spec ID event, in the legacy SHA-1 format.
+	specID := new(bytes.Buffer)
+	specID.Write([]byte("Spec ID Event03\x00"))
+	binary.Write(specID, binary.LittleEndian, uint32(0)) // platformClass
+	specID.Write([]byte{0, 2, 0, 2})                     // specVersionMinor, specVersionMajor, specErrata, uintnSize
+	binary.Write(specID, binary.LittleEndian, uint32(len(banks)))
+	for _, b := range banks {
+		binary.Write(specID, binary.LittleEndian, b.alg)
+		binary.Write(specID, binary.LittleEndian, uint16(b.hash.Size()))
+	}
+	specID.WriteByte(0) // vendorInfoSize
+
+	binary.Write(w, binary.LittleEndian, uint32(0))
+	binary.Write(w, binary.LittleEndian, uint32(evNoAction))
+	w.Write(make([]byte, 20))
+	binary.Write(w, binary.LittleEndian, uint32(specID.Len()))
+	w.Write(specID.Bytes())
+
+	pcrs := make(map[string]map[string][]byte)
+	for _, b := range banks {
+		pcrs[b.name] = make(map[string][]byte)
+	}
+
+	for _, e := range l.events {
+		measured := e.measured
+		if measured == nil {
+			measured = e.data
+		}
+
+		binary.Write(w, binary.LittleEndian, e.pcr)
+		binary.Write(w, binary.LittleEndian, e.eventType)
+		binary.Write(w, binary.LittleEndian, uint32(len(banks)))
+		for _, b := range banks {
+			h := b.hash.New()
+			h.Write(measured)
+			digest := h.Sum(nil)
+
+			binary.Write(w, binary.LittleEndian, b.alg)
+			w.Write(digest)
+
+			index := strconv.Itoa(int(e.pcr))
+			pcr, ok := pcrs[b.name][index]
+			if !ok {
+				pcr = make([]byte, b.hash.Size())
+			}
+			h = b.hash.New()
+			h.Write(pcr)
+			h.Write(digest)
+			pcrs[b.name][index] = h.Sum(nil)
+		}
+		binary.Write(w, binary.LittleEndian, uint32(len(e.data)))
+		w.Write(e.data)
+	}
+
+	if err := ioutil.WriteFile(name+".bin", w.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	expected := struct {
+		Description string                       `json:"description"`
+		PCRs        map[string]map[string]string `json:"pcrs"`
+	}{Description: l.description, PCRs: make(map[string]map[string]string)}
+	for bank, values := range pcrs {
+		expected.PCRs[bank] = make(map[string]string)
+		for index, value := range values {
+			expected.PCRs[bank][index] = hex.EncodeToString(value)
+		}
+	}
+	j, err := json.MarshalIndent(expected, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name+".json", append(j, '\n'), 0644)
+}
+
+func newLog(description string, secureBoot bool) *log {
+	l := &log{description: description}
+
+	l.add(0, evSCRTMVersion, ucs2("1.0\x00"))
+	l.addMeasured(0, evEFIPlatformFirmwareBlob, firmwareBlob(0xffc00000, 0x00200000), []byte("sample firmware volume 1"))
+	l.addMeasured(0, evEFIPlatformFirmwareBlob, firmwareBlob(0xffe00000, 0x00200000), []byte("sample firmware volume 2"))
+
+	var sb []byte
+	var pk, kek, db, dbx []byte
+	if secureBoot {
+		sb = []byte{1}
+		pk = signatureList(efiCertX509Guid, sampleCert("Sample Platform Key"))
+		kek = signatureList(efiCertX509Guid, sampleCert("Sample KEK CA"))
+		db = signatureList(efiCertX509Guid, sampleCert("Sample UEFI CA"))
+		dbx = signatureList(efiCertSHA256Guid, make([]byte, 32))
+	} else {
+		sb = []byte{0}
+	}
+	l.add(7, evEFIVariableDriverConfig, variableData(efiGlobalVariable, "SecureBoot", sb))
+	l.add(7, evEFIVariableDriverConfig, variableData(efiGlobalVariable, "PK", pk))
+	l.add(7, evEFIVariableDriverConfig, variableData(efiGlobalVariable, "KEK", kek))
+	l.add(7, evEFIVariableDriverConfig, variableData(efiImageSecurityDB, "db", db))
+	l.add(7, evEFIVariableDriverConfig, variableData(efiImageSecurityDB, "dbx", dbx))
+
+	l.addMeasured(1, evEFIHandoffTables, firmwareBlob(0x7b6e8000, 0x1), []byte("sample SMBIOS tables"))
+	l.add(1, evEFIVariableBoot, variableData(efiGlobalVariable, "BootOrder", []byte{0x01, 0x00, 0x00, 0x00}))
+	l.add(1, evEFIVariableBoot, variableData(efiGlobalVariable, "Boot0001", append([]byte{0x01, 0x00, 0x00, 0x00, 0x04, 0x00},
+		append(ucs2("ubuntu\x00"), 0x7f, 0xff, 0x04, 0x00)...)))
+
+	l.add(4, evEFIAction, []byte("Calling EFI Application from Boot Option"))
+	for pcr := uint32(0); pcr < 8; pcr++ {
+		l.add(pcr, evSeparator, []byte{0, 0, 0, 0})
+	}
+
+	if secureBoot {
+		l.add(7, evEFIVariableAuthority, variableData(efiImageSecurityDB, "db", signatureData(sampleCert("Sample UEFI CA"))))
+		l.addMeasured(4, evEFIBootServicesApplication, imageLoadEvent(0x7a000000, 0xe8000), []byte("sample shimx64.efi"))
+		l.addMeasured(14, evIPL, []byte("MokList\x00"), signatureList(efiCertX509Guid, sampleCert("Sample Machine Owner Key")))
+		l.add(7, evEFIVariableAuthority, variableData(shimLockGuid, "Shim", sampleCert("Sample Distribution CA")))
+	}
+	l.addMeasured(4, evEFIBootServicesApplication, imageLoadEvent(0x79000000, 0x1a0000), []byte("sample grubx64.efi"))
+	l.addMeasured(4, evEFIBootServicesApplication, imageLoadEvent(0x78000000, 0xb00000), []byte("sample vmlinuz"))
+
+	l.add(5, evEFIAction, []byte("Exit Boot Services Invocation"))
+	l.add(5, evEFIAction, []byte("Exit Boot Services Returned with Success"))
+
+	return l
+}
+
+func run() error {
+	for _, f := range []struct {
+		name       string
+		desc       string
+		secureBoot bool
+	}{
+		{"uefi-secureboot", "UEFI boot of shim, GRUB and a Linux kernel with secure boot enabled", true},
+		{"uefi-no-secureboot", "UEFI boot of GRUB and a Linux kernel with secure boot disabled", false},
+	} {
+		if err := newLog(f.desc, f.secureBoot).write(f.name); err != nil {
+			return fmt.Errorf("cannot write %s: %v", f.name, err)
+		}
+	}
+	return nil
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
@@ -139,6 +139,7 @@ const (
 	TPMBackendNone TPMBackendType = iota
 	TPMBackendDevice
 	TPMBackendMssim
+	TPMBackendSwtpm
 )
 
 var (
@@ -152,7 +153,8 @@ var (
 	// TPMDevicePath defines the path of the TPM character device where TPMBackend is TPMBackendDevice.
 	TPMDevicePath string = "/dev/tpm0"
 
-	// MssimPort defines the port number of the TPM simulator command port where TPMBackend is TPMBackendMssim.
+	// MssimPort defines the port number of the TPM simulator command port where TPMBackend is TPMBackendMssim or
+	// TPMBackendSwtpm. The simulator's platform or control port is the next port number.
 	MssimPort uint = 2321
 )
 
@@ -185,17 +187,79 @@ func (v *tpmBackendFlagValue) IsBoolFlag() bool { return true }
 func AddCommandLineFlags() {
 	flag.Var(&tpmBackendFlagValue{v: TPMBackendDevice, target: &TPMBackend}, "use-tpm", "Whether to use a TPM character device for testing (eg, /dev/tpm0)")
 	flag.Var(&tpmBackendFlagValue{v: TPMBackendMssim, target: &TPMBackend}, "use-mssim", "Whether to use the TPM simulator for testing")
+	flag.Var(&tpmBackendFlagValue{v: TPMBackendSwtpm, target: &TPMBackend}, "use-swtpm", "Whether to use swtpm for testing")
 	flag.Var(&PermittedTPMFeatures, "tpm-permitted-features", "Comma-separated list of features that tests can use on a TPM character device")
 
 	flag.StringVar(&TPMDevicePath, "tpm-path", "/dev/tpm0", "The path of the TPM character device to use for testing (default: /dev/tpm0)")
 	flag.UintVar(&MssimPort, "mssim-port", 2321, "The port number of the TPM simulator command channel (default: 2321)")
+	flag.BoolVar(&UpdateGoldenTranscripts, "update-golden", false, "Whether to overwrite golden transcripts rather than checking against them")
 }
 
+// TPMSimulatorType identifies a TPM simulator implementation.
+type TPMSimulatorType int
+
+const (
+	// TPMSimulatorAuto selects the simulator corresponding to TPMBackend if it is TPMBackendMssim or TPMBackendSwtpm. Otherwise,
+	// the Microsoft reference simulator is used if it can be found, else swtpm is used.
+	TPMSimulatorAuto TPMSimulatorType = iota
+
+	// TPMSimulatorMssim is the Microsoft reference simulator (tpm2-simulator).
+	TPMSimulatorMssim
+
+	// TPMSimulatorSwtpm is swtpm.
+	TPMSimulatorSwtpm
+)
+
 // TPMSimulatorOptions provide the options to LaunchTPMSimulator
 type TPMSimulatorOptions struct {
-	SourceDir      string // Source directory for the persistent data file
-	Manufacture    bool   // Indicates that the simulator should be executed in re-manufacture mode
-	SavePersistent bool   // Saves the persistent data file back to SourceDir on exit
+	SourceDir      string           // Source directory for the persistent data file
+	Manufacture    bool             // Indicates that the simulator should be executed in re-manufacture mode
+	SavePersistent bool             // Saves the persistent data file back to SourceDir on exit
+	Simulator      TPMSimulatorType // The simulator to launch
+	Port           uint             // The port for the simulator's command channel. If zero, MssimPort is used
+}
+
+func (o *TPMSimulatorOptions) port() uint {
+	if o.Port == 0 {
+		return MssimPort
+	}
+	return o.Port
+}
+
+func findMssim() string {
+	for _, p := range []string{"tpm2-simulator", "tpm2-simulator-chrisccoulson.tpm2-simulator"} {
+		if path, err := exec.LookPath(p); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+func (t TPMSimulatorType) resolve() TPMSimulatorType {
+	if t != TPMSimulatorAuto {
+		return t
+	}
+	switch {
+	case TPMBackend == TPMBackendMssim:
+		return TPMSimulatorMssim
+	case TPMBackend == TPMBackendSwtpm:
+		return TPMSimulatorSwtpm
+	case findMssim() != "":
+		return TPMSimulatorMssim
+	default:
+		return TPMSimulatorSwtpm
+	}
+}
+
+// Available indicates whether the binary for the simulator selected by t can be found.
+func (t TPMSimulatorType) Available() bool {
+	switch t.resolve() {
+	case TPMSimulatorMssim:
+		return findMssim() != ""
+	default:
+		_, err := exec.LookPath("swtpm")
+		return err == nil
+	}
 }
 
 // LaunchTPMSimulator launches a TPM simulator. A new temporary directory will be created in which the
@@ -205,6 +269,10 @@ type TPMSimulatorOptions struct {
 // temporary directory to the source directory on exit. This is useful for generating test data that
 // needs to be checked in to a repository.
 //
+// If swtpm is selected by opts.Simulator, it is always launched with a freshly manufactured TPM, and
+// opts.SourceDir and opts.SavePersistent are not supported. Neither are SnapshotTPMSimulator and
+// RestoreTPMSimulator.
+//
 // On success, it returns a function that can be used to stop the simulator and clean up its temporary
 // directory.
 func LaunchTPMSimulator(opts *TPMSimulatorOptions) (stop func(), err error) {
@@ -212,25 +280,39 @@ func LaunchTPMSimulator(opts *TPMSimulatorOptions) (stop func(), err error) {
 	if opts == nil {
 		opts = &TPMSimulatorOptions{Manufacture: true}
 	}
+	if opts.Simulator.resolve() == TPMSimulatorSwtpm {
+		return launchSwtpm(opts)
+	}
+
+	stateDir, stopMssim, err := launchMssim(opts)
+	if err != nil {
+		return nil, err
+	}
+	sim := &launchedMssim{opts: *opts, stateDir: stateDir, stop: stopMssim}
+	addLaunchedMssim(sim)
+	return func() {
+		sim.stop()
+		removeLaunchedMssim(sim)
+	}, nil
+}
+
+// launchMssim launches the Microsoft reference simulator for LaunchTPMSimulator, returning the temporary directory in which it
+// stores its persistent data.
+func launchMssim(opts *TPMSimulatorOptions) (stateDir string, stop func(), err error) {
+	port := opts.port()
+
 	if opts.SourceDir == "" {
 		wd, err := os.Getwd()
 		if err != nil {
-			return nil, xerrors.Errorf("cannot determine cwd: %w", err)
+			return "", nil, xerrors.Errorf("cannot determine cwd: %w", err)
 		}
 		opts.SourceDir = wd
 	}
 
 	// Search for a TPM simulator binary
-	mssimPath := ""
-	for _, p := range []string{"tpm2-simulator", "tpm2-simulator-chrisccoulson.tpm2-simulator"} {
-		var err error
-		mssimPath, err = exec.LookPath(p)
-		if err == nil {
-			break
-		}
-	}
+	mssimPath := findMssim()
 	if mssimPath == "" {
-		return nil, errors.New("cannot find a simulator binary")
+		return "", nil, errors.New("cannot find a simulator binary")
 	}
 
 	// The TPM simulator creates its persistent storage in its current directory. Ideally, we would create
@@ -260,17 +342,17 @@ func LaunchTPMSimulator(opts *TPMSimulatorOptions) (stop func(), err error) {
 	if mssimSnapName != "" {
 		home := os.Getenv("HOME")
 		if home == "" {
-			return nil, errors.New("cannot determine home directory")
+			return "", nil, errors.New("cannot determine home directory")
 		}
 		tmpRoot = snap.UserCommonDataDir(home, mssimSnapName)
 		if err := os.MkdirAll(tmpRoot, 0755); err != nil {
-			return nil, xerrors.Errorf("cannot create snap common data dir: %w", err)
+			return "", nil, xerrors.Errorf("cannot create snap common data dir: %w", err)
 		}
 	}
 
 	mssimTmpDir, err := ioutil.TempDir(tmpRoot, "tpm2test.mssim")
 	if err != nil {
-		return nil, xerrors.Errorf("cannot create temporary directory for simulator: %w", err)
+		return "", nil, xerrors.Errorf("cannot create temporary directory for simulator: %w", err)
 	}
 
 	var cmd *exec.Cmd
@@ -334,7 +416,7 @@ func LaunchTPMSimulator(opts *TPMSimulatorOptions) (stop func(), err error) {
 				}
 			}()
 
-			tcti, err := tpm2.OpenMssim("", MssimPort, MssimPort+1)
+			tcti, err := tpm2.OpenMssim("", port, port+1)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Cannot open TPM simulator connection for shutdown: %v\n", err)
 				return
@@ -369,18 +451,18 @@ func LaunchTPMSimulator(opts *TPMSimulatorOptions) (stop func(), err error) {
 	source, err := os.Open(filepath.Join(opts.SourceDir, "NVChip"))
 	switch {
 	case err != nil && !os.IsNotExist(err):
-		return nil, xerrors.Errorf("cannot open source persistent storage: %w", err)
+		return "", nil, xerrors.Errorf("cannot open source persistent storage: %w", err)
 	case err != nil:
 		// Nothing to do
 	default:
 		defer source.Close()
 		dest, err := os.Create(filepath.Join(mssimTmpDir, "NVChip"))
 		if err != nil {
-			return nil, xerrors.Errorf("cannot create temporary storage for simulator: %w", err)
+			return "", nil, xerrors.Errorf("cannot create temporary storage for simulator: %w", err)
 		}
 		defer dest.Close()
 		if _, err := io.Copy(dest, source); err != nil {
-			return nil, xerrors.Errorf("cannot copy persistent storage to temporary location for simulator: %w", err)
+			return "", nil, xerrors.Errorf("cannot copy persistent storage to temporary location for simulator: %w", err)
 		}
 	}
 
@@ -388,7 +470,7 @@ func LaunchTPMSimulator(opts *TPMSimulatorOptions) (stop func(), err error) {
 	if opts.Manufacture {
 		args = append(args, "-m")
 	}
-	args = append(args, strconv.FormatUint(uint64(MssimPort), 10))
+	args = append(args, strconv.FormatUint(uint64(port), 10))
 
 	cmd = exec.Command(mssimPath, args...)
 	cmd.Dir = mssimTmpDir // Run from the temporary directory we created
@@ -398,7 +480,7 @@ func LaunchTPMSimulator(opts *TPMSimulatorOptions) (stop func(), err error) {
 	cmd.Env = append(cmd.Env, "TPM2SIM_DONT_CD_TO_HOME=1")
 
 	if err := cmd.Start(); err != nil {
-		return nil, xerrors.Errorf("cannot start simulator: %w", err)
+		return "", nil, xerrors.Errorf("cannot start simulator: %w", err)
 	}
 
 	var tcti *tpm2.TctiMssim
@@ -406,10 +488,10 @@ func LaunchTPMSimulator(opts *TPMSimulatorOptions) (stop func(), err error) {
 Loop:
 	for i := 0; ; i++ {
 		var err error
-		tcti, err = tpm2.OpenMssim("", MssimPort, MssimPort+1)
+		tcti, err = tpm2.OpenMssim("", port, port+1)
 		switch {
 		case err != nil && i == 4:
-			return nil, xerrors.Errorf("cannot open simulator connection: %w", err)
+			return "", nil, xerrors.Errorf("cannot open simulator connection: %w", err)
 		case err != nil:
 			time.Sleep(time.Second)
 		default:
@@ -421,11 +503,11 @@ Loop:
 	defer tpm.Close()
 
 	if err := tpm.Startup(tpm2.StartupClear); err != nil {
-		return nil, xerrors.Errorf("simulator startup failed: %w", err)
+		return "", nil, xerrors.Errorf("simulator startup failed: %w", err)
 	}
 
 	succeeded = true
-	return cleanup, nil
+	return mssimTmpDir, cleanup, nil
 }
 
 // NewTCTI returns a new TCTI for testing, for integration with test suites that might have a custom way to create a
@@ -454,6 +536,12 @@ func NewTCTI(features TPMFeatureFlags) (tpm2.TCTI, error) {
 			return nil, err
 		}
 		return &tctiFilter{tcti, features}, nil
+	case TPMBackendSwtpm:
+		tcti, err := OpenSwtpm("", MssimPort, MssimPort+1)
+		if err != nil {
+			return nil, err
+		}
+		return &tctiFilter{tcti, features}, nil
 	}
 	panic("not reached")
 }
@@ -491,6 +579,44 @@ func NewTPMSimulatorContext() (*tpm2.TPMContext, *tpm2.TctiMssim, error) {
 	return tpm, tcti, nil
 }
 
+// LaunchTPMSimulatorContext launches a TPM simulator with LaunchTPMSimulator and returns a TPMContext that is connected to it,
+// for use by tests that want a private simulator rather than one configured with AddCommandLineFlags. If opts is nil, the
+// simulator selected by TPMSimulatorAuto is launched with a freshly manufactured TPM.
+//
+// On success, it returns a function that closes the TPMContext, stops the simulator and cleans up its temporary directory.
+func LaunchTPMSimulatorContext(opts *TPMSimulatorOptions) (tpm *tpm2.TPMContext, stop func(), err error) {
+	if opts == nil {
+		opts = &TPMSimulatorOptions{Manufacture: true}
+	}
+	simulator := opts.Simulator.resolve()
+	opts.Simulator = simulator
+
+	stopSimulator, err := LaunchTPMSimulator(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var tcti tpm2.TCTI
+	switch simulator {
+	case TPMSimulatorSwtpm:
+		tcti, err = OpenSwtpm("", opts.port(), opts.port()+1)
+	default:
+		tcti, err = tpm2.OpenMssim("", opts.port(), opts.port()+1)
+	}
+	if err != nil {
+		stopSimulator()
+		return nil, nil, xerrors.Errorf("cannot open simulator connection: %w", err)
+	}
+
+	tpm, _ = tpm2.NewTPMContext(tcti)
+	return tpm, func() {
+		if err := tpm.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot close TPM simulator connection: %v\n", err)
+		}
+		stopSimulator()
+	}, nil
+}
+
 // ResetTPMSimulator issues a Shutdown -> Reset -> Startup cycle of the TPM simulator.
 func ResetTPMSimulator(tpm *tpm2.TPMContext, tcti *tpm2.TctiMssim) error {
 	if err := tpm.Shutdown(tpm2.StartupClear); err != nil {
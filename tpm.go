@@ -6,17 +6,47 @@ package tpm2
 
 import (
 	"bytes"
+	"crypto/rand"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"reflect"
+	"sync"
+	"time"
 
 	"github.com/canonical/go-tpm2/mu"
 
 	"golang.org/x/xerrors"
 )
 
+// waitForReadyInterval is the time to wait between submissions of a command when the TPM indicates that it is not ready and
+// TPMContext.SetWaitForReady has been used to enable waiting.
+const waitForReadyInterval = 100 * time.Millisecond
+
+// selfTestWaitTimeout is the maximum time to wait for the TPM when a command fails because the TPM is performing self tests that were
+// started with TPMContext.SelfTest, and TPMContext.SetWaitForReady hasn't been used to enable waiting.
+const selfTestWaitTimeout = 10 * time.Second
+
+var sleep = time.Sleep
+
+// Clock is the source of time used by TPMContext for measuring the duration of commands and for waiting between command
+// submissions. It can be replaced with TPMContext.SetClock.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) Sleep(d time.Duration) {
+	sleep(d)
+}
+
 func makeInvalidArgError(name, msg string) error {
 	return fmt.Errorf("invalid %s argument: %s", name, msg)
 }
@@ -27,13 +57,108 @@ func wrapMarshallingError(commandCode CommandCode, context string, err error) er
 
 func handleUnmarshallingError(commandCode CommandCode, context string, err error) error {
 	var s *mu.InvalidSelectorError
-	if xerrors.Is(err, io.EOF) || xerrors.Is(err, io.ErrUnexpectedEOF) || xerrors.As(err, &s) {
-		return &InvalidResponseError{commandCode, fmt.Sprintf("cannot unmarshal %s: %v", context, err)}
+	var e *mu.SizeError
+	if xerrors.Is(err, io.EOF) || xerrors.Is(err, io.ErrUnexpectedEOF) || xerrors.As(err, &s) || xerrors.As(err, &e) {
+		return &InvalidResponseError{Command: commandCode, msg: fmt.Sprintf("cannot unmarshal %s: %v", context, err)}
 	}
 
 	return fmt.Errorf("cannot unmarshal %s for command %s: %v", context, commandCode, err)
 }
 
+// captureCommandPacket returns a copy of the command packet constructed from the supplied fields, with any cleartext authorization
+// values in the command authorization area replaced with zeros.
+func captureCommandPacket(tag StructTag, commandCode CommandCode, handles []interface{}, authArea commandAuthArea, cpBytes []byte) []byte {
+	var redacted commandAuthArea
+	for _, a := range authArea {
+		if a.SessionHandle == HandlePW {
+			a.HMAC = make(Auth, len(a.HMAC))
+		}
+		redacted = append(redacted, a)
+	}
+
+	payload := new(bytes.Buffer)
+	if _, err := mu.MarshalToWriter(payload, handles...); err != nil {
+		panic(fmt.Sprintf("cannot marshal command handles: %v", err))
+	}
+	if tag == TagSessions {
+		if _, err := mu.MarshalToWriter(payload, &redacted); err != nil {
+			panic(fmt.Sprintf("cannot marshal command auth area: %v", err))
+		}
+	}
+	payload.Write(cpBytes)
+
+	b, err := mu.MarshalToBytes(commandHeader{tag, uint32(binary.Size(commandHeader{}) + payload.Len()), commandCode}, mu.RawBytes(payload.Bytes()))
+	if err != nil {
+		panic(fmt.Sprintf("cannot marshal command packet: %v", err))
+	}
+	return b
+}
+
+// maxRecordedResponseSize is the maximum number of bytes of a response packet that are recorded in InvalidResponseError.
+const maxRecordedResponseSize = 4096
+
+// recordResponse returns a bounded copy of the response packet with the specified header fields and payload, for attaching to an
+// InvalidResponseError.
+func recordResponse(tag StructTag, responseCode ResponseCode, payload []byte) []byte {
+	b, err := mu.MarshalToBytes(responseHeader{tag, uint32(binary.Size(responseHeader{}) + len(payload)), responseCode}, mu.RawBytes(payload))
+	if err != nil {
+		panic(fmt.Sprintf("cannot marshal response packet: %v", err))
+	}
+	if len(b) > maxRecordedResponseSize {
+		b = b[:maxRecordedResponseSize]
+	}
+	return b
+}
+
+// defaultPacketBufferSize is the size of the pooled command and response buffers used before the maximum sizes supported by the TPM
+// are known.
+const defaultPacketBufferSize = 4096
+
+// packetBufferPools contains a *sync.Pool of command and response buffers for each buffer size in use.
+var packetBufferPools sync.Map
+
+func getPacketBuffer(size int) *[]byte {
+	p, ok := packetBufferPools.Load(size)
+	if !ok {
+		p, _ = packetBufferPools.LoadOrStore(size, &sync.Pool{New: func() interface{} {
+			b := make([]byte, size)
+			return &b
+		}})
+	}
+	return p.(*sync.Pool).Get().(*[]byte)
+}
+
+func putPacketBuffer(b *[]byte) {
+	if p, ok := packetBufferPools.Load(cap(*b)); ok {
+		p.(*sync.Pool).Put(b)
+	}
+}
+
+// annotateResponseError adds the handle and name of the resource or session associated with a *TPMHandleError or *TPMSessionError
+// returned from DecodeResponseCode, using the handles and sessions that the command was submitted with.
+func annotateResponseError(err error, handles []interface{}, handleNames []Name, sessionParams *sessionParams) {
+	switch e := err.(type) {
+	case *TPMHandleError:
+		if e.Index < 1 || e.Index > len(handles) {
+			return
+		}
+		e.Handle = handles[e.Index-1].(Handle)
+		e.Name = handleNames[e.Index-1]
+	case *TPMSessionError:
+		if e.Index < 1 || e.Index > len(sessionParams.sessions) {
+			return
+		}
+		s := sessionParams.sessions[e.Index-1]
+		if s.session == nil {
+			e.Handle = HandlePW
+			e.Name = handleName(HandlePW)
+		} else {
+			e.Handle = s.session.Handle()
+			e.Name = s.session.Name()
+		}
+	}
+}
+
 func isSessionAllowed(commandCode CommandCode) bool {
 	switch commandCode {
 	case CommandStartup:
@@ -72,6 +197,20 @@ type cmdContext struct {
 	responseTag      StructTag
 	responseAuthArea []authResponse
 	rpBytes          []byte
+	responseBytes    []byte
+	responseBuffer   *[]byte
+	capturedCommand  []byte
+	audit            *auditCommand
+}
+
+// CommandObserver can be registered with TPMContext.SetCommandObserver in order to be notified of every command that is executed on
+// the TPM, for the purposes of telemetry or audit logging.
+type CommandObserver interface {
+	// ObserveCommand is called after the TPM responds to a command, with the command code, the command handles, the time taken to
+	// submit the command and receive the response, and the response code. It is called for each submission of a command that is
+	// resubmitted automatically. It is not called if the transmission interface returns an error or the response header is badly
+	// formed.
+	ObserveCommand(commandCode CommandCode, handles HandleList, duration time.Duration, responseCode ResponseCode)
 }
 
 type delimiterSentinel struct{}
@@ -108,12 +247,36 @@ type TPMContext struct {
 	tcti                  TCTI
 	permanentResources    map[Handle]*permanentContext
 	maxSubmissions        uint
+	retryPolicy           RetryPolicy
+	waitForReadyTimeout   time.Duration
+	observer              CommandObserver
+	stats                 Stats
+	metrics               Metrics
+	random                io.Reader
+	clock                 Clock
+	manufacturer          *TPMManufacturer
+	strictResponses       bool
+	captureCommands       bool
+	skipConsistencyChecks bool
+	invalidatedSessions   []SessionContext
+	capabilityCache       map[capabilityCacheKey][]byte
 	propertiesInitialized bool
 	maxBufferSize         int
 	maxDigestSize         int
 	maxNVBufferSize       int
+	maxCommandSize        int
+	maxResponseSize       int
 	exclusiveSession      *sessionContext
+	desyncedSessions      map[*sessionContextData]struct{}
+	auditVerifiers        map[*sessionContextData]*AuditVerifier
+	pcrReadResponse       pcrReadResponse
+	selfTestState         selfTestState
 	currentCmd            *cmdContext
+	locality              uint8
+	rejectPasswordAuths   bool
+	defaultAuthSession    *sessionContext
+	disabledHierarchies   map[Handle]struct{}
+	transientObjects      map[*objectContext]Handle
 }
 
 // Close calls Close on the transmission interface.
@@ -125,6 +288,17 @@ func (t *TPMContext) Close() error {
 	return nil
 }
 
+// decodeVendorError populates the vendor-specific fields of a *TPMVendorError using the decoder registered for the manufacturer of
+// the TPM, if there is one. This only uses a manufacturer that has already been obtained by TPMContext.InitProperties or
+// TPMContext.GetManufacturer, as it is called whilst dispatching a command and must not execute any commands itself.
+func (t *TPMContext) decodeVendorError(err error) {
+	e, isVendorErr := err.(*TPMVendorError)
+	if !isVendorErr || t.manufacturer == nil {
+		return
+	}
+	DecodeVendorError(*t.manufacturer, e)
+}
+
 // RunCommandBytes is a low-level interface for executing the command defined by the specified commandCode. It will construct an
 // appropriate header, but the caller is responsible for providing the rest of the serialized command structure in commandBytes.
 // Valid values for tag are TagNoSessions if the authorization area is empty, else it must be TagSessions.
@@ -134,24 +308,55 @@ func (t *TPMContext) Close() error {
 // the returned response structure is correctly formed, but will return an error if marshalling of the command header or
 // unmarshalling of the response header fails, or the transmission interface returns an error.
 func (t *TPMContext) RunCommandBytes(tag StructTag, commandCode CommandCode, commandBytes []byte) (ResponseCode, StructTag, []byte, error) {
-	cHeader := commandHeader{tag, 0, commandCode}
-	cHeader.CommandSize = uint32(binary.Size(cHeader) + len(commandBytes))
+	return t.runCommandBytes(tag, commandCode, commandBytes, nil)
+}
 
-	bytes, err := mu.MarshalToBytes(cHeader, mu.RawBytes(commandBytes))
-	if err != nil {
-		panic(fmt.Sprintf("cannot marshal complete command packet bytes: %v", err))
+// runCommandBytes is the implementation of RunCommandBytes. If rspBuf has sufficient capacity, the response payload is read in to it
+// and the returned slice aliases it.
+func (t *TPMContext) runCommandBytes(tag StructTag, commandCode CommandCode, commandBytes []byte, rspBuf []byte) (ResponseCode, StructTag, []byte, error) {
+	if err := t.writeCommandBytes(tag, commandCode, commandBytes); err != nil {
+		return 0, 0, nil, err
 	}
+	return t.readResponseBytes(commandCode, rspBuf)
+}
+
+// writeCommandBytes constructs a command packet and writes it to the transmission interface. The command packet is assembled in a
+// pooled buffer that is released once the packet has been written.
+func (t *TPMContext) writeCommandBytes(tag StructTag, commandCode CommandCode, commandBytes []byte) error {
+	var cHeader commandHeader
+	cHeaderSize := binary.Size(cHeader)
+	commandSize := cHeaderSize + len(commandBytes)
+
+	cmdBuf := getPacketBuffer(t.commandBufferSize())
+	defer putPacketBuffer(cmdBuf)
+
+	var packet []byte
+	if commandSize <= cap(*cmdBuf) {
+		packet = (*cmdBuf)[:commandSize]
+	} else {
+		packet = make([]byte, commandSize)
+	}
+	binary.BigEndian.PutUint16(packet[0:], uint16(tag))
+	binary.BigEndian.PutUint32(packet[2:], uint32(commandSize))
+	binary.BigEndian.PutUint32(packet[6:], uint32(commandCode))
+	copy(packet[cHeaderSize:], commandBytes)
 
-	if _, err := t.tcti.Write(bytes); err != nil {
-		return 0, 0, nil, &TctiError{"write", err}
+	if _, err := t.tcti.Write(packet); err != nil {
+		return &TctiError{"write", err}
 	}
+	return nil
+}
 
+// readResponseBytes reads the next response packet from the transmission interface. If rspBuf has sufficient capacity, the response
+// payload is read in to it and the returned slice aliases it.
+func (t *TPMContext) readResponseBytes(commandCode CommandCode, rspBuf []byte) (ResponseCode, StructTag, []byte, error) {
 	var rHeader responseHeader
 	rHeaderSize := uint32(binary.Size(rHeader))
 	rHeaderBytes := make([]byte, rHeaderSize)
 	if n, err := io.ReadFull(t.tcti, rHeaderBytes); err != nil {
 		if xerrors.Is(err, io.ErrUnexpectedEOF) {
-			return 0, 0, nil, &InvalidResponseError{commandCode, fmt.Sprintf("insufficient bytes for response header (got %d, expected %d)", n, rHeaderSize)}
+			return 0, 0, nil, &InvalidResponseError{Command: commandCode, Response: rHeaderBytes[:n],
+				msg: fmt.Sprintf("insufficient bytes for response header (got %d, expected %d)", n, rHeaderSize)}
 		}
 		return 0, 0, nil, &TctiError{"read", err}
 	}
@@ -161,13 +366,32 @@ func (t *TPMContext) RunCommandBytes(tag StructTag, commandCode CommandCode, com
 	}
 
 	if rHeader.ResponseSize < rHeaderSize {
-		return 0, 0, nil, &InvalidResponseError{commandCode, fmt.Sprintf("invalid responseSize value (%d)", rHeader.ResponseSize)}
+		return 0, 0, nil, &InvalidResponseError{Command: commandCode, Response: rHeaderBytes,
+			msg: fmt.Sprintf("invalid responseSize value (%d)", rHeader.ResponseSize)}
+	}
+
+	payloadSize := int(rHeader.ResponseSize - rHeaderSize)
+	if payloadSize > cap(rspBuf) {
+		// Don't trust the TPM's responseSize for allocating a buffer - read the payload in to a buffer that grows as bytes
+		// are received instead.
+		buf := new(bytes.Buffer)
+		if n, err := io.CopyN(buf, t.tcti, int64(payloadSize)); err != nil {
+			if err == io.EOF && n > 0 {
+				return 0, 0, nil, &InvalidResponseError{Command: commandCode,
+					Response: recordResponse(rHeader.Tag, rHeader.ResponseCode, buf.Bytes()),
+					msg:      fmt.Sprintf("insufficient bytes for response payload (got %d, expected %d)", n, payloadSize)}
+			}
+			return 0, 0, nil, &TctiError{"read", err}
+		}
+		return rHeader.ResponseCode, rHeader.Tag, buf.Bytes(), nil
 	}
 
-	responseBytes := make([]byte, rHeader.ResponseSize-rHeaderSize)
+	responseBytes := rspBuf[:payloadSize]
 	if n, err := io.ReadFull(t.tcti, responseBytes); err != nil {
 		if xerrors.Is(err, io.ErrUnexpectedEOF) {
-			return 0, 0, nil, &InvalidResponseError{commandCode, fmt.Sprintf("insufficient bytes for response payload (got %d, expected %d)", n, len(responseBytes))}
+			return 0, 0, nil, &InvalidResponseError{Command: commandCode,
+				Response: recordResponse(rHeader.Tag, rHeader.ResponseCode, responseBytes[:n]),
+				msg:      fmt.Sprintf("insufficient bytes for response payload (got %d, expected %d)", n, len(responseBytes))}
 		}
 		return 0, 0, nil, &TctiError{"read", err}
 	}
@@ -175,11 +399,21 @@ func (t *TPMContext) RunCommandBytes(tag StructTag, commandCode CommandCode, com
 	return rHeader.ResponseCode, rHeader.Tag, responseBytes, nil
 }
 
-func (t *TPMContext) runCommandWithoutProcessingAuthResponse(commandCode CommandCode, sessionParams *sessionParams, resources, params, outHandles []interface{}) error {
-	if t.currentCmd != nil {
-		panic("starting a new command without processing the auth response of the previous command")
-	}
+// preparedCommand is a command that has been marshalled and is ready to be submitted to the TPM.
+type preparedCommand struct {
+	commandCode     CommandCode
+	tag             StructTag
+	handles         []interface{}
+	handleNames     []Name
+	resources       []interface{}
+	sessionParams   *sessionParams
+	outHandles      []interface{}
+	packet          []byte // The command payload (everything except for the header)
+	capturedCommand []byte
+	audit           *auditCommand
+}
 
+func (t *TPMContext) prepareCommand(commandCode CommandCode, sessionParams *sessionParams, resources, params, outHandles []interface{}) (*preparedCommand, error) {
 	handles := make([]interface{}, 0, len(resources))
 	handleNames := make([]Name, 0, len(resources))
 
@@ -188,28 +422,46 @@ func (t *TPMContext) runCommandWithoutProcessingAuthResponse(commandCode Command
 		case HandleContext:
 			if r == nil {
 				handles = append(handles, HandleNull)
-				handleNames = append(handleNames, makeDummyContext(HandleNull).Name())
+				handleNames = append(handleNames, handleName(HandleNull))
 			} else {
 				handles = append(handles, r.Handle())
 				handleNames = append(handleNames, r.Name())
 			}
 		case nil:
 			handles = append(handles, HandleNull)
-			handleNames = append(handleNames, makeDummyContext(HandleNull).Name())
+			handleNames = append(handleNames, handleName(HandleNull))
 		default:
-			return fmt.Errorf("cannot process command handle context parameter for command %s at index %d: invalid type (%s)", commandCode, i, reflect.TypeOf(resource))
+			return nil, fmt.Errorf("cannot process command handle context parameter for command %s at index %d: invalid type (%s)", commandCode, i, reflect.TypeOf(resource))
 		}
 	}
 
 	for i, handle := range outHandles {
 		_, isHandle := handle.(*Handle)
 		if !isHandle {
-			return fmt.Errorf("cannot process response handle parameter for command %s at index %d: invalid type (%s)", commandCode, i, reflect.TypeOf(handle))
+			return nil, fmt.Errorf("cannot process response handle parameter for command %s at index %d: invalid type (%s)", commandCode, i, reflect.TypeOf(handle))
+		}
+	}
+
+	if err := sessionParams.useDefaultSession(t.defaultAuthSession); err != nil {
+		return nil, err
+	}
+
+	for _, s := range sessionParams.sessions {
+		if s.session != nil && t.isSessionDesynchronized(s.session) {
+			return nil, &SessionDesynchronizedError{Handle: s.session.Handle()}
+		}
+		if s.session == nil && s.isAuth() && t.rejectPasswordAuths {
+			return nil, &PasswordAuthorizationError{Command: commandCode, Handle: s.associatedContext.Handle()}
 		}
 	}
 
+	sessionParams.excludeUnsupportedParamEncryption(AttrCommandEncrypt, params)
+	if err := sessionParams.validateAttrs(commandCode); err != nil {
+		return nil, err
+	}
+
 	if sessionParams.hasDecryptSession() && (len(params) == 0 || !isParamEncryptable(params[0])) {
-		return fmt.Errorf("command %s does not support command parameter encryption", commandCode)
+		return nil, fmt.Errorf("command %s does not support command parameter encryption", commandCode)
 	}
 
 	cBytes := new(bytes.Buffer)
@@ -220,54 +472,205 @@ func (t *TPMContext) runCommandWithoutProcessingAuthResponse(commandCode Command
 
 	cpBytes := new(bytes.Buffer)
 	if _, err := mu.MarshalToWriter(cpBytes, params...); err != nil {
-		return xerrors.Errorf("cannot marshal command parameters for command %s: %w", commandCode, err)
+		return nil, xerrors.Errorf("cannot marshal command parameters for command %s: %w", commandCode, err)
 	}
 
 	tag := TagNoSessions
+	var cAuthArea commandAuthArea
 	if len(sessionParams.sessions) > 0 {
 		tag = TagSessions
-		authArea, err := sessionParams.buildCommandAuthArea(commandCode, handleNames, cpBytes.Bytes())
+		var err error
+		cAuthArea, err = sessionParams.buildCommandAuthArea(t.randReader(), commandCode, handleNames, cpBytes.Bytes())
 		if err != nil {
-			return xerrors.Errorf("cannot build command auth area for command %s: %w", commandCode, err)
+			return nil, xerrors.Errorf("cannot build command auth area for command %s: %w", commandCode, err)
 		}
-		if _, err := mu.MarshalToWriter(cBytes, &authArea); err != nil {
+		if _, err := mu.MarshalToWriter(cBytes, &cAuthArea); err != nil {
 			panic(fmt.Sprintf("cannot marshal command auth area: %v", err))
 		}
 	}
 
+	var audit *auditCommand
+	if len(t.auditVerifiers) > 0 {
+		audit = t.prepareAuditCommand(commandCode, handleNames, cpBytes.Bytes(), sessionParams)
+	}
+
+	var capturedCommand []byte
+	if t.captureCommands {
+		capturedCommand = captureCommandPacket(tag, commandCode, handles, cAuthArea, cpBytes.Bytes())
+	}
+
 	if _, err := cpBytes.WriteTo(cBytes); err != nil {
 		panic(fmt.Sprintf("cannot write command parameter bytes to command buffer: %v", err))
 	}
 
+	return &preparedCommand{
+		commandCode:     commandCode,
+		tag:             tag,
+		handles:         handles,
+		handleNames:     handleNames,
+		resources:       resources,
+		sessionParams:   sessionParams,
+		outHandles:      outHandles,
+		packet:          cBytes.Bytes(),
+		capturedCommand: capturedCommand,
+		audit:           audit}, nil
+}
+
+// recordCommand updates the statistics and metrics for a command submission, and notifies the CommandObserver.
+func (t *TPMContext) recordCommand(cmd *preparedCommand, duration time.Duration, responseCode ResponseCode) {
+	t.stats.record(cmd.commandCode, duration, responseCode)
+	if t.metrics != nil {
+		t.recordMetrics(cmd.commandCode, duration, responseCode)
+	}
+	if t.observer != nil {
+		observedHandles := make(HandleList, 0, len(cmd.handles))
+		for _, h := range cmd.handles {
+			observedHandles = append(observedHandles, h.(Handle))
+		}
+		t.observer.ObserveCommand(cmd.commandCode, observedHandles, duration, responseCode)
+	}
+}
+
+// submitPreparedCommand submits a prepared command to the TPM and processes the response, with the exception of the response
+// parameters and authorization area which are processed by processLastAuthResponse.
+func (t *TPMContext) submitPreparedCommand(cmd *preparedCommand) (err error) {
+	if t.currentCmd != nil {
+		panic("starting a new command without processing the auth response of the previous command")
+	}
+	t.invalidatedSessions = nil
+
+	commandCode := cmd.commandCode
+	tag := cmd.tag
+	sessionParams := cmd.sessionParams
+	capturedCommand := cmd.capturedCommand
+
+	if capturedCommand != nil {
+		defer func() {
+			if err != nil {
+				err = &CapturedCommandError{Packet: capturedCommand, err: err}
+			}
+		}()
+	}
+
+	// The response buffer is retained by the cmdContext on success, and released once the response parameters have been processed.
+	rspBuf := getPacketBuffer(t.responseBufferSize())
+	defer func() {
+		if err != nil {
+			putPacketBuffer(rspBuf)
+		}
+	}()
+
 	var responseCode ResponseCode
 	var responseTag StructTag
 	var responseBytes []byte
+	var readyDeadline time.Time
 
 	for tries := uint(1); ; tries++ {
 		var err error
-		responseCode, responseTag, responseBytes, err = t.RunCommandBytes(tag, commandCode, cBytes.Bytes())
+		start := t.now()
+		responseCode, responseTag, responseBytes, err = t.runCommandBytes(tag, commandCode, cmd.packet, *rspBuf)
 		if err != nil {
+			t.markSessionsDesynchronized(sessionParams)
 			return err
 		}
+		t.recordCommand(cmd, t.now().Sub(start), responseCode)
 
-		err = DecodeResponseCode(commandCode, responseCode)
-		if err == nil {
+		if responseCode == Success {
 			break
 		}
+		err = t.makeResponseError(cmd, responseCode)
 
-		if tries >= t.maxSubmissions {
-			return err
+		if IsTPMError(err, ErrorNeedsTest, AnyCommandCode) || IsTPMError(err, ErrorFailure, AnyCommandCode) {
+			t.selfTestState = selfTestStateUnknown
+		}
+
+		waitTimeout := t.waitForReadyTimeout
+		if waitTimeout == 0 && t.selfTestState == selfTestStateRunning && IsTPMWarning(err, WarningTesting, AnyCommandCode) {
+			waitTimeout = selfTestWaitTimeout
 		}
-		if e, ok := err.(*TPMWarning); !ok || !(e.Code == WarningYielded || e.Code == WarningTesting || e.Code == WarningRetry) {
+
+		if waitTimeout > 0 && isTPMNotReadyError(err) {
+			if readyDeadline.IsZero() {
+				readyDeadline = t.now().Add(waitTimeout)
+			}
+			if t.now().Before(readyDeadline) {
+				// Resubmissions whilst waiting for the TPM don't count towards the maximum number of submissions.
+				t.wait(waitForReadyInterval)
+				tries--
+				continue
+			}
 			return err
 		}
+
+		if tries >= t.maxSubmissions {
+			return t.annotateHierarchyDisabledError(makeTypedFailureError(err), cmd.resources)
+		}
+		if !t.retryPolicy(err) {
+			return t.annotateHierarchyDisabledError(makeTypedFailureError(err), cmd.resources)
+		}
 	}
 
-	buf := bytes.NewReader(responseBytes)
+	if err := t.completePreparedCommand(cmd, responseCode, responseTag, responseBytes, rspBuf); err != nil {
+		t.markSessionsDesynchronized(sessionParams)
+		return err
+	}
+	return nil
+}
+
+// makeResponseError returns the error for an unsuccessful response to a prepared command, annotated with the handle, session
+// and vendor details that are available.
+func (t *TPMContext) makeResponseError(cmd *preparedCommand, responseCode ResponseCode) error {
+	err := DecodeResponseCode(cmd.commandCode, responseCode)
+	annotateResponseError(err, cmd.handles, cmd.handleNames, cmd.sessionParams)
+	t.decodeVendorError(err)
+	return err
+}
+
+// markSessionsDesynchronized records that the host's copy of the nonces for the sessions used in a command may no longer match the
+// TPM's, because the TPM may have executed the command without a valid response being received. Commands that fail with a TPM error
+// don't affect the nonces, so this is only used when a response can't be read or decoded.
+func (t *TPMContext) markSessionsDesynchronized(sessionParams *sessionParams) {
+	for _, s := range sessionParams.sessions {
+		if s.session == nil {
+			continue
+		}
+		if t.desyncedSessions == nil {
+			t.desyncedSessions = make(map[*sessionContextData]struct{})
+		}
+		t.desyncedSessions[s.session.Data()] = struct{}{}
+	}
+}
+
+func (t *TPMContext) isSessionDesynchronized(session *sessionContext) bool {
+	data := session.Data()
+	if data == nil {
+		return false
+	}
+	_, desynced := t.desyncedSessions[data]
+	return desynced
+}
+
+// completePreparedCommand unmarshals the response handles and authorization area from the successful response to a prepared command,
+// and retains the response for processLastAuthResponse. On success, the response buffer is owned by the returned command context and
+// is released by processLastAuthResponse, else it must be released by the caller.
+func (t *TPMContext) completePreparedCommand(cmd *preparedCommand, responseCode ResponseCode, responseTag StructTag, responseBytes []byte, rspBuf *[]byte) error {
+	commandCode := cmd.commandCode
+	tag := cmd.tag
+	sessionParams := cmd.sessionParams
+	outHandles := cmd.outHandles
+
+	makeInvalidResponseError := func(msg string) error {
+		return &InvalidResponseError{Command: commandCode, Response: recordResponse(responseTag, responseCode, responseBytes), msg: msg}
+	}
+
+	u, err := mu.NewUnmarshaller(bytes.NewReader(responseBytes))
+	if err != nil {
+		panic(fmt.Sprintf("cannot create unmarshaller for response payload: %v", err))
+	}
 
 	if len(outHandles) > 0 {
-		if _, err := mu.UnmarshalFromReader(buf, outHandles...); err != nil {
-			return &InvalidResponseError{commandCode, fmt.Sprintf("cannot unmarshal response handles: %v", err)}
+		if err := u.Unmarshal(outHandles...); err != nil {
+			return makeInvalidResponseError(fmt.Sprintf("cannot unmarshal response handles: %v", err))
 		}
 	}
 
@@ -277,29 +680,48 @@ func (t *TPMContext) runCommandWithoutProcessingAuthResponse(commandCode Command
 	switch responseTag {
 	case TagSessions:
 		var parameterSize uint32
-		if _, err := mu.UnmarshalFromReader(buf, &parameterSize); err != nil {
-			return &InvalidResponseError{commandCode, fmt.Sprintf("cannot unmarshal response parameterSize: %v", err)}
+		if err := u.Unmarshal(&parameterSize); err != nil {
+			return makeInvalidResponseError(fmt.Sprintf("cannot unmarshal response parameterSize: %v", err))
+		}
+		if int64(parameterSize) > int64(u.Len()) {
+			return makeInvalidResponseError(fmt.Sprintf("invalid response parameterSize value (%d)", parameterSize))
 		}
 		rpBytes = make([]byte, parameterSize)
-		if _, err := io.ReadFull(buf, rpBytes); err != nil {
-			return &InvalidResponseError{commandCode, fmt.Sprintf("cannot read response parameter area: %v", err)}
+		if _, err := io.ReadFull(u, rpBytes); err != nil {
+			return makeInvalidResponseError(fmt.Sprintf("cannot read response parameter area: %v", err))
 		}
 
 		authArea.Data = make([]authResponse, len(sessionParams.sessions))
-		if _, err := mu.UnmarshalFromReader(buf, &authArea); err != nil {
-			return &InvalidResponseError{commandCode, fmt.Sprintf("cannot unmarshal response auth area: %v", err)}
+		if err := u.Unmarshal(&authArea); err != nil {
+			return makeInvalidResponseError(fmt.Sprintf("cannot unmarshal response auth area: %v", err))
 		}
 	case TagNoSessions:
-		rpBytes = make([]byte, buf.Len())
-		if _, err := io.ReadFull(buf, rpBytes); err != nil {
-			return &InvalidResponseError{commandCode, fmt.Sprintf("cannot read response parameter area: %v", err)}
+		rpBytes = make([]byte, u.Len())
+		if _, err := io.ReadFull(u, rpBytes); err != nil {
+			return makeInvalidResponseError(fmt.Sprintf("cannot read response parameter area: %v", err))
 		}
 	default:
-		return &InvalidResponseError{commandCode, fmt.Sprintf("unexpected response tag: %v", responseTag)}
+		return makeInvalidResponseError(fmt.Sprintf("unexpected response tag: %v", responseTag))
 	}
 
-	if buf.Len() > 0 {
-		return &InvalidResponseError{commandCode, fmt.Sprintf("response payload contains %d trailing bytes", buf.Len())}
+	if u.Len() > 0 {
+		return makeInvalidResponseError(fmt.Sprintf("response payload contains %d trailing bytes", u.Len()))
+	}
+
+	if t.strictResponses {
+		if responseTag != tag {
+			return makeInvalidResponseError(fmt.Sprintf("unexpected response tag for command with tag %v: %v", tag, responseTag))
+		}
+		for i, h := range outHandles {
+			switch handle := *h.(*Handle); handle.Type() {
+			case HandleTypeTransient, HandleTypeHMACSession, HandleTypePolicySession:
+			default:
+				return makeInvalidResponseError(fmt.Sprintf("invalid type for response handle %d (0x%08x)", i, handle))
+			}
+		}
+		if err := sessionParams.validateResponseAuthArea(authArea.Data); err != nil {
+			return makeInvalidResponseError(fmt.Sprintf("invalid response auth area: %v", err))
+		}
 	}
 
 	t.currentCmd = &cmdContext{
@@ -308,25 +730,63 @@ func (t *TPMContext) runCommandWithoutProcessingAuthResponse(commandCode Command
 		responseCode:     responseCode,
 		responseTag:      responseTag,
 		responseAuthArea: authArea.Data,
-		rpBytes:          rpBytes}
+		rpBytes:          rpBytes,
+		responseBytes:    responseBytes,
+		responseBuffer:   rspBuf,
+		capturedCommand:  cmd.capturedCommand,
+		audit:            cmd.audit}
 	return nil
 }
 
-func (t *TPMContext) processLastAuthResponse(params []interface{}) error {
+func (t *TPMContext) runCommandWithoutProcessingAuthResponse(commandCode CommandCode, sessionParams *sessionParams, resources, params, outHandles []interface{}) error {
+	cmd, err := t.prepareCommand(commandCode, sessionParams, resources, params, outHandles)
+	if err != nil {
+		return err
+	}
+	return t.submitPreparedCommand(cmd)
+}
+
+func (t *TPMContext) processLastAuthResponse(params []interface{}) (err error) {
 	if t.currentCmd == nil {
 		panic("no command to process an auth response for")
 	}
 
 	cmd := t.currentCmd
 	t.currentCmd = nil
+	defer putPacketBuffer(cmd.responseBuffer)
+
+	if cmd.capturedCommand != nil {
+		defer func() {
+			if err != nil {
+				err = &CapturedCommandError{Packet: cmd.capturedCommand, err: err}
+			}
+		}()
+	}
+
+	makeInvalidResponseError := func(msg string) error {
+		return &InvalidResponseError{Command: cmd.commandCode, Response: recordResponse(cmd.responseTag, cmd.responseCode, cmd.responseBytes),
+			msg: msg}
+	}
 
 	if cmd.responseTag == TagSessions {
-		if err := cmd.sessionParams.processResponseAuthArea(cmd.responseAuthArea, cmd.responseCode, cmd.rpBytes); err != nil {
-			return &InvalidResponseError{cmd.commandCode, fmt.Sprintf("cannot process response auth area: %v", err)}
+		var rpHash Digest
+		if cmd.audit != nil {
+			// The response parameters are decrypted in place, so compute the audit digest first.
+			rpHash = cryptComputeRpHash(cmd.audit.verifier.hashAlg, cmd.responseCode, cmd.commandCode, cmd.rpBytes)
+		}
+		err := cmd.sessionParams.processResponseAuthArea(cmd.responseAuthArea, cmd.responseCode, cmd.rpBytes)
+		t.invalidatedSessions = cmd.sessionParams.invalidateSessionContexts(cmd.responseAuthArea)
+		if err != nil {
+			return makeInvalidResponseError(fmt.Sprintf("cannot process response auth area: %v", err))
+		}
+		if cmd.audit != nil {
+			exclusive := cmd.responseAuthArea[cmd.audit.index].SessionAttrs&attrAuditExclusive != 0
+			cmd.audit.verifier.record(cmd.commandCode, cmd.audit.reset, cmd.audit.cpHash, rpHash, exclusive)
 		}
 	}
 
 	if isSessionAllowed(cmd.commandCode) {
+		t.recordAuditInterruptions(cmd.commandCode, cmd.audit)
 		if t.exclusiveSession != nil {
 			t.exclusiveSession.Data().IsExclusive = false
 		}
@@ -350,17 +810,147 @@ func (t *TPMContext) processLastAuthResponse(params []interface{}) error {
 
 	if len(params) > 0 {
 		if _, err := mu.UnmarshalFromReader(rpBuf, params...); err != nil {
-			return &InvalidResponseError{cmd.commandCode, fmt.Sprintf("cannot unmarshal response parameters: %v", err)}
+			return makeInvalidResponseError(fmt.Sprintf("cannot unmarshal response parameters: %v", err))
 		}
 	}
 
 	if rpBuf.Len() > 0 {
-		return &InvalidResponseError{cmd.commandCode, fmt.Sprintf("response parameter area contains %d trailing bytes", rpBuf.Len())}
+		return makeInvalidResponseError(fmt.Sprintf("response parameter area contains %d trailing bytes", rpBuf.Len()))
 	}
 
 	return nil
 }
 
+// pipelinedCommand is a command to be executed by runPipelined. The params field contains command handles, command parameters,
+// response handles and response parameters in the same form as they are supplied to RunCommand.
+type pipelinedCommand struct {
+	commandCode CommandCode
+	params      []interface{}
+}
+
+// canPipeline indicates whether a sequence of commands with the specified sessions can be executed with runPipelined. This requires
+// a transmission interface that supports pipelining, and that there are no sessions other than password authorizations, as the
+// HMAC for each command depends on the nonce returned in the response to the previous one.
+func (t *TPMContext) canPipeline(authSession SessionContext, sessions []SessionContext) bool {
+	if (authSession != nil && !isPasswordSession(authSession)) || len(sessions) > 0 || t.captureCommands {
+		return false
+	}
+	p, ok := t.tcti.(PipelinedTCTI)
+	return ok && p.SupportsPipelining()
+}
+
+// runPipelined executes the supplied sequence of commands, writing each command to the transmission interface before the response
+// to the previous command has been read. It should only be used if canPipeline returns true.
+//
+// Pipelining only starts once the first command has succeeded, so that a command with an incorrect authorization value is never
+// submitted more than once, which would otherwise count as multiple dictionary attack failures.
+//
+// If the TPM responds to a command with a warning that is accepted by the retry policy, the response to the command that is still
+// outstanding is read and discarded, and the index of the failed command is returned without an error. This allows the caller to
+// execute the remaining commands in the sequence with RunCommand, in order to benefit from its retry and error handling. Commands
+// in the sequence must therefore be safe to execute more than once. Any other error from the TPM is returned along with the index
+// of the failed command, and the caller must not resubmit it. The returned index is the number of commands that completed
+// successfully.
+func (t *TPMContext) runPipelined(cmds []pipelinedCommand) (int, error) {
+	if t.currentCmd != nil {
+		panic("starting a new command without processing the auth response of the previous command")
+	}
+	t.invalidatedSessions = nil
+
+	type outstandingCommand struct {
+		cmd            *preparedCommand
+		responseParams []interface{}
+		start          time.Time
+	}
+	var pending []outstandingCommand
+
+	write := func(c pipelinedCommand) error {
+		p, err := splitCommandParams(c.commandCode, nil, c.params)
+		if err != nil {
+			return err
+		}
+		cmd, err := t.prepareCommand(c.commandCode, &p.sessionParams, p.commandHandles, p.commandParams, p.responseHandles)
+		if err != nil {
+			return err
+		}
+		if err := t.writeCommandBytes(cmd.tag, cmd.commandCode, cmd.packet); err != nil {
+			return err
+		}
+		pending = append(pending, outstandingCommand{cmd: cmd, responseParams: p.responseParams, start: t.now()})
+		return nil
+	}
+
+	drain := func() {
+		for _, o := range pending {
+			rspBuf := getPacketBuffer(t.responseBufferSize())
+			if rc, _, _, err := t.readResponseBytes(o.cmd.commandCode, *rspBuf); err == nil {
+				t.recordCommand(o.cmd, t.now().Sub(o.start), rc)
+			}
+			putPacketBuffer(rspBuf)
+		}
+		pending = nil
+	}
+
+	if len(cmds) == 0 {
+		return 0, nil
+	}
+	if err := write(cmds[0]); err != nil {
+		return 0, err
+	}
+
+	for i := range cmds {
+		var writeErr error
+		if i > 0 && i+1 < len(cmds) {
+			writeErr = write(cmds[i+1])
+		}
+
+		o := pending[0]
+		pending = pending[1:]
+
+		rspBuf := getPacketBuffer(t.responseBufferSize())
+		responseCode, responseTag, responseBytes, err := t.readResponseBytes(o.cmd.commandCode, *rspBuf)
+		if err != nil {
+			putPacketBuffer(rspBuf)
+			return i, err
+		}
+		t.recordCommand(o.cmd, t.now().Sub(o.start), responseCode)
+		if len(pending) > 0 {
+			// The TPM only starts executing the next command once it has finished with this one.
+			pending[0].start = t.now()
+		}
+
+		if responseCode != Success {
+			putPacketBuffer(rspBuf)
+			drain()
+
+			err := t.makeResponseError(o.cmd, responseCode)
+			if !t.retryPolicy(err) {
+				return i, t.annotateHierarchyDisabledError(makeTypedFailureError(err), o.cmd.resources)
+			}
+			return i, writeErr
+		}
+		if err := t.completePreparedCommand(o.cmd, responseCode, responseTag, responseBytes, rspBuf); err != nil {
+			putPacketBuffer(rspBuf)
+			drain()
+			return i, err
+		}
+		if err := t.processLastAuthResponse(o.responseParams); err != nil {
+			drain()
+			return i, err
+		}
+
+		if i == 0 && len(cmds) > 1 {
+			// The first command succeeded, so the remaining commands can be pipelined.
+			writeErr = write(cmds[1])
+		}
+		if writeErr != nil {
+			return i + 1, writeErr
+		}
+	}
+
+	return len(cmds), nil
+}
+
 // RunCommand is the high-level generic interface for executing the command specified by commandCode. All of the methods on TPMContext
 // exported by this package that execute commands on the TPM are essentially wrappers around this function. It takes care of
 // marshalling command handles and command parameters, as well as constructing and marshalling the authorization area and choosing
@@ -385,7 +975,7 @@ func (t *TPMContext) processLastAuthResponse(params []interface{}) error {
 //
 // If the TPM responds with a warning that indicates the command could not be started and should be retried, this function will
 // resubmit the command a finite number of times before returning an error. The maximum number of retries can be set via
-// TPMContext.SetMaxSubmissions.
+// TPMContext.SetMaxSubmissions, and the errors for which commands are resubmitted can be customized via TPMContext.SetRetryPolicy.
 //
 // The caller can provide additional sessions that aren't associated with a TPM entity (and therefore not used for authorization) via
 // the sessions parameter, for the purposes of command auditing or session based parameter encryption.
@@ -393,6 +983,28 @@ func (t *TPMContext) processLastAuthResponse(params []interface{}) error {
 // In addition to returning an error if any marshalling or unmarshalling fails, or if the transmission backend returns an error,
 // this function will also return an error if the TPM responds with any ResponseCode other than Success.
 func (t *TPMContext) RunCommand(commandCode CommandCode, sessions []SessionContext, params ...interface{}) error {
+	p, err := splitCommandParams(commandCode, sessions, params)
+	if err != nil {
+		return err
+	}
+
+	if err := t.runCommandWithoutProcessingAuthResponse(commandCode, &p.sessionParams, p.commandHandles, p.commandParams, p.responseHandles); err != nil {
+		return err
+	}
+
+	return t.processLastAuthResponse(p.responseParams)
+}
+
+// runCommandParams contains the arguments supplied to RunCommand, split in to their separate groups.
+type runCommandParams struct {
+	commandHandles  []interface{}
+	commandParams   []interface{}
+	responseHandles []interface{}
+	responseParams  []interface{}
+	sessionParams   sessionParams
+}
+
+func splitCommandParams(commandCode CommandCode, sessions []SessionContext, params []interface{}) (*runCommandParams, error) {
 	var commandHandles []interface{}
 	var commandParams []interface{}
 	var responseHandles []interface{}
@@ -412,7 +1024,7 @@ func (t *TPMContext) RunCommand(commandCode CommandCode, sessions []SessionConte
 			case ResourceContextWithSession:
 				commandHandles = append(commandHandles, p.Context)
 				if err := sessionParams.validateAndAppendAuth(p); err != nil {
-					return fmt.Errorf("cannot process ResourceContextWithSession for command %s at index %d: %v", commandCode, len(commandHandles), err)
+					return nil, fmt.Errorf("cannot process ResourceContextWithSession for command %s at index %d: %v", commandCode, len(commandHandles), err)
 				}
 			default:
 				commandHandles = append(commandHandles, param)
@@ -427,14 +1039,20 @@ func (t *TPMContext) RunCommand(commandCode CommandCode, sessions []SessionConte
 	}
 
 	if err := sessionParams.validateAndAppendExtra(sessions); err != nil {
-		return fmt.Errorf("cannot process non-auth SessionContext parameters for command %s: %v", commandCode, err)
+		return nil, fmt.Errorf("cannot process non-auth SessionContext parameters for command %s: %v", commandCode, err)
 	}
 
-	if err := t.runCommandWithoutProcessingAuthResponse(commandCode, &sessionParams, commandHandles, commandParams, responseHandles); err != nil {
-		return err
+	sessionParams.excludeUnsupportedParamEncryption(AttrResponseEncrypt, responseParams)
+	if sessionParams.hasEncryptSession() && (len(responseParams) == 0 || !isParamEncryptable(responseParams[0])) {
+		return nil, fmt.Errorf("command %s does not support response parameter encryption", commandCode)
 	}
 
-	return t.processLastAuthResponse(responseParams)
+	return &runCommandParams{
+		commandHandles:  commandHandles,
+		commandParams:   commandParams,
+		responseHandles: responseHandles,
+		responseParams:  responseParams,
+		sessionParams:   sessionParams}, nil
 }
 
 // SetMaxSubmissions sets the maximum number of times that RunCommand will attempt to submit a command before failing with an error.
@@ -443,6 +1061,150 @@ func (t *TPMContext) SetMaxSubmissions(max uint) {
 	t.maxSubmissions = max
 }
 
+// SetRetryPolicy sets the policy used by RunCommand to decide whether to resubmit a command that fails with an error. Setting this
+// to nil restores DefaultRetryPolicy.
+func (t *TPMContext) SetRetryPolicy(policy RetryPolicy) {
+	if policy == nil {
+		policy = DefaultRetryPolicy
+	}
+	t.retryPolicy = policy
+}
+
+// SetWaitForReady configures RunCommand to wait for the TPM to become ready when a command fails because the TPM is performing
+// self tests (TPM_RC_TESTING) or because NV memory is temporarily unavailable (TPM_RC_NV_UNAVAILABLE), which can happen shortly
+// after startup. If enabled, the command is resubmitted periodically until it succeeds, fails with another error or the specified
+// timeout elapses, in which case the last error is returned. These resubmissions don't count towards the limit set by
+// TPMContext.SetMaxSubmissions.
+//
+// A timeout of zero disables waiting, which is the default. In this case, TPM_RC_TESTING is handled by the RetryPolicy and
+// TPM_RC_NV_UNAVAILABLE is returned to the caller, unless a self test was started with TPMContext.SelfTest, in which case
+// TPM_RC_TESTING is waited on for a short period.
+func (t *TPMContext) SetWaitForReady(timeout time.Duration) {
+	t.waitForReadyTimeout = timeout
+}
+
+// SetCommandObserver sets the CommandObserver that is notified of every command submitted by RunCommand. Setting this to nil
+// removes any existing observer.
+func (t *TPMContext) SetCommandObserver(observer CommandObserver) {
+	t.observer = observer
+}
+
+// SetStrictResponseValidation enables or disables additional checks on successful responses. When enabled, RunCommand returns an
+// *InvalidResponseError if the response tag does not match the command tag, if a response handle has a type that cannot be returned
+// by any command, or if the response authorization area contains attributes or nonces that are not consistent with the sessions
+// supplied with the command. This can be used to detect misbehaving TPM firmware or proxies early. It is disabled by default.
+func (t *TPMContext) SetStrictResponseValidation(enable bool) {
+	t.strictResponses = enable
+}
+
+// SetCaptureCommandOnError enables or disables the capture of command packets for post-mortem analysis. When enabled, errors that
+// occur after a command has been submitted to the TPM (including errors returned from the TPM and *InvalidResponseError) are
+// returned wrapped in a *CapturedCommandError, which contains the serialized command packet that was sent. Cleartext authorization
+// values supplied for password authorizations are redacted from the captured packet, but command parameters are captured as they
+// were sent and may contain sensitive data, such as new authorization values. It is disabled by default.
+func (t *TPMContext) SetCaptureCommandOnError(enable bool) {
+	t.captureCommands = enable
+}
+
+// SetRejectPasswordAuthorizations enables or disables the rejection of commands that are supplied with password authorizations,
+// which are used when no session or the session returned from PasswordSession is supplied for a resource that requires
+// authorization. Password authorizations transmit authorization values to the TPM in cleartext, where they can be observed by an
+// adversary with access to the TPM bus. When enabled, any method that executes a command with a password authorization returns a
+// *PasswordAuthorizationError without submitting the command, so that HMAC or policy sessions (such as the session associated
+// with a SecureChannel) must be used for all authorizations. This applies even to resources with an empty authorization value. It
+// is disabled by default.
+func (t *TPMContext) SetRejectPasswordAuthorizations(reject bool) {
+	t.rejectPasswordAuths = reject
+}
+
+// SetDefaultAuthSession sets a HMAC session that is used in place of a password authorization when executing a command, which
+// happens when no session or the session returned from PasswordSession is supplied for a resource that requires authorization.
+// As a session can only be supplied once for each command, it only replaces the first password authorization and it isn't used
+// for commands that it is already supplied to. The AttrCommandEncrypt and AttrResponseEncrypt attributes of the session are
+// ignored for commands that are supplied with other sessions that are used for parameter encryption.
+//
+// TPMContext.OpenSecureChannel sets the session associated with the returned channel as the default. Supplying a nil session
+// disables this, which is the default.
+func (t *TPMContext) SetDefaultAuthSession(session SessionContext) {
+	sc, _ := session.(*sessionContext)
+	if sc != nil && sc.isPassword() {
+		sc = nil
+	}
+	t.defaultAuthSession = sc
+}
+
+// SetConsistencyChecks enables or disables the checks that the name returned from the TPM is consistent with the public area of an
+// object or NV index, which are performed when creating a ResourceContext with TPMContext.CreateResourceContextFromTPM and when
+// loading or creating objects. These checks require the public area to be hashed, which is measurable on some platforms. They should
+// only be disabled where the TPM is trusted, such as when communicating with a local simulator in tests. They are enabled by default.
+func (t *TPMContext) SetConsistencyChecks(enable bool) {
+	t.skipConsistencyChecks = !enable
+}
+
+// SetRandomSource sets the source of randomness used for generating caller nonces, salts and ephemeral keys for sessions started
+// with this TPMContext. This can be used to integrate a hardware RNG, or to make session establishment deterministic in tests.
+// Setting this to nil restores the default, which is crypto/rand.Reader.
+//
+// The supplied reader must be a cryptographically secure source of random bytes unless it is being used for testing.
+func (t *TPMContext) SetRandomSource(rand io.Reader) {
+	t.random = rand
+}
+
+// SetClock sets the Clock used by this TPMContext for measuring the duration of commands and for waiting between command
+// submissions. This can be used to make the durations reported to a CommandObserver and Metrics implementation reproducible in
+// tests. Setting this to nil restores the default, which uses the system time.
+func (t *TPMContext) SetClock(clock Clock) {
+	t.clock = clock
+}
+
+// SetLocality sets the locality at which subsequent commands are executed, by calling SetLocality on the transmission interface.
+// Commands can only be executed at localities 1-4 if the transmission interface and platform support it, in which case this
+// permits the use of policies that contain TPM2_PolicyLocality assertions and the use of PCRs that can only be extended or reset
+// from specific localities. The locality is unchanged if the transmission interface returns an error.
+func (t *TPMContext) SetLocality(locality uint8) error {
+	if err := t.tcti.SetLocality(locality); err != nil {
+		return &TctiError{"setLocality", err}
+	}
+	t.locality = locality
+	return nil
+}
+
+// Locality returns the locality at which commands are executed, as set by TPMContext.SetLocality. This returns 0 if the locality
+// has not been set with this TPMContext.
+func (t *TPMContext) Locality() uint8 {
+	return t.locality
+}
+
+func (t *TPMContext) now() time.Time {
+	if t.clock == nil {
+		return systemClock{}.Now()
+	}
+	return t.clock.Now()
+}
+
+func (t *TPMContext) wait(d time.Duration) {
+	if t.clock == nil {
+		systemClock{}.Sleep(d)
+		return
+	}
+	t.clock.Sleep(d)
+}
+
+func (t *TPMContext) randReader() io.Reader {
+	if t.random == nil {
+		return rand.Reader
+	}
+	return t.random
+}
+
+// InvalidatedSessions returns the SessionContext instances supplied to the most recently executed command that were invalidated because
+// the TPM flushed the corresponding sessions, which happens when a session is used without the AttrContinueSession attribute. The
+// returned instances can no longer be used, and applications can use this to determine which sessions need to be started again.
+// The list is cleared when the next command is executed.
+func (t *TPMContext) InvalidatedSessions() []SessionContext {
+	return t.invalidatedSessions
+}
+
 // InitProperties executes a TPM2_GetCapability command to initialize properties used internally by TPMContext. This is normally done
 // automatically by functions that require these properties when they are used for the first time, but this function is provided so
 // that the command can be audited, and so the exclusivity of an audit session can be preserved.
@@ -460,6 +1222,13 @@ func (t *TPMContext) InitProperties(sessions ...SessionContext) error {
 			t.maxDigestSize = int(prop.Value)
 		case PropertyNVBufferMax:
 			t.maxNVBufferSize = int(prop.Value)
+		case PropertyMaxCommandSize:
+			t.maxCommandSize = int(prop.Value)
+		case PropertyMaxResponseSize:
+			t.maxResponseSize = int(prop.Value)
+		case PropertyManufacturer:
+			manufacturer := TPMManufacturer(prop.Value)
+			t.manufacturer = &manufacturer
 		}
 	}
 
@@ -476,6 +1245,22 @@ func (t *TPMContext) InitProperties(sessions ...SessionContext) error {
 	return nil
 }
 
+// commandBufferSize returns the size of the pooled buffers used to assemble command packets.
+func (t *TPMContext) commandBufferSize() int {
+	if t.maxCommandSize > 0 {
+		return t.maxCommandSize
+	}
+	return defaultPacketBufferSize
+}
+
+// responseBufferSize returns the size of the pooled buffers in to which response payloads are read.
+func (t *TPMContext) responseBufferSize() int {
+	if t.maxResponseSize > 0 {
+		return t.maxResponseSize
+	}
+	return defaultPacketBufferSize
+}
+
 func (t *TPMContext) initPropertiesIfNeeded() error {
 	if t.propertiesInitialized {
 		return nil
@@ -488,6 +1273,7 @@ func newTpmContext(tcti TCTI) *TPMContext {
 	r.tcti = tcti
 	r.permanentResources = make(map[Handle]*permanentContext)
 	r.maxSubmissions = 5
+	r.retryPolicy = DefaultRetryPolicy
 
 	return r
 }
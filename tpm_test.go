@@ -9,17 +9,22 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
 	"flag"
 	"fmt"
 	"math/big"
 	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	. "github.com/canonical/go-tpm2"
 	"github.com/canonical/go-tpm2/mu"
 	"github.com/canonical/go-tpm2/testutil"
 
+	"golang.org/x/xerrors"
+
 	. "gopkg.in/check.v1"
 )
 
@@ -29,11 +34,767 @@ func init() {
 
 func Test(t *testing.T) { TestingT(t) }
 
+func TestRetryPolicy(t *testing.T) {
+	nvRate := mockCommand(CommandSelfTest, ResponseCode(0x920))
+	retry := mockCommand(CommandSelfTest, ResponseCode(0x922))
+	success := mockCommand(CommandSelfTest, Success)
+
+	for _, data := range []struct {
+		desc      string
+		policy    RetryPolicy
+		responses []*testutil.MockCommand
+		commands  int
+		err       WarningCode
+	}{
+		{desc: "DefaultRetry", responses: []*testutil.MockCommand{retry, retry, success}, commands: 3},
+		{desc: "DefaultNoRetry", responses: []*testutil.MockCommand{nvRate, success}, commands: 1, err: WarningNVRate},
+		{desc: "Custom", policy: IsRetryableError, responses: []*testutil.MockCommand{nvRate, retry, success}, commands: 3},
+		{desc: "MaxSubmissions", responses: []*testutil.MockCommand{retry, retry, retry, retry, retry, success}, commands: 5, err: WarningRetry},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			tcti := testutil.NewMockTCTI(data.responses...)
+			tpm, _ := NewTPMContext(tcti)
+			tpm.SetRetryPolicy(data.policy)
+
+			err := tpm.SelfTest(false)
+			if data.err == 0 && err != nil {
+				t.Errorf("SelfTest failed: %v", err)
+			}
+			if data.err != 0 && !IsTPMWarning(err, data.err, CommandSelfTest) {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if len(tcti.Commands()) != data.commands {
+				t.Errorf("Unexpected number of submissions: %d", len(tcti.Commands()))
+			}
+		})
+	}
+}
+
+func TestWaitForReady(t *testing.T) {
+	testingRsp := mockCommand(CommandSelfTest, ResponseCode(0x90a))
+	nvUnavailable := mockCommand(CommandSelfTest, ResponseCode(0x923))
+	success := mockCommand(CommandSelfTest, Success)
+
+	for _, data := range []struct {
+		desc      string
+		timeout   time.Duration
+		responses []*testutil.MockCommand
+		commands  int
+		err       WarningCode
+	}{
+		{desc: "Disabled", responses: []*testutil.MockCommand{nvUnavailable, success}, commands: 1, err: WarningNVUnavailable},
+		{desc: "NVUnavailable", timeout: time.Minute, responses: []*testutil.MockCommand{nvUnavailable, nvUnavailable, success}, commands: 3},
+		{desc: "Testing", timeout: time.Minute,
+			responses: []*testutil.MockCommand{testingRsp, testingRsp, testingRsp, testingRsp, testingRsp, testingRsp, success}, commands: 7},
+		{desc: "Timeout", timeout: 5 * time.Millisecond,
+			responses: []*testutil.MockCommand{testingRsp, testingRsp, testingRsp, testingRsp, testingRsp, testingRsp, testingRsp, testingRsp}, err: WarningTesting},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			var slept time.Duration
+			restore := MockSleep(func(d time.Duration) {
+				slept += d
+				time.Sleep(time.Millisecond)
+			})
+			defer restore()
+
+			tcti := testutil.NewMockTCTI(data.responses...)
+			tpm, _ := NewTPMContext(tcti)
+			tpm.SetWaitForReady(data.timeout)
+
+			err := tpm.SelfTest(false)
+			if data.err == 0 && err != nil {
+				t.Errorf("SelfTest failed: %v", err)
+			}
+			if data.err != 0 && !IsTPMWarning(err, data.err, CommandSelfTest) {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if data.commands > 0 && len(tcti.Commands()) != data.commands {
+				t.Errorf("Unexpected number of submissions: %d", len(tcti.Commands()))
+			}
+			if data.timeout > 0 && slept == 0 {
+				t.Errorf("Expected a delay between submissions")
+			}
+		})
+	}
+}
+
+func TestSelfTestTracking(t *testing.T) {
+	var slept time.Duration
+	restore := MockSleep(func(d time.Duration) { slept += d })
+	defer restore()
+
+	testingRsp := mockCommand(CommandPCRReset, ResponseCode(0x90a))
+	tcti := testutil.NewMockTCTI(
+		mockCommand(CommandSelfTest, Success),
+		testingRsp, testingRsp, testingRsp, testingRsp, testingRsp, testingRsp, mockCommand(CommandPCRReset, Success),
+		&testutil.MockCommand{CommandCode: CommandGetTestResult, Response: &testutil.MockResponse{Params: []interface{}{MaxBuffer(nil), Success}}},
+		mockCommand(CommandSelfTest, Success),
+		mockCommand(CommandPCRReset, ResponseCode(0x153)), // TPM_RC_NEEDS_TEST
+		mockCommand(CommandSelfTest, Success))
+	tpm, _ := NewTPMContext(tcti)
+
+	if err := tpm.SelfTest(false); err != nil {
+		t.Fatalf("SelfTest failed: %v", err)
+	}
+
+	// The TPM is running self tests in the background, so this should wait without needing SetWaitForReady.
+	if err := tpm.PCRReset(tpm.PCRHandleContext(7), nil); err != nil {
+		t.Fatalf("PCRReset failed: %v", err)
+	}
+	if slept == 0 {
+		t.Errorf("Expected a delay between submissions")
+	}
+	if tpm.SelfTestsComplete() {
+		t.Errorf("SelfTestsComplete should return false")
+	}
+
+	if _, _, err := tpm.GetTestResult(); err != nil {
+		t.Fatalf("GetTestResult failed: %v", err)
+	}
+	if !tpm.SelfTestsComplete() {
+		t.Errorf("SelfTestsComplete should return true")
+	}
+
+	n := len(tcti.Commands())
+	if err := tpm.SelfTest(false); err != nil {
+		t.Fatalf("SelfTest failed: %v", err)
+	}
+	if len(tcti.Commands()) != n {
+		t.Errorf("Redundant self test was submitted")
+	}
+	if err := tpm.SelfTest(true); err != nil {
+		t.Fatalf("SelfTest failed: %v", err)
+	}
+	if len(tcti.Commands()) != n+1 {
+		t.Errorf("Full self test wasn't submitted")
+	}
+
+	if err := tpm.PCRReset(tpm.PCRHandleContext(7), nil); !IsTPMError(err, ErrorNeedsTest, CommandPCRReset) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := tpm.SelfTest(false); err != nil {
+		t.Fatalf("SelfTest failed: %v", err)
+	}
+	if len(tcti.Commands()) != n+3 {
+		t.Errorf("Self test wasn't submitted after TPM_RC_NEEDS_TEST")
+	}
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+}
+
+type observedCommand struct {
+	commandCode  CommandCode
+	handles      HandleList
+	responseCode ResponseCode
+}
+
+type mockCommandObserver struct {
+	commands []observedCommand
+}
+
+func (o *mockCommandObserver) ObserveCommand(commandCode CommandCode, handles HandleList, duration time.Duration, responseCode ResponseCode) {
+	o.commands = append(o.commands, observedCommand{commandCode, handles, responseCode})
+}
+
+func TestCommandObserver(t *testing.T) {
+	tcti := testutil.NewMockTCTI(
+		mockCommand(CommandPCRReset, ResponseCode(0x922)),
+		mockCommand(CommandPCRReset, Success),
+		mockCommand(CommandSelfTest, Success))
+	tpm, _ := NewTPMContext(tcti)
+
+	var observer mockCommandObserver
+	tpm.SetCommandObserver(&observer)
+
+	if err := tpm.PCRReset(tpm.PCRHandleContext(7), nil); err != nil {
+		t.Fatalf("PCRReset failed: %v", err)
+	}
+	tpm.SetCommandObserver(nil)
+	if err := tpm.SelfTest(false); err != nil {
+		t.Fatalf("SelfTest failed: %v", err)
+	}
+
+	expected := []observedCommand{
+		{commandCode: CommandPCRReset, handles: HandleList{7}, responseCode: ResponseCode(0x922)},
+		{commandCode: CommandPCRReset, handles: HandleList{7}, responseCode: Success}}
+	if !reflect.DeepEqual(observer.commands, expected) {
+		t.Errorf("Unexpected observed commands: %v", observer.commands)
+	}
+}
+
+func TestStats(t *testing.T) {
+	tcti := testutil.NewMockTCTI(
+		mockCommand(CommandPCRReset, ResponseCode(0x922)),
+		mockCommand(CommandPCRReset, Success),
+		mockCommand(CommandSelfTest, Success),
+		mockCommand(CommandSelfTest, Success))
+	tpm, _ := NewTPMContext(tcti)
+
+	if err := tpm.PCRReset(tpm.PCRHandleContext(7), nil); err != nil {
+		t.Fatalf("PCRReset failed: %v", err)
+	}
+	if err := tpm.SelfTest(false); err != nil {
+		t.Fatalf("SelfTest failed: %v", err)
+	}
+
+	stats := tpm.Stats()
+	if s := stats.Command(CommandPCRReset); s.Count != 2 || s.Errors != 1 {
+		t.Errorf("Unexpected stats for TPM2_PCR_Reset: %+v", s)
+	}
+	if s := stats.Command(CommandSelfTest); s.Count != 1 || s.Errors != 0 {
+		t.Errorf("Unexpected stats for TPM2_SelfTest: %+v", s)
+	}
+	if len(stats.Commands()) != 2 {
+		t.Errorf("Unexpected number of commands: %v", stats.Commands())
+	}
+
+	stats.Reset()
+	if len(stats.Commands()) != 0 {
+		t.Errorf("Stats weren't reset")
+	}
+	if err := tpm.SelfTest(false); err != nil {
+		t.Fatalf("SelfTest failed: %v", err)
+	}
+	if s := stats.Command(CommandSelfTest); s.Count != 1 {
+		t.Errorf("Unexpected stats for TPM2_SelfTest after reset: %+v", s)
+	}
+}
+
+type mockMetrics struct {
+	counters   []string
+	histograms []string
+}
+
+func (m *mockMetrics) IncCounter(name string, labelValues ...string) {
+	m.counters = append(m.counters, fmt.Sprintf("%s%v", name, labelValues))
+}
+
+func (m *mockMetrics) ObserveHistogram(name string, value float64, labelValues ...string) {
+	m.histograms = append(m.histograms, fmt.Sprintf("%s%v", name, labelValues))
+}
+
+func TestMetrics(t *testing.T) {
+	tcti := testutil.NewMockTCTI(
+		mockCommand(CommandPCRReset, ResponseCode(0x921)),
+		mockCommand(CommandSelfTest, Success))
+	tpm, _ := NewTPMContext(tcti)
+
+	var metrics mockMetrics
+	tpm.SetMetrics(&metrics)
+
+	if err := tpm.PCRReset(tpm.PCRHandleContext(7), nil); !IsTPMWarning(err, WarningLockout, CommandPCRReset) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := tpm.SelfTest(false); err != nil {
+		t.Fatalf("SelfTest failed: %v", err)
+	}
+
+	expectedCounters := []string{
+		"tpm_commands_total[TPM_CC_PCR_Reset]",
+		"tpm_command_errors_total[TPM_CC_PCR_Reset 0x00000921]",
+		"tpm_lockout_events_total[TPM_CC_PCR_Reset]",
+		"tpm_commands_total[TPM_CC_SelfTest]"}
+	if !reflect.DeepEqual(metrics.counters, expectedCounters) {
+		t.Errorf("Unexpected counters: %v", metrics.counters)
+	}
+	expectedHistograms := []string{
+		"tpm_command_duration_seconds[TPM_CC_PCR_Reset]",
+		"tpm_command_duration_seconds[TPM_CC_SelfTest]"}
+	if !reflect.DeepEqual(metrics.histograms, expectedHistograms) {
+		t.Errorf("Unexpected histograms: %v", metrics.histograms)
+	}
+}
+
+func TestVendorErrorDecoding(t *testing.T) {
+	RegisterVendorErrorDecoder(TPMManufacturerIFX, VendorErrorTable{0x0501: "firmware update in progress"}.Decode)
+	defer RegisterVendorErrorDecoder(TPMManufacturerIFX, nil)
+
+	vendorErr := mockCommand(CommandSelfTest, ResponseCode(0x0501))
+	tcti := testutil.NewMockTCTI(
+		vendorErr,
+		mockTPMPropertiesCommand(TaggedProperty{Property: PropertyManufacturer, Value: uint32(TPMManufacturerIFX)}),
+		vendorErr)
+	tpm, _ := NewTPMContext(tcti)
+
+	// The manufacturer isn't known yet, and shouldn't be obtained whilst dispatching the failed command.
+	var e *TPMVendorError
+	if err := tpm.SelfTest(false); !xerrors.As(err, &e) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if e.Description != "" {
+		t.Errorf("Unexpected error: %#v", e)
+	}
+	if len(tcti.Commands()) != 1 {
+		t.Errorf("Unexpected number of commands: %d", len(tcti.Commands()))
+	}
+
+	if _, err := tpm.GetManufacturer(); err != nil {
+		t.Fatalf("GetManufacturer failed: %v", err)
+	}
+	if err := tpm.SelfTest(false); !xerrors.As(err, &e) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if e.Manufacturer != TPMManufacturerIFX || e.Description != "firmware update in progress" {
+		t.Errorf("Unexpected error: %#v", e)
+	}
+	if err := tcti.Done(); err != nil {
+		t.Errorf("Unexpected commands: %v", err)
+	}
+}
+
+func TestStrictResponseValidation(t *testing.T) {
+	makeSessionsResponse := func(attrs uint8) []byte {
+		b, err := mu.MarshalToBytes(TagSessions, uint32(19), Success, uint32(0), Nonce(nil), attrs, Auth(nil))
+		if err != nil {
+			t.Fatalf("MarshalToBytes failed: %v", err)
+		}
+		return b
+	}
+
+	for _, data := range []struct {
+		desc     string
+		response []byte
+		err      string
+	}{
+		{desc: "Valid", response: makeSessionsResponse(0x01)},
+		{desc: "WrongTag", response: []byte{0x80, 0x01, 0x00, 0x00, 0x00, 0x0a, 0x00, 0x00, 0x00, 0x00},
+			err: "TPM returned an invalid response for command TPM_CC_PCR_Reset: unexpected response tag for command with tag TPM_ST_SESSIONS: TPM_ST_NO_SESSIONS"},
+		{desc: "InvalidPasswordAttrs", response: makeSessionsResponse(0x00),
+			err: "TPM returned an invalid response for command TPM_CC_PCR_Reset: invalid response auth area: invalid response for password session at index 0"},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			tpm, _ := NewTPMContext(testutil.NewMockTCTI(&testutil.MockCommand{CommandCode: CommandPCRReset, RawResponse: data.response}))
+			tpm.SetStrictResponseValidation(true)
+
+			err := tpm.PCRReset(tpm.PCRHandleContext(7), nil)
+			switch {
+			case data.err == "" && err != nil:
+				t.Errorf("PCRReset failed: %v", err)
+			case data.err != "" && (err == nil || err.Error() != data.err):
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+
+	for _, data := range []struct {
+		desc   string
+		handle Handle
+		valid  bool
+	}{
+		{desc: "Transient", handle: 0x80000001, valid: true},
+		{desc: "Permanent", handle: HandleOwner},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			tcti := testutil.NewMockTCTI(&testutil.MockCommand{CommandCode: CommandContextLoad, Response: &testutil.MockResponse{Handle: data.handle}})
+			tpm, _ := NewTPMContext(tcti)
+			tpm.SetStrictResponseValidation(true)
+
+			var handle Handle
+			err := tpm.RunCommand(CommandContextLoad, nil, Delimiter, Delimiter, &handle)
+			var e *InvalidResponseError
+			if data.valid && err != nil {
+				t.Errorf("RunCommand failed: %v", err)
+			}
+			if !data.valid && !xerrors.As(err, &e) {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestContextConstructorsWithInvalidHandles(t *testing.T) {
+	tcti := testutil.NewMockTCTI()
+	tpm, _ := NewTPMContext(tcti)
+
+	if _, err := tpm.CreateResourceContextFromTPM(HandleOwner); err != (InvalidHandleTypeError{HandleOwner}) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(tcti.Commands()) != 0 {
+		t.Errorf("Unexpected command submission")
+	}
+
+	if _, err := tpm.TryGetPermanentContext(0x80000001); err != (InvalidHandleTypeError{0x80000001}) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	rc, err := tpm.TryGetPermanentContext(HandleOwner)
+	if err != nil {
+		t.Fatalf("TryGetPermanentContext failed: %v", err)
+	}
+	if rc != tpm.OwnerHandleContext() {
+		t.Errorf("Unexpected context")
+	}
+
+	for _, pcr := range []int{-1, 0x01000000} {
+		if _, err := tpm.TryPCRHandleContext(pcr); err == nil {
+			t.Errorf("TryPCRHandleContext should have failed for %d", pcr)
+		}
+	}
+	rc, err = tpm.TryPCRHandleContext(7)
+	if err != nil {
+		t.Fatalf("TryPCRHandleContext failed: %v", err)
+	}
+	if rc != tpm.PCRHandleContext(7) {
+		t.Errorf("Unexpected context")
+	}
+}
+
+func TestCaptureCommandOnError(t *testing.T) {
+	tcti := testutil.NewMockTCTI(mockCommand(CommandPCRReset, ResponseCode(0x9a2)), mockCommand(CommandPCRReset, ResponseCode(0x9a2)))
+	tpm, _ := NewTPMContext(tcti)
+
+	pcr := tpm.PCRHandleContext(7)
+	pcr.SetAuthValue(testAuth)
+	defer pcr.SetAuthValue(nil)
+
+	err := tpm.PCRReset(pcr, nil)
+	var ce *CapturedCommandError
+	if xerrors.As(err, &ce) {
+		t.Errorf("Command shouldn't have been captured")
+	}
+
+	tpm.SetCaptureCommandOnError(true)
+	err = tpm.PCRReset(pcr, nil)
+	if !xerrors.As(err, &ce) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !IsTPMSessionError(err, ErrorBadAuth, CommandPCRReset, 1) {
+		t.Errorf("Unexpected wrapped error: %v", err)
+	}
+
+	expected, _ := mu.MarshalToBytes(TagSessions, uint32(31), CommandPCRReset, Handle(7), uint32(13), HandlePW, Nonce(nil), uint8(1),
+		Auth{0, 0, 0, 0})
+	if !bytes.Equal(ce.Packet, expected) {
+		t.Errorf("Unexpected captured packet: %x", ce.Packet)
+	}
+	if !bytes.Equal(tcti.Commands()[1][27:], testAuth) {
+		t.Errorf("Unexpected submitted packet: %x", tcti.Commands()[1])
+	}
+}
+
+func TestTypedFailureErrors(t *testing.T) {
+	tcti := testutil.NewMockTCTI(
+		mockCommand(CommandSelfTest, ResponseCode(0x101)),
+		mockCommand(CommandSelfTest, ResponseCode(0x1e)),
+		mockCommand(CommandClear, ResponseCode(0x185)),
+		mockCommand(CommandClear, ResponseCode(0x185)))
+	tpm, _ := NewTPMContext(tcti)
+
+	err := tpm.SelfTest(false)
+	var fe *TPMFailureModeError
+	if !xerrors.As(err, &fe) || fe.Command != CommandSelfTest || fe.Guidance == "" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if !IsTPMError(err, ErrorFailure, CommandSelfTest) {
+		t.Errorf("Unexpected wrapped error: %v", err)
+	}
+
+	err = tpm.SelfTest(false)
+	var de *TPM12DeviceError
+	if !xerrors.As(err, &de) || de.Command != CommandSelfTest || de.Guidance == "" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	var e1 *TPM1Error
+	if !xerrors.As(err, &e1) || e1.Code != 0x1e {
+		t.Errorf("Unexpected wrapped error: %v", err)
+	}
+
+	err = tpm.Clear(tpm.OwnerHandleContext(), nil)
+	var he *HierarchyDisabledError
+	if !xerrors.As(err, &he) || he.Command != CommandClear || he.Handle != HandleOwner || he.Guidance == "" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if !IsTPMHandleError(err, ErrorHierarchy, CommandClear, 1) {
+		t.Errorf("Unexpected wrapped error: %v", err)
+	}
+
+	err = tpm.Clear(tpm.PlatformHandleContext(), nil)
+	var pe *PlatformHierarchyUnavailableError
+	if !xerrors.As(err, &pe) || pe.Command != CommandClear || pe.Guidance == "" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if !IsTPMHandleError(err, ErrorHierarchy, CommandClear, 1) {
+		t.Errorf("Unexpected wrapped error: %v", err)
+	}
+}
+
+func TestInvalidatedSessions(t *testing.T) {
+	nonce := make(Nonce, 32)
+	makeSessionsResponse := func(attrs uint8) []byte {
+		b, err := mu.MarshalToBytes(TagSessions, uint32(51), Success, uint32(0), nonce, attrs, Auth(nil))
+		if err != nil {
+			t.Fatalf("MarshalToBytes failed: %v", err)
+		}
+		return b
+	}
+
+	tcti := testutil.NewMockTCTI(
+		&testutil.MockCommand{CommandCode: CommandPCRReset, RawResponse: makeSessionsResponse(0x01)},
+		&testutil.MockCommand{CommandCode: CommandPCRReset, RawResponse: makeSessionsResponse(0x00)},
+		mockCommand(CommandSelfTest, Success))
+	tpm, _ := NewTPMContext(tcti)
+
+	session := MakeMockSessionContext(0x03000000, &SessionContextData{
+		HashAlg:     HashAlgorithmSHA256,
+		SessionType: SessionTypePolicy,
+		NonceCaller: nonce,
+		NonceTPM:    nonce})
+
+	if err := tpm.PCRReset(tpm.PCRHandleContext(7), session.WithAttrs(AttrContinueSession)); err != nil {
+		t.Fatalf("PCRReset failed: %v", err)
+	}
+	if len(tpm.InvalidatedSessions()) != 0 {
+		t.Errorf("Unexpected invalidated sessions")
+	}
+
+	sessionNoContinue := session.WithAttrs(0)
+	if err := tpm.PCRReset(tpm.PCRHandleContext(7), sessionNoContinue); err != nil {
+		t.Fatalf("PCRReset failed: %v", err)
+	}
+	if !reflect.DeepEqual(tpm.InvalidatedSessions(), []SessionContext{sessionNoContinue}) {
+		t.Errorf("Unexpected invalidated sessions: %v", tpm.InvalidatedSessions())
+	}
+	if session.Handle() != HandleUnassigned {
+		t.Errorf("Session wasn't invalidated")
+	}
+
+	if err := tpm.SelfTest(false); err != nil {
+		t.Fatalf("SelfTest failed: %v", err)
+	}
+	if len(tpm.InvalidatedSessions()) != 0 {
+		t.Errorf("Invalidated sessions weren't cleared")
+	}
+}
+
+func TestAuthSessionExcludesUnsupportedParamEncryption(t *testing.T) {
+	rsp, err := mu.MarshalToBytes(TagSessions, uint32(19+32), Success, uint32(0), make(Nonce, 32), uint8(0x01), Auth(nil))
+	if err != nil {
+		t.Fatalf("MarshalToBytes failed: %v", err)
+	}
+	tcti := testutil.NewMockTCTI(&testutil.MockCommand{CommandCode: CommandPCRReset, RawResponse: rsp})
+	tpm, _ := NewTPMContext(tcti)
+
+	aes := &SymDef{Algorithm: SymAlgorithmAES, KeyBits: &SymKeyBitsU{Sym: 128}, Mode: &SymModeU{Sym: SymModeCFB}}
+	session := MakeMockSessionContext(0x02000000, &SessionContextData{
+		HashAlg:     HashAlgorithmSHA256,
+		SessionType: SessionTypeHMAC,
+		NonceCaller: make(Nonce, 32),
+		NonceTPM:    make(Nonce, 32),
+		Symmetric:   aes}).WithAttrs(AttrContinueSession | AttrCommandEncrypt | AttrResponseEncrypt)
+
+	// TPM2_PCR_Reset has no parameters, so the session should only be used for authorization.
+	if err := tpm.PCRReset(tpm.PCRHandleContext(7), session); err != nil {
+		t.Fatalf("PCRReset failed: %v", err)
+	}
+
+	// header (10) + handle (4) + authorizationSize (4) + sessionHandle (4) + nonceCaller (34)
+	if attrs := tcti.Commands()[0][56]; attrs != 0x01 {
+		t.Errorf("Unexpected session attributes in command: 0x%02x", attrs)
+	}
+	if session.(*TestSessionContext).Attrs() != AttrContinueSession|AttrCommandEncrypt|AttrResponseEncrypt {
+		t.Errorf("Session attributes were modified")
+	}
+}
+
 var (
 	dummyAuth = []byte("dummy")
 	testAuth  = []byte("1234")
 )
 
+func TestResponseBufferReuse(t *testing.T) {
+	getRandom := func(data Digest) *testutil.MockCommand {
+		return &testutil.MockCommand{CommandCode: CommandGetRandom, Response: &testutil.MockResponse{Params: []interface{}{data}}}
+	}
+
+	large := make([]byte, 5000)
+	for i := range large {
+		large[i] = byte(i)
+	}
+	small := []byte{0xff, 0xfe, 0xfd, 0xfc}
+
+	tcti := testutil.NewMockTCTI(getRandom(large), getRandom(small), getRandom(small))
+	tpm, _ := NewTPMContext(tcti)
+
+	var data1, data2 Digest
+	if err := tpm.RunCommand(CommandGetRandom, nil, Delimiter, uint16(5000), Delimiter, Delimiter, &data1); err != nil {
+		t.Fatalf("RunCommand failed: %v", err)
+	}
+	if err := tpm.RunCommand(CommandGetRandom, nil, Delimiter, uint16(4), Delimiter, Delimiter, &data2); err != nil {
+		t.Fatalf("RunCommand failed: %v", err)
+	}
+	if !bytes.Equal(data1, large) {
+		t.Errorf("First response was modified by the second command")
+	}
+	if !bytes.Equal(data2, small) {
+		t.Errorf("Unexpected response: %x", data2)
+	}
+
+	expectedCmd := []byte{0x80, 0x01, 0x00, 0x00, 0x00, 0x0c, 0x00, 0x00, 0x01, 0x7b, 0x00, 0x04}
+	if !bytes.Equal(tcti.Commands()[1], expectedCmd) {
+		t.Errorf("Unexpected command packet: %x", tcti.Commands()[1])
+	}
+
+	rc, _, rsp, err := tpm.RunCommandBytes(TagNoSessions, CommandGetRandom, []byte{0x00, 0x04})
+	if err != nil {
+		t.Fatalf("RunCommandBytes failed: %v", err)
+	}
+	if rc != Success {
+		t.Errorf("Unexpected response code: %v", rc)
+	}
+	if !bytes.Equal(rsp, []byte{0x00, 0x04, 0xff, 0xfe, 0xfd, 0xfc}) {
+		t.Errorf("Unexpected response payload: %x", rsp)
+	}
+	if !bytes.Equal(data2, small) {
+		t.Errorf("Second response was modified by RunCommandBytes")
+	}
+}
+
+func TestSetRandomSource(t *testing.T) {
+	tcti := testutil.NewMockTCTI(&testutil.MockCommand{CommandCode: CommandStartAuthSession,
+		Response: &testutil.MockResponse{Handle: 0x02000000, Params: []interface{}{make(Nonce, 32)}}})
+	tpm, _ := NewTPMContext(tcti)
+
+	random := make([]byte, 32)
+	for i := range random {
+		random[i] = byte(i)
+	}
+	tpm.SetRandomSource(bytes.NewReader(random))
+
+	if _, err := tpm.StartAuthSession(nil, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256); err != nil {
+		t.Fatalf("StartAuthSession failed: %v", err)
+	}
+
+	// The caller nonce follows the command header and the 2 command handles.
+	cmd := tcti.Commands()[0]
+	if !bytes.Equal(cmd[18:20], []byte{0x00, 0x20}) || !bytes.Equal(cmd[20:52], random) {
+		t.Errorf("Unexpected caller nonce in command: %x", cmd[18:52])
+	}
+}
+
+func TestSetLocality(t *testing.T) {
+	tcti := testutil.NewMockTCTI(mockCommand(CommandPolicyLocality, Success))
+	tpm, _ := NewTPMContext(tcti)
+
+	if tpm.Locality() != 0 {
+		t.Errorf("Unexpected initial locality: %d", tpm.Locality())
+	}
+	if err := tpm.SetLocality(3); err != nil {
+		t.Fatalf("SetLocality failed: %v", err)
+	}
+	if tcti.Locality() != 3 || tpm.Locality() != 3 {
+		t.Errorf("Unexpected locality (TCTI: %d, TPMContext: %d)", tcti.Locality(), tpm.Locality())
+	}
+
+	session := MakeMockSessionContext(0x03000000, &SessionContextData{
+		HashAlg:     HashAlgorithmSHA256,
+		SessionType: SessionTypePolicy,
+		NonceCaller: make(Nonce, 32),
+		NonceTPM:    make(Nonce, 32)})
+	if err := tpm.PolicyLocality(session, 1<<LocalityThree); err != nil {
+		t.Fatalf("PolicyLocality failed: %v", err)
+	}
+	if !bytes.Equal(tcti.Commands()[0][10:], []byte{0x03, 0x00, 0x00, 0x00, 0x08}) {
+		t.Errorf("Unexpected PolicyLocality command: %x", tcti.Commands()[0])
+	}
+
+	trial, _ := ComputeAuthPolicy(HashAlgorithmSHA256)
+	trial.PolicyLocality(1 << LocalityThree)
+	h := sha256.New()
+	h.Write(make([]byte, 32))
+	binary.Write(h, binary.BigEndian, CommandPolicyLocality)
+	h.Write([]byte{0x08})
+	if !bytes.Equal(trial.GetDigest(), h.Sum(nil)) {
+		t.Errorf("Unexpected trial policy digest")
+	}
+}
+
+// mockCommand returns a command for testutil.MockTCTI that returns a response with the specified response code and no
+// parameters.
+func mockCommand(commandCode CommandCode, rc ResponseCode) *testutil.MockCommand {
+	return &testutil.MockCommand{CommandCode: commandCode, Response: &testutil.MockResponse{ResponseCode: rc}}
+}
+
+func TestResponseErrorIdentifiesEntity(t *testing.T) {
+	tcti := testutil.NewMockTCTI(mockCommand(CommandPCRReset, ResponseCode(0x184)), mockCommand(CommandPCRReset, ResponseCode(0x9a2)))
+	tpm, _ := NewTPMContext(tcti)
+
+	err := tpm.PCRReset(tpm.PCRHandleContext(7), nil)
+	var he *TPMHandleError
+	if !AsTPMHandleError(err, ErrorValue, CommandPCRReset, 1, &he) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if he.Handle != 7 || !bytes.Equal(he.Name, tpm.PCRHandleContext(7).Name()) {
+		t.Errorf("Unexpected handle or name: 0x%08x, %x", he.Handle, he.Name)
+	}
+	if err.Error() != "TPM returned an error for handle 1 (0x00000007) whilst executing command TPM_CC_PCR_Reset: TPM_RC_VALUE (value is out of range or is not correct for the context)" {
+		t.Errorf("Unexpected error string: %v", err)
+	}
+
+	err = tpm.PCRReset(tpm.PCRHandleContext(7), nil)
+	var se *TPMSessionError
+	if !AsTPMSessionError(err, ErrorBadAuth, CommandPCRReset, 1, &se) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if se.Handle != HandlePW {
+		t.Errorf("Unexpected handle: 0x%08x", se.Handle)
+	}
+}
+
+func TestInvalidResponseErrorRecordsResponse(t *testing.T) {
+	makeResponse := func(payload []byte) []byte {
+		b, err := mu.MarshalToBytes(TagNoSessions, uint32(10+len(payload)), Success, mu.RawBytes(payload))
+		if err != nil {
+			t.Fatalf("MarshalToBytes failed: %v", err)
+		}
+		return b
+	}
+
+	trailing := makeResponse([]byte{0xa5, 0x5a})
+	badSize := []byte{0x80, 0x01, 0x00, 0x00, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00}
+	truncated := makeResponse([]byte{0xa5, 0x5a})[:11]
+	oversized := append([]byte{0x80, 0x01, 0xff, 0xff, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00}, make([]byte, 5000)...)
+
+	for _, data := range []struct {
+		desc     string
+		response []byte
+		expected []byte
+	}{
+		{desc: "TrailingBytes", response: trailing, expected: trailing},
+		{desc: "InvalidSize", response: badSize, expected: badSize},
+		{desc: "TruncatedHeader", response: badSize[:6], expected: badSize[:6]},
+		{desc: "TruncatedPayload", response: truncated, expected: makeResponse([]byte{0xa5})},
+		{desc: "OversizedPayload", response: oversized, expected: makeResponse(make([]byte, 5000))[:4096]},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			tpm, _ := NewTPMContext(testutil.NewMockTCTI(&testutil.MockCommand{CommandCode: CommandSelfTest, RawResponse: data.response}))
+
+			var e *InvalidResponseError
+			if err := tpm.SelfTest(false); !xerrors.As(err, &e) {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !bytes.Equal(e.Response, data.expected) {
+				t.Errorf("Unexpected response bytes: %x", e.Response)
+			}
+		})
+	}
+}
+
+func TestInvalidResponseParameterSize(t *testing.T) {
+	response, err := mu.MarshalToBytes(TagSessions, uint32(19), Success, uint32(0x7a000000), mu.RawBytes([]byte{0x00, 0x00, 0x01, 0x00, 0x00}))
+	if err != nil {
+		t.Fatalf("MarshalToBytes failed: %v", err)
+	}
+	tpm, _ := NewTPMContext(testutil.NewMockTCTI(&testutil.MockCommand{CommandCode: CommandPCRReset, RawResponse: response}))
+
+	var e *InvalidResponseError
+	if err := tpm.PCRReset(tpm.PCRHandleContext(7), nil); !xerrors.As(err, &e) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if e.Error() != "TPM returned an invalid response for command TPM_CC_PCR_Reset: invalid response parameterSize value (2046820352)" {
+		t.Errorf("Unexpected error string: %v", e)
+	}
+}
+
 // Set the hierarchy auth to testAuth. Fatal on failure
 func setHierarchyAuthForTest(t *testing.T, tpm *TPMContext, hierarchy ResourceContext) {
 	if err := tpm.HierarchyChangeAuth(hierarchy, Auth(testAuth), nil); err != nil {
@@ -49,7 +810,7 @@ func resetHierarchyAuth(t *testing.T, tpm *TPMContext, hierarchy ResourceContext
 }
 
 // Undefine a NV index set by a test. Fails the test if it doesn't succeed.
-func undefineNVSpace(t *testing.T, tpm *TPMContext, context, authHandle ResourceContext) {
+func undefineNVSpace(t testing.TB, tpm *TPMContext, context, authHandle ResourceContext) {
 	if err := tpm.NVUndefineSpace(authHandle, context, nil); err != nil {
 		t.Errorf("NVUndefineSpace failed: %v", err)
 	}
@@ -198,21 +959,9 @@ func verifySignature(t *testing.T, pub *Public, digest []byte, signature *Signat
 }
 
 func createRSASrkForTesting(t *testing.T, tpm *TPMContext, userAuth Auth) ResourceContext {
-	template := Public{
-		Type:    ObjectTypeRSA,
-		NameAlg: HashAlgorithmSHA256,
-		Attrs:   AttrFixedTPM | AttrFixedParent | AttrSensitiveDataOrigin | AttrUserWithAuth | AttrNoDA | AttrRestricted | AttrDecrypt,
-		Params: &PublicParamsU{
-			RSADetail: &RSAParams{
-				Symmetric: SymDefObject{
-					Algorithm: SymObjectAlgorithmAES,
-					KeyBits:   &SymKeyBitsU{Sym: 128},
-					Mode:      &SymModeU{Sym: SymModeCFB}},
-				Scheme:   RSAScheme{Scheme: RSASchemeNull},
-				KeyBits:  2048,
-				Exponent: 0}}}
+	template := testutil.MakeRSASRKTemplate()
 	sensitiveCreate := SensitiveCreate{UserAuth: userAuth}
-	objectHandle, _, _, _, _, err := tpm.CreatePrimary(tpm.OwnerHandleContext(), &sensitiveCreate, &template, nil, nil, nil)
+	objectHandle, _, _, _, _, err := tpm.CreatePrimary(tpm.OwnerHandleContext(), &sensitiveCreate, template, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("CreatePrimary failed: %v", err)
 	}
@@ -220,21 +969,9 @@ func createRSASrkForTesting(t *testing.T, tpm *TPMContext, userAuth Auth) Resour
 }
 
 func createECCSrkForTesting(t *testing.T, tpm *TPMContext, userAuth Auth) ResourceContext {
-	template := Public{
-		Type:    ObjectTypeECC,
-		NameAlg: HashAlgorithmSHA256,
-		Attrs:   AttrFixedTPM | AttrFixedParent | AttrSensitiveDataOrigin | AttrUserWithAuth | AttrNoDA | AttrRestricted | AttrDecrypt,
-		Params: &PublicParamsU{
-			ECCDetail: &ECCParams{
-				Symmetric: SymDefObject{
-					Algorithm: SymObjectAlgorithmAES,
-					KeyBits:   &SymKeyBitsU{Sym: 128},
-					Mode:      &SymModeU{Sym: SymModeCFB}},
-				Scheme:  ECCScheme{Scheme: ECCSchemeNull},
-				CurveID: ECCCurveNIST_P256,
-				KDF:     KDFScheme{Scheme: KDFAlgorithmNull}}}}
+	template := testutil.MakeECCSRKTemplate()
 	sensitiveCreate := SensitiveCreate{UserAuth: userAuth}
-	objectHandle, _, _, _, _, err := tpm.CreatePrimary(tpm.OwnerHandleContext(), &sensitiveCreate, &template, nil, nil, nil)
+	objectHandle, _, _, _, _, err := tpm.CreatePrimary(tpm.OwnerHandleContext(), &sensitiveCreate, template, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("CreatePrimary failed: %v", err)
 	}
@@ -367,7 +1104,7 @@ func verifyPersistentObjectEvicted(t *testing.T, tpm *TPMContext, auth, context
 }
 
 // Flush a resource context. Fails the test if the resource context is valid but the flush doesn't succeed.
-func flushContext(t *testing.T, tpm *TPMContext, context HandleContext) {
+func flushContext(t testing.TB, tpm *TPMContext, context HandleContext) {
 	if err := tpm.FlushContext(context); err != nil {
 		t.Errorf("FlushContext failed: %v", err)
 	}
@@ -399,7 +1136,7 @@ func openTPMSimulatorForTesting(t *testing.T) (*TPMContext, *TctiMssim) {
 	return tpm, tcti
 }
 
-func openTPMForTesting(t *testing.T, features testutil.TPMFeatureFlags) *TPMContext {
+func openTPMForTesting(t testing.TB, features testutil.TPMFeatureFlags) *TPMContext {
 	tpm, _, err := testutil.NewTPMContext(features)
 	if err != nil {
 		t.Fatalf("Cannot open TPM: %v", err)
@@ -410,7 +1147,7 @@ func openTPMForTesting(t *testing.T, features testutil.TPMFeatureFlags) *TPMCont
 	return tpm
 }
 
-func closeTPM(t *testing.T, tpm *TPMContext) {
+func closeTPM(t testing.TB, tpm *TPMContext) {
 	if err := tpm.Close(); err != nil {
 		t.Errorf("Close failed: %v", err)
 	}
@@ -419,7 +1156,7 @@ func closeTPM(t *testing.T, tpm *TPMContext) {
 func TestMain(m *testing.M) {
 	flag.Parse()
 	os.Exit(func() int {
-		if testutil.TPMBackend == testutil.TPMBackendMssim {
+		if testutil.TPMBackend == testutil.TPMBackendMssim || testutil.TPMBackend == testutil.TPMBackendSwtpm {
 			simulatorCleanup, err := testutil.LaunchTPMSimulator(nil)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Cannot launch TPM simulator: %v\n", err)
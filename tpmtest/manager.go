@@ -0,0 +1,177 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+//go:build go1.14
+// +build go1.14
+
+package tpmtest
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+var (
+	// ErrNoSimulator is returned from Manager.Launch if no TPM simulator can be found.
+	ErrNoSimulator = errors.New("no TPM simulator available")
+
+	// ErrManagerClosed is returned from Manager.Launch if the Manager has been closed.
+	ErrManagerClosed = errors.New("manager is closed")
+)
+
+// Instance is a TPM simulator launched by a Manager.
+type Instance struct {
+	TPM  *tpm2.TPMContext // A connection to the simulator
+	Port uint             // The port of the simulator's command channel. The platform channel is on the following port
+
+	m        *Manager
+	stopOnce sync.Once
+	stop     func()
+}
+
+// Stop closes the connection to the simulator, stops it and releases its resources, allowing another instance to be launched by
+// the Manager. It is safe to call Stop more than once.
+func (i *Instance) Stop() {
+	i.stopOnce.Do(func() {
+		i.stop()
+		i.m.remove(i)
+	})
+}
+
+// Manager launches and tracks independent TPM simulator instances, each with its own ports and persistent data, and limits how
+// many of them run at the same time. It is safe to use from multiple goroutines.
+type Manager struct {
+	slots chan struct{}
+
+	mu        sync.Mutex
+	instances map[*Instance]struct{}
+	closed    bool
+	done      chan struct{}
+}
+
+// NewManager returns a new Manager that runs at most n simulators at the same time. If n is zero or negative, the limit is the
+// value of runtime.GOMAXPROCS.
+func NewManager(n int) *Manager {
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	return &Manager{
+		slots:     make(chan struct{}, n),
+		instances: make(map[*Instance]struct{}),
+		done:      make(chan struct{})}
+}
+
+func (m *Manager) remove(i *Instance) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.instances, i)
+	<-m.slots
+}
+
+// Launch launches a new, freshly manufactured TPM simulator, selected in the same way as testutil.TPMSimulatorAuto. If the
+// maximum number of simulators are already running, Launch blocks until one of them is stopped or the Manager is closed.
+//
+// If no simulator can be found, ErrNoSimulator is returned. If the Manager is closed, ErrManagerClosed is returned.
+func (m *Manager) Launch() (*Instance, error) {
+	select {
+	case <-m.done:
+		return nil, ErrManagerClosed
+	default:
+	}
+	if !testutil.TPMSimulatorAuto.Available() {
+		return nil, ErrNoSimulator
+	}
+
+	select {
+	case m.slots <- struct{}{}:
+	case <-m.done:
+		return nil, ErrManagerClosed
+	}
+
+	i, err := m.launch()
+	if err != nil {
+		<-m.slots
+		return nil, err
+	}
+	return i, nil
+}
+
+func (m *Manager) launch() (*Instance, error) {
+	sourceDir, err := ioutil.TempDir("", "tpmtest.")
+	if err != nil {
+		return nil, err
+	}
+
+	tpm, port, stop, err := launch(sourceDir)
+	if err != nil {
+		os.RemoveAll(sourceDir)
+		return nil, err
+	}
+	i := &Instance{TPM: tpm, Port: port, m: m, stop: func() {
+		stop()
+		os.RemoveAll(sourceDir)
+	}}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		i.stop()
+		return nil, ErrManagerClosed
+	}
+	m.instances[i] = struct{}{}
+	return i, nil
+}
+
+// New launches a new simulator in the same way as Launch and returns a TPMContext that is connected to it. The simulator is stopped
+// by a cleanup function registered with t. This is equivalent to the package level New function, except that the number of
+// simulators is limited by m.
+//
+// If no simulator can be found, the test is skipped. Other failures are fatal.
+func (m *Manager) New(t testing.TB) *tpm2.TPMContext {
+	t.Helper()
+
+	i, err := m.Launch()
+	switch {
+	case err == ErrNoSimulator:
+		t.Skip(err)
+	case err != nil:
+		t.Fatal(err)
+	}
+	t.Cleanup(i.Stop)
+
+	return i.TPM
+}
+
+// Running returns the number of simulators launched by m that haven't been stopped yet.
+func (m *Manager) Running() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.instances)
+}
+
+// Close stops all of the simulators launched by m that are still running. Subsequent calls to Launch will fail, and calls that are
+// blocked waiting for a simulator to be stopped will return an error.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.done)
+	}
+	var instances []*Instance
+	for i := range m.instances {
+		instances = append(instances, i)
+	}
+	m.mu.Unlock()
+
+	for _, i := range instances {
+		i.Stop()
+	}
+}
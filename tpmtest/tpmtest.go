@@ -0,0 +1,139 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+//go:build go1.14
+// +build go1.14
+
+/*
+Package tpmtest provides a convenient way for tests to obtain a private TPM simulator, in the same way that net/http/httptest
+provides test servers.
+
+	func TestSomething(t *testing.T) {
+		t.Parallel()
+		tpm := tpmtest.New(t)
+		...
+	}
+
+Each call to New launches a new, freshly manufactured simulator instance listening on its own ports, so tests that use it can
+run in parallel. The simulator is stopped automatically when the test and its subtests complete.
+
+This package relies on testing.TB.Cleanup, and so it requires Go 1.14 or later.
+*/
+package tpmtest
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/testutil"
+
+	"golang.org/x/xerrors"
+)
+
+var (
+	reservedPorts     = make(map[uint]bool)
+	reservedPortsLock sync.Mutex
+)
+
+// isPortFree determines whether the specified port can be listened on.
+func isPortFree(port uint) bool {
+	l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return false
+	}
+	l.Close()
+	return true
+}
+
+// reservePorts obtains a pair of consecutive free ports for a simulator's command and platform channels. The returned port
+// is reserved for this process until releasePorts is called, so that parallel tests are never given the same ports.
+func reservePorts() (uint, error) {
+	reservedPortsLock.Lock()
+	defer reservedPortsLock.Unlock()
+
+	for i := 0; i < 20; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return 0, err
+		}
+		port := uint(l.Addr().(*net.TCPAddr).Port)
+		l.Close()
+
+		if port >= 0xffff || reservedPorts[port] || reservedPorts[port+1] || reservedPorts[port-1] {
+			continue
+		}
+		if !isPortFree(port + 1) {
+			continue
+		}
+		reservedPorts[port] = true
+		return port, nil
+	}
+	return 0, errors.New("cannot find a free pair of ports")
+}
+
+func releasePorts(port uint) {
+	reservedPortsLock.Lock()
+	defer reservedPortsLock.Unlock()
+	delete(reservedPorts, port)
+}
+
+// launch launches a new, freshly manufactured TPM simulator on a pair of reserved ports, with sourceDir as the source directory
+// for its persistent data. On success, it returns the command channel port and a function that closes the connection, stops the
+// simulator and releases its ports.
+func launch(sourceDir string) (tpm *tpm2.TPMContext, port uint, stop func(), err error) {
+	port, err = reservePorts()
+	if err != nil {
+		return nil, 0, nil, xerrors.Errorf("cannot allocate ports for TPM simulator: %w", err)
+	}
+
+	tpm, stopSimulator, err := testutil.LaunchTPMSimulatorContext(&testutil.TPMSimulatorOptions{
+		SourceDir:   sourceDir,
+		Manufacture: true,
+		Simulator:   testutil.TPMSimulatorAuto,
+		Port:        port})
+	if err != nil {
+		releasePorts(port)
+		return nil, 0, nil, xerrors.Errorf("cannot launch TPM simulator: %w", err)
+	}
+	return tpm, port, func() {
+		stopSimulator()
+		releasePorts(port)
+	}, nil
+}
+
+// New launches a new, freshly manufactured TPM simulator and returns a TPMContext that is connected to it. The simulator
+// listens on ports allocated for this instance, and is selected in the same way as testutil.TPMSimulatorAuto. The connection
+// is closed and the simulator is stopped by a cleanup function registered with t.
+//
+// If no simulator can be found, the test is skipped. Other failures are fatal.
+func New(t testing.TB) *tpm2.TPMContext {
+	t.Helper()
+
+	if !testutil.TPMSimulatorAuto.Available() {
+		t.Skip("no TPM simulator available")
+	}
+
+	sourceDir, err := ioutil.TempDir("", "tpmtest.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpm, _, stop, err := launch(sourceDir)
+	if err != nil {
+		os.RemoveAll(sourceDir)
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		stop()
+		os.RemoveAll(sourceDir)
+	})
+
+	return tpm
+}
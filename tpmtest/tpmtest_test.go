@@ -0,0 +1,134 @@
+// Copyright 2020 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+//go:build go1.14
+// +build go1.14
+
+package tpmtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+func init() {
+	testutil.AddCommandLineFlags()
+}
+
+func TestReservePorts(t *testing.T) {
+	var ports []uint
+	defer func() {
+		for _, port := range ports {
+			releasePorts(port)
+		}
+	}()
+
+	for i := 0; i < 4; i++ {
+		port, err := reservePorts()
+		if err != nil {
+			t.Fatalf("reservePorts failed: %v", err)
+		}
+		for _, p := range ports {
+			if port == p || port == p+1 || port+1 == p {
+				t.Errorf("port %d overlaps with previously reserved port %d", port, p)
+			}
+		}
+		ports = append(ports, port)
+	}
+}
+
+func TestNewParallel(t *testing.T) {
+	for _, name := range []string{"1", "2"} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			tpm := New(t)
+
+			b, err := tpm.GetRandom(8)
+			if err != nil {
+				t.Fatalf("GetRandom failed: %v", err)
+			}
+			if len(b) != 8 {
+				t.Errorf("Unexpected number of bytes: %d", len(b))
+			}
+		})
+	}
+}
+
+func TestManager(t *testing.T) {
+	m := NewManager(2)
+	defer m.Close()
+
+	var instances []*Instance
+	for i := 0; i < 2; i++ {
+		instance, err := m.Launch()
+		if err == ErrNoSimulator {
+			t.SkipNow()
+		}
+		if err != nil {
+			t.Fatalf("Launch failed: %v", err)
+		}
+		instances = append(instances, instance)
+	}
+	if instances[0].Port == instances[1].Port {
+		t.Errorf("instances share port %d", instances[0].Port)
+	}
+	if m.Running() != 2 {
+		t.Errorf("Unexpected number of running instances: %d", m.Running())
+	}
+
+	// A third instance can only be launched once one of the others is stopped.
+	launched := make(chan *Instance)
+	go func() {
+		instance, err := m.Launch()
+		if err != nil {
+			t.Errorf("Launch failed: %v", err)
+		}
+		launched <- instance
+	}()
+	select {
+	case <-launched:
+		t.Fatalf("Launch didn't block")
+	case <-time.After(100 * time.Millisecond):
+	}
+	instances[0].Stop()
+	instance := <-launched
+	if instance == nil {
+		t.FailNow()
+	}
+
+	if _, err := instance.TPM.GetRandom(8); err != nil {
+		t.Errorf("GetRandom failed: %v", err)
+	}
+
+	m.Close()
+	if m.Running() != 0 {
+		t.Errorf("Unexpected number of running instances after Close: %d", m.Running())
+	}
+}
+
+func TestManagerClosed(t *testing.T) {
+	m := NewManager(1)
+	m.Close()
+	if _, err := m.Launch(); err != ErrManagerClosed {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestManagerNewParallel(t *testing.T) {
+	m := NewManager(1)
+	t.Cleanup(m.Close)
+
+	for _, name := range []string{"1", "2", "3"} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			tpm := m.New(t)
+
+			if _, err := tpm.GetRandom(8); err != nil {
+				t.Fatalf("GetRandom failed: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,532 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/canonical/go-tpm2/mu"
+
+	"golang.org/x/xerrors"
+)
+
+// A transcript file consists of an 8 byte magic value and a 32-bit version number, followed by a sequence of records. Each record
+// contains a command packet and the response packet that the TPM returned for it, each of which is preceded by its length as a
+// 32-bit value. All integers are big-endian.
+const (
+	transcriptMagic   = "TPM2TRNS"
+	transcriptVersion = uint32(1)
+
+	// maxTranscriptPacketSize is the maximum size of a packet that will be decoded from a transcript file.
+	maxTranscriptPacketSize = 1 << 20
+)
+
+// commandHandleCounts contains the number of command and response handles for each command code.
+var commandHandleCounts = map[CommandCode][2]int{
+	CommandNVUndefineSpaceSpecial:     {2, 0},
+	CommandEvictControl:               {2, 0},
+	CommandHierarchyControl:           {1, 0},
+	CommandNVUndefineSpace:            {2, 0},
+	CommandChangeEPS:                  {1, 0},
+	CommandChangePPS:                  {1, 0},
+	CommandClear:                      {1, 0},
+	CommandClearControl:               {1, 0},
+	CommandClockSet:                   {1, 0},
+	CommandHierarchyChangeAuth:        {1, 0},
+	CommandNVDefineSpace:              {1, 0},
+	CommandPCRAllocate:                {1, 0},
+	CommandSetPrimaryPolicy:           {1, 0},
+	CommandClockRateAdjust:            {1, 0},
+	CommandCreatePrimary:              {1, 1},
+	CommandNVGlobalWriteLock:          {1, 0},
+	CommandGetCommandAuditDigest:      {2, 0},
+	CommandNVIncrement:                {2, 0},
+	CommandNVSetBits:                  {2, 0},
+	CommandNVExtend:                   {2, 0},
+	CommandNVWrite:                    {2, 0},
+	CommandNVWriteLock:                {2, 0},
+	CommandDictionaryAttackLockReset:  {1, 0},
+	CommandDictionaryAttackParameters: {1, 0},
+	CommandNVChangeAuth:               {1, 0},
+	CommandPCREvent:                   {1, 0},
+	CommandPCRReset:                   {1, 0},
+	CommandSequenceComplete:           {1, 0},
+	CommandSetCommandCodeAuditStatus:  {1, 0},
+	CommandIncrementalSelfTest:        {0, 0},
+	CommandSelfTest:                   {0, 0},
+	CommandStartup:                    {0, 0},
+	CommandShutdown:                   {0, 0},
+	CommandStirRandom:                 {0, 0},
+	CommandActivateCredential:         {2, 0},
+	CommandCertify:                    {2, 0},
+	CommandPolicyNV:                   {3, 0},
+	CommandCertifyCreation:            {2, 0},
+	CommandDuplicate:                  {2, 0},
+	CommandGetTime:                    {2, 0},
+	CommandGetSessionAuditDigest:      {3, 0},
+	CommandNVRead:                     {2, 0},
+	CommandNVReadLock:                 {2, 0},
+	CommandObjectChangeAuth:           {2, 0},
+	CommandPolicySecret:               {2, 0},
+	CommandCreate:                     {1, 0},
+	CommandECDHZGen:                   {1, 0},
+	CommandHMAC:                       {1, 0},
+	CommandImport:                     {1, 0},
+	CommandLoad:                       {1, 1},
+	CommandQuote:                      {1, 0},
+	CommandRSADecrypt:                 {1, 0},
+	CommandHMACStart:                  {1, 1},
+	CommandSequenceUpdate:             {1, 0},
+	CommandSign:                       {1, 0},
+	CommandUnseal:                     {1, 0},
+	CommandPolicySigned:               {2, 0},
+	CommandContextLoad:                {0, 1},
+	CommandContextSave:                {1, 0},
+	CommandECDHKeyGen:                 {1, 0},
+	CommandFlushContext:               {0, 0},
+	CommandLoadExternal:               {0, 1},
+	CommandMakeCredential:             {1, 0},
+	CommandNVReadPublic:               {1, 0},
+	CommandPolicyAuthorize:            {1, 0},
+	CommandPolicyAuthValue:            {1, 0},
+	CommandPolicyCommandCode:          {1, 0},
+	CommandPolicyCounterTimer:         {1, 0},
+	CommandPolicyCpHash:               {1, 0},
+	CommandPolicyLocality:             {1, 0},
+	CommandPolicyNameHash:             {1, 0},
+	CommandPolicyOR:                   {1, 0},
+	CommandPolicyTicket:               {1, 0},
+	CommandReadPublic:                 {1, 0},
+	CommandRSAEncrypt:                 {1, 0},
+	CommandStartAuthSession:           {2, 1},
+	CommandVerifySignature:            {1, 0},
+	CommandECCParameters:              {0, 0},
+	CommandGetCapability:              {0, 0},
+	CommandGetRandom:                  {0, 0},
+	CommandGetTestResult:              {0, 0},
+	CommandHash:                       {0, 0},
+	CommandPCRRead:                    {0, 0},
+	CommandPolicyPCR:                  {1, 0},
+	CommandPolicyRestart:              {1, 0},
+	CommandReadClock:                  {0, 0},
+	CommandPCRExtend:                  {1, 0},
+	CommandNVCertify:                  {3, 0},
+	CommandEventSequenceComplete:      {2, 0},
+	CommandHashSequenceStart:          {0, 1},
+	CommandPolicyDuplicationSelect:    {1, 0},
+	CommandPolicyGetDigest:            {1, 0},
+	CommandTestParms:                  {0, 0},
+	CommandCommit:                     {1, 0},
+	CommandPolicyPassword:             {1, 0},
+	CommandPolicyNvWritten:            {1, 0},
+	CommandPolicyTemplate:             {1, 0},
+	CommandCreateLoaded:               {1, 1},
+	CommandPolicyAuthorizeNV:          {3, 0},
+}
+
+// TranscriptEntry corresponds to a single command and response exchange recorded in a transcript.
+type TranscriptEntry struct {
+	Command  []byte // The command packet
+	Response []byte // The response packet
+}
+
+// TranscriptWriter writes command and response exchanges to a transcript file.
+type TranscriptWriter struct {
+	w io.Writer
+}
+
+// NewTranscriptWriter returns a new TranscriptWriter that writes a transcript to w. The transcript header is written immediately.
+func NewTranscriptWriter(w io.Writer) (*TranscriptWriter, error) {
+	if _, err := io.WriteString(w, transcriptMagic); err != nil {
+		return nil, xerrors.Errorf("cannot write magic: %w", err)
+	}
+	if err := binary.Write(w, binary.BigEndian, transcriptVersion); err != nil {
+		return nil, xerrors.Errorf("cannot write version: %w", err)
+	}
+	return &TranscriptWriter{w: w}, nil
+}
+
+func (w *TranscriptWriter) writePacket(packet []byte) error {
+	if err := binary.Write(w.w, binary.BigEndian, uint32(len(packet))); err != nil {
+		return err
+	}
+	_, err := w.w.Write(packet)
+	return err
+}
+
+// WriteEntry appends the supplied exchange to the transcript.
+func (w *TranscriptWriter) WriteEntry(entry *TranscriptEntry) error {
+	if err := w.writePacket(entry.Command); err != nil {
+		return xerrors.Errorf("cannot write command: %w", err)
+	}
+	if err := w.writePacket(entry.Response); err != nil {
+		return xerrors.Errorf("cannot write response: %w", err)
+	}
+	return nil
+}
+
+func readTranscriptPacket(r io.Reader) ([]byte, error) {
+	var size uint32
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	if size > maxTranscriptPacketSize {
+		return nil, fmt.Errorf("invalid packet size (%d)", size)
+	}
+	packet := make([]byte, size)
+	if _, err := io.ReadFull(r, packet); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return packet, nil
+}
+
+// ReadTranscript reads all of the exchanges from the transcript file provided by r.
+func ReadTranscript(r io.Reader) ([]*TranscriptEntry, error) {
+	magic := make([]byte, len(transcriptMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, xerrors.Errorf("cannot read magic: %w", err)
+	}
+	if string(magic) != transcriptMagic {
+		return nil, errors.New("invalid magic")
+	}
+	var version uint32
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+		return nil, xerrors.Errorf("cannot read version: %w", err)
+	}
+	if version != transcriptVersion {
+		return nil, fmt.Errorf("unsupported version (%d)", version)
+	}
+
+	var entries []*TranscriptEntry
+	for i := 0; ; i++ {
+		cmd, err := readTranscriptPacket(r)
+		switch {
+		case err == io.EOF:
+			return entries, nil
+		case err != nil:
+			return nil, xerrors.Errorf("cannot read command for entry %d: %w", i, err)
+		}
+		rsp, err := readTranscriptPacket(r)
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, xerrors.Errorf("cannot read response for entry %d: %w", i, err)
+		}
+		entries = append(entries, &TranscriptEntry{Command: cmd, Response: rsp})
+	}
+}
+
+// TranscriptAuth is a decoded authorization from the authorization area of a command or response.
+type TranscriptAuth struct {
+	SessionHandle Handle // The session handle. This is only set for command authorizations
+	Nonce         Nonce
+	Attrs         uint8 // The TPMA_SESSION attributes
+	HMAC          Auth
+}
+
+// DecodedCommand is the symbolic form of a command packet recorded in a transcript.
+type DecodedCommand struct {
+	Tag         StructTag
+	CommandCode CommandCode
+
+	// Handles contains the command handles. If the command code is not recognized, this is nil and any handles are included in
+	// Params.
+	Handles HandleList
+
+	// AuthArea contains the command authorizations. If the command code is not recognized, this is nil and the authorization area
+	// is included in Params.
+	AuthArea []TranscriptAuth
+
+	Params []byte // The marshalled command parameters
+}
+
+func (c *DecodedCommand) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v", c.CommandCode)
+	if c.Handles != nil {
+		b.WriteString(" handles=[")
+		for i, h := range c.Handles {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "0x%08x", h)
+		}
+		b.WriteString("]")
+	}
+	for _, a := range c.AuthArea {
+		fmt.Fprintf(&b, " session={handle=0x%08x attrs=0x%02x}", a.SessionHandle, a.Attrs)
+	}
+	fmt.Fprintf(&b, " params=%s", hex.EncodeToString(c.Params))
+	return b.String()
+}
+
+// DecodedResponse is the symbolic form of a response packet recorded in a transcript.
+type DecodedResponse struct {
+	Tag          StructTag
+	ResponseCode ResponseCode
+
+	// Handle is the response handle, for commands that return one.
+	Handle Handle
+
+	// AuthArea contains the response authorizations.
+	AuthArea []TranscriptAuth
+
+	// Params contains the marshalled response parameters. If the command code is not recognized and the response has no
+	// authorization area, this also contains any response handle.
+	Params []byte
+}
+
+func (r *DecodedResponse) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "rc=0x%08x", uint32(r.ResponseCode))
+	if r.Handle != 0 {
+		fmt.Fprintf(&b, " handle=0x%08x", r.Handle)
+	}
+	fmt.Fprintf(&b, " params=%s", hex.EncodeToString(r.Params))
+	return b.String()
+}
+
+func decodeCommandPacket(packet []byte) (*DecodedCommand, error) {
+	r := bytes.NewReader(packet)
+
+	var h commandHeader
+	if _, err := mu.UnmarshalFromReader(r, &h); err != nil {
+		return nil, xerrors.Errorf("cannot unmarshal header: %w", err)
+	}
+	if int(h.CommandSize) != len(packet) {
+		return nil, fmt.Errorf("invalid commandSize value (%d)", h.CommandSize)
+	}
+
+	cmd := &DecodedCommand{Tag: h.Tag, CommandCode: h.CommandCode}
+
+	counts, known := commandHandleCounts[h.CommandCode]
+	if known {
+		cmd.Handles = make(HandleList, counts[0])
+		for i := range cmd.Handles {
+			if _, err := mu.UnmarshalFromReader(r, &cmd.Handles[i]); err != nil {
+				return nil, xerrors.Errorf("cannot unmarshal handle %d: %w", i, err)
+			}
+		}
+
+		if h.Tag == TagSessions {
+			authArea, err := readCommandAuthArea(r, nil)
+			if err != nil {
+				return nil, xerrors.Errorf("cannot unmarshal auth area: %w", err)
+			}
+			for _, a := range authArea {
+				cmd.AuthArea = append(cmd.AuthArea, TranscriptAuth{SessionHandle: a.SessionHandle, Nonce: a.Nonce, Attrs: uint8(a.SessionAttrs), HMAC: a.HMAC})
+			}
+		}
+	}
+
+	cmd.Params = make([]byte, r.Len())
+	r.Read(cmd.Params)
+	return cmd, nil
+}
+
+func decodeResponsePacket(commandCode CommandCode, packet []byte) (*DecodedResponse, error) {
+	r := bytes.NewReader(packet)
+
+	var h responseHeader
+	if _, err := mu.UnmarshalFromReader(r, &h); err != nil {
+		return nil, xerrors.Errorf("cannot unmarshal header: %w", err)
+	}
+	if int(h.ResponseSize) != len(packet) {
+		return nil, fmt.Errorf("invalid responseSize value (%d)", h.ResponseSize)
+	}
+
+	rsp := &DecodedResponse{Tag: h.Tag, ResponseCode: h.ResponseCode}
+	if h.ResponseCode != Success {
+		rsp.Params = make([]byte, r.Len())
+		r.Read(rsp.Params)
+		return rsp, nil
+	}
+
+	counts, known := commandHandleCounts[commandCode]
+	if known && counts[1] > 0 {
+		if _, err := mu.UnmarshalFromReader(r, &rsp.Handle); err != nil {
+			return nil, xerrors.Errorf("cannot unmarshal handle: %w", err)
+		}
+	}
+
+	if h.Tag != TagSessions {
+		rsp.Params = make([]byte, r.Len())
+		r.Read(rsp.Params)
+		return rsp, nil
+	}
+
+	if !known {
+		return nil, errors.New("cannot decode response with authorization area for unrecognized command")
+	}
+
+	var paramSize uint32
+	if _, err := mu.UnmarshalFromReader(r, &paramSize); err != nil {
+		return nil, xerrors.Errorf("cannot unmarshal parameterSize: %w", err)
+	}
+	if int(paramSize) > r.Len() {
+		return nil, fmt.Errorf("invalid parameterSize value (%d)", paramSize)
+	}
+	rsp.Params = make([]byte, paramSize)
+	r.Read(rsp.Params)
+
+	for r.Len() > 0 {
+		var auth authResponse
+		if _, err := mu.UnmarshalFromReader(r, &auth); err != nil {
+			return nil, xerrors.Errorf("cannot unmarshal authorization %d: %w", len(rsp.AuthArea), err)
+		}
+		rsp.AuthArea = append(rsp.AuthArea, TranscriptAuth{Nonce: auth.Nonce, Attrs: uint8(auth.SessionAttrs), HMAC: auth.HMAC})
+	}
+
+	return rsp, nil
+}
+
+// Decode decodes this exchange in to symbolic form.
+func (e *TranscriptEntry) Decode() (*DecodedCommand, *DecodedResponse, error) {
+	cmd, err := decodeCommandPacket(e.Command)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("cannot decode command: %w", err)
+	}
+	rsp, err := decodeResponsePacket(cmd.CommandCode, e.Response)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("cannot decode response: %w", err)
+	}
+	return cmd, rsp, nil
+}
+
+// readCommandAuthArea reads a command authorization area from r. If fn is not nil, it is called for each authorization with the
+// offset of the end of its HMAC field, relative to the start of the authorization area.
+func readCommandAuthArea(r io.Reader, fn func(auth *authCommand, end int)) ([]authCommand, error) {
+	var size uint32
+	if _, err := mu.UnmarshalFromReader(r, &size); err != nil {
+		return nil, err
+	}
+	if size > maxTranscriptPacketSize {
+		return nil, fmt.Errorf("invalid size (%d)", size)
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+
+	ar := bytes.NewReader(b)
+	var authArea []authCommand
+	for ar.Len() > 0 {
+		var auth authCommand
+		if _, err := mu.UnmarshalFromReader(ar, &auth); err != nil {
+			return nil, xerrors.Errorf("cannot unmarshal authorization %d: %w", len(authArea), err)
+		}
+		if fn != nil {
+			fn(&auth, binary.Size(size)+len(b)-ar.Len())
+		}
+		authArea = append(authArea, auth)
+	}
+	return authArea, nil
+}
+
+// redactCommandPacket returns a copy of the supplied command packet with the cleartext authorization values of any password
+// authorizations replaced with zeros. If the command code is not recognized, the packet is returned unmodified.
+func redactCommandPacket(packet []byte) []byte {
+	packet = append([]byte(nil), packet...)
+
+	r := bytes.NewReader(packet)
+	var h commandHeader
+	if _, err := mu.UnmarshalFromReader(r, &h); err != nil || h.Tag != TagSessions {
+		return packet
+	}
+	counts, known := commandHandleCounts[h.CommandCode]
+	if !known {
+		return packet
+	}
+	if _, err := r.Seek(int64(counts[0]*binary.Size(Handle(0))), io.SeekCurrent); err != nil {
+		return packet
+	}
+
+	start := len(packet) - r.Len()
+	readCommandAuthArea(r, func(auth *authCommand, end int) {
+		if auth.SessionHandle != HandlePW {
+			return
+		}
+		for i := start + end - len(auth.HMAC); i < start+end; i++ {
+			packet[i] = 0
+		}
+	})
+
+	return packet
+}
+
+// TranscriptTCTI is a TCTI that wraps another TCTI and records every command and response exchange to a transcript, so that it
+// can be attached to bug reports and decoded or replayed later. Cleartext authorization values supplied for password
+// authorizations are redacted from the transcript for recognized commands, but command and response parameters are recorded as
+// they are sent and received.
+type TranscriptTCTI struct {
+	tcti     TCTI
+	w        *TranscriptWriter
+	commands [][]byte
+	rsp      bytes.Buffer
+}
+
+// NewTranscriptTCTI returns a new TranscriptTCTI that wraps tcti and records exchanges with w.
+func NewTranscriptTCTI(tcti TCTI, w *TranscriptWriter) *TranscriptTCTI {
+	return &TranscriptTCTI{tcti: tcti, w: w}
+}
+
+func (t *TranscriptTCTI) Read(data []byte) (int, error) {
+	n, err := t.tcti.Read(data)
+	t.rsp.Write(data[:n])
+
+	for t.rsp.Len() >= binary.Size(responseHeader{}) {
+		size := int(binary.BigEndian.Uint32(t.rsp.Bytes()[2:]))
+		if t.rsp.Len() < size {
+			break
+		}
+		if len(t.commands) == 0 {
+			return n, errors.New("cannot record response: no outstanding command")
+		}
+		rsp := make([]byte, size)
+		t.rsp.Read(rsp)
+		if err := t.w.WriteEntry(&TranscriptEntry{Command: t.commands[0], Response: rsp}); err != nil {
+			return n, xerrors.Errorf("cannot record exchange: %w", err)
+		}
+		t.commands = t.commands[1:]
+	}
+
+	return n, err
+}
+
+func (t *TranscriptTCTI) Write(data []byte) (int, error) {
+	n, err := t.tcti.Write(data)
+	if err == nil {
+		t.commands = append(t.commands, redactCommandPacket(data))
+	}
+	return n, err
+}
+
+func (t *TranscriptTCTI) Close() error {
+	return t.tcti.Close()
+}
+
+func (t *TranscriptTCTI) SetLocality(locality uint8) error {
+	return t.tcti.SetLocality(locality)
+}
+
+func (t *TranscriptTCTI) MakeSticky(handle Handle, sticky bool) error {
+	return t.tcti.MakeSticky(handle, sticky)
+}
+
+// SupportsPipelining implements PipelinedTCTI, and indicates whether the wrapped TCTI supports pipelining.
+func (t *TranscriptTCTI) SupportsPipelining() bool {
+	p, ok := t.tcti.(PipelinedTCTI)
+	return ok && p.SupportsPipelining()
+}
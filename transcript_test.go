@@ -0,0 +1,210 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+func TestTranscript(t *testing.T) {
+	random, err := mu.MarshalToBytes(Digest{1, 2, 3, 4})
+	if err != nil {
+		t.Fatalf("MarshalToBytes failed: %v", err)
+	}
+	mock := testutil.NewMockTCTI(
+		mockTPMPropertiesCommand(
+			TaggedProperty{Property: PropertyInputBuffer, Value: 1024},
+			TaggedProperty{Property: PropertyMaxDigest, Value: 32},
+			TaggedProperty{Property: PropertyNVBufferMax, Value: 1024}),
+		&testutil.MockCommand{CommandCode: CommandGetRandom, Response: &testutil.MockResponse{Params: []interface{}{mu.RawBytes(random)}}},
+		&testutil.MockCommand{CommandCode: CommandPCRReset, Handles: []Handle{7}, Response: &testutil.MockResponse{PasswordSessions: 1}},
+		&testutil.MockCommand{CommandCode: CommandPCRReset, Handles: []Handle{8}, Response: &testutil.MockResponse{ResponseCode: ResponseCode(0x184)}})
+
+	buf := new(bytes.Buffer)
+	w, err := NewTranscriptWriter(buf)
+	if err != nil {
+		t.Fatalf("NewTranscriptWriter failed: %v", err)
+	}
+	tpm, _ := NewTPMContext(NewTranscriptTCTI(mock, w))
+
+	if _, err := tpm.GetRandom(4); err != nil {
+		t.Fatalf("GetRandom failed: %v", err)
+	}
+	pcr := tpm.PCRHandleContext(7)
+	pcr.SetAuthValue([]byte("secret"))
+	if err := tpm.PCRReset(pcr, nil); err != nil {
+		t.Fatalf("PCRReset failed: %v", err)
+	}
+	if err := tpm.PCRReset(tpm.PCRHandleContext(8), nil); err == nil {
+		t.Fatalf("PCRReset should have failed")
+	}
+
+	entries, err := ReadTranscript(buf)
+	if err != nil {
+		t.Fatalf("ReadTranscript failed: %v", err)
+	}
+	if len(entries) != len(mock.Commands()) {
+		t.Fatalf("Unexpected number of entries: %d", len(entries))
+	}
+	for i, e := range entries {
+		if i == 2 {
+			continue
+		}
+		if !bytes.Equal(e.Command, mock.Commands()[i]) {
+			t.Errorf("Unexpected command for entry %d: %x", i, e.Command)
+		}
+	}
+
+	cmd, rsp, err := entries[1].Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if cmd.CommandCode != CommandGetRandom || len(cmd.Handles) != 0 || !bytes.Equal(cmd.Params, []byte{0x00, 0x04}) {
+		t.Errorf("Unexpected command: %v", cmd)
+	}
+	if rsp.ResponseCode != Success || !bytes.Equal(rsp.Params, random) {
+		t.Errorf("Unexpected response: %v", rsp)
+	}
+
+	cmd, rsp, err = entries[2].Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if cmd.String() != "TPM_CC_PCR_Reset handles=[0x00000007] session={handle=0x40000009 attrs=0x01} params=" {
+		t.Errorf("Unexpected command: %v", cmd)
+	}
+	if len(cmd.AuthArea) != 1 || !bytes.Equal(cmd.AuthArea[0].HMAC, make(Auth, 6)) {
+		t.Errorf("Password was not redacted: %x", entries[2].Command)
+	}
+	if bytes.Contains(entries[2].Command, []byte("secret")) || !bytes.Contains(mock.Commands()[2], []byte("secret")) {
+		t.Errorf("Password was not redacted: %x", entries[2].Command)
+	}
+	if len(rsp.AuthArea) != 1 || len(rsp.Params) != 0 {
+		t.Errorf("Unexpected response: %v", rsp)
+	}
+
+	_, rsp, err = entries[3].Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if rsp.String() != "rc=0x00000184 params=" {
+		t.Errorf("Unexpected response: %v", rsp)
+	}
+}
+
+func TestReadTranscriptInvalid(t *testing.T) {
+	for _, data := range []struct {
+		desc string
+		data []byte
+		err  string
+	}{
+		{desc: "BadMagic", data: []byte("TPM2XXXX\x00\x00\x00\x01"), err: "invalid magic"},
+		{desc: "BadVersion", data: []byte("TPM2TRNS\x00\x00\x00\x02"), err: "unsupported version (2)"},
+		{desc: "Truncated", data: []byte("TPM2TRNS\x00\x00\x00\x01\x00\x00\x00\x02\x80"), err: "cannot read command for entry 0: unexpected EOF"},
+		{desc: "MissingResponse", data: []byte("TPM2TRNS\x00\x00\x00\x01\x00\x00\x00\x01\x80"), err: "cannot read response for entry 0: unexpected EOF"},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			_, err := ReadTranscript(bytes.NewReader(data.data))
+			if err == nil || err.Error() != data.err {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestCompareTranscripts(t *testing.T) {
+	makeCommand := func(session Handle, nonce Nonce, params []byte) []byte {
+		auth, err := mu.MarshalToBytes(session, nonce, uint8(1), Auth(nil))
+		if err != nil {
+			t.Fatalf("MarshalToBytes failed: %v", err)
+		}
+		b, err := mu.MarshalToBytes(TagSessions, uint32(18+len(auth)+len(params)), CommandPCRReset, Handle(7),
+			uint32(len(auth)), mu.RawBytes(auth), mu.RawBytes(params))
+		if err != nil {
+			t.Fatalf("MarshalToBytes failed: %v", err)
+		}
+		return b
+	}
+	makeResponse := func(nonce Nonce) []byte {
+		b, err := mu.MarshalToBytes(TagSessions, uint32(19+len(nonce)), Success, uint32(0), nonce, uint8(1), Auth(nil))
+		if err != nil {
+			t.Fatalf("MarshalToBytes failed: %v", err)
+		}
+		return b
+	}
+
+	golden := []*TranscriptEntry{{Command: makeCommand(0x02000000, Nonce{1, 2}, nil), Response: makeResponse(Nonce{3, 4})}}
+
+	for _, data := range []struct {
+		desc     string
+		obtained []*TranscriptEntry
+		rules    *testutil.TranscriptIgnoreRules
+		err      string
+	}{
+		{desc: "Identical", obtained: golden},
+		{
+			desc:     "DifferentNonces",
+			obtained: []*TranscriptEntry{{Command: makeCommand(0x02000000, Nonce{5, 6}, nil), Response: makeResponse(Nonce{7, 8})}},
+			err:      "exchange 0: command: unexpected nonce for authorization 0",
+		},
+		{
+			desc:     "IgnoreNonces",
+			obtained: []*TranscriptEntry{{Command: makeCommand(0x02000000, Nonce{5, 6}, nil), Response: makeResponse(Nonce{7, 8})}},
+			rules:    &testutil.TranscriptIgnoreRules{Nonces: true},
+		},
+		{
+			desc:     "DifferentHandles",
+			obtained: []*TranscriptEntry{{Command: makeCommand(0x02000001, Nonce{1, 2}, nil), Response: makeResponse(Nonce{3, 4})}},
+			err:      "exchange 0: command: unexpected session handle for authorization 0: 0x02000001 (expected 0x02000000)",
+		},
+		{
+			desc:     "IgnoreHandles",
+			obtained: []*TranscriptEntry{{Command: makeCommand(0x02000001, Nonce{1, 2}, nil), Response: makeResponse(Nonce{3, 4})}},
+			rules:    &testutil.TranscriptIgnoreRules{Handles: true},
+		},
+		{
+			desc:     "DifferentSessionType",
+			obtained: []*TranscriptEntry{{Command: makeCommand(0x03000000, Nonce{1, 2}, nil), Response: makeResponse(Nonce{3, 4})}},
+			rules:    &testutil.TranscriptIgnoreRules{Handles: true},
+			err:      "exchange 0: command: unexpected session handle for authorization 0: 0x03000000 (expected 0x02000000)",
+		},
+		{
+			desc:     "DifferentParams",
+			obtained: []*TranscriptEntry{{Command: makeCommand(0x02000000, Nonce{1, 2}, []byte{1}), Response: makeResponse(Nonce{3, 4})}},
+			err:      "exchange 0: unexpected command parameters 01 (expected )",
+		},
+		{
+			desc:     "IgnoreParams",
+			obtained: []*TranscriptEntry{{Command: makeCommand(0x02000000, Nonce{1, 2}, []byte{1}), Response: makeResponse(Nonce{3, 4})}},
+			rules:    &testutil.TranscriptIgnoreRules{Params: []CommandCode{CommandPCRReset}},
+		},
+		{
+			desc:     "DifferentResponseCode",
+			obtained: []*TranscriptEntry{{Command: makeCommand(0x02000000, Nonce{1, 2}, nil), Response: []byte{0x80, 0x01, 0x00, 0x00, 0x00, 0x0a, 0x00, 0x00, 0x09, 0x8e}}},
+			rules:    &testutil.TranscriptIgnoreRules{Nonces: true, ResponseParams: true},
+			err:      "exchange 0: unexpected response code 0x0000098e (expected 0x00000000)",
+		},
+		{
+			desc:     "Truncated",
+			obtained: nil,
+			err:      "unexpected number of exchanges 0 (expected 1)",
+		},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			err := testutil.CompareTranscripts(data.obtained, golden, data.rules)
+			switch {
+			case data.err == "" && err != nil:
+				t.Errorf("CompareTranscripts failed: %v", err)
+			case data.err != "" && (err == nil || err.Error() != data.err):
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -11,11 +11,14 @@ import (
 	_ "crypto/sha1"
 	_ "crypto/sha256"
 	_ "crypto/sha512"
+	"encoding/asn1"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"hash"
 	"io"
+	"math"
+	"math/big"
 	"reflect"
 	"sort"
 	"unsafe"
@@ -153,12 +156,28 @@ func (a HashAlgorithmId) GetHash() crypto.Hash {
 	}
 }
 
+// IsValid determines if the digest algorithm is a known TPM digest algorithm. This may return true for algorithms that don't
+// have an equivalent go crypto.Hash.
+func (a HashAlgorithmId) IsValid() bool {
+	switch a {
+	case HashAlgorithmSHA1, HashAlgorithmSHA256, HashAlgorithmSHA384, HashAlgorithmSHA512, HashAlgorithmSM3_256:
+		return true
+	default:
+		return false
+	}
+}
+
 // Supported determines if the TPM digest algorithm has an equivalent go crypto.Hash.
 func (a HashAlgorithmId) Supported() bool {
 	return a.GetHash() != crypto.Hash(0)
 }
 
-// NewHash constructs a new hash.Hash implementation for this algorithm. It will panic if HashAlgorithmId.Supported
+// Available determines if the TPM digest algorithm has an equivalent go crypto.Hash that is linked in to the current binary.
+func (a HashAlgorithmId) Available() bool {
+	return a.Supported() && a.GetHash().Available()
+}
+
+// NewHash constructs a new hash.Hash implementation for this algorithm. It will panic if HashAlgorithmId.Available
 // returns false.
 func (a HashAlgorithmId) NewHash() hash.Hash {
 	return a.GetHash().New()
@@ -169,6 +188,23 @@ func (a HashAlgorithmId) Size() int {
 	return a.GetHash().Size()
 }
 
+// HashAlgorithmIdFromCryptoHash returns the TPM digest algorithm that is equivalent to the supplied go crypto.Hash. If there
+// isn't an equivalent algorithm, HashAlgorithmNull is returned.
+func HashAlgorithmIdFromCryptoHash(h crypto.Hash) HashAlgorithmId {
+	switch h {
+	case crypto.SHA1:
+		return HashAlgorithmSHA1
+	case crypto.SHA256:
+		return HashAlgorithmSHA256
+	case crypto.SHA384:
+		return HashAlgorithmSHA384
+	case crypto.SHA512:
+		return HashAlgorithmSHA512
+	default:
+		return HashAlgorithmNull
+	}
+}
+
 // SymAlgorithmId corresponds to the TPMI_ALG_SYM type
 type SymAlgorithmId AlgorithmId
 
@@ -307,6 +343,21 @@ func (n Name) Digest() Digest {
 	return Digest(n[binary.Size(HashAlgorithmId(0)):])
 }
 
+// IsValid returns true if the name contains either a handle or a digest prefixed with the identifier of a supported digest
+// algorithm of the correct size.
+func (n Name) IsValid() bool {
+	return n.IsHandle() || n.Algorithm() != HashAlgorithmNull
+}
+
+// NameFromBytes returns a copy of the supplied bytes as a Name, after checking that it is well formed (see Name.IsValid).
+func NameFromBytes(b []byte) (Name, error) {
+	n := Name(b)
+	if !n.IsValid() {
+		return nil, errors.New("invalid name")
+	}
+	return append(Name(nil), n...), nil
+}
+
 // 10.6) PCR Structures
 
 // PCRSelect is a slice of PCR indexes. It is marshalled to and from the TPMS_PCR_SELECT type, which is a bitmap of the PCR indices
@@ -314,45 +365,50 @@ func (n Name) Digest() Digest {
 type PCRSelect []int
 
 func (d PCRSelect) Marshal(w io.Writer) error {
-	bytes := make([]byte, 3)
+	_, err := w.Write(d.appendTo(nil))
+	if err != nil {
+		return xerrors.Errorf("cannot write PCR selection bit mask: %w", err)
+	}
+	return nil
+}
 
+// appendTo appends the size prefixed bit mask representation of this selection to b.
+func (d PCRSelect) appendTo(b []byte) []byte {
+	size := 3
 	for _, i := range d {
-		octet := i / 8
-		for octet >= len(bytes) {
-			bytes = append(bytes, byte(0))
+		if i/8 >= size {
+			size = i/8 + 1
 		}
-		bit := uint(i % 8)
-		bytes[octet] |= 1 << bit
 	}
 
-	if err := binary.Write(w, binary.BigEndian, uint8(len(bytes))); err != nil {
-		return xerrors.Errorf("cannot write size of PCR selection bit mask: %w", err)
+	b = append(b, uint8(size))
+	start := len(b)
+	for i := 0; i < size; i++ {
+		b = append(b, 0)
 	}
-
-	if _, err := w.Write(bytes); err != nil {
-		return xerrors.Errorf("cannot write PCR selection bit mask: %w", err)
+	for _, i := range d {
+		b[start+(i/8)] |= 1 << uint(i%8)
 	}
-	return nil
+	return b
 }
 
 func (d *PCRSelect) Unmarshal(r mu.Reader) error {
-	var size uint8
-	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+	var size [1]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
 		return xerrors.Errorf("cannot read size of PCR selection bit mask: %w", err)
 	}
-	if int(size) > r.Len() {
+	if int(size[0]) > r.Len() {
 		return errors.New("size field is larger than the remaining bytes")
 	}
 
-	bytes := make([]byte, size)
-
-	if _, err := io.ReadFull(r, bytes); err != nil {
+	var mask [math.MaxUint8]byte
+	if _, err := io.ReadFull(r, mask[:size[0]]); err != nil {
 		return xerrors.Errorf("cannot read PCR selection bit mask: %w", err)
 	}
 
 	*d = make(PCRSelect, 0)
 
-	for i, octet := range bytes {
+	for i, octet := range mask[:size[0]] {
 		for bit := uint(0); bit < 8; bit++ {
 			if octet&(1<<bit) == 0 {
 				continue
@@ -452,6 +508,46 @@ type TaggedHashList []TaggedHash
 // PCRSelectionList is a slice of PCRSelection values, and corresponds to the TPML_PCR_SELECTION type.
 type PCRSelectionList []PCRSelection
 
+// Marshal implements mu.CustomMarshaller. PCR selections appear in many commands and responses, so
+// they are marshalled by hand to avoid the overhead of the reflection based path.
+func (l PCRSelectionList) Marshal(w io.Writer) error {
+	b := make([]byte, 4, 4+len(l)*6)
+	binary.BigEndian.PutUint32(b, uint32(len(l)))
+	for _, s := range l {
+		b = append(b, uint8(s.Hash>>8), uint8(s.Hash))
+		b = s.Select.appendTo(b)
+	}
+	if _, err := w.Write(b); err != nil {
+		return xerrors.Errorf("cannot write PCR selection list: %w", err)
+	}
+	return nil
+}
+
+// Unmarshal implements mu.CustomUnmarshaller.
+func (l *PCRSelectionList) Unmarshal(r mu.Reader) error {
+	var scratch [4]byte
+	if _, err := io.ReadFull(r, scratch[:]); err != nil {
+		return xerrors.Errorf("cannot read length of list: %w", err)
+	}
+	n := binary.BigEndian.Uint32(scratch[:])
+	// Each element is at least 3 bytes long.
+	if int64(n)*3 > int64(r.Len()) {
+		return errors.New("list length is larger than the remaining bytes")
+	}
+
+	*l = make(PCRSelectionList, n)
+	for i := range *l {
+		if _, err := io.ReadFull(r, scratch[:2]); err != nil {
+			return xerrors.Errorf("cannot read hash algorithm for element %d: %w", i, err)
+		}
+		(*l)[i].Hash = HashAlgorithmId(binary.BigEndian.Uint16(scratch[:]))
+		if err := (*l)[i].Select.Unmarshal(r); err != nil {
+			return xerrors.Errorf("cannot unmarshal selection for element %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
 func (l PCRSelectionList) copy() (out PCRSelectionList) {
 	b, _ := mu.MarshalToBytes(l)
 	mu.UnmarshalFromBytes(b, &out)
@@ -553,16 +649,57 @@ func (l PCRSelectionList) Remove(r PCRSelectionList) (out PCRSelectionList) {
 		}
 	}
 
+	return out.removeEmpty()
+}
+
+// Intersect will return a new set of PCR selections containing only the PCRs from l that are also selected in r. The order of
+// the PCR banks in l is preserved, and any bank that ends up with no selected PCRs is omitted.
+func (l PCRSelectionList) Intersect(r PCRSelectionList) (out PCRSelectionList) {
+	out = l.copy()
+	r = r.copy()
+
 	for i, so := range out {
-		if len(so.Select) > 0 {
+		var sel PCRSelect
+		for _, po := range so.Select {
+			if r.contains(so.Hash, po) {
+				sel = append(sel, po)
+			}
+		}
+		out[i].Select = sel
+	}
+
+	return out.removeEmpty()
+}
+
+// IsSubsetOf indicates whether every PCR selected in l is also selected in r, regardless of the order of the PCR banks in
+// either list.
+func (l PCRSelectionList) IsSubsetOf(r PCRSelectionList) bool {
+	return l.Remove(r).IsEmpty()
+}
+
+func (l PCRSelectionList) contains(alg HashAlgorithmId, pcr int) bool {
+	for _, s := range l {
+		if s.Hash != alg {
 			continue
 		}
-		if i < len(out)-1 {
-			copy(out[i:], out[i+1:])
+		for _, p := range s.Select {
+			if p == pcr {
+				return true
+			}
 		}
-		out = out[:len(out)-1]
 	}
-	return
+	return false
+}
+
+func (l PCRSelectionList) removeEmpty() PCRSelectionList {
+	out := l[:0]
+	for _, s := range l {
+		if len(s.Select) == 0 {
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
 }
 
 // IsEmpty returns true if the list of PCR selections selects no PCRs.
@@ -617,30 +754,30 @@ type CapabilitiesU struct {
 	AuthPolicies  TaggedPolicyList
 }
 
-func (c *CapabilitiesU) Select(selector reflect.Value) interface{} {
+func (c *CapabilitiesU) Select(selector reflect.Value) (interface{}, error) {
 	switch selector.Interface().(Capability) {
 	case CapabilityAlgs:
-		return &c.Algorithms
+		return &c.Algorithms, nil
 	case CapabilityHandles:
-		return &c.Handles
+		return &c.Handles, nil
 	case CapabilityCommands:
-		return &c.Command
+		return &c.Command, nil
 	case CapabilityPPCommands:
-		return &c.PPCommands
+		return &c.PPCommands, nil
 	case CapabilityAuditCommands:
-		return &c.AuditCommands
+		return &c.AuditCommands, nil
 	case CapabilityPCRs:
-		return &c.AssignedPCR
+		return &c.AssignedPCR, nil
 	case CapabilityTPMProperties:
-		return &c.TPMProperties
+		return &c.TPMProperties, nil
 	case CapabilityPCRProperties:
-		return &c.PCRProperties
+		return &c.PCRProperties, nil
 	case CapabilityECCCurves:
-		return &c.ECCCurves
+		return &c.ECCCurves, nil
 	case CapabilityAuthPolicies:
-		return &c.AuthPolicies
+		return &c.AuthPolicies, nil
 	default:
-		return nil
+		return nil, &mu.InvalidSelectorError{Selector: selector}
 	}
 }
 
@@ -737,24 +874,24 @@ type AttestU struct {
 	NV           *NVCertifyInfo
 }
 
-func (a *AttestU) Select(selector reflect.Value) interface{} {
+func (a *AttestU) Select(selector reflect.Value) (interface{}, error) {
 	switch selector.Interface().(StructTag) {
 	case TagAttestNV:
-		return &a.NV
+		return &a.NV, nil
 	case TagAttestCommandAudit:
-		return &a.CommandAudit
+		return &a.CommandAudit, nil
 	case TagAttestSessionAudit:
-		return &a.SessionAudit
+		return &a.SessionAudit, nil
 	case TagAttestCertify:
-		return &a.Certify
+		return &a.Certify, nil
 	case TagAttestQuote:
-		return &a.Quote
+		return &a.Quote, nil
 	case TagAttestTime:
-		return &a.Time
+		return &a.Time, nil
 	case TagAttestCreation:
-		return &a.Creation
+		return &a.Creation, nil
 	default:
-		return nil
+		return nil, &mu.InvalidSelectorError{Selector: selector}
 	}
 }
 
@@ -790,20 +927,20 @@ type SymKeyBitsU struct {
 	XOR HashAlgorithmId
 }
 
-func (b *SymKeyBitsU) Select(selector reflect.Value) interface{} {
+func (b *SymKeyBitsU) Select(selector reflect.Value) (interface{}, error) {
 	switch selector.Convert(reflect.TypeOf(AlgorithmId(0))).Interface().(AlgorithmId) {
 	case AlgorithmAES:
 		fallthrough
 	case AlgorithmSM4:
 		fallthrough
 	case AlgorithmCamellia:
-		return &b.Sym
+		return &b.Sym, nil
 	case AlgorithmXOR:
-		return &b.XOR
+		return &b.XOR, nil
 	case AlgorithmNull:
-		return mu.NilUnionValue
+		return nil, nil
 	default:
-		return nil
+		return nil, &mu.InvalidSelectorError{Selector: selector}
 	}
 }
 
@@ -818,20 +955,20 @@ type SymModeU struct {
 	Sym SymModeId
 }
 
-func (m *SymModeU) Select(selector reflect.Value) interface{} {
+func (m *SymModeU) Select(selector reflect.Value) (interface{}, error) {
 	switch selector.Convert(reflect.TypeOf(AlgorithmId(0))).Interface().(AlgorithmId) {
 	case AlgorithmAES:
 		fallthrough
 	case AlgorithmSM4:
 		fallthrough
 	case AlgorithmCamellia:
-		return &m.Sym
+		return &m.Sym, nil
 	case AlgorithmXOR:
 		fallthrough
 	case AlgorithmNull:
-		return mu.NilUnionValue
+		return nil, nil
 	default:
-		return nil
+		return nil, &mu.InvalidSelectorError{Selector: selector}
 	}
 }
 
@@ -849,6 +986,139 @@ type SymDefObject struct {
 	Mode      *SymModeU            `tpm2:"selector:Algorithm"` // Symmetric mode
 }
 
+func validateSymKeyBits(alg AlgorithmId, keyBits uint16) error {
+	var valid []uint16
+	switch alg {
+	case AlgorithmAES, AlgorithmCamellia:
+		valid = []uint16{128, 192, 256}
+	case AlgorithmSM4:
+		valid = []uint16{128}
+	}
+	for _, v := range valid {
+		if keyBits == v {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid key size %d for symmetric algorithm %v", keyBits, alg)
+}
+
+// Validate checks that this is a valid combination of algorithm, key size and mode for use as the symmetric algorithm of a
+// session. Block ciphers must use SymModeCFB, and SymAlgorithmXOR must specify a valid digest algorithm.
+func (d *SymDef) Validate() error {
+	switch d.Algorithm {
+	case SymAlgorithmNull:
+		return nil
+	case SymAlgorithmXOR:
+		if d.KeyBits == nil || !d.KeyBits.XOR.IsValid() {
+			return errors.New("invalid digest algorithm for XOR obfuscation")
+		}
+		return nil
+	case SymAlgorithmAES, SymAlgorithmSM4, SymAlgorithmCamellia:
+		if d.KeyBits == nil {
+			return errors.New("no key size")
+		}
+		if err := validateSymKeyBits(AlgorithmId(d.Algorithm), d.KeyBits.Sym); err != nil {
+			return err
+		}
+		if d.Mode == nil || d.Mode.Sym != SymModeCFB {
+			return errors.New("invalid mode: block ciphers must use CFB mode for parameter encryption")
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid symmetric algorithm: %v", d.Algorithm)
+	}
+}
+
+// Validate checks that this is a valid combination of algorithm, key size and mode for use as the symmetric algorithm of an
+// object. A mode of SymModeNull is permitted, which allows a symmetric cipher object to be used with any mode. Note that the TPM
+// additionally requires SymModeCFB for storage parents.
+func (d *SymDefObject) Validate() error {
+	switch d.Algorithm {
+	case SymObjectAlgorithmNull:
+		return nil
+	case SymObjectAlgorithmAES, SymObjectAlgorithmSM4, SymObjectAlgorithmCamellia:
+		if d.KeyBits == nil {
+			return errors.New("no key size")
+		}
+		if err := validateSymKeyBits(AlgorithmId(d.Algorithm), d.KeyBits.Sym); err != nil {
+			return err
+		}
+		if d.Mode == nil {
+			return errors.New("no mode")
+		}
+		switch d.Mode.Sym {
+		case SymModeNull, SymModeCTR, SymModeOFB, SymModeCBC, SymModeCFB, SymModeECB:
+			return nil
+		default:
+			return fmt.Errorf("invalid mode: %v", d.Mode.Sym)
+		}
+	default:
+		return fmt.Errorf("invalid symmetric algorithm: %v", d.Algorithm)
+	}
+}
+
+// MakeSymDef creates a SymDef for a block cipher with the specified algorithm, key size and mode, returning an error if it isn't
+// a valid combination.
+func MakeSymDef(alg SymAlgorithmId, keyBits uint16, mode SymModeId) (*SymDef, error) {
+	d := &SymDef{
+		Algorithm: alg,
+		KeyBits:   &SymKeyBitsU{Sym: keyBits},
+		Mode:      &SymModeU{Sym: mode}}
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// SymDefAES128CFB returns a SymDef for AES-128 in CFB mode, which is the most commonly used algorithm for session based parameter
+// encryption.
+func SymDefAES128CFB() *SymDef {
+	return &SymDef{
+		Algorithm: SymAlgorithmAES,
+		KeyBits:   &SymKeyBitsU{Sym: 128},
+		Mode:      &SymModeU{Sym: SymModeCFB}}
+}
+
+// SymDefXOR returns a SymDef for XOR obfuscation using the specified digest algorithm.
+func SymDefXOR(hashAlg HashAlgorithmId) *SymDef {
+	return &SymDef{
+		Algorithm: SymAlgorithmXOR,
+		KeyBits:   &SymKeyBitsU{XOR: hashAlg}}
+}
+
+// SymDefNull returns a SymDef that specifies no symmetric algorithm.
+func SymDefNull() *SymDef {
+	return &SymDef{Algorithm: SymAlgorithmNull}
+}
+
+// MakeSymDefObject creates a SymDefObject with the specified algorithm, key size and mode, returning an error if it isn't a
+// valid combination.
+func MakeSymDefObject(alg SymObjectAlgorithmId, keyBits uint16, mode SymModeId) (*SymDefObject, error) {
+	d := &SymDefObject{
+		Algorithm: alg,
+		KeyBits:   &SymKeyBitsU{Sym: keyBits},
+		Mode:      &SymModeU{Sym: mode}}
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// SymDefObjectAES128CFB returns a SymDefObject for AES-128 in CFB mode, which is suitable for use as the symmetric algorithm of a
+// storage parent.
+func SymDefObjectAES128CFB() *SymDefObject {
+	return &SymDefObject{
+		Algorithm: SymObjectAlgorithmAES,
+		KeyBits:   &SymKeyBitsU{Sym: 128},
+		Mode:      &SymModeU{Sym: SymModeCFB}}
+}
+
+// SymDefObjectNull returns a SymDefObject that specifies no symmetric algorithm, as required for objects that are not storage
+// parents.
+func SymDefObjectNull() *SymDefObject {
+	return &SymDefObject{Algorithm: SymObjectAlgorithmNull}
+}
+
 // SymKey corresponds to the TPM2B_SYM_KEY type.
 type SymKey []byte
 
@@ -914,16 +1184,16 @@ type SchemeKeyedHashU struct {
 	XOR  *SchemeXOR
 }
 
-func (d *SchemeKeyedHashU) Select(selector reflect.Value) interface{} {
+func (d *SchemeKeyedHashU) Select(selector reflect.Value) (interface{}, error) {
 	switch selector.Interface().(KeyedHashSchemeId) {
 	case KeyedHashSchemeHMAC:
-		return &d.HMAC
+		return &d.HMAC, nil
 	case KeyedHashSchemeXOR:
-		return &d.XOR
+		return &d.XOR, nil
 	case KeyedHashSchemeNull:
-		return mu.NilUnionValue
+		return nil, nil
 	default:
-		return nil
+		return nil, &mu.InvalidSelectorError{Selector: selector}
 	}
 }
 
@@ -933,6 +1203,53 @@ type KeyedHashScheme struct {
 	Details *SchemeKeyedHashU `tpm2:"selector:Scheme"` // Scheme specific parameters
 }
 
+// Validate checks that the scheme is a valid keyed hash scheme, and that the required parameters are present.
+func (s *KeyedHashScheme) Validate() error {
+	switch s.Scheme {
+	case KeyedHashSchemeNull:
+		return nil
+	case KeyedHashSchemeHMAC:
+		if s.Details == nil || s.Details.HMAC == nil || !s.Details.HMAC.HashAlg.IsValid() {
+			return errors.New("invalid digest algorithm for HMAC scheme")
+		}
+		return nil
+	case KeyedHashSchemeXOR:
+		if s.Details == nil || s.Details.XOR == nil || !s.Details.XOR.HashAlg.IsValid() {
+			return errors.New("invalid digest algorithm for XOR scheme")
+		}
+		switch s.Details.XOR.KDF {
+		case KDFAlgorithmMGF1, KDFAlgorithmKDF1_SP800_56A, KDFAlgorithmKDF2, KDFAlgorithmKDF1_SP800_108:
+			return nil
+		default:
+			return fmt.Errorf("invalid KDF for XOR scheme: %v", s.Details.XOR.KDF)
+		}
+	default:
+		return fmt.Errorf("invalid keyed hash scheme: %v", s.Scheme)
+	}
+}
+
+// MakeKeyedHashSchemeHMAC returns a KeyedHashScheme for HMAC with the specified digest algorithm.
+func MakeKeyedHashSchemeHMAC(hashAlg HashAlgorithmId) (*KeyedHashScheme, error) {
+	s := &KeyedHashScheme{
+		Scheme:  KeyedHashSchemeHMAC,
+		Details: &SchemeKeyedHashU{HMAC: &SchemeHMAC{HashAlg: hashAlg}}}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// MakeKeyedHashSchemeXOR returns a KeyedHashScheme for XOR obfuscation with the specified digest algorithm and KDF.
+func MakeKeyedHashSchemeXOR(hashAlg HashAlgorithmId, kdf KDFAlgorithmId) (*KeyedHashScheme, error) {
+	s := &KeyedHashScheme{
+		Scheme:  KeyedHashSchemeXOR,
+		Details: &SchemeKeyedHashU{XOR: &SchemeXOR{HashAlg: hashAlg, KDF: kdf}}}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
 // 11.2 Assymetric
 
 // 11.2.1 Signing Schemes
@@ -964,26 +1281,26 @@ type SigSchemeU struct {
 	HMAC      *SchemeHMAC
 }
 
-func (s *SigSchemeU) Select(selector reflect.Value) interface{} {
+func (s *SigSchemeU) Select(selector reflect.Value) (interface{}, error) {
 	switch selector.Interface().(SigSchemeId) {
 	case SigSchemeAlgRSASSA:
-		return &s.RSASSA
+		return &s.RSASSA, nil
 	case SigSchemeAlgRSAPSS:
-		return &s.RSAPSS
+		return &s.RSAPSS, nil
 	case SigSchemeAlgECDSA:
-		return &s.ECDSA
+		return &s.ECDSA, nil
 	case SigSchemeAlgECDAA:
-		return &s.ECDAA
+		return &s.ECDAA, nil
 	case SigSchemeAlgSM2:
-		return &s.SM2
+		return &s.SM2, nil
 	case SigSchemeAlgECSCHNORR:
-		return &s.ECSCHNORR
+		return &s.ECSCHNORR, nil
 	case SigSchemeAlgHMAC:
-		return &s.HMAC
+		return &s.HMAC, nil
 	case SigSchemeAlgNull:
-		return mu.NilUnionValue
+		return nil, nil
 	default:
-		return nil
+		return nil, &mu.InvalidSelectorError{Selector: selector}
 	}
 }
 
@@ -1016,6 +1333,55 @@ type SigScheme struct {
 	Details *SigSchemeU `tpm2:"selector:Scheme"` // Scheme specific parameters
 }
 
+// Validate checks that the scheme is a valid signing scheme, and that a valid digest algorithm is specified for it.
+func (s *SigScheme) Validate() error {
+	switch s.Scheme {
+	case SigSchemeAlgNull:
+		return nil
+	case SigSchemeAlgRSASSA, SigSchemeAlgRSAPSS, SigSchemeAlgECDSA, SigSchemeAlgECDAA, SigSchemeAlgSM2, SigSchemeAlgECSCHNORR,
+		SigSchemeAlgHMAC:
+		if s.Details == nil {
+			return errors.New("no scheme parameters")
+		}
+		if d := s.Details.Any(); d == nil || !d.HashAlg.IsValid() {
+			return fmt.Errorf("invalid digest algorithm for scheme %v", s.Scheme)
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid signing scheme: %v", s.Scheme)
+	}
+}
+
+// MakeSigScheme returns a SigScheme for the specified signing scheme and digest algorithm, returning an error if the scheme or
+// digest algorithm is invalid.
+func MakeSigScheme(scheme SigSchemeId, hashAlg HashAlgorithmId) (*SigScheme, error) {
+	var details *SigSchemeU
+	switch scheme {
+	case SigSchemeAlgNull:
+	case SigSchemeAlgRSASSA:
+		details = &SigSchemeU{RSASSA: &SigSchemeRSASSA{HashAlg: hashAlg}}
+	case SigSchemeAlgRSAPSS:
+		details = &SigSchemeU{RSAPSS: &SigSchemeRSAPSS{HashAlg: hashAlg}}
+	case SigSchemeAlgECDSA:
+		details = &SigSchemeU{ECDSA: &SigSchemeECDSA{HashAlg: hashAlg}}
+	case SigSchemeAlgECDAA:
+		details = &SigSchemeU{ECDAA: &SigSchemeECDAA{HashAlg: hashAlg}}
+	case SigSchemeAlgSM2:
+		details = &SigSchemeU{SM2: &SigSchemeSM2{HashAlg: hashAlg}}
+	case SigSchemeAlgECSCHNORR:
+		details = &SigSchemeU{ECSCHNORR: &SigSchemeECSCHNORR{HashAlg: hashAlg}}
+	case SigSchemeAlgHMAC:
+		details = &SigSchemeU{HMAC: &SchemeHMAC{HashAlg: hashAlg}}
+	default:
+		return nil, fmt.Errorf("invalid signing scheme: %v", scheme)
+	}
+	s := &SigScheme{Scheme: scheme, Details: details}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
 // 11.2.3 Key Derivation Schemes
 
 type SchemeMGF1 SchemeHash
@@ -1037,20 +1403,20 @@ type KDFSchemeU struct {
 	KDF1_SP800_108 *SchemeKDF1_SP800_108
 }
 
-func (s *KDFSchemeU) Select(selector reflect.Value) interface{} {
+func (s *KDFSchemeU) Select(selector reflect.Value) (interface{}, error) {
 	switch selector.Interface().(KDFAlgorithmId) {
 	case KDFAlgorithmMGF1:
-		return &s.MGF1
+		return &s.MGF1, nil
 	case KDFAlgorithmKDF1_SP800_56A:
-		return &s.KDF1_SP800_56A
+		return &s.KDF1_SP800_56A, nil
 	case KDFAlgorithmKDF2:
-		return &s.KDF2
+		return &s.KDF2, nil
 	case KDFAlgorithmKDF1_SP800_108:
-		return &s.KDF1_SP800_108
+		return &s.KDF1_SP800_108, nil
 	case KDFAlgorithmNull:
-		return mu.NilUnionValue
+		return nil, nil
 	default:
-		return nil
+		return nil, &mu.InvalidSelectorError{Selector: selector}
 	}
 }
 
@@ -1094,32 +1460,32 @@ type AsymSchemeU struct {
 	ECMQV     *KeySchemeECMQV
 }
 
-func (s *AsymSchemeU) Select(selector reflect.Value) interface{} {
+func (s *AsymSchemeU) Select(selector reflect.Value) (interface{}, error) {
 	switch selector.Convert(reflect.TypeOf(AsymSchemeId(0))).Interface().(AsymSchemeId) {
 	case AsymSchemeRSASSA:
-		return &s.RSASSA
+		return &s.RSASSA, nil
 	case AsymSchemeRSAES:
-		return &s.RSAES
+		return &s.RSAES, nil
 	case AsymSchemeRSAPSS:
-		return &s.RSAPSS
+		return &s.RSAPSS, nil
 	case AsymSchemeOAEP:
-		return &s.OAEP
+		return &s.OAEP, nil
 	case AsymSchemeECDSA:
-		return &s.ECDSA
+		return &s.ECDSA, nil
 	case AsymSchemeECDH:
-		return &s.ECDH
+		return &s.ECDH, nil
 	case AsymSchemeECDAA:
-		return &s.ECDAA
+		return &s.ECDAA, nil
 	case AsymSchemeSM2:
-		return &s.SM2
+		return &s.SM2, nil
 	case AsymSchemeECSCHNORR:
-		return &s.ECSCHNORR
+		return &s.ECSCHNORR, nil
 	case AsymSchemeECMQV:
-		return &s.ECMQV
+		return &s.ECMQV, nil
 	case AsymSchemeNull:
-		return mu.NilUnionValue
+		return nil, nil
 	default:
-		return nil
+		return nil, &mu.InvalidSelectorError{Selector: selector}
 	}
 }
 
@@ -1156,6 +1522,52 @@ type AsymScheme struct {
 	Details *AsymSchemeU `tpm2:"selector:Scheme"` // Scheme specific parameters
 }
 
+func makeAsymSchemeU(scheme AsymSchemeId, hashAlg HashAlgorithmId) *AsymSchemeU {
+	switch scheme {
+	case AsymSchemeRSASSA:
+		return &AsymSchemeU{RSASSA: &SigSchemeRSASSA{HashAlg: hashAlg}}
+	case AsymSchemeRSAES:
+		return &AsymSchemeU{RSAES: new(EncSchemeRSAES)}
+	case AsymSchemeRSAPSS:
+		return &AsymSchemeU{RSAPSS: &SigSchemeRSAPSS{HashAlg: hashAlg}}
+	case AsymSchemeOAEP:
+		return &AsymSchemeU{OAEP: &EncSchemeOAEP{HashAlg: hashAlg}}
+	case AsymSchemeECDSA:
+		return &AsymSchemeU{ECDSA: &SigSchemeECDSA{HashAlg: hashAlg}}
+	case AsymSchemeECDH:
+		return &AsymSchemeU{ECDH: &KeySchemeECDH{HashAlg: hashAlg}}
+	case AsymSchemeECDAA:
+		return &AsymSchemeU{ECDAA: &SigSchemeECDAA{HashAlg: hashAlg}}
+	case AsymSchemeSM2:
+		return &AsymSchemeU{SM2: &SigSchemeSM2{HashAlg: hashAlg}}
+	case AsymSchemeECSCHNORR:
+		return &AsymSchemeU{ECSCHNORR: &SigSchemeECSCHNORR{HashAlg: hashAlg}}
+	case AsymSchemeECMQV:
+		return &AsymSchemeU{ECMQV: &KeySchemeECMQV{HashAlg: hashAlg}}
+	default:
+		return nil
+	}
+}
+
+func validateAsymScheme(scheme AsymSchemeId, details *AsymSchemeU) error {
+	switch scheme {
+	case AsymSchemeNull:
+		return nil
+	case AsymSchemeRSAES:
+		if details == nil || details.RSAES == nil {
+			return errors.New("no scheme parameters")
+		}
+		return nil
+	}
+	if details == nil {
+		return errors.New("no scheme parameters")
+	}
+	if d := details.Any(); d == nil || !d.HashAlg.IsValid() {
+		return fmt.Errorf("invalid digest algorithm for scheme %v", scheme)
+	}
+	return nil
+}
+
 // 11.2.4 RSA
 
 // RSASchemeId corresponds to the TPMI_ALG_RSA_SCHEME type.
@@ -1167,6 +1579,30 @@ type RSAScheme struct {
 	Details *AsymSchemeU `tpm2:"selector:Scheme"` // Scheme specific parameters.
 }
 
+// Validate checks that the scheme is a valid RSA scheme, and that a valid digest algorithm is specified for schemes that
+// require one.
+func (s *RSAScheme) Validate() error {
+	switch s.Scheme {
+	case RSASchemeNull, RSASchemeRSASSA, RSASchemeRSAES, RSASchemeRSAPSS, RSASchemeOAEP:
+		return validateAsymScheme(AsymSchemeId(s.Scheme), s.Details)
+	default:
+		return fmt.Errorf("invalid RSA scheme: %v", s.Scheme)
+	}
+}
+
+// MakeRSAScheme returns a RSAScheme for the specified scheme and digest algorithm, returning an error if the scheme or digest
+// algorithm is invalid. The digest algorithm is ignored for RSASchemeRSAES and RSASchemeNull.
+func MakeRSAScheme(scheme RSASchemeId, hashAlg HashAlgorithmId) (*RSAScheme, error) {
+	s := &RSAScheme{Scheme: scheme}
+	if scheme != RSASchemeNull {
+		s.Details = makeAsymSchemeU(AsymSchemeId(scheme), hashAlg)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
 // PublicKeyRSA corresponds to the TPM2B_PUBLIC_KEY_RSA type.
 type PublicKeyRSA []byte
 
@@ -1193,6 +1629,29 @@ type ECCScheme struct {
 	Details *AsymSchemeU `tpm2:"selector:Scheme"` // Scheme specific parameters.
 }
 
+// Validate checks that the scheme is a valid ECC scheme, and that a valid digest algorithm is specified for it.
+func (s *ECCScheme) Validate() error {
+	switch s.Scheme {
+	case ECCSchemeNull, ECCSchemeECDSA, ECCSchemeECDH, ECCSchemeECDAA, ECCSchemeSM2, ECCSchemeECSCHNORR, ECCSchemeECMQV:
+		return validateAsymScheme(AsymSchemeId(s.Scheme), s.Details)
+	default:
+		return fmt.Errorf("invalid ECC scheme: %v", s.Scheme)
+	}
+}
+
+// MakeECCScheme returns a ECCScheme for the specified scheme and digest algorithm, returning an error if the scheme or digest
+// algorithm is invalid. The digest algorithm is ignored for ECCSchemeNull.
+func MakeECCScheme(scheme ECCSchemeId, hashAlg HashAlgorithmId) (*ECCScheme, error) {
+	s := &ECCScheme{Scheme: scheme}
+	if scheme != ECCSchemeNull {
+		s.Details = makeAsymSchemeU(AsymSchemeId(scheme), hashAlg)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
 // 11.3 Signatures
 
 // SignatureRSA corresponds to the TPMS_SIGNATURE_RSA type.
@@ -1235,26 +1694,26 @@ type SignatureU struct {
 	HMAC      *TaggedHash
 }
 
-func (s *SignatureU) Select(selector reflect.Value) interface{} {
+func (s *SignatureU) Select(selector reflect.Value) (interface{}, error) {
 	switch selector.Interface().(SigSchemeId) {
 	case SigSchemeAlgRSASSA:
-		return &s.RSASSA
+		return &s.RSASSA, nil
 	case SigSchemeAlgRSAPSS:
-		return &s.RSAPSS
+		return &s.RSAPSS, nil
 	case SigSchemeAlgECDSA:
-		return &s.ECDSA
+		return &s.ECDSA, nil
 	case SigSchemeAlgECDAA:
-		return &s.ECDAA
+		return &s.ECDAA, nil
 	case SigSchemeAlgSM2:
-		return &s.SM2
+		return &s.SM2, nil
 	case SigSchemeAlgECSCHNORR:
-		return &s.ECSCHNORR
+		return &s.ECSCHNORR, nil
 	case SigSchemeAlgHMAC:
-		return &s.HMAC
+		return &s.HMAC, nil
 	case SigSchemeAlgNull:
-		return mu.NilUnionValue
+		return nil, nil
 	default:
-		return nil
+		return nil, &mu.InvalidSelectorError{Selector: selector}
 	}
 }
 
@@ -1288,6 +1747,92 @@ type Signature struct {
 	Signature *SignatureU `tpm2:"selector:SigAlg"` // Actual signature
 }
 
+// ECDSA returns the R and S components of this signature if it is an ECDSA signature, for use with ecdsa.Verify from the
+// standard library.
+func (s *Signature) ECDSA() (r, sig *big.Int, err error) {
+	if s.SigAlg != SigSchemeAlgECDSA || s.Signature == nil || s.Signature.ECDSA == nil {
+		return nil, nil, fmt.Errorf("not an ECDSA signature (signature algorithm: %v)", s.SigAlg)
+	}
+	return new(big.Int).SetBytes(s.Signature.ECDSA.SignatureR), new(big.Int).SetBytes(s.Signature.ECDSA.SignatureS), nil
+}
+
+// ECDSAASN1 returns this signature encoded as an ASN.1 DER ECDSA-Sig-Value structure, as defined in RFC 3279, if it is an
+// ECDSA signature.
+func (s *Signature) ECDSAASN1() ([]byte, error) {
+	r, sig, err := s.ECDSA()
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(ecdsaSignature{R: r, S: sig})
+}
+
+// RSA returns the signature bytes if this is a RSASSA-PKCS1-v1_5 or RSASSA-PSS signature, for use with rsa.VerifyPKCS1v15 or
+// rsa.VerifyPSS from the standard library.
+func (s *Signature) RSA() ([]byte, error) {
+	if s.Signature == nil {
+		return nil, fmt.Errorf("not a RSA signature (signature algorithm: %v)", s.SigAlg)
+	}
+	switch {
+	case s.SigAlg == SigSchemeAlgRSASSA && s.Signature.RSASSA != nil:
+		return s.Signature.RSASSA.Sig, nil
+	case s.SigAlg == SigSchemeAlgRSAPSS && s.Signature.RSAPSS != nil:
+		return s.Signature.RSAPSS.Sig, nil
+	default:
+		return nil, fmt.Errorf("not a RSA signature (signature algorithm: %v)", s.SigAlg)
+	}
+}
+
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// NewECDSASignature creates a ECDSA signature from the supplied R and S components and the digest algorithm used to create
+// the signed digest.
+func NewECDSASignature(hashAlg HashAlgorithmId, r, s *big.Int) *Signature {
+	return &Signature{
+		SigAlg: SigSchemeAlgECDSA,
+		Signature: &SignatureU{
+			ECDSA: &SignatureECDSA{
+				Hash:       hashAlg,
+				SignatureR: r.Bytes(),
+				SignatureS: s.Bytes()}}}
+}
+
+// NewECDSASignatureFromASN1 creates a ECDSA signature from the supplied ASN.1 DER encoded ECDSA-Sig-Value structure, as
+// produced by ecdsa.SignASN1 or crypto.Signer implementations for ECDSA keys, and the digest algorithm used to create the
+// signed digest.
+func NewECDSASignatureFromASN1(hashAlg HashAlgorithmId, data []byte) (*Signature, error) {
+	var sig ecdsaSignature
+	rest, err := asn1.Unmarshal(data, &sig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode signature: %v", err)
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("cannot decode signature: trailing bytes")
+	}
+	if sig.R == nil || sig.S == nil || sig.R.Sign() <= 0 || sig.S.Sign() <= 0 {
+		return nil, errors.New("invalid signature")
+	}
+	return NewECDSASignature(hashAlg, sig.R, sig.S), nil
+}
+
+// NewRSASSASignature creates a RSASSA-PKCS1-v1_5 signature from the supplied signature bytes, as produced by
+// rsa.SignPKCS1v15, and the digest algorithm used to create the signed digest.
+func NewRSASSASignature(hashAlg HashAlgorithmId, sig []byte) *Signature {
+	return &Signature{
+		SigAlg:    SigSchemeAlgRSASSA,
+		Signature: &SignatureU{RSASSA: &SignatureRSASSA{Hash: hashAlg, Sig: sig}}}
+}
+
+// NewRSAPSSSignature creates a RSASSA-PSS signature from the supplied signature bytes, as produced by rsa.SignPSS, and the
+// digest algorithm used to create the signed digest. Note that the TPM requires the salt length to be the same as the digest
+// length (rsa.PSSSaltLengthEqualsHash) when verifying signatures.
+func NewRSAPSSSignature(hashAlg HashAlgorithmId, sig []byte) *Signature {
+	return &Signature{
+		SigAlg:    SigSchemeAlgRSAPSS,
+		Signature: &SignatureU{RSAPSS: &SignatureRSAPSS{Hash: hashAlg, Sig: sig}}}
+}
+
 // 11.4) Key/Secret Exchange
 
 // EncryptedSecret corresponds to the TPM2B_ENCRYPTED_SECRET type.
@@ -1313,18 +1858,18 @@ type PublicIDU struct {
 	ECC       *ECCPoint
 }
 
-func (p *PublicIDU) Select(selector reflect.Value) interface{} {
+func (p *PublicIDU) Select(selector reflect.Value) (interface{}, error) {
 	switch selector.Interface().(ObjectTypeId) {
 	case ObjectTypeRSA:
-		return &p.RSA
+		return &p.RSA, nil
 	case ObjectTypeKeyedHash:
-		return &p.KeyedHash
+		return &p.KeyedHash, nil
 	case ObjectTypeECC:
-		return &p.ECC
+		return &p.ECC, nil
 	case ObjectTypeSymCipher:
-		return &p.Sym
+		return &p.Sym, nil
 	default:
-		return nil
+		return nil, &mu.InvalidSelectorError{Selector: selector}
 	}
 }
 
@@ -1378,18 +1923,18 @@ type PublicParamsU struct {
 	ECCDetail       *ECCParams
 }
 
-func (p *PublicParamsU) Select(selector reflect.Value) interface{} {
+func (p *PublicParamsU) Select(selector reflect.Value) (interface{}, error) {
 	switch selector.Interface().(ObjectTypeId) {
 	case ObjectTypeRSA:
-		return &p.RSADetail
+		return &p.RSADetail, nil
 	case ObjectTypeKeyedHash:
-		return &p.KeyedHashDetail
+		return &p.KeyedHashDetail, nil
 	case ObjectTypeECC:
-		return &p.ECCDetail
+		return &p.ECCDetail, nil
 	case ObjectTypeSymCipher:
-		return &p.SymDetail
+		return &p.SymDetail, nil
 	default:
-		return nil
+		return nil, &mu.InvalidSelectorError{Selector: selector}
 	}
 }
 
@@ -1466,6 +2011,46 @@ func (p *Public) ToTemplate() (Template, error) {
 	return b, nil
 }
 
+// ComputeTemplateHash computes the digest of this public area using the specified digest algorithm, for use as the templateHash
+// argument of the TPM2_PolicyTemplate assertion. This restricts the use of a policy session to the creation of objects with this
+// template.
+func (p *Public) ComputeTemplateHash(alg HashAlgorithmId) (Digest, error) {
+	if !alg.Available() {
+		return nil, fmt.Errorf("unsupported digest algorithm: %v", alg)
+	}
+	hasher := alg.NewHash()
+	if _, err := mu.MarshalToWriter(hasher, p); err != nil {
+		return nil, fmt.Errorf("cannot marshal object: %v", err)
+	}
+	return hasher.Sum(nil), nil
+}
+
+// ToBytes returns the TPMT_PUBLIC wire representation of this public area.
+func (p *Public) ToBytes() ([]byte, error) {
+	b, err := mu.MarshalToBytes(p)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal object: %v", err)
+	}
+	return b, nil
+}
+
+// PublicFromBytes unmarshals the supplied TPMT_PUBLIC structure, such as one serialized by another TSS or obtained from
+// Public.ToBytes. An error is returned if the data contains trailing bytes, if the name algorithm is not a supported digest
+// algorithm or if the size of the authorization policy digest is inconsistent with the name algorithm.
+func PublicFromBytes(b []byte) (*Public, error) {
+	var p *Public
+	if _, err := mu.UnmarshalFromBytesStrict(b, &p); err != nil {
+		return nil, xerrors.Errorf("cannot unmarshal object: %w", err)
+	}
+	if !p.NameAlg.Supported() {
+		return nil, fmt.Errorf("unsupported name algorithm: %v", p.NameAlg)
+	}
+	if len(p.AuthPolicy) > 0 && len(p.AuthPolicy) != p.NameAlg.Size() {
+		return nil, errors.New("authorization policy digest has the wrong size for the name algorithm")
+	}
+	return p, nil
+}
+
 type publicSized struct {
 	Ptr *Public `tpm2:"sized"`
 }
@@ -1534,18 +2119,18 @@ type SensitiveCompositeU struct {
 	Sym  SymKey
 }
 
-func (s *SensitiveCompositeU) Select(selector reflect.Value) interface{} {
+func (s *SensitiveCompositeU) Select(selector reflect.Value) (interface{}, error) {
 	switch selector.Interface().(ObjectTypeId) {
 	case ObjectTypeRSA:
-		return &s.RSA
+		return &s.RSA, nil
 	case ObjectTypeECC:
-		return &s.ECC
+		return &s.ECC, nil
 	case ObjectTypeKeyedHash:
-		return &s.Bits
+		return &s.Bits, nil
 	case ObjectTypeSymCipher:
-		return &s.Sym
+		return &s.Sym, nil
 	default:
-		return nil
+		return nil, &mu.InvalidSelectorError{Selector: selector}
 	}
 }
 
@@ -1662,6 +2247,36 @@ func (p *NVPublic) copy() (*NVPublic, error) {
 	return out, nil
 }
 
+// ToBytes returns the TPMS_NV_PUBLIC wire representation of this public area.
+func (p *NVPublic) ToBytes() ([]byte, error) {
+	b, err := mu.MarshalToBytes(p)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal index: %v", err)
+	}
+	return b, nil
+}
+
+// NVPublicFromBytes unmarshals the supplied TPMS_NV_PUBLIC structure, such as one serialized by another TSS or obtained from
+// NVPublic.ToBytes. An error is returned if the data contains trailing bytes, if the handle is not a NV index handle, if the
+// name algorithm is not a supported digest algorithm or if the size of the authorization policy digest is inconsistent with the
+// name algorithm.
+func NVPublicFromBytes(b []byte) (*NVPublic, error) {
+	var p *NVPublic
+	if _, err := mu.UnmarshalFromBytesStrict(b, &p); err != nil {
+		return nil, xerrors.Errorf("cannot unmarshal index: %w", err)
+	}
+	if p.Index.Type() != HandleTypeNVIndex {
+		return nil, fmt.Errorf("invalid handle type for NV index: %v", p.Index)
+	}
+	if !p.NameAlg.Supported() {
+		return nil, fmt.Errorf("unsupported name algorithm: %v", p.NameAlg)
+	}
+	if len(p.AuthPolicy) > 0 && len(p.AuthPolicy) != p.NameAlg.Size() {
+		return nil, errors.New("authorization policy digest has the wrong size for the name algorithm")
+	}
+	return p, nil
+}
+
 type nvPublicSized struct {
 	Ptr *NVPublic `tpm2:"sized"`
 }
@@ -6,8 +6,16 @@ package tpm2_test
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha1"
 	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/hex"
+	"math/big"
 	"reflect"
 	"testing"
 
@@ -66,6 +74,51 @@ func TestHandle(t *testing.T) {
 	}
 }
 
+func TestHashAlgorithmId(t *testing.T) {
+	for _, data := range []struct {
+		desc      string
+		alg       HashAlgorithmId
+		hash      crypto.Hash
+		valid     bool
+		available bool
+	}{
+		{desc: "SHA1", alg: HashAlgorithmSHA1, hash: crypto.SHA1, valid: true, available: true},
+		{desc: "SHA256", alg: HashAlgorithmSHA256, hash: crypto.SHA256, valid: true, available: true},
+		{desc: "SHA384", alg: HashAlgorithmSHA384, hash: crypto.SHA384, valid: true, available: true},
+		{desc: "SHA512", alg: HashAlgorithmSHA512, hash: crypto.SHA512, valid: true, available: true},
+		{desc: "SM3_256", alg: HashAlgorithmSM3_256, valid: true},
+		{desc: "Null", alg: HashAlgorithmNull},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			if data.alg.GetHash() != data.hash {
+				t.Errorf("Unexpected crypto.Hash (%v)", data.alg.GetHash())
+			}
+			if data.alg.IsValid() != data.valid {
+				t.Errorf("Unexpected IsValid result")
+			}
+			if data.alg.Available() != data.available {
+				t.Errorf("Unexpected Available result")
+			}
+			if !data.available {
+				return
+			}
+			if HashAlgorithmIdFromCryptoHash(data.hash) != data.alg {
+				t.Errorf("Unexpected HashAlgorithmIdFromCryptoHash result (%v)", HashAlgorithmIdFromCryptoHash(data.hash))
+			}
+			if data.alg.Size() != data.hash.Size() {
+				t.Errorf("Unexpected size (%d)", data.alg.Size())
+			}
+			if data.alg.NewHash().Size() != data.hash.Size() {
+				t.Errorf("NewHash returned the wrong hash")
+			}
+		})
+	}
+
+	if HashAlgorithmIdFromCryptoHash(crypto.MD5) != HashAlgorithmNull {
+		t.Errorf("Unexpected HashAlgorithmIdFromCryptoHash result for unsupported algorithm")
+	}
+}
+
 type TestPublicIDUContainer struct {
 	Alg    ObjectTypeId
 	Unique *PublicIDU `tpm2:"selector:Alg"`
@@ -95,19 +148,28 @@ func TestPublicIDUnion(t *testing.T) {
 			in: TestPublicIDUContainer{Alg: ObjectTypeId(AlgorithmNull),
 				Unique: &PublicIDU{Sym: Digest{0x04, 0x05, 0x06, 0x07}}},
 			out: []byte{0x00, 0x10},
-			err: "cannot unmarshal argument at index 0: cannot process struct type tpm2_test.TestPublicIDUContainer: cannot process field " +
+			err: "cannot process struct type tpm2_test.TestPublicIDUContainer: cannot process field " +
 				"Unique from struct type tpm2_test.TestPublicIDUContainer: cannot process union type tpm2.PublicIDU, inside container type " +
 				"tpm2_test.TestPublicIDUContainer: invalid selector value: TPM_ALG_NULL",
 		},
 	} {
 		t.Run(data.desc, func(t *testing.T) {
 			out, err := mu.MarshalToBytes(data.in)
-			if err != nil {
-				t.Fatalf("MarshalToBytes failed: %v", err)
-			}
-
-			if !bytes.Equal(out, data.out) {
-				t.Fatalf("MarshalToBytes returned an unexpected byte sequence: %x", out)
+			if data.err != "" {
+				if err == nil {
+					t.Fatalf("MarshalToBytes was expected to fail")
+				}
+				if err.Error() != "cannot marshal argument at index 0: "+data.err {
+					t.Errorf("MarshalToBytes returned an unexpected error: %v", err)
+				}
+				out = data.out
+			} else {
+				if err != nil {
+					t.Fatalf("MarshalToBytes failed: %v", err)
+				}
+				if !bytes.Equal(out, data.out) {
+					t.Fatalf("MarshalToBytes returned an unexpected byte sequence: %x", out)
+				}
 			}
 
 			var a TestPublicIDUContainer
@@ -116,7 +178,7 @@ func TestPublicIDUnion(t *testing.T) {
 				if err == nil {
 					t.Fatalf("UnmarshalFromBytes was expected to fail")
 				}
-				if err.Error() != data.err {
+				if err.Error() != "cannot unmarshal argument at index 0: "+data.err {
 					t.Errorf("UnmarshalFromBytes returned an unexpected error: %v", err)
 				}
 			} else {
@@ -163,19 +225,28 @@ func TestSchemeKeyedHashUnion(t *testing.T) {
 			desc: "InvalidSelector",
 			in:   TestSchemeKeyedHashUContainer{Scheme: KeyedHashSchemeId(HashAlgorithmSHA256)},
 			out:  []byte{0x00, 0x0b},
-			err: "cannot unmarshal argument at index 0: cannot process struct type tpm2_test.TestSchemeKeyedHashUContainer: cannot " +
+			err: "cannot process struct type tpm2_test.TestSchemeKeyedHashUContainer: cannot " +
 				"process field Details from struct type tpm2_test.TestSchemeKeyedHashUContainer: cannot process union type " +
 				"tpm2.SchemeKeyedHashU, inside container type tpm2_test.TestSchemeKeyedHashUContainer: invalid selector value: TPM_ALG_SHA256",
 		},
 	} {
 		t.Run(data.desc, func(t *testing.T) {
 			out, err := mu.MarshalToBytes(data.in)
-			if err != nil {
-				t.Fatalf("MarshalToBytes failed: %v", err)
-			}
-
-			if !bytes.Equal(out, data.out) {
-				t.Errorf("MarshalToBytes returned an unexpected sequence of bytes: %x", out)
+			if data.err != "" {
+				if err == nil {
+					t.Fatalf("MarshalToBytes was expected to fail")
+				}
+				if err.Error() != "cannot marshal argument at index 0: "+data.err {
+					t.Errorf("MarshalToBytes returned an unexpected error: %v", err)
+				}
+				out = data.out
+			} else {
+				if err != nil {
+					t.Fatalf("MarshalToBytes failed: %v", err)
+				}
+				if !bytes.Equal(out, data.out) {
+					t.Errorf("MarshalToBytes returned an unexpected sequence of bytes: %x", out)
+				}
 			}
 
 			var a TestSchemeKeyedHashUContainer
@@ -184,7 +255,7 @@ func TestSchemeKeyedHashUnion(t *testing.T) {
 				if err == nil {
 					t.Fatalf("UnmarshaFromBytes was expected to fail")
 				}
-				if err.Error() != data.err {
+				if err.Error() != "cannot unmarshal argument at index 0: "+data.err {
 					t.Errorf("UnmarshalFromBytes returned an unexpected error: %v", err)
 				}
 			} else {
@@ -203,6 +274,143 @@ func TestSchemeKeyedHashUnion(t *testing.T) {
 	}
 }
 
+func TestSymDefValidate(t *testing.T) {
+	for _, data := range []struct {
+		desc  string
+		in    *SymDef
+		valid bool
+	}{
+		{desc: "AES128CFB", in: SymDefAES128CFB(), valid: true},
+		{desc: "XOR", in: SymDefXOR(HashAlgorithmSHA256), valid: true},
+		{desc: "Null", in: SymDefNull(), valid: true},
+		{desc: "XORNullHash", in: SymDefXOR(HashAlgorithmNull)},
+		{desc: "AES256CFB", in: &SymDef{Algorithm: SymAlgorithmAES, KeyBits: &SymKeyBitsU{Sym: 256}, Mode: &SymModeU{Sym: SymModeCFB}}, valid: true},
+		{desc: "AES128CBC", in: &SymDef{Algorithm: SymAlgorithmAES, KeyBits: &SymKeyBitsU{Sym: 128}, Mode: &SymModeU{Sym: SymModeCBC}}},
+		{desc: "AES64CFB", in: &SymDef{Algorithm: SymAlgorithmAES, KeyBits: &SymKeyBitsU{Sym: 64}, Mode: &SymModeU{Sym: SymModeCFB}}},
+		{desc: "SM4256CFB", in: &SymDef{Algorithm: SymAlgorithmSM4, KeyBits: &SymKeyBitsU{Sym: 256}, Mode: &SymModeU{Sym: SymModeCFB}}},
+		{desc: "NoKeyBits", in: &SymDef{Algorithm: SymAlgorithmAES, Mode: &SymModeU{Sym: SymModeCFB}}},
+		{desc: "InvalidAlg", in: &SymDef{Algorithm: SymAlgorithmId(AlgorithmSHA256)}},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			err := data.in.Validate()
+			if data.valid && err != nil {
+				t.Errorf("Validate failed: %v", err)
+			}
+			if !data.valid && err == nil {
+				t.Errorf("Validate should have failed")
+			}
+		})
+	}
+}
+
+func TestSymDefObjectValidate(t *testing.T) {
+	for _, data := range []struct {
+		desc  string
+		in    *SymDefObject
+		valid bool
+	}{
+		{desc: "AES128CFB", in: SymDefObjectAES128CFB(), valid: true},
+		{desc: "Null", in: SymDefObjectNull(), valid: true},
+		{desc: "AES256NullMode", in: &SymDefObject{Algorithm: SymObjectAlgorithmAES, KeyBits: &SymKeyBitsU{Sym: 256}, Mode: &SymModeU{Sym: SymModeNull}}, valid: true},
+		{desc: "Camellia192CTR", in: &SymDefObject{Algorithm: SymObjectAlgorithmCamellia, KeyBits: &SymKeyBitsU{Sym: 192}, Mode: &SymModeU{Sym: SymModeCTR}}, valid: true},
+		{desc: "AES100CFB", in: &SymDefObject{Algorithm: SymObjectAlgorithmAES, KeyBits: &SymKeyBitsU{Sym: 100}, Mode: &SymModeU{Sym: SymModeCFB}}},
+		{desc: "InvalidMode", in: &SymDefObject{Algorithm: SymObjectAlgorithmAES, KeyBits: &SymKeyBitsU{Sym: 128}, Mode: &SymModeU{Sym: SymModeId(AlgorithmSHA1)}}},
+		{desc: "NoMode", in: &SymDefObject{Algorithm: SymObjectAlgorithmAES, KeyBits: &SymKeyBitsU{Sym: 128}}},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			err := data.in.Validate()
+			if data.valid && err != nil {
+				t.Errorf("Validate failed: %v", err)
+			}
+			if !data.valid && err == nil {
+				t.Errorf("Validate should have failed")
+			}
+		})
+	}
+}
+
+func TestMakeSymDef(t *testing.T) {
+	d, err := MakeSymDef(SymAlgorithmAES, 128, SymModeCFB)
+	if err != nil {
+		t.Fatalf("MakeSymDef failed: %v", err)
+	}
+	if !reflect.DeepEqual(d, SymDefAES128CFB()) {
+		t.Errorf("MakeSymDef returned an unexpected value")
+	}
+	if _, err := MakeSymDef(SymAlgorithmAES, 128, SymModeECB); err == nil {
+		t.Errorf("MakeSymDef should fail for ECB mode")
+	}
+
+	o, err := MakeSymDefObject(SymObjectAlgorithmAES, 128, SymModeCFB)
+	if err != nil {
+		t.Fatalf("MakeSymDefObject failed: %v", err)
+	}
+	if !reflect.DeepEqual(o, SymDefObjectAES128CFB()) {
+		t.Errorf("MakeSymDefObject returned an unexpected value")
+	}
+	if _, err := MakeSymDefObject(SymObjectAlgorithmSM4, 192, SymModeCFB); err == nil {
+		t.Errorf("MakeSymDefObject should fail for SM4 with a 192-bit key")
+	}
+}
+
+func TestMakeSchemes(t *testing.T) {
+	rsa, err := MakeRSAScheme(RSASchemeRSAPSS, HashAlgorithmSHA256)
+	if err != nil {
+		t.Fatalf("MakeRSAScheme failed: %v", err)
+	}
+	if !reflect.DeepEqual(rsa, &RSAScheme{Scheme: RSASchemeRSAPSS, Details: &AsymSchemeU{RSAPSS: &SigSchemeRSAPSS{HashAlg: HashAlgorithmSHA256}}}) {
+		t.Errorf("MakeRSAScheme returned an unexpected value")
+	}
+	if _, err := MakeRSAScheme(RSASchemeRSAES, HashAlgorithmNull); err != nil {
+		t.Errorf("MakeRSAScheme failed for RSAES: %v", err)
+	}
+	if _, err := MakeRSAScheme(RSASchemeOAEP, HashAlgorithmNull); err == nil {
+		t.Errorf("MakeRSAScheme should fail for OAEP without a digest algorithm")
+	}
+	if _, err := MakeRSAScheme(RSASchemeId(AlgorithmECDSA), HashAlgorithmSHA256); err == nil {
+		t.Errorf("MakeRSAScheme should fail for an ECC scheme")
+	}
+
+	ecc, err := MakeECCScheme(ECCSchemeECDSA, HashAlgorithmSHA384)
+	if err != nil {
+		t.Fatalf("MakeECCScheme failed: %v", err)
+	}
+	if !reflect.DeepEqual(ecc, &ECCScheme{Scheme: ECCSchemeECDSA, Details: &AsymSchemeU{ECDSA: &SigSchemeECDSA{HashAlg: HashAlgorithmSHA384}}}) {
+		t.Errorf("MakeECCScheme returned an unexpected value")
+	}
+	if _, err := MakeECCScheme(ECCSchemeNull, HashAlgorithmNull); err != nil {
+		t.Errorf("MakeECCScheme failed for Null: %v", err)
+	}
+	if _, err := MakeECCScheme(ECCSchemeId(AlgorithmRSASSA), HashAlgorithmSHA256); err == nil {
+		t.Errorf("MakeECCScheme should fail for a RSA scheme")
+	}
+
+	sig, err := MakeSigScheme(SigSchemeAlgHMAC, HashAlgorithmSHA256)
+	if err != nil {
+		t.Fatalf("MakeSigScheme failed: %v", err)
+	}
+	if !reflect.DeepEqual(sig, &SigScheme{Scheme: SigSchemeAlgHMAC, Details: &SigSchemeU{HMAC: &SchemeHMAC{HashAlg: HashAlgorithmSHA256}}}) {
+		t.Errorf("MakeSigScheme returned an unexpected value")
+	}
+	if _, err := MakeSigScheme(SigSchemeAlgECDSA, HashAlgorithmId(AlgorithmAES)); err == nil {
+		t.Errorf("MakeSigScheme should fail with an invalid digest algorithm")
+	}
+
+	kh, err := MakeKeyedHashSchemeXOR(HashAlgorithmSHA256, KDFAlgorithmKDF1_SP800_108)
+	if err != nil {
+		t.Fatalf("MakeKeyedHashSchemeXOR failed: %v", err)
+	}
+	if !reflect.DeepEqual(kh, &KeyedHashScheme{Scheme: KeyedHashSchemeXOR, Details: &SchemeKeyedHashU{XOR: &SchemeXOR{HashAlg: HashAlgorithmSHA256, KDF: KDFAlgorithmKDF1_SP800_108}}}) {
+		t.Errorf("MakeKeyedHashSchemeXOR returned an unexpected value")
+	}
+	if _, err := MakeKeyedHashSchemeXOR(HashAlgorithmSHA256, KDFAlgorithmNull); err == nil {
+		t.Errorf("MakeKeyedHashSchemeXOR should fail without a KDF")
+	}
+	if _, err := MakeKeyedHashSchemeHMAC(HashAlgorithmSHA1); err != nil {
+		t.Errorf("MakeKeyedHashSchemeHMAC failed: %v", err)
+	}
+}
+
 func TestPCRSelect(t *testing.T) {
 	for _, data := range []struct {
 		desc string
@@ -257,6 +465,18 @@ func TestPCRSelectionList(t *testing.T) {
 			in:   PCRSelectionList{{Hash: HashAlgorithmSHA1, Select: []int{3, 6, 24}}},
 			out:  []byte{0x00, 0x00, 0x00, 0x01, 0x00, 0x04, 0x04, 0x48, 0x00, 0x00, 0x01},
 		},
+		{
+			desc: "Empty",
+			in:   PCRSelectionList{},
+			out:  []byte{0x00, 0x00, 0x00, 0x00},
+		},
+		{
+			desc: "2",
+			in: PCRSelectionList{
+				{Hash: HashAlgorithmSHA256, Select: []int{0, 7}},
+				{Hash: HashAlgorithmSHA1, Select: []int{}}},
+			out: []byte{0x00, 0x00, 0x00, 0x02, 0x00, 0x0b, 0x03, 0x81, 0x00, 0x00, 0x00, 0x04, 0x03, 0x00, 0x00, 0x00},
+		},
 	} {
 		t.Run(data.desc, func(t *testing.T) {
 			out, err := mu.MarshalToBytes(&data.in)
@@ -284,6 +504,14 @@ func TestPCRSelectionList(t *testing.T) {
 	}
 }
 
+func TestPCRSelectionListUnmarshalTruncated(t *testing.T) {
+	var a PCRSelectionList
+	_, err := mu.UnmarshalFromBytes([]byte{0x00, 0x00, 0x00, 0x02, 0x00, 0x0b, 0x03, 0x81, 0x00, 0x00}, &a)
+	if err == nil {
+		t.Fatalf("UnmarshalFromBytes should have failed")
+	}
+}
+
 func TestTaggedHash(t *testing.T) {
 	sha1Hash := sha1.Sum([]byte("foo"))
 	sha256Hash := sha256.Sum256([]byte("foo"))
@@ -433,6 +661,245 @@ func TestPublicName(t *testing.T) {
 	}
 }
 
+func TestPublicComputeTemplateHash(t *testing.T) {
+	pub := Public{
+		Type:    ObjectTypeKeyedHash,
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   AttrFixedTPM | AttrFixedParent | AttrUserWithAuth,
+		Params:  &PublicParamsU{KeyedHashDetail: &KeyedHashParams{Scheme: KeyedHashScheme{Scheme: KeyedHashSchemeNull}}},
+		Unique:  &PublicIDU{KeyedHash: Digest{}}}
+	// TPMT_PUBLIC: type=TPM_ALG_KEYEDHASH, nameAlg=TPM_ALG_SHA256, objectAttributes=0x52, authPolicy=empty,
+	// scheme=TPM_ALG_NULL, unique=empty
+	b, _ := hex.DecodeString("0008000b00000052000000100000")
+	expected := sha256.Sum256(b)
+
+	digest, err := pub.ComputeTemplateHash(HashAlgorithmSHA256)
+	if err != nil {
+		t.Fatalf("ComputeTemplateHash failed: %v", err)
+	}
+	if !bytes.Equal(digest, expected[:]) {
+		t.Errorf("ComputeTemplateHash returned an unexpected digest: %x", digest)
+	}
+
+	if _, err := pub.ComputeTemplateHash(HashAlgorithmNull); err == nil {
+		t.Errorf("ComputeTemplateHash should fail with an unsupported algorithm")
+	}
+}
+
+func TestPublicFromBytes(t *testing.T) {
+	pub := Public{
+		Type:       ObjectTypeKeyedHash,
+		NameAlg:    HashAlgorithmSHA256,
+		Attrs:      AttrFixedTPM | AttrFixedParent | AttrUserWithAuth,
+		AuthPolicy: make(Digest, 32),
+		Params:     &PublicParamsU{KeyedHashDetail: &KeyedHashParams{Scheme: KeyedHashScheme{Scheme: KeyedHashSchemeNull}}},
+		Unique:     &PublicIDU{KeyedHash: Digest{}}}
+	b, err := pub.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes failed: %v", err)
+	}
+
+	pub2, err := PublicFromBytes(b)
+	if err != nil {
+		t.Fatalf("PublicFromBytes failed: %v", err)
+	}
+	b2, err := pub2.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes failed: %v", err)
+	}
+	if !bytes.Equal(b2, b) {
+		t.Errorf("PublicFromBytes returned an unexpected value")
+	}
+
+	if _, err := PublicFromBytes(append(b, 0)); err == nil {
+		t.Errorf("PublicFromBytes should fail with trailing bytes")
+	}
+
+	pub.AuthPolicy = make(Digest, 20)
+	b, err = pub.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes failed: %v", err)
+	}
+	if _, err := PublicFromBytes(b); err == nil {
+		t.Errorf("PublicFromBytes should fail with an inconsistent authorization policy")
+	}
+
+	pub.AuthPolicy = nil
+	pub.NameAlg = HashAlgorithmNull
+	b, err = pub.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes failed: %v", err)
+	}
+	if _, err := PublicFromBytes(b); err == nil {
+		t.Errorf("PublicFromBytes should fail with an invalid name algorithm")
+	}
+}
+
+func TestNVPublicFromBytes(t *testing.T) {
+	pub := NVPublic{
+		Index:   0x01800000,
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead),
+		Size:    8}
+	b, err := pub.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes failed: %v", err)
+	}
+
+	pub2, err := NVPublicFromBytes(b)
+	if err != nil {
+		t.Fatalf("NVPublicFromBytes failed: %v", err)
+	}
+	if !reflect.DeepEqual(pub2, &pub) {
+		t.Errorf("NVPublicFromBytes returned an unexpected value: %#v", pub2)
+	}
+
+	pub.Index = 0x81000001
+	b, err = pub.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes failed: %v", err)
+	}
+	if _, err := NVPublicFromBytes(b); err == nil {
+		t.Errorf("NVPublicFromBytes should fail with an invalid handle")
+	}
+}
+
+func TestNameFromBytes(t *testing.T) {
+	for _, data := range []struct {
+		desc  string
+		in    []byte
+		valid bool
+	}{
+		{desc: "Handle", in: []byte{0x40, 0x00, 0x00, 0x01}, valid: true},
+		{desc: "SHA256", in: append([]byte{0x00, 0x0b}, make([]byte, 32)...), valid: true},
+		{desc: "SHA1", in: append([]byte{0x00, 0x04}, make([]byte, 20)...), valid: true},
+		{desc: "WrongSize", in: append([]byte{0x00, 0x0b}, make([]byte, 20)...)},
+		{desc: "UnknownAlg", in: append([]byte{0x00, 0x10}, make([]byte, 32)...)},
+		{desc: "Empty"},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			name, err := NameFromBytes(data.in)
+			if !data.valid {
+				if err == nil {
+					t.Errorf("NameFromBytes should have failed")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NameFromBytes failed: %v", err)
+			}
+			if !bytes.Equal(name, data.in) {
+				t.Errorf("NameFromBytes returned an unexpected name: %x", name)
+			}
+			if !name.IsValid() {
+				t.Errorf("IsValid returned false")
+			}
+		})
+	}
+}
+
+func TestSignatureECDSA(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	digest := sha256.Sum256([]byte("foo"))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	der, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	sig, err := NewECDSASignatureFromASN1(HashAlgorithmSHA256, der)
+	if err != nil {
+		t.Fatalf("NewECDSASignatureFromASN1 failed: %v", err)
+	}
+	if sig.SigAlg != SigSchemeAlgECDSA || sig.Signature.ECDSA.Hash != HashAlgorithmSHA256 {
+		t.Errorf("Unexpected signature: %#v", sig)
+	}
+
+	r2, s2, err := sig.ECDSA()
+	if err != nil {
+		t.Fatalf("ECDSA failed: %v", err)
+	}
+	if !ecdsa.Verify(&key.PublicKey, digest[:], r2, s2) {
+		t.Errorf("Signature verification failed")
+	}
+
+	der2, err := sig.ECDSAASN1()
+	if err != nil {
+		t.Fatalf("ECDSAASN1 failed: %v", err)
+	}
+	if !bytes.Equal(der2, der) {
+		t.Errorf("ECDSAASN1 returned unexpected bytes: %x", der2)
+	}
+
+	if _, err := sig.RSA(); err == nil {
+		t.Errorf("RSA should fail for an ECDSA signature")
+	}
+	if _, err := NewECDSASignatureFromASN1(HashAlgorithmSHA256, append(der, 0)); err == nil {
+		t.Errorf("NewECDSASignatureFromASN1 should fail with trailing bytes")
+	}
+}
+
+func TestSignatureRSA(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	digest := sha256.Sum256([]byte("foo"))
+
+	for _, data := range []struct {
+		desc   string
+		sign   func() ([]byte, error)
+		new    func(HashAlgorithmId, []byte) *Signature
+		verify func([]byte) error
+	}{
+		{
+			desc: "PKCS1v15",
+			sign: func() ([]byte, error) { return rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:]) },
+			new:  NewRSASSASignature,
+			verify: func(sig []byte) error {
+				return rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig)
+			},
+		},
+		{
+			desc: "PSS",
+			sign: func() ([]byte, error) {
+				return rsa.SignPSS(rand.Reader, key, crypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+			},
+			new: NewRSAPSSSignature,
+			verify: func(sig []byte) error {
+				return rsa.VerifyPSS(&key.PublicKey, crypto.SHA256, digest[:], sig, nil)
+			},
+		},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			b, err := data.sign()
+			if err != nil {
+				t.Fatalf("Sign failed: %v", err)
+			}
+			sig := data.new(HashAlgorithmSHA256, b)
+			if sig.Signature.Any().HashAlg != HashAlgorithmSHA256 {
+				t.Errorf("Unexpected digest algorithm")
+			}
+			b2, err := sig.RSA()
+			if err != nil {
+				t.Fatalf("RSA failed: %v", err)
+			}
+			if err := data.verify(b2); err != nil {
+				t.Errorf("Signature verification failed: %v", err)
+			}
+			if _, _, err := sig.ECDSA(); err == nil {
+				t.Errorf("ECDSA should fail for a RSA signature")
+			}
+		})
+	}
+}
+
 func TestNVPublicName(t *testing.T) {
 	tpm := openTPMForTesting(t, testutil.TPMFeatureOwnerPersist)
 	defer closeTPM(t, tpm)
@@ -734,6 +1201,17 @@ func TestPCRSelectionListRemove(t *testing.T) {
 				{Hash: HashAlgorithmSHA1, Select: []int{0, 1, 2, 3, 4, 5, 6}},
 				{Hash: HashAlgorithmSHA256, Select: []int{0, 1, 2, 3, 4, 5}}},
 		},
+		{
+			desc: "ConsecutiveEmptyResults",
+			x: PCRSelectionList{
+				{Hash: HashAlgorithmSHA1, Select: []int{0, 1}},
+				{Hash: HashAlgorithmSHA256, Select: []int{0, 1}},
+				{Hash: HashAlgorithmSHA384, Select: []int{0, 1}}},
+			y: PCRSelectionList{
+				{Hash: HashAlgorithmSHA1, Select: []int{0, 1}},
+				{Hash: HashAlgorithmSHA256, Select: []int{0, 1}}},
+			expected: PCRSelectionList{{Hash: HashAlgorithmSHA384, Select: []int{0, 1}}},
+		},
 	} {
 		t.Run(data.desc, func(t *testing.T) {
 			res := data.x.Remove(data.y)
@@ -743,3 +1221,111 @@ func TestPCRSelectionListRemove(t *testing.T) {
 		})
 	}
 }
+
+func TestPCRSelectionListIntersect(t *testing.T) {
+	for _, data := range []struct {
+		desc           string
+		x, y, expected PCRSelectionList
+	}{
+		{
+			desc:     "SingleSelection",
+			x:        PCRSelectionList{{Hash: HashAlgorithmSHA256, Select: []int{0, 1, 2, 3, 4, 5}}},
+			y:        PCRSelectionList{{Hash: HashAlgorithmSHA256, Select: []int{0, 2, 7, 4}}},
+			expected: PCRSelectionList{{Hash: HashAlgorithmSHA256, Select: []int{0, 2, 4}}},
+		},
+		{
+			desc:     "None",
+			x:        PCRSelectionList{{Hash: HashAlgorithmSHA256, Select: []int{0, 1, 2, 3, 4, 5}}},
+			y:        PCRSelectionList{{Hash: HashAlgorithmSHA1, Select: []int{0, 2, 3, 4}}},
+			expected: PCRSelectionList{},
+		},
+		{
+			desc: "MultipleSelection",
+			x: PCRSelectionList{
+				{Hash: HashAlgorithmSHA1, Select: []int{0, 1, 2, 3, 4, 5, 6}},
+				{Hash: HashAlgorithmSHA256, Select: []int{0, 1, 2, 3, 4, 5}}},
+			y: PCRSelectionList{
+				{Hash: HashAlgorithmSHA256, Select: []int{0, 4, 5, 16}},
+				{Hash: HashAlgorithmSHA1, Select: []int{1, 3, 6}}},
+			expected: PCRSelectionList{
+				{Hash: HashAlgorithmSHA1, Select: []int{1, 3, 6}},
+				{Hash: HashAlgorithmSHA256, Select: []int{0, 4, 5}}},
+		},
+		{
+			desc: "OneBankEmpty",
+			x: PCRSelectionList{
+				{Hash: HashAlgorithmSHA1, Select: []int{0, 1, 2}},
+				{Hash: HashAlgorithmSHA256, Select: []int{0, 1, 2}}},
+			y:        PCRSelectionList{{Hash: HashAlgorithmSHA256, Select: []int{2, 1}}},
+			expected: PCRSelectionList{{Hash: HashAlgorithmSHA256, Select: []int{1, 2}}},
+		},
+		{
+			desc:     "SplitBank",
+			x:        PCRSelectionList{{Hash: HashAlgorithmSHA256, Select: []int{0, 1, 2, 3}}},
+			y:        PCRSelectionList{{Hash: HashAlgorithmSHA256, Select: []int{0}}, {Hash: HashAlgorithmSHA256, Select: []int{3}}},
+			expected: PCRSelectionList{{Hash: HashAlgorithmSHA256, Select: []int{0, 3}}},
+		},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			res := data.x.Intersect(data.y)
+			if !reflect.DeepEqual(res, data.expected) {
+				t.Errorf("Unexpected result %v", res)
+			}
+		})
+	}
+}
+
+func TestPCRSelectionListIsSubsetOf(t *testing.T) {
+	for _, data := range []struct {
+		desc     string
+		x, y     PCRSelectionList
+		expected bool
+	}{
+		{
+			desc:     "Subset",
+			x:        PCRSelectionList{{Hash: HashAlgorithmSHA256, Select: []int{1, 5}}},
+			y:        PCRSelectionList{{Hash: HashAlgorithmSHA256, Select: []int{0, 1, 2, 3, 4, 5}}},
+			expected: true,
+		},
+		{
+			desc:     "Equal",
+			x:        PCRSelectionList{{Hash: HashAlgorithmSHA256, Select: []int{5, 1}}},
+			y:        PCRSelectionList{{Hash: HashAlgorithmSHA256, Select: []int{1, 5}}},
+			expected: true,
+		},
+		{
+			desc:     "Superset",
+			x:        PCRSelectionList{{Hash: HashAlgorithmSHA256, Select: []int{0, 1, 2, 3, 4, 5}}},
+			y:        PCRSelectionList{{Hash: HashAlgorithmSHA256, Select: []int{1, 5}}},
+			expected: false,
+		},
+		{
+			desc:     "DifferentBank",
+			x:        PCRSelectionList{{Hash: HashAlgorithmSHA1, Select: []int{1}}},
+			y:        PCRSelectionList{{Hash: HashAlgorithmSHA256, Select: []int{1}}},
+			expected: false,
+		},
+		{
+			desc: "MultipleBanksDifferentOrder",
+			x: PCRSelectionList{
+				{Hash: HashAlgorithmSHA256, Select: []int{7}},
+				{Hash: HashAlgorithmSHA1, Select: []int{1}}},
+			y: PCRSelectionList{
+				{Hash: HashAlgorithmSHA1, Select: []int{0, 1}},
+				{Hash: HashAlgorithmSHA256, Select: []int{7}}},
+			expected: true,
+		},
+		{
+			desc:     "Empty",
+			x:        PCRSelectionList{},
+			y:        PCRSelectionList{{Hash: HashAlgorithmSHA256, Select: []int{1}}},
+			expected: true,
+		},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			if data.x.IsSubsetOf(data.y) != data.expected {
+				t.Errorf("Unexpected result")
+			}
+		})
+	}
+}
@@ -5,13 +5,17 @@
 package tpm2
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"hash"
+	"io"
 	"sort"
 
 	"github.com/canonical/go-tpm2/mu"
+
+	"golang.org/x/xerrors"
 )
 
 // ComputeCpHash computes a command parameter digest from the specified command code and provided command parameters, using the
@@ -35,7 +39,7 @@ func ComputeCpHash(hashAlg HashAlgorithmId, command CommandCode, params ...inter
 		i++
 		switch p := param.(type) {
 		case Handle:
-			handles = append(handles, makeDummyContext(p).Name())
+			handles = append(handles, handleName(p))
 		case HandleContext:
 			handles = append(handles, p.Name())
 		default:
@@ -98,6 +102,37 @@ func ComputePCRDigestSimple(alg HashAlgorithmId, values PCRValues) (PCRSelection
 	return pcrs, digest, nil
 }
 
+// ComputeDigest computes a digest using the specified algorithm from the concatenation of the data read from each of the supplied
+// readers. The result is correctly sized for use as an input to commands that expect a digest produced with alg, such as
+// TPMContext.PolicyCpHash, TPMContext.PolicyNameHash or TPMContext.PolicyTemplate.
+func ComputeDigest(alg HashAlgorithmId, data ...io.Reader) (Digest, error) {
+	if !alg.Available() {
+		return nil, fmt.Errorf("unsupported digest algorithm %v", alg)
+	}
+	h := alg.NewHash()
+	for i, r := range data {
+		if _, err := io.Copy(h, r); err != nil {
+			return nil, xerrors.Errorf("cannot read data at index %d: %w", i, err)
+		}
+	}
+	return h.Sum(nil), nil
+}
+
+// MakeTaggedHashList computes a digest of data for each of the specified algorithms, and returns the results as a TaggedHashList.
+// This is useful for computing the digests argument of TPMContext.PCRExtend, where a digest is required for each of the active
+// PCR banks.
+func MakeTaggedHashList(data []byte, algs ...HashAlgorithmId) (TaggedHashList, error) {
+	out := make(TaggedHashList, 0, len(algs))
+	for _, alg := range algs {
+		d, err := ComputeDigest(alg, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, TaggedHash{HashAlg: alg, Digest: d})
+	}
+	return out, nil
+}
+
 // TrialAuthPolicy provides a mechanism for computing authorization policy digests without having to execute a trial authorization
 // policy session on the TPM. An advantage of this is that it is possible to compute digests for PolicySecret and PolicyNV assertions
 // without knowledge of the authorization value of the authorizing entities used for those commands.
@@ -192,6 +227,12 @@ func (p *TrialAuthPolicy) PolicyPCR(pcrDigest Digest, pcrs PCRSelectionList) {
 	end()
 }
 
+func (p *TrialAuthPolicy) PolicyLocality(locality Locality) {
+	h, end := p.beginUpdateForCommand(CommandPolicyLocality)
+	h.Write([]byte{uint8(locality)})
+	end()
+}
+
 func (p *TrialAuthPolicy) PolicyNV(nvIndexName Name, operandB Operand, offset uint16, operation ArithmeticOp) {
 	h := p.alg.NewHash()
 	h.Write(operandB)
@@ -273,6 +273,69 @@ func TestComputePCRDigestSimple(t *testing.T) {
 	}
 }
 
+func TestComputeDigest(t *testing.T) {
+	for _, data := range []struct {
+		desc string
+		alg  HashAlgorithmId
+		data [][]byte
+	}{
+		{desc: "SHA256", alg: HashAlgorithmSHA256, data: [][]byte{[]byte("foo")}},
+		{desc: "SHA1", alg: HashAlgorithmSHA1, data: [][]byte{[]byte("foo")}},
+		{desc: "Multiple", alg: HashAlgorithmSHA256, data: [][]byte{[]byte("foo"), []byte("bar")}},
+		{desc: "None", alg: HashAlgorithmSHA384},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			var readers []io.Reader
+			h := data.alg.NewHash()
+			for _, d := range data.data {
+				readers = append(readers, bytes.NewReader(d))
+				h.Write(d)
+			}
+
+			digest, err := ComputeDigest(data.alg, readers...)
+			if err != nil {
+				t.Fatalf("ComputeDigest failed: %v", err)
+			}
+			if !bytes.Equal(digest, h.Sum(nil)) {
+				t.Errorf("Unexpected digest %x", digest)
+			}
+		})
+	}
+
+	if _, err := ComputeDigest(HashAlgorithmNull); err == nil {
+		t.Errorf("ComputeDigest should fail with an unsupported algorithm")
+	}
+}
+
+func TestMakeTaggedHashList(t *testing.T) {
+	l, err := MakeTaggedHashList([]byte("foo"), HashAlgorithmSHA1, HashAlgorithmSHA256)
+	if err != nil {
+		t.Fatalf("MakeTaggedHashList failed: %v", err)
+	}
+	if len(l) != 2 {
+		t.Fatalf("Unexpected number of digests: %d", len(l))
+	}
+	for i, alg := range []HashAlgorithmId{HashAlgorithmSHA1, HashAlgorithmSHA256} {
+		h := alg.NewHash()
+		h.Write([]byte("foo"))
+		if l[i].HashAlg != alg {
+			t.Errorf("Unexpected algorithm at index %d: %v", i, l[i].HashAlg)
+		}
+		if !bytes.Equal(l[i].Digest, h.Sum(nil)) {
+			t.Errorf("Unexpected digest at index %d: %x", i, l[i].Digest)
+		}
+	}
+
+	// The result must marshal correctly as a TPML_DIGEST_VALUES
+	if _, err := mu.MarshalToBytes(l); err != nil {
+		t.Errorf("MarshalToBytes failed: %v", err)
+	}
+
+	if _, err := MakeTaggedHashList([]byte("foo"), HashAlgorithmSHA256, HashAlgorithmNull); err == nil {
+		t.Errorf("MakeTaggedHashList should fail with an unsupported algorithm")
+	}
+}
+
 func TestTrialPolicySigned(t *testing.T) {
 	tpm := openTPMForTesting(t, testutil.TPMFeatureOwnerHierarchy)
 	defer closeTPM(t, tpm)
@@ -746,6 +809,60 @@ func TestTrialPolicyCommandCode(t *testing.T) {
 	}
 }
 
+func TestTrialPolicyLocality(t *testing.T) {
+	tpm := openTPMForTesting(t, 0)
+	defer closeTPM(t, tpm)
+
+	for _, data := range []struct {
+		desc     string
+		alg      HashAlgorithmId
+		locality Locality
+	}{
+		{
+			desc:     "Three",
+			alg:      HashAlgorithmSHA256,
+			locality: 1 << LocalityThree,
+		},
+		{
+			desc:     "ZeroAndFour",
+			alg:      HashAlgorithmSHA256,
+			locality: 1<<LocalityZero | 1<<LocalityFour,
+		},
+		{
+			desc:     "SHA1",
+			alg:      HashAlgorithmSHA1,
+			locality: 1 << LocalityTwo,
+		},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			sessionContext, err := tpm.StartAuthSession(nil, nil, SessionTypeTrial, nil, data.alg)
+			if err != nil {
+				t.Fatalf("StartAuthSession failed: %v", err)
+			}
+			defer flushContext(t, tpm, sessionContext)
+
+			if err := tpm.PolicyLocality(sessionContext, data.locality); err != nil {
+				t.Fatalf("PolicyLocality failed: %v", err)
+			}
+
+			trial, err := ComputeAuthPolicy(data.alg)
+			if err != nil {
+				t.Fatalf("ComputeAuthPolicy failed: %v", err)
+			}
+			trial.PolicyLocality(data.locality)
+
+			tpmDigest, err := tpm.PolicyGetDigest(sessionContext)
+			if err != nil {
+				t.Fatalf("PolicyGetDigest failed: %v", err)
+			}
+
+			if !bytes.Equal(tpmDigest, trial.GetDigest()) {
+				t.Errorf("Unexpected digest")
+			}
+		})
+	}
+}
+
 func TestTrialPolicyCpHash(t *testing.T) {
 	tpm := openTPMForTesting(t, 0)
 	defer closeTPM(t, tpm)
@@ -0,0 +1,101 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// VendorInfo contains information that identifies the manufacturer and firmware of a TPM, and is returned from
+// TPMContext.GetVendorInfo.
+type VendorInfo struct {
+	Manufacturer    TPMManufacturer // TPM_PT_MANUFACTURER
+	VendorString    string          // TPM_PT_VENDOR_STRING_1 to TPM_PT_VENDOR_STRING_4, decoded as a string
+	FirmwareVersion [2]uint32       // TPM_PT_FIRMWARE_VERSION_1 and TPM_PT_FIRMWARE_VERSION_2
+
+	// Version is the firmware version formatted according to the convention used by the manufacturer, if this is known. If it
+	// isn't, it is formatted as 4 dot separated decimal numbers obtained from the most and least significant 16-bits of each
+	// firmware version property.
+	Version string
+
+	// VendorData contains additional vendor-specific information added by a VendorInfoDecoder.
+	VendorData map[string]interface{}
+}
+
+// VendorInfoDecoder decodes vendor-specific information for TPMs made by a particular manufacturer. It is called from
+// TPMContext.GetVendorInfo with the information obtained from the standard properties, and may update Version according to the
+// manufacturer's convention and add entries to VendorData. It may use the supplied TPMContext to obtain additional information from
+// the TPM, such as vendor-specific properties.
+type VendorInfoDecoder func(tpm *TPMContext, info *VendorInfo) error
+
+var vendorInfoDecoders = map[TPMManufacturer]VendorInfoDecoder{
+	TPMManufacturerIFX: decodeInfineonVendorInfo}
+
+// RegisterVendorInfoDecoder registers a decoder for vendor-specific information for TPMs made by the specified manufacturer,
+// replacing any previously registered decoder for that manufacturer, including the decoders provided by this package. Passing a nil
+// decoder removes the registration. This isn't safe to call concurrently with TPMContext.GetVendorInfo, and should normally be
+// called from an init function.
+func RegisterVendorInfoDecoder(manufacturer TPMManufacturer, decoder VendorInfoDecoder) {
+	if decoder == nil {
+		delete(vendorInfoDecoders, manufacturer)
+		return
+	}
+	vendorInfoDecoders[manufacturer] = decoder
+}
+
+// decodeInfineonVendorInfo formats the firmware version of Infineon TPMs, which encode the third and fourth components in the
+// most significant 24-bits and least significant 8-bits of TPM_PT_FIRMWARE_VERSION_2 (eg, 7.85.4555.0).
+func decodeInfineonVendorInfo(_ *TPMContext, info *VendorInfo) error {
+	info.Version = fmt.Sprintf("%d.%d.%d.%d", info.FirmwareVersion[0]>>16, info.FirmwareVersion[0]&0xffff,
+		info.FirmwareVersion[1]>>8, info.FirmwareVersion[1]&0xff)
+	return nil
+}
+
+func decodeVendorString(values [4]uint32) string {
+	var vendor []byte
+	for _, v := range values {
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], v)
+		vendor = append(vendor, b[:]...)
+	}
+	return strings.TrimSpace(strings.Trim(string(vendor), "\x00"))
+}
+
+// GetVendorInfo is a helper function that wraps around TPMContext.GetCapability in order to obtain information that identifies the
+// manufacturer and firmware of the TPM. If a VendorInfoDecoder is registered for the manufacturer, it is used to decode
+// vendor-specific information, and any error that it returns is returned from this function.
+func (t *TPMContext) GetVendorInfo(sessions ...SessionContext) (*VendorInfo, error) {
+	props, err := t.GetCapabilityTPMProperties(PropertyManufacturer, uint32(PropertyFirmwareVersion2-PropertyManufacturer)+1, sessions...)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[Property]uint32)
+	for _, p := range props {
+		values[p.Property] = p.Value
+	}
+
+	info := &VendorInfo{
+		Manufacturer: TPMManufacturer(values[PropertyManufacturer]),
+		VendorString: decodeVendorString([4]uint32{values[PropertyVendorString1], values[PropertyVendorString2],
+			values[PropertyVendorString3], values[PropertyVendorString4]}),
+		FirmwareVersion: [2]uint32{values[PropertyFirmwareVersion1], values[PropertyFirmwareVersion2]},
+		VendorData:      make(map[string]interface{})}
+	manufacturer := info.Manufacturer
+	t.manufacturer = &manufacturer
+	info.Version = fmt.Sprintf("%d.%d.%d.%d", info.FirmwareVersion[0]>>16, info.FirmwareVersion[0]&0xffff,
+		info.FirmwareVersion[1]>>16, info.FirmwareVersion[1]&0xffff)
+
+	if decoder, ok := vendorInfoDecoders[info.Manufacturer]; ok {
+		if err := decoder(t, info); err != nil {
+			return nil, xerrors.Errorf("cannot decode vendor information for %v: %w", info.Manufacturer, err)
+		}
+	}
+
+	return info, nil
+}
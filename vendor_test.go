@@ -0,0 +1,104 @@
+// Copyright 2019 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+func mockVendorInfoCommand(manufacturer TPMManufacturer, vendor string, fw1, fw2 uint32) *testutil.MockCommand {
+	var vendorBytes [16]byte
+	copy(vendorBytes[:], vendor)
+	var values [4]uint32
+	mu.UnmarshalFromBytes(vendorBytes[:], &values[0], &values[1], &values[2], &values[3])
+
+	return mockTPMPropertiesCommand(
+		TaggedProperty{Property: PropertyManufacturer, Value: uint32(manufacturer)},
+		TaggedProperty{Property: PropertyVendorString1, Value: values[0]},
+		TaggedProperty{Property: PropertyVendorString2, Value: values[1]},
+		TaggedProperty{Property: PropertyVendorString3, Value: values[2]},
+		TaggedProperty{Property: PropertyVendorString4, Value: values[3]},
+		TaggedProperty{Property: PropertyVendorTPMType, Value: 0},
+		TaggedProperty{Property: PropertyFirmwareVersion1, Value: fw1},
+		TaggedProperty{Property: PropertyFirmwareVersion2, Value: fw2})
+}
+
+func TestGetVendorInfo(t *testing.T) {
+	for _, data := range []struct {
+		desc         string
+		manufacturer TPMManufacturer
+		vendor       string
+		fw1, fw2     uint32
+		version      string
+	}{
+		{
+			desc:         "Infineon",
+			manufacturer: TPMManufacturerIFX,
+			vendor:       "SLB9670",
+			fw1:          0x00070055,
+			fw2:          0x0011cb00,
+			version:      "7.85.4555.0",
+		},
+		{
+			desc:         "Default",
+			manufacturer: TPMManufacturerIBM,
+			vendor:       "SW   TPM",
+			fw1:          0x20191023,
+			fw2:          0x00163636,
+			version:      "8217.4131.22.13878",
+		},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			tcti := testutil.NewMockTCTI(mockVendorInfoCommand(data.manufacturer, data.vendor, data.fw1, data.fw2))
+			tpm, _ := NewTPMContext(tcti)
+
+			info, err := tpm.GetVendorInfo()
+			if err != nil {
+				t.Fatalf("GetVendorInfo failed: %v", err)
+			}
+			if info.Manufacturer != data.manufacturer || info.VendorString != data.vendor ||
+				info.FirmwareVersion != [2]uint32{data.fw1, data.fw2} || info.Version != data.version {
+				t.Errorf("Unexpected info: %#v", info)
+			}
+		})
+	}
+}
+
+func TestRegisterVendorInfoDecoder(t *testing.T) {
+	RegisterVendorInfoDecoder(TPMManufacturerNTC, func(tpm *TPMContext, info *VendorInfo) error {
+		props, err := tpm.GetCapabilityTPMProperties(PropertyFirmwareVersion1, 1)
+		if err != nil {
+			return err
+		}
+		info.Version = "custom"
+		info.VendorData["fw1"] = props[0].Value
+		return nil
+	})
+	defer RegisterVendorInfoDecoder(TPMManufacturerNTC, nil)
+
+	tcti := testutil.NewMockTCTI(
+		mockVendorInfoCommand(TPMManufacturerNTC, "NPCT75x", 0x00070002, 0x00010000),
+		mockTPMPropertiesCommand(TaggedProperty{Property: PropertyFirmwareVersion1, Value: 0x00070002}))
+	tpm, _ := NewTPMContext(tcti)
+
+	info, err := tpm.GetVendorInfo()
+	if err != nil {
+		t.Fatalf("GetVendorInfo failed: %v", err)
+	}
+	if info.Version != "custom" || info.VendorData["fw1"] != uint32(0x00070002) {
+		t.Errorf("Unexpected info: %#v", info)
+	}
+
+	RegisterVendorInfoDecoder(TPMManufacturerNTC, func(*TPMContext, *VendorInfo) error { return errors.New("some error") })
+	tcti.Expect(mockVendorInfoCommand(TPMManufacturerNTC, "NPCT75x", 0x00070002, 0x00010000))
+	if _, err := tpm.GetVendorInfo(); err == nil || err.Error() != "cannot decode vendor information for Nuvoton Technology: some error" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}